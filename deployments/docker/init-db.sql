@@ -27,3 +27,7 @@ GRANT ALL PRIVILEGES ON DATABASE notification_db TO postgres;
 -- Create cart_db database
 CREATE DATABASE cart_db;
 GRANT ALL PRIVILEGES ON DATABASE cart_db TO postgres;
+
+-- Create events_db database
+CREATE DATABASE events_db;
+GRANT ALL PRIVILEGES ON DATABASE events_db TO postgres;
@@ -2,13 +2,13 @@
 
 import { useMemo, useState } from 'react';
 import { useQueryClient } from '@tanstack/react-query';
-import { Plus, Trash } from 'lucide-react';
+import { Download, Plus, Trash, Upload } from 'lucide-react';
 import { Button } from '@/components/ui/button';
 import { Card, CardContent, CardHeader, CardTitle } from '@/components/ui/card';
 import { Input } from '@/components/ui/input';
 import { Label } from '@/components/ui/label';
 import { useCategories, useProducts } from '@/hooks/use-products';
-import { adminApi } from '@/lib/api';
+import { adminApi, type ImportProductsResponse } from '@/lib/api';
 
 function formatMoney(amountCents?: number, currency = 'USD') {
   const amount = (amountCents ?? 0) / 100;
@@ -33,6 +33,10 @@ export default function AdminProductsPage() {
     stock_quantity: '10',
   });
 
+  const [importFile, setImportFile] = useState<File | null>(null);
+  const [importing, setImporting] = useState(false);
+  const [importReport, setImportReport] = useState<ImportProductsResponse | null>(null);
+
   const products = productsData?.products ?? [];
   const defaultCategoryId = useMemo(() => categories[0]?.id ?? '', [categories]);
 
@@ -70,6 +74,32 @@ export default function AdminProductsPage() {
     }
   };
 
+  const importProducts = async (dryRun: boolean) => {
+    if (!importFile) {
+      return;
+    }
+
+    setImporting(true);
+    try {
+      setImportReport(await adminApi.importProducts(importFile, dryRun));
+      if (!dryRun) {
+        queryClient.invalidateQueries({ queryKey: ['products'] });
+      }
+    } finally {
+      setImporting(false);
+    }
+  };
+
+  const exportProducts = async () => {
+    const blob = await adminApi.exportProducts('csv');
+    const url = URL.createObjectURL(blob);
+    const link = document.createElement('a');
+    link.href = url;
+    link.download = 'products.csv';
+    link.click();
+    URL.revokeObjectURL(url);
+  };
+
   const removeProduct = async (id: string) => {
     await adminApi.deleteProduct(id);
     queryClient.invalidateQueries({ queryKey: ['products'] });
@@ -79,12 +109,64 @@ export default function AdminProductsPage() {
     <div>
       <div className="flex items-center justify-between mb-6">
         <h1 className="text-3xl font-bold">Products</h1>
-        <Button onClick={() => setShowForm((prev) => !prev)}>
-          <Plus className="h-4 w-4 mr-2" />
-          {showForm ? 'Cancel' : 'Add Product'}
-        </Button>
+        <div className="flex space-x-2">
+          <Button variant="outline" onClick={exportProducts}>
+            <Download className="h-4 w-4 mr-2" />
+            Export CSV
+          </Button>
+          <Button onClick={() => setShowForm((prev) => !prev)}>
+            <Plus className="h-4 w-4 mr-2" />
+            {showForm ? 'Cancel' : 'Add Product'}
+          </Button>
+        </div>
       </div>
 
+      <Card className="mb-6">
+        <CardHeader>
+          <CardTitle>Import Products</CardTitle>
+        </CardHeader>
+        <CardContent className="space-y-4">
+          <div className="flex items-center space-x-2">
+            <Input
+              type="file"
+              accept=".csv,.json"
+              onChange={(e) => {
+                setImportFile(e.target.files?.[0] ?? null);
+                setImportReport(null);
+              }}
+            />
+            <Button variant="outline" onClick={() => importProducts(true)} disabled={!importFile || importing}>
+              Dry Run
+            </Button>
+            <Button onClick={() => importProducts(false)} disabled={!importFile || importing}>
+              <Upload className="h-4 w-4 mr-2" />
+              {importing ? 'Importing...' : 'Import'}
+            </Button>
+          </div>
+          {importReport && (
+            <div className="space-y-2 text-sm">
+              <p>
+                {importReport.dry_run ? 'Would create' : 'Created'} {importReport.created ?? 0},{' '}
+                {importReport.dry_run ? 'would update' : 'updated'} {importReport.updated ?? 0} of{' '}
+                {importReport.total_rows ?? 0} rows; {importReport.failed ?? 0} failed.
+              </p>
+              {importReport.errors?.map((error) => (
+                <p key={error.row} className="text-destructive">
+                  Row {error.row}
+                  {error.slug ? ` (${error.slug})` : ''}: {error.message}
+                </p>
+              ))}
+              {importReport.warnings?.map((warning) => (
+                <p key={warning.row} className="text-muted-foreground">
+                  Row {warning.row}
+                  {warning.slug ? ` (${warning.slug})` : ''}: {warning.message}
+                </p>
+              ))}
+            </div>
+          )}
+        </CardContent>
+      </Card>
+
       {showForm && (
         <Card className="mb-6">
           <CardHeader>
@@ -132,7 +214,7 @@ export default function AdminProductsPage() {
                 />
               </div>
               <div className="space-y-2">
-                <Label>Stock</Label>
+                <Label>Opening stock</Label>
                 <Input
                   value={form.stock_quantity}
                   onChange={(e) => setForm((prev) => ({ ...prev, stock_quantity: e.target.value }))}
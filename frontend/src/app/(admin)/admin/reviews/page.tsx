@@ -0,0 +1,108 @@
+'use client';
+
+import { useState } from 'react';
+import { useQuery, useQueryClient } from '@tanstack/react-query';
+import { Check, X } from 'lucide-react';
+import { Button } from '@/components/ui/button';
+import { Card, CardContent } from '@/components/ui/card';
+import { Input } from '@/components/ui/input';
+import { StarRating } from '@/components/products/product-reviews';
+import { adminApi, type ReviewStatusName } from '@/lib/api';
+
+export default function AdminReviewsPage() {
+  const queryClient = useQueryClient();
+  const [status, setStatus] = useState<ReviewStatusName>('pending');
+  const [notes, setNotes] = useState<Record<string, string>>({});
+  const [moderating, setModerating] = useState<string | null>(null);
+
+  const { data, isLoading } = useQuery({
+    queryKey: ['admin', 'reviews', status],
+    queryFn: () => adminApi.listReviews({ status, page: 1, page_size: 50 }),
+  });
+  const reviews = data?.reviews ?? [];
+
+  const moderate = async (id: string, next: ReviewStatusName) => {
+    setModerating(id);
+    try {
+      await adminApi.moderateReview(id, { status: next, note: notes[id] });
+      queryClient.invalidateQueries({ queryKey: ['admin', 'reviews'] });
+      queryClient.invalidateQueries({ queryKey: ['products'] });
+    } finally {
+      setModerating(null);
+    }
+  };
+
+  return (
+    <div>
+      <div className="flex items-center justify-between mb-6">
+        <h1 className="text-3xl font-bold">Reviews</h1>
+        <select
+          className="h-9 rounded-md border bg-background px-2 text-sm"
+          value={status}
+          onChange={(e) => setStatus(e.target.value as ReviewStatusName)}
+        >
+          <option value="pending">Pending</option>
+          <option value="approved">Approved</option>
+          <option value="rejected">Rejected</option>
+        </select>
+      </div>
+
+      {isLoading ? (
+        <p className="text-muted-foreground">Loading reviews...</p>
+      ) : reviews.length === 0 ? (
+        <Card>
+          <CardContent className="pt-6 text-muted-foreground">No {status} reviews.</CardContent>
+        </Card>
+      ) : (
+        <div className="space-y-4">
+          {reviews.map((review) => (
+            <Card key={review.id}>
+              <CardContent className="pt-6">
+                <div className="flex items-center gap-2 mb-1">
+                  <StarRating rating={review.rating} />
+                  <span className="font-semibold">{review.title}</span>
+                </div>
+                <p className="text-xs text-muted-foreground mb-2">
+                  Product {review.product_id} · User {review.user_id} · Order {review.order_id} ·{' '}
+                  {new Date(review.created_at).toLocaleDateString()}
+                </p>
+                <p className="text-sm mb-4 whitespace-pre-line">{review.body}</p>
+                {review.moderation_note && (
+                  <p className="text-sm text-muted-foreground mb-4">Note: {review.moderation_note}</p>
+                )}
+                <div className="flex flex-col md:flex-row gap-2">
+                  <Input
+                    placeholder="Note for the customer (optional)"
+                    value={notes[review.id] ?? ''}
+                    onChange={(e) => setNotes({ ...notes, [review.id]: e.target.value })}
+                  />
+                  {status !== 'approved' && (
+                    <Button
+                      size="sm"
+                      onClick={() => moderate(review.id, 'approved')}
+                      disabled={moderating === review.id}
+                    >
+                      <Check className="h-4 w-4 mr-2" />
+                      Approve
+                    </Button>
+                  )}
+                  {status !== 'rejected' && (
+                    <Button
+                      size="sm"
+                      variant="outline"
+                      onClick={() => moderate(review.id, 'rejected')}
+                      disabled={moderating === review.id}
+                    >
+                      <X className="h-4 w-4 mr-2" />
+                      Reject
+                    </Button>
+                  )}
+                </div>
+              </CardContent>
+            </Card>
+          ))}
+        </div>
+      )}
+    </div>
+  );
+}
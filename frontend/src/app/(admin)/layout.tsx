@@ -1,5 +1,5 @@
 import Link from 'next/link';
-import { LayoutDashboard, Package, ShoppingCart, Users } from 'lucide-react';
+import { LayoutDashboard, MessageSquare, Package, ShoppingCart, Users } from 'lucide-react';
 import { AdminRoute } from '@/components/auth/admin-route';
 import { AdminHeader } from '@/components/admin/admin-header';
 
@@ -38,6 +38,13 @@ export default function AdminLayout({
                 <ShoppingCart className="h-5 w-5" />
                 <span>Orders</span>
               </Link>
+              <Link
+                href="/admin/reviews"
+                className="flex items-center space-x-2 px-4 py-2 rounded-lg hover:bg-muted"
+              >
+                <MessageSquare className="h-5 w-5" />
+                <span>Reviews</span>
+              </Link>
               <Link
                 href="/admin/users"
                 className="flex items-center space-x-2 px-4 py-2 rounded-lg hover:bg-muted"
@@ -6,7 +6,6 @@ import { Button } from '@/components/ui/button';
 import { Card, CardContent, CardFooter, CardHeader, CardTitle } from '@/components/ui/card';
 import { useAddToCart } from '@/hooks/use-cart';
 import { useWishlist } from '@/hooks/use-user';
-import { productsApi } from '@/lib/api';
 
 export default function WishlistPage() {
   const { data: wishlist = [], isLoading } = useWishlist();
@@ -16,13 +15,9 @@ export default function WishlistPage() {
   const moveToCart = async (productId: string) => {
     setLoadingProduct(productId);
     try {
-      const product = await productsApi.getProduct(productId);
       await addToCart.mutateAsync({
-        product_id: product.id,
-        product_name: product.name,
+        product_id: productId,
         quantity: 1,
-        unit_price: product.price,
-        image_url: product.image_urls?.[0],
       });
     } finally {
       setLoadingProduct(null);
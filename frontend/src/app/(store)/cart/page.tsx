@@ -3,7 +3,17 @@
 import Link from 'next/link';
 import { Button } from '@/components/ui/button';
 import { Card, CardContent, CardHeader, CardTitle } from '@/components/ui/card';
-import { useCart, useClearCart, useRemoveFromCart, useUpdateCartItem } from '@/hooks/use-cart';
+import type { CartItem } from '@/lib/api';
+import {
+  useAcceptPriceChanges,
+  useCart,
+  useClearCart,
+  useMoveToCart,
+  useRemoveFromCart,
+  useRemoveSavedItem,
+  useSaveForLater,
+  useUpdateCartItem,
+} from '@/hooks/use-cart';
 
 function formatMoney(amountCents?: number, currency = 'USD') {
   const amount = (amountCents ?? 0) / 100;
@@ -13,13 +23,29 @@ function formatMoney(amountCents?: number, currency = 'USD') {
   }).format(amount);
 }
 
+function lineKey(item: CartItem) {
+  return item.variant_id ? `${item.product_id}/${item.variant_id}` : item.product_id;
+}
+
+function variantLabel(item: CartItem) {
+  return Object.entries(item.variant_options ?? {})
+    .map(([name, value]) => `${name}: ${value}`)
+    .join(', ');
+}
+
 export default function CartPage() {
   const { data: cart, isLoading } = useCart();
   const updateItem = useUpdateCartItem();
   const removeItem = useRemoveFromCart();
   const clearCart = useClearCart();
+  const saveForLater = useSaveForLater();
+  const moveToCart = useMoveToCart();
+  const removeSavedItem = useRemoveSavedItem();
+  const acceptPriceChanges = useAcceptPriceChanges();
 
   const items = cart?.items ?? [];
+  const pricesChanged = items.some((item) => item.price_changed && !item.unavailable);
+  const savedItems = cart?.saved_items ?? [];
 
   return (
     <div className="container mx-auto px-4 py-8">
@@ -40,15 +66,27 @@ export default function CartPage() {
         <div className="grid grid-cols-1 lg:grid-cols-3 gap-8">
           <div className="lg:col-span-2 space-y-4">
             {items.map((item) => (
-              <Card key={item.product_id}>
+              <Card key={lineKey(item)}>
                 <CardContent className="p-6">
                   <div className="flex items-center space-x-4">
                     <div className="w-24 h-24 bg-muted rounded-md" />
                     <div className="flex-1">
                       <h3 className="font-semibold">{item.product_name}</h3>
+                      {item.variant_id && (
+                        <p className="text-sm text-muted-foreground">{variantLabel(item)}</p>
+                      )}
                       <p className="text-sm text-muted-foreground">
                         {formatMoney(item.unit_price?.amount_cents, item.unit_price?.currency)}
                       </p>
+                      {item.price_changed && (
+                        <p className="text-sm text-amber-600">
+                          Price changed from{' '}
+                          {formatMoney(item.added_unit_price?.amount_cents, item.added_unit_price?.currency)}
+                        </p>
+                      )}
+                      {item.unavailable && (
+                        <p className="text-sm text-destructive">No longer available</p>
+                      )}
                     </div>
                     <div className="flex items-center space-x-2">
                       <Button
@@ -56,7 +94,7 @@ export default function CartPage() {
                         size="sm"
                         onClick={() =>
                           updateItem.mutate({
-                            productId: item.product_id,
+                            line: item,
                             quantity: Math.max(1, item.quantity - 1),
                           })
                         }
@@ -69,7 +107,7 @@ export default function CartPage() {
                         size="sm"
                         onClick={() =>
                           updateItem.mutate({
-                            productId: item.product_id,
+                            line: item,
                             quantity: item.quantity + 1,
                           })
                         }
@@ -77,10 +115,17 @@ export default function CartPage() {
                         +
                       </Button>
                     </div>
+                    <Button
+                      variant="outline"
+                      size="sm"
+                      onClick={() => saveForLater.mutate(item)}
+                    >
+                      Save for later
+                    </Button>
                     <Button
                       variant="destructive"
                       size="sm"
-                      onClick={() => removeItem.mutate(item.product_id)}
+                      onClick={() => removeItem.mutate(item)}
                     >
                       Remove
                     </Button>
@@ -106,9 +151,26 @@ export default function CartPage() {
                     <span>{formatMoney(cart?.total?.amount_cents, cart?.total?.currency)}</span>
                   </div>
                 </div>
-                <Button className="w-full" size="lg" asChild>
-                  <Link href="/checkout">Proceed to Checkout</Link>
-                </Button>
+                {pricesChanged ? (
+                  <>
+                    <p className="text-sm text-amber-600">
+                      Some prices changed since you added the items. Accept the new prices to
+                      check out.
+                    </p>
+                    <Button
+                      className="w-full"
+                      size="lg"
+                      onClick={() => acceptPriceChanges.mutate()}
+                      disabled={acceptPriceChanges.isPending}
+                    >
+                      Accept New Prices
+                    </Button>
+                  </>
+                ) : (
+                  <Button className="w-full" size="lg" asChild>
+                    <Link href="/checkout">Proceed to Checkout</Link>
+                  </Button>
+                )}
                 <Button
                   variant="outline"
                   className="w-full"
@@ -122,6 +184,57 @@ export default function CartPage() {
           </div>
         </div>
       )}
+
+      {savedItems.length > 0 && (
+        <div className="mt-12">
+          <h2 className="text-2xl font-bold mb-4">Saved for Later</h2>
+          <div className="space-y-4 lg:w-2/3">
+            {savedItems.map((item) => (
+              <Card key={lineKey(item)}>
+                <CardContent className="p-6">
+                  <div className="flex items-center space-x-4">
+                    <div className="w-24 h-24 bg-muted rounded-md" />
+                    <div className="flex-1">
+                      <h3 className="font-semibold">{item.product_name}</h3>
+                      {item.variant_id && (
+                        <p className="text-sm text-muted-foreground">{variantLabel(item)}</p>
+                      )}
+                      <p className="text-sm text-muted-foreground">
+                        {item.quantity} ×{' '}
+                        {formatMoney(item.unit_price?.amount_cents, item.unit_price?.currency)}
+                      </p>
+                      {item.price_changed && (
+                        <p className="text-sm text-amber-600">
+                          Price changed from{' '}
+                          {formatMoney(item.added_unit_price?.amount_cents, item.added_unit_price?.currency)}
+                        </p>
+                      )}
+                      {item.unavailable && (
+                        <p className="text-sm text-destructive">No longer available</p>
+                      )}
+                    </div>
+                    <Button
+                      variant="outline"
+                      size="sm"
+                      onClick={() => moveToCart.mutate(item)}
+                      disabled={item.unavailable}
+                    >
+                      Move to cart
+                    </Button>
+                    <Button
+                      variant="destructive"
+                      size="sm"
+                      onClick={() => removeSavedItem.mutate(item)}
+                    >
+                      Remove
+                    </Button>
+                  </div>
+                </CardContent>
+              </Card>
+            ))}
+          </div>
+        </div>
+      )}
     </div>
   );
 }
@@ -1,9 +1,11 @@
 'use client';
 
+import { useState } from 'react';
 import Link from 'next/link';
 import { useParams } from 'next/navigation';
 import { Button } from '@/components/ui/button';
 import { Card, CardContent } from '@/components/ui/card';
+import { ProductReviews, StarRating } from '@/components/products/product-reviews';
 import { useAddToCart } from '@/hooks/use-cart';
 import { useProduct } from '@/hooks/use-products';
 import { useAddToWishlist } from '@/hooks/use-user';
@@ -23,6 +25,7 @@ export default function ProductDetailPage() {
   const { data: product, isLoading, isError } = useProduct(productId);
   const addToCart = useAddToCart();
   const addToWishlist = useAddToWishlist();
+  const [selected, setSelected] = useState<Record<string, string>>({});
 
   if (isLoading) {
     return <div className="container mx-auto px-4 py-8 text-muted-foreground">Loading product...</div>;
@@ -43,13 +46,41 @@ export default function ProductDetailPage() {
     );
   }
 
+  // Products with variants are sold one variant at a time, picked by
+  // choosing a value of each option
+  const options = product.options ?? [];
+  const hasVariants = (product.variants?.length ?? 0) > 0;
+  const variant = product.variants?.find((candidate) =>
+    options.every((option) => candidate.options[option.name] === selected[option.name])
+  );
+  const price = variant?.price ?? product.price;
+  // Variants with their own price are not on sale
+  const compareAt = variant?.price_override ? undefined : product.compare_at_price;
+  const stock = hasVariants ? variant?.stock_quantity ?? 0 : product.stock_quantity;
+  const imageUrl = variant?.image_urls?.[0] ?? product.image_urls?.[0];
+
   return (
     <div className="container mx-auto px-4 py-8">
+      {product.breadcrumbs && product.breadcrumbs.length > 0 && (
+        <nav className="mb-6 text-sm text-muted-foreground">
+          <Link href="/products" className="hover:underline">
+            Products
+          </Link>
+          {product.breadcrumbs.map((category) => (
+            <span key={category.id}>
+              {' / '}
+              <Link href={`/products?category_id=${category.id}`} className="hover:underline">
+                {category.name}
+              </Link>
+            </span>
+          ))}
+        </nav>
+      )}
       <div className="grid grid-cols-1 md:grid-cols-2 gap-8">
         <div className="aspect-square bg-muted rounded-lg overflow-hidden">
-          {product.image_urls?.[0] ? (
+          {imageUrl ? (
             <img
-              src={product.image_urls[0]}
+              src={imageUrl}
               alt={product.name}
               className="h-full w-full object-cover"
               onError={(event) => {
@@ -61,11 +92,49 @@ export default function ProductDetailPage() {
 
         <div>
           <h1 className="text-3xl font-bold mb-4">{product.name}</h1>
+          {(product.rating_count ?? 0) > 0 && (
+            <p className="flex items-center gap-2 mb-4 text-sm text-muted-foreground">
+              <StarRating rating={product.rating_average ?? 0} />
+              {(product.rating_average ?? 0).toFixed(1)} ({product.rating_count} reviews)
+            </p>
+          )}
           <p className="text-2xl font-bold mb-4">
-            {formatMoney(product.price?.amount_cents, product.price?.currency)}
+            {formatMoney(price?.amount_cents, price?.currency)}
+            {compareAt && (
+              <span className="ml-3 text-lg font-normal text-muted-foreground line-through">
+                {formatMoney(compareAt.amount_cents, compareAt.currency)}
+              </span>
+            )}
           </p>
+          {compareAt && product.sale_ends_at && (
+            <p className="-mt-3 mb-4 text-sm text-muted-foreground">
+              Sale ends {new Date(product.sale_ends_at).toLocaleDateString()}
+            </p>
+          )}
           <p className="text-muted-foreground mb-6">{product.description}</p>
 
+          {hasVariants && (
+            <div className="space-y-4 mb-6">
+              {options.map((option) => (
+                <div key={option.name}>
+                  <p className="text-sm font-medium mb-2">{option.name}</p>
+                  <div className="flex flex-wrap gap-2">
+                    {option.values.map((value) => (
+                      <Button
+                        key={value}
+                        variant={selected[option.name] === value ? 'default' : 'outline'}
+                        size="sm"
+                        onClick={() => setSelected({ ...selected, [option.name]: value })}
+                      >
+                        {value}
+                      </Button>
+                    ))}
+                  </div>
+                </div>
+              ))}
+            </div>
+          )}
+
           <div className="space-y-3">
             <Button
               size="lg"
@@ -73,13 +142,11 @@ export default function ProductDetailPage() {
               onClick={() =>
                 addToCart.mutate({
                   product_id: product.id,
-                  product_name: product.name,
+                  variant_id: variant?.id,
                   quantity: 1,
-                  unit_price: product.price,
-                  image_url: product.image_urls?.[0],
                 })
               }
-              disabled={addToCart.isPending || product.stock_quantity <= 0}
+              disabled={addToCart.isPending || (hasVariants && !variant) || stock <= 0}
             >
               Add to Cart
             </Button>
@@ -108,13 +175,21 @@ export default function ProductDetailPage() {
                 </div>
                 <div className="flex justify-between">
                   <dt className="text-muted-foreground">Stock</dt>
-                  <dd>{product.stock_quantity}</dd>
+                  <dd>{stock}</dd>
                 </div>
+                {variant && (
+                  <div className="flex justify-between">
+                    <dt className="text-muted-foreground">SKU</dt>
+                    <dd className="truncate ml-4">{variant.sku}</dd>
+                  </div>
+                )}
               </dl>
             </CardContent>
           </Card>
         </div>
       </div>
+
+      <ProductReviews productId={product.id} />
     </div>
   );
 }
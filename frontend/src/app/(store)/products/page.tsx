@@ -7,8 +7,14 @@ import { Card, CardContent, CardDescription, CardFooter, CardHeader, CardTitle }
 import { Button } from '@/components/ui/button';
 import { Input } from '@/components/ui/input';
 import { useAddToCart } from '@/hooks/use-cart';
-import { useCategories, useProductSearch, useProducts } from '@/hooks/use-products';
+import {
+  useCategories,
+  useProductSearch,
+  useProductSuggestions,
+  useProducts,
+} from '@/hooks/use-products';
 import { useAddToWishlist } from '@/hooks/use-user';
+import type { PriceFacet, SearchSort } from '@/lib/api';
 
 function formatMoney(amountCents?: number, currency = 'USD') {
   const amount = (amountCents ?? 0) / 100;
@@ -18,18 +24,49 @@ function formatMoney(amountCents?: number, currency = 'USD') {
   }).format(amount);
 }
 
+function priceFacetLabel(facet: PriceFacet) {
+  if (!facet.max_price_cents) {
+    return `${formatMoney(facet.min_price_cents)}+`;
+  }
+  return `${formatMoney(facet.min_price_cents)} – ${formatMoney(facet.max_price_cents)}`;
+}
+
 export default function ProductsPage() {
   const searchParams = useSearchParams();
   const categoryId = searchParams.get('category_id') || undefined;
   const [query, setQuery] = useState('');
   const isSearching = query.trim().length > 2;
+  const [priceRange, setPriceRange] = useState<PriceFacet | undefined>();
+  const [inStockOnly, setInStockOnly] = useState(false);
+  const [sort, setSort] = useState<SearchSort>('relevance');
+  const [showSuggestions, setShowSuggestions] = useState(false);
+  const { data: suggestions } = useProductSuggestions(query.trim().toLowerCase());
+  const hasSuggestions =
+    !!suggestions?.queries?.length ||
+    !!suggestions?.products?.length ||
+    !!suggestions?.categories?.length;
 
   const { data: productsData, isLoading: productsLoading } = useProducts({
     page: 1,
     page_size: 20,
     category_id: categoryId,
+    include_descendants: !!categoryId,
   });
-  const { data: searchData, isLoading: searchLoading } = useProductSearch(query.trim());
+  const { data: searchData, isLoading: searchLoading } = useProductSearch({
+    q: query.trim(),
+    page: 1,
+    page_size: 20,
+    category_id: categoryId,
+    include_descendants: !!categoryId,
+    // The facet's upper bound is exclusive while the filter's is inclusive
+    min_price_cents: priceRange?.min_price_cents,
+    max_price_cents: priceRange?.max_price_cents ? priceRange.max_price_cents - 1 : undefined,
+    in_stock: inStockOnly || undefined,
+    sort,
+  });
+  const categoryCounts = new Map(
+    (searchData?.facets?.categories ?? []).map((facet) => [facet.category_id, facet.count])
+  );
   const { data: categories = [] } = useCategories();
   const addToCart = useAddToCart();
   const addToWishlist = useAddToWishlist();
@@ -47,12 +84,58 @@ export default function ProductsPage() {
           <h1 className="text-3xl font-bold">Products</h1>
           <p className="text-muted-foreground">Browse products from the catalog service.</p>
         </div>
-        <div className="w-full md:w-80">
+        <div className="relative w-full md:w-80">
           <Input
             value={query}
-            onChange={(e) => setQuery(e.target.value)}
+            onChange={(e) => {
+              setQuery(e.target.value);
+              setShowSuggestions(true);
+            }}
+            onFocus={() => setShowSuggestions(true)}
+            onBlur={() => setShowSuggestions(false)}
             placeholder="Search products (min 3 chars)"
           />
+          {showSuggestions && query.trim().length >= 2 && hasSuggestions && (
+            // preventDefault on mouse down keeps the input focused until a
+            // suggestion's click has been handled
+            <div
+              className="absolute z-10 mt-1 w-full rounded-md border bg-background p-1 text-sm shadow-md"
+              onMouseDown={(e) => e.preventDefault()}
+            >
+              {suggestions?.queries?.map((suggestion) => (
+                <button
+                  key={`query-${suggestion.query}`}
+                  type="button"
+                  className="block w-full rounded px-2 py-1 text-left hover:bg-muted"
+                  onClick={() => {
+                    setQuery(suggestion.query);
+                    setShowSuggestions(false);
+                  }}
+                >
+                  {suggestion.query}
+                </button>
+              ))}
+              {suggestions?.products?.map((product) => (
+                <Link
+                  key={`product-${product.id}`}
+                  href={`/products/${product.id}`}
+                  className="block rounded px-2 py-1 hover:bg-muted"
+                >
+                  {product.name}
+                </Link>
+              ))}
+              {suggestions?.categories?.map((category) => (
+                <Link
+                  key={`category-${category.id}`}
+                  href={`/products?category_id=${category.id}`}
+                  className="block rounded px-2 py-1 text-muted-foreground hover:bg-muted"
+                  onClick={() => setShowSuggestions(false)}
+                >
+                  in {category.name}
+                </Link>
+              ))}
+            </div>
+          )}
         </div>
       </div>
 
@@ -67,11 +150,51 @@ export default function ProductsPage() {
             variant={categoryId === category.id ? 'default' : 'outline'}
             size="sm"
           >
-            <Link href={`/products?category_id=${category.id}`}>{category.name}</Link>
+            <Link href={`/products?category_id=${category.id}`}>
+              {category.name}
+              {isSearching && ` (${categoryCounts.get(category.id) ?? 0})`}
+            </Link>
           </Button>
         ))}
       </div>
 
+      {isSearching && (
+        <div className="flex flex-wrap items-center gap-2">
+          {(searchData?.facets?.price_ranges ?? []).map((facet) => {
+            const selected = priceRange?.min_price_cents === facet.min_price_cents;
+            return (
+              <Button
+                key={facet.min_price_cents ?? 0}
+                variant={selected ? 'default' : 'outline'}
+                size="sm"
+                onClick={() => setPriceRange(selected ? undefined : facet)}
+                disabled={!facet.count && !selected}
+              >
+                {priceFacetLabel(facet)} ({facet.count ?? 0})
+              </Button>
+            );
+          })}
+          <Button
+            variant={inStockOnly ? 'default' : 'outline'}
+            size="sm"
+            onClick={() => setInStockOnly(!inStockOnly)}
+          >
+            In stock
+          </Button>
+          <select
+            className="h-9 rounded-md border bg-background px-2 text-sm"
+            value={sort}
+            onChange={(e) => setSort(e.target.value as SearchSort)}
+          >
+            <option value="relevance">Relevance</option>
+            <option value="price_asc">Price: low to high</option>
+            <option value="price_desc">Price: high to low</option>
+            <option value="newest">Newest</option>
+            <option value="rating">Top rated</option>
+          </select>
+        </div>
+      )}
+
       {isLoading ? (
         <p className="text-muted-foreground">Loading products...</p>
       ) : products.length === 0 ? (
@@ -103,6 +226,11 @@ export default function ProductsPage() {
               <CardContent className="space-y-2">
                 <p className="text-2xl font-bold">
                   {formatMoney(product.price?.amount_cents, product.price?.currency)}
+                  {product.compare_at_price && (
+                    <span className="ml-2 text-base font-normal text-muted-foreground line-through">
+                      {formatMoney(product.compare_at_price.amount_cents, product.compare_at_price.currency)}
+                    </span>
+                  )}
                 </p>
                 <p className="text-sm text-muted-foreground">
                   Stock: {product.stock_quantity}
@@ -117,10 +245,7 @@ export default function ProductsPage() {
                   onClick={() =>
                     addToCart.mutate({
                       product_id: product.id,
-                      product_name: product.name,
                       quantity: 1,
-                      unit_price: product.price,
-                      image_url: product.image_urls?.[0],
                     })
                   }
                   disabled={addToCart.isPending || product.stock_quantity <= 0}
@@ -68,6 +68,11 @@ export default function Home() {
                   <CardContent className="space-y-3">
                     <p className="text-2xl font-bold">
                       {formatMoney(product.price?.amount_cents, product.price?.currency)}
+                      {product.compare_at_price && (
+                        <span className="ml-2 text-base font-normal text-muted-foreground line-through">
+                          {formatMoney(product.compare_at_price.amount_cents, product.compare_at_price.currency)}
+                        </span>
+                      )}
                     </p>
                     <Button asChild className="w-full">
                       <Link href={`/products/${product.id}`}>View Product</Link>
@@ -0,0 +1,181 @@
+'use client';
+
+import { useState } from 'react';
+import { Star, ThumbsUp } from 'lucide-react';
+import { Button } from '@/components/ui/button';
+import { Card, CardContent } from '@/components/ui/card';
+import { Input } from '@/components/ui/input';
+import { Label } from '@/components/ui/label';
+import { useProductReviews, useSubmitReview, useVoteReviewHelpful } from '@/hooks/use-products';
+import { getErrorMessage } from '@/lib/error-message';
+import type { ReviewSort } from '@/lib/api';
+
+export function StarRating({ rating, className = 'h-4 w-4' }: { rating: number; className?: string }) {
+  return (
+    <span className="inline-flex" aria-label={`${rating.toFixed(1)} out of 5 stars`}>
+      {[1, 2, 3, 4, 5].map((star) => (
+        <Star
+          key={star}
+          className={`${className} ${
+            star <= Math.round(rating) ? 'fill-yellow-400 text-yellow-400' : 'text-muted-foreground'
+          }`}
+        />
+      ))}
+    </span>
+  );
+}
+
+export function ProductReviews({ productId }: { productId: string }) {
+  const [page, setPage] = useState(1);
+  const [sort, setSort] = useState<ReviewSort>('newest');
+  const { data, isLoading } = useProductReviews(productId, { page, sort });
+  const submitReview = useSubmitReview(productId);
+  const voteHelpful = useVoteReviewHelpful(productId);
+
+  const [form, setForm] = useState({ rating: 5, title: '', body: '' });
+  const [submitted, setSubmitted] = useState(false);
+
+  const reviews = data?.reviews ?? [];
+  const totalPages = data?.pagination?.total_pages ?? 1;
+
+  const handleSubmit = (event: React.FormEvent) => {
+    event.preventDefault();
+    submitReview.mutate(form, {
+      onSuccess: () => {
+        setSubmitted(true);
+        setForm({ rating: 5, title: '', body: '' });
+      },
+    });
+  };
+
+  return (
+    <section className="mt-12">
+      <div className="flex items-center justify-between mb-4">
+        <h2 className="text-2xl font-bold">Customer Reviews</h2>
+        <select
+          className="h-9 rounded-md border bg-background px-2 text-sm"
+          value={sort}
+          onChange={(e) => {
+            setSort(e.target.value as ReviewSort);
+            setPage(1);
+          }}
+        >
+          <option value="newest">Newest</option>
+          <option value="helpful">Most helpful</option>
+        </select>
+      </div>
+
+      {isLoading ? (
+        <p className="text-muted-foreground">Loading reviews...</p>
+      ) : reviews.length === 0 ? (
+        <p className="text-muted-foreground mb-6">No reviews yet.</p>
+      ) : (
+        <div className="space-y-4 mb-6">
+          {reviews.map((review) => (
+            <Card key={review.id}>
+              <CardContent className="pt-6">
+                <div className="flex items-center gap-2 mb-1">
+                  <StarRating rating={review.rating} />
+                  <span className="font-semibold">{review.title}</span>
+                </div>
+                <p className="text-xs text-muted-foreground mb-2">
+                  Verified purchase · {new Date(review.created_at).toLocaleDateString()}
+                </p>
+                <p className="text-sm mb-3 whitespace-pre-line">{review.body}</p>
+                <Button
+                  variant="ghost"
+                  size="sm"
+                  onClick={() => voteHelpful.mutate({ reviewId: review.id, helpful: true })}
+                  disabled={voteHelpful.isPending}
+                >
+                  <ThumbsUp className="h-4 w-4 mr-2" />
+                  Helpful ({review.helpful_count ?? 0})
+                </Button>
+              </CardContent>
+            </Card>
+          ))}
+          {totalPages > 1 && (
+            <div className="flex items-center gap-2">
+              <Button variant="outline" size="sm" disabled={page <= 1} onClick={() => setPage(page - 1)}>
+                Previous
+              </Button>
+              <span className="text-sm text-muted-foreground">
+                Page {page} of {totalPages}
+              </span>
+              <Button
+                variant="outline"
+                size="sm"
+                disabled={page >= totalPages}
+                onClick={() => setPage(page + 1)}
+              >
+                Next
+              </Button>
+            </div>
+          )}
+        </div>
+      )}
+
+      <Card>
+        <CardContent className="pt-6">
+          <h3 className="font-semibold mb-4">Write a review</h3>
+          {submitted ? (
+            <p className="text-sm text-muted-foreground">
+              Thanks! Your review will appear once it has been approved.
+            </p>
+          ) : (
+            <form onSubmit={handleSubmit} className="space-y-4">
+              <div>
+                <Label>Rating</Label>
+                <div className="flex gap-1 mt-1">
+                  {[1, 2, 3, 4, 5].map((star) => (
+                    <button
+                      key={star}
+                      type="button"
+                      onClick={() => setForm({ ...form, rating: star })}
+                      aria-label={`${star} stars`}
+                    >
+                      <Star
+                        className={`h-6 w-6 ${
+                          star <= form.rating ? 'fill-yellow-400 text-yellow-400' : 'text-muted-foreground'
+                        }`}
+                      />
+                    </button>
+                  ))}
+                </div>
+              </div>
+              <div>
+                <Label htmlFor="review-title">Title</Label>
+                <Input
+                  id="review-title"
+                  value={form.title}
+                  maxLength={200}
+                  onChange={(e) => setForm({ ...form, title: e.target.value })}
+                  required
+                />
+              </div>
+              <div>
+                <Label htmlFor="review-body">Review</Label>
+                <textarea
+                  id="review-body"
+                  className="flex min-h-24 w-full rounded-md border border-input bg-background px-3 py-2 text-sm"
+                  value={form.body}
+                  maxLength={5000}
+                  onChange={(e) => setForm({ ...form, body: e.target.value })}
+                  required
+                />
+              </div>
+              {submitReview.isError && (
+                <p className="text-sm text-red-600">
+                  {getErrorMessage(submitReview.error, 'Could not submit your review.')}
+                </p>
+              )}
+              <Button type="submit" disabled={submitReview.isPending}>
+                Submit Review
+              </Button>
+            </form>
+          )}
+        </CardContent>
+      </Card>
+    </section>
+  );
+}
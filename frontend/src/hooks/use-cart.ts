@@ -1,6 +1,5 @@
 import { useQuery, useMutation, useQueryClient } from '@tanstack/react-query';
-import { cartApi, type AddCartItemRequest } from '@/lib/api';
-import { hasAccessToken, redirectToLogin } from '@/lib/auth-redirect';
+import { cartApi, type AddCartItemRequest, type CartLine } from '@/lib/api';
 
 export function useCart() {
   return useQuery({
@@ -13,13 +12,7 @@ export function useAddToCart() {
   const queryClient = useQueryClient();
 
   return useMutation({
-    mutationFn: (data: AddCartItemRequest) => {
-      if (!hasAccessToken()) {
-        redirectToLogin('action_requires_auth');
-        return Promise.reject(new Error('Authentication required'));
-      }
-      return cartApi.addItem(data);
-    },
+    mutationFn: (data: AddCartItemRequest) => cartApi.addItem(data),
     onSuccess: () => {
       queryClient.invalidateQueries({ queryKey: ['cart'] });
     },
@@ -30,8 +23,8 @@ export function useUpdateCartItem() {
   const queryClient = useQueryClient();
 
   return useMutation({
-    mutationFn: ({ productId, quantity }: { productId: string; quantity: number }) =>
-      cartApi.updateItem(productId, quantity),
+    mutationFn: ({ line, quantity }: { line: CartLine; quantity: number }) =>
+      cartApi.updateItem(line, quantity),
     onSuccess: () => {
       queryClient.invalidateQueries({ queryKey: ['cart'] });
     },
@@ -42,7 +35,51 @@ export function useRemoveFromCart() {
   const queryClient = useQueryClient();
 
   return useMutation({
-    mutationFn: (productId: string) => cartApi.removeItem(productId),
+    mutationFn: (line: CartLine) => cartApi.removeItem(line),
+    onSuccess: () => {
+      queryClient.invalidateQueries({ queryKey: ['cart'] });
+    },
+  });
+}
+
+export function useSaveForLater() {
+  const queryClient = useQueryClient();
+
+  return useMutation({
+    mutationFn: (line: CartLine) => cartApi.saveForLater(line),
+    onSuccess: () => {
+      queryClient.invalidateQueries({ queryKey: ['cart'] });
+    },
+  });
+}
+
+export function useMoveToCart() {
+  const queryClient = useQueryClient();
+
+  return useMutation({
+    mutationFn: (line: CartLine) => cartApi.moveToCart(line),
+    onSuccess: () => {
+      queryClient.invalidateQueries({ queryKey: ['cart'] });
+    },
+  });
+}
+
+export function useRemoveSavedItem() {
+  const queryClient = useQueryClient();
+
+  return useMutation({
+    mutationFn: (line: CartLine) => cartApi.removeSavedItem(line),
+    onSuccess: () => {
+      queryClient.invalidateQueries({ queryKey: ['cart'] });
+    },
+  });
+}
+
+export function useAcceptPriceChanges() {
+  const queryClient = useQueryClient();
+
+  return useMutation({
+    mutationFn: () => cartApi.acceptPriceChanges(),
     onSuccess: () => {
       queryClient.invalidateQueries({ queryKey: ['cart'] });
     },
@@ -1,10 +1,19 @@
-import { useQuery } from '@tanstack/react-query';
-import { productsApi } from '@/lib/api';
+import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query';
+import {
+  productsApi,
+  type ReviewSort,
+  type SearchProductsParams,
+  type SearchSort,
+  type SubmitReviewRequest,
+} from '@/lib/api';
+import { hasAccessToken, redirectToLogin } from '@/lib/auth-redirect';
 
 export function useProducts(params?: {
   page?: number;
   page_size?: number;
   category_id?: string;
+  include_descendants?: boolean;
+  sort?: SearchSort;
 }) {
   return useQuery({
     queryKey: ['products', params],
@@ -20,11 +29,57 @@ export function useProduct(id: string) {
   });
 }
 
-export function useProductSearch(query: string) {
+export function useProductSearch(params: SearchProductsParams) {
   return useQuery({
-    queryKey: ['products', 'search', query],
-    queryFn: () => productsApi.searchProducts(query),
-    enabled: !!query && query.length > 2,
+    queryKey: ['products', 'search', params],
+    queryFn: () => productsApi.searchProducts(params),
+    enabled: !!params.q && params.q.length > 2,
+  });
+}
+
+export function useProductSuggestions(prefix: string) {
+  return useQuery({
+    queryKey: ['products', 'suggest', prefix],
+    queryFn: () => productsApi.suggestProducts(prefix),
+    enabled: prefix.length >= 2,
+    staleTime: 60 * 1000,
+  });
+}
+
+export function useProductReviews(productId: string, params?: { page?: number; sort?: ReviewSort }) {
+  return useQuery({
+    queryKey: ['products', productId, 'reviews', params],
+    queryFn: () => productsApi.getReviews(productId, params),
+    enabled: !!productId,
+  });
+}
+
+export function useSubmitReview(productId: string) {
+  return useMutation({
+    mutationFn: (data: SubmitReviewRequest) => {
+      if (!hasAccessToken()) {
+        redirectToLogin('action_requires_auth');
+        return Promise.reject(new Error('Authentication required'));
+      }
+      return productsApi.submitReview(productId, data);
+    },
+  });
+}
+
+export function useVoteReviewHelpful(productId: string) {
+  const queryClient = useQueryClient();
+
+  return useMutation({
+    mutationFn: ({ reviewId, helpful }: { reviewId: string; helpful: boolean }) => {
+      if (!hasAccessToken()) {
+        redirectToLogin('action_requires_auth');
+        return Promise.reject(new Error('Authentication required'));
+      }
+      return productsApi.voteReviewHelpful(reviewId, helpful);
+    },
+    onSuccess: () => {
+      queryClient.invalidateQueries({ queryKey: ['products', productId, 'reviews'] });
+    },
   });
 }
 
@@ -34,3 +89,10 @@ export function useCategories() {
     queryFn: () => productsApi.getCategories(),
   });
 }
+
+export function useCategoryTree() {
+  return useQuery({
+    queryKey: ['categories', 'tree'],
+    queryFn: () => productsApi.getCategoryTree(),
+  });
+}
@@ -1,5 +1,14 @@
 import apiClient from './client';
-import type { Money, PaginationResponse, Product } from './products';
+import type {
+  Category,
+  CursorParams,
+  Money,
+  PaginationResponse,
+  Product,
+  ProductPrice,
+  Review,
+  ReviewsResponse,
+} from './products';
 import type { User } from './user';
 
 export interface ListUsersResponse {
@@ -14,18 +23,139 @@ export interface CreateProductRequest {
   price: Money;
   category_id: string;
   image_urls?: string[];
+  // Opening stock, received at the default warehouse
   stock_quantity: number;
 }
 
-export interface UpdateProductRequest extends CreateProductRequest {
+// Stock is not updated with the product; adjust it with adjustStock
+export interface UpdateProductRequest extends Omit<CreateProductRequest, 'stock_quantity'> {
   is_active: boolean;
 }
 
+export interface CategoryRequest {
+  name: string;
+  slug: string;
+  description?: string;
+  parent_id?: string;
+}
+
+// CreateProductPriceRequest schedules a sale price; starts_at and ends_at
+// are RFC 3339, starting now and never ending when left out
+export interface CreateProductPriceRequest {
+  price: Money;
+  compare_at_price?: Money;
+  starts_at?: string;
+  ends_at?: string;
+}
+
+// InventoryMovementReason is the InventoryMovementReason proto enum:
+// 1 receipt, 2 sale, 3 reservation, 4 release, 5 return, 6 damage,
+// 7 adjustment.
+export type InventoryMovementReason = 1 | 2 | 3 | 4 | 5 | 6 | 7;
+
+export type InventoryMovementReasonName =
+  | 'receipt'
+  | 'sale'
+  | 'reservation'
+  | 'release'
+  | 'return'
+  | 'damage'
+  | 'adjustment';
+
+export interface Warehouse {
+  id: string;
+  code: string;
+  name: string;
+  is_default?: boolean;
+  created_at: string;
+}
+
+// InventoryMovement is an entry of the append-only inventory ledger
+export interface InventoryMovement {
+  id: number;
+  warehouse_id: string;
+  product_id: string;
+  variant_id?: string;
+  reason: InventoryMovementReason;
+  on_hand_change?: number;
+  reserved_change?: number;
+  reference?: string;
+  note?: string;
+  created_by?: string;
+  created_at: string;
+}
+
+export interface InventoryMovementsResponse {
+  movements?: InventoryMovement[];
+  pagination: PaginationResponse;
+}
+
+export interface InventoryLevel {
+  warehouse_id: string;
+  warehouse_code: string;
+  product_id: string;
+  variant_id?: string;
+  on_hand?: number;
+  reserved?: number;
+  available?: number;
+  updated_at: string;
+}
+
+// AdjustStockRequest changes stock on hand: positive quantities for
+// receipts and returns, negative for damage, and either for adjustments.
+// It goes to the default warehouse when warehouse_id is left out.
+export interface AdjustStockRequest {
+  variant_id?: string;
+  warehouse_id?: string;
+  quantity: number;
+  reason: 'receipt' | 'return' | 'damage' | 'adjustment';
+  reference?: string;
+  note?: string;
+}
+
+// LowStockItem is a product, or a variant of one when variant_id is set,
+// that is at or below its reorder threshold or out of stock.
+export interface LowStockItem {
+  product_id: string;
+  product_name: string;
+  product_slug: string;
+  variant_id?: string;
+  sku?: string;
+  available?: number;
+  reorder_threshold?: number;
+  out_of_stock?: boolean;
+}
+
+export interface LowStockProductsResponse {
+  items?: LowStockItem[];
+  pagination: PaginationResponse;
+}
+
+export type ProductFileFormat = 'csv' | 'json';
+
+export interface ImportRowError {
+  row: number;
+  slug?: string;
+  message: string;
+}
+
+export interface ImportProductsResponse {
+  dry_run?: boolean;
+  total_rows?: number;
+  created?: number;
+  updated?: number;
+  failed?: number;
+  errors?: ImportRowError[];
+  warnings?: ImportRowError[];
+}
+
+export type ReviewStatusName = 'pending' | 'approved' | 'rejected';
+
 export const adminApi = {
   listUsers: async (params?: {
     page?: number;
     page_size?: number;
-  }): Promise<ListUsersResponse> => {
+  } & CursorParams): Promise<ListUsersResponse> => {
     const response = await apiClient.get('/api/v1/admin/users', { params });
     return response.data;
   },
@@ -43,4 +173,123 @@ export const adminApi = {
   deleteProduct: async (id: string): Promise<void> => {
     await apiClient.delete(`/api/v1/admin/products/${id}`);
   },
+
+  // importProducts uploads a CSV or JSON product file; the format is taken
+  // from the file name
+  importProducts: async (file: File, dryRun = false): Promise<ImportProductsResponse> => {
+    const data = new FormData();
+    data.append('file', file);
+    const response = await apiClient.post('/api/v1/admin/products/import', data, {
+      params: { dry_run: dryRun || undefined },
+      headers: { 'Content-Type': 'multipart/form-data' },
+    });
+    return response.data;
+  },
+
+  exportProducts: async (format: ProductFileFormat = 'csv'): Promise<Blob> => {
+    const response = await apiClient.get('/api/v1/admin/products/export', {
+      params: { format },
+      responseType: 'blob',
+    });
+    return response.data;
+  },
+
+  listProductPrices: async (productId: string): Promise<ProductPrice[]> => {
+    const response = await apiClient.get(`/api/v1/admin/products/${productId}/prices`);
+    return response.data.prices ?? [];
+  },
+
+  createProductPrice: async (productId: string, data: CreateProductPriceRequest): Promise<ProductPrice> => {
+    const response = await apiClient.post(`/api/v1/admin/products/${productId}/prices`, data);
+    return response.data;
+  },
+
+  // cancelProductPrice deletes a scheduled price that has not started, or
+  // ends one in effect now
+  cancelProductPrice: async (productId: string, priceId: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/admin/products/${productId}/prices/${priceId}`);
+  },
+
+  getInventoryLevels: async (productId: string): Promise<InventoryLevel[]> => {
+    const response = await apiClient.get(`/api/v1/admin/products/${productId}/inventory`);
+    return response.data.levels ?? [];
+  },
+
+  adjustStock: async (productId: string, data: AdjustStockRequest): Promise<InventoryMovement> => {
+    const response = await apiClient.post(`/api/v1/admin/products/${productId}/inventory/adjustments`, data);
+    return response.data;
+  },
+
+  // listInventoryMovements lists the inventory ledger newest first; since
+  // and until are RFC 3339
+  listInventoryMovements: async (params?: {
+    product_id?: string;
+    variant_id?: string;
+    warehouse_id?: string;
+    reason?: InventoryMovementReasonName;
+    reference?: string;
+    since?: string;
+    until?: string;
+    page?: number;
+    page_size?: number;
+  } & CursorParams): Promise<InventoryMovementsResponse> => {
+    const response = await apiClient.get('/api/v1/admin/inventory/movements', { params });
+    return response.data;
+  },
+
+  // setReorderThreshold sets when a product counts as low on stock; 0 turns
+  // low-stock alerts off
+  setReorderThreshold: async (productId: string, reorderThreshold: number): Promise<Product> => {
+    const response = await apiClient.put(`/api/v1/admin/products/${productId}/reorder-threshold`, {
+      reorder_threshold: reorderThreshold,
+    });
+    return response.data;
+  },
+
+  listLowStockProducts: async (params?: { page?: number; page_size?: number }): Promise<LowStockProductsResponse> => {
+    const response = await apiClient.get('/api/v1/admin/inventory/low-stock', { params });
+    return response.data;
+  },
+
+  listWarehouses: async (): Promise<Warehouse[]> => {
+    const response = await apiClient.get('/api/v1/admin/warehouses');
+    return response.data.warehouses ?? [];
+  },
+
+  createWarehouse: async (data: { code: string; name: string }): Promise<Warehouse> => {
+    const response = await apiClient.post('/api/v1/admin/warehouses', data);
+    return response.data;
+  },
+
+  createCategory: async (data: CategoryRequest): Promise<Category> => {
+    const response = await apiClient.post('/api/v1/admin/categories', data);
+    return response.data;
+  },
+
+  updateCategory: async (id: string, data: CategoryRequest): Promise<Category> => {
+    const response = await apiClient.put(`/api/v1/admin/categories/${id}`, data);
+    return response.data;
+  },
+
+  deleteCategory: async (id: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/admin/categories/${id}`);
+  },
+
+  listReviews: async (params?: {
+    status?: ReviewStatusName;
+    product_id?: string;
+    page?: number;
+    page_size?: number;
+  }): Promise<ReviewsResponse> => {
+    const response = await apiClient.get('/api/v1/admin/reviews', { params });
+    return response.data;
+  },
+
+  moderateReview: async (
+    id: string,
+    data: { status: ReviewStatusName; note?: string }
+  ): Promise<Review> => {
+    const response = await apiClient.put(`/api/v1/admin/reviews/${id}/moderation`, data);
+    return response.data;
+  },
 };
@@ -31,11 +31,15 @@ export interface AuthResponse {
 export const authApi = {
   login: async (data: LoginRequest): Promise<AuthResponse> => {
     const response = await apiClient.post('/api/v1/auth/login', data);
+    // The gateway merged the guest cart into the account
+    localStorage.removeItem('cart_token');
     return response.data;
   },
 
   register: async (data: RegisterRequest): Promise<AuthResponse> => {
     const response = await apiClient.post('/api/v1/auth/register', data);
+    // The gateway merged the guest cart into the account
+    localStorage.removeItem('cart_token');
     return response.data;
   },
 
@@ -8,21 +8,33 @@ export interface CartItem {
   unit_price: Money;
   total_price: Money;
   image_url?: string;
+  added_unit_price?: Money;
+  price_changed?: boolean;
+  unavailable?: boolean;
+  variant_id?: string;
+  sku?: string;
+  variant_options?: Record<string, string>;
+}
+
+// CartLine identifies a line of the cart: a product, or a variant of it.
+export type CartLine = Pick<CartItem, 'product_id' | 'variant_id'>;
+
+function lineParams(line: CartLine) {
+  return line.variant_id ? { variant_id: line.variant_id } : undefined;
 }
 
 export interface Cart {
   user_id: string;
   items: CartItem[];
+  saved_items?: CartItem[];
   total: Money;
   updated_at: string;
 }
 
 export interface AddCartItemRequest {
   product_id: string;
-  product_name: string;
+  variant_id?: string;
   quantity: number;
-  unit_price: Money;
-  image_url?: string;
 }
 
 export const cartApi = {
@@ -36,15 +48,48 @@ export const cartApi = {
     return response.data;
   },
 
-  updateItem: async (productId: string, quantity: number): Promise<Cart> => {
-    const response = await apiClient.put(`/api/v1/cart/items/${productId}`, {
-      quantity,
+  updateItem: async (line: CartLine, quantity: number): Promise<Cart> => {
+    const response = await apiClient.put(
+      `/api/v1/cart/items/${line.product_id}`,
+      { quantity },
+      { params: lineParams(line) }
+    );
+    return response.data;
+  },
+
+  removeItem: async (line: CartLine): Promise<Cart> => {
+    const response = await apiClient.delete(`/api/v1/cart/items/${line.product_id}`, {
+      params: lineParams(line),
+    });
+    return response.data;
+  },
+
+  saveForLater: async (line: CartLine): Promise<Cart> => {
+    const response = await apiClient.post('/api/v1/cart/saved', {
+      product_id: line.product_id,
+      variant_id: line.variant_id,
+    });
+    return response.data;
+  },
+
+  moveToCart: async (line: CartLine): Promise<Cart> => {
+    const response = await apiClient.post(
+      `/api/v1/cart/saved/${line.product_id}/move-to-cart`,
+      undefined,
+      { params: lineParams(line) }
+    );
+    return response.data;
+  },
+
+  removeSavedItem: async (line: CartLine): Promise<Cart> => {
+    const response = await apiClient.delete(`/api/v1/cart/saved/${line.product_id}`, {
+      params: lineParams(line),
     });
     return response.data;
   },
 
-  removeItem: async (productId: string): Promise<Cart> => {
-    const response = await apiClient.delete(`/api/v1/cart/items/${productId}`);
+  acceptPriceChanges: async (): Promise<Cart> => {
+    const response = await apiClient.post('/api/v1/cart/accept-prices');
     return response.data;
   },
 
@@ -21,6 +21,12 @@ apiClient.interceptors.request.use(
     if (token) {
       config.headers.Authorization = `Bearer ${token}`;
     }
+
+    // Guest carts are named by a token the gateway issues
+    const cartToken = window.localStorage.getItem('cart_token');
+    if (cartToken) {
+      config.headers['X-Cart-Token'] = cartToken;
+    }
     return config;
   },
   (error) => {
@@ -30,7 +36,13 @@ apiClient.interceptors.request.use(
 
 // Response interceptor to handle errors
 apiClient.interceptors.response.use(
-  (response) => response,
+  (response) => {
+    const cartToken = response.headers['x-cart-token'];
+    if (cartToken && typeof window !== 'undefined') {
+      window.localStorage.setItem('cart_token', cartToken);
+    }
+    return response;
+  },
   async (error) => {
     const originalRequest = error.config;
     const requestURL = originalRequest?.url as string | undefined;
@@ -1,6 +1,6 @@
 import apiClient from './client';
 import type { Address } from './user';
-import type { Money, PaginationResponse } from './products';
+import type { CursorParams, Money, PaginationResponse } from './products';
 
 export interface OrderItem {
   id: string;
@@ -51,7 +51,7 @@ export const ordersApi = {
     page?: number;
     page_size?: number;
     status?: string;
-  }): Promise<OrdersResponse> => {
+  } & CursorParams): Promise<OrdersResponse> => {
     const response = await apiClient.get('/api/v1/orders', { params });
     return response.data;
   },
@@ -10,6 +10,19 @@ export interface PaginationResponse {
   page_size: number;
   total_pages: number;
   total_count: number;
+  next_page_token?: string;
+  total_count_approximate?: boolean;
+  total_counted?: boolean;
+}
+
+export type CountMode = 'exact' | 'approximate' | 'none';
+
+// Lists page by cursor when page_token is set, or cursor asks for the first
+// page by cursor; next_page_token in the response fetches the next page.
+export interface CursorParams {
+  page_token?: string;
+  cursor?: boolean;
+  count?: CountMode;
 }
 
 export interface Product {
@@ -17,13 +30,46 @@ export interface Product {
   name: string;
   slug: string;
   description: string;
+  // What the product sells at now: its scheduled sale price while one is
+  // in effect, or else its list price
   price: Money;
+  list_price?: Money;
+  // Original price to show struck through during a sale
+  compare_at_price?: Money;
+  sale_ends_at?: string;
   category_id: string;
   image_urls: string[];
   stock_quantity: number;
+  // Stock at or below which the product, or each of its variants, is low
+  // on stock; left out when low-stock alerts are off
+  reorder_threshold?: number;
   is_active: boolean;
   created_at: string;
   updated_at: string;
+  // Average of the approved reviews' ratings; both are left out when the
+  // product has no approved reviews
+  rating_average?: number;
+  rating_count?: number;
+  options?: ProductOption[];
+  variants?: ProductVariant[];
+  breadcrumbs?: Category[];
+}
+
+export interface ProductOption {
+  name: string;
+  values: string[];
+}
+
+export interface ProductVariant {
+  id: string;
+  product_id: string;
+  sku: string;
+  options: Record<string, string>;
+  price: Money;
+  price_override?: boolean;
+  stock_quantity: number;
+  image_urls?: string[];
+  is_active: boolean;
 }
 
 export interface ProductsResponse {
@@ -31,6 +77,131 @@ export interface ProductsResponse {
   pagination: PaginationResponse;
 }
 
+export interface CategoryFacet {
+  category_id: string;
+  name: string;
+  count: number;
+}
+
+// PriceFacet counts products from min_price_cents up to, but not
+// including, max_price_cents; a missing max means no upper bound.
+export interface PriceFacet {
+  min_price_cents?: number;
+  max_price_cents?: number;
+  count?: number;
+}
+
+export interface SearchFacets {
+  categories?: CategoryFacet[];
+  price_ranges?: PriceFacet[];
+}
+
+export interface SearchProductsResponse extends ProductsResponse {
+  facets?: SearchFacets;
+}
+
+export type SearchSort = 'relevance' | 'price_asc' | 'price_desc' | 'newest' | 'rating';
+
+export interface SearchProductsParams {
+  q?: string;
+  page?: number;
+  page_size?: number;
+  category_id?: string;
+  include_descendants?: boolean;
+  min_price_cents?: number;
+  max_price_cents?: number;
+  in_stock?: boolean;
+  sort?: SearchSort;
+}
+
+export interface ProductSuggestion {
+  id: string;
+  name: string;
+  slug: string;
+  image_url?: string;
+}
+
+export interface CategorySuggestion {
+  id: string;
+  name: string;
+  slug: string;
+}
+
+export interface QuerySuggestion {
+  query: string;
+  search_count?: number;
+}
+
+export interface SuggestProductsResponse {
+  products?: ProductSuggestion[];
+  categories?: CategorySuggestion[];
+  queries?: QuerySuggestion[];
+}
+
+// ReviewStatus is the ReviewStatus proto enum: 1 pending, 2 approved,
+// 3 rejected.
+export type ReviewStatus = 1 | 2 | 3;
+
+export interface Review {
+  id: string;
+  product_id: string;
+  user_id: string;
+  order_id: string;
+  rating: number;
+  title: string;
+  body: string;
+  status: ReviewStatus;
+  moderation_note?: string;
+  helpful_count?: number;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface ReviewsResponse {
+  reviews?: Review[];
+  pagination: PaginationResponse;
+}
+
+export type ReviewSort = 'newest' | 'helpful';
+
+export interface SubmitReviewRequest {
+  rating: number;
+  title: string;
+  body: string;
+}
+
+// PriceChangeKind is the PriceChangeKind proto enum: 1 list price,
+// 2 scheduled price.
+export type PriceChangeKind = 1 | 2;
+
+export interface PriceHistoryEntry {
+  kind: PriceChangeKind;
+  price: Money;
+  compare_at_price?: Money;
+  effective_from: string;
+  // Left out while the price is still set
+  effective_until?: string;
+}
+
+export interface PriceHistory {
+  entries?: PriceHistoryEntry[];
+  // Lowest price over the last days days
+  lowest_price?: Money;
+  days: number;
+}
+
+// ProductPrice is a scheduled price a product sells at from starts_at
+// until ends_at, or with no end when ends_at is left out.
+export interface ProductPrice {
+  id: string;
+  product_id: string;
+  price: Money;
+  compare_at_price?: Money;
+  starts_at: string;
+  ends_at?: string;
+  created_at: string;
+}
+
 export interface Category {
   id: string;
   name: string;
@@ -44,12 +215,23 @@ export interface CategoriesResponse {
   categories: Category[];
 }
 
+export interface CategoryNode {
+  category: Category;
+  children?: CategoryNode[];
+}
+
+export interface CategoryTree {
+  roots?: CategoryNode[];
+}
+
 export const productsApi = {
   getProducts: async (params?: {
     page?: number;
     page_size?: number;
     category_id?: string;
-  }): Promise<ProductsResponse> => {
+    include_descendants?: boolean;
+    sort?: SearchSort;
+  } & CursorParams): Promise<ProductsResponse> => {
     const response = await apiClient.get('/api/v1/products', { params });
     return response.data;
   },
@@ -59,16 +241,58 @@ export const productsApi = {
     return response.data;
   },
 
-  searchProducts: async (query: string): Promise<ProductsResponse> => {
-    const response = await apiClient.get('/api/v1/products/search', {
-      params: { q: query },
+  searchProducts: async (params: SearchProductsParams): Promise<SearchProductsResponse> => {
+    const response = await apiClient.get('/api/v1/products/search', { params });
+    return response.data;
+  },
+
+  suggestProducts: async (prefix: string, limit?: number): Promise<SuggestProductsResponse> => {
+    const response = await apiClient.get('/api/v1/products/suggest', {
+      params: { q: prefix, limit },
     });
     return response.data;
   },
 
+  getPriceHistory: async (productId: string, days?: number): Promise<PriceHistory> => {
+    const response = await apiClient.get(`/api/v1/products/${productId}/price-history`, {
+      params: { days },
+    });
+    return response.data;
+  },
+
+  getReviews: async (
+    productId: string,
+    params?: { page?: number; page_size?: number; sort?: ReviewSort }
+  ): Promise<ReviewsResponse> => {
+    const response = await apiClient.get(`/api/v1/products/${productId}/reviews`, { params });
+    return response.data;
+  },
+
+  submitReview: async (productId: string, data: SubmitReviewRequest): Promise<Review> => {
+    const response = await apiClient.post(`/api/v1/products/${productId}/reviews`, data);
+    return response.data;
+  },
+
+  voteReviewHelpful: async (reviewId: string, helpful: boolean): Promise<Review> => {
+    const response = helpful
+      ? await apiClient.post(`/api/v1/reviews/${reviewId}/helpful`)
+      : await apiClient.delete(`/api/v1/reviews/${reviewId}/helpful`);
+    return response.data;
+  },
+
+  deleteReview: async (reviewId: string): Promise<void> => {
+    await apiClient.delete(`/api/v1/reviews/${reviewId}`);
+  },
+
   getCategories: async (): Promise<Category[]> => {
     const response = await apiClient.get('/api/v1/categories');
     const data: CategoriesResponse = response.data;
     return data.categories ?? [];
   },
+
+  getCategoryTree: async (): Promise<CategoryNode[]> => {
+    const response = await apiClient.get('/api/v1/categories/tree');
+    const data: CategoryTree = response.data;
+    return data.roots ?? [];
+  },
 };
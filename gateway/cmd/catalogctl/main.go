@@ -0,0 +1,150 @@
+// Command catalogctl imports and exports catalog products as CSV or JSON
+// files through the catalog service.
+//
+//	catalogctl import [-dry-run] [-format csv|json] FILE
+//	catalogctl export [-format csv|json] [-category-id ID] [-include-descendants] [-active-only] [-o FILE]
+//
+// FILE may be - for standard input. The catalog service address is taken
+// from -addr, or else from CATALOG_SERVICE_URL.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/safar/microservices-demo/gateway/internal/client"
+	"github.com/safar/microservices-demo/gateway/internal/productfile"
+	catalogpb "github.com/safar/microservices-demo/proto/catalog/v1"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = runImport(ctx, os.Args[2:])
+	case "export":
+		err = runExport(ctx, os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "catalogctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: catalogctl import [flags] FILE")
+	fmt.Fprintln(os.Stderr, "       catalogctl export [flags]")
+	os.Exit(2)
+}
+
+func defaultAddr() string {
+	if addr := os.Getenv("CATALOG_SERVICE_URL"); addr != "" {
+		return addr
+	}
+	return "localhost:50052"
+}
+
+func runImport(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "catalog service address")
+	format := flags.String("format", "", "file format, csv or json (default: from the file name)")
+	dryRun := flags.Bool("dry-run", false, "validate and report what would change without writing")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("import takes one file")
+	}
+	name := flags.Arg(0)
+
+	if *format == "" {
+		*format = productfile.FormatOf(name)
+	}
+	if *format != productfile.FormatCSV && *format != productfile.FormatJSON {
+		return fmt.Errorf("cannot tell the format of %s; pass -format csv or -format json", name)
+	}
+
+	var in io.Reader = os.Stdin
+	if name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	catalog, err := client.NewCatalogClient(*addr)
+	if err != nil {
+		return err
+	}
+	defer catalog.Close()
+
+	resp, err := productfile.Import(ctx, catalog, in, *format, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "imported"
+	if resp.DryRun {
+		verb = "would import"
+	}
+	fmt.Printf("%d rows: %s %d new and %d updated products, %d failed\n",
+		resp.TotalRows, verb, resp.Created, resp.Updated, resp.Failed)
+	for _, e := range resp.Errors {
+		fmt.Printf("row %d (%s): %s\n", e.Row, e.Slug, e.Message)
+	}
+	for _, w := range resp.Warnings {
+		fmt.Printf("row %d (%s): warning: %s\n", w.Row, w.Slug, w.Message)
+	}
+
+	if resp.Failed > 0 {
+		return fmt.Errorf("%d rows failed", resp.Failed)
+	}
+	return nil
+}
+
+func runExport(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	addr := flags.String("addr", defaultAddr(), "catalog service address")
+	format := flags.String("format", productfile.FormatCSV, "file format, csv or json")
+	categoryID := flags.String("category-id", "", "only export products of this category")
+	includeDescendants := flags.Bool("include-descendants", false, "with -category-id, also export its subcategories' products")
+	activeOnly := flags.Bool("active-only", false, "only export active products")
+	output := flags.String("o", "-", "file to write, or - for standard output")
+	flags.Parse(args)
+
+	catalog, err := client.NewCatalogClient(*addr)
+	if err != nil {
+		return err
+	}
+	defer catalog.Close()
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	return productfile.Export(ctx, catalog, &catalogpb.ExportProductsRequest{
+		CategoryId:         *categoryID,
+		IncludeDescendants: *includeDescendants,
+		ActiveOnly:         *activeOnly,
+	}, out, *format)
+}
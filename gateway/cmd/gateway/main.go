@@ -83,7 +83,7 @@ func main() {
 	}
 
 	// Initialize handlers
-	authHandler := handler.NewAuthHandler(userClient)
+	authHandler := handler.NewAuthHandler(userClient, cartClient)
 	userHandler := handler.NewUserHandler(userClient)
 	catalogHandler := handler.NewCatalogHandler(catalogClient)
 	cartHandler := handler.NewCartHandler(cartClient)
@@ -120,7 +120,28 @@ func main() {
 		r.Get("/products", catalogHandler.ListProducts)
 		r.Get("/products/{id}", catalogHandler.GetProduct)
 		r.Get("/products/search", catalogHandler.SearchProducts)
+		r.Get("/products/suggest", catalogHandler.SuggestProducts)
+		r.Get("/products/{id}/reviews", catalogHandler.ListProductReviews)
+		r.Get("/products/{id}/price-history", catalogHandler.GetPriceHistory)
 		r.Get("/categories", catalogHandler.ListCategories)
+		r.Get("/categories/tree", catalogHandler.GetCategoryTree)
+
+		// Cart routes - signed-in users or guests with a cart token
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.OptionalAuth(cfg.JWTSecret))
+
+			r.Get("/cart", cartHandler.GetCart)
+			r.Post("/cart/items", cartHandler.AddItem)
+			r.Put("/cart/items/{id}", cartHandler.UpdateItem)
+			r.Delete("/cart/items/{id}", cartHandler.RemoveItem)
+			r.Delete("/cart", cartHandler.ClearCart)
+			r.Post("/cart/coupon", cartHandler.ApplyCoupon)
+			r.Delete("/cart/coupon", cartHandler.RemoveCoupon)
+			r.Post("/cart/accept-prices", cartHandler.AcceptPriceChanges)
+			r.Post("/cart/saved", cartHandler.SaveForLater)
+			r.Post("/cart/saved/{id}/move-to-cart", cartHandler.MoveToCart)
+			r.Delete("/cart/saved/{id}", cartHandler.RemoveSavedItem)
+		})
 
 		// Authenticated routes
 		r.Group(func(r chi.Router) {
@@ -134,18 +155,18 @@ func main() {
 			r.Get("/wishlist", userHandler.GetWishlist)
 			r.Post("/wishlist", userHandler.AddToWishlist)
 
-			// Cart routes
-			r.Get("/cart", cartHandler.GetCart)
-			r.Post("/cart/items", cartHandler.AddItem)
-			r.Put("/cart/items/{id}", cartHandler.UpdateItem)
-			r.Delete("/cart/items/{id}", cartHandler.RemoveItem)
-			r.Delete("/cart", cartHandler.ClearCart)
-
 			// Order routes
 			r.Get("/orders", orderHandler.ListOrders)
 			r.Post("/orders", orderHandler.CreateOrder)
+			r.Post("/shipping/quotes", orderHandler.GetShippingQuotes)
 			r.Get("/orders/{id}", orderHandler.GetOrder)
 			r.Delete("/orders/{id}", orderHandler.CancelOrder)
+
+			// Review routes
+			r.Post("/products/{id}/reviews", catalogHandler.SubmitReview)
+			r.Post("/reviews/{id}/helpful", catalogHandler.VoteReviewHelpful)
+			r.Delete("/reviews/{id}/helpful", catalogHandler.UnvoteReviewHelpful)
+			r.Delete("/reviews/{id}", catalogHandler.DeleteReview)
 		})
 
 		// Admin routes
@@ -155,9 +176,40 @@ func main() {
 
 			// Product management
 			r.Post("/admin/products", catalogHandler.CreateProduct)
+			r.Post("/admin/products/import", catalogHandler.ImportProducts)
+			r.Get("/admin/products/export", catalogHandler.ExportProducts)
 			r.Put("/admin/products/{id}", catalogHandler.UpdateProduct)
 			r.Delete("/admin/products/{id}", catalogHandler.DeleteProduct)
+			r.Put("/admin/products/{id}/options", catalogHandler.SetProductOptions)
+			r.Get("/admin/products/{id}/variants", catalogHandler.ListVariants)
+			r.Post("/admin/products/{id}/variants", catalogHandler.CreateVariant)
+			r.Put("/admin/products/{id}/variants/{variantId}", catalogHandler.UpdateVariant)
+			r.Delete("/admin/products/{id}/variants/{variantId}", catalogHandler.DeleteVariant)
+			r.Get("/admin/products/{id}/prices", catalogHandler.ListProductPrices)
+			r.Post("/admin/products/{id}/prices", catalogHandler.CreateProductPrice)
+			r.Delete("/admin/products/{id}/prices/{priceId}", catalogHandler.CancelProductPrice)
+			r.Get("/admin/products/{id}/inventory", catalogHandler.GetInventoryLevels)
+			r.Post("/admin/products/{id}/inventory/adjustments", catalogHandler.AdjustStock)
+			r.Put("/admin/products/{id}/reorder-threshold", catalogHandler.SetReorderThreshold)
 			r.Get("/admin/users", userHandler.ListUsers)
+
+			// Category management
+			r.Post("/admin/categories", catalogHandler.CreateCategory)
+			r.Put("/admin/categories/{id}", catalogHandler.UpdateCategory)
+			r.Delete("/admin/categories/{id}", catalogHandler.DeleteCategory)
+
+			// Inventory management
+			r.Get("/admin/inventory/movements", catalogHandler.ListInventoryMovements)
+			r.Get("/admin/inventory/low-stock", catalogHandler.ListLowStockProducts)
+			r.Get("/admin/warehouses", catalogHandler.ListWarehouses)
+			r.Post("/admin/warehouses", catalogHandler.CreateWarehouse)
+
+			// Review moderation
+			r.Get("/admin/reviews", catalogHandler.ListReviews)
+			r.Put("/admin/reviews/{id}/moderation", catalogHandler.ModerateReview)
+
+			// Order management
+			r.Put("/admin/orders/{id}/status", orderHandler.UpdateOrderStatus)
 		})
 	})
 
@@ -30,7 +30,12 @@ type listProductsResponse struct {
 	Products []product `json:"products"`
 }
 
-func TestCheckoutFlow(t *testing.T) {
+// prepareCheckout registers a new user with a catalog product in their
+// cart, and returns a client, the gateway's base URL, the user's access
+// token and a checkout request body. It skips the test unless integration
+// tests are enabled.
+func prepareCheckout(t *testing.T) (*http.Client, string, string, []byte) {
+	t.Helper()
 	if os.Getenv("RUN_INTEGRATION") != "1" {
 		t.Skip("set RUN_INTEGRATION=1 to run integration tests")
 	}
@@ -127,8 +132,14 @@ func TestCheckoutFlow(t *testing.T) {
 	}
 
 	checkoutPayload, _ := json.Marshal(checkoutBody)
+	return client, baseURL, auth.AccessToken, checkoutPayload
+}
+
+func TestCheckoutFlow(t *testing.T) {
+	client, baseURL, accessToken, checkoutPayload := prepareCheckout(t)
+
 	checkoutReq, _ := http.NewRequest(http.MethodPost, baseURL+"/api/v1/orders", bytes.NewReader(checkoutPayload))
-	checkoutReq.Header.Set("Authorization", "Bearer "+auth.AccessToken)
+	checkoutReq.Header.Set("Authorization", "Bearer "+accessToken)
 	checkoutReq.Header.Set("Content-Type", "application/json")
 	checkoutResp, err := client.Do(checkoutReq)
 	if err != nil {
@@ -140,3 +151,37 @@ func TestCheckoutFlow(t *testing.T) {
 		t.Fatalf("unexpected checkout status: %d", checkoutResp.StatusCode)
 	}
 }
+
+func TestCheckoutReplayWithIdempotencyKey(t *testing.T) {
+	client, baseURL, accessToken, checkoutPayload := prepareCheckout(t)
+
+	idempotencyKey := fmt.Sprintf("checkout-%d", time.Now().UnixNano())
+	placeOrder := func() string {
+		checkoutReq, _ := http.NewRequest(http.MethodPost, baseURL+"/api/v1/orders", bytes.NewReader(checkoutPayload))
+		checkoutReq.Header.Set("Authorization", "Bearer "+accessToken)
+		checkoutReq.Header.Set("Content-Type", "application/json")
+		checkoutReq.Header.Set("Idempotency-Key", idempotencyKey)
+		checkoutResp, err := client.Do(checkoutReq)
+		if err != nil {
+			t.Fatalf("failed to create order: %v", err)
+		}
+		defer checkoutResp.Body.Close()
+
+		if checkoutResp.StatusCode != http.StatusCreated {
+			t.Fatalf("unexpected checkout status: %d", checkoutResp.StatusCode)
+		}
+
+		var created struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(checkoutResp.Body).Decode(&created); err != nil {
+			t.Fatalf("failed to decode checkout response: %v", err)
+		}
+		return created.ID
+	}
+
+	orderID := placeOrder()
+	if replayedID := placeOrder(); replayedID != orderID {
+		t.Fatalf("expected replayed checkout to return order %s, got %s", orderID, replayedID)
+	}
+}
@@ -59,3 +59,31 @@ func (c *CartClient) ClearCart(ctx context.Context, req *pb.ClearCartRequest) er
 	_, err := c.client.ClearCart(ctx, req)
 	return err
 }
+
+func (c *CartClient) ApplyCoupon(ctx context.Context, req *pb.ApplyCouponRequest) (*pb.Cart, error) {
+	return c.client.ApplyCoupon(ctx, req)
+}
+
+func (c *CartClient) RemoveCoupon(ctx context.Context, req *pb.RemoveCouponRequest) (*pb.Cart, error) {
+	return c.client.RemoveCoupon(ctx, req)
+}
+
+func (c *CartClient) MergeCarts(ctx context.Context, req *pb.MergeCartsRequest) (*pb.Cart, error) {
+	return c.client.MergeCarts(ctx, req)
+}
+
+func (c *CartClient) MoveToSavedForLater(ctx context.Context, req *pb.MoveToSavedForLaterRequest) (*pb.Cart, error) {
+	return c.client.MoveToSavedForLater(ctx, req)
+}
+
+func (c *CartClient) MoveToCart(ctx context.Context, req *pb.MoveToCartRequest) (*pb.Cart, error) {
+	return c.client.MoveToCart(ctx, req)
+}
+
+func (c *CartClient) RemoveSavedItem(ctx context.Context, req *pb.RemoveSavedItemRequest) (*pb.Cart, error) {
+	return c.client.RemoveSavedItem(ctx, req)
+}
+
+func (c *CartClient) AcceptPriceChanges(ctx context.Context, req *pb.AcceptPriceChangesRequest) (*pb.Cart, error) {
+	return c.client.AcceptPriceChanges(ctx, req)
+}
@@ -48,10 +48,22 @@ func (c *CatalogClient) GetProduct(ctx context.Context, req *pb.GetProductReques
 	return c.client.GetProduct(ctx, req)
 }
 
-func (c *CatalogClient) SearchProducts(ctx context.Context, req *pb.SearchProductsRequest) (*pb.ListProductsResponse, error) {
+func (c *CatalogClient) SearchProducts(ctx context.Context, req *pb.SearchProductsRequest) (*pb.SearchProductsResponse, error) {
 	return c.client.SearchProducts(ctx, req)
 }
 
+func (c *CatalogClient) ImportProducts(ctx context.Context) (grpc.ClientStreamingClient[pb.ImportProductsRequest, pb.ImportProductsResponse], error) {
+	return c.client.ImportProducts(ctx)
+}
+
+func (c *CatalogClient) ExportProducts(ctx context.Context, req *pb.ExportProductsRequest) (grpc.ServerStreamingClient[pb.ProductRecord], error) {
+	return c.client.ExportProducts(ctx, req)
+}
+
+func (c *CatalogClient) SuggestProducts(ctx context.Context, prefix string, limit int32) (*pb.SuggestProductsResponse, error) {
+	return c.client.SuggestProducts(ctx, &pb.SuggestProductsRequest{Prefix: prefix, Limit: limit})
+}
+
 func (c *CatalogClient) CreateProduct(ctx context.Context, req *pb.CreateProductRequest) (*pb.Product, error) {
 	return c.client.CreateProduct(ctx, req)
 }
@@ -68,3 +80,107 @@ func (c *CatalogClient) DeleteProduct(ctx context.Context, req *pb.DeleteProduct
 func (c *CatalogClient) ListCategories(ctx context.Context) (*pb.ListCategoriesResponse, error) {
 	return c.client.ListCategories(ctx, &commonv1.Empty{})
 }
+
+func (c *CatalogClient) GetCategoryTree(ctx context.Context) (*pb.CategoryTree, error) {
+	return c.client.GetCategoryTree(ctx, &commonv1.Empty{})
+}
+
+func (c *CatalogClient) CreateCategory(ctx context.Context, req *pb.CreateCategoryRequest) (*pb.Category, error) {
+	return c.client.CreateCategory(ctx, req)
+}
+
+func (c *CatalogClient) UpdateCategory(ctx context.Context, req *pb.UpdateCategoryRequest) (*pb.Category, error) {
+	return c.client.UpdateCategory(ctx, req)
+}
+
+func (c *CatalogClient) DeleteCategory(ctx context.Context, req *pb.DeleteCategoryRequest) error {
+	_, err := c.client.DeleteCategory(ctx, req)
+	return err
+}
+
+func (c *CatalogClient) SetProductOptions(ctx context.Context, req *pb.SetProductOptionsRequest) (*pb.Product, error) {
+	return c.client.SetProductOptions(ctx, req)
+}
+
+func (c *CatalogClient) ListVariants(ctx context.Context, req *pb.ListVariantsRequest) (*pb.ListVariantsResponse, error) {
+	return c.client.ListVariants(ctx, req)
+}
+
+func (c *CatalogClient) CreateVariant(ctx context.Context, req *pb.CreateVariantRequest) (*pb.ProductVariant, error) {
+	return c.client.CreateVariant(ctx, req)
+}
+
+func (c *CatalogClient) UpdateVariant(ctx context.Context, req *pb.UpdateVariantRequest) (*pb.ProductVariant, error) {
+	return c.client.UpdateVariant(ctx, req)
+}
+
+func (c *CatalogClient) DeleteVariant(ctx context.Context, req *pb.DeleteVariantRequest) error {
+	_, err := c.client.DeleteVariant(ctx, req)
+	return err
+}
+
+func (c *CatalogClient) CreateProductPrice(ctx context.Context, req *pb.CreateProductPriceRequest) (*pb.ProductPrice, error) {
+	return c.client.CreateProductPrice(ctx, req)
+}
+
+func (c *CatalogClient) ListProductPrices(ctx context.Context, req *pb.ListProductPricesRequest) (*pb.ListProductPricesResponse, error) {
+	return c.client.ListProductPrices(ctx, req)
+}
+
+func (c *CatalogClient) CancelProductPrice(ctx context.Context, req *pb.CancelProductPriceRequest) error {
+	_, err := c.client.CancelProductPrice(ctx, req)
+	return err
+}
+
+func (c *CatalogClient) GetPriceHistory(ctx context.Context, req *pb.GetPriceHistoryRequest) (*pb.PriceHistory, error) {
+	return c.client.GetPriceHistory(ctx, req)
+}
+
+func (c *CatalogClient) AdjustStock(ctx context.Context, req *pb.AdjustStockRequest) (*pb.InventoryMovement, error) {
+	return c.client.AdjustStock(ctx, req)
+}
+
+func (c *CatalogClient) ListInventoryMovements(ctx context.Context, req *pb.ListInventoryMovementsRequest) (*pb.ListInventoryMovementsResponse, error) {
+	return c.client.ListInventoryMovements(ctx, req)
+}
+
+func (c *CatalogClient) GetInventoryLevels(ctx context.Context, req *pb.GetInventoryLevelsRequest) (*pb.GetInventoryLevelsResponse, error) {
+	return c.client.GetInventoryLevels(ctx, req)
+}
+
+func (c *CatalogClient) CreateWarehouse(ctx context.Context, req *pb.CreateWarehouseRequest) (*pb.Warehouse, error) {
+	return c.client.CreateWarehouse(ctx, req)
+}
+
+func (c *CatalogClient) ListWarehouses(ctx context.Context) (*pb.ListWarehousesResponse, error) {
+	return c.client.ListWarehouses(ctx, &commonv1.Empty{})
+}
+
+func (c *CatalogClient) SetReorderThreshold(ctx context.Context, req *pb.SetReorderThresholdRequest) (*pb.Product, error) {
+	return c.client.SetReorderThreshold(ctx, req)
+}
+
+func (c *CatalogClient) ListLowStockProducts(ctx context.Context, req *pb.ListLowStockProductsRequest) (*pb.ListLowStockProductsResponse, error) {
+	return c.client.ListLowStockProducts(ctx, req)
+}
+
+func (c *CatalogClient) SubmitReview(ctx context.Context, req *pb.SubmitReviewRequest) (*pb.Review, error) {
+	return c.client.SubmitReview(ctx, req)
+}
+
+func (c *CatalogClient) ListReviews(ctx context.Context, req *pb.ListReviewsRequest) (*pb.ListReviewsResponse, error) {
+	return c.client.ListReviews(ctx, req)
+}
+
+func (c *CatalogClient) ModerateReview(ctx context.Context, req *pb.ModerateReviewRequest) (*pb.Review, error) {
+	return c.client.ModerateReview(ctx, req)
+}
+
+func (c *CatalogClient) VoteReview(ctx context.Context, req *pb.VoteReviewRequest) (*pb.Review, error) {
+	return c.client.VoteReview(ctx, req)
+}
+
+func (c *CatalogClient) DeleteReview(ctx context.Context, req *pb.DeleteReviewRequest) error {
+	_, err := c.client.DeleteReview(ctx, req)
+	return err
+}
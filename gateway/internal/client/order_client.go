@@ -43,6 +43,10 @@ func (c *OrderClient) CreateOrder(ctx context.Context, req *pb.CreateOrderReques
 	return c.client.CreateOrder(ctx, req)
 }
 
+func (c *OrderClient) GetShippingQuotes(ctx context.Context, req *pb.GetShippingQuotesRequest) (*pb.GetShippingQuotesResponse, error) {
+	return c.client.GetShippingQuotes(ctx, req)
+}
+
 func (c *OrderClient) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb.Order, error) {
 	return c.client.GetOrder(ctx, req)
 }
@@ -54,3 +58,7 @@ func (c *OrderClient) ListOrders(ctx context.Context, req *pb.ListOrdersRequest)
 func (c *OrderClient) CancelOrder(ctx context.Context, req *pb.CancelOrderRequest) (*pb.Order, error) {
 	return c.client.CancelOrder(ctx, req)
 }
+
+func (c *OrderClient) UpdateOrderStatus(ctx context.Context, req *pb.UpdateOrderStatusRequest) (*pb.Order, error) {
+	return c.client.UpdateOrderStatus(ctx, req)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -48,6 +49,21 @@ func WriteValidationError(w http.ResponseWriter, errors []ValidationError) {
 	WriteError(w, http.StatusBadRequest, "Validation failed", details)
 }
 
+// GRPCErrorReason returns the reason of the ErrorInfo detail attached to a
+// gRPC error, or "" if it has none.
+func GRPCErrorReason(err error) string {
+	st, ok := status.FromError(err)
+	if !ok {
+		return ""
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
 // GRPCErrorToHTTP converts a gRPC error to appropriate HTTP status code
 func GRPCErrorToHTTP(err error) (int, string) {
 	if err == nil {
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 
+	cartpb "github.com/safar/microservices-demo/proto/cart/v1"
 	userpb "github.com/safar/microservices-demo/proto/user/v1"
 	"github.com/safar/microservices-demo/gateway/internal/client"
 	"github.com/safar/microservices-demo/gateway/internal/errors"
@@ -13,11 +14,13 @@ import (
 
 type AuthHandler struct {
 	userClient *client.UserClient
+	cartClient *client.CartClient
 }
 
-func NewAuthHandler(userClient *client.UserClient) *AuthHandler {
+func NewAuthHandler(userClient *client.UserClient, cartClient *client.CartClient) *AuthHandler {
 	return &AuthHandler{
 		userClient: userClient,
+		cartClient: cartClient,
 	}
 }
 
@@ -71,6 +74,8 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.mergeGuestCart(r, resp.User.GetId())
+
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -109,6 +114,8 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.mergeGuestCart(r, resp.User.GetId())
+
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
@@ -150,3 +157,20 @@ func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Failed to encode response: %v", err)
 	}
 }
+
+// mergeGuestCart moves the cart an anonymous shopper built before signing in
+// into their account. A failed merge leaves the guest cart in place and does
+// not fail the sign-in.
+func (h *AuthHandler) mergeGuestCart(r *http.Request, userID string) {
+	token := r.Header.Get(CartTokenHeader)
+	if userID == "" || !validCartToken(token) {
+		return
+	}
+
+	if _, err := h.cartClient.MergeCarts(r.Context(), &cartpb.MergeCartsRequest{
+		UserId:    userID,
+		CartToken: token,
+	}); err != nil {
+		log.Printf("Failed to merge guest cart into cart of user %s: %v", userID, err)
+	}
+}
@@ -1,9 +1,14 @@
 package handler
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/safar/microservices-demo/gateway/internal/client"
@@ -11,6 +16,8 @@ import (
 	"github.com/safar/microservices-demo/gateway/internal/middleware"
 	"github.com/safar/microservices-demo/gateway/internal/validation"
 	cartpb "github.com/safar/microservices-demo/proto/cart/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type CartHandler struct {
@@ -23,10 +30,87 @@ func NewCartHandler(cartClient *client.CartClient) *CartHandler {
 	}
 }
 
+// CartTokenHeader carries the opaque token naming an anonymous shopper's
+// cart. Cart responses to anonymous requests without a valid token carry a
+// newly issued one.
+const CartTokenHeader = "X-Cart-Token"
+
+// guestCartPrefix starts the cart owner the cart service uses for a guest
+// cart, followed by its cart token.
+const guestCartPrefix = "guest:"
+
+// cartOwner returns who owns the request's cart: the signed-in user, or
+// for anonymous shoppers the guest cart of their cart token.
+func cartOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if userID, ok := r.Context().Value(middleware.UserIDKey).(string); ok && userID != "" {
+		return userID, true
+	}
+
+	token := r.Header.Get(CartTokenHeader)
+	if !validCartToken(token) {
+		var err error
+		token, err = newCartToken()
+		if err != nil {
+			log.Printf("Failed to issue cart token: %v", err)
+			errors.WriteError(w, http.StatusInternalServerError, "Failed to create cart", nil)
+			return "", false
+		}
+	}
+
+	w.Header().Set(CartTokenHeader, token)
+	return guestCartPrefix + token, true
+}
+
+func newCartToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func validCartToken(token string) bool {
+	if len(token) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(token)
+	return err == nil
+}
+
+// cartETag is the ETag of a cart at version.
+func cartETag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// expectedCartVersion returns the cart version named by the request's
+// If-Match header, or 0 when the request does not name one.
+func expectedCartVersion(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return 0, true
+	}
+
+	version, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`), 10, 64)
+	if err != nil || version < 0 {
+		errors.WriteError(w, http.StatusBadRequest, "Invalid If-Match header", nil)
+		return 0, false
+	}
+	return version, true
+}
+
+// writeCartError writes err, reporting a cart that changed since the
+// version in If-Match as 412 Precondition Failed.
+func writeCartError(w http.ResponseWriter, err error) {
+	if status.Code(err) == codes.Aborted {
+		errors.WriteError(w, http.StatusPreconditionFailed, status.Convert(err).Message(), nil)
+		return
+	}
+	errors.WriteGRPCError(w, err)
+}
+
 func (h *CartHandler) GetCart(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
-	if !ok || userID == "" {
-		errors.WriteError(w, http.StatusUnauthorized, "User ID not found in context", nil)
+	userID, ok := cartOwner(w, r)
+	if !ok {
 		return
 	}
 
@@ -35,10 +119,11 @@ func (h *CartHandler) GetCart(w http.ResponseWriter, r *http.Request) {
 	})
 	if err != nil {
 		log.Printf("Failed to get cart for user %s: %v", userID, err)
-		errors.WriteGRPCError(w, err)
+		writeCartError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", cartETag(resp.Version))
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		log.Printf("Failed to encode response: %v", err)
@@ -46,33 +131,33 @@ func (h *CartHandler) GetCart(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *CartHandler) AddItem(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
-	if !ok || userID == "" {
-		errors.WriteError(w, http.StatusUnauthorized, "User ID not found in context", nil)
+	userID, ok := cartOwner(w, r)
+	if !ok {
+		return
+	}
+
+	expectedVersion, ok := expectedCartVersion(w, r)
+	if !ok {
 		return
 	}
 
-	var req cartpb.AddItemRequest
+	// Only the product, variant and quantity are taken from the client;
+	// the cart service prices the item from the catalog
+	var req struct {
+		ProductID string `json:"product_id"`
+		VariantID string `json:"variant_id"`
+		Quantity  int32  `json:"quantity"`
+	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("Failed to decode add item request: %v", err)
 		errors.WriteError(w, http.StatusBadRequest, "Invalid request body", nil)
 		return
 	}
-	req.UserId = userID
 
 	// Validate input
 	validationErrors := validation.Validate(
-		func() *errors.ValidationError { return validation.ValidateRequired("product_id", req.ProductId) },
+		func() *errors.ValidationError { return validation.ValidateRequired("product_id", req.ProductID) },
 		func() *errors.ValidationError { return validation.ValidatePositive("quantity", int64(req.Quantity)) },
-		func() *errors.ValidationError {
-			if req.UnitPrice == nil {
-				return &errors.ValidationError{
-					Field:   "unit_price",
-					Message: "unit_price is required",
-				}
-			}
-			return nil
-		},
 	)
 
 	if len(validationErrors) > 0 {
@@ -80,13 +165,20 @@ func (h *CartHandler) AddItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := h.cartClient.AddItem(r.Context(), &req)
+	resp, err := h.cartClient.AddItem(r.Context(), &cartpb.AddItemRequest{
+		UserId:          userID,
+		ProductId:       req.ProductID,
+		VariantId:       req.VariantID,
+		Quantity:        req.Quantity,
+		ExpectedVersion: expectedVersion,
+	})
 	if err != nil {
 		log.Printf("Failed to add item to cart for user %s: %v", userID, err)
-		errors.WriteGRPCError(w, err)
+		writeCartError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", cartETag(resp.Version))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
@@ -95,9 +187,13 @@ func (h *CartHandler) AddItem(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *CartHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
-	if !ok || userID == "" {
-		errors.WriteError(w, http.StatusUnauthorized, "User ID not found in context", nil)
+	userID, ok := cartOwner(w, r)
+	if !ok {
+		return
+	}
+
+	expectedVersion, ok := expectedCartVersion(w, r)
+	if !ok {
 		return
 	}
 
@@ -127,16 +223,19 @@ func (h *CartHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp, err := h.cartClient.UpdateItem(r.Context(), &cartpb.UpdateItemRequest{
-		UserId:    userID,
-		ProductId: productID,
-		Quantity:  req.Quantity,
+		UserId:          userID,
+		ProductId:       productID,
+		VariantId:       r.URL.Query().Get("variant_id"),
+		Quantity:        req.Quantity,
+		ExpectedVersion: expectedVersion,
 	})
 	if err != nil {
 		log.Printf("Failed to update cart item for user %s: %v", userID, err)
-		errors.WriteGRPCError(w, err)
+		writeCartError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", cartETag(resp.Version))
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		log.Printf("Failed to encode response: %v", err)
@@ -144,9 +243,13 @@ func (h *CartHandler) UpdateItem(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *CartHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
-	if !ok || userID == "" {
-		errors.WriteError(w, http.StatusUnauthorized, "User ID not found in context", nil)
+	userID, ok := cartOwner(w, r)
+	if !ok {
+		return
+	}
+
+	expectedVersion, ok := expectedCartVersion(w, r)
+	if !ok {
 		return
 	}
 
@@ -157,15 +260,139 @@ func (h *CartHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
 	}
 
 	resp, err := h.cartClient.RemoveItem(r.Context(), &cartpb.RemoveItemRequest{
-		UserId:    userID,
-		ProductId: productID,
+		UserId:          userID,
+		ProductId:       productID,
+		VariantId:       r.URL.Query().Get("variant_id"),
+		ExpectedVersion: expectedVersion,
 	})
 	if err != nil {
 		log.Printf("Failed to remove cart item for user %s: %v", userID, err)
-		errors.WriteGRPCError(w, err)
+		writeCartError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", cartETag(resp.Version))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func (h *CartHandler) SaveForLater(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cartOwner(w, r)
+	if !ok {
+		return
+	}
+
+	expectedVersion, ok := expectedCartVersion(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ProductID string `json:"product_id"`
+		VariantID string `json:"variant_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode save for later request: %v", err)
+		errors.WriteError(w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+
+	validationErrors := validation.Validate(
+		func() *errors.ValidationError { return validation.ValidateRequired("product_id", req.ProductID) },
+	)
+
+	if len(validationErrors) > 0 {
+		errors.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	resp, err := h.cartClient.MoveToSavedForLater(r.Context(), &cartpb.MoveToSavedForLaterRequest{
+		UserId:          userID,
+		ProductId:       req.ProductID,
+		VariantId:       req.VariantID,
+		ExpectedVersion: expectedVersion,
+	})
+	if err != nil {
+		log.Printf("Failed to save cart item for later for user %s: %v", userID, err)
+		writeCartError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", cartETag(resp.Version))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func (h *CartHandler) MoveToCart(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cartOwner(w, r)
+	if !ok {
+		return
+	}
+
+	expectedVersion, ok := expectedCartVersion(w, r)
+	if !ok {
+		return
+	}
+
+	productID := chi.URLParam(r, "id")
+	if productID == "" {
+		errors.WriteError(w, http.StatusBadRequest, "Product ID is required", nil)
+		return
+	}
+
+	resp, err := h.cartClient.MoveToCart(r.Context(), &cartpb.MoveToCartRequest{
+		UserId:          userID,
+		ProductId:       productID,
+		VariantId:       r.URL.Query().Get("variant_id"),
+		ExpectedVersion: expectedVersion,
+	})
+	if err != nil {
+		log.Printf("Failed to move saved item to cart for user %s: %v", userID, err)
+		writeCartError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", cartETag(resp.Version))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func (h *CartHandler) RemoveSavedItem(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cartOwner(w, r)
+	if !ok {
+		return
+	}
+
+	expectedVersion, ok := expectedCartVersion(w, r)
+	if !ok {
+		return
+	}
+
+	productID := chi.URLParam(r, "id")
+	if productID == "" {
+		errors.WriteError(w, http.StatusBadRequest, "Product ID is required", nil)
+		return
+	}
+
+	resp, err := h.cartClient.RemoveSavedItem(r.Context(), &cartpb.RemoveSavedItemRequest{
+		UserId:          userID,
+		ProductId:       productID,
+		VariantId:       r.URL.Query().Get("variant_id"),
+		ExpectedVersion: expectedVersion,
+	})
+	if err != nil {
+		log.Printf("Failed to remove saved item for user %s: %v", userID, err)
+		writeCartError(w, err)
 		return
 	}
 
+	w.Header().Set("ETag", cartETag(resp.Version))
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
 		log.Printf("Failed to encode response: %v", err)
@@ -173,19 +400,131 @@ func (h *CartHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *CartHandler) ClearCart(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
-	if !ok || userID == "" {
-		errors.WriteError(w, http.StatusUnauthorized, "User ID not found in context", nil)
+	userID, ok := cartOwner(w, r)
+	if !ok {
+		return
+	}
+
+	expectedVersion, ok := expectedCartVersion(w, r)
+	if !ok {
 		return
 	}
 
 	if err := h.cartClient.ClearCart(r.Context(), &cartpb.ClearCartRequest{
-		UserId: userID,
+		UserId:          userID,
+		ExpectedVersion: expectedVersion,
 	}); err != nil {
 		log.Printf("Failed to clear cart for user %s: %v", userID, err)
-		errors.WriteGRPCError(w, err)
+		writeCartError(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func (h *CartHandler) ApplyCoupon(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cartOwner(w, r)
+	if !ok {
+		return
+	}
+
+	expectedVersion, ok := expectedCartVersion(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		CouponCode string `json:"coupon_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Failed to decode apply coupon request: %v", err)
+		errors.WriteError(w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+
+	// Validate input
+	validationErrors := validation.Validate(
+		func() *errors.ValidationError { return validation.ValidateRequired("coupon_code", req.CouponCode) },
+		func() *errors.ValidationError { return validation.ValidateMaxLength("coupon_code", req.CouponCode, 100) },
+	)
+
+	if len(validationErrors) > 0 {
+		errors.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	resp, err := h.cartClient.ApplyCoupon(r.Context(), &cartpb.ApplyCouponRequest{
+		UserId:          userID,
+		CouponCode:      req.CouponCode,
+		ExpectedVersion: expectedVersion,
+	})
+	if err != nil {
+		log.Printf("Failed to apply coupon for user %s: %v", userID, err)
+		writeCartError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", cartETag(resp.Version))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+func (h *CartHandler) RemoveCoupon(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cartOwner(w, r)
+	if !ok {
+		return
+	}
+
+	expectedVersion, ok := expectedCartVersion(w, r)
+	if !ok {
+		return
+	}
+
+	resp, err := h.cartClient.RemoveCoupon(r.Context(), &cartpb.RemoveCouponRequest{
+		UserId:          userID,
+		ExpectedVersion: expectedVersion,
+	})
+	if err != nil {
+		log.Printf("Failed to remove coupon for user %s: %v", userID, err)
+		writeCartError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", cartETag(resp.Version))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
+
+// AcceptPriceChanges accepts the current price of every cart item flagged
+// price_changed. Orders cannot be placed until the new prices are accepted.
+func (h *CartHandler) AcceptPriceChanges(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cartOwner(w, r)
+	if !ok {
+		return
+	}
+
+	expectedVersion, ok := expectedCartVersion(w, r)
+	if !ok {
+		return
+	}
+
+	resp, err := h.cartClient.AcceptPriceChanges(r.Context(), &cartpb.AcceptPriceChangesRequest{
+		UserId:          userID,
+		ExpectedVersion: expectedVersion,
+	})
+	if err != nil {
+		log.Printf("Failed to accept price changes for user %s: %v", userID, err)
+		writeCartError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", cartETag(resp.Version))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to encode response: %v", err)
+	}
+}
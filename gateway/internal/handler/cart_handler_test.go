@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/safar/microservices-demo/gateway/internal/middleware"
+)
+
+func TestValidCartToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{name: "issued token", token: "0123456789abcdef0123456789abcdef", want: true},
+		{name: "upper-case hex", token: "0123456789ABCDEF0123456789ABCDEF", want: true},
+		{name: "empty", token: "", want: false},
+		{name: "too short", token: "0123456789abcdef", want: false},
+		{name: "too long", token: "0123456789abcdef0123456789abcdef00", want: false},
+		{name: "not hex", token: "0123456789abcdef0123456789abcdeg", want: false},
+		{name: "owner prefix smuggled in", token: "guest:0123456789abcdef0123456789", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validCartToken(tt.token); got != tt.want {
+				t.Fatalf("validCartToken(%q) = %v, want %v", tt.token, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCartOwner(t *testing.T) {
+	const token = "0123456789abcdef0123456789abcdef"
+
+	t.Run("signed-in user owns their cart", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/cart", nil)
+		req.Header.Set(CartTokenHeader, token)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+		rec := httptest.NewRecorder()
+
+		owner, ok := cartOwner(rec, req)
+		if !ok || owner != "user-1" {
+			t.Fatalf("expected user-1, got %q", owner)
+		}
+		if rec.Header().Get(CartTokenHeader) != "" {
+			t.Fatalf("expected no cart token for a signed-in user")
+		}
+	})
+
+	t.Run("guest keeps a valid cart token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/cart", nil)
+		req.Header.Set(CartTokenHeader, token)
+		rec := httptest.NewRecorder()
+
+		owner, ok := cartOwner(rec, req)
+		if !ok || owner != guestCartPrefix+token {
+			t.Fatalf("expected guest owner for %s, got %q", token, owner)
+		}
+		if rec.Header().Get(CartTokenHeader) != token {
+			t.Fatalf("expected the token to be echoed, got %q", rec.Header().Get(CartTokenHeader))
+		}
+	})
+
+	invalid := map[string]string{
+		"guest without a token gets one":         "",
+		"malformed token is replaced":            "not-a-token",
+		"user ID sent as a token is not trusted": "user-1",
+	}
+	for name, header := range invalid {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/cart", nil)
+			if header != "" {
+				req.Header.Set(CartTokenHeader, header)
+			}
+			rec := httptest.NewRecorder()
+
+			owner, ok := cartOwner(rec, req)
+			issued := rec.Header().Get(CartTokenHeader)
+			if !ok || !validCartToken(issued) || issued == header {
+				t.Fatalf("expected a new valid cart token, got %q", issued)
+			}
+			if owner != guestCartPrefix+issued {
+				t.Fatalf("expected owner for the issued token, got %q", owner)
+			}
+		})
+	}
+}
@@ -4,13 +4,20 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	commonpb "github.com/safar/microservices-demo/proto/common/v1"
 	catalogpb "github.com/safar/microservices-demo/proto/catalog/v1"
 	"github.com/safar/microservices-demo/gateway/internal/client"
+	"github.com/safar/microservices-demo/gateway/internal/errors"
+	"github.com/safar/microservices-demo/gateway/internal/middleware"
+	"github.com/safar/microservices-demo/gateway/internal/productfile"
 )
 
+// maxImportFileBytes caps the size of an uploaded product file.
+const maxImportFileBytes = 64 << 20
+
 type CatalogHandler struct {
 	catalogClient *client.CatalogClient
 }
@@ -22,28 +29,30 @@ func NewCatalogHandler(catalogClient *client.CatalogClient) *CatalogHandler {
 }
 
 func (h *CatalogHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	pagination, ok := listPagination(w, r, 10)
+	if !ok {
+		return
+	}
+
 	categoryID := r.URL.Query().Get("category_id")
+	includeDescendants := r.URL.Query().Get("include_descendants") == "true"
 	activeOnly := r.URL.Query().Get("active_only") == "true"
 
-	if page <= 0 {
-		page = 1
-	}
-	if pageSize <= 0 {
-		pageSize = 10
+	sort, ok := searchSorts[r.URL.Query().Get("sort")]
+	if !ok && r.URL.Query().Get("sort") != "" {
+		http.Error(w, "invalid sort", http.StatusBadRequest)
+		return
 	}
 
 	resp, err := h.catalogClient.ListProducts(r.Context(), &catalogpb.ListProductsRequest{
-		Pagination: &commonpb.Pagination{
-			Page:     int32(page),
-			PageSize: int32(pageSize),
-		},
-		CategoryId: categoryID,
-		ActiveOnly: activeOnly,
+		Pagination:         pagination,
+		CategoryId:         categoryID,
+		ActiveOnly:         activeOnly,
+		IncludeDescendants: includeDescendants,
+		Sort:               sort,
 	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		errors.WriteGRPCError(w, err)
 		return
 	}
 
@@ -66,11 +75,39 @@ func (h *CatalogHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// searchSorts maps the sort query parameter of product search to its
+// proto value.
+var searchSorts = map[string]catalogpb.SearchSort{
+	"relevance":  catalogpb.SearchSort_SEARCH_SORT_RELEVANCE,
+	"price_asc":  catalogpb.SearchSort_SEARCH_SORT_PRICE_ASC,
+	"price_desc": catalogpb.SearchSort_SEARCH_SORT_PRICE_DESC,
+	"newest":     catalogpb.SearchSort_SEARCH_SORT_NEWEST,
+	"rating":     catalogpb.SearchSort_SEARCH_SORT_RATING,
+}
+
+// SearchProducts searches products. Variant options to filter by are
+// passed as attr.<option>=<value>, such as attr.size=M.
 func (h *CatalogHandler) SearchProducts(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("q")
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
-	categoryID := r.URL.Query().Get("category_id")
+	params := r.URL.Query()
+	query := params.Get("q")
+	page, _ := strconv.Atoi(params.Get("page"))
+	pageSize, _ := strconv.Atoi(params.Get("page_size"))
+	categoryID := params.Get("category_id")
+	minPrice, _ := strconv.ParseInt(params.Get("min_price_cents"), 10, 64)
+	maxPrice, _ := strconv.ParseInt(params.Get("max_price_cents"), 10, 64)
+
+	sort, ok := searchSorts[params.Get("sort")]
+	if !ok && params.Get("sort") != "" {
+		http.Error(w, "invalid sort", http.StatusBadRequest)
+		return
+	}
+
+	attributes := make(map[string]string)
+	for key, values := range params {
+		if name, ok := strings.CutPrefix(key, "attr."); ok && name != "" && len(values) > 0 {
+			attributes[name] = values[0]
+		}
+	}
 
 	if page <= 0 {
 		page = 1
@@ -85,10 +122,31 @@ func (h *CatalogHandler) SearchProducts(w http.ResponseWriter, r *http.Request)
 			Page:     int32(page),
 			PageSize: int32(pageSize),
 		},
-		CategoryId: categoryID,
+		CategoryId:         categoryID,
+		IncludeDescendants: params.Get("include_descendants") == "true",
+		MinPriceCents:      minPrice,
+		MaxPriceCents:      maxPrice,
+		InStockOnly:        params.Get("in_stock") == "true",
+		Attributes:         attributes,
+		Sort:               sort,
 	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// SuggestProducts returns search-as-you-type suggestions for the partly
+// typed query q.
+func (h *CatalogHandler) SuggestProducts(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	resp, err := h.catalogClient.SuggestProducts(r.Context(), r.URL.Query().Get("q"), int32(limit))
+	if err != nil {
+		errors.WriteGRPCError(w, err)
 		return
 	}
 
@@ -107,6 +165,65 @@ func (h *CatalogHandler) ListCategories(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(resp)
 }
 
+func (h *CatalogHandler) GetCategoryTree(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.catalogClient.GetCategoryTree(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *CatalogHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var req catalogpb.CreateCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.catalogClient.CreateCategory(r.Context(), &req)
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// UpdateCategory updates a category; setting parent_id moves it in the tree.
+func (h *CatalogHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	var req catalogpb.UpdateCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Id = chi.URLParam(r, "id")
+
+	resp, err := h.catalogClient.UpdateCategory(r.Context(), &req)
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *CatalogHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	if err := h.catalogClient.DeleteCategory(r.Context(), &catalogpb.DeleteCategoryRequest{
+		Id: chi.URLParam(r, "id"),
+	}); err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (h *CatalogHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	var req catalogpb.CreateProductRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -125,6 +242,113 @@ func (h *CatalogHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// ImportProducts imports the products of a CSV or JSON file uploaded as
+// the multipart form field "file". The format is taken from the format
+// query parameter, or else from the file name. With dry_run=true, nothing
+// is written and the report says what would change.
+func (h *CatalogHandler) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportFileBytes)
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		errors.WriteError(w, http.StatusBadRequest, "expected a multipart/form-data upload", nil)
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			errors.WriteError(w, http.StatusBadRequest, `missing form field "file"`, nil)
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = productfile.FormatOf(part.FileName())
+		}
+		if format != productfile.FormatCSV && format != productfile.FormatJSON {
+			errors.WriteError(w, http.StatusBadRequest, "format must be csv or json", nil)
+			return
+		}
+
+		resp, err := productfile.Import(r.Context(), h.catalogClient, part, format, r.URL.Query().Get("dry_run") == "true")
+		if fileErr, ok := err.(*productfile.FileError); ok {
+			errors.WriteError(w, http.StatusBadRequest, fileErr.Error(), nil)
+			return
+		}
+		if err != nil {
+			errors.WriteGRPCError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+}
+
+// ExportProducts downloads products as a CSV or JSON file, ordered by
+// slug, in the format given by the format query parameter (default csv).
+func (h *CatalogHandler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	format := params.Get("format")
+	if format == "" {
+		format = productfile.FormatCSV
+	}
+	contentTypes := map[string]string{
+		productfile.FormatCSV:  "text/csv",
+		productfile.FormatJSON: "application/json",
+	}
+	contentType, ok := contentTypes[format]
+	if !ok {
+		errors.WriteError(w, http.StatusBadRequest, "format must be csv or json", nil)
+		return
+	}
+
+	// Nothing is written until the first product arrives, so an error
+	// starting the export can still be sent as an error response
+	out := &lazyResponseWriter{w: w, header: func() {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="products.`+format+`"`)
+	}}
+
+	err := productfile.Export(r.Context(), h.catalogClient, &catalogpb.ExportProductsRequest{
+		CategoryId:         params.Get("category_id"),
+		IncludeDescendants: params.Get("include_descendants") == "true",
+		ActiveOnly:         params.Get("active_only") == "true",
+	}, out, format)
+	if err != nil && !out.started {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+	if err != nil {
+		// The status is already sent; abort so the client sees a truncated
+		// download rather than a complete-looking file
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// lazyResponseWriter sets the response headers just before the first
+// write.
+type lazyResponseWriter struct {
+	w       http.ResponseWriter
+	header  func()
+	started bool
+}
+
+func (l *lazyResponseWriter) Write(p []byte) (int, error) {
+	if !l.started {
+		l.header()
+		l.started = true
+	}
+	return l.w.Write(p)
+}
+
 func (h *CatalogHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 
@@ -157,3 +381,538 @@ func (h *CatalogHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// SetProductOptions replaces the option types, such as size or colour, that
+// a product's variants differ in.
+func (h *CatalogHandler) SetProductOptions(w http.ResponseWriter, r *http.Request) {
+	var req catalogpb.SetProductOptionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.ProductId = chi.URLParam(r, "id")
+
+	resp, err := h.catalogClient.SetProductOptions(r.Context(), &req)
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *CatalogHandler) ListVariants(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.catalogClient.ListVariants(r.Context(), &catalogpb.ListVariantsRequest{
+		ProductId:       chi.URLParam(r, "id"),
+		IncludeInactive: r.URL.Query().Get("include_inactive") == "true",
+	})
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *CatalogHandler) CreateVariant(w http.ResponseWriter, r *http.Request) {
+	var req catalogpb.CreateVariantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.ProductId = chi.URLParam(r, "id")
+
+	resp, err := h.catalogClient.CreateVariant(r.Context(), &req)
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *CatalogHandler) UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	var req catalogpb.UpdateVariantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Id = chi.URLParam(r, "variantId")
+
+	resp, err := h.catalogClient.UpdateVariant(r.Context(), &req)
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *CatalogHandler) DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	if err := h.catalogClient.DeleteVariant(r.Context(), &catalogpb.DeleteVariantRequest{
+		Id: chi.URLParam(r, "variantId"),
+	}); err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *CatalogHandler) ListProductPrices(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.catalogClient.ListProductPrices(r.Context(), &catalogpb.ListProductPricesRequest{
+		ProductId: chi.URLParam(r, "id"),
+	})
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *CatalogHandler) CreateProductPrice(w http.ResponseWriter, r *http.Request) {
+	var req catalogpb.CreateProductPriceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.ProductId = chi.URLParam(r, "id")
+
+	resp, err := h.catalogClient.CreateProductPrice(r.Context(), &req)
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *CatalogHandler) CancelProductPrice(w http.ResponseWriter, r *http.Request) {
+	if err := h.catalogClient.CancelProductPrice(r.Context(), &catalogpb.CancelProductPriceRequest{
+		Id: chi.URLParam(r, "priceId"),
+	}); err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPriceHistory returns a product's price history and its lowest price
+// over the last days days, 30 by default.
+func (h *CatalogHandler) GetPriceHistory(w http.ResponseWriter, r *http.Request) {
+	var days int
+	if param := r.URL.Query().Get("days"); param != "" {
+		var err error
+		if days, err = strconv.Atoi(param); err != nil || days <= 0 {
+			errors.WriteError(w, http.StatusBadRequest, "days must be a positive number", nil)
+			return
+		}
+	}
+
+	resp, err := h.catalogClient.GetPriceHistory(r.Context(), &catalogpb.GetPriceHistoryRequest{
+		ProductId: chi.URLParam(r, "id"),
+		Days:      int32(days),
+	})
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// movementReasons maps the reason of an inventory movement to its proto
+// value.
+var movementReasons = map[string]catalogpb.InventoryMovementReason{
+	"receipt":     catalogpb.InventoryMovementReason_INVENTORY_MOVEMENT_REASON_RECEIPT,
+	"sale":        catalogpb.InventoryMovementReason_INVENTORY_MOVEMENT_REASON_SALE,
+	"reservation": catalogpb.InventoryMovementReason_INVENTORY_MOVEMENT_REASON_RESERVATION,
+	"release":     catalogpb.InventoryMovementReason_INVENTORY_MOVEMENT_REASON_RELEASE,
+	"return":      catalogpb.InventoryMovementReason_INVENTORY_MOVEMENT_REASON_RETURN,
+	"damage":      catalogpb.InventoryMovementReason_INVENTORY_MOVEMENT_REASON_DAMAGE,
+	"adjustment":  catalogpb.InventoryMovementReason_INVENTORY_MOVEMENT_REASON_ADJUSTMENT,
+}
+
+type AdjustStockRequest struct {
+	VariantID   string `json:"variant_id"`
+	WarehouseID string `json:"warehouse_id"`
+	Quantity    int32  `json:"quantity"`
+	Reason      string `json:"reason"`
+	Reference   string `json:"reference"`
+	Note        string `json:"note"`
+}
+
+// AdjustStock records a receipt, return, damage or manual adjustment of a
+// product's stock in the inventory ledger, made by the signed-in admin.
+func (h *CatalogHandler) AdjustStock(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		errors.WriteError(w, http.StatusUnauthorized, "User ID not found in context", nil)
+		return
+	}
+
+	var req AdjustStockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteError(w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+
+	reason, ok := movementReasons[req.Reason]
+	if !ok {
+		errors.WriteError(w, http.StatusBadRequest, "reason must be receipt, return, damage or adjustment", nil)
+		return
+	}
+
+	resp, err := h.catalogClient.AdjustStock(r.Context(), &catalogpb.AdjustStockRequest{
+		ProductId:   chi.URLParam(r, "id"),
+		VariantId:   req.VariantID,
+		WarehouseId: req.WarehouseID,
+		Quantity:    req.Quantity,
+		Reason:      reason,
+		Reference:   req.Reference,
+		Note:        req.Note,
+		ActorId:     userID,
+	})
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetInventoryLevels returns a product's stock and its variants' at each
+// warehouse.
+func (h *CatalogHandler) GetInventoryLevels(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.catalogClient.GetInventoryLevels(r.Context(), &catalogpb.GetInventoryLevelsRequest{
+		ProductId: chi.URLParam(r, "id"),
+	})
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListInventoryMovements lists the inventory ledger newest first, for
+// audits. It filters by product_id, variant_id, warehouse_id, reason,
+// reference, and an RFC 3339 since and until.
+func (h *CatalogHandler) ListInventoryMovements(w http.ResponseWriter, r *http.Request) {
+	pagination, ok := listPagination(w, r, 50)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	reason, ok := movementReasons[query.Get("reason")]
+	if !ok && query.Get("reason") != "" {
+		errors.WriteError(w, http.StatusBadRequest, "invalid reason", nil)
+		return
+	}
+
+	resp, err := h.catalogClient.ListInventoryMovements(r.Context(), &catalogpb.ListInventoryMovementsRequest{
+		Pagination:  pagination,
+		ProductId:   query.Get("product_id"),
+		VariantId:   query.Get("variant_id"),
+		WarehouseId: query.Get("warehouse_id"),
+		Reason:      reason,
+		Reference:   query.Get("reference"),
+		Since:       query.Get("since"),
+		Until:       query.Get("until"),
+	})
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *CatalogHandler) ListWarehouses(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.catalogClient.ListWarehouses(r.Context())
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *CatalogHandler) CreateWarehouse(w http.ResponseWriter, r *http.Request) {
+	var req catalogpb.CreateWarehouseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.catalogClient.CreateWarehouse(r.Context(), &req)
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+type SetReorderThresholdRequest struct {
+	ReorderThreshold int32 `json:"reorder_threshold"`
+}
+
+// SetReorderThreshold sets the stock at or below which a product, or each
+// of its variants, is low on stock. 0 turns low-stock alerts off.
+func (h *CatalogHandler) SetReorderThreshold(w http.ResponseWriter, r *http.Request) {
+	var req SetReorderThresholdRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteError(w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+
+	resp, err := h.catalogClient.SetReorderThreshold(r.Context(), &catalogpb.SetReorderThresholdRequest{
+		ProductId:        chi.URLParam(r, "id"),
+		ReorderThreshold: req.ReorderThreshold,
+	})
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListLowStockProducts lists the products and variants that are low on or
+// out of stock, the least available first.
+func (h *CatalogHandler) ListLowStockProducts(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 50
+	}
+
+	resp, err := h.catalogClient.ListLowStockProducts(r.Context(), &catalogpb.ListLowStockProductsRequest{
+		Pagination: &commonpb.Pagination{
+			Page:     int32(page),
+			PageSize: int32(pageSize),
+		},
+	})
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// reviewStatuses maps the status query parameter of the moderation queue
+// to its proto value.
+var reviewStatuses = map[string]catalogpb.ReviewStatus{
+	"pending":  catalogpb.ReviewStatus_REVIEW_STATUS_PENDING,
+	"approved": catalogpb.ReviewStatus_REVIEW_STATUS_APPROVED,
+	"rejected": catalogpb.ReviewStatus_REVIEW_STATUS_REJECTED,
+}
+
+// reviewSorts maps the sort query parameter of review lists to its proto
+// value.
+var reviewSorts = map[string]catalogpb.ReviewSort{
+	"newest":  catalogpb.ReviewSort_REVIEW_SORT_NEWEST,
+	"helpful": catalogpb.ReviewSort_REVIEW_SORT_HELPFUL,
+}
+
+type SubmitReviewRequest struct {
+	Rating int32  `json:"rating"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+}
+
+type ModerateReviewRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+// ListProductReviews lists a product's approved reviews.
+func (h *CatalogHandler) ListProductReviews(w http.ResponseWriter, r *http.Request) {
+	h.listReviews(w, r, chi.URLParam(r, "id"), catalogpb.ReviewStatus_REVIEW_STATUS_APPROVED)
+}
+
+// ListReviews lists reviews of every product for moderation, pending ones
+// unless another status is asked for.
+func (h *CatalogHandler) ListReviews(w http.ResponseWriter, r *http.Request) {
+	status := catalogpb.ReviewStatus_REVIEW_STATUS_PENDING
+	if param := r.URL.Query().Get("status"); param != "" {
+		var ok bool
+		if status, ok = reviewStatuses[param]; !ok {
+			errors.WriteError(w, http.StatusBadRequest, "invalid status", nil)
+			return
+		}
+	}
+
+	h.listReviews(w, r, r.URL.Query().Get("product_id"), status)
+}
+
+func (h *CatalogHandler) listReviews(w http.ResponseWriter, r *http.Request, productID string, status catalogpb.ReviewStatus) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+
+	sort, ok := reviewSorts[r.URL.Query().Get("sort")]
+	if !ok && r.URL.Query().Get("sort") != "" {
+		errors.WriteError(w, http.StatusBadRequest, "invalid sort", nil)
+		return
+	}
+
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+
+	resp, err := h.catalogClient.ListReviews(r.Context(), &catalogpb.ListReviewsRequest{
+		ProductId: productID,
+		Status:    status,
+		Sort:      sort,
+		Pagination: &commonpb.Pagination{
+			Page:     int32(page),
+			PageSize: int32(pageSize),
+		},
+	})
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// SubmitReview reviews a product the signed-in user bought, replacing
+// their earlier review of it.
+func (h *CatalogHandler) SubmitReview(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		errors.WriteError(w, http.StatusUnauthorized, "User ID not found in context", nil)
+		return
+	}
+
+	var req SubmitReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteError(w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+
+	resp, err := h.catalogClient.SubmitReview(r.Context(), &catalogpb.SubmitReviewRequest{
+		ProductId: chi.URLParam(r, "id"),
+		UserId:    userID,
+		Rating:    req.Rating,
+		Title:     req.Title,
+		Body:      req.Body,
+	})
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// VoteReviewHelpful marks a review as helpful to the signed-in user.
+func (h *CatalogHandler) VoteReviewHelpful(w http.ResponseWriter, r *http.Request) {
+	h.voteReview(w, r, true)
+}
+
+// UnvoteReviewHelpful takes back the signed-in user's helpful vote.
+func (h *CatalogHandler) UnvoteReviewHelpful(w http.ResponseWriter, r *http.Request) {
+	h.voteReview(w, r, false)
+}
+
+func (h *CatalogHandler) voteReview(w http.ResponseWriter, r *http.Request, helpful bool) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		errors.WriteError(w, http.StatusUnauthorized, "User ID not found in context", nil)
+		return
+	}
+
+	resp, err := h.catalogClient.VoteReview(r.Context(), &catalogpb.VoteReviewRequest{
+		ReviewId: chi.URLParam(r, "id"),
+		UserId:   userID,
+		Helpful:  helpful,
+	})
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// DeleteReview deletes the signed-in user's own review.
+func (h *CatalogHandler) DeleteReview(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		errors.WriteError(w, http.StatusUnauthorized, "User ID not found in context", nil)
+		return
+	}
+
+	if err := h.catalogClient.DeleteReview(r.Context(), &catalogpb.DeleteReviewRequest{
+		Id:     chi.URLParam(r, "id"),
+		UserId: userID,
+	}); err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *CatalogHandler) ModerateReview(w http.ResponseWriter, r *http.Request) {
+	var req ModerateReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteError(w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+
+	status, ok := reviewStatuses[req.Status]
+	if !ok {
+		errors.WriteError(w, http.StatusBadRequest, "status must be pending, approved or rejected", nil)
+		return
+	}
+
+	resp, err := h.catalogClient.ModerateReview(r.Context(), &catalogpb.ModerateReviewRequest{
+		Id:     chi.URLParam(r, "id"),
+		Status: status,
+		Note:   req.Note,
+	})
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
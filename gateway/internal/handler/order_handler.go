@@ -3,17 +3,21 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/safar/microservices-demo/gateway/internal/client"
 	"github.com/safar/microservices-demo/gateway/internal/errors"
 	"github.com/safar/microservices-demo/gateway/internal/middleware"
+	"github.com/safar/microservices-demo/gateway/internal/validation"
 	commonpb "github.com/safar/microservices-demo/proto/common/v1"
 	orderpb "github.com/safar/microservices-demo/proto/order/v1"
 )
 
+// checkoutRolledBackReason is the ErrorInfo reason the order service sends
+// when a checkout failed and was rolled back.
+const checkoutRolledBackReason = "CHECKOUT_ROLLED_BACK"
+
 type OrderHandler struct {
 	orderClient *client.OrderClient
 }
@@ -24,9 +28,15 @@ func NewOrderHandler(orderClient *client.OrderClient) *OrderHandler {
 	}
 }
 
+// idempotencyKeyHeader lets clients retry order creation without placing a
+// second order.
+const idempotencyKeyHeader = "Idempotency-Key"
+
 type CreateOrderRequest struct {
 	ShippingAddress *commonpb.Address `json:"shipping_address"`
 	PaymentMethodID string            `json:"payment_method_id"`
+	ShippingCarrier string            `json:"shipping_carrier"`
+	ShippingService string            `json:"shipping_service"`
 }
 
 func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
@@ -46,12 +56,36 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 		errors.WriteError(w, http.StatusBadRequest, "shipping_address and payment_method_id are required", nil)
 		return
 	}
+	if (req.ShippingCarrier == "") != (req.ShippingService == "") {
+		errors.WriteError(w, http.StatusBadRequest, "shipping_carrier and shipping_service must be provided together", nil)
+		return
+	}
+
+	idempotencyKey := r.Header.Get(idempotencyKeyHeader)
+	validationErrors := validation.Validate(
+		func() *errors.ValidationError {
+			return validation.ValidateMaxLength(idempotencyKeyHeader, idempotencyKey, 255)
+		},
+	)
+	if len(validationErrors) > 0 {
+		errors.WriteValidationError(w, validationErrors)
+		return
+	}
 
 	resp, err := h.orderClient.CreateOrder(r.Context(), &orderpb.CreateOrderRequest{
 		UserId:          userID,
 		ShippingAddress: req.ShippingAddress,
 		PaymentMethodId: req.PaymentMethodID,
+		ShippingCarrier: req.ShippingCarrier,
+		ShippingService: req.ShippingService,
+		IdempotencyKey:  idempotencyKey,
 	})
+	if errors.GRPCErrorReason(err) == checkoutRolledBackReason {
+		// Replaying the key cannot succeed; a new checkout needs a new key
+		_, message := errors.GRPCErrorToHTTP(err)
+		errors.WriteError(w, http.StatusConflict, message, nil)
+		return
+	}
 	if err != nil {
 		errors.WriteGRPCError(w, err)
 		return
@@ -62,6 +96,43 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
+type GetShippingQuotesRequest struct {
+	ShippingAddress *commonpb.Address `json:"shipping_address"`
+}
+
+// GetShippingQuotes prices the caller's current cart with every available
+// carrier so they can pick a shipping option before checking out.
+func (h *OrderHandler) GetShippingQuotes(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		errors.WriteError(w, http.StatusUnauthorized, "User ID not found in context", nil)
+		return
+	}
+
+	var req GetShippingQuotesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteError(w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+
+	if req.ShippingAddress == nil {
+		errors.WriteError(w, http.StatusBadRequest, "shipping_address is required", nil)
+		return
+	}
+
+	resp, err := h.orderClient.GetShippingQuotes(r.Context(), &orderpb.GetShippingQuotesRequest{
+		UserId:          userID,
+		ShippingAddress: req.ShippingAddress,
+	})
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
 func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
 	if !ok || userID == "" {
@@ -95,23 +166,16 @@ func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
-	if page <= 0 {
-		page = 1
-	}
-	if pageSize <= 0 {
-		pageSize = 10
+	pagination, ok := listPagination(w, r, 10)
+	if !ok {
+		return
 	}
 
 	statusFilter := parseOrderStatus(r.URL.Query().Get("status"))
 
 	resp, err := h.orderClient.ListOrders(r.Context(), &orderpb.ListOrdersRequest{
-		UserId: userID,
-		Pagination: &commonpb.Pagination{
-			Page:     int32(page),
-			PageSize: int32(pageSize),
-		},
+		UserId:       userID,
+		Pagination:   pagination,
 		StatusFilter: statusFilter,
 	})
 	if err != nil {
@@ -150,6 +214,53 @@ func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(resp)
 }
 
+type UpdateOrderStatusRequest struct {
+	Status string `json:"status"`
+	Notes  string `json:"notes"`
+}
+
+// UpdateOrderStatus moves an order to a new status on behalf of an admin.
+// The order service rejects transitions its state machine does not allow.
+func (h *OrderHandler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		errors.WriteError(w, http.StatusUnauthorized, "User ID not found in context", nil)
+		return
+	}
+
+	orderID := chi.URLParam(r, "id")
+	if orderID == "" {
+		errors.WriteError(w, http.StatusBadRequest, "Order ID is required", nil)
+		return
+	}
+
+	var req UpdateOrderStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errors.WriteError(w, http.StatusBadRequest, "Invalid request body", nil)
+		return
+	}
+
+	status := parseOrderStatus(req.Status)
+	if status == orderpb.OrderStatus_ORDER_STATUS_UNSPECIFIED {
+		errors.WriteError(w, http.StatusBadRequest, "status must be one of pending, confirmed, processing, shipped, delivered, cancelled, refunded", nil)
+		return
+	}
+
+	resp, err := h.orderClient.UpdateOrderStatus(r.Context(), &orderpb.UpdateOrderStatusRequest{
+		Id:        orderID,
+		Status:    status,
+		Notes:     req.Notes,
+		ChangedBy: userID,
+	})
+	if err != nil {
+		errors.WriteGRPCError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
 func parseOrderStatus(status string) orderpb.OrderStatus {
 	switch strings.ToLower(strings.TrimSpace(status)) {
 	case "pending":
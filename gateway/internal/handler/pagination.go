@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/safar/microservices-demo/gateway/internal/errors"
+	commonpb "github.com/safar/microservices-demo/proto/common/v1"
+)
+
+// countModes maps the count query parameter of list requests to its proto
+// value.
+var countModes = map[string]commonpb.CountMode{
+	"exact":       commonpb.CountMode_COUNT_MODE_EXACT,
+	"approximate": commonpb.CountMode_COUNT_MODE_APPROXIMATE,
+	"none":        commonpb.CountMode_COUNT_MODE_NONE,
+}
+
+// listPagination returns the pagination a list request asks for. Lists
+// page by the page query parameter, or by cursor when page_token is set or
+// cursor=true asks for the first page by cursor. count picks how the total
+// is counted.
+func listPagination(w http.ResponseWriter, r *http.Request, defaultPageSize int) (*commonpb.Pagination, bool) {
+	query := r.URL.Query()
+
+	page, _ := strconv.Atoi(query.Get("page"))
+	pageSize, _ := strconv.Atoi(query.Get("page_size"))
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+
+	count, ok := countModes[query.Get("count")]
+	if !ok && query.Get("count") != "" {
+		errors.WriteError(w, http.StatusBadRequest, "count must be exact, approximate or none", nil)
+		return nil, false
+	}
+
+	return &commonpb.Pagination{
+		Page:         int32(page),
+		PageSize:     int32(pageSize),
+		PageToken:    query.Get("page_token"),
+		UsePageToken: query.Get("cursor") == "true",
+		Count:        count,
+	}, true
+}
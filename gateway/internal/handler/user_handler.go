@@ -3,9 +3,9 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
 
 	"github.com/safar/microservices-demo/gateway/internal/client"
+	"github.com/safar/microservices-demo/gateway/internal/errors"
 	"github.com/safar/microservices-demo/gateway/internal/middleware"
 	commonpb "github.com/safar/microservices-demo/proto/common/v1"
 	userpb "github.com/safar/microservices-demo/proto/user/v1"
@@ -144,24 +144,16 @@ func (h *UserHandler) AddToWishlist(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
-	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
-	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
-
-	if page <= 0 {
-		page = 1
-	}
-	if pageSize <= 0 {
-		pageSize = 20
+	pagination, ok := listPagination(w, r, 20)
+	if !ok {
+		return
 	}
 
 	resp, err := h.userClient.ListUsers(r.Context(), &userpb.ListUsersRequest{
-		Pagination: &commonpb.Pagination{
-			Page:     int32(page),
-			PageSize: int32(pageSize),
-		},
+		Pagination: pagination,
 	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		errors.WriteGRPCError(w, err)
 		return
 	}
 
@@ -32,36 +32,56 @@ func Auth(jwtSecret string) func(http.Handler) http.Handler {
 				return
 			}
 
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				http.Error(w, "invalid authorization header", http.StatusUnauthorized)
+			authenticate(jwtSecret, authHeader, next, w, r)
+		})
+	}
+}
+
+// OptionalAuth authenticates requests that carry an Authorization header
+// and lets anonymous requests through without a user in their context.
+func OptionalAuth(jwtSecret string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				next.ServeHTTP(w, r)
 				return
 			}
 
-			tokenString := parts[1]
+			authenticate(jwtSecret, authHeader, next, w, r)
+		})
+	}
+}
 
-			token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-				return []byte(jwtSecret), nil
-			})
+func authenticate(jwtSecret, authHeader string, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		http.Error(w, "invalid authorization header", http.StatusUnauthorized)
+		return
+	}
 
-			if err != nil || !token.Valid {
-				http.Error(w, "invalid token", http.StatusUnauthorized)
-				return
-			}
+	tokenString := parts[1]
 
-			claims, ok := token.Claims.(*Claims)
-			if !ok {
-				http.Error(w, "invalid token claims", http.StatusUnauthorized)
-				return
-			}
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(jwtSecret), nil
+	})
 
-			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
-			ctx = context.WithValue(ctx, UserEmailKey, claims.Email)
-			ctx = context.WithValue(ctx, UserRoleKey, claims.Role)
+	if err != nil || !token.Valid {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
 
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
+	claims, ok := token.Claims.(*Claims)
+	if !ok {
+		http.Error(w, "invalid token claims", http.StatusUnauthorized)
+		return
 	}
+
+	ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+	ctx = context.WithValue(ctx, UserEmailKey, claims.Email)
+	ctx = context.WithValue(ctx, UserRoleKey, claims.Role)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
 }
 
 func AdminOnly(next http.Handler) http.Handler {
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "test-secret"
+
+func signedToken(t *testing.T, secret, userID string, expiresAt time.Time) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		UserID: userID,
+		Email:  userID + "@example.test",
+		Role:   "customer",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestOptionalAuth(t *testing.T) {
+	valid := signedToken(t, testSecret, "user-1", time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantUserID string
+	}{
+		{name: "anonymous request passes without a user", wantStatus: http.StatusOK},
+		{name: "valid token sets the user", header: "Bearer " + valid, wantStatus: http.StatusOK, wantUserID: "user-1"},
+		{name: "malformed header is rejected", header: "Token " + valid, wantStatus: http.StatusUnauthorized},
+		{
+			name:       "token signed with another secret is rejected",
+			header:     "Bearer " + signedToken(t, "other-secret", "user-1", time.Now().Add(time.Hour)),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "expired token is rejected",
+			header:     "Bearer " + signedToken(t, testSecret, "user-1", time.Now().Add(-time.Hour)),
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUserID string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUserID, _ = r.Context().Value(UserIDKey).(string)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/cart", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			OptionalAuth(testSecret)(next).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if gotUserID != tt.wantUserID {
+				t.Fatalf("expected user %q, got %q", tt.wantUserID, gotUserID)
+			}
+		})
+	}
+}
+
+func TestAuthRejectsAnonymousRequests(t *testing.T) {
+	called := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true })
+
+	rec := httptest.NewRecorder()
+	Auth(testSecret)(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+	if rec.Code != http.StatusUnauthorized || called {
+		t.Fatalf("expected 401 without calling the handler, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,457 @@
+// Package productfile reads and writes catalog products as CSV or JSON
+// files, and streams them to and from the catalog service's import and
+// export RPCs.
+package productfile
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/safar/microservices-demo/gateway/internal/client"
+	catalogpb "github.com/safar/microservices-demo/proto/catalog/v1"
+)
+
+// File formats.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Columns are the CSV columns, in the order they are exported. Only slug
+// and name are required on import.
+var Columns = []string{
+	"slug", "name", "description", "price_cents", "currency", "category_slug",
+	"image_urls", "stock_quantity", "weight_grams", "is_active",
+}
+
+// imageURLSeparator separates the image URLs of a CSV cell.
+const imageURLSeparator = "|"
+
+// FileError is a problem with a file as a whole, such as a bad CSV header
+// or malformed JSON, that stops it being read.
+type FileError struct {
+	Err error
+}
+
+func (e *FileError) Error() string {
+	return "invalid product file: " + e.Err.Error()
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Row is a product read from a file. Number is its line in a CSV file, or
+// its position in a JSON array. Err is set when the row could not be read
+// as a product, in which case Product holds whatever could be.
+type Row struct {
+	Number  int
+	Product *catalogpb.ProductRecord
+	Err     error
+}
+
+// jsonProduct is a product in a JSON file. IsActive is a pointer so a
+// product without it is imported active.
+type jsonProduct struct {
+	Slug          string   `json:"slug"`
+	Name          string   `json:"name"`
+	Description   string   `json:"description,omitempty"`
+	PriceCents    int64    `json:"price_cents"`
+	Currency      string   `json:"currency,omitempty"`
+	CategorySlug  string   `json:"category_slug,omitempty"`
+	ImageURLs     []string `json:"image_urls,omitempty"`
+	StockQuantity int32    `json:"stock_quantity"`
+	WeightGrams   int32    `json:"weight_grams"`
+	IsActive      *bool    `json:"is_active,omitempty"`
+}
+
+// FormatOf returns the format of a file name by its extension, or "" if
+// it has neither.
+func FormatOf(filename string) string {
+	switch {
+	case strings.HasSuffix(strings.ToLower(filename), ".csv"):
+		return FormatCSV
+	case strings.HasSuffix(strings.ToLower(filename), ".json"):
+		return FormatJSON
+	}
+	return ""
+}
+
+// Read calls fn with each product of a file in format, stopping at the
+// first error fn returns. Problems with a single product are passed to fn
+// in its Row; problems with the file are returned as a *FileError.
+func Read(r io.Reader, format string, fn func(Row) error) error {
+	switch format {
+	case FormatCSV:
+		return readCSV(r, fn)
+	case FormatJSON:
+		return readJSON(r, fn)
+	}
+	return &FileError{Err: fmt.Errorf("unsupported format %q", format)}
+}
+
+func readCSV(r io.Reader, fn func(Row) error) error {
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return &FileError{Err: errors.New("file is empty")}
+	}
+	if err != nil {
+		return &FileError{Err: err}
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if !isColumn(name) {
+			return &FileError{Err: fmt.Errorf("unknown column %q", name)}
+		}
+		if _, ok := columns[name]; ok {
+			return &FileError{Err: fmt.Errorf("column %q appears twice", name)}
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"slug", "name"} {
+		if _, ok := columns[name]; !ok {
+			return &FileError{Err: fmt.Errorf("missing column %q", name)}
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		var row Row
+		switch {
+		case errors.Is(err, csv.ErrFieldCount):
+			line, _ := reader.FieldPos(0)
+			row = Row{Number: line, Product: &catalogpb.ProductRecord{}, Err: fmt.Errorf("expected %d fields, got %d", len(header), len(record))}
+		case err != nil:
+			return &FileError{Err: err}
+		default:
+			line, _ := reader.FieldPos(0)
+			product, err := parseCSVRecord(record, columns)
+			row = Row{Number: line, Product: product, Err: err}
+		}
+
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
+
+func isColumn(name string) bool {
+	for _, column := range Columns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCSVRecord(record []string, columns map[string]int) (*catalogpb.ProductRecord, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	product := &catalogpb.ProductRecord{
+		Slug:         field("slug"),
+		Name:         field("name"),
+		Description:  field("description"),
+		Currency:     field("currency"),
+		CategorySlug: field("category_slug"),
+		IsActive:     true,
+	}
+
+	for _, url := range strings.Split(field("image_urls"), imageURLSeparator) {
+		if url = strings.TrimSpace(url); url != "" {
+			product.ImageUrls = append(product.ImageUrls, url)
+		}
+	}
+
+	var problems []string
+	if value := field("price_cents"); value != "" {
+		price, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("price_cents %q is not a whole number", value))
+		}
+		product.PriceCents = price
+	}
+	if value := field("stock_quantity"); value != "" {
+		stock, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("stock_quantity %q is not a whole number", value))
+		}
+		product.StockQuantity = int32(stock)
+	}
+	if value := field("weight_grams"); value != "" {
+		weight, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("weight_grams %q is not a whole number", value))
+		}
+		product.WeightGrams = int32(weight)
+	}
+	if value := field("is_active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("is_active %q is not true or false", value))
+		}
+		product.IsActive = active
+	}
+
+	if len(problems) > 0 {
+		return product, errors.New(strings.Join(problems, "; "))
+	}
+	return product, nil
+}
+
+func readJSON(r io.Reader, fn func(Row) error) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	token, err := decoder.Token()
+	if err != nil {
+		return &FileError{Err: err}
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return &FileError{Err: errors.New("expected an array of products")}
+	}
+
+	for number := 1; decoder.More(); number++ {
+		var product jsonProduct
+		err := decoder.Decode(&product)
+
+		// A value of the wrong type or an unknown field is a problem with
+		// this product only, and the decoder has still read past it; any
+		// other error leaves the rest of the file unreadable
+		var typeErr *json.UnmarshalTypeError
+		if err != nil && !errors.As(err, &typeErr) && !strings.HasPrefix(err.Error(), "json: unknown field") {
+			return &FileError{Err: err}
+		}
+
+		row := Row{Number: number, Product: product.toProto(), Err: err}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return &FileError{Err: err}
+	}
+	return nil
+}
+
+func (p *jsonProduct) toProto() *catalogpb.ProductRecord {
+	isActive := true
+	if p.IsActive != nil {
+		isActive = *p.IsActive
+	}
+
+	return &catalogpb.ProductRecord{
+		Slug:          p.Slug,
+		Name:          p.Name,
+		Description:   p.Description,
+		PriceCents:    p.PriceCents,
+		Currency:      p.Currency,
+		CategorySlug:  p.CategorySlug,
+		ImageUrls:     p.ImageURLs,
+		StockQuantity: p.StockQuantity,
+		WeightGrams:   p.WeightGrams,
+		IsActive:      isActive,
+	}
+}
+
+// Writer writes products to a file. Close finishes the file.
+type Writer interface {
+	Write(product *catalogpb.ProductRecord) error
+	Close() error
+}
+
+// NewWriter returns a Writer of files in format.
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(Columns); err != nil {
+			return nil, err
+		}
+		return &csvWriter{writer: writer}, nil
+	case FormatJSON:
+		return &jsonWriter{w: w}, nil
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvWriter) Write(p *catalogpb.ProductRecord) error {
+	return w.writer.Write([]string{
+		p.Slug,
+		p.Name,
+		p.Description,
+		strconv.FormatInt(p.PriceCents, 10),
+		p.Currency,
+		p.CategorySlug,
+		strings.Join(p.ImageUrls, imageURLSeparator),
+		strconv.FormatInt(int64(p.StockQuantity), 10),
+		strconv.FormatInt(int64(p.WeightGrams), 10),
+		strconv.FormatBool(p.IsActive),
+	})
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// jsonWriter writes an array with one product per line.
+type jsonWriter struct {
+	w       io.Writer
+	written int
+}
+
+func (w *jsonWriter) Write(p *catalogpb.ProductRecord) error {
+	isActive := p.IsActive
+	data, err := json.Marshal(jsonProduct{
+		Slug:          p.Slug,
+		Name:          p.Name,
+		Description:   p.Description,
+		PriceCents:    p.PriceCents,
+		Currency:      p.Currency,
+		CategorySlug:  p.CategorySlug,
+		ImageURLs:     p.ImageUrls,
+		StockQuantity: p.StockQuantity,
+		WeightGrams:   p.WeightGrams,
+		IsActive:      &isActive,
+	})
+	if err != nil {
+		return err
+	}
+
+	prefix := ",\n"
+	if w.written == 0 {
+		prefix = "[\n"
+	}
+	w.written++
+
+	_, err = io.WriteString(w.w, prefix+string(data))
+	return err
+}
+
+func (w *jsonWriter) Close() error {
+	end := "\n]\n"
+	if w.written == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(w.w, end)
+	return err
+}
+
+// Import streams the products of a file in format to the catalog service
+// and returns its report, with the rows that could not be read as products
+// added to it. If the file itself is invalid, nothing is imported and a
+// *FileError is returned.
+func Import(ctx context.Context, catalog *client.CatalogClient, r io.Reader, format string, dryRun bool) (*catalogpb.ImportProductsResponse, error) {
+	// Cancelling the stream before it is closed abandons the import
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := catalog.ImportProducts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	send := func(req *catalogpb.ImportProductsRequest) error {
+		err := stream.Send(req)
+		if err == io.EOF {
+			// The service ended the stream; its error comes with the response
+			_, err = stream.CloseAndRecv()
+		}
+		return err
+	}
+
+	if err := send(&catalogpb.ImportProductsRequest{
+		Payload: &catalogpb.ImportProductsRequest_Options{
+			Options: &catalogpb.ImportOptions{DryRun: dryRun},
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	var unreadable []*catalogpb.ImportRowError
+	err = Read(r, format, func(row Row) error {
+		if row.Err != nil {
+			unreadable = append(unreadable, &catalogpb.ImportRowError{
+				Row:     int32(row.Number),
+				Slug:    row.Product.Slug,
+				Message: row.Err.Error(),
+			})
+			return nil
+		}
+		return send(&catalogpb.ImportProductsRequest{
+			Payload: &catalogpb.ImportProductsRequest_Product{Product: row.Product},
+			Row:     int32(row.Number),
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, err
+	}
+
+	resp.TotalRows += int32(len(unreadable))
+	resp.Failed += int32(len(unreadable))
+	resp.Errors = append(resp.Errors, unreadable...)
+	sort.SliceStable(resp.Errors, func(i, j int) bool {
+		return resp.Errors[i].Row < resp.Errors[j].Row
+	})
+
+	return resp, nil
+}
+
+// Export writes the products req selects from the catalog service to w
+// as a file in format.
+func Export(ctx context.Context, catalog *client.CatalogClient, req *catalogpb.ExportProductsRequest, w io.Writer, format string) error {
+	writer, err := NewWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	stream, err := catalog.ExportProducts(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for {
+		product, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := writer.Write(product); err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
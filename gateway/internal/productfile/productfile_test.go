@@ -0,0 +1,290 @@
+package productfile
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	catalogpb "github.com/safar/microservices-demo/proto/catalog/v1"
+)
+
+// readAll reads every row of a file, failing the test on a file error.
+func readAll(t *testing.T, data, format string) []Row {
+	t.Helper()
+	var rows []Row
+	err := Read(strings.NewReader(data), format, func(row Row) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return rows
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{filename: "products.csv", want: FormatCSV},
+		{filename: "PRODUCTS.CSV", want: FormatCSV},
+		{filename: "export.json", want: FormatJSON},
+		{filename: "products.xlsx", want: ""},
+		{filename: "csv", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := FormatOf(tt.filename); got != tt.want {
+			t.Errorf("FormatOf(%q): expected %q, got %q", tt.filename, tt.want, got)
+		}
+	}
+}
+
+func TestReadCSVHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+		want    *catalogpb.ProductRecord
+	}{
+		{
+			name: "columns in any order",
+			data: "price_cents, name ,slug\n1999,Cotton T-Shirt,cotton-t-shirt\n",
+			want: &catalogpb.ProductRecord{Slug: "cotton-t-shirt", Name: "Cotton T-Shirt", PriceCents: 1999, IsActive: true},
+		},
+		{
+			name: "every column",
+			data: strings.Join(Columns, ",") + "\n" +
+				"denim-jeans,Denim Jeans,Slim fit,4999,EUR,clothing,https://img/1.jpg| https://img/2.jpg,40,650,false\n",
+			want: &catalogpb.ProductRecord{
+				Slug: "denim-jeans", Name: "Denim Jeans", Description: "Slim fit", PriceCents: 4999, Currency: "EUR",
+				CategorySlug: "clothing", ImageUrls: []string{"https://img/1.jpg", "https://img/2.jpg"},
+				StockQuantity: 40, WeightGrams: 650, IsActive: false,
+			},
+		},
+		{name: "unknown column", data: "slug,name,colour\n", wantErr: `unknown column "colour"`},
+		{name: "column twice", data: "slug,name,slug\n", wantErr: `column "slug" appears twice`},
+		{name: "missing slug", data: "name,price_cents\n", wantErr: `missing column "slug"`},
+		{name: "missing name", data: "slug\n", wantErr: `missing column "name"`},
+		{name: "empty file", data: "", wantErr: "file is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rows []Row
+			err := Read(strings.NewReader(tt.data), FormatCSV, func(row Row) error {
+				rows = append(rows, row)
+				return nil
+			})
+
+			if tt.wantErr != "" {
+				var fileErr *FileError
+				if !errors.As(err, &fileErr) || fileErr.Err.Error() != tt.wantErr {
+					t.Fatalf("expected file error %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(rows) != 1 || rows[0].Err != nil {
+				t.Fatalf("expected one valid row, got %+v", rows)
+			}
+			if !proto.Equal(rows[0].Product, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, rows[0].Product)
+			}
+		})
+	}
+}
+
+func TestReadCSVRowErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		row     string
+		wantErr string
+	}{
+		{name: "too few fields", row: "cotton-t-shirt,Cotton T-Shirt", wantErr: "expected 5 fields, got 2"},
+		{name: "too many fields", row: "cotton-t-shirt,Cotton T-Shirt,1999,10,true,extra", wantErr: "expected 5 fields, got 6"},
+		{name: "decimal price", row: "cotton-t-shirt,Cotton T-Shirt,19.99,10,true", wantErr: `price_cents "19.99" is not a whole number`},
+		{name: "price with currency", row: "cotton-t-shirt,Cotton T-Shirt,$20,10,true", wantErr: `price_cents "$20" is not a whole number`},
+		{name: "stock out of range", row: "cotton-t-shirt,Cotton T-Shirt,1999,99999999999,true", wantErr: `stock_quantity "99999999999" is not a whole number`},
+		{name: "is_active not a bool", row: "cotton-t-shirt,Cotton T-Shirt,1999,10,yes", wantErr: `is_active "yes" is not true or false`},
+		{
+			name:    "several problems",
+			row:     "cotton-t-shirt,Cotton T-Shirt,free,many,true",
+			wantErr: `price_cents "free" is not a whole number; stock_quantity "many" is not a whole number`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := "slug,name,price_cents,stock_quantity,is_active\n" +
+				"denim-jeans,Denim Jeans,4999,5,true\n" +
+				tt.row + "\n"
+
+			rows := readAll(t, data, FormatCSV)
+			if len(rows) != 2 {
+				t.Fatalf("expected 2 rows, got %d", len(rows))
+			}
+			if rows[0].Err != nil || rows[0].Number != 2 {
+				t.Fatalf("expected a valid row 2, got %+v", rows[0])
+			}
+			bad := rows[1]
+			if bad.Number != 3 || bad.Err == nil || bad.Err.Error() != tt.wantErr {
+				t.Fatalf("expected row 3 to fail with %q, got %d: %v", tt.wantErr, bad.Number, bad.Err)
+			}
+		})
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		wantFileErr string
+		wantRows    int
+		wantRowErrs map[int]string
+	}{
+		{name: "empty array", data: "[]", wantRows: 0},
+		{
+			name:     "array of products",
+			data:     `[{"slug":"denim-jeans","name":"Denim Jeans"},{"slug":"cotton-t-shirt","name":"Cotton T-Shirt","is_active":false}]`,
+			wantRows: 2,
+		},
+		{name: "object instead of array", data: `{"slug":"denim-jeans","name":"Denim Jeans"}`, wantFileErr: "expected an array of products"},
+		{name: "bare string", data: `"products"`, wantFileErr: "expected an array of products"},
+		{name: "empty file", data: "", wantFileErr: "EOF"},
+		{name: "malformed product", data: `[{"slug":}]`, wantFileErr: "invalid character '}' looking for beginning of value"},
+		{
+			name:        "wrong type is a row error",
+			data:        `[{"slug":"denim-jeans","name":"Denim Jeans","price_cents":"49.99"},{"slug":"cotton-t-shirt","name":"Cotton T-Shirt"}]`,
+			wantRows:    2,
+			wantRowErrs: map[int]string{1: "price_cents"},
+		},
+		{
+			name:        "unknown field is a row error",
+			data:        `[{"slug":"denim-jeans","name":"Denim Jeans"},{"slug":"cotton-t-shirt","colour":"red"}]`,
+			wantRows:    2,
+			wantRowErrs: map[int]string{2: `unknown field "colour"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rows []Row
+			err := Read(strings.NewReader(tt.data), FormatJSON, func(row Row) error {
+				rows = append(rows, row)
+				return nil
+			})
+
+			if tt.wantFileErr != "" {
+				var fileErr *FileError
+				if !errors.As(err, &fileErr) || !strings.Contains(fileErr.Err.Error(), tt.wantFileErr) {
+					t.Fatalf("expected file error containing %q, got %v", tt.wantFileErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if len(rows) != tt.wantRows {
+				t.Fatalf("expected %d rows, got %d", tt.wantRows, len(rows))
+			}
+			for i, row := range rows {
+				if row.Number != i+1 {
+					t.Fatalf("expected row %d, got %d", i+1, row.Number)
+				}
+				want, ok := tt.wantRowErrs[row.Number]
+				switch {
+				case !ok && row.Err != nil:
+					t.Fatalf("row %d: expected no error, got %v", row.Number, row.Err)
+				case ok && (row.Err == nil || !strings.Contains(row.Err.Error(), want)):
+					t.Fatalf("row %d: expected error containing %q, got %v", row.Number, want, row.Err)
+				}
+			}
+		})
+	}
+}
+
+func TestReadJSONDefaultsToActive(t *testing.T) {
+	rows := readAll(t, `[{"slug":"denim-jeans","name":"Denim Jeans"},{"slug":"wool-socks","name":"Wool Socks","is_active":false}]`, FormatJSON)
+
+	if !rows[0].Product.IsActive || rows[1].Product.IsActive {
+		t.Fatalf("expected only the first product active, got %v and %v", rows[0].Product.IsActive, rows[1].Product.IsActive)
+	}
+}
+
+func TestReadUnsupportedFormat(t *testing.T) {
+	err := Read(strings.NewReader(""), "xlsx", func(Row) error { return nil })
+
+	var fileErr *FileError
+	if !errors.As(err, &fileErr) {
+		t.Fatalf("expected a file error, got %v", err)
+	}
+}
+
+func TestExportedFilesRoundTrip(t *testing.T) {
+	products := []*catalogpb.ProductRecord{
+		{
+			Slug: "denim-jeans", Name: "Denim Jeans", Description: "Slim fit, \"dark\" wash\nMachine washable",
+			PriceCents: 4999, Currency: "USD", CategorySlug: "clothing",
+			ImageUrls:     []string{"https://img.example/jeans-1.jpg", "https://img.example/jeans-2.jpg"},
+			StockQuantity: 40, WeightGrams: 650, IsActive: true,
+		},
+		{Slug: "wool-socks", Name: "Wool Socks", PriceCents: 899, Currency: "EUR", IsActive: false},
+	}
+
+	for _, format := range []string{FormatCSV, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewWriter(&buf, format)
+			if err != nil {
+				t.Fatalf("failed to create writer: %v", err)
+			}
+			for _, product := range products {
+				if err := writer.Write(product); err != nil {
+					t.Fatalf("failed to write product: %v", err)
+				}
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("failed to close writer: %v", err)
+			}
+
+			rows := readAll(t, buf.String(), format)
+			if len(rows) != len(products) {
+				t.Fatalf("expected %d rows, got %d", len(products), len(rows))
+			}
+			for i, row := range rows {
+				if row.Err != nil {
+					t.Fatalf("row %d: expected no error, got %v", row.Number, row.Err)
+				}
+				if !proto.Equal(row.Product, products[i]) {
+					t.Fatalf("expected %v, got %v", products[i], row.Product)
+				}
+			}
+		})
+	}
+}
+
+func TestExportedEmptyFilesRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer, err := NewWriter(&buf, format)
+			if err != nil {
+				t.Fatalf("failed to create writer: %v", err)
+			}
+			if err := writer.Close(); err != nil {
+				t.Fatalf("failed to close writer: %v", err)
+			}
+
+			if rows := readAll(t, buf.String(), format); len(rows) != 0 {
+				t.Fatalf("expected no rows, got %d", len(rows))
+			}
+		})
+	}
+}
@@ -111,4 +111,13 @@ protoc \
     --go-grpc_opt=paths=source_relative \
     ${PROTO_DIR}/notification/v1/notification.proto
 
+# Generate events proto
+echo -e "${GREEN}Generating events proto...${NC}"
+protoc \
+    --proto_path=${PROTO_DIR} \
+    --go_out=${PROTO_DIR} \
+    --go_opt=paths=source_relative \
+    ${PROTO_DIR}/events/v1/order_events.proto \
+    ${PROTO_DIR}/events/v1/shipment_events.proto
+
 echo -e "${BLUE}Protobuf code generation completed!${NC}"
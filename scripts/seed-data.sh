@@ -35,17 +35,17 @@ SET
   description = EXCLUDED.description;
 
 -- Products
-INSERT INTO products (name, slug, description, price_cents, currency, category_id, image_urls, stock_quantity, is_active)
+INSERT INTO products (name, slug, description, price_cents, currency, category_id, image_urls, is_active)
 VALUES
-  ('Wireless Headphones', 'wireless-headphones', 'Premium noise-canceling wireless headphones with 30-hour battery life', 29900, 'USD', (SELECT id FROM categories WHERE slug = 'electronics'), ARRAY['http://localhost:3000/images/products/wireless-headphones.jpg']::TEXT[], 50, true),
-  ('Smart Watch', 'smart-watch', 'Fitness tracking smartwatch with heart rate monitor and GPS', 39900, 'USD', (SELECT id FROM categories WHERE slug = 'electronics'), ARRAY['http://localhost:3000/images/products/smart-watch.jpg']::TEXT[], 30, true),
-  ('Laptop Backpack', 'laptop-backpack', 'Durable backpack with padded laptop compartment, fits up to 15 inch laptops', 5900, 'USD', (SELECT id FROM categories WHERE slug = 'electronics'), ARRAY['http://localhost:3000/images/products/laptop-backpack.jpg']::TEXT[], 100, true),
-  ('Cotton T-Shirt', 'cotton-t-shirt', 'Comfortable 100% cotton t-shirt, available in multiple colors', 1999, 'USD', (SELECT id FROM categories WHERE slug = 'clothing'), ARRAY['http://localhost:3000/images/products/cotton-t-shirt.png']::TEXT[], 200, true),
-  ('Denim Jeans', 'denim-jeans', 'Classic fit denim jeans, durable and stylish', 4999, 'USD', (SELECT id FROM categories WHERE slug = 'clothing'), ARRAY['http://localhost:3000/images/products/denim-jeans.jpg']::TEXT[], 75, true),
-  ('Winter Jacket', 'winter-jacket', 'Warm and waterproof winter jacket with hood', 12900, 'USD', (SELECT id FROM categories WHERE slug = 'clothing'), ARRAY['http://localhost:3000/images/products/winter-jacket.jpg']::TEXT[], 40, true),
-  ('The Great Gatsby', 'the-great-gatsby', 'Classic American novel by F. Scott Fitzgerald', 1499, 'USD', (SELECT id FROM categories WHERE slug = 'books'), ARRAY['http://localhost:3000/images/products/the-great-gatsby.jpg']::TEXT[], 150, true),
-  ('To Kill a Mockingbird', 'to-kill-a-mockingbird', 'Pulitzer Prize-winning novel by Harper Lee', 1599, 'USD', (SELECT id FROM categories WHERE slug = 'books'), ARRAY['http://localhost:3000/images/products/to-kill-a-mockingbird.jpg']::TEXT[], 120, true),
-  ('1984', 'nineteen-eighty-four', 'Dystopian novel by George Orwell', 1699, 'USD', (SELECT id FROM categories WHERE slug = 'books'), ARRAY['http://localhost:3000/images/products/nineteen-eighty-four.jpg']::TEXT[], 200, true)
+  ('Wireless Headphones', 'wireless-headphones', 'Premium noise-canceling wireless headphones with 30-hour battery life', 29900, 'USD', (SELECT id FROM categories WHERE slug = 'electronics'), ARRAY['http://localhost:3000/images/products/wireless-headphones.jpg']::TEXT[], true),
+  ('Smart Watch', 'smart-watch', 'Fitness tracking smartwatch with heart rate monitor and GPS', 39900, 'USD', (SELECT id FROM categories WHERE slug = 'electronics'), ARRAY['http://localhost:3000/images/products/smart-watch.jpg']::TEXT[], true),
+  ('Laptop Backpack', 'laptop-backpack', 'Durable backpack with padded laptop compartment, fits up to 15 inch laptops', 5900, 'USD', (SELECT id FROM categories WHERE slug = 'electronics'), ARRAY['http://localhost:3000/images/products/laptop-backpack.jpg']::TEXT[], true),
+  ('Cotton T-Shirt', 'cotton-t-shirt', 'Comfortable 100% cotton t-shirt, available in multiple colors', 1999, 'USD', (SELECT id FROM categories WHERE slug = 'clothing'), ARRAY['http://localhost:3000/images/products/cotton-t-shirt.png']::TEXT[], true),
+  ('Denim Jeans', 'denim-jeans', 'Classic fit denim jeans, durable and stylish', 4999, 'USD', (SELECT id FROM categories WHERE slug = 'clothing'), ARRAY['http://localhost:3000/images/products/denim-jeans.jpg']::TEXT[], true),
+  ('Winter Jacket', 'winter-jacket', 'Warm and waterproof winter jacket with hood', 12900, 'USD', (SELECT id FROM categories WHERE slug = 'clothing'), ARRAY['http://localhost:3000/images/products/winter-jacket.jpg']::TEXT[], true),
+  ('The Great Gatsby', 'the-great-gatsby', 'Classic American novel by F. Scott Fitzgerald', 1499, 'USD', (SELECT id FROM categories WHERE slug = 'books'), ARRAY['http://localhost:3000/images/products/the-great-gatsby.jpg']::TEXT[], true),
+  ('To Kill a Mockingbird', 'to-kill-a-mockingbird', 'Pulitzer Prize-winning novel by Harper Lee', 1599, 'USD', (SELECT id FROM categories WHERE slug = 'books'), ARRAY['http://localhost:3000/images/products/to-kill-a-mockingbird.jpg']::TEXT[], true),
+  ('1984', 'nineteen-eighty-four', 'Dystopian novel by George Orwell', 1699, 'USD', (SELECT id FROM categories WHERE slug = 'books'), ARRAY['http://localhost:3000/images/products/nineteen-eighty-four.jpg']::TEXT[], true)
 ON CONFLICT (slug) DO UPDATE
 SET
   name = EXCLUDED.name,
@@ -54,9 +54,27 @@ SET
   currency = EXCLUDED.currency,
   category_id = EXCLUDED.category_id,
   image_urls = EXCLUDED.image_urls,
-  stock_quantity = EXCLUDED.stock_quantity,
   is_active = EXCLUDED.is_active,
   updated_at = NOW();
+
+-- Opening stock, received at the default warehouse for products that have
+-- no inventory movements yet
+INSERT INTO inventory_movements (warehouse_id, product_id, reason, on_hand_change, note)
+SELECT (SELECT id FROM warehouses WHERE is_default), p.id, 'receipt', s.quantity, 'Opening stock'
+FROM (
+  VALUES
+    ('wireless-headphones', 50),
+    ('smart-watch', 30),
+    ('laptop-backpack', 100),
+    ('cotton-t-shirt', 200),
+    ('denim-jeans', 75),
+    ('winter-jacket', 40),
+    ('the-great-gatsby', 150),
+    ('to-kill-a-mockingbird', 120),
+    ('nineteen-eighty-four', 200)
+) AS s (slug, quantity)
+JOIN products p ON p.slug = s.slug
+WHERE NOT EXISTS (SELECT 1 FROM inventory_movements m WHERE m.product_id = p.id);
 SQL
 
 echo "✅ Sample data seeded successfully."
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"time"
 
 	pb "github.com/safar/microservices-demo/proto/cart/v1"
+	"github.com/safar/microservices-demo/services/cart/internal/client"
 	"github.com/safar/microservices-demo/services/cart/internal/config"
 	"github.com/safar/microservices-demo/services/cart/internal/repository"
 	"github.com/safar/microservices-demo/services/cart/internal/server"
@@ -14,16 +17,45 @@ import (
 	"google.golang.org/grpc/reflection"
 )
 
+// guestCartMaxAge is how long a guest cart is kept after its last change.
+const guestCartMaxAge = 30 * 24 * time.Hour
+
 func main() {
 	cfg := config.Load()
 
-	repo, err := repository.NewCartRepository(cfg.DatabaseURL)
+	var repo interface {
+		service.CartStore
+		Close() error
+	}
+	var err error
+	switch cfg.CartStore {
+	case "redis":
+		repo, err = repository.NewRedisCartRepository(cfg.RedisURL, guestCartMaxAge)
+	case "postgres":
+		repo, err = repository.NewCartRepository(cfg.DatabaseURL)
+	default:
+		log.Fatalf("Unknown cart store %q", cfg.CartStore)
+	}
 	if err != nil {
 		log.Fatalf("Failed to initialize repository: %v", err)
 	}
 	defer repo.Close()
 
-	cartService := service.NewCartService(repo)
+	clients, err := client.NewServiceClients(cfg.OrderServiceURL, cfg.CatalogServiceURL, cfg.UserServiceURL, cfg.NotificationServiceURL)
+	if err != nil {
+		log.Fatalf("Failed to initialize service clients: %v", err)
+	}
+	defer clients.Close()
+
+	cartService := service.NewCartService(repo, clients)
+
+	// Delete guest carts abandoned for a month
+	go cartService.RunGuestCartCleanup(context.Background(), time.Hour, guestCartMaxAge)
+
+	// Remind signed-in customers of carts they left behind
+	go cartService.RunCartReminders(context.Background(), time.Hour,
+		time.Duration(cfg.AbandonedCartHours)*time.Hour, cfg.CartReminderLimit)
+
 	grpcServer := server.NewGRPCServer(cartService)
 
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", cfg.Port))
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"fmt"
+
+	catalogpb "github.com/safar/microservices-demo/proto/catalog/v1"
+	notificationpb "github.com/safar/microservices-demo/proto/notification/v1"
+	orderpb "github.com/safar/microservices-demo/proto/order/v1"
+	userpb "github.com/safar/microservices-demo/proto/user/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type ServiceClients struct {
+	Order        orderpb.OrderServiceClient
+	Catalog      catalogpb.CatalogServiceClient
+	User         userpb.UserServiceClient
+	Notification notificationpb.NotificationServiceClient
+	conns        []*grpc.ClientConn
+}
+
+func NewServiceClients(orderURL, catalogURL, userURL, notificationURL string) (*ServiceClients, error) {
+	clients := &ServiceClients{}
+
+	// Connect to Order Service
+	orderConn, err := dialService(orderURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to order service: %w", err)
+	}
+	clients.Order = orderpb.NewOrderServiceClient(orderConn)
+	clients.conns = append(clients.conns, orderConn)
+
+	// Connect to Catalog Service
+	catalogConn, err := dialService(catalogURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to catalog service: %w", err)
+	}
+	clients.Catalog = catalogpb.NewCatalogServiceClient(catalogConn)
+	clients.conns = append(clients.conns, catalogConn)
+
+	// Connect to User Service
+	userConn, err := dialService(userURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to user service: %w", err)
+	}
+	clients.User = userpb.NewUserServiceClient(userConn)
+	clients.conns = append(clients.conns, userConn)
+
+	// Connect to Notification Service
+	notificationConn, err := dialService(notificationURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to notification service: %w", err)
+	}
+	clients.Notification = notificationpb.NewNotificationServiceClient(notificationConn)
+	clients.conns = append(clients.conns, notificationConn)
+
+	return clients, nil
+}
+
+// dialService connects lazily: the order service waits for the cart service
+// when it starts, so blocking here would deadlock the two on startup.
+func dialService(serviceURL string) (*grpc.ClientConn, error) {
+	return grpc.NewClient(serviceURL,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+}
+
+func (c *ServiceClients) Close() error {
+	for _, conn := range c.conns {
+		if err := conn.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
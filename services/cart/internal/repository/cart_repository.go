@@ -10,19 +10,60 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// GuestOwnerPrefix starts the owner of an anonymous shopper's cart; the
+// rest of the owner is the cart token the gateway issued them.
+const GuestOwnerPrefix = "guest:"
+
+var (
+	// ErrVersionConflict is returned when a cart changed since the version
+	// a mutation expected.
+	ErrVersionConflict = errors.New("cart was modified since it was read")
+	ErrItemNotFound    = errors.New("item not found in cart")
+)
+
+// Cart is a shopping cart. Version goes up with every change to the cart
+// or its items and is 0 for a cart that was never stored. SavedItems are
+// set aside for later and are not part of the cart's total or checkout.
 type Cart struct {
-	UserID    string     `json:"user_id"`
-	Items     []CartItem `json:"items"`
-	UpdatedAt time.Time  `json:"updated_at"`
+	UserID     string     `json:"user_id"`
+	Items      []CartItem `json:"items"`
+	SavedItems []CartItem `json:"saved_items"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	CouponCode string     `json:"coupon_code"`
+	Version    int64      `json:"version"`
+	// Discount, FreeShipping and CouponError are priced from CouponCode by
+	// the cart service and are not stored.
+	Discount     Money  `json:"discount"`
+	FreeShipping bool   `json:"free_shipping"`
+	CouponError  string `json:"coupon_error"`
 }
 
+// CartItem is stored with the catalog price it was added at. The cart
+// service replaces UnitPrice with the current catalog price when it reads
+// the cart, keeping the stored price in AddedUnitPrice. A cart has one line
+// per product and variant; VariantID is empty for products without
+// variants.
 type CartItem struct {
-	ProductID   string `json:"product_id"`
-	ProductName string `json:"product_name"`
-	Quantity    int32  `json:"quantity"`
-	UnitPrice   Money  `json:"unit_price"`
-	TotalPrice  Money  `json:"total_price"`
-	ImageURL    string `json:"image_url"`
+	ProductID      string `json:"product_id"`
+	VariantID      string `json:"variant_id"`
+	ProductName    string `json:"product_name"`
+	Quantity       int32  `json:"quantity"`
+	UnitPrice      Money  `json:"unit_price"`
+	TotalPrice     Money  `json:"total_price"`
+	ImageURL       string `json:"image_url"`
+	AddedUnitPrice Money  `json:"added_unit_price"`
+	PriceChanged   bool   `json:"price_changed"`
+	Unavailable    bool   `json:"unavailable"`
+	// SKU and VariantOptions are filled in from the catalog by the cart
+	// service and are not stored.
+	SKU            string            `json:"sku"`
+	VariantOptions map[string]string `json:"variant_options"`
+}
+
+// sameLine reports whether item is the line for the same product and
+// variant as other.
+func (item CartItem) sameLine(other CartItem) bool {
+	return item.ProductID == other.ProductID && item.VariantID == other.VariantID
 }
 
 type Money struct {
@@ -55,17 +96,29 @@ func (r *CartRepository) Close() error {
 	return r.db.Close()
 }
 
+// queryer is implemented by both *sql.DB and *sql.Tx, so carts can be read
+// inside the transaction that changed them.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
 func (r *CartRepository) GetCart(ctx context.Context, userID string) (*Cart, error) {
+	return getCart(ctx, r.db, userID)
+}
+
+func getCart(ctx context.Context, q queryer, userID string) (*Cart, error) {
 	cart := &Cart{
-		UserID: userID,
-		Items:  []CartItem{},
+		UserID:     userID,
+		Items:      []CartItem{},
+		SavedItems: []CartItem{},
 	}
 
-	err := r.db.QueryRowContext(ctx, `
-		SELECT updated_at
+	err := q.QueryRowContext(ctx, `
+		SELECT updated_at, coupon_code, version
 		FROM carts
 		WHERE user_id = $1
-	`, userID).Scan(&cart.UpdatedAt)
+	`, userID).Scan(&cart.UpdatedAt, &cart.CouponCode, &cart.Version)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			cart.UpdatedAt = time.Now().UTC()
@@ -74,176 +127,488 @@ func (r *CartRepository) GetCart(ctx context.Context, userID string) (*Cart, err
 		return nil, fmt.Errorf("failed to get cart: %w", err)
 	}
 
-	rows, err := r.db.QueryContext(ctx, `
-		SELECT product_id, product_name, quantity, unit_price_cents, currency, image_url
+	cart.Items, err = getCartItems(ctx, q, `
+		SELECT product_id, variant_id, product_name, quantity, unit_price_cents, currency, image_url
 		FROM cart_items
 		WHERE user_id = $1
-		ORDER BY product_id ASC
+		ORDER BY product_id ASC, variant_id ASC
 	`, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get cart items: %w", err)
 	}
+
+	cart.SavedItems, err = getCartItems(ctx, q, `
+		SELECT product_id, variant_id, product_name, quantity, unit_price_cents, currency, image_url
+		FROM cart_saved_items
+		WHERE user_id = $1
+		ORDER BY saved_at DESC, product_id ASC, variant_id ASC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved items: %w", err)
+	}
+
+	return cart, nil
+}
+
+// getCartItems reads the lines query selects for userID.
+func getCartItems(ctx context.Context, q queryer, query string, userID string) ([]CartItem, error) {
+	rows, err := q.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
+	items := []CartItem{}
 	for rows.Next() {
 		item := CartItem{}
 		if err := rows.Scan(
 			&item.ProductID,
+			&item.VariantID,
 			&item.ProductName,
 			&item.Quantity,
 			&item.UnitPrice.AmountCents,
 			&item.UnitPrice.Currency,
 			&item.ImageURL,
 		); err != nil {
-			return nil, fmt.Errorf("failed to scan cart item: %w", err)
+			return nil, err
 		}
 
 		item.TotalPrice = Money{
 			AmountCents: item.UnitPrice.AmountCents * int64(item.Quantity),
 			Currency:    item.UnitPrice.Currency,
 		}
-		cart.Items = append(cart.Items, item)
+		items = append(items, item)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("failed to iterate cart items: %w", err)
+		return nil, err
 	}
 
-	return cart, nil
+	return items, nil
 }
 
-func (r *CartRepository) SaveCart(ctx context.Context, cart *Cart) error {
+// updateCart runs update in a transaction after checking that the cart is
+// at expectedVersion and moving it to the next version, then returns the
+// updated cart. An expectedVersion of 0 skips the check.
+func (r *CartRepository) updateCart(ctx context.Context, userID string, expectedVersion int64, update func(tx *sql.Tx) error) (*Cart, error) {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	cart.UpdatedAt = time.Now().UTC()
+	if err := touchCartTx(ctx, tx, userID, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	if err := update(tx); err != nil {
+		return nil, err
+	}
+
+	cart, err := getCart(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return cart, nil
+}
+
+// touchCartTx creates the cart or moves it to its next version. The cart
+// row stays locked until tx ends, so concurrent changes to one cart are
+// applied one after another.
+func touchCartTx(ctx context.Context, tx *sql.Tx, userID string, expectedVersion int64) error {
+	var version int64
+	err := tx.QueryRowContext(ctx, `
+		SELECT version FROM carts WHERE user_id = $1 FOR UPDATE
+	`, userID).Scan(&version)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to lock cart: %w", err)
+	}
+
+	if expectedVersion != 0 && version != expectedVersion {
+		return ErrVersionConflict
+	}
 
 	if _, err := tx.ExecContext(ctx, `
-		INSERT INTO carts (user_id, updated_at)
-		VALUES ($1, $2)
+		INSERT INTO carts (user_id, updated_at, version)
+		VALUES ($1, $2, 1)
 		ON CONFLICT (user_id)
-		DO UPDATE SET updated_at = EXCLUDED.updated_at
-	`, cart.UserID, cart.UpdatedAt); err != nil {
+		DO UPDATE SET updated_at = EXCLUDED.updated_at, version = carts.version + 1
+	`, userID, time.Now().UTC()); err != nil {
 		return fmt.Errorf("failed to upsert cart: %w", err)
 	}
 
-	if _, err := tx.ExecContext(ctx, `DELETE FROM cart_items WHERE user_id = $1`, cart.UserID); err != nil {
-		return fmt.Errorf("failed to clear cart items: %w", err)
-	}
+	return nil
+}
 
-	for _, item := range cart.Items {
+// DeleteCart empties the cart and removes its coupon. Items saved for later
+// are kept; a cart without any is deleted altogether.
+func (r *CartRepository) DeleteCart(ctx context.Context, userID string, expectedVersion int64) error {
+	_, err := r.updateCart(ctx, userID, expectedVersion, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM cart_items WHERE user_id = $1
+		`, userID); err != nil {
+			return fmt.Errorf("failed to delete cart items: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE carts SET coupon_code = '', reminders_sent = 0, last_reminded_at = NULL
+			WHERE user_id = $1
+		`, userID); err != nil {
+			return fmt.Errorf("failed to reset cart: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM carts
+			WHERE user_id = $1
+				AND NOT EXISTS (SELECT 1 FROM cart_saved_items WHERE user_id = $1)
+		`, userID); err != nil {
+			return fmt.Errorf("failed to delete cart: %w", err)
+		}
+		return nil
+	})
+	return err
+}
+
+// AddItem adds item to the cart, or adds its quantity to the existing line
+// for its product and variant, which keeps the price it was first added at.
+func (r *CartRepository) AddItem(ctx context.Context, userID string, item CartItem, expectedVersion int64) (*Cart, error) {
+	return r.updateCart(ctx, userID, expectedVersion, func(tx *sql.Tx) error {
 		if _, err := tx.ExecContext(ctx, `
 			INSERT INTO cart_items (
-				user_id, product_id, product_name, quantity, unit_price_cents, currency, image_url
+				user_id, product_id, variant_id, product_name, quantity, unit_price_cents, currency, image_url
 			)
-			VALUES ($1, $2, $3, $4, $5, $6, $7)
-		`, cart.UserID, item.ProductID, item.ProductName, item.Quantity, item.UnitPrice.AmountCents, item.UnitPrice.Currency, item.ImageURL); err != nil {
-			return fmt.Errorf("failed to insert cart item: %w", err)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (user_id, product_id, variant_id)
+			DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity
+		`, userID, item.ProductID, item.VariantID, item.ProductName, item.Quantity, item.UnitPrice.AmountCents, item.UnitPrice.Currency, item.ImageURL); err != nil {
+			return fmt.Errorf("failed to add cart item: %w", err)
+		}
+		return nil
+	})
+}
+
+// UpdateItem sets the quantity of a product variant in the cart; a
+// quantity of 0 or less removes it.
+func (r *CartRepository) UpdateItem(ctx context.Context, userID, productID, variantID string, quantity int32, expectedVersion int64) (*Cart, error) {
+	return r.updateCart(ctx, userID, expectedVersion, func(tx *sql.Tx) error {
+		var result sql.Result
+		var err error
+		if quantity <= 0 {
+			result, err = tx.ExecContext(ctx, `
+				DELETE FROM cart_items WHERE user_id = $1 AND product_id = $2 AND variant_id = $3
+			`, userID, productID, variantID)
+		} else {
+			result, err = tx.ExecContext(ctx, `
+				UPDATE cart_items SET quantity = $4 WHERE user_id = $1 AND product_id = $2 AND variant_id = $3
+			`, userID, productID, variantID, quantity)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update cart item: %w", err)
+		}
+
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to count updated cart items: %w", err)
+		}
+		if updated == 0 {
+			return ErrItemNotFound
+		}
+		return nil
+	})
+}
+
+func (r *CartRepository) RemoveItem(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*Cart, error) {
+	return r.updateCart(ctx, userID, expectedVersion, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM cart_items WHERE user_id = $1 AND product_id = $2 AND variant_id = $3
+		`, userID, productID, variantID); err != nil {
+			return fmt.Errorf("failed to remove cart item: %w", err)
+		}
+		return nil
+	})
+}
+
+// MoveToSavedForLater moves a product variant's line from the cart to its
+// saved items. If the variant was already saved, the quantities are added
+// up and the saved line keeps its price.
+func (r *CartRepository) MoveToSavedForLater(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*Cart, error) {
+	return r.updateCart(ctx, userID, expectedVersion, func(tx *sql.Tx) error {
+		return moveCartItemTx(ctx, tx, "cart_items", "cart_saved_items", userID, productID, variantID)
+	})
+}
+
+// MoveToCart moves a saved product variant's line back into the cart. If
+// the variant is already in the cart, the quantities are added up and the
+// cart line keeps its price.
+func (r *CartRepository) MoveToCart(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*Cart, error) {
+	return r.updateCart(ctx, userID, expectedVersion, func(tx *sql.Tx) error {
+		return moveCartItemTx(ctx, tx, "cart_saved_items", "cart_items", userID, productID, variantID)
+	})
+}
+
+func (r *CartRepository) RemoveSavedItem(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*Cart, error) {
+	return r.updateCart(ctx, userID, expectedVersion, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM cart_saved_items WHERE user_id = $1 AND product_id = $2 AND variant_id = $3
+		`, userID, productID, variantID); err != nil {
+			return fmt.Errorf("failed to remove saved item: %w", err)
 		}
+		return nil
+	})
+}
+
+// moveCartItemTx moves userID's line for a product variant from the from
+// table to the to table, which are cart_items or cart_saved_items.
+func moveCartItemTx(ctx context.Context, tx *sql.Tx, from, to, userID, productID, variantID string) error {
+	item := CartItem{ProductID: productID, VariantID: variantID}
+	err := tx.QueryRowContext(ctx, `
+		DELETE FROM `+from+`
+		WHERE user_id = $1 AND product_id = $2 AND variant_id = $3
+		RETURNING product_name, quantity, unit_price_cents, currency, image_url
+	`, userID, productID, variantID).Scan(
+		&item.ProductName,
+		&item.Quantity,
+		&item.UnitPrice.AmountCents,
+		&item.UnitPrice.Currency,
+		&item.ImageURL,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrItemNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to take item from %s: %w", from, err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO `+to+` (
+			user_id, product_id, variant_id, product_name, quantity, unit_price_cents, currency, image_url
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id, product_id, variant_id)
+		DO UPDATE SET quantity = `+to+`.quantity + EXCLUDED.quantity
+	`, userID, item.ProductID, item.VariantID, item.ProductName, item.Quantity, item.UnitPrice.AmountCents, item.UnitPrice.Currency, item.ImageURL); err != nil {
+		return fmt.Errorf("failed to put item in %s: %w", to, err)
 	}
 
 	return nil
 }
 
-func (r *CartRepository) DeleteCart(ctx context.Context, userID string) error {
-	if _, err := r.db.ExecContext(ctx, `DELETE FROM carts WHERE user_id = $1`, userID); err != nil {
-		return fmt.Errorf("failed to delete cart: %w", err)
-	}
+// SetItemPrices stores the unit price of each of items' cart lines, so the
+// cart charges that price from then on.
+func (r *CartRepository) SetItemPrices(ctx context.Context, userID string, items []CartItem, expectedVersion int64) (*Cart, error) {
+	return r.updateCart(ctx, userID, expectedVersion, func(tx *sql.Tx) error {
+		for _, item := range items {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE cart_items SET unit_price_cents = $4, currency = $5
+				WHERE user_id = $1 AND product_id = $2 AND variant_id = $3
+			`, userID, item.ProductID, item.VariantID, item.UnitPrice.AmountCents, item.UnitPrice.Currency); err != nil {
+				return fmt.Errorf("failed to set cart item price: %w", err)
+			}
+		}
+		return nil
+	})
+}
 
-	return nil
+// SetCouponCode stores the coupon applied to the cart; an empty code
+// removes it.
+func (r *CartRepository) SetCouponCode(ctx context.Context, userID, couponCode string, expectedVersion int64) (*Cart, error) {
+	return r.updateCart(ctx, userID, expectedVersion, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE carts SET coupon_code = $2 WHERE user_id = $1
+		`, userID, couponCode); err != nil {
+			return fmt.Errorf("failed to set coupon code: %w", err)
+		}
+		return nil
+	})
 }
 
-func (r *CartRepository) AddItem(ctx context.Context, userID string, item CartItem) (*Cart, error) {
+// MergeCarts moves the guest cart owned by guestID into userID's cart and
+// deletes it. A product variant in both carts keeps the user's line at the
+// larger of the two quantities, so items added twice across a login are not
+// doubled. The guest's saved items are added to the user's unless the user
+// saved the variant too. The user's coupon is kept; the guest's coupon is
+// used only if the user has none.
+func (r *CartRepository) MergeCarts(ctx context.Context, guestID, userID string) (*Cart, error) {
+	guest, err := r.GetCart(ctx, guestID)
+	if err != nil {
+		return nil, err
+	}
+
 	cart, err := r.GetCart(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	found := false
-	for i, existing := range cart.Items {
-		if existing.ProductID == item.ProductID {
-			cart.Items[i].Quantity += item.Quantity
-			cart.Items[i].TotalPrice = Money{
-				AmountCents: cart.Items[i].UnitPrice.AmountCents * int64(cart.Items[i].Quantity),
-				Currency:    cart.Items[i].UnitPrice.Currency,
+	if len(guest.Items) == 0 && len(guest.SavedItems) == 0 && guest.CouponCode == "" {
+		return cart, nil
+	}
+
+	mergeCartItems(cart, guest)
+
+	// The merge is computed from the carts as read, so it only applies if
+	// the user's cart did not change since
+	return r.updateCart(ctx, userID, cart.Version, func(tx *sql.Tx) error {
+		for _, item := range cart.Items {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO cart_items (
+					user_id, product_id, variant_id, product_name, quantity, unit_price_cents, currency, image_url
+				)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+				ON CONFLICT (user_id, product_id, variant_id)
+				DO UPDATE SET quantity = EXCLUDED.quantity
+			`, userID, item.ProductID, item.VariantID, item.ProductName, item.Quantity, item.UnitPrice.AmountCents, item.UnitPrice.Currency, item.ImageURL); err != nil {
+				return fmt.Errorf("failed to merge cart item: %w", err)
 			}
-			found = true
-			break
 		}
-	}
 
-	if !found {
-		item.TotalPrice = Money{
-			AmountCents: item.UnitPrice.AmountCents * int64(item.Quantity),
-			Currency:    item.UnitPrice.Currency,
+		for _, item := range cart.SavedItems {
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO cart_saved_items (
+					user_id, product_id, variant_id, product_name, quantity, unit_price_cents, currency, image_url
+				)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+				ON CONFLICT (user_id, product_id, variant_id) DO NOTHING
+			`, userID, item.ProductID, item.VariantID, item.ProductName, item.Quantity, item.UnitPrice.AmountCents, item.UnitPrice.Currency, item.ImageURL); err != nil {
+				return fmt.Errorf("failed to merge saved item: %w", err)
+			}
 		}
-		cart.Items = append(cart.Items, item)
-	}
 
-	if err := r.SaveCart(ctx, cart); err != nil {
-		return nil, err
-	}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE carts SET coupon_code = $2 WHERE user_id = $1
+		`, userID, cart.CouponCode); err != nil {
+			return fmt.Errorf("failed to merge coupon code: %w", err)
+		}
 
-	return cart, nil
+		if _, err := tx.ExecContext(ctx, `DELETE FROM carts WHERE user_id = $1`, guestID); err != nil {
+			return fmt.Errorf("failed to delete guest cart: %w", err)
+		}
+		return nil
+	})
 }
 
-func (r *CartRepository) UpdateItem(ctx context.Context, userID, productID string, quantity int32) (*Cart, error) {
-	cart, err := r.GetCart(ctx, userID)
-	if err != nil {
-		return nil, err
+func mergeCartItems(cart, guest *Cart) {
+	for _, guestItem := range guest.Items {
+		found := false
+		for i, item := range cart.Items {
+			if item.sameLine(guestItem) {
+				if guestItem.Quantity > item.Quantity {
+					cart.Items[i].Quantity = guestItem.Quantity
+					cart.Items[i].TotalPrice = Money{
+						AmountCents: item.UnitPrice.AmountCents * int64(guestItem.Quantity),
+						Currency:    item.UnitPrice.Currency,
+					}
+				}
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			cart.Items = append(cart.Items, guestItem)
+		}
 	}
 
-	found := false
-	for i, item := range cart.Items {
-		if item.ProductID == productID {
-			if quantity <= 0 {
-				cart.Items = append(cart.Items[:i], cart.Items[i+1:]...)
-			} else {
-				cart.Items[i].Quantity = quantity
-				cart.Items[i].TotalPrice = Money{
-					AmountCents: cart.Items[i].UnitPrice.AmountCents * int64(quantity),
-					Currency:    cart.Items[i].UnitPrice.Currency,
-				}
+	for _, guestItem := range guest.SavedItems {
+		found := false
+		for _, item := range cart.SavedItems {
+			if item.sameLine(guestItem) {
+				found = true
+				break
 			}
-			found = true
-			break
+		}
+
+		if !found {
+			cart.SavedItems = append(cart.SavedItems, guestItem)
 		}
 	}
 
-	if !found {
-		return nil, fmt.Errorf("item not found in cart")
+	if cart.CouponCode == "" {
+		cart.CouponCode = guest.CouponCode
 	}
+}
 
-	if err := r.SaveCart(ctx, cart); err != nil {
-		return nil, err
+// DeleteStaleGuestCarts deletes guest carts not updated since before, along
+// with their items, and returns how many were deleted.
+func (r *CartRepository) DeleteStaleGuestCarts(ctx context.Context, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM carts
+		WHERE updated_at < $1 AND user_id LIKE $2
+	`, before, GuestOwnerPrefix+"%")
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete stale guest carts: %w", err)
 	}
 
-	return cart, nil
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted guest carts: %w", err)
+	}
+
+	return deleted, nil
 }
 
-func (r *CartRepository) RemoveItem(ctx context.Context, userID, productID string) (*Cart, error) {
-	cart, err := r.GetCart(ctx, userID)
+// ListAbandonedCarts returns up to limit signed-in users' carts that still
+// hold items, were not updated since idleSince and were sent fewer than
+// maxReminders reminders, none of them since idleSince. The longest idle
+// carts come first.
+func (r *CartRepository) ListAbandonedCarts(ctx context.Context, idleSince time.Time, maxReminders, limit int) ([]*Cart, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT c.user_id
+		FROM carts c
+		WHERE c.updated_at < $1
+			AND c.user_id NOT LIKE $2
+			AND c.reminders_sent < $3
+			AND (c.last_reminded_at IS NULL OR c.last_reminded_at < $1)
+			AND EXISTS (SELECT 1 FROM cart_items i WHERE i.user_id = c.user_id)
+		ORDER BY c.updated_at ASC
+		LIMIT $4
+	`, idleSince, GuestOwnerPrefix+"%", maxReminders, limit)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to list abandoned carts: %w", err)
 	}
+	defer rows.Close()
 
-	for i, item := range cart.Items {
-		if item.ProductID == productID {
-			cart.Items = append(cart.Items[:i], cart.Items[i+1:]...)
-			break
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan abandoned cart: %w", err)
 		}
+		userIDs = append(userIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate abandoned carts: %w", err)
 	}
 
-	if err := r.SaveCart(ctx, cart); err != nil {
-		return nil, err
+	carts := make([]*Cart, 0, len(userIDs))
+	for _, userID := range userIDs {
+		cart, err := getCart(ctx, r.db, userID)
+		if err != nil {
+			return nil, err
+		}
+		carts = append(carts, cart)
 	}
 
-	return cart, nil
+	return carts, nil
+}
+
+// RecordCartReminder notes that userID's cart was checked for a reminder at
+// remindedAt, counting it towards the cart's limit when one was sent. It
+// leaves updated_at and version alone so the cart stays idle.
+func (r *CartRepository) RecordCartReminder(ctx context.Context, userID string, remindedAt time.Time, sent bool) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE carts
+		SET last_reminded_at = $2,
+			reminders_sent = reminders_sent + CASE WHEN $3 THEN 1 ELSE 0 END
+		WHERE user_id = $1
+	`, userID, remindedAt, sent)
+	if err != nil {
+		return fmt.Errorf("failed to record cart reminder: %w", err)
+	}
+
+	return nil
 }
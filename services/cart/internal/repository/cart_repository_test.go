@@ -0,0 +1,79 @@
+package repository
+
+import "testing"
+
+func TestMergeCartItems(t *testing.T) {
+	cart := &Cart{
+		UserID: "user-1",
+		Items: []CartItem{
+			{ProductID: "prod-1", Quantity: 1, UnitPrice: Money{AmountCents: 1500, Currency: "USD"}},
+			{ProductID: "prod-2", Quantity: 3, UnitPrice: Money{AmountCents: 200, Currency: "USD"}},
+		},
+	}
+	guest := &Cart{
+		UserID:     GuestOwnerPrefix + "token-1",
+		CouponCode: "SAVE10",
+		Items: []CartItem{
+			{ProductID: "prod-1", Quantity: 2, UnitPrice: Money{AmountCents: 1400, Currency: "USD"}},
+			{ProductID: "prod-2", Quantity: 1, UnitPrice: Money{AmountCents: 200, Currency: "USD"}},
+			{ProductID: "prod-3", Quantity: 1, UnitPrice: Money{AmountCents: 900, Currency: "USD"}},
+		},
+	}
+
+	mergeCartItems(cart, guest)
+
+	want := map[string]struct {
+		quantity  int32
+		unitCents int64
+	}{
+		"prod-1": {2, 1500},
+		"prod-2": {3, 200},
+		"prod-3": {1, 900},
+	}
+	if len(cart.Items) != len(want) {
+		t.Fatalf("expected %d items, got %+v", len(want), cart.Items)
+	}
+	for _, item := range cart.Items {
+		w := want[item.ProductID]
+		if item.Quantity != w.quantity || item.UnitPrice.AmountCents != w.unitCents {
+			t.Fatalf("%s: expected %d at %d, got %d at %d", item.ProductID, w.quantity, w.unitCents, item.Quantity, item.UnitPrice.AmountCents)
+		}
+	}
+	if cart.CouponCode != "SAVE10" {
+		t.Fatalf("expected guest coupon to be used, got %q", cart.CouponCode)
+	}
+}
+
+func TestMergeCartItemsKeepsUserCoupon(t *testing.T) {
+	cart := &Cart{UserID: "user-1", CouponCode: "MINE"}
+	guest := &Cart{UserID: GuestOwnerPrefix + "token-1", CouponCode: "SAVE10"}
+
+	mergeCartItems(cart, guest)
+
+	if cart.CouponCode != "MINE" {
+		t.Fatalf("expected user coupon to be kept, got %q", cart.CouponCode)
+	}
+}
+
+func TestMergeCartItemsAddsGuestSavedItems(t *testing.T) {
+	cart := &Cart{
+		UserID:     "user-1",
+		SavedItems: []CartItem{{ProductID: "prod-1", Quantity: 1}},
+	}
+	guest := &Cart{
+		UserID: GuestOwnerPrefix + "token-1",
+		SavedItems: []CartItem{
+			{ProductID: "prod-1", Quantity: 4},
+			{ProductID: "prod-2", Quantity: 2},
+		},
+	}
+
+	mergeCartItems(cart, guest)
+
+	if len(cart.Items) != 0 || len(cart.SavedItems) != 2 {
+		t.Fatalf("expected two saved items and an empty cart, got %+v", cart)
+	}
+	if cart.SavedItems[0].Quantity != 1 || cart.SavedItems[1].ProductID != "prod-2" {
+		t.Fatalf("expected user's saved line kept and prod-2 added, got %+v", cart.SavedItems)
+	}
+}
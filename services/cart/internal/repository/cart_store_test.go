@@ -0,0 +1,486 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/safar/microservices-demo/services/cart/internal/repository"
+	"github.com/safar/microservices-demo/services/cart/internal/service"
+)
+
+// testCartStore runs the behaviour every CartStore must share against the
+// stores newStore returns. Each call to newStore must return an empty
+// store.
+func testCartStore(t *testing.T, newStore func(t *testing.T) service.CartStore) {
+	ctx := context.Background()
+
+	t.Run("unknown cart is empty", func(t *testing.T) {
+		store := newStore(t)
+
+		cart, err := store.GetCart(ctx, "user-1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cart.Version != 0 || len(cart.Items) != 0 || len(cart.SavedItems) != 0 {
+			t.Fatalf("expected an empty cart at version 0, got %+v", cart)
+		}
+	})
+
+	t.Run("add item keeps first price and adds quantities", func(t *testing.T) {
+		store := newStore(t)
+
+		mustAddItem(t, store, "user-1", item("prod-1", 1, 1500))
+		cart, err := store.AddItem(ctx, "user-1", item("prod-1", 2, 1800), 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if cart.Version != 2 || len(cart.Items) != 1 {
+			t.Fatalf("expected one line at version 2, got %+v", cart)
+		}
+		if got := cart.Items[0]; got.Quantity != 3 || got.UnitPrice.AmountCents != 1500 || got.TotalPrice.AmountCents != 4500 {
+			t.Fatalf("expected 3 at 1500, got %+v", got)
+		}
+	})
+
+	t.Run("items are ordered by product", func(t *testing.T) {
+		store := newStore(t)
+
+		mustAddItem(t, store, "user-1", item("prod-2", 1, 200))
+		cart := mustAddItem(t, store, "user-1", item("prod-1", 1, 100))
+
+		if productIDs(cart.Items) != "prod-1,prod-2" {
+			t.Fatalf("expected prod-1,prod-2, got %s", productIDs(cart.Items))
+		}
+	})
+
+	t.Run("concurrent adds are not lost", func(t *testing.T) {
+		store := newStore(t)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := store.AddItem(ctx, "user-1", item("prod-1", 1, 1500), 0); err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		cart, err := store.GetCart(ctx, "user-1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cart.Version != 10 || cart.Items[0].Quantity != 10 {
+			t.Fatalf("expected 10 units at version 10, got %d at version %d", cart.Items[0].Quantity, cart.Version)
+		}
+	})
+
+	t.Run("update item sets or removes quantity", func(t *testing.T) {
+		store := newStore(t)
+		mustAddItem(t, store, "user-1", item("prod-1", 1, 1500))
+
+		cart, err := store.UpdateItem(ctx, "user-1", "prod-1", "", 4, 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cart.Items[0].Quantity != 4 {
+			t.Fatalf("expected quantity 4, got %d", cart.Items[0].Quantity)
+		}
+
+		cart, err = store.UpdateItem(ctx, "user-1", "prod-1", "", 0, 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(cart.Items) != 0 {
+			t.Fatalf("expected item to be removed, got %+v", cart.Items)
+		}
+
+		if _, err := store.UpdateItem(ctx, "user-1", "prod-1", "", 1, 0); !errors.Is(err, repository.ErrItemNotFound) {
+			t.Fatalf("expected ErrItemNotFound, got %v", err)
+		}
+	})
+
+	t.Run("remove item", func(t *testing.T) {
+		store := newStore(t)
+		mustAddItem(t, store, "user-1", item("prod-1", 1, 1500))
+
+		cart, err := store.RemoveItem(ctx, "user-1", "prod-1", "", 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(cart.Items) != 0 || cart.Version != 2 {
+			t.Fatalf("expected an empty cart at version 2, got %+v", cart)
+		}
+	})
+
+	t.Run("variants of a product are separate lines", func(t *testing.T) {
+		store := newStore(t)
+
+		small := item("prod-1", 1, 1500)
+		small.VariantID = "var-s"
+		large := item("prod-1", 2, 1700)
+		large.VariantID = "var-l"
+		mustAddItem(t, store, "user-1", small)
+		cart := mustAddItem(t, store, "user-1", large)
+
+		if len(cart.Items) != 2 {
+			t.Fatalf("expected two lines, got %+v", cart.Items)
+		}
+
+		cart, err := store.UpdateItem(ctx, "user-1", "prod-1", "var-l", 5, 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		cart, err = store.RemoveItem(ctx, "user-1", "prod-1", "var-s", 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if len(cart.Items) != 1 {
+			t.Fatalf("expected one line, got %+v", cart.Items)
+		}
+		if got := cart.Items[0]; got.VariantID != "var-l" || got.Quantity != 5 || got.UnitPrice.AmountCents != 1700 {
+			t.Fatalf("expected 5 of var-l at 1700, got %+v", got)
+		}
+	})
+
+	t.Run("stale version is rejected", func(t *testing.T) {
+		store := newStore(t)
+		mustAddItem(t, store, "user-1", item("prod-1", 1, 1500))
+
+		if _, err := store.AddItem(ctx, "user-1", item("prod-2", 1, 200), 5); !errors.Is(err, repository.ErrVersionConflict) {
+			t.Fatalf("expected ErrVersionConflict, got %v", err)
+		}
+		if _, err := store.SetCouponCode(ctx, "user-1", "SAVE10", 5); !errors.Is(err, repository.ErrVersionConflict) {
+			t.Fatalf("expected ErrVersionConflict, got %v", err)
+		}
+		if err := store.DeleteCart(ctx, "user-1", 5); !errors.Is(err, repository.ErrVersionConflict) {
+			t.Fatalf("expected ErrVersionConflict, got %v", err)
+		}
+
+		cart, err := store.AddItem(ctx, "user-1", item("prod-2", 1, 200), 1)
+		if err != nil {
+			t.Fatalf("expected change at the current version to apply, got %v", err)
+		}
+		if cart.Version != 2 || len(cart.Items) != 2 {
+			t.Fatalf("expected two lines at version 2, got %+v", cart)
+		}
+	})
+
+	t.Run("coupon code", func(t *testing.T) {
+		store := newStore(t)
+		mustAddItem(t, store, "user-1", item("prod-1", 1, 1500))
+
+		if _, err := store.SetCouponCode(ctx, "user-1", "SAVE10", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		cart, err := store.GetCart(ctx, "user-1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cart.CouponCode != "SAVE10" {
+			t.Fatalf("expected SAVE10, got %q", cart.CouponCode)
+		}
+	})
+
+	t.Run("set item prices", func(t *testing.T) {
+		store := newStore(t)
+		mustAddItem(t, store, "user-1", item("prod-1", 2, 1500))
+		mustAddItem(t, store, "user-1", item("prod-2", 1, 200))
+
+		cart, err := store.SetItemPrices(ctx, "user-1", []repository.CartItem{item("prod-1", 0, 1800), item("prod-3", 0, 900)}, 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(cart.Items) != 2 || cart.Items[0].UnitPrice.AmountCents != 1800 || cart.Items[0].Quantity != 2 {
+			t.Fatalf("expected prod-1 repriced at 1800 and unknown lines ignored, got %+v", cart.Items)
+		}
+		if cart.Items[1].UnitPrice.AmountCents != 200 {
+			t.Fatalf("expected prod-2 to keep its price, got %d", cart.Items[1].UnitPrice.AmountCents)
+		}
+	})
+
+	t.Run("save for later and move back", func(t *testing.T) {
+		store := newStore(t)
+		mustAddItem(t, store, "user-1", item("prod-1", 2, 1500))
+
+		cart, err := store.MoveToSavedForLater(ctx, "user-1", "prod-1", "", 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(cart.Items) != 0 || len(cart.SavedItems) != 1 || cart.SavedItems[0].Quantity != 2 {
+			t.Fatalf("expected prod-1 to be saved, got %+v", cart)
+		}
+
+		mustAddItem(t, store, "user-1", item("prod-1", 1, 1800))
+		cart, err = store.MoveToCart(ctx, "user-1", "prod-1", "", 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(cart.SavedItems) != 0 || cart.Items[0].Quantity != 3 || cart.Items[0].UnitPrice.AmountCents != 1800 {
+			t.Fatalf("expected 3 of prod-1 at the cart's price, got %+v", cart)
+		}
+
+		if _, err := store.MoveToCart(ctx, "user-1", "prod-1", "", 0); !errors.Is(err, repository.ErrItemNotFound) {
+			t.Fatalf("expected ErrItemNotFound, got %v", err)
+		}
+	})
+
+	t.Run("remove saved item", func(t *testing.T) {
+		store := newStore(t)
+		mustAddItem(t, store, "user-1", item("prod-1", 1, 1500))
+		if _, err := store.MoveToSavedForLater(ctx, "user-1", "prod-1", "", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		cart, err := store.RemoveSavedItem(ctx, "user-1", "prod-1", "", 0)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(cart.SavedItems) != 0 {
+			t.Fatalf("expected no saved items, got %+v", cart.SavedItems)
+		}
+	})
+
+	t.Run("delete cart", func(t *testing.T) {
+		store := newStore(t)
+		mustAddItem(t, store, "user-1", item("prod-1", 1, 1500))
+
+		if err := store.DeleteCart(ctx, "user-1", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		cart, err := store.GetCart(ctx, "user-1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cart.Version != 0 || len(cart.Items) != 0 {
+			t.Fatalf("expected the cart to be gone, got %+v", cart)
+		}
+	})
+
+	t.Run("delete cart keeps saved items", func(t *testing.T) {
+		store := newStore(t)
+		mustAddItem(t, store, "user-1", item("prod-1", 1, 1500))
+		mustAddItem(t, store, "user-1", item("prod-2", 1, 200))
+		if _, err := store.MoveToSavedForLater(ctx, "user-1", "prod-2", "", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err := store.SetCouponCode(ctx, "user-1", "SAVE10", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if err := store.DeleteCart(ctx, "user-1", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		cart, err := store.GetCart(ctx, "user-1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(cart.Items) != 0 || cart.CouponCode != "" || productIDs(cart.SavedItems) != "prod-2" {
+			t.Fatalf("expected only the saved prod-2 to be left, got %+v", cart)
+		}
+	})
+
+	t.Run("merge carts", func(t *testing.T) {
+		store := newStore(t)
+		guestID := repository.GuestOwnerPrefix + "token-1"
+		mustAddItem(t, store, "user-1", item("prod-1", 1, 1500))
+		mustAddItem(t, store, guestID, item("prod-1", 2, 1400))
+		mustAddItem(t, store, guestID, item("prod-2", 1, 200))
+		if _, err := store.SetCouponCode(ctx, guestID, "SAVE10", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		cart, err := store.MergeCarts(ctx, guestID, "user-1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		if productIDs(cart.Items) != "prod-1,prod-2" || cart.CouponCode != "SAVE10" {
+			t.Fatalf("expected prod-1,prod-2 with SAVE10, got %+v", cart)
+		}
+		if got := cart.Items[0]; got.Quantity != 2 || got.UnitPrice.AmountCents != 1500 {
+			t.Fatalf("expected 2 of prod-1 at the user's price, got %+v", got)
+		}
+
+		guest, err := store.GetCart(ctx, guestID)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if guest.Version != 0 || len(guest.Items) != 0 {
+			t.Fatalf("expected the guest cart to be deleted, got %+v", guest)
+		}
+	})
+
+	t.Run("abandoned carts and reminders", func(t *testing.T) {
+		store := newStore(t)
+		mustAddItem(t, store, "user-1", item("prod-1", 1, 1500))
+		mustAddItem(t, store, repository.GuestOwnerPrefix+"token-1", item("prod-1", 1, 1500))
+		mustAddItem(t, store, "user-2", item("prod-1", 1, 1500))
+		if _, err := store.RemoveItem(ctx, "user-2", "prod-1", "", 0); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		now := time.Now()
+		idleSince := now.Add(time.Hour)
+		carts, err := store.ListAbandonedCarts(ctx, idleSince, 2, 10)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if len(carts) != 1 || carts[0].UserID != "user-1" {
+			t.Fatalf("expected only user-1's cart, got %+v", carts)
+		}
+
+		if err := store.RecordCartReminder(ctx, "user-1", now, true); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if carts, _ := store.ListAbandonedCarts(ctx, idleSince, 2, 10); len(carts) != 1 {
+			t.Fatalf("expected a reminder before idleSince not to hold the cart back, got %+v", carts)
+		}
+		if carts, _ := store.ListAbandonedCarts(ctx, idleSince, 1, 10); len(carts) != 0 {
+			t.Fatalf("expected the reminder limit to hold the cart back, got %+v", carts)
+		}
+
+		if err := store.RecordCartReminder(ctx, "user-1", idleSince, false); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if carts, _ := store.ListAbandonedCarts(ctx, idleSince, 2, 10); len(carts) != 0 {
+			t.Fatalf("expected a recent check to hold the cart back, got %+v", carts)
+		}
+
+		cart, err := store.GetCart(ctx, "user-1")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if cart.Version != 1 {
+			t.Fatalf("expected reminders to leave the version alone, got %d", cart.Version)
+		}
+	})
+}
+
+func TestRedisCartStore(t *testing.T) {
+	testCartStore(t, func(t *testing.T) service.CartStore {
+		return newRedisStore(t, miniredis.RunT(t))
+	})
+}
+
+func TestRedisCartStoreExpiresGuestCarts(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := newRedisStore(t, server)
+	guestID := repository.GuestOwnerPrefix + "token-1"
+	mustAddItem(t, store, guestID, item("prod-1", 1, 1500))
+	mustAddItem(t, store, "user-1", item("prod-1", 1, 1500))
+
+	server.FastForward(2 * time.Hour)
+
+	guest, err := store.GetCart(context.Background(), guestID)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(guest.Items) != 0 {
+		t.Fatalf("expected the guest cart to expire, got %+v", guest)
+	}
+
+	cart, err := store.GetCart(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(cart.Items) != 1 {
+		t.Fatalf("expected the signed-in cart to be kept, got %+v", cart)
+	}
+}
+
+// TestPostgresCartStore runs against the database in CART_TEST_DATABASE_URL,
+// which it migrates and empties.
+func TestPostgresCartStore(t *testing.T) {
+	databaseURL := os.Getenv("CART_TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("set CART_TEST_DATABASE_URL to run the Postgres cart store tests")
+	}
+
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	migrations, err := filepath.Glob("../../migrations/*.up.sql")
+	if err != nil {
+		t.Fatalf("failed to list migrations: %v", err)
+	}
+	sort.Strings(migrations)
+	for _, migration := range migrations {
+		query, err := os.ReadFile(migration)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", migration, err)
+		}
+		if _, err := db.Exec(string(query)); err != nil {
+			t.Fatalf("failed to apply %s: %v", migration, err)
+		}
+	}
+
+	testCartStore(t, func(t *testing.T) service.CartStore {
+		if _, err := db.Exec(`TRUNCATE carts CASCADE`); err != nil {
+			t.Fatalf("failed to empty carts: %v", err)
+		}
+
+		store, err := repository.NewCartRepository(databaseURL)
+		if err != nil {
+			t.Fatalf("failed to open store: %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+func newRedisStore(t *testing.T, server *miniredis.Miniredis) *repository.RedisCartRepository {
+	store, err := repository.NewRedisCartRepository(server.Addr(), time.Hour)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func mustAddItem(t *testing.T, store service.CartStore, userID string, item repository.CartItem) *repository.Cart {
+	t.Helper()
+	cart, err := store.AddItem(context.Background(), userID, item, 0)
+	if err != nil {
+		t.Fatalf("failed to add %s: %v", item.ProductID, err)
+	}
+	return cart
+}
+
+func item(productID string, quantity int32, unitCents int64) repository.CartItem {
+	return repository.CartItem{
+		ProductID:   productID,
+		ProductName: "Product " + productID,
+		Quantity:    quantity,
+		UnitPrice:   repository.Money{AmountCents: unitCents, Currency: "USD"},
+	}
+}
+
+func productIDs(items []repository.CartItem) string {
+	ids := ""
+	for i, item := range items {
+		if i > 0 {
+			ids += ","
+		}
+		ids += item.ProductID
+	}
+	return ids
+}
@@ -0,0 +1,680 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// A cart is stored in Redis as three hashes. cart:{owner} holds the cart's
+// own fields. cart:{owner}:items and cart:{owner}:saved hold two fields per
+// line: "qty:{line}", the quantity, which is changed with HINCRBY, and
+// "line:{line}", the rest of the line as JSON, where {line} is named by
+// redisLineID. Signed-in carts are also indexed by their update time in the
+// carts:updated sorted set.
+const (
+	redisQuantityPrefix = "qty:"
+	redisLinePrefix     = "line:"
+	redisUpdatedCarts   = "carts:updated"
+
+	// redisTxRetries is how often a watched transaction is retried when
+	// the cart changes under it.
+	redisTxRetries = 10
+)
+
+// redisLine is the JSON stored for a cart line. AddedAt is when the line
+// was created, so saved items can be listed newest first.
+type redisLine struct {
+	ProductID      string    `json:"product_id"`
+	VariantID      string    `json:"variant_id"`
+	ProductName    string    `json:"product_name"`
+	UnitPriceCents int64     `json:"unit_price_cents"`
+	Currency       string    `json:"currency"`
+	ImageURL       string    `json:"image_url"`
+	AddedAt        time.Time `json:"added_at"`
+}
+
+// redisHashReader is implemented by both *redis.Client and *redis.Tx, so
+// carts can be read while they are watched.
+type redisHashReader interface {
+	HGetAll(ctx context.Context, key string) *redis.MapStringStringCmd
+}
+
+// RedisCartRepository stores carts in Redis. Guest carts expire guestTTL
+// after their last change instead of being deleted by a cleanup job.
+type RedisCartRepository struct {
+	client   *redis.Client
+	guestTTL time.Duration
+}
+
+func NewRedisCartRepository(redisURL string, guestTTL time.Duration) (*RedisCartRepository, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr: redisURL,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	return &RedisCartRepository{client: client, guestTTL: guestTTL}, nil
+}
+
+func (r *RedisCartRepository) Close() error {
+	return r.client.Close()
+}
+
+func redisCartKey(userID string) string {
+	return "cart:" + userID
+}
+
+func redisItemsKey(userID string) string {
+	return "cart:" + userID + ":items"
+}
+
+func redisSavedKey(userID string) string {
+	return "cart:" + userID + ":saved"
+}
+
+// redisLineID names the line for a product variant within a cart's hashes.
+func redisLineID(productID, variantID string) string {
+	if variantID == "" {
+		return productID
+	}
+	return productID + "/" + variantID
+}
+
+func (r *RedisCartRepository) GetCart(ctx context.Context, userID string) (*Cart, error) {
+	var read func() (*Cart, error)
+	if _, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		read = queueGetRedisCart(ctx, pipe, userID)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to get cart: %w", err)
+	}
+
+	return read()
+}
+
+// queueGetRedisCart queues reading the cart on pipe and returns a function
+// building the cart once the pipeline ran.
+func queueGetRedisCart(ctx context.Context, pipe redis.Pipeliner, userID string) func() (*Cart, error) {
+	cart := pipe.HGetAll(ctx, redisCartKey(userID))
+	items := pipe.HGetAll(ctx, redisItemsKey(userID))
+	saved := pipe.HGetAll(ctx, redisSavedKey(userID))
+
+	return func() (*Cart, error) {
+		return redisCart(userID, cart.Val(), items.Val(), saved.Val())
+	}
+}
+
+func getRedisCart(ctx context.Context, r redisHashReader, userID string) (*Cart, error) {
+	cart, err := r.HGetAll(ctx, redisCartKey(userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart: %w", err)
+	}
+	items, err := r.HGetAll(ctx, redisItemsKey(userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart items: %w", err)
+	}
+	saved, err := r.HGetAll(ctx, redisSavedKey(userID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved items: %w", err)
+	}
+
+	return redisCart(userID, cart, items, saved)
+}
+
+func redisCart(userID string, fields, items, saved map[string]string) (*Cart, error) {
+	cart := &Cart{
+		UserID:     userID,
+		Items:      []CartItem{},
+		SavedItems: []CartItem{},
+		UpdatedAt:  time.Now().UTC(),
+	}
+
+	if updatedAt, ok := fields["updated_at"]; ok {
+		t, err := time.Parse(time.RFC3339Nano, updatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cart update time: %w", err)
+		}
+		cart.UpdatedAt = t
+	}
+	if version, ok := fields["version"]; ok {
+		v, err := strconv.ParseInt(version, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cart version: %w", err)
+		}
+		cart.Version = v
+	}
+	cart.CouponCode = fields["coupon_code"]
+
+	var err error
+	if cart.Items, err = redisLines(items, false); err != nil {
+		return nil, fmt.Errorf("failed to read cart items: %w", err)
+	}
+	if cart.SavedItems, err = redisLines(saved, true); err != nil {
+		return nil, fmt.Errorf("failed to read saved items: %w", err)
+	}
+
+	return cart, nil
+}
+
+// redisLines reads the lines of an items or saved hash, ordered by product
+// and variant or, with newestFirst, by when they were added.
+func redisLines(fields map[string]string, newestFirst bool) ([]CartItem, error) {
+	items := []CartItem{}
+	addedAt := map[string]time.Time{}
+
+	for field, value := range fields {
+		lineID, ok := strings.CutPrefix(field, redisLinePrefix)
+		if !ok {
+			continue
+		}
+
+		quantity, err := strconv.ParseInt(fields[redisQuantityPrefix+lineID], 10, 32)
+		if err != nil || quantity <= 0 {
+			continue
+		}
+
+		var line redisLine
+		if err := json.Unmarshal([]byte(value), &line); err != nil {
+			return nil, fmt.Errorf("failed to decode line of %s: %w", lineID, err)
+		}
+		// Lines stored before variants were named by their product alone
+		if line.ProductID == "" {
+			line.ProductID = lineID
+		}
+
+		unitPrice := Money{AmountCents: line.UnitPriceCents, Currency: line.Currency}
+		items = append(items, CartItem{
+			ProductID:   line.ProductID,
+			VariantID:   line.VariantID,
+			ProductName: line.ProductName,
+			Quantity:    int32(quantity),
+			UnitPrice:   unitPrice,
+			TotalPrice: Money{
+				AmountCents: unitPrice.AmountCents * quantity,
+				Currency:    unitPrice.Currency,
+			},
+			ImageURL: line.ImageURL,
+		})
+		addedAt[redisLineID(line.ProductID, line.VariantID)] = line.AddedAt
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		addedA := addedAt[redisLineID(a.ProductID, a.VariantID)]
+		addedB := addedAt[redisLineID(b.ProductID, b.VariantID)]
+		if newestFirst && !addedA.Equal(addedB) {
+			return addedA.After(addedB)
+		}
+		if a.ProductID != b.ProductID {
+			return a.ProductID < b.ProductID
+		}
+		return a.VariantID < b.VariantID
+	})
+
+	return items, nil
+}
+
+func encodeRedisLine(item CartItem, addedAt time.Time) (string, error) {
+	line, err := json.Marshal(redisLine{
+		ProductID:      item.ProductID,
+		VariantID:      item.VariantID,
+		ProductName:    item.ProductName,
+		UnitPriceCents: item.UnitPrice.AmountCents,
+		Currency:       item.UnitPrice.Currency,
+		ImageURL:       item.ImageURL,
+		AddedAt:        addedAt.UTC(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cart line: %w", err)
+	}
+	return string(line), nil
+}
+
+// updateCart applies update to the cart in a MULTI transaction, moves the
+// cart to its next version and returns the updated cart. The cart is only
+// watched when expectedVersion is set; otherwise quantities are changed
+// with HINCRBY, so concurrent changes never need to be retried.
+func (r *RedisCartRepository) updateCart(ctx context.Context, userID string, expectedVersion int64, update func(pipe redis.Pipeliner) error) (*Cart, error) {
+	if expectedVersion != 0 {
+		return r.updateWatchedCart(ctx, userID, expectedVersion, func(_ *redis.Tx, pipe redis.Pipeliner) error {
+			return update(pipe)
+		})
+	}
+
+	var read func() (*Cart, error)
+	if _, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if err := update(pipe); err != nil {
+			return err
+		}
+		r.touchCart(ctx, pipe, userID)
+		read = queueGetRedisCart(ctx, pipe, userID)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to update cart: %w", err)
+	}
+
+	return read()
+}
+
+// updateWatchedCart is updateCart for changes that read the cart first.
+// update may read through tx; its writes are queued on pipe and only
+// applied if the cart did not change since it was read.
+func (r *RedisCartRepository) updateWatchedCart(ctx context.Context, userID string, expectedVersion int64, update func(tx *redis.Tx, pipe redis.Pipeliner) error) (*Cart, error) {
+	var read func() (*Cart, error)
+	err := r.watchCart(ctx, userID, expectedVersion, func(tx *redis.Tx) error {
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if err := update(tx, pipe); err != nil {
+				return err
+			}
+			r.touchCart(ctx, pipe, userID)
+			read = queueGetRedisCart(ctx, pipe, userID)
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return read()
+}
+
+// watchCart runs fn while watching the cart and keys, after checking that
+// the cart is at expectedVersion; 0 skips the check. fn is run again if its
+// transaction fails because a watched key changed.
+func (r *RedisCartRepository) watchCart(ctx context.Context, userID string, expectedVersion int64, fn func(tx *redis.Tx) error, keys ...string) error {
+	keys = append([]string{redisCartKey(userID)}, keys...)
+
+	for attempt := 0; attempt < redisTxRetries; attempt++ {
+		err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+			version, err := tx.HGet(ctx, redisCartKey(userID), "version").Int64()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return fmt.Errorf("failed to get cart version: %w", err)
+			}
+			if expectedVersion != 0 && version != expectedVersion {
+				return ErrVersionConflict
+			}
+			return fn(tx)
+		}, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("failed to update cart after %d attempts: %w", redisTxRetries, redis.TxFailedErr)
+}
+
+// touchCart queues moving the cart to its next version. Guest carts get
+// their expiry pushed back; signed-in carts are re-indexed by update time.
+func (r *RedisCartRepository) touchCart(ctx context.Context, pipe redis.Pipeliner, userID string) {
+	now := time.Now().UTC()
+	pipe.HIncrBy(ctx, redisCartKey(userID), "version", 1)
+	pipe.HSet(ctx, redisCartKey(userID), "updated_at", now.Format(time.RFC3339Nano))
+
+	if strings.HasPrefix(userID, GuestOwnerPrefix) {
+		pipe.Expire(ctx, redisCartKey(userID), r.guestTTL)
+		pipe.Expire(ctx, redisItemsKey(userID), r.guestTTL)
+		pipe.Expire(ctx, redisSavedKey(userID), r.guestTTL)
+		return
+	}
+
+	pipe.ZAdd(ctx, redisUpdatedCarts, redis.Z{Score: float64(now.UnixMilli()), Member: userID})
+}
+
+// AddItem adds item to the cart, or adds its quantity to the existing line
+// for its product and variant, which keeps the price it was first added at.
+func (r *RedisCartRepository) AddItem(ctx context.Context, userID string, item CartItem, expectedVersion int64) (*Cart, error) {
+	line, err := encodeRedisLine(item, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	lineID := redisLineID(item.ProductID, item.VariantID)
+	return r.updateCart(ctx, userID, expectedVersion, func(pipe redis.Pipeliner) error {
+		pipe.HIncrBy(ctx, redisItemsKey(userID), redisQuantityPrefix+lineID, int64(item.Quantity))
+		pipe.HSetNX(ctx, redisItemsKey(userID), redisLinePrefix+lineID, line)
+		return nil
+	})
+}
+
+// UpdateItem sets the quantity of a product variant in the cart; a
+// quantity of 0 or less removes it.
+func (r *RedisCartRepository) UpdateItem(ctx context.Context, userID, productID, variantID string, quantity int32, expectedVersion int64) (*Cart, error) {
+	lineID := redisLineID(productID, variantID)
+	return r.updateWatchedCart(ctx, userID, expectedVersion, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+		exists, err := tx.HExists(ctx, redisItemsKey(userID), redisLinePrefix+lineID).Result()
+		if err != nil {
+			return fmt.Errorf("failed to get cart item: %w", err)
+		}
+		if !exists {
+			return ErrItemNotFound
+		}
+
+		if quantity <= 0 {
+			pipe.HDel(ctx, redisItemsKey(userID), redisQuantityPrefix+lineID, redisLinePrefix+lineID)
+			return nil
+		}
+		pipe.HSet(ctx, redisItemsKey(userID), redisQuantityPrefix+lineID, quantity)
+		return nil
+	})
+}
+
+func (r *RedisCartRepository) RemoveItem(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*Cart, error) {
+	lineID := redisLineID(productID, variantID)
+	return r.updateCart(ctx, userID, expectedVersion, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, redisItemsKey(userID), redisQuantityPrefix+lineID, redisLinePrefix+lineID)
+		return nil
+	})
+}
+
+// MoveToSavedForLater moves a product variant's line from the cart to its
+// saved items. If the variant was already saved, the quantities are added
+// up and the saved line keeps its price.
+func (r *RedisCartRepository) MoveToSavedForLater(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*Cart, error) {
+	return r.updateWatchedCart(ctx, userID, expectedVersion, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+		return moveRedisLine(ctx, tx, pipe, redisItemsKey(userID), redisSavedKey(userID), redisLineID(productID, variantID))
+	})
+}
+
+// MoveToCart moves a saved product variant's line back into the cart. If
+// the variant is already in the cart, the quantities are added up and the
+// cart line keeps its price.
+func (r *RedisCartRepository) MoveToCart(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*Cart, error) {
+	return r.updateWatchedCart(ctx, userID, expectedVersion, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+		return moveRedisLine(ctx, tx, pipe, redisSavedKey(userID), redisItemsKey(userID), redisLineID(productID, variantID))
+	})
+}
+
+func (r *RedisCartRepository) RemoveSavedItem(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*Cart, error) {
+	lineID := redisLineID(productID, variantID)
+	return r.updateCart(ctx, userID, expectedVersion, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, redisSavedKey(userID), redisQuantityPrefix+lineID, redisLinePrefix+lineID)
+		return nil
+	})
+}
+
+// moveRedisLine queues moving the line lineID from the from hash to the to
+// hash, which are a cart's items or saved hash.
+func moveRedisLine(ctx context.Context, tx *redis.Tx, pipe redis.Pipeliner, from, to, lineID string) error {
+	values, err := tx.HMGet(ctx, from, redisQuantityPrefix+lineID, redisLinePrefix+lineID).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get cart line: %w", err)
+	}
+
+	quantity, _ := values[0].(string)
+	line, _ := values[1].(string)
+	if quantity == "" || line == "" {
+		return ErrItemNotFound
+	}
+
+	var stored redisLine
+	if err := json.Unmarshal([]byte(line), &stored); err != nil {
+		return fmt.Errorf("failed to decode line of %s: %w", lineID, err)
+	}
+	stored.AddedAt = time.Now().UTC()
+	moved, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("failed to encode line of %s: %w", lineID, err)
+	}
+
+	n, err := strconv.ParseInt(quantity, 10, 32)
+	if err != nil {
+		return fmt.Errorf("failed to parse quantity of %s: %w", lineID, err)
+	}
+
+	pipe.HDel(ctx, from, redisQuantityPrefix+lineID, redisLinePrefix+lineID)
+	pipe.HIncrBy(ctx, to, redisQuantityPrefix+lineID, n)
+	pipe.HSetNX(ctx, to, redisLinePrefix+lineID, string(moved))
+	return nil
+}
+
+// SetItemPrices stores the unit price of each of items' cart lines, so the
+// cart charges that price from then on.
+func (r *RedisCartRepository) SetItemPrices(ctx context.Context, userID string, items []CartItem, expectedVersion int64) (*Cart, error) {
+	return r.updateWatchedCart(ctx, userID, expectedVersion, func(tx *redis.Tx, pipe redis.Pipeliner) error {
+		for _, item := range items {
+			lineID := redisLineID(item.ProductID, item.VariantID)
+			line, err := tx.HGet(ctx, redisItemsKey(userID), redisLinePrefix+lineID).Result()
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to get cart line: %w", err)
+			}
+
+			var stored redisLine
+			if err := json.Unmarshal([]byte(line), &stored); err != nil {
+				return fmt.Errorf("failed to decode line of %s: %w", lineID, err)
+			}
+			stored.UnitPriceCents = item.UnitPrice.AmountCents
+			stored.Currency = item.UnitPrice.Currency
+			priced, err := json.Marshal(stored)
+			if err != nil {
+				return fmt.Errorf("failed to encode line of %s: %w", lineID, err)
+			}
+
+			pipe.HSet(ctx, redisItemsKey(userID), redisLinePrefix+lineID, string(priced))
+		}
+		return nil
+	})
+}
+
+// SetCouponCode stores the coupon applied to the cart; an empty code
+// removes it.
+func (r *RedisCartRepository) SetCouponCode(ctx context.Context, userID, couponCode string, expectedVersion int64) (*Cart, error) {
+	return r.updateCart(ctx, userID, expectedVersion, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, redisCartKey(userID), "coupon_code", couponCode)
+		return nil
+	})
+}
+
+// DeleteCart empties the cart and removes its coupon. Items saved for later
+// are kept; a cart without any is deleted altogether.
+func (r *RedisCartRepository) DeleteCart(ctx context.Context, userID string, expectedVersion int64) error {
+	return r.watchCart(ctx, userID, expectedVersion, func(tx *redis.Tx) error {
+		saved, err := tx.Exists(ctx, redisSavedKey(userID)).Result()
+		if err != nil {
+			return fmt.Errorf("failed to get saved items: %w", err)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, redisItemsKey(userID))
+			if saved == 0 {
+				pipe.Del(ctx, redisCartKey(userID))
+				pipe.ZRem(ctx, redisUpdatedCarts, userID)
+				return nil
+			}
+
+			pipe.HSet(ctx, redisCartKey(userID), "coupon_code", "", "reminders_sent", 0)
+			pipe.HDel(ctx, redisCartKey(userID), "last_reminded_at")
+			r.touchCart(ctx, pipe, userID)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete cart: %w", err)
+		}
+		return nil
+	})
+}
+
+// MergeCarts moves the guest cart owned by guestID into userID's cart and
+// deletes it, merging the two as the Postgres repository does.
+func (r *RedisCartRepository) MergeCarts(ctx context.Context, guestID, userID string) (*Cart, error) {
+	var read func() (*Cart, error)
+	err := r.watchCart(ctx, userID, 0, func(tx *redis.Tx) error {
+		guest, err := getRedisCart(ctx, tx, guestID)
+		if err != nil {
+			return err
+		}
+
+		cart, err := getRedisCart(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+
+		if len(guest.Items) == 0 && len(guest.SavedItems) == 0 && guest.CouponCode == "" {
+			read = func() (*Cart, error) { return cart, nil }
+			return nil
+		}
+
+		mergeCartItems(cart, guest)
+
+		now := time.Now()
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, item := range cart.Items {
+				line, err := encodeRedisLine(item, now)
+				if err != nil {
+					return err
+				}
+				lineID := redisLineID(item.ProductID, item.VariantID)
+				pipe.HSet(ctx, redisItemsKey(userID), redisQuantityPrefix+lineID, item.Quantity)
+				pipe.HSetNX(ctx, redisItemsKey(userID), redisLinePrefix+lineID, line)
+			}
+
+			for _, item := range cart.SavedItems {
+				line, err := encodeRedisLine(item, now)
+				if err != nil {
+					return err
+				}
+				lineID := redisLineID(item.ProductID, item.VariantID)
+				pipe.HSetNX(ctx, redisSavedKey(userID), redisQuantityPrefix+lineID, item.Quantity)
+				pipe.HSetNX(ctx, redisSavedKey(userID), redisLinePrefix+lineID, line)
+			}
+
+			pipe.HSet(ctx, redisCartKey(userID), "coupon_code", cart.CouponCode)
+			pipe.Del(ctx, redisCartKey(guestID), redisItemsKey(guestID), redisSavedKey(guestID))
+			r.touchCart(ctx, pipe, userID)
+			read = queueGetRedisCart(ctx, pipe, userID)
+			return nil
+		})
+		return err
+	}, redisCartKey(guestID), redisItemsKey(guestID), redisSavedKey(guestID))
+	if err != nil {
+		return nil, err
+	}
+
+	return read()
+}
+
+// DeleteStaleGuestCarts deletes nothing: guest carts in Redis expire on
+// their own.
+func (r *RedisCartRepository) DeleteStaleGuestCarts(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// ListAbandonedCarts returns up to limit signed-in users' carts that still
+// hold items, were not updated since idleSince and were sent fewer than
+// maxReminders reminders, none of them since idleSince. The longest idle
+// carts come first.
+func (r *RedisCartRepository) ListAbandonedCarts(ctx context.Context, idleSince time.Time, maxReminders, limit int) ([]*Cart, error) {
+	carts := []*Cart{}
+
+	for offset := int64(0); len(carts) < limit; offset += int64(limit) {
+		userIDs, err := r.client.ZRangeByScore(ctx, redisUpdatedCarts, &redis.ZRangeBy{
+			Min:    "-inf",
+			Max:    "(" + strconv.FormatInt(idleSince.UnixMilli(), 10),
+			Offset: offset,
+			Count:  int64(limit),
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list abandoned carts: %w", err)
+		}
+		if len(userIDs) == 0 {
+			break
+		}
+
+		for _, userID := range userIDs {
+			remind, err := r.canRemind(ctx, userID, idleSince, maxReminders)
+			if err != nil {
+				return nil, err
+			}
+			if !remind {
+				continue
+			}
+
+			cart, err := r.GetCart(ctx, userID)
+			if err != nil {
+				return nil, err
+			}
+			if len(cart.Items) == 0 {
+				continue
+			}
+
+			carts = append(carts, cart)
+			if len(carts) == limit {
+				break
+			}
+		}
+	}
+
+	return carts, nil
+}
+
+// canRemind reports whether the cart was sent fewer than maxReminders
+// reminders, none of them since idleSince.
+func (r *RedisCartRepository) canRemind(ctx context.Context, userID string, idleSince time.Time, maxReminders int) (bool, error) {
+	values, err := r.client.HMGet(ctx, redisCartKey(userID), "reminders_sent", "last_reminded_at").Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to get cart reminders: %w", err)
+	}
+
+	if sent, _ := values[0].(string); sent != "" {
+		n, err := strconv.Atoi(sent)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse cart reminders: %w", err)
+		}
+		if n >= maxReminders {
+			return false, nil
+		}
+	}
+
+	if remindedAt, _ := values[1].(string); remindedAt != "" {
+		t, err := time.Parse(time.RFC3339Nano, remindedAt)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse cart reminder time: %w", err)
+		}
+		if !t.Before(idleSince) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// RecordCartReminder notes that userID's cart was checked for a reminder at
+// remindedAt, counting it towards the cart's limit when one was sent. It
+// leaves the cart's update time and version alone so the cart stays idle.
+func (r *RedisCartRepository) RecordCartReminder(ctx context.Context, userID string, remindedAt time.Time, sent bool) error {
+	exists, err := r.client.Exists(ctx, redisCartKey(userID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to record cart reminder: %w", err)
+	}
+	if exists == 0 {
+		return nil
+	}
+
+	if _, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, redisCartKey(userID), "last_reminded_at", remindedAt.UTC().Format(time.RFC3339Nano))
+		if sent {
+			pipe.HIncrBy(ctx, redisCartKey(userID), "reminders_sent", 1)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to record cart reminder: %w", err)
+	}
+
+	return nil
+}
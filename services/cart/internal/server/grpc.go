@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"errors"
+	"strings"
 
 	commonv1 "github.com/safar/microservices-demo/proto/common/v1"
 	pb "github.com/safar/microservices-demo/proto/cart/v1"
@@ -40,22 +42,19 @@ func (s *GRPCServer) AddItem(ctx context.Context, req *pb.AddItemRequest) (*pb.C
 		return nil, status.Error(codes.InvalidArgument, "user ID and product ID are required")
 	}
 
-	if req.UnitPrice == nil {
-		return nil, status.Error(codes.InvalidArgument, "unit price is required")
+	cart, err := s.cartService.AddItem(ctx, req.UserId, req.ProductId, req.VariantId, req.Quantity, req.ExpectedVersion)
+	if errors.Is(err, service.ErrProductNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if errors.Is(err, service.ErrVariantRequired) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, service.ErrProductUnavailable) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, err.Error())
 	}
-
-	cart, err := s.cartService.AddItem(
-		ctx,
-		req.UserId,
-		req.ProductId,
-		req.ProductName,
-		req.Quantity,
-		repository.Money{
-			AmountCents: req.UnitPrice.AmountCents,
-			Currency:    req.UnitPrice.Currency,
-		},
-		req.ImageUrl,
-	)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to add item: %v", err)
 	}
@@ -68,7 +67,13 @@ func (s *GRPCServer) UpdateItem(ctx context.Context, req *pb.UpdateItemRequest)
 		return nil, status.Error(codes.InvalidArgument, "user ID and product ID are required")
 	}
 
-	cart, err := s.cartService.UpdateItem(ctx, req.UserId, req.ProductId, req.Quantity)
+	cart, err := s.cartService.UpdateItem(ctx, req.UserId, req.ProductId, req.VariantId, req.Quantity, req.ExpectedVersion)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	if errors.Is(err, repository.ErrItemNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to update item: %v", err)
 	}
@@ -81,7 +86,10 @@ func (s *GRPCServer) RemoveItem(ctx context.Context, req *pb.RemoveItemRequest)
 		return nil, status.Error(codes.InvalidArgument, "user ID and product ID are required")
 	}
 
-	cart, err := s.cartService.RemoveItem(ctx, req.UserId, req.ProductId)
+	cart, err := s.cartService.RemoveItem(ctx, req.UserId, req.ProductId, req.VariantId, req.ExpectedVersion)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to remove item: %v", err)
 	}
@@ -94,35 +102,154 @@ func (s *GRPCServer) ClearCart(ctx context.Context, req *pb.ClearCartRequest) (*
 		return nil, status.Error(codes.InvalidArgument, "user ID is required")
 	}
 
-	if err := s.cartService.ClearCart(ctx, req.UserId); err != nil {
+	err := s.cartService.ClearCart(ctx, req.UserId, req.ExpectedVersion)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to clear cart: %v", err)
 	}
 
 	return &commonv1.Empty{}, nil
 }
 
+func (s *GRPCServer) ApplyCoupon(ctx context.Context, req *pb.ApplyCouponRequest) (*pb.Cart, error) {
+	if req.UserId == "" || req.CouponCode == "" {
+		return nil, status.Error(codes.InvalidArgument, "user ID and coupon code are required")
+	}
+
+	cart, err := s.cartService.ApplyCoupon(ctx, req.UserId, req.CouponCode, req.ExpectedVersion)
+	if errors.Is(err, service.ErrEmptyCart) || errors.Is(err, service.ErrCouponRejected) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to apply coupon: %v", err)
+	}
+
+	return convertCartToProto(cart), nil
+}
+
+func (s *GRPCServer) RemoveCoupon(ctx context.Context, req *pb.RemoveCouponRequest) (*pb.Cart, error) {
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user ID is required")
+	}
+
+	cart, err := s.cartService.RemoveCoupon(ctx, req.UserId, req.ExpectedVersion)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to remove coupon: %v", err)
+	}
+
+	return convertCartToProto(cart), nil
+}
+
+func (s *GRPCServer) MergeCarts(ctx context.Context, req *pb.MergeCartsRequest) (*pb.Cart, error) {
+	if req.UserId == "" || req.CartToken == "" {
+		return nil, status.Error(codes.InvalidArgument, "user ID and cart token are required")
+	}
+
+	if strings.HasPrefix(req.UserId, repository.GuestOwnerPrefix) {
+		return nil, status.Error(codes.InvalidArgument, "cannot merge into a guest cart")
+	}
+
+	cart, err := s.cartService.MergeCarts(ctx, req.UserId, req.CartToken)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to merge carts: %v", err)
+	}
+
+	return convertCartToProto(cart), nil
+}
+
+func (s *GRPCServer) MoveToSavedForLater(ctx context.Context, req *pb.MoveToSavedForLaterRequest) (*pb.Cart, error) {
+	if req.UserId == "" || req.ProductId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user ID and product ID are required")
+	}
+
+	cart, err := s.cartService.MoveToSavedForLater(ctx, req.UserId, req.ProductId, req.VariantId, req.ExpectedVersion)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	if errors.Is(err, repository.ErrItemNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to save item for later: %v", err)
+	}
+
+	return convertCartToProto(cart), nil
+}
+
+func (s *GRPCServer) MoveToCart(ctx context.Context, req *pb.MoveToCartRequest) (*pb.Cart, error) {
+	if req.UserId == "" || req.ProductId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user ID and product ID are required")
+	}
+
+	cart, err := s.cartService.MoveToCart(ctx, req.UserId, req.ProductId, req.VariantId, req.ExpectedVersion)
+	if errors.Is(err, service.ErrProductUnavailable) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	if errors.Is(err, repository.ErrItemNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to move item to cart: %v", err)
+	}
+
+	return convertCartToProto(cart), nil
+}
+
+func (s *GRPCServer) RemoveSavedItem(ctx context.Context, req *pb.RemoveSavedItemRequest) (*pb.Cart, error) {
+	if req.UserId == "" || req.ProductId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user ID and product ID are required")
+	}
+
+	cart, err := s.cartService.RemoveSavedItem(ctx, req.UserId, req.ProductId, req.VariantId, req.ExpectedVersion)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to remove saved item: %v", err)
+	}
+
+	return convertCartToProto(cart), nil
+}
+
+func (s *GRPCServer) AcceptPriceChanges(ctx context.Context, req *pb.AcceptPriceChangesRequest) (*pb.Cart, error) {
+	if req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user ID is required")
+	}
+
+	cart, err := s.cartService.AcceptPriceChanges(ctx, req.UserId, req.ExpectedVersion)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to accept price changes: %v", err)
+	}
+
+	return convertCartToProto(cart), nil
+}
+
 func convertCartToProto(cart *repository.Cart) *pb.Cart {
 	var items []*pb.CartItem
-	var totalCents int64
+	var subtotalCents int64
 	var currency string
 
 	for _, item := range cart.Items {
-		items = append(items, &pb.CartItem{
-			ProductId:   item.ProductID,
-			ProductName: item.ProductName,
-			Quantity:    item.Quantity,
-			UnitPrice: &commonv1.Money{
-				AmountCents: item.UnitPrice.AmountCents,
-				Currency:    item.UnitPrice.Currency,
-			},
-			TotalPrice: &commonv1.Money{
-				AmountCents: item.TotalPrice.AmountCents,
-				Currency:    item.TotalPrice.Currency,
-			},
-			ImageUrl: item.ImageURL,
-		})
-
-		totalCents += item.TotalPrice.AmountCents
+		items = append(items, convertItemToProto(item))
+
+		subtotalCents += item.TotalPrice.AmountCents
 		if currency == "" {
 			currency = item.UnitPrice.Currency
 		}
@@ -132,13 +259,58 @@ func convertCartToProto(cart *repository.Cart) *pb.Cart {
 		currency = "USD"
 	}
 
+	// Saved items are returned for display only and left out of the totals
+	var savedItems []*pb.CartItem
+	for _, item := range cart.SavedItems {
+		savedItems = append(savedItems, convertItemToProto(item))
+	}
+
 	return &pb.Cart{
 		UserId: cart.UserID,
 		Items:  items,
 		Total: &commonv1.Money{
-			AmountCents: totalCents,
+			AmountCents: subtotalCents - cart.Discount.AmountCents,
+			Currency:    currency,
+		},
+		UpdatedAt:  cart.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		CouponCode: cart.CouponCode,
+		Version:    cart.Version,
+		Subtotal: &commonv1.Money{
+			AmountCents: subtotalCents,
+			Currency:    currency,
+		},
+		Discount: &commonv1.Money{
+			AmountCents: cart.Discount.AmountCents,
 			Currency:    currency,
 		},
-		UpdatedAt: cart.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		FreeShipping: cart.FreeShipping,
+		CouponError:  cart.CouponError,
+		SavedItems:   savedItems,
+	}
+}
+
+func convertItemToProto(item repository.CartItem) *pb.CartItem {
+	return &pb.CartItem{
+		ProductId:   item.ProductID,
+		ProductName: item.ProductName,
+		Quantity:    item.Quantity,
+		UnitPrice: &commonv1.Money{
+			AmountCents: item.UnitPrice.AmountCents,
+			Currency:    item.UnitPrice.Currency,
+		},
+		TotalPrice: &commonv1.Money{
+			AmountCents: item.TotalPrice.AmountCents,
+			Currency:    item.TotalPrice.Currency,
+		},
+		ImageUrl: item.ImageURL,
+		AddedUnitPrice: &commonv1.Money{
+			AmountCents: item.AddedUnitPrice.AmountCents,
+			Currency:    item.AddedUnitPrice.Currency,
+		},
+		PriceChanged:   item.PriceChanged,
+		Unavailable:    item.Unavailable,
+		VariantId:      item.VariantID,
+		Sku:            item.SKU,
+		VariantOptions: item.VariantOptions,
 	}
 }
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	commonpb "github.com/safar/microservices-demo/proto/common/v1"
+	notificationpb "github.com/safar/microservices-demo/proto/notification/v1"
+	orderpb "github.com/safar/microservices-demo/proto/order/v1"
+	userpb "github.com/safar/microservices-demo/proto/user/v1"
+	"github.com/safar/microservices-demo/services/cart/internal/repository"
+)
+
+// reminderBatchSize is how many abandoned carts one reminder run handles.
+const reminderBatchSize = 100
+
+// SendCartReminders emails the owners of carts idle for longer than
+// idleAfter a reminder of what they left behind, sending at most
+// maxReminders per cart and waiting idleAfter between them. Carts whose
+// owner placed an order since the cart last changed are skipped. It returns
+// how many reminders were sent.
+func (s *CartService) SendCartReminders(ctx context.Context, idleAfter time.Duration, maxReminders int) (int, error) {
+	now := time.Now()
+	carts, err := s.repo.ListAbandonedCarts(ctx, now.Add(-idleAfter), maxReminders, reminderBatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list abandoned carts: %w", err)
+	}
+
+	sent := 0
+	for _, cart := range carts {
+		reminded, err := s.remindCart(ctx, cart)
+		if err != nil {
+			log.Printf("Failed to send cart reminder to %s: %v", cart.UserID, err)
+			continue
+		}
+
+		if err := s.repo.RecordCartReminder(ctx, cart.UserID, now, reminded); err != nil {
+			log.Printf("Failed to record cart reminder for %s: %v", cart.UserID, err)
+			continue
+		}
+		if reminded {
+			sent++
+		}
+	}
+
+	return sent, nil
+}
+
+// RunCartReminders sends abandoned cart reminders every interval until ctx
+// is cancelled.
+func (s *CartService) RunCartReminders(ctx context.Context, interval, idleAfter time.Duration, maxReminders int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sent, err := s.SendCartReminders(ctx, idleAfter, maxReminders)
+		if err != nil {
+			log.Printf("Cart reminders failed: %v", err)
+		} else if sent > 0 {
+			log.Printf("Sent %d cart reminders", sent)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// remindCart emails the cart's owner the items still for sale in it at
+// their current prices. It reports false without sending anything when the
+// cart was converted to an order or holds nothing that can be bought.
+func (s *CartService) remindCart(ctx context.Context, cart *repository.Cart) (bool, error) {
+	converted, err := s.convertedToOrder(ctx, cart)
+	if err != nil {
+		return false, err
+	}
+	if converted {
+		return false, nil
+	}
+
+	s.refreshPrices(ctx, cart)
+
+	var items []*notificationpb.OrderItem
+	total := &commonpb.Money{}
+	for _, item := range cart.Items {
+		if item.Unavailable {
+			continue
+		}
+		items = append(items, &notificationpb.OrderItem{
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			UnitPrice:   &commonpb.Money{AmountCents: item.UnitPrice.AmountCents, Currency: item.UnitPrice.Currency},
+			TotalPrice:  &commonpb.Money{AmountCents: item.TotalPrice.AmountCents, Currency: item.TotalPrice.Currency},
+		})
+		total.AmountCents += item.TotalPrice.AmountCents
+		total.Currency = item.TotalPrice.Currency
+	}
+	if len(items) == 0 {
+		return false, nil
+	}
+
+	user, err := s.clients.User.GetUser(ctx, &userpb.GetUserRequest{Id: cart.UserID})
+	if err != nil {
+		return false, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if _, err := s.clients.Notification.SendCartReminder(ctx, &notificationpb.SendCartReminderRequest{
+		Email:     user.Email,
+		FirstName: user.GetProfile().GetFirstName(),
+		Items:     items,
+		Total:     total,
+	}); err != nil {
+		return false, fmt.Errorf("failed to send cart reminder: %w", err)
+	}
+
+	return true, nil
+}
+
+// convertedToOrder reports whether the cart's owner placed an order since
+// the cart last changed, which means the cart was checked out and only its
+// clearing failed.
+func (s *CartService) convertedToOrder(ctx context.Context, cart *repository.Cart) (bool, error) {
+	resp, err := s.clients.Order.ListOrders(ctx, &orderpb.ListOrdersRequest{
+		UserId:     cart.UserID,
+		Pagination: &commonpb.Pagination{Page: 1, PageSize: 1},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to list orders: %w", err)
+	}
+	if len(resp.Orders) == 0 {
+		return false, nil
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, resp.Orders[0].CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse order time: %w", err)
+	}
+
+	return !createdAt.Before(cart.UpdatedAt.Truncate(time.Second)), nil
+}
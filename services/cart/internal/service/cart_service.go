@@ -2,26 +2,65 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
+	cartpb "github.com/safar/microservices-demo/proto/cart/v1"
+	catalogpb "github.com/safar/microservices-demo/proto/catalog/v1"
+	commonpb "github.com/safar/microservices-demo/proto/common/v1"
+	orderpb "github.com/safar/microservices-demo/proto/order/v1"
+	"github.com/safar/microservices-demo/services/cart/internal/client"
 	"github.com/safar/microservices-demo/services/cart/internal/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrEmptyCart is returned when applying a coupon to an empty cart.
+	ErrEmptyCart = errors.New("cart is empty")
+	// ErrCouponRejected is returned when the order service does not accept
+	// a coupon for the cart.
+	ErrCouponRejected = errors.New("coupon rejected")
+	// ErrProductNotFound is returned when adding a product the catalog does
+	// not know.
+	ErrProductNotFound = errors.New("product not found")
+	// ErrProductUnavailable is returned when adding a product or variant
+	// that is no longer sold.
+	ErrProductUnavailable = errors.New("product is not available")
+	// ErrVariantRequired is returned when adding a product that has
+	// variants without choosing one.
+	ErrVariantRequired = errors.New("a variant of the product must be chosen")
 )
 
 type CartStore interface {
 	GetCart(ctx context.Context, userID string) (*repository.Cart, error)
-	AddItem(ctx context.Context, userID string, item repository.CartItem) (*repository.Cart, error)
-	UpdateItem(ctx context.Context, userID, productID string, quantity int32) (*repository.Cart, error)
-	RemoveItem(ctx context.Context, userID, productID string) (*repository.Cart, error)
-	DeleteCart(ctx context.Context, userID string) error
+	AddItem(ctx context.Context, userID string, item repository.CartItem, expectedVersion int64) (*repository.Cart, error)
+	UpdateItem(ctx context.Context, userID, productID, variantID string, quantity int32, expectedVersion int64) (*repository.Cart, error)
+	RemoveItem(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*repository.Cart, error)
+	MoveToSavedForLater(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*repository.Cart, error)
+	MoveToCart(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*repository.Cart, error)
+	RemoveSavedItem(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*repository.Cart, error)
+	DeleteCart(ctx context.Context, userID string, expectedVersion int64) error
+	SetCouponCode(ctx context.Context, userID, couponCode string, expectedVersion int64) (*repository.Cart, error)
+	SetItemPrices(ctx context.Context, userID string, items []repository.CartItem, expectedVersion int64) (*repository.Cart, error)
+	MergeCarts(ctx context.Context, guestID, userID string) (*repository.Cart, error)
+	DeleteStaleGuestCarts(ctx context.Context, before time.Time) (int64, error)
+	ListAbandonedCarts(ctx context.Context, idleSince time.Time, maxReminders, limit int) ([]*repository.Cart, error)
+	RecordCartReminder(ctx context.Context, userID string, remindedAt time.Time, sent bool) error
 }
 
 type CartService struct {
-	repo CartStore
+	repo    CartStore
+	clients *client.ServiceClients
 }
 
-func NewCartService(repo CartStore) *CartService {
+func NewCartService(repo CartStore, clients *client.ServiceClients) *CartService {
 	return &CartService{
-		repo: repo,
+		repo:    repo,
+		clients: clients,
 	}
 }
 
@@ -31,48 +70,451 @@ func (s *CartService) GetCart(ctx context.Context, userID string) (*repository.C
 		return nil, fmt.Errorf("failed to get cart: %w", err)
 	}
 
+	s.priceCart(ctx, cart)
 	return cart, nil
 }
 
-func (s *CartService) AddItem(ctx context.Context, userID, productID, productName string, quantity int32, unitPrice repository.Money, imageURL string) (*repository.Cart, error) {
+// AddItem adds quantity of a product to the cart. The product's name, price
+// and image are taken from the catalog rather than from the caller. Products
+// with variants are added by variant, at the variant's price.
+//
+// AddItem and the other mutations fail with repository.ErrVersionConflict
+// if expectedVersion is set and the cart is at a different version.
+func (s *CartService) AddItem(ctx context.Context, userID, productID, variantID string, quantity int32, expectedVersion int64) (*repository.Cart, error) {
+	product, err := s.clients.Catalog.GetProduct(ctx, &catalogpb.GetProductRequest{
+		Identifier: &catalogpb.GetProductRequest_Id{Id: productID},
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	if !product.IsActive {
+		return nil, ErrProductUnavailable
+	}
+
+	variant, err := productVariant(product, variantID)
+	if err != nil {
+		return nil, err
+	}
+
 	item := repository.CartItem{
-		ProductID:   productID,
-		ProductName: productName,
+		ProductID:   product.Id,
+		VariantID:   variantID,
+		ProductName: product.Name,
 		Quantity:    quantity,
-		UnitPrice:   unitPrice,
-		ImageURL:    imageURL,
+		UnitPrice:   catalogPrice(product, variant),
+		ImageURL:    catalogImage(product, variant),
 	}
 
-	cart, err := s.repo.AddItem(ctx, userID, item)
+	cart, err := s.repo.AddItem(ctx, userID, item, expectedVersion)
 	if err != nil {
 		return nil, fmt.Errorf("failed to add item: %w", err)
 	}
 
+	s.priceCart(ctx, cart)
 	return cart, nil
 }
 
-func (s *CartService) UpdateItem(ctx context.Context, userID, productID string, quantity int32) (*repository.Cart, error) {
-	cart, err := s.repo.UpdateItem(ctx, userID, productID, quantity)
+func (s *CartService) UpdateItem(ctx context.Context, userID, productID, variantID string, quantity int32, expectedVersion int64) (*repository.Cart, error) {
+	cart, err := s.repo.UpdateItem(ctx, userID, productID, variantID, quantity, expectedVersion)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update item: %w", err)
 	}
 
+	s.priceCart(ctx, cart)
 	return cart, nil
 }
 
-func (s *CartService) RemoveItem(ctx context.Context, userID, productID string) (*repository.Cart, error) {
-	cart, err := s.repo.RemoveItem(ctx, userID, productID)
+func (s *CartService) RemoveItem(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*repository.Cart, error) {
+	cart, err := s.repo.RemoveItem(ctx, userID, productID, variantID, expectedVersion)
 	if err != nil {
 		return nil, fmt.Errorf("failed to remove item: %w", err)
 	}
 
+	s.priceCart(ctx, cart)
+	return cart, nil
+}
+
+// MoveToSavedForLater sets a product variant's line aside, taking it out of
+// the cart's total and checkout.
+func (s *CartService) MoveToSavedForLater(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*repository.Cart, error) {
+	cart, err := s.repo.MoveToSavedForLater(ctx, userID, productID, variantID, expectedVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save item for later: %w", err)
+	}
+
+	s.priceCart(ctx, cart)
+	return cart, nil
+}
+
+// MoveToCart puts a saved product variant's line back in the cart, provided
+// the catalog still sells the variant.
+func (s *CartService) MoveToCart(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*repository.Cart, error) {
+	product, err := s.clients.Catalog.GetProduct(ctx, &catalogpb.GetProductRequest{
+		Identifier: &catalogpb.GetProductRequest_Id{Id: productID},
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrProductUnavailable
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	if !product.IsActive {
+		return nil, ErrProductUnavailable
+	}
+
+	if _, err := productVariant(product, variantID); err != nil {
+		return nil, ErrProductUnavailable
+	}
+
+	cart, err := s.repo.MoveToCart(ctx, userID, productID, variantID, expectedVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to move item to cart: %w", err)
+	}
+
+	s.priceCart(ctx, cart)
 	return cart, nil
 }
 
-func (s *CartService) ClearCart(ctx context.Context, userID string) error {
-	if err := s.repo.DeleteCart(ctx, userID); err != nil {
+func (s *CartService) RemoveSavedItem(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*repository.Cart, error) {
+	cart, err := s.repo.RemoveSavedItem(ctx, userID, productID, variantID, expectedVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove saved item: %w", err)
+	}
+
+	s.priceCart(ctx, cart)
+	return cart, nil
+}
+
+func (s *CartService) ClearCart(ctx context.Context, userID string, expectedVersion int64) error {
+	if err := s.repo.DeleteCart(ctx, userID, expectedVersion); err != nil {
 		return fmt.Errorf("failed to clear cart: %w", err)
 	}
 
 	return nil
 }
+
+// ApplyCoupon prices couponCode against the cart with the order service and
+// keeps it on the cart if it is accepted.
+func (s *CartService) ApplyCoupon(ctx context.Context, userID, couponCode string, expectedVersion int64) (*repository.Cart, error) {
+	cart, err := s.repo.GetCart(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart: %w", err)
+	}
+
+	if expectedVersion != 0 && cart.Version != expectedVersion {
+		return nil, repository.ErrVersionConflict
+	}
+
+	if len(cart.Items) == 0 {
+		return nil, ErrEmptyCart
+	}
+
+	s.refreshPrices(ctx, cart)
+	evaluation, err := s.evaluateCoupon(ctx, cart, couponCode)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.repo.SetCouponCode(ctx, userID, evaluation.CouponCode, expectedVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply coupon: %w", err)
+	}
+
+	cart.CouponCode = updated.CouponCode
+	cart.Version = updated.Version
+	cart.UpdatedAt = updated.UpdatedAt
+	applyCouponEvaluation(cart, evaluation)
+	return cart, nil
+}
+
+func (s *CartService) RemoveCoupon(ctx context.Context, userID string, expectedVersion int64) (*repository.Cart, error) {
+	cart, err := s.repo.SetCouponCode(ctx, userID, "", expectedVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove coupon: %w", err)
+	}
+
+	s.refreshPrices(ctx, cart)
+	return cart, nil
+}
+
+// AcceptPriceChanges stores the current catalog price of every cart item
+// flagged as price changed, which the order service requires before it
+// checks the cart out at the new price.
+func (s *CartService) AcceptPriceChanges(ctx context.Context, userID string, expectedVersion int64) (*repository.Cart, error) {
+	cart, err := s.repo.GetCart(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart: %w", err)
+	}
+
+	if expectedVersion != 0 && cart.Version != expectedVersion {
+		return nil, repository.ErrVersionConflict
+	}
+
+	products, err := s.catalogProducts(ctx, cart.Items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get catalog prices: %w", err)
+	}
+	refreshItemPrices(cart.Items, products)
+	var changed []repository.CartItem
+	for _, item := range cart.Items {
+		if item.PriceChanged && !item.Unavailable {
+			changed = append(changed, item)
+		}
+	}
+	if len(changed) == 0 {
+		s.priceCart(ctx, cart)
+		return cart, nil
+	}
+
+	updated, err := s.repo.SetItemPrices(ctx, userID, changed, expectedVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept price changes: %w", err)
+	}
+
+	s.priceCart(ctx, updated)
+	return updated, nil
+}
+
+// MergeCarts moves the guest cart issued cartToken into userID's cart, for
+// when an anonymous shopper signs in.
+func (s *CartService) MergeCarts(ctx context.Context, userID, cartToken string) (*repository.Cart, error) {
+	cart, err := s.repo.MergeCarts(ctx, repository.GuestOwnerPrefix+cartToken, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge carts: %w", err)
+	}
+
+	s.priceCart(ctx, cart)
+	return cart, nil
+}
+
+// RunGuestCartCleanup deletes guest carts idle for longer than maxAge every
+// interval until ctx is cancelled.
+func (s *CartService) RunGuestCartCleanup(ctx context.Context, interval, maxAge time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := s.repo.DeleteStaleGuestCarts(ctx, time.Now().Add(-maxAge))
+		if err != nil {
+			log.Printf("Guest cart cleanup failed: %v", err)
+		} else if deleted > 0 {
+			log.Printf("Deleted %d stale guest carts", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// priceCart prices the cart's items at the current catalog prices and then
+// prices its coupon against them.
+func (s *CartService) priceCart(ctx context.Context, cart *repository.Cart) {
+	s.refreshPrices(ctx, cart)
+	s.priceCoupon(ctx, cart)
+}
+
+// catalogLookupBatch is how many products one catalog lookup asks for, the
+// most GetProducts accepts.
+const catalogLookupBatch = 100
+
+// refreshPrices replaces the stored price, name and image of each item,
+// including the saved ones, with the catalog's, flagging items whose price
+// changed since they were added and items whose product or variant is no
+// longer sold. All the products are looked up together. If the catalog
+// cannot be reached, items keep their stored price; checkout validates
+// prices against the catalog again.
+func (s *CartService) refreshPrices(ctx context.Context, cart *repository.Cart) {
+	products, err := s.catalogProducts(ctx, cart.Items, cart.SavedItems)
+	if err != nil {
+		log.Printf("Failed to refresh prices for cart %s: %v", cart.UserID, err)
+	}
+	refreshItemPrices(cart.Items, products)
+	refreshItemPrices(cart.SavedItems, products)
+}
+
+// catalogProducts looks up the products of every item in itemLists, keyed
+// by product ID, asking the catalog for each product once.
+func (s *CartService) catalogProducts(ctx context.Context, itemLists ...[]repository.CartItem) (map[string]*catalogpb.Product, error) {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, items := range itemLists {
+		for _, item := range items {
+			if !seen[item.ProductID] {
+				seen[item.ProductID] = true
+				ids = append(ids, item.ProductID)
+			}
+		}
+	}
+
+	products := make(map[string]*catalogpb.Product, len(ids))
+	for start := 0; start < len(ids); start += catalogLookupBatch {
+		end := min(start+catalogLookupBatch, len(ids))
+		resp, err := s.clients.Catalog.GetProducts(ctx, &catalogpb.GetProductsRequest{Ids: ids[start:end]})
+		if err != nil {
+			return nil, err
+		}
+		for _, product := range resp.Products {
+			products[product.Id] = product
+		}
+	}
+	return products, nil
+}
+
+// refreshItemPrices prices items from products, as looked up by
+// catalogProducts. Items keep their stored price when products is nil
+// because the lookup failed; items whose product is missing from it are
+// flagged unavailable.
+func refreshItemPrices(items []repository.CartItem, products map[string]*catalogpb.Product) {
+	for i := range items {
+		item := &items[i]
+		item.AddedUnitPrice = item.UnitPrice
+		if products == nil {
+			continue
+		}
+
+		product, ok := products[item.ProductID]
+		if !ok {
+			item.Unavailable = true
+			continue
+		}
+
+		variant, err := productVariant(product, item.VariantID)
+		if err != nil {
+			item.Unavailable = true
+			continue
+		}
+		if variant != nil {
+			item.SKU = variant.Sku
+			item.VariantOptions = variant.Options
+		}
+
+		item.ProductName = product.Name
+		if image := catalogImage(product, variant); image != "" {
+			item.ImageURL = image
+		}
+		item.UnitPrice = catalogPrice(product, variant)
+		item.TotalPrice = repository.Money{
+			AmountCents: item.UnitPrice.AmountCents * int64(item.Quantity),
+			Currency:    item.UnitPrice.Currency,
+		}
+		item.PriceChanged = item.UnitPrice != item.AddedUnitPrice
+		item.Unavailable = !product.IsActive
+	}
+}
+
+// priceCoupon fills in the discount of the cart's coupon. A coupon that no
+// longer applies stays on the cart with CouponError explaining why, so the
+// customer can see it and remove it.
+func (s *CartService) priceCoupon(ctx context.Context, cart *repository.Cart) {
+	if cart.CouponCode == "" || len(cart.Items) == 0 {
+		return
+	}
+
+	evaluation, err := s.evaluateCoupon(ctx, cart, cart.CouponCode)
+	if errors.Is(err, ErrCouponRejected) {
+		cart.CouponError = err.Error()
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to price coupon %s for cart %s: %v", cart.CouponCode, cart.UserID, err)
+		cart.CouponError = "coupon could not be priced"
+		return
+	}
+
+	applyCouponEvaluation(cart, evaluation)
+}
+
+// evaluateCoupon prices couponCode against the cart with the order service.
+// Guest carts are evaluated without a user, since their owner is not a user
+// ID; the per-user limit is enforced when the guest checks out signed in.
+func (s *CartService) evaluateCoupon(ctx context.Context, cart *repository.Cart, couponCode string) (*orderpb.EvaluateCouponResponse, error) {
+	req := &orderpb.EvaluateCouponRequest{
+		UserId:     cart.UserID,
+		CouponCode: couponCode,
+	}
+	if strings.HasPrefix(cart.UserID, repository.GuestOwnerPrefix) {
+		req.UserId = ""
+	}
+	for _, item := range cart.Items {
+		req.Items = append(req.Items, &cartpb.CartItem{
+			ProductId: item.ProductID,
+			VariantId: item.VariantID,
+			Quantity:  item.Quantity,
+			UnitPrice: &commonpb.Money{
+				AmountCents: item.UnitPrice.AmountCents,
+				Currency:    item.UnitPrice.Currency,
+			},
+		})
+	}
+
+	evaluation, err := s.clients.Order.EvaluateCoupon(ctx, req)
+	if code := status.Code(err); code == codes.NotFound || code == codes.FailedPrecondition {
+		return nil, fmt.Errorf("%w: %s", ErrCouponRejected, status.Convert(err).Message())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate coupon: %w", err)
+	}
+
+	return evaluation, nil
+}
+
+// productVariant returns the variant of product a cart line is for, or nil
+// for a product without variants. It fails if the product has variants and
+// variantID names none of those still sold.
+func productVariant(product *catalogpb.Product, variantID string) (*catalogpb.ProductVariant, error) {
+	if variantID == "" {
+		if len(product.Variants) > 0 {
+			return nil, ErrVariantRequired
+		}
+		return nil, nil
+	}
+
+	for _, variant := range product.Variants {
+		if variant.Id == variantID {
+			return variant, nil
+		}
+	}
+	return nil, ErrProductUnavailable
+}
+
+// catalogPrice returns what the catalog sells product at, or variant of it
+// if it is set.
+func catalogPrice(product *catalogpb.Product, variant *catalogpb.ProductVariant) repository.Money {
+	price := product.Price
+	if variant != nil {
+		price = variant.Price
+	}
+	return repository.Money{
+		AmountCents: price.GetAmountCents(),
+		Currency:    price.GetCurrency(),
+	}
+}
+
+// catalogImage returns the first image of variant, falling back to the
+// product's images.
+func catalogImage(product *catalogpb.Product, variant *catalogpb.ProductVariant) string {
+	if len(variant.GetImageUrls()) > 0 {
+		return variant.ImageUrls[0]
+	}
+	if len(product.ImageUrls) > 0 {
+		return product.ImageUrls[0]
+	}
+	return ""
+}
+
+func applyCouponEvaluation(cart *repository.Cart, evaluation *orderpb.EvaluateCouponResponse) {
+	cart.Discount = repository.Money{
+		AmountCents: evaluation.Discount.GetAmountCents(),
+		Currency:    evaluation.Discount.GetCurrency(),
+	}
+	cart.FreeShipping = evaluation.FreeShipping
+	cart.CouponError = ""
+}
@@ -4,42 +4,219 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
+	catalogpb "github.com/safar/microservices-demo/proto/catalog/v1"
+	commonpb "github.com/safar/microservices-demo/proto/common/v1"
+	notificationpb "github.com/safar/microservices-demo/proto/notification/v1"
+	orderpb "github.com/safar/microservices-demo/proto/order/v1"
+	userpb "github.com/safar/microservices-demo/proto/user/v1"
+	"github.com/safar/microservices-demo/services/cart/internal/client"
 	"github.com/safar/microservices-demo/services/cart/internal/repository"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type mockCartStore struct {
+	cart         *repository.Cart
+	mergedGuest  string
+	staleBefore  time.Time
+	abandoned    []*repository.Cart
+	reminded     map[string]bool
 	addItemFn    func(ctx context.Context, userID string, item repository.CartItem) (*repository.Cart, error)
 	deleteCartFn func(ctx context.Context, userID string) error
 }
 
 func (m *mockCartStore) GetCart(ctx context.Context, userID string) (*repository.Cart, error) {
+	if m.cart != nil {
+		cart := *m.cart
+		cart.Items = append([]repository.CartItem(nil), m.cart.Items...)
+		cart.SavedItems = append([]repository.CartItem(nil), m.cart.SavedItems...)
+		return &cart, nil
+	}
 	return &repository.Cart{UserID: userID}, nil
 }
 
-func (m *mockCartStore) AddItem(ctx context.Context, userID string, item repository.CartItem) (*repository.Cart, error) {
+func (m *mockCartStore) AddItem(ctx context.Context, userID string, item repository.CartItem, expectedVersion int64) (*repository.Cart, error) {
 	if m.addItemFn != nil {
 		return m.addItemFn(ctx, userID, item)
 	}
 	return &repository.Cart{UserID: userID, Items: []repository.CartItem{item}}, nil
 }
 
-func (m *mockCartStore) UpdateItem(ctx context.Context, userID, productID string, quantity int32) (*repository.Cart, error) {
+func (m *mockCartStore) UpdateItem(ctx context.Context, userID, productID, variantID string, quantity int32, expectedVersion int64) (*repository.Cart, error) {
+	return &repository.Cart{UserID: userID}, nil
+}
+
+func (m *mockCartStore) RemoveItem(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*repository.Cart, error) {
 	return &repository.Cart{UserID: userID}, nil
 }
 
-func (m *mockCartStore) RemoveItem(ctx context.Context, userID, productID string) (*repository.Cart, error) {
+func (m *mockCartStore) MoveToSavedForLater(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*repository.Cart, error) {
+	return m.moveItem(userID, productID, variantID, &m.cart.Items, &m.cart.SavedItems)
+}
+
+func (m *mockCartStore) MoveToCart(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*repository.Cart, error) {
+	return m.moveItem(userID, productID, variantID, &m.cart.SavedItems, &m.cart.Items)
+}
+
+func (m *mockCartStore) moveItem(userID, productID, variantID string, from, to *[]repository.CartItem) (*repository.Cart, error) {
+	for i, item := range *from {
+		if item.ProductID == productID && item.VariantID == variantID {
+			*from = append((*from)[:i], (*from)[i+1:]...)
+			*to = append(*to, item)
+			return m.GetCart(context.Background(), userID)
+		}
+	}
+	return nil, repository.ErrItemNotFound
+}
+
+func (m *mockCartStore) RemoveSavedItem(ctx context.Context, userID, productID, variantID string, expectedVersion int64) (*repository.Cart, error) {
 	return &repository.Cart{UserID: userID}, nil
 }
 
-func (m *mockCartStore) DeleteCart(ctx context.Context, userID string) error {
+func (m *mockCartStore) DeleteCart(ctx context.Context, userID string, expectedVersion int64) error {
 	if m.deleteCartFn != nil {
 		return m.deleteCartFn(ctx, userID)
 	}
 	return nil
 }
 
-func TestAddItemBuildsRepositoryItem(t *testing.T) {
+func (m *mockCartStore) SetCouponCode(ctx context.Context, userID, couponCode string, expectedVersion int64) (*repository.Cart, error) {
+	if m.cart == nil {
+		m.cart = &repository.Cart{UserID: userID}
+	}
+	m.cart.CouponCode = couponCode
+	cart := *m.cart
+	return &cart, nil
+}
+
+func (m *mockCartStore) SetItemPrices(ctx context.Context, userID string, items []repository.CartItem, expectedVersion int64) (*repository.Cart, error) {
+	for _, item := range items {
+		for i := range m.cart.Items {
+			if m.cart.Items[i].ProductID == item.ProductID && m.cart.Items[i].VariantID == item.VariantID {
+				m.cart.Items[i].UnitPrice = item.UnitPrice
+			}
+		}
+	}
+	return m.GetCart(ctx, userID)
+}
+
+func (m *mockCartStore) MergeCarts(ctx context.Context, guestID, userID string) (*repository.Cart, error) {
+	m.mergedGuest = guestID
+	return m.GetCart(ctx, userID)
+}
+
+func (m *mockCartStore) DeleteStaleGuestCarts(ctx context.Context, before time.Time) (int64, error) {
+	m.staleBefore = before
+	return 0, nil
+}
+
+func (m *mockCartStore) ListAbandonedCarts(ctx context.Context, idleSince time.Time, maxReminders, limit int) ([]*repository.Cart, error) {
+	return m.abandoned, nil
+}
+
+func (m *mockCartStore) RecordCartReminder(ctx context.Context, userID string, remindedAt time.Time, sent bool) error {
+	if m.reminded == nil {
+		m.reminded = map[string]bool{}
+	}
+	m.reminded[userID] = sent
+	return nil
+}
+
+type mockOrderClient struct {
+	orderpb.OrderServiceClient
+	evaluateFn func(in *orderpb.EvaluateCouponRequest) (*orderpb.EvaluateCouponResponse, error)
+	orders     []*orderpb.Order
+}
+
+func (m *mockOrderClient) EvaluateCoupon(ctx context.Context, in *orderpb.EvaluateCouponRequest, opts ...grpc.CallOption) (*orderpb.EvaluateCouponResponse, error) {
+	return m.evaluateFn(in)
+}
+
+func (m *mockOrderClient) ListOrders(ctx context.Context, in *orderpb.ListOrdersRequest, opts ...grpc.CallOption) (*orderpb.ListOrdersResponse, error) {
+	return &orderpb.ListOrdersResponse{Orders: m.orders}, nil
+}
+
+type mockUserClient struct {
+	userpb.UserServiceClient
+}
+
+func (m *mockUserClient) GetUser(ctx context.Context, in *userpb.GetUserRequest, opts ...grpc.CallOption) (*userpb.User, error) {
+	return &userpb.User{
+		Id:      in.Id,
+		Email:   in.Id + "@example.test",
+		Profile: &userpb.Profile{FirstName: "Ada"},
+	}, nil
+}
+
+type mockNotificationClient struct {
+	notificationpb.NotificationServiceClient
+	reminders []*notificationpb.SendCartReminderRequest
+}
+
+func (m *mockNotificationClient) SendCartReminder(ctx context.Context, in *notificationpb.SendCartReminderRequest, opts ...grpc.CallOption) (*commonpb.Empty, error) {
+	m.reminders = append(m.reminders, in)
+	return &commonpb.Empty{}, nil
+}
+
+type mockCatalogClient struct {
+	catalogpb.CatalogServiceClient
+	products map[string]*catalogpb.Product
+	lookups  [][]string
+}
+
+func (m *mockCatalogClient) GetProduct(ctx context.Context, in *catalogpb.GetProductRequest, opts ...grpc.CallOption) (*catalogpb.Product, error) {
+	product, ok := m.products[in.GetId()]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "product not found")
+	}
+	return product, nil
+}
+
+func (m *mockCatalogClient) GetProducts(ctx context.Context, in *catalogpb.GetProductsRequest, opts ...grpc.CallOption) (*catalogpb.GetProductsResponse, error) {
+	m.lookups = append(m.lookups, in.Ids)
+	resp := &catalogpb.GetProductsResponse{}
+	for _, id := range in.Ids {
+		if product, ok := m.products[id]; ok {
+			resp.Products = append(resp.Products, product)
+		}
+	}
+	return resp, nil
+}
+
+func newTestCatalog() *mockCatalogClient {
+	return &mockCatalogClient{products: map[string]*catalogpb.Product{
+		"prod-1": {
+			Id:        "prod-1",
+			Name:      "Widget",
+			Price:     &commonpb.Money{AmountCents: 1500, Currency: "USD"},
+			ImageUrls: []string{"https://example.test/p.png"},
+			IsActive:  true,
+		},
+	}}
+}
+
+func newCouponTestService(store *mockCartStore, evaluateFn func(in *orderpb.EvaluateCouponRequest) (*orderpb.EvaluateCouponResponse, error)) *CartService {
+	return NewCartService(store, &client.ServiceClients{
+		Order:   &mockOrderClient{evaluateFn: evaluateFn},
+		Catalog: newTestCatalog(),
+	})
+}
+
+func cartWithItem(userID string) *repository.Cart {
+	return &repository.Cart{
+		UserID: userID,
+		Items: []repository.CartItem{{
+			ProductID: "prod-1",
+			Quantity:  2,
+			UnitPrice: repository.Money{AmountCents: 1500, Currency: "USD"},
+		}},
+	}
+}
+
+func TestAddItemBuildsRepositoryItemFromCatalog(t *testing.T) {
 	var captured repository.CartItem
 	store := &mockCartStore{
 		addItemFn: func(_ context.Context, userID string, item repository.CartItem) (*repository.Cart, error) {
@@ -51,16 +228,8 @@ func TestAddItemBuildsRepositoryItem(t *testing.T) {
 		},
 	}
 
-	svc := NewCartService(store)
-	_, err := svc.AddItem(
-		context.Background(),
-		"user-1",
-		"prod-1",
-		"Widget",
-		2,
-		repository.Money{AmountCents: 1599, Currency: "USD"},
-		"https://example.test/p.png",
-	)
+	svc := NewCartService(store, &client.ServiceClients{Catalog: newTestCatalog()})
+	_, err := svc.AddItem(context.Background(), "user-1", "prod-1", "", 2, 0)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
@@ -68,6 +237,168 @@ func TestAddItemBuildsRepositoryItem(t *testing.T) {
 	if captured.ProductID != "prod-1" || captured.Quantity != 2 || captured.ProductName != "Widget" {
 		t.Fatalf("unexpected captured item: %+v", captured)
 	}
+	if captured.UnitPrice.AmountCents != 1500 || captured.ImageURL != "https://example.test/p.png" {
+		t.Fatalf("expected catalog price and image, got %+v", captured)
+	}
+}
+
+func TestAddItemRejectsUnknownAndInactiveProducts(t *testing.T) {
+	catalog := newTestCatalog()
+	catalog.products["prod-2"] = &catalogpb.Product{
+		Id:       "prod-2",
+		Price:    &commonpb.Money{AmountCents: 900, Currency: "USD"},
+		IsActive: false,
+	}
+	store := &mockCartStore{
+		addItemFn: func(_ context.Context, _ string, item repository.CartItem) (*repository.Cart, error) {
+			t.Fatalf("expected %s not to be added", item.ProductID)
+			return nil, nil
+		},
+	}
+	svc := NewCartService(store, &client.ServiceClients{Catalog: catalog})
+
+	if _, err := svc.AddItem(context.Background(), "user-1", "missing", "", 1, 0); !errors.Is(err, ErrProductNotFound) {
+		t.Fatalf("expected ErrProductNotFound, got %v", err)
+	}
+	if _, err := svc.AddItem(context.Background(), "user-1", "prod-2", "", 1, 0); !errors.Is(err, ErrProductUnavailable) {
+		t.Fatalf("expected ErrProductUnavailable, got %v", err)
+	}
+}
+
+func TestAddItemPricesVariantsAtTheirOwnPrice(t *testing.T) {
+	catalog := newTestCatalog()
+	catalog.products["prod-2"] = &catalogpb.Product{
+		Id:        "prod-2",
+		Name:      "Shirt",
+		Price:     &commonpb.Money{AmountCents: 2000, Currency: "USD"},
+		ImageUrls: []string{"https://example.test/shirt.png"},
+		IsActive:  true,
+		Variants: []*catalogpb.ProductVariant{{
+			Id:        "var-l",
+			ProductId: "prod-2",
+			Sku:       "SHIRT-L",
+			Options:   map[string]string{"size": "L"},
+			Price:     &commonpb.Money{AmountCents: 2400, Currency: "USD"},
+			ImageUrls: []string{"https://example.test/shirt-l.png"},
+			IsActive:  true,
+		}},
+	}
+	var captured repository.CartItem
+	store := &mockCartStore{
+		addItemFn: func(_ context.Context, userID string, item repository.CartItem) (*repository.Cart, error) {
+			captured = item
+			return &repository.Cart{UserID: userID, Items: []repository.CartItem{item}}, nil
+		},
+	}
+	svc := NewCartService(store, &client.ServiceClients{Catalog: catalog})
+
+	if _, err := svc.AddItem(context.Background(), "user-1", "prod-2", "", 1, 0); !errors.Is(err, ErrVariantRequired) {
+		t.Fatalf("expected ErrVariantRequired, got %v", err)
+	}
+	if _, err := svc.AddItem(context.Background(), "user-1", "prod-2", "var-m", 1, 0); !errors.Is(err, ErrProductUnavailable) {
+		t.Fatalf("expected ErrProductUnavailable, got %v", err)
+	}
+
+	if _, err := svc.AddItem(context.Background(), "user-1", "prod-2", "var-l", 1, 0); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if captured.VariantID != "var-l" || captured.UnitPrice.AmountCents != 2400 || captured.ImageURL != "https://example.test/shirt-l.png" {
+		t.Fatalf("expected variant price and image, got %+v", captured)
+	}
+}
+
+func TestGetCartFlagsChangedPrices(t *testing.T) {
+	catalog := newTestCatalog()
+	catalog.products["prod-1"].Price = &commonpb.Money{AmountCents: 1800, Currency: "USD"}
+	store := &mockCartStore{cart: cartWithItem("user-1")}
+	svc := NewCartService(store, &client.ServiceClients{Catalog: catalog})
+
+	cart, err := svc.GetCart(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	item := cart.Items[0]
+	if !item.PriceChanged || item.AddedUnitPrice.AmountCents != 1500 {
+		t.Fatalf("expected price change from 1500 to be flagged, got %+v", item)
+	}
+	if item.UnitPrice.AmountCents != 1800 || item.TotalPrice.AmountCents != 3600 {
+		t.Fatalf("expected item priced at the catalog price, got %+v", item)
+	}
+	if store.cart.Items[0].UnitPrice.AmountCents != 1500 {
+		t.Fatalf("expected stored price to be kept, got %d", store.cart.Items[0].UnitPrice.AmountCents)
+	}
+}
+
+func TestGetCartLooksUpEachProductOnce(t *testing.T) {
+	catalog := newTestCatalog()
+	catalog.products["prod-2"] = &catalogpb.Product{
+		Id:       "prod-2",
+		Name:     "Gadget",
+		Price:    &commonpb.Money{AmountCents: 700, Currency: "USD"},
+		IsActive: true,
+	}
+	cart := cartWithItem("user-1")
+	cart.Items = append(cart.Items, repository.CartItem{
+		ProductID: "prod-2",
+		Quantity:  1,
+		UnitPrice: repository.Money{AmountCents: 700, Currency: "USD"},
+	})
+	cart.SavedItems = []repository.CartItem{
+		{ProductID: "prod-1", Quantity: 1, UnitPrice: repository.Money{AmountCents: 1500, Currency: "USD"}},
+		{ProductID: "gone", Quantity: 1, UnitPrice: repository.Money{AmountCents: 300, Currency: "USD"}},
+	}
+	svc := NewCartService(&mockCartStore{cart: cart}, &client.ServiceClients{Catalog: catalog})
+
+	got, err := svc.GetCart(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(catalog.lookups) != 1 || len(catalog.lookups[0]) != 3 {
+		t.Fatalf("expected one lookup of 3 products, got %v", catalog.lookups)
+	}
+	if got.Items[1].ProductName != "Gadget" || got.Items[1].Unavailable {
+		t.Fatalf("expected prod-2 priced from the catalog, got %+v", got.Items[1])
+	}
+	if !got.SavedItems[1].Unavailable {
+		t.Fatalf("expected the saved item missing from the catalog to be unavailable, got %+v", got.SavedItems[1])
+	}
+}
+
+func TestAcceptPriceChangesStoresCatalogPrice(t *testing.T) {
+	catalog := newTestCatalog()
+	catalog.products["prod-1"].Price = &commonpb.Money{AmountCents: 1800, Currency: "USD"}
+	store := &mockCartStore{cart: cartWithItem("user-1")}
+	svc := NewCartService(store, &client.ServiceClients{Catalog: catalog})
+
+	cart, err := svc.AcceptPriceChanges(context.Background(), "user-1", 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	item := cart.Items[0]
+	if item.PriceChanged || item.UnitPrice.AmountCents != 1800 || item.AddedUnitPrice.AmountCents != 1800 {
+		t.Fatalf("expected the new price to be accepted, got %+v", item)
+	}
+	if store.cart.Items[0].UnitPrice.AmountCents != 1800 {
+		t.Fatalf("expected stored price to be updated, got %d", store.cart.Items[0].UnitPrice.AmountCents)
+	}
+}
+
+func TestGetCartFlagsProductsNoLongerSold(t *testing.T) {
+	catalog := newTestCatalog()
+	catalog.products["prod-1"].IsActive = false
+	svc := NewCartService(&mockCartStore{cart: cartWithItem("user-1")}, &client.ServiceClients{Catalog: catalog})
+
+	cart, err := svc.GetCart(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !cart.Items[0].Unavailable || cart.Items[0].PriceChanged {
+		t.Fatalf("expected item flagged unavailable only, got %+v", cart.Items[0])
+	}
 }
 
 func TestClearCartWrapsDeleteError(t *testing.T) {
@@ -77,8 +408,8 @@ func TestClearCartWrapsDeleteError(t *testing.T) {
 		},
 	}
 
-	svc := NewCartService(store)
-	err := svc.ClearCart(context.Background(), "user-1")
+	svc := NewCartService(store, &client.ServiceClients{})
+	err := svc.ClearCart(context.Background(), "user-1", 0)
 	if err == nil {
 		t.Fatalf("expected error, got nil")
 	}
@@ -87,3 +418,236 @@ func TestClearCartWrapsDeleteError(t *testing.T) {
 		t.Fatalf("unexpected error message: %v", err)
 	}
 }
+
+func TestApplyCouponStoresAcceptedCoupon(t *testing.T) {
+	store := &mockCartStore{cart: cartWithItem("user-1")}
+	svc := newCouponTestService(store, func(in *orderpb.EvaluateCouponRequest) (*orderpb.EvaluateCouponResponse, error) {
+		if in.CouponCode != "save10" || len(in.Items) != 1 || in.Items[0].UnitPrice.AmountCents != 1500 {
+			t.Fatalf("unexpected evaluate request: %+v", in)
+		}
+		return &orderpb.EvaluateCouponResponse{
+			CouponCode: "SAVE10",
+			Discount:   &commonpb.Money{AmountCents: 300, Currency: "USD"},
+		}, nil
+	})
+
+	cart, err := svc.ApplyCoupon(context.Background(), "user-1", "save10", 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if cart.CouponCode != "SAVE10" || cart.Discount.AmountCents != 300 {
+		t.Fatalf("expected SAVE10 with 300 off, got %q with %d off", cart.CouponCode, cart.Discount.AmountCents)
+	}
+	if store.cart.CouponCode != "SAVE10" {
+		t.Fatalf("expected coupon to be stored, got %q", store.cart.CouponCode)
+	}
+}
+
+func TestApplyCouponEvaluatesGuestCartWithoutUser(t *testing.T) {
+	guestID := repository.GuestOwnerPrefix + "token-1"
+	store := &mockCartStore{cart: cartWithItem(guestID)}
+	svc := newCouponTestService(store, func(in *orderpb.EvaluateCouponRequest) (*orderpb.EvaluateCouponResponse, error) {
+		if in.UserId != "" {
+			t.Fatalf("expected guest cart to be evaluated without a user, got %q", in.UserId)
+		}
+		return &orderpb.EvaluateCouponResponse{
+			CouponCode: "SAVE10",
+			Discount:   &commonpb.Money{AmountCents: 300, Currency: "USD"},
+		}, nil
+	})
+
+	cart, err := svc.ApplyCoupon(context.Background(), guestID, "SAVE10", 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cart.CouponCode != "SAVE10" {
+		t.Fatalf("expected SAVE10, got %q", cart.CouponCode)
+	}
+}
+
+func TestApplyCouponRejectsCouponTheOrderServiceRefuses(t *testing.T) {
+	store := &mockCartStore{cart: cartWithItem("user-1")}
+	svc := newCouponTestService(store, func(in *orderpb.EvaluateCouponRequest) (*orderpb.EvaluateCouponResponse, error) {
+		return nil, status.Error(codes.FailedPrecondition, "coupon cannot be applied: coupon is not active")
+	})
+
+	_, err := svc.ApplyCoupon(context.Background(), "user-1", "OLD", 0)
+	if !errors.Is(err, ErrCouponRejected) {
+		t.Fatalf("expected ErrCouponRejected, got %v", err)
+	}
+	if store.cart.CouponCode != "" {
+		t.Fatalf("expected rejected coupon not to be stored, got %q", store.cart.CouponCode)
+	}
+}
+
+func TestApplyCouponRejectsEmptyCart(t *testing.T) {
+	svc := newCouponTestService(&mockCartStore{}, func(in *orderpb.EvaluateCouponRequest) (*orderpb.EvaluateCouponResponse, error) {
+		t.Fatalf("expected no evaluation for an empty cart")
+		return nil, nil
+	})
+
+	if _, err := svc.ApplyCoupon(context.Background(), "user-1", "SAVE10", 0); !errors.Is(err, ErrEmptyCart) {
+		t.Fatalf("expected ErrEmptyCart, got %v", err)
+	}
+}
+
+func TestGetCartReportsCouponThatNoLongerApplies(t *testing.T) {
+	cart := cartWithItem("user-1")
+	cart.CouponCode = "SAVE10"
+	svc := newCouponTestService(&mockCartStore{cart: cart}, func(in *orderpb.EvaluateCouponRequest) (*orderpb.EvaluateCouponResponse, error) {
+		return nil, status.Error(codes.FailedPrecondition, "coupon cannot be applied: coupon is no longer available")
+	})
+
+	got, err := svc.GetCart(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if got.CouponCode != "SAVE10" || got.Discount.AmountCents != 0 || got.CouponError == "" {
+		t.Fatalf("expected coupon kept without discount and with an error, got %+v", got)
+	}
+}
+
+func TestMergeCartsMergesGuestCartOfToken(t *testing.T) {
+	store := &mockCartStore{cart: cartWithItem("user-1")}
+	svc := NewCartService(store, &client.ServiceClients{Catalog: newTestCatalog()})
+
+	cart, err := svc.MergeCarts(context.Background(), "user-1", "token-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if store.mergedGuest != "guest:token-1" {
+		t.Fatalf("expected guest cart guest:token-1 to be merged, got %q", store.mergedGuest)
+	}
+	if cart.UserID != "user-1" || cart.Items[0].ProductName != "Widget" {
+		t.Fatalf("expected priced cart of user-1, got %+v", cart)
+	}
+}
+
+func TestRunGuestCartCleanupDeletesCartsOlderThanMaxAge(t *testing.T) {
+	store := &mockCartStore{}
+	svc := NewCartService(store, &client.ServiceClients{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	svc.RunGuestCartCleanup(ctx, time.Hour, 24*time.Hour)
+
+	if age := time.Since(store.staleBefore); age < 24*time.Hour || age > 25*time.Hour {
+		t.Fatalf("expected carts idle for a day to be deleted, got cutoff %v ago", age)
+	}
+}
+
+func TestApplyCouponRejectsStaleVersion(t *testing.T) {
+	cart := cartWithItem("user-1")
+	cart.Version = 3
+	store := &mockCartStore{cart: cart}
+	svc := newCouponTestService(store, func(in *orderpb.EvaluateCouponRequest) (*orderpb.EvaluateCouponResponse, error) {
+		t.Fatalf("expected no evaluation for a stale cart")
+		return nil, nil
+	})
+
+	if _, err := svc.ApplyCoupon(context.Background(), "user-1", "SAVE10", 2); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Fatalf("expected ErrVersionConflict, got %v", err)
+	}
+	if store.cart.CouponCode != "" {
+		t.Fatalf("expected coupon not to be stored, got %q", store.cart.CouponCode)
+	}
+}
+
+func TestSendCartRemindersEmailsIdleCartItems(t *testing.T) {
+	cart := cartWithItem("user-1")
+	cart.UpdatedAt = time.Now().Add(-48 * time.Hour)
+	store := &mockCartStore{abandoned: []*repository.Cart{cart}}
+	notifications := &mockNotificationClient{}
+	svc := NewCartService(store, &client.ServiceClients{
+		Order:        &mockOrderClient{},
+		Catalog:      newTestCatalog(),
+		User:         &mockUserClient{},
+		Notification: notifications,
+	})
+
+	sent, err := svc.SendCartReminders(context.Background(), 24*time.Hour, 2)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if sent != 1 || len(notifications.reminders) != 1 {
+		t.Fatalf("expected one reminder, got %d", len(notifications.reminders))
+	}
+	reminder := notifications.reminders[0]
+	if reminder.Email != "user-1@example.test" || reminder.FirstName != "Ada" {
+		t.Fatalf("expected reminder to user-1, got %+v", reminder)
+	}
+	if len(reminder.Items) != 1 || reminder.Items[0].ProductName != "Widget" || reminder.Total.AmountCents != 3000 {
+		t.Fatalf("expected Widget totalling 3000, got %+v", reminder)
+	}
+	if sent, ok := store.reminded["user-1"]; !ok || !sent {
+		t.Fatalf("expected reminder to be recorded as sent")
+	}
+}
+
+func TestSendCartRemindersSkipsCartsCheckedOut(t *testing.T) {
+	cart := cartWithItem("user-1")
+	cart.UpdatedAt = time.Now().Add(-48 * time.Hour)
+	store := &mockCartStore{abandoned: []*repository.Cart{cart}}
+	notifications := &mockNotificationClient{}
+	svc := NewCartService(store, &client.ServiceClients{
+		Order: &mockOrderClient{orders: []*orderpb.Order{{
+			Id:        "order-1",
+			CreatedAt: time.Now().Add(-47 * time.Hour).UTC().Format("2006-01-02T15:04:05Z"),
+		}}},
+		Catalog:      newTestCatalog(),
+		User:         &mockUserClient{},
+		Notification: notifications,
+	})
+
+	if _, err := svc.SendCartReminders(context.Background(), 24*time.Hour, 2); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(notifications.reminders) != 0 {
+		t.Fatalf("expected no reminder for a checked out cart, got %d", len(notifications.reminders))
+	}
+	if sent, ok := store.reminded["user-1"]; !ok || sent {
+		t.Fatalf("expected cart to be recorded as checked without a reminder")
+	}
+}
+
+func TestMoveToSavedForLaterRefreshesSavedItemPrices(t *testing.T) {
+	catalog := newTestCatalog()
+	catalog.products["prod-1"].Price = &commonpb.Money{AmountCents: 1800, Currency: "USD"}
+	store := &mockCartStore{cart: cartWithItem("user-1")}
+	svc := NewCartService(store, &client.ServiceClients{Catalog: catalog})
+
+	cart, err := svc.MoveToSavedForLater(context.Background(), "user-1", "prod-1", "", 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(cart.Items) != 0 || len(cart.SavedItems) != 1 {
+		t.Fatalf("expected the item to be saved for later, got %+v", cart)
+	}
+	saved := cart.SavedItems[0]
+	if saved.UnitPrice.AmountCents != 1800 || !saved.PriceChanged || saved.ProductName != "Widget" {
+		t.Fatalf("expected saved item priced from the catalog, got %+v", saved)
+	}
+}
+
+func TestMoveToCartRejectsProductsNoLongerSold(t *testing.T) {
+	catalog := newTestCatalog()
+	catalog.products["prod-1"].IsActive = false
+	store := &mockCartStore{cart: &repository.Cart{
+		UserID:     "user-1",
+		SavedItems: cartWithItem("user-1").Items,
+	}}
+	svc := NewCartService(store, &client.ServiceClients{Catalog: catalog})
+
+	if _, err := svc.MoveToCart(context.Background(), "user-1", "prod-1", "", 0); !errors.Is(err, ErrProductUnavailable) {
+		t.Fatalf("expected ErrProductUnavailable, got %v", err)
+	}
+	if len(store.cart.Items) != 0 || len(store.cart.SavedItems) != 1 {
+		t.Fatalf("expected the item to stay saved, got %+v", store.cart)
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE carts ADD COLUMN IF NOT EXISTS coupon_code TEXT NOT NULL DEFAULT '';
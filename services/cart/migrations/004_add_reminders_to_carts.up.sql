@@ -0,0 +1,2 @@
+ALTER TABLE carts ADD COLUMN IF NOT EXISTS reminders_sent INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE carts ADD COLUMN IF NOT EXISTS last_reminded_at TIMESTAMPTZ;
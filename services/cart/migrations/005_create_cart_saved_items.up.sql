@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS cart_saved_items (
+    user_id TEXT NOT NULL,
+    product_id TEXT NOT NULL,
+    product_name TEXT NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    unit_price_cents BIGINT NOT NULL CHECK (unit_price_cents >= 0),
+    currency TEXT NOT NULL,
+    image_url TEXT NOT NULL DEFAULT '',
+    saved_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, product_id),
+    CONSTRAINT fk_cart_saved_items_cart
+        FOREIGN KEY (user_id)
+        REFERENCES carts(user_id)
+        ON DELETE CASCADE
+);
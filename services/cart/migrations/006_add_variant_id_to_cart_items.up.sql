@@ -0,0 +1,7 @@
+ALTER TABLE cart_items ADD COLUMN IF NOT EXISTS variant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE cart_items DROP CONSTRAINT IF EXISTS cart_items_pkey;
+ALTER TABLE cart_items ADD PRIMARY KEY (user_id, product_id, variant_id);
+
+ALTER TABLE cart_saved_items ADD COLUMN IF NOT EXISTS variant_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE cart_saved_items DROP CONSTRAINT IF EXISTS cart_saved_items_pkey;
+ALTER TABLE cart_saved_items ADD PRIMARY KEY (user_id, product_id, variant_id);
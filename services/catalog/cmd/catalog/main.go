@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"time"
 
 	pb "github.com/safar/microservices-demo/proto/catalog/v1"
+	"github.com/safar/microservices-demo/services/catalog/internal/client"
 	"github.com/safar/microservices-demo/services/catalog/internal/config"
 	"github.com/safar/microservices-demo/services/catalog/internal/repository"
 	"github.com/safar/microservices-demo/services/catalog/internal/server"
 	"github.com/safar/microservices-demo/services/catalog/internal/service"
+	"github.com/safar/microservices-demo/shared/events"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
@@ -25,8 +29,39 @@ func main() {
 	}
 	defer repo.Close()
 
+	// Initialize service clients
+	clients, err := client.NewServiceClients(cfg.OrderServiceURL)
+	if err != nil {
+		log.Fatalf("Failed to initialize service clients: %v", err)
+	}
+	defer clients.Close()
+
+	// Initialize event bus
+	bus, err := events.Open(cfg.EventBusDriver, cfg.EventBusURL)
+	if err != nil {
+		log.Fatalf("Failed to initialize event bus: %v", err)
+	}
+	defer bus.Close()
+
+	// Publish low-stock and out-of-stock alerts raised by stock changes
+	go events.NewOutboxRelay(repo, bus).Run(context.Background(), time.Second)
+
 	// Initialize service
-	catalogService := service.NewCatalogService(repo)
+	catalogService := service.NewCatalogService(repo, clients)
+
+	// Return stock held by reservations that expired without being committed
+	go catalogService.RunReservationSweeper(context.Background(), time.Minute)
+
+	// Write searches to the query log that ranks suggestions
+	go catalogService.RunSearchQueryLog(context.Background(), 10*time.Second)
+
+	// Return the stock of cancelled orders
+	eventHandler := server.NewEventHandler(catalogService)
+	go func() {
+		if err := bus.Subscribe(context.Background(), "catalog-service", server.OrderEventTypes, eventHandler.HandleOrderEvent); err != nil {
+			log.Printf("Order event subscription stopped: %v", err)
+		}
+	}()
 
 	// Initialize gRPC server
 	grpcServer := server.NewGRPCServer(catalogService)
@@ -5,6 +5,7 @@ go 1.26.0
 require (
 	github.com/lib/pq v1.11.2
 	github.com/safar/microservices-demo/proto v0.0.0-00010101000000-000000000000
+	github.com/safar/microservices-demo/shared v0.0.0-00010101000000-000000000000
 	google.golang.org/grpc v1.79.1
 )
 
@@ -17,3 +18,5 @@ require (
 )
 
 replace github.com/safar/microservices-demo/proto => ../../proto
+
+replace github.com/safar/microservices-demo/shared => ../../shared
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"fmt"
+
+	orderpb "github.com/safar/microservices-demo/proto/order/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type ServiceClients struct {
+	Order orderpb.OrderServiceClient
+	conns []*grpc.ClientConn
+}
+
+func NewServiceClients(orderURL string) (*ServiceClients, error) {
+	clients := &ServiceClients{}
+
+	// Connect to Order Service
+	orderConn, err := dialService(orderURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to order service: %w", err)
+	}
+	clients.Order = orderpb.NewOrderServiceClient(orderConn)
+	clients.conns = append(clients.conns, orderConn)
+
+	return clients, nil
+}
+
+// dialService connects lazily: the order service waits for the catalog
+// service when it starts, so blocking here would deadlock the two on
+// startup.
+func dialService(serviceURL string) (*grpc.ClientConn, error) {
+	return grpc.NewClient(serviceURL,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+}
+
+func (c *ServiceClients) Close() error {
+	for _, conn := range c.conns {
+		if err := conn.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,11 +2,14 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
+	"github.com/safar/microservices-demo/shared/pagination"
 )
 
 type Category struct {
@@ -19,27 +22,96 @@ type Category struct {
 }
 
 type Product struct {
-	ID            string
-	Name          string
-	Slug          string
-	Description   string
+	ID          string
+	Name        string
+	Slug        string
+	Description string
+	// PriceCents is the list price; see EffectivePriceCents for what the
+	// product sells at now.
 	PriceCents    int64
 	Currency      string
 	CategoryID    sql.NullString
 	ImageURLs     []string
 	StockQuantity int32
+	WeightGrams   int32
+	// ReorderThreshold is the stock at or below which the product, or each
+	// of its variants, is low on stock; 0 when it has none.
+	ReorderThreshold int32
+	// RatingAverage and RatingCount summarise the product's approved
+	// reviews.
+	RatingAverage float64
+	RatingCount   int32
 	IsActive      bool
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
+	// Options, Variants and Breadcrumbs are loaded by the catalog service
+	// for single products and are not read with the product.
+	Options     []ProductOption
+	Variants    []*ProductVariant
+	Breadcrumbs []*Category
+	// ScheduledPrice is the scheduled price in effect, loaded by the
+	// catalog service; nil when the product sells at its list price.
+	ScheduledPrice *ProductPrice
 }
 
-type InventoryReservation struct {
-	ID        string
-	OrderID   string
+// EffectivePriceCents returns what the product sells at now: its scheduled
+// price in effect, or else its list price.
+func (p *Product) EffectivePriceCents() int64 {
+	if p.ScheduledPrice != nil {
+		return p.ScheduledPrice.PriceCents
+	}
+	return p.PriceCents
+}
+
+// CompareAtPriceCents returns the original price to show struck through
+// while a scheduled price is in effect, which is the list price unless the
+// scheduled price sets its own. It returns 0 when no scheduled price is in
+// effect or it is not a reduction.
+func (p *Product) CompareAtPriceCents() int64 {
+	if p.ScheduledPrice == nil {
+		return 0
+	}
+	compareAt := p.PriceCents
+	if p.ScheduledPrice.CompareAtCents.Valid {
+		compareAt = p.ScheduledPrice.CompareAtCents.Int64
+	}
+	if compareAt <= p.ScheduledPrice.PriceCents {
+		return 0
+	}
+	return compareAt
+}
+
+// InventoryKey names what stock is held for: a product, or one of its
+// variants when VariantID is set.
+type InventoryKey struct {
 	ProductID string
-	Quantity  int32
-	ReservedAt time.Time
-	ExpiresAt  time.Time
+	VariantID string
+}
+
+// Reservation statuses. A pending reservation holds stock until it is
+// committed, released or expires.
+const (
+	ReservationStatusPending   = "pending"
+	ReservationStatusCommitted = "committed"
+	ReservationStatusReleased  = "released"
+	ReservationStatusExpired   = "expired"
+)
+
+var (
+	ErrProductNotFound     = errors.New("product not found")
+	ErrReservationNotFound = errors.New("reservation not found")
+	ErrReservationClosed   = errors.New("reservation is no longer active")
+)
+
+type InventoryReservation struct {
+	ID            string
+	ReservationID string
+	OrderID       string
+	ProductID     string
+	VariantID     sql.NullString
+	Quantity      int32
+	ReservedAt    time.Time
+	ExpiresAt     time.Time
 }
 
 type CatalogRepository struct {
@@ -94,11 +166,14 @@ func (r *CatalogRepository) ListCategories() ([]*Category, error) {
 }
 
 // Product operations
-func (r *CatalogRepository) CreateProduct(name, slug, description string, priceCents int64, currency, categoryID string, imageURLs []string, stockQuantity int32) (*Product, error) {
+
+// CreateProduct creates a product, receiving stockQuantity of it at the
+// default warehouse.
+func (r *CatalogRepository) CreateProduct(name, slug, description string, priceCents int64, currency, categoryID string, imageURLs []string, stockQuantity, weightGrams int32) (*Product, error) {
 	query := `
-		INSERT INTO products (name, slug, description, price_cents, currency, category_id, image_urls, stock_quantity)
+		INSERT INTO products (name, slug, description, price_cents, currency, category_id, image_urls, weight_grams)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id, name, slug, description, price_cents, currency, category_id, image_urls, stock_quantity, is_active, created_at, updated_at
+		RETURNING id, name, slug, description, price_cents, currency, category_id, image_urls, stock_quantity, weight_grams, reorder_threshold, rating_average, rating_count, is_active, created_at, updated_at
 	`
 
 	var categoryIDNull sql.NullString
@@ -106,22 +181,37 @@ func (r *CatalogRepository) CreateProduct(name, slug, description string, priceC
 		categoryIDNull = sql.NullString{String: categoryID, Valid: true}
 	}
 
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	product := &Product{}
-	err := r.db.QueryRow(query, name, slug, description, priceCents, currency, categoryIDNull, pq.Array(imageURLs), stockQuantity).Scan(
+	err = tx.QueryRow(query, name, slug, description, priceCents, currency, categoryIDNull, pq.Array(imageURLs), weightGrams).Scan(
 		&product.ID, &product.Name, &product.Slug, &product.Description, &product.PriceCents,
 		&product.Currency, &product.CategoryID, pq.Array(&product.ImageURLs), &product.StockQuantity,
-		&product.IsActive, &product.CreatedAt, &product.UpdatedAt,
+		&product.WeightGrams, &product.ReorderThreshold, &product.RatingAverage, &product.RatingCount, &product.IsActive, &product.CreatedAt, &product.UpdatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create product: %w", err)
 	}
 
+	if err := receiveOpeningStock(tx, product.ID, "", stockQuantity); err != nil {
+		return nil, err
+	}
+	product.StockQuantity = max(stockQuantity, 0)
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return product, nil
 }
 
 func (r *CatalogRepository) GetProductByID(id string) (*Product, error) {
 	query := `
-		SELECT id, name, slug, description, price_cents, currency, category_id, image_urls, stock_quantity, is_active, created_at, updated_at
+		SELECT id, name, slug, description, price_cents, currency, category_id, image_urls, stock_quantity, weight_grams, reorder_threshold, rating_average, rating_count, is_active, created_at, updated_at
 		FROM products
 		WHERE id = $1
 	`
@@ -130,8 +220,11 @@ func (r *CatalogRepository) GetProductByID(id string) (*Product, error) {
 	err := r.db.QueryRow(query, id).Scan(
 		&product.ID, &product.Name, &product.Slug, &product.Description, &product.PriceCents,
 		&product.Currency, &product.CategoryID, pq.Array(&product.ImageURLs), &product.StockQuantity,
-		&product.IsActive, &product.CreatedAt, &product.UpdatedAt,
+		&product.WeightGrams, &product.ReorderThreshold, &product.RatingAverage, &product.RatingCount, &product.IsActive, &product.CreatedAt, &product.UpdatedAt,
 	)
+	if err == sql.ErrNoRows {
+		return nil, ErrProductNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get product: %w", err)
 	}
@@ -141,7 +234,7 @@ func (r *CatalogRepository) GetProductByID(id string) (*Product, error) {
 
 func (r *CatalogRepository) GetProductBySlug(slug string) (*Product, error) {
 	query := `
-		SELECT id, name, slug, description, price_cents, currency, category_id, image_urls, stock_quantity, is_active, created_at, updated_at
+		SELECT id, name, slug, description, price_cents, currency, category_id, image_urls, stock_quantity, weight_grams, reorder_threshold, rating_average, rating_count, is_active, created_at, updated_at
 		FROM products
 		WHERE slug = $1
 	`
@@ -150,8 +243,11 @@ func (r *CatalogRepository) GetProductBySlug(slug string) (*Product, error) {
 	err := r.db.QueryRow(query, slug).Scan(
 		&product.ID, &product.Name, &product.Slug, &product.Description, &product.PriceCents,
 		&product.Currency, &product.CategoryID, pq.Array(&product.ImageURLs), &product.StockQuantity,
-		&product.IsActive, &product.CreatedAt, &product.UpdatedAt,
+		&product.WeightGrams, &product.ReorderThreshold, &product.RatingAverage, &product.RatingCount, &product.IsActive, &product.CreatedAt, &product.UpdatedAt,
 	)
+	if err == sql.ErrNoRows {
+		return nil, ErrProductNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get product: %w", err)
 	}
@@ -159,40 +255,20 @@ func (r *CatalogRepository) GetProductBySlug(slug string) (*Product, error) {
 	return product, nil
 }
 
-func (r *CatalogRepository) ListProducts(limit, offset int, categoryID string, activeOnly bool) ([]*Product, int, error) {
-	countQuery := `SELECT COUNT(*) FROM products WHERE 1=1`
-	query := `
-		SELECT id, name, slug, description, price_cents, currency, category_id, image_urls, stock_quantity, is_active, created_at, updated_at
-		FROM products
-		WHERE 1=1
-	`
-
-	args := []interface{}{}
-	argPos := 1
-
-	if categoryID != "" {
-		countQuery += fmt.Sprintf(" AND category_id = $%d", argPos)
-		query += fmt.Sprintf(" AND category_id = $%d", argPos)
-		args = append(args, categoryID)
-		argPos++
-	}
-
-	if activeOnly {
-		countQuery += " AND is_active = true"
-		query += " AND is_active = true"
+// GetProductsByIDs returns the products of ids that exist, in no
+// particular order.
+func (r *CatalogRepository) GetProductsByIDs(ids []string) ([]*Product, error) {
+	if len(ids) == 0 {
+		return nil, nil
 	}
 
-	var totalCount int
-	if err := r.db.QueryRow(countQuery, args...).Scan(&totalCount); err != nil {
-		return nil, 0, fmt.Errorf("failed to count products: %w", err)
-	}
-
-	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", argPos, argPos+1)
-	args = append(args, limit, offset)
-
-	rows, err := r.db.Query(query, args...)
+	rows, err := r.db.Query(`
+		SELECT id, name, slug, description, price_cents, currency, category_id, image_urls, stock_quantity, weight_grams, reorder_threshold, rating_average, rating_count, is_active, created_at, updated_at
+		FROM products
+		WHERE id = ANY($1)
+	`, pq.Array(ids))
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to list products: %w", err)
+		return nil, fmt.Errorf("failed to get products: %w", err)
 	}
 	defer rows.Close()
 
@@ -202,49 +278,62 @@ func (r *CatalogRepository) ListProducts(limit, offset int, categoryID string, a
 		if err := rows.Scan(
 			&product.ID, &product.Name, &product.Slug, &product.Description, &product.PriceCents,
 			&product.Currency, &product.CategoryID, pq.Array(&product.ImageURLs), &product.StockQuantity,
-			&product.IsActive, &product.CreatedAt, &product.UpdatedAt,
+			&product.WeightGrams, &product.ReorderThreshold, &product.RatingAverage, &product.RatingCount, &product.IsActive, &product.CreatedAt, &product.UpdatedAt,
 		); err != nil {
-			return nil, 0, fmt.Errorf("failed to scan product: %w", err)
+			return nil, fmt.Errorf("failed to scan product: %w", err)
 		}
 		products = append(products, product)
 	}
 
-	return products, totalCount, nil
-}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate products: %w", err)
+	}
 
-func (r *CatalogRepository) SearchProducts(searchQuery string, limit, offset int, categoryID string) ([]*Product, int, error) {
-	countQuery := `
-		SELECT COUNT(*) FROM products
-		WHERE (name ILIKE $1 OR description ILIKE $1)
-	`
-	query := `
-		SELECT id, name, slug, description, price_cents, currency, category_id, image_urls, stock_quantity, is_active, created_at, updated_at
-		FROM products
-		WHERE (name ILIKE $1 OR description ILIKE $1)
-	`
+	return products, nil
+}
 
-	searchPattern := "%" + searchQuery + "%"
-	args := []interface{}{searchPattern}
-	argPos := 2
+// ListProducts lists products in the order of sortOrder, one of the search
+// sorts other than relevance, or newest first. With includeDescendants,
+// products of every category below categoryID are listed too.
+func (r *CatalogRepository) ListProducts(page pagination.Page, categoryID string, includeDescendants, activeOnly bool, sortOrder string) ([]*Product, pagination.Result, error) {
+	where := ` WHERE 1=1`
+	args := []interface{}{}
+	argPos := 1
 
-	if categoryID != "" {
-		countQuery += fmt.Sprintf(" AND category_id = $%d", argPos)
-		query += fmt.Sprintf(" AND category_id = $%d", argPos)
+	if categoryID != "" && includeDescendants {
+		where += " AND " + inCategorySubtree("category_id", fmt.Sprintf("$%d", argPos))
+		args = append(args, categoryID)
+		argPos++
+	} else if categoryID != "" {
+		where += fmt.Sprintf(" AND category_id = $%d", argPos)
 		args = append(args, categoryID)
 		argPos++
 	}
 
-	var totalCount int
-	if err := r.db.QueryRow(countQuery, args...).Scan(&totalCount); err != nil {
-		return nil, 0, fmt.Errorf("failed to count search results: %w", err)
+	if activeOnly {
+		where += " AND is_active = true"
+	}
+
+	result, err := pagination.Count(r.db, page, `FROM products p`+where, args...)
+	if err != nil {
+		return nil, pagination.Result{}, fmt.Errorf("failed to count products: %w", err)
 	}
 
-	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", argPos, argPos+1)
-	args = append(args, limit, offset)
+	if condition, conditionArgs := page.Condition("p.created_at", "p.id", argPos); condition != "" {
+		where += " AND " + condition
+		args = append(args, conditionArgs...)
+		argPos += len(conditionArgs)
+	}
+
+	query := `
+		SELECT id, name, slug, description, price_cents, currency, category_id, image_urls, stock_quantity, weight_grams, reorder_threshold, rating_average, rating_count, is_active, created_at, updated_at
+		FROM products p` + where
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d OFFSET $%d", productOrder(sortOrder), argPos, argPos+1)
+	args = append(args, page.Limit(), page.Offset())
 
 	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to search products: %w", err)
+		return nil, pagination.Result{}, fmt.Errorf("failed to list products: %w", err)
 	}
 	defer rows.Close()
 
@@ -254,22 +343,27 @@ func (r *CatalogRepository) SearchProducts(searchQuery string, limit, offset int
 		if err := rows.Scan(
 			&product.ID, &product.Name, &product.Slug, &product.Description, &product.PriceCents,
 			&product.Currency, &product.CategoryID, pq.Array(&product.ImageURLs), &product.StockQuantity,
-			&product.IsActive, &product.CreatedAt, &product.UpdatedAt,
+			&product.WeightGrams, &product.ReorderThreshold, &product.RatingAverage, &product.RatingCount, &product.IsActive, &product.CreatedAt, &product.UpdatedAt,
 		); err != nil {
-			return nil, 0, fmt.Errorf("failed to scan product: %w", err)
+			return nil, pagination.Result{}, fmt.Errorf("failed to scan product: %w", err)
 		}
 		products = append(products, product)
 	}
 
-	return products, totalCount, nil
+	products, result.Next = pagination.Trim(page, products, func(product *Product) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: product.CreatedAt, ID: product.ID}
+	})
+	return products, result, nil
 }
 
-func (r *CatalogRepository) UpdateProduct(id, name, slug, description string, priceCents int64, currency, categoryID string, imageURLs []string, stockQuantity int32, isActive bool) (*Product, error) {
+// UpdateProduct replaces a product's fields other than its stock, which
+// only changes through the inventory ledger.
+func (r *CatalogRepository) UpdateProduct(id, name, slug, description string, priceCents int64, currency, categoryID string, imageURLs []string, weightGrams int32, isActive bool) (*Product, error) {
 	query := `
 		UPDATE products
-		SET name = $2, slug = $3, description = $4, price_cents = $5, currency = $6, category_id = $7, image_urls = $8, stock_quantity = $9, is_active = $10, updated_at = NOW()
+		SET name = $2, slug = $3, description = $4, price_cents = $5, currency = $6, category_id = $7, image_urls = $8, weight_grams = $9, is_active = $10, updated_at = NOW()
 		WHERE id = $1
-		RETURNING id, name, slug, description, price_cents, currency, category_id, image_urls, stock_quantity, is_active, created_at, updated_at
+		RETURNING id, name, slug, description, price_cents, currency, category_id, image_urls, stock_quantity, weight_grams, reorder_threshold, rating_average, rating_count, is_active, created_at, updated_at
 	`
 
 	var categoryIDNull sql.NullString
@@ -278,10 +372,10 @@ func (r *CatalogRepository) UpdateProduct(id, name, slug, description string, pr
 	}
 
 	product := &Product{}
-	err := r.db.QueryRow(query, id, name, slug, description, priceCents, currency, categoryIDNull, pq.Array(imageURLs), stockQuantity, isActive).Scan(
+	err := r.db.QueryRow(query, id, name, slug, description, priceCents, currency, categoryIDNull, pq.Array(imageURLs), weightGrams, isActive).Scan(
 		&product.ID, &product.Name, &product.Slug, &product.Description, &product.PriceCents,
 		&product.Currency, &product.CategoryID, pq.Array(&product.ImageURLs), &product.StockQuantity,
-		&product.IsActive, &product.CreatedAt, &product.UpdatedAt,
+		&product.WeightGrams, &product.ReorderThreshold, &product.RatingAverage, &product.RatingCount, &product.IsActive, &product.CreatedAt, &product.UpdatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update product: %w", err)
@@ -302,10 +396,27 @@ func (r *CatalogRepository) DeleteProduct(id string) error {
 }
 
 // Inventory operations
-func (r *CatalogRepository) CheckInventory(productID string, quantity int32) (bool, error) {
-	query := `SELECT stock_quantity FROM products WHERE id = $1`
 
+// CheckInventory reports whether quantity of a product is in stock, or of
+// one of its variants when variantID is set.
+func (r *CatalogRepository) CheckInventory(productID, variantID string, quantity int32) (bool, error) {
 	var stockQuantity int32
+	if variantID != "" {
+		err := r.db.QueryRow(`
+			SELECT stock_quantity FROM product_variants
+			WHERE id = $1 AND product_id = $2 AND is_active = true
+		`, variantID, productID).Scan(&stockQuantity)
+		if err == sql.ErrNoRows {
+			return false, ErrVariantNotFound
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to check inventory: %w", err)
+		}
+		return stockQuantity >= quantity, nil
+	}
+
+	query := `SELECT stock_quantity FROM products WHERE id = $1`
+
 	if err := r.db.QueryRow(query, productID).Scan(&stockQuantity); err != nil {
 		return false, fmt.Errorf("failed to check inventory: %w", err)
 	}
@@ -313,44 +424,223 @@ func (r *CatalogRepository) CheckInventory(productID string, quantity int32) (bo
 	return stockQuantity >= quantity, nil
 }
 
-func (r *CatalogRepository) ReserveInventory(orderID, productID string, quantity int32, expirationMinutes int32) (string, error) {
+// ReserveInventory holds stock for every item of an order under a single
+// reservation ID. Items naming a variant take the variant's stock.
+// Reserving again for the same order returns the existing reservation
+// instead of holding the stock twice. Each hold is recorded in the
+// inventory ledger.
+func (r *CatalogRepository) ReserveInventory(orderID string, items map[InventoryKey]int32, expirationMinutes int32) (string, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
 		return "", fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	// Check current stock
-	var stockQuantity int32
-	if err := tx.QueryRow(`SELECT stock_quantity FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&stockQuantity); err != nil {
-		return "", fmt.Errorf("failed to check stock: %w", err)
+	var reservationID string
+	expiresAt := time.Now().Add(time.Duration(expirationMinutes) * time.Minute)
+	err = tx.QueryRow(`
+		INSERT INTO reservations (order_id, status, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (order_id) DO NOTHING
+		RETURNING id
+	`, orderID, ReservationStatusPending, expiresAt).Scan(&reservationID)
+	if err == sql.ErrNoRows {
+		var status string
+		if err := tx.QueryRow(`SELECT id, status FROM reservations WHERE order_id = $1`, orderID).Scan(&reservationID, &status); err != nil {
+			return "", fmt.Errorf("failed to get reservation: %w", err)
+		}
+		if status != ReservationStatusPending && status != ReservationStatusCommitted {
+			return "", fmt.Errorf("%w: reservation for order %s is %s", ErrReservationClosed, orderID, status)
+		}
+		return reservationID, nil
 	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create reservation: %w", err)
+	}
+
+	// Lock stock in a stable order so concurrent reservations can't deadlock
+	keys := make([]InventoryKey, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ProductID != keys[j].ProductID {
+			return keys[i].ProductID < keys[j].ProductID
+		}
+		return keys[i].VariantID < keys[j].VariantID
+	})
+
+	for _, key := range keys {
+		if err := reserveStock(tx, reservationID, orderID, key, items[key], expiresAt); err != nil {
+			return "", err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return reservationID, nil
+}
 
-	if stockQuantity < quantity {
-		return "", fmt.Errorf("insufficient stock")
+// CommitReservation marks reserved stock as sold so it is never returned to
+// inventory by expiry, recording the sale in the inventory ledger.
+// Committing an already committed reservation is a no-op.
+func (r *CatalogRepository) CommitReservation(reservationID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback()
 
-	// Update stock
-	_, err = tx.Exec(`UPDATE products SET stock_quantity = stock_quantity - $1 WHERE id = $2`, quantity, productID)
+	status, err := lockReservation(tx, reservationID)
 	if err != nil {
-		return "", fmt.Errorf("failed to update stock: %w", err)
+		return err
 	}
 
-	// Create reservation
-	expiresAt := time.Now().Add(time.Duration(expirationMinutes) * time.Minute)
+	switch status {
+	case ReservationStatusCommitted:
+		return nil
+	case ReservationStatusPending:
+	default:
+		return fmt.Errorf("%w: reservation %s is %s", ErrReservationClosed, reservationID, status)
+	}
+
+	if err := moveReservedStock(tx, reservationID, MovementSale); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE reservations SET status = $2, updated_at = NOW() WHERE id = $1`,
+		reservationID, ReservationStatusCommitted); err != nil {
+		return fmt.Errorf("failed to commit reservation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseReservation returns the stock held by a reservation to inventory.
+// Committed reservations can be released to undo a sale; releasing a
+// reservation that was already released or expired is a no-op.
+func (r *CatalogRepository) ReleaseReservation(reservationID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	status, err := lockReservation(tx, reservationID)
+	if err != nil {
+		return err
+	}
+	if status != ReservationStatusPending && status != ReservationStatusCommitted {
+		return nil
+	}
+
+	// Stock that was sold comes back as a return
+	reason := MovementRelease
+	if status == ReservationStatusCommitted {
+		reason = MovementReturn
+	}
+	if err := returnReservedStock(tx, reservationID, reason, ReservationStatusReleased); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ReleaseOrderReservation releases the reservation made for an order, like
+// ReleaseReservation. Orders without a reservation are a no-op.
+func (r *CatalogRepository) ReleaseOrderReservation(orderID string) error {
 	var reservationID string
-	err = tx.QueryRow(`
-		INSERT INTO inventory_reservations (order_id, product_id, quantity, expires_at)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id
-	`, orderID, productID, quantity, expiresAt).Scan(&reservationID)
+	err := r.db.QueryRow(`SELECT id FROM reservations WHERE order_id = $1`, orderID).Scan(&reservationID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to create reservation: %w", err)
+		return fmt.Errorf("failed to get order reservation: %w", err)
+	}
+
+	return r.ReleaseReservation(reservationID)
+}
+
+// ReleaseExpiredReservations returns the stock of up to limit pending
+// reservations whose expiry has passed and reports how many were released.
+func (r *CatalogRepository) ReleaseExpiredReservations(limit int) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id FROM reservations
+		WHERE status = $1 AND expires_at < NOW()
+		ORDER BY expires_at ASC
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`, ReservationStatusPending, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list expired reservations: %w", err)
+	}
+
+	var reservationIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan reservation: %w", err)
+		}
+		reservationIDs = append(reservationIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to iterate reservations: %w", err)
+	}
+
+	for _, id := range reservationIDs {
+		if err := returnReservedStock(tx, id, MovementRelease, ReservationStatusExpired); err != nil {
+			return 0, err
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
-		return "", fmt.Errorf("failed to commit transaction: %w", err)
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	return reservationID, nil
+	return len(reservationIDs), nil
+}
+
+func lockReservation(tx *sql.Tx, reservationID string) (string, error) {
+	var status string
+	err := tx.QueryRow(`SELECT status FROM reservations WHERE id = $1 FOR UPDATE`, reservationID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", ErrReservationNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get reservation: %w", err)
+	}
+	return status, nil
+}
+
+// returnReservedStock returns a reservation's stock to inventory with a
+// movement of reason for each of its lines and closes the reservation with
+// the given status.
+func returnReservedStock(tx *sql.Tx, reservationID, reason, status string) error {
+	if err := moveReservedStock(tx, reservationID, reason); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE reservations SET status = $2, updated_at = NOW() WHERE id = $1`, reservationID, status); err != nil {
+		return fmt.Errorf("failed to close reservation: %w", err)
+	}
+
+	return nil
 }
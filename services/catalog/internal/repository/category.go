@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrCategoryNotFound      = errors.New("category not found")
+	ErrDuplicateCategorySlug = errors.New("category slug is already in use")
+	ErrCategoryCycle         = errors.New("category cannot be moved below itself")
+	ErrCategoryNotEmpty      = errors.New("category has subcategories or products")
+)
+
+const categoryColumns = `id, name, slug, COALESCE(description, ''), parent_id, created_at`
+
+func scanCategory(row rowScanner) (*Category, error) {
+	cat := &Category{}
+	if err := row.Scan(&cat.ID, &cat.Name, &cat.Slug, &cat.Description, &cat.ParentID, &cat.CreatedAt); err != nil {
+		return nil, err
+	}
+	return cat, nil
+}
+
+func (r *CatalogRepository) GetCategory(id string) (*Category, error) {
+	cat, err := scanCategory(r.db.QueryRow(`SELECT `+categoryColumns+` FROM categories WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category: %w", err)
+	}
+
+	return cat, nil
+}
+
+// ListCategoryAncestors returns the path from the root category down to
+// the category with the given id, which is last.
+func (r *CatalogRepository) ListCategoryAncestors(id string) ([]*Category, error) {
+	rows, err := r.db.Query(`
+		WITH RECURSIVE path AS (
+			SELECT `+categoryColumns+`, 0 AS depth
+			FROM categories
+			WHERE id = $1
+			UNION
+			SELECT c.id, c.name, c.slug, COALESCE(c.description, ''), c.parent_id, c.created_at, p.depth + 1
+			FROM categories c
+			JOIN path p ON c.id = p.parent_id
+		)
+		SELECT id, name, slug, description, parent_id, created_at
+		FROM path
+		ORDER BY depth DESC
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list category ancestors: %w", err)
+	}
+	defer rows.Close()
+
+	var categories []*Category
+	for rows.Next() {
+		cat, err := scanCategory(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan category: %w", err)
+		}
+		categories = append(categories, cat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate categories: %w", err)
+	}
+
+	return categories, nil
+}
+
+func (r *CatalogRepository) CreateCategory(name, slug, description, parentID string) (*Category, error) {
+	cat, err := scanCategory(r.db.QueryRow(`
+		INSERT INTO categories (name, slug, description, parent_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+categoryColumns,
+		name, slug, description, nullString(parentID)))
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicateCategorySlug
+	}
+	if isForeignKeyViolation(err) {
+		return nil, fmt.Errorf("parent %w", ErrCategoryNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create category: %w", err)
+	}
+
+	return cat, nil
+}
+
+// UpdateCategory updates a category and moves it below parentID, or to the
+// top level if parentID is empty. Category changes are serialised so two
+// concurrent moves cannot form a cycle between them.
+func (r *CatalogRepository) UpdateCategory(id, name, slug, description, parentID string) (*Category, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockCategories(tx); err != nil {
+		return nil, err
+	}
+
+	if parentID != "" {
+		// Walk up from the new parent; reaching the category means the
+		// parent is the category itself or one of its subcategories
+		var cycle bool
+		if err := tx.QueryRow(`
+			WITH RECURSIVE ancestors AS (
+				SELECT id, parent_id FROM categories WHERE id = $1
+				UNION
+				SELECT c.id, c.parent_id
+				FROM categories c
+				JOIN ancestors a ON c.id = a.parent_id
+			)
+			SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)
+		`, parentID, id).Scan(&cycle); err != nil {
+			return nil, fmt.Errorf("failed to check category ancestors: %w", err)
+		}
+		if cycle {
+			return nil, ErrCategoryCycle
+		}
+	}
+
+	cat, err := scanCategory(tx.QueryRow(`
+		UPDATE categories
+		SET name = $2, slug = $3, description = $4, parent_id = $5
+		WHERE id = $1
+		RETURNING `+categoryColumns,
+		id, name, slug, description, nullString(parentID)))
+	if err == sql.ErrNoRows {
+		return nil, ErrCategoryNotFound
+	}
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicateCategorySlug
+	}
+	if isForeignKeyViolation(err) {
+		return nil, fmt.Errorf("parent %w", ErrCategoryNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update category: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return cat, nil
+}
+
+// DeleteCategory deletes a category that has no subcategories and no
+// products.
+func (r *CatalogRepository) DeleteCategory(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockCategories(tx); err != nil {
+		return err
+	}
+
+	var inUse bool
+	if err := tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM categories WHERE parent_id = $1)
+			OR EXISTS (SELECT 1 FROM products WHERE category_id = $1)
+	`, id).Scan(&inUse); err != nil {
+		return fmt.Errorf("failed to check category contents: %w", err)
+	}
+	if inUse {
+		return ErrCategoryNotEmpty
+	}
+
+	result, err := tx.Exec(`DELETE FROM categories WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete category: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to count deleted categories: %w", err)
+	}
+	if deleted == 0 {
+		return ErrCategoryNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// inCategorySubtree is a condition that column holds the category given by
+// the param placeholder or one of the categories below it.
+func inCategorySubtree(column, param string) string {
+	return column + ` IN (
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM categories WHERE id = ` + param + `
+			UNION
+			SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+		)
+		SELECT id FROM subtree
+	)`
+}
+
+// lockCategories blocks other category changes until tx ends, while still
+// letting categories be read.
+func lockCategories(tx *sql.Tx) error {
+	if _, err := tx.Exec(`LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return fmt.Errorf("failed to lock categories: %w", err)
+	}
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
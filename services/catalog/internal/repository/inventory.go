@@ -0,0 +1,421 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/safar/microservices-demo/shared/pagination"
+)
+
+// Reasons for inventory movements. Receipts, returns, damage and manual
+// adjustments change stock on hand. Reservations and releases change the
+// stock reserved for orders, and a sale takes reserved stock off hand.
+const (
+	MovementReceipt     = "receipt"
+	MovementSale        = "sale"
+	MovementReservation = "reservation"
+	MovementRelease     = "release"
+	MovementReturn      = "return"
+	MovementDamage      = "damage"
+	MovementAdjustment  = "adjustment"
+)
+
+var (
+	ErrWarehouseNotFound      = errors.New("warehouse not found")
+	ErrDuplicateWarehouseCode = errors.New("warehouse code is already in use")
+	ErrInsufficientStock      = errors.New("insufficient stock")
+)
+
+// Warehouse is a location stock is held at. Stock received without a
+// warehouse goes to the default one.
+type Warehouse struct {
+	ID        string
+	Code      string
+	Name      string
+	IsDefault bool
+	CreatedAt time.Time
+}
+
+// InventoryMovement is an entry of the inventory ledger: a change to the
+// stock of a product, or of one of its variants when VariantID is set, at
+// a warehouse. Reference names what caused it, such as an order ID.
+type InventoryMovement struct {
+	ID             int64
+	WarehouseID    string
+	ProductID      string
+	VariantID      sql.NullString
+	Reason         string
+	OnHandChange   int32
+	ReservedChange int32
+	Reference      sql.NullString
+	Note           sql.NullString
+	CreatedBy      sql.NullString
+	CreatedAt      time.Time
+}
+
+// InventoryLevel is the stock of a product, or of one of its variants, at
+// a warehouse, as the ledger adds up to.
+type InventoryLevel struct {
+	WarehouseID   string
+	WarehouseCode string
+	ProductID     string
+	VariantID     sql.NullString
+	OnHand        int32
+	Reserved      int32
+	UpdatedAt     time.Time
+}
+
+// Available returns the stock of the level that can be sold.
+func (l *InventoryLevel) Available() int32 {
+	return l.OnHand - l.Reserved
+}
+
+// MovementFilter narrows the inventory ledger. Zero values leave a filter
+// off.
+type MovementFilter struct {
+	ProductID   string
+	VariantID   string
+	WarehouseID string
+	Reason      string
+	Reference   string
+	Since       time.Time
+	Until       time.Time
+}
+
+// queryRower runs a query returning one row; *sql.DB and *sql.Tx are both
+// queryRowers.
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+const inventoryMovementColumns = `m.id, m.warehouse_id, m.product_id, m.variant_id, m.reason, m.on_hand_change,
+	m.reserved_change, m.reference, m.note, m.created_by, m.created_at`
+
+func scanInventoryMovement(row rowScanner) (*InventoryMovement, error) {
+	m := &InventoryMovement{}
+	if err := row.Scan(
+		&m.ID, &m.WarehouseID, &m.ProductID, &m.VariantID, &m.Reason, &m.OnHandChange,
+		&m.ReservedChange, &m.Reference, &m.Note, &m.CreatedBy, &m.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// recordMovement appends movement to the ledger, at the default warehouse
+// when it names none. The ledger's trigger applies it to the warehouse's
+// stock level and to the stock_quantity of its product or variant, and
+// fails it with ErrInsufficientStock if stock on hand would drop below
+// zero or below what is reserved.
+func recordMovement(q queryRower, movement InventoryMovement) (*InventoryMovement, error) {
+	warehouseID := sql.NullString{String: movement.WarehouseID, Valid: movement.WarehouseID != ""}
+	recorded, err := scanInventoryMovement(q.QueryRow(`
+		INSERT INTO inventory_movements AS m (warehouse_id, product_id, variant_id, reason, on_hand_change,
+			reserved_change, reference, note, created_by)
+		VALUES (COALESCE($1, (SELECT id FROM warehouses WHERE is_default)), $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+inventoryMovementColumns,
+		warehouseID, movement.ProductID, movement.VariantID, movement.Reason, movement.OnHandChange,
+		movement.ReservedChange, movement.Reference, movement.Note, movement.CreatedBy))
+	if isCheckViolation(err) {
+		return nil, ErrInsufficientStock
+	}
+	if isForeignKeyViolation(err) {
+		return nil, ErrWarehouseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record inventory movement: %w", err)
+	}
+	return recorded, nil
+}
+
+// receiveOpeningStock records the stock a product or variant is created
+// with as received at the default warehouse.
+func receiveOpeningStock(q queryRower, productID, variantID string, quantity int32) error {
+	if quantity <= 0 {
+		return nil
+	}
+	_, err := recordMovement(q, InventoryMovement{
+		ProductID:    productID,
+		VariantID:    sql.NullString{String: variantID, Valid: variantID != ""},
+		Reason:       MovementReceipt,
+		OnHandChange: quantity,
+		Note:         sql.NullString{String: "Opening stock", Valid: true},
+	})
+	return err
+}
+
+// AdjustStock records a movement of stock on hand.
+func (r *CatalogRepository) AdjustStock(movement InventoryMovement) (*InventoryMovement, error) {
+	return recordMovement(r.db, movement)
+}
+
+// ListInventoryMovements returns a page of the ledger entries filter
+// matches, newest first.
+func (r *CatalogRepository) ListInventoryMovements(filter MovementFilter, page pagination.Page) ([]*InventoryMovement, pagination.Result, error) {
+	f := &searchFilter{}
+	if filter.ProductID != "" {
+		f.conditions = append(f.conditions, "m.product_id = "+f.arg(filter.ProductID))
+	}
+	if filter.VariantID != "" {
+		f.conditions = append(f.conditions, "m.variant_id = "+f.arg(filter.VariantID))
+	}
+	if filter.WarehouseID != "" {
+		f.conditions = append(f.conditions, "m.warehouse_id = "+f.arg(filter.WarehouseID))
+	}
+	if filter.Reason != "" {
+		f.conditions = append(f.conditions, "m.reason = "+f.arg(filter.Reason))
+	}
+	if filter.Reference != "" {
+		f.conditions = append(f.conditions, "m.reference = "+f.arg(filter.Reference))
+	}
+	if !filter.Since.IsZero() {
+		f.conditions = append(f.conditions, "m.created_at >= "+f.arg(filter.Since))
+	}
+	if !filter.Until.IsZero() {
+		f.conditions = append(f.conditions, "m.created_at < "+f.arg(filter.Until))
+	}
+
+	result, err := pagination.Count(r.db, page, `FROM inventory_movements m`+f.where(), f.args...)
+	if err != nil {
+		return nil, pagination.Result{}, fmt.Errorf("failed to count inventory movements: %w", err)
+	}
+
+	if condition, args := page.Condition("m.created_at", "m.id", len(f.args)+1); condition != "" {
+		f.conditions = append(f.conditions, condition)
+		f.args = append(f.args, args...)
+	}
+
+	query := `SELECT ` + inventoryMovementColumns + ` FROM inventory_movements m` + f.where()
+	query += fmt.Sprintf(" ORDER BY m.created_at DESC, m.id DESC LIMIT %s OFFSET %s", f.arg(page.Limit()), f.arg(page.Offset()))
+
+	rows, err := r.db.Query(query, f.args...)
+	if err != nil {
+		return nil, pagination.Result{}, fmt.Errorf("failed to list inventory movements: %w", err)
+	}
+	defer rows.Close()
+
+	var movements []*InventoryMovement
+	for rows.Next() {
+		movement, err := scanInventoryMovement(rows)
+		if err != nil {
+			return nil, pagination.Result{}, fmt.Errorf("failed to scan inventory movement: %w", err)
+		}
+		movements = append(movements, movement)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, pagination.Result{}, fmt.Errorf("failed to iterate inventory movements: %w", err)
+	}
+
+	movements, result.Next = pagination.Trim(page, movements, func(m *InventoryMovement) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: m.CreatedAt, ID: strconv.FormatInt(m.ID, 10)}
+	})
+	return movements, result, nil
+}
+
+// ListInventoryLevels returns the stock of a product and its variants at
+// every warehouse holding or having held any, by warehouse code.
+func (r *CatalogRepository) ListInventoryLevels(productID string) ([]*InventoryLevel, error) {
+	rows, err := r.db.Query(`
+		SELECT l.warehouse_id, w.code, l.product_id, l.variant_id, l.on_hand, l.reserved, l.updated_at
+		FROM inventory_levels l
+		JOIN warehouses w ON w.id = l.warehouse_id
+		WHERE l.product_id = $1
+		ORDER BY w.code, l.variant_id NULLS FIRST
+	`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inventory levels: %w", err)
+	}
+	defer rows.Close()
+
+	var levels []*InventoryLevel
+	for rows.Next() {
+		level := &InventoryLevel{}
+		if err := rows.Scan(
+			&level.WarehouseID, &level.WarehouseCode, &level.ProductID, &level.VariantID,
+			&level.OnHand, &level.Reserved, &level.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan inventory level: %w", err)
+		}
+		levels = append(levels, level)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate inventory levels: %w", err)
+	}
+
+	return levels, nil
+}
+
+func (r *CatalogRepository) CreateWarehouse(code, name string) (*Warehouse, error) {
+	warehouse := &Warehouse{}
+	err := r.db.QueryRow(`
+		INSERT INTO warehouses (code, name)
+		VALUES ($1, $2)
+		RETURNING id, code, name, is_default, created_at
+	`, code, name).Scan(&warehouse.ID, &warehouse.Code, &warehouse.Name, &warehouse.IsDefault, &warehouse.CreatedAt)
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicateWarehouseCode
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create warehouse: %w", err)
+	}
+	return warehouse, nil
+}
+
+// ListWarehouses returns every warehouse, the default one first.
+func (r *CatalogRepository) ListWarehouses() ([]*Warehouse, error) {
+	rows, err := r.db.Query(`
+		SELECT id, code, name, is_default, created_at
+		FROM warehouses
+		ORDER BY is_default DESC, code
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list warehouses: %w", err)
+	}
+	defer rows.Close()
+
+	var warehouses []*Warehouse
+	for rows.Next() {
+		warehouse := &Warehouse{}
+		if err := rows.Scan(&warehouse.ID, &warehouse.Code, &warehouse.Name, &warehouse.IsDefault, &warehouse.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan warehouse: %w", err)
+		}
+		warehouses = append(warehouses, warehouse)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate warehouses: %w", err)
+	}
+
+	return warehouses, nil
+}
+
+// reserveStock reserves quantity of a product or variant for an order,
+// taking it from the warehouses with the most available first so orders
+// are split across as few as possible.
+func reserveStock(tx *sql.Tx, reservationID, orderID string, key InventoryKey, quantity int32, expiresAt time.Time) error {
+	variantID := sql.NullString{String: key.VariantID, Valid: key.VariantID != ""}
+	if variantID.Valid {
+		var active bool
+		err := tx.QueryRow(`
+			SELECT is_active FROM product_variants WHERE id = $1 AND product_id = $2
+		`, key.VariantID, key.ProductID).Scan(&active)
+		if err == sql.ErrNoRows || (err == nil && !active) {
+			return fmt.Errorf("%w: %s", ErrVariantNotFound, key.VariantID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check variant: %w", err)
+		}
+	}
+
+	rows, err := tx.Query(`
+		SELECT warehouse_id, on_hand - reserved
+		FROM inventory_levels
+		WHERE product_id = $1 AND variant_id IS NOT DISTINCT FROM $2 AND on_hand > reserved
+		ORDER BY warehouse_id
+		FOR UPDATE
+	`, key.ProductID, variantID)
+	if err != nil {
+		return fmt.Errorf("failed to check stock: %w", err)
+	}
+
+	type allocation struct {
+		warehouseID string
+		available   int32
+	}
+	var allocations []allocation
+	var available int32
+	for rows.Next() {
+		var a allocation
+		if err := rows.Scan(&a.warehouseID, &a.available); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan stock: %w", err)
+		}
+		allocations = append(allocations, a)
+		available += a.available
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate stock: %w", err)
+	}
+
+	if available < quantity {
+		if variantID.Valid {
+			return fmt.Errorf("%w for variant %s", ErrInsufficientStock, key.VariantID)
+		}
+		return fmt.Errorf("%w for product %s", ErrInsufficientStock, key.ProductID)
+	}
+
+	// Rows are locked by warehouse ID so concurrent reservations can't
+	// deadlock, then taken from the most available first
+	sort.SliceStable(allocations, func(i, j int) bool {
+		return allocations[i].available > allocations[j].available
+	})
+
+	remaining := quantity
+	for _, a := range allocations {
+		if remaining == 0 {
+			break
+		}
+		take := min(a.available, remaining)
+		remaining -= take
+
+		if _, err := recordMovement(tx, InventoryMovement{
+			WarehouseID:    a.warehouseID,
+			ProductID:      key.ProductID,
+			VariantID:      variantID,
+			Reason:         MovementReservation,
+			ReservedChange: take,
+			Reference:      sql.NullString{String: orderID, Valid: true},
+		}); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`
+			INSERT INTO inventory_reservations (reservation_id, order_id, product_id, variant_id, warehouse_id, quantity, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, reservationID, orderID, key.ProductID, variantID, a.warehouseID, take, expiresAt); err != nil {
+			return fmt.Errorf("failed to create reservation item: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// reservedStockChanges are the changes to stock on hand and reserved, per
+// unit, of the movements that close a reservation.
+var reservedStockChanges = map[string]struct{ onHand, reserved int32 }{
+	// A sale ships reserved stock
+	MovementSale: {onHand: -1, reserved: -1},
+	// A release returns reserved stock to what is available
+	MovementRelease: {onHand: 0, reserved: -1},
+	// A return puts sold stock back on hand
+	MovementReturn: {onHand: 1, reserved: 0},
+}
+
+// moveReservedStock records a movement with reason for every line of a
+// reservation, at the warehouse the line holds stock at.
+func moveReservedStock(tx *sql.Tx, reservationID, reason string) error {
+	changes := reservedStockChanges[reason]
+	if _, err := tx.Exec(`
+		INSERT INTO inventory_movements (warehouse_id, product_id, variant_id, reason, on_hand_change, reserved_change, reference)
+		SELECT warehouse_id, product_id, variant_id, $2, quantity * $3, quantity * $4, order_id::TEXT
+		FROM inventory_reservations
+		WHERE reservation_id = $1 AND quantity > 0
+		ORDER BY warehouse_id, product_id, variant_id NULLS FIRST
+	`, reservationID, reason, changes.onHand, changes.reserved); err != nil {
+		if isCheckViolation(err) {
+			return fmt.Errorf("%w: reservation %s", ErrInsufficientStock, reservationID)
+		}
+		return fmt.Errorf("failed to record %s of reservation: %w", reason, err)
+	}
+	return nil
+}
+
+func isCheckViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23514"
+}
@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// ProductRecord is a product as it is imported and exported, naming its
+// category by slug.
+type ProductRecord struct {
+	Slug          string
+	Name          string
+	Description   string
+	PriceCents    int64
+	Currency      string
+	CategorySlug  string
+	ImageURLs     []string
+	StockQuantity int32
+	WeightGrams   int32
+	IsActive      bool
+}
+
+// UpsertProduct creates the product of record, or updates the product with
+// its slug, reporting whether it was created and the stock it has.
+// categoryID is the id of the record's category, or empty for none. The
+// record's stock is received at the default warehouse for products it
+// creates; the stock of existing products only changes through the
+// inventory ledger, so it is returned for the caller to compare.
+func (r *CatalogRepository) UpsertProduct(record ProductRecord, categoryID string) (bool, int32, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id string
+	var created bool
+	var stockQuantity int32
+	err = tx.QueryRow(`
+		INSERT INTO products (slug, name, description, price_cents, currency, category_id, image_urls, weight_grams, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (slug) DO UPDATE
+		SET name = EXCLUDED.name,
+			description = EXCLUDED.description,
+			price_cents = EXCLUDED.price_cents,
+			currency = EXCLUDED.currency,
+			category_id = EXCLUDED.category_id,
+			image_urls = EXCLUDED.image_urls,
+			weight_grams = EXCLUDED.weight_grams,
+			is_active = EXCLUDED.is_active,
+			updated_at = NOW()
+		RETURNING id, xmax = 0, stock_quantity
+	`, record.Slug, record.Name, record.Description, record.PriceCents, record.Currency, nullString(categoryID),
+		pq.Array(record.ImageURLs), record.WeightGrams, record.IsActive).Scan(&id, &created, &stockQuantity)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to upsert product: %w", err)
+	}
+
+	if created {
+		if err := receiveOpeningStock(tx, id, "", record.StockQuantity); err != nil {
+			return false, 0, err
+		}
+		stockQuantity = record.StockQuantity
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return created, stockQuantity, nil
+}
+
+// ExistingProductStock returns the stock of each of slugs that is in use by
+// a product.
+func (r *CatalogRepository) ExistingProductStock(slugs []string) (map[string]int32, error) {
+	rows, err := r.db.Query(`SELECT slug, stock_quantity FROM products WHERE slug = ANY($1)`, pq.Array(slugs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up product slugs: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]int32)
+	for rows.Next() {
+		var slug string
+		var stockQuantity int32
+		if err := rows.Scan(&slug, &stockQuantity); err != nil {
+			return nil, fmt.Errorf("failed to scan product slug: %w", err)
+		}
+		existing[slug] = stockQuantity
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate product slugs: %w", err)
+	}
+
+	return existing, nil
+}
+
+// ExportProducts calls fn with each product, ordered by slug, stopping at
+// the first error fn returns. categoryID and activeOnly filter the
+// products as they do for ListProducts.
+func (r *CatalogRepository) ExportProducts(categoryID string, includeDescendants, activeOnly bool, fn func(*ProductRecord) error) error {
+	f := &searchFilter{}
+	if categoryID != "" {
+		if includeDescendants {
+			f.conditions = append(f.conditions, inCategorySubtree("p.category_id", f.arg(categoryID)))
+		} else {
+			f.conditions = append(f.conditions, "p.category_id = "+f.arg(categoryID))
+		}
+	}
+	if activeOnly {
+		f.conditions = append(f.conditions, "p.is_active = true")
+	}
+
+	rows, err := r.db.Query(`
+		SELECT p.slug, p.name, COALESCE(p.description, ''), p.price_cents, p.currency, COALESCE(c.slug, ''),
+			p.image_urls, p.stock_quantity, p.weight_grams, p.is_active
+		FROM products p
+		LEFT JOIN categories c ON c.id = p.category_id`+f.where()+`
+		ORDER BY p.slug ASC
+	`, f.args...)
+	if err != nil {
+		return fmt.Errorf("failed to export products: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		record := &ProductRecord{}
+		if err := rows.Scan(
+			&record.Slug, &record.Name, &record.Description, &record.PriceCents, &record.Currency, &record.CategorySlug,
+			pq.Array(&record.ImageURLs), &record.StockQuantity, &record.WeightGrams, &record.IsActive,
+		); err != nil {
+			return fmt.Errorf("failed to scan product: %w", err)
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate products: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of price history entries.
+const (
+	PriceChangeList      = "list"
+	PriceChangeScheduled = "scheduled"
+)
+
+var (
+	ErrPriceNotFound = errors.New("scheduled price not found")
+	ErrPriceEnded    = errors.New("scheduled price has already ended")
+	ErrPriceOverlap  = errors.New("scheduled price overlaps another scheduled price of the product")
+)
+
+// ProductPrice is a price a product sells at instead of its list price,
+// from StartsAt until EndsAt, or with no end when EndsAt is not set. It
+// only applies while its currency is the product's.
+type ProductPrice struct {
+	ID             string
+	ProductID      string
+	PriceCents     int64
+	CompareAtCents sql.NullInt64
+	Currency       string
+	StartsAt       time.Time
+	EndsAt         sql.NullTime
+	CreatedAt      time.Time
+}
+
+// PriceHistoryEntry is a price a product was or is set to sell at, from
+// EffectiveFrom until EffectiveUntil, or still when it is not set.
+type PriceHistoryEntry struct {
+	Kind           string
+	PriceCents     int64
+	CompareAtCents sql.NullInt64
+	Currency       string
+	EffectiveFrom  time.Time
+	EffectiveUntil sql.NullTime
+}
+
+// activePriceCondition keeps the scheduled prices pp in effect now for
+// product p. The product_prices exclusion constraint keeps it to one.
+const activePriceCondition = `pp.product_id = p.id AND pp.currency = p.currency
+	AND pp.starts_at <= NOW() AND (pp.ends_at IS NULL OR pp.ends_at > NOW())`
+
+// effectivePriceCents is what product p sells at now, for filtering and
+// sorting by price.
+const effectivePriceCents = `COALESCE((SELECT pp.price_cents FROM product_prices pp WHERE ` + activePriceCondition + `), p.price_cents)`
+
+const productPriceColumns = `pp.id, pp.product_id, pp.price_cents, pp.compare_at_cents, pp.currency,
+	pp.starts_at, pp.ends_at, pp.created_at`
+
+func scanProductPrice(row rowScanner) (*ProductPrice, error) {
+	price := &ProductPrice{}
+	if err := row.Scan(
+		&price.ID, &price.ProductID, &price.PriceCents, &price.CompareAtCents, &price.Currency,
+		&price.StartsAt, &price.EndsAt, &price.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return price, nil
+}
+
+// CreateProductPrice schedules a price for productID in its currency.
+func (r *CatalogRepository) CreateProductPrice(productID string, priceCents int64, compareAtCents sql.NullInt64, startsAt time.Time, endsAt sql.NullTime) (*ProductPrice, error) {
+	price, err := scanProductPrice(r.db.QueryRow(`
+		INSERT INTO product_prices AS pp (product_id, price_cents, compare_at_cents, currency, starts_at, ends_at)
+		SELECT id, $2, $3, currency, $4, $5 FROM products WHERE id = $1
+		RETURNING `+productPriceColumns,
+		productID, priceCents, compareAtCents, startsAt, endsAt))
+	if err == sql.ErrNoRows {
+		return nil, ErrProductNotFound
+	}
+	if isExclusionViolation(err) {
+		return nil, ErrPriceOverlap
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scheduled price: %w", err)
+	}
+	return price, nil
+}
+
+// ListProductPrices returns every scheduled price of productID, latest
+// start first.
+func (r *CatalogRepository) ListProductPrices(productID string) ([]*ProductPrice, error) {
+	rows, err := r.db.Query(`
+		SELECT `+productPriceColumns+`
+		FROM product_prices pp
+		WHERE pp.product_id = $1
+		ORDER BY pp.starts_at DESC
+	`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled prices: %w", err)
+	}
+	defer rows.Close()
+
+	var prices []*ProductPrice
+	for rows.Next() {
+		price, err := scanProductPrice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled price: %w", err)
+		}
+		prices = append(prices, price)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate scheduled prices: %w", err)
+	}
+
+	return prices, nil
+}
+
+// ActiveProductPrices returns the scheduled price in effect now for each
+// of productIDs that has one, keyed by product ID.
+func (r *CatalogRepository) ActiveProductPrices(productIDs []string) (map[string]*ProductPrice, error) {
+	prices := make(map[string]*ProductPrice)
+	if len(productIDs) == 0 {
+		return prices, nil
+	}
+
+	rows, err := r.db.Query(`
+		SELECT `+productPriceColumns+`
+		FROM product_prices pp
+		JOIN products p ON p.id = pp.product_id
+		WHERE pp.product_id = ANY($1) AND `+activePriceCondition,
+		pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduled prices: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		price, err := scanProductPrice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled price: %w", err)
+		}
+		prices[price.ProductID] = price
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate scheduled prices: %w", err)
+	}
+
+	return prices, nil
+}
+
+// CancelProductPrice deletes a scheduled price that has not started, or
+// ends one in effect now. Prices that have ended are kept for the price
+// history.
+func (r *CatalogRepository) CancelProductPrice(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var started, ended bool
+	err = tx.QueryRow(`
+		SELECT starts_at < NOW(), ends_at IS NOT NULL AND ends_at <= NOW()
+		FROM product_prices
+		WHERE id = $1
+		FOR UPDATE
+	`, id).Scan(&started, &ended)
+	if err == sql.ErrNoRows {
+		return ErrPriceNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock scheduled price: %w", err)
+	}
+
+	switch {
+	case ended:
+		return ErrPriceEnded
+	case started:
+		_, err = tx.Exec(`UPDATE product_prices SET ends_at = NOW() WHERE id = $1`, id)
+	default:
+		_, err = tx.Exec(`DELETE FROM product_prices WHERE id = $1`, id)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to cancel scheduled price: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// PriceHistory returns every list price productID was set to and every
+// scheduled price of it that has started, latest first.
+func (r *CatalogRepository) PriceHistory(productID string) ([]PriceHistoryEntry, error) {
+	rows, err := r.db.Query(`
+		SELECT 'list', price_cents, NULL::BIGINT, currency, effective_from,
+			LEAD(effective_from) OVER (ORDER BY effective_from, id)
+		FROM product_price_history
+		WHERE product_id = $1
+		UNION ALL
+		SELECT 'scheduled', price_cents, compare_at_cents, currency, starts_at, ends_at
+		FROM product_prices
+		WHERE product_id = $1 AND starts_at <= NOW()
+		ORDER BY 5 DESC
+	`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price history: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []PriceHistoryEntry
+	for rows.Next() {
+		var entry PriceHistoryEntry
+		if err := rows.Scan(
+			&entry.Kind, &entry.PriceCents, &entry.CompareAtCents, &entry.Currency,
+			&entry.EffectiveFrom, &entry.EffectiveUntil,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan price history: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate price history: %w", err)
+	}
+
+	return entries, nil
+}
+
+func isExclusionViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23P01"
+}
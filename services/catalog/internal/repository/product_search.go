@@ -0,0 +1,294 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Search sort orders.
+const (
+	SearchSortRelevance = "relevance"
+	SearchSortPriceAsc  = "price_asc"
+	SearchSortPriceDesc = "price_desc"
+	SearchSortNewest    = "newest"
+	SearchSortRating    = "rating"
+)
+
+// PriceFacetBounds are the lower bounds, in cents, of every price facet
+// above the first, which starts at 0.
+var PriceFacetBounds = []int64{2500, 5000, 10000, 20000}
+
+// ProductSearch is a product search with its filters. Zero values leave a
+// filter off.
+type ProductSearch struct {
+	Query              string
+	CategoryID         string
+	IncludeDescendants bool
+	MinPriceCents      int64
+	MaxPriceCents      int64
+	InStockOnly        bool
+	// Attributes are variant options, such as size, that one active
+	// variant of the product must all have.
+	Attributes map[string]string
+	Sort       string
+	Limit      int
+	Offset     int
+}
+
+// SearchFacets counts the products a search matches per category and per
+// price range.
+type SearchFacets struct {
+	Categories  []CategoryFacet
+	PriceRanges []PriceFacet
+}
+
+type CategoryFacet struct {
+	CategoryID string
+	Name       string
+	Count      int64
+}
+
+// PriceFacet counts products priced from MinCents up to, but not including,
+// MaxCents. A MaxCents of 0 means no upper bound.
+type PriceFacet struct {
+	MinCents int64
+	MaxCents int64
+	Count    int64
+}
+
+// Facet dimensions a search filter can leave out.
+const (
+	facetCategory = "category"
+	facetPrice    = "price"
+)
+
+// searchFilter builds the WHERE clause of a search, numbering parameters
+// as they are added.
+type searchFilter struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (f *searchFilter) arg(value interface{}) string {
+	f.args = append(f.args, value)
+	return fmt.Sprintf("$%d", len(f.args))
+}
+
+func (f *searchFilter) where() string {
+	if len(f.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conditions, " AND ")
+}
+
+// filter returns the conditions of search, leaving out the filter of the
+// facet dimension skip so its facet counts every value.
+func (s ProductSearch) filter(skip string) (*searchFilter, error) {
+	f := &searchFilter{}
+
+	if s.Query != "" {
+		// <% matches names containing a word similar to the query, so
+		// misspelt queries still find products
+		q := f.arg(s.Query)
+		pattern := f.arg("%" + s.Query + "%")
+		f.conditions = append(f.conditions, fmt.Sprintf(
+			"(p.name ILIKE %[2]s OR p.description ILIKE %[2]s OR %[1]s <%% p.name)", q, pattern))
+	}
+
+	if s.CategoryID != "" && skip != facetCategory {
+		if s.IncludeDescendants {
+			f.conditions = append(f.conditions, inCategorySubtree("p.category_id", f.arg(s.CategoryID)))
+		} else {
+			f.conditions = append(f.conditions, "p.category_id = "+f.arg(s.CategoryID))
+		}
+	}
+
+	if skip != facetPrice {
+		if s.MinPriceCents > 0 {
+			f.conditions = append(f.conditions, effectivePriceCents+" >= "+f.arg(s.MinPriceCents))
+		}
+		if s.MaxPriceCents > 0 {
+			f.conditions = append(f.conditions, effectivePriceCents+" <= "+f.arg(s.MaxPriceCents))
+		}
+	}
+
+	if s.InStockOnly {
+		// Products with variants are in stock when any variant is
+		f.conditions = append(f.conditions, `CASE
+			WHEN EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.id AND v.is_active)
+			THEN EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.id AND v.is_active AND v.stock_quantity > 0)
+			ELSE p.stock_quantity > 0
+		END`)
+	}
+
+	if len(s.Attributes) > 0 {
+		attributes, err := json.Marshal(s.Attributes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode attributes: %w", err)
+		}
+		f.conditions = append(f.conditions, fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.id AND v.is_active AND v.options @> %s::jsonb)",
+			f.arg(string(attributes))))
+	}
+
+	return f, nil
+}
+
+// SearchProducts returns a page of the products search matches, how many
+// it matches in total, and its facet counts.
+func (r *CatalogRepository) SearchProducts(search ProductSearch) ([]*Product, int, *SearchFacets, error) {
+	f, err := search.filter("")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	var totalCount int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM products p`+f.where(), f.args...).Scan(&totalCount); err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	query := `
+		SELECT p.id, p.name, p.slug, COALESCE(p.description, ''), p.price_cents, p.currency, p.category_id, p.image_urls,
+			p.stock_quantity, p.weight_grams, p.reorder_threshold, p.rating_average, p.rating_count, p.is_active, p.created_at, p.updated_at
+		FROM products p` + f.where() + " ORDER BY " + searchOrder(search, f)
+	query += fmt.Sprintf(" LIMIT %s OFFSET %s", f.arg(search.Limit), f.arg(search.Offset))
+
+	rows, err := r.db.Query(query, f.args...)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to search products: %w", err)
+	}
+	defer rows.Close()
+
+	var products []*Product
+	for rows.Next() {
+		product := &Product{}
+		if err := rows.Scan(
+			&product.ID, &product.Name, &product.Slug, &product.Description, &product.PriceCents,
+			&product.Currency, &product.CategoryID, pq.Array(&product.ImageURLs), &product.StockQuantity,
+			&product.WeightGrams, &product.ReorderThreshold, &product.RatingAverage, &product.RatingCount, &product.IsActive, &product.CreatedAt, &product.UpdatedAt,
+		); err != nil {
+			return nil, 0, nil, fmt.Errorf("failed to scan product: %w", err)
+		}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, nil, fmt.Errorf("failed to iterate search results: %w", err)
+	}
+
+	facets := &SearchFacets{}
+	if facets.Categories, err = r.searchCategoryFacets(search); err != nil {
+		return nil, 0, nil, err
+	}
+	if facets.PriceRanges, err = r.searchPriceFacets(search); err != nil {
+		return nil, 0, nil, err
+	}
+
+	return products, totalCount, facets, nil
+}
+
+// searchOrder returns the ORDER BY expression of search. Relevance weighs
+// how closely the name matches the query above the description, and falls
+// back to newest first when there is no query.
+func searchOrder(search ProductSearch, f *searchFilter) string {
+	if search.Sort == SearchSortRelevance && search.Query != "" {
+		q := f.arg(search.Query)
+		return fmt.Sprintf(
+			"(2 * word_similarity(%[1]s, p.name) + word_similarity(%[1]s, COALESCE(p.description, ''))) DESC, p.created_at DESC, p.id ASC", q)
+	}
+	return productOrder(search.Sort)
+}
+
+// productOrder returns the ORDER BY expression of a sort that does not
+// depend on a query, listing newest first for any other sort. Newest first
+// matches the (created_at, id) order that page tokens continue from.
+func productOrder(sort string) string {
+	switch sort {
+	case SearchSortPriceAsc:
+		return effectivePriceCents + " ASC, p.id ASC"
+	case SearchSortPriceDesc:
+		return effectivePriceCents + " DESC, p.id ASC"
+	case SearchSortRating:
+		return "p.rating_average DESC, p.rating_count DESC, p.id ASC"
+	}
+	return "p.created_at DESC, p.id DESC"
+}
+
+func (r *CatalogRepository) searchCategoryFacets(search ProductSearch) ([]CategoryFacet, error) {
+	f, err := search.filter(facetCategory)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(`
+		SELECT c.id, c.name, COUNT(*)
+		FROM products p
+		JOIN categories c ON c.id = p.category_id`+f.where()+`
+		GROUP BY c.id, c.name
+		ORDER BY COUNT(*) DESC, c.name ASC
+	`, f.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count category facets: %w", err)
+	}
+	defer rows.Close()
+
+	var facets []CategoryFacet
+	for rows.Next() {
+		var facet CategoryFacet
+		if err := rows.Scan(&facet.CategoryID, &facet.Name, &facet.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan category facet: %w", err)
+		}
+		facets = append(facets, facet)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate category facets: %w", err)
+	}
+
+	return facets, nil
+}
+
+// searchPriceFacets counts results in every price range of
+// PriceFacetBounds, including empty ones.
+func (r *CatalogRepository) searchPriceFacets(search ProductSearch) ([]PriceFacet, error) {
+	f, err := search.filter(facetPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := f.arg(pq.Array(PriceFacetBounds))
+	rows, err := r.db.Query(`
+		SELECT width_bucket(`+effectivePriceCents+`, `+bounds+`::bigint[]) AS bucket, COUNT(*)
+		FROM products p`+f.where()+`
+		GROUP BY bucket
+	`, f.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count price facets: %w", err)
+	}
+	defer rows.Close()
+
+	facets := make([]PriceFacet, len(PriceFacetBounds)+1)
+	for i := range facets {
+		if i > 0 {
+			facets[i].MinCents = PriceFacetBounds[i-1]
+		}
+		if i < len(PriceFacetBounds) {
+			facets[i].MaxCents = PriceFacetBounds[i]
+		}
+	}
+
+	for rows.Next() {
+		var bucket int
+		var count int64
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan price facet: %w", err)
+		}
+		facets[bucket].Count = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate price facets: %w", err)
+	}
+
+	return facets, nil
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type ProductSuggestion struct {
+	ID       string
+	Name     string
+	Slug     string
+	ImageURL string
+}
+
+// QuerySuggestion is a logged search query and how often it was searched.
+type QuerySuggestion struct {
+	Query       string
+	SearchCount int64
+}
+
+// likeEscaper escapes the wildcards of LIKE so typed text matches
+// literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchQueryCount is how often a normalised query was searched since it
+// was last logged, and how many products its latest search found.
+type SearchQueryCount struct {
+	Query       string
+	Searches    int64
+	ResultCount int
+}
+
+// LogSearchQueries adds a batch of search counts to the query log in one
+// statement. Each query must appear in the batch at most once.
+func (r *CatalogRepository) LogSearchQueries(counts []SearchQueryCount) error {
+	queries := make([]string, len(counts))
+	searches := make([]int64, len(counts))
+	results := make([]int64, len(counts))
+	for i, count := range counts {
+		queries[i] = count.Query
+		searches[i] = count.Searches
+		results[i] = int64(count.ResultCount)
+	}
+
+	_, err := r.db.Exec(`
+		INSERT INTO search_queries (query, search_count, result_count, last_searched_at)
+		SELECT q.query, q.searches, q.results, NOW()
+		FROM unnest($1::text[], $2::bigint[], $3::int[]) AS q(query, searches, results)
+		ON CONFLICT (query) DO UPDATE
+		SET search_count = search_queries.search_count + EXCLUDED.search_count,
+			result_count = EXCLUDED.result_count,
+			last_searched_at = NOW()
+	`, pq.Array(queries), pq.Array(searches), pq.Array(results))
+	if err != nil {
+		return fmt.Errorf("failed to log search queries: %w", err)
+	}
+	return nil
+}
+
+// SuggestProducts returns active products whose name starts with prefix,
+// has a word starting with it, or has a word similar to it. Names starting
+// with prefix come first, then the closest matches.
+func (r *CatalogRepository) SuggestProducts(ctx context.Context, prefix string, limit int) ([]*ProductSuggestion, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, name, slug, COALESCE(image_urls[1], '')
+		FROM products
+		WHERE is_active
+			AND (name ILIKE $2 || '%' OR name ILIKE '% ' || $2 || '%' OR $1 <% name)
+		ORDER BY name ILIKE $2 || '%' DESC, word_similarity($1, name) DESC, name ASC
+		LIMIT $3
+	`, prefix, likeEscaper.Replace(prefix), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest products: %w", err)
+	}
+	defer rows.Close()
+
+	var suggestions []*ProductSuggestion
+	for rows.Next() {
+		s := &ProductSuggestion{}
+		if err := rows.Scan(&s.ID, &s.Name, &s.Slug, &s.ImageURL); err != nil {
+			return nil, fmt.Errorf("failed to scan product suggestion: %w", err)
+		}
+		suggestions = append(suggestions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate product suggestions: %w", err)
+	}
+
+	return suggestions, nil
+}
+
+// SuggestCategories returns categories matching prefix the way
+// SuggestProducts matches product names.
+func (r *CatalogRepository) SuggestCategories(ctx context.Context, prefix string, limit int) ([]*Category, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+categoryColumns+`
+		FROM categories
+		WHERE name ILIKE $2 || '%' OR name ILIKE '% ' || $2 || '%' OR $1 <% name
+		ORDER BY name ILIKE $2 || '%' DESC, word_similarity($1, name) DESC, name ASC
+		LIMIT $3
+	`, prefix, likeEscaper.Replace(prefix), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest categories: %w", err)
+	}
+	defer rows.Close()
+
+	var categories []*Category
+	for rows.Next() {
+		cat, err := scanCategory(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan category: %w", err)
+		}
+		categories = append(categories, cat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate categories: %w", err)
+	}
+
+	return categories, nil
+}
+
+// SuggestQueries returns logged queries that found products and start
+// with or are similar to prefix. Queries starting with prefix come first;
+// within each group, closeness to prefix is weighted by how often the
+// query was searched, so popular searches rise to the top.
+func (r *CatalogRepository) SuggestQueries(ctx context.Context, prefix string, limit int) ([]*QuerySuggestion, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT query, search_count
+		FROM search_queries
+		WHERE result_count > 0
+			AND (query LIKE $2 || '%' OR $1 <% query)
+		ORDER BY query LIKE $2 || '%' DESC, word_similarity($1, query) * ln(search_count + 2) DESC, query ASC
+		LIMIT $3
+	`, prefix, likeEscaper.Replace(prefix), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest queries: %w", err)
+	}
+	defer rows.Close()
+
+	var suggestions []*QuerySuggestion
+	for rows.Next() {
+		s := &QuerySuggestion{}
+		if err := rows.Scan(&s.Query, &s.SearchCount); err != nil {
+			return nil, fmt.Errorf("failed to scan query suggestion: %w", err)
+		}
+		suggestions = append(suggestions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate query suggestions: %w", err)
+	}
+
+	return suggestions, nil
+}
@@ -0,0 +1,323 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrVariantNotFound = errors.New("variant not found")
+	ErrDuplicateSKU    = errors.New("SKU is already in use")
+)
+
+// ProductOption is an option type a product's variants differ in, such as
+// size, with the values it can take.
+type ProductOption struct {
+	Name   string
+	Values []string
+}
+
+// ProductVariant is a sellable SKU of a product, stocked on its own.
+// PriceCents and Currency are the variant's own price when PriceOverride is
+// set and its product's price otherwise. Empty ImageURLs mean the product's
+// images are used.
+type ProductVariant struct {
+	ID            string
+	ProductID     string
+	SKU           string
+	Options       map[string]string
+	PriceCents    int64
+	Currency      string
+	PriceOverride bool
+	StockQuantity int32
+	ImageURLs     []string
+	IsActive      bool
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+const productVariantColumns = `v.id, v.product_id, v.sku, v.options,
+	COALESCE(v.price_cents, p.price_cents), COALESCE(v.currency, p.currency), v.price_cents IS NOT NULL,
+	v.stock_quantity, v.image_urls, v.is_active, v.created_at, v.updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanProductVariant(row rowScanner) (*ProductVariant, error) {
+	variant := &ProductVariant{}
+	var options []byte
+	if err := row.Scan(
+		&variant.ID, &variant.ProductID, &variant.SKU, &options,
+		&variant.PriceCents, &variant.Currency, &variant.PriceOverride,
+		&variant.StockQuantity, pq.Array(&variant.ImageURLs), &variant.IsActive,
+		&variant.CreatedAt, &variant.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(options, &variant.Options); err != nil {
+		return nil, fmt.Errorf("failed to decode variant options: %w", err)
+	}
+
+	return variant, nil
+}
+
+// ListProductOptions returns a product's option types in the order they
+// were set.
+func (r *CatalogRepository) ListProductOptions(productID string) ([]ProductOption, error) {
+	rows, err := r.db.Query(`
+		SELECT name, "values"
+		FROM product_options
+		WHERE product_id = $1
+		ORDER BY position ASC
+	`, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list product options: %w", err)
+	}
+	defer rows.Close()
+
+	var options []ProductOption
+	for rows.Next() {
+		var option ProductOption
+		if err := rows.Scan(&option.Name, pq.Array(&option.Values)); err != nil {
+			return nil, fmt.Errorf("failed to scan product option: %w", err)
+		}
+		options = append(options, option)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate product options: %w", err)
+	}
+
+	return options, nil
+}
+
+// SetProductOptions replaces a product's option types with options.
+func (r *CatalogRepository) SetProductOptions(productID string, options []ProductOption) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM product_options WHERE product_id = $1`, productID); err != nil {
+		return fmt.Errorf("failed to clear product options: %w", err)
+	}
+
+	for i, option := range options {
+		if _, err := tx.Exec(`
+			INSERT INTO product_options (product_id, name, "values", position)
+			VALUES ($1, $2, $3, $4)
+		`, productID, option.Name, pq.Array(option.Values), i); err != nil {
+			return fmt.Errorf("failed to create product option: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE products SET updated_at = NOW() WHERE id = $1`, productID); err != nil {
+		return fmt.Errorf("failed to update product: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ListVariants returns a product's variants, oldest first. Inactive ones
+// are left out unless includeInactive is set.
+func (r *CatalogRepository) ListVariants(productID string, includeInactive bool) ([]*ProductVariant, error) {
+	query := `
+		SELECT ` + productVariantColumns + `
+		FROM product_variants v
+		JOIN products p ON p.id = v.product_id
+		WHERE v.product_id = $1
+	`
+	if !includeInactive {
+		query += " AND v.is_active = true"
+	}
+	query += " ORDER BY v.created_at ASC, v.sku ASC"
+
+	rows, err := r.db.Query(query, productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list variants: %w", err)
+	}
+	defer rows.Close()
+
+	var variants []*ProductVariant
+	for rows.Next() {
+		variant, err := scanProductVariant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan variant: %w", err)
+		}
+		variants = append(variants, variant)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate variants: %w", err)
+	}
+
+	return variants, nil
+}
+
+// ListActiveVariantsOfProducts returns the active variants of each of
+// productIDs that has any, oldest first, keyed by product ID.
+func (r *CatalogRepository) ListActiveVariantsOfProducts(productIDs []string) (map[string][]*ProductVariant, error) {
+	variants := make(map[string][]*ProductVariant)
+	if len(productIDs) == 0 {
+		return variants, nil
+	}
+
+	rows, err := r.db.Query(`
+		SELECT `+productVariantColumns+`
+		FROM product_variants v
+		JOIN products p ON p.id = v.product_id
+		WHERE v.product_id = ANY($1) AND v.is_active = true
+		ORDER BY v.created_at ASC, v.sku ASC
+	`, pq.Array(productIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list variants: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		variant, err := scanProductVariant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan variant: %w", err)
+		}
+		variants[variant.ProductID] = append(variants[variant.ProductID], variant)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate variants: %w", err)
+	}
+
+	return variants, nil
+}
+
+func (r *CatalogRepository) GetVariant(id string) (*ProductVariant, error) {
+	variant, err := scanProductVariant(r.db.QueryRow(`
+		SELECT `+productVariantColumns+`
+		FROM product_variants v
+		JOIN products p ON p.id = v.product_id
+		WHERE v.id = $1
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrVariantNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variant: %w", err)
+	}
+
+	return variant, nil
+}
+
+// CreateVariant adds a variant to a product, receiving stockQuantity of it
+// at the default warehouse. An invalid priceCents makes the variant sell at
+// the product's price.
+func (r *CatalogRepository) CreateVariant(productID, sku string, options map[string]string, priceCents sql.NullInt64, currency string, stockQuantity int32, imageURLs []string) (*ProductVariant, error) {
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode variant options: %w", err)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRow(`
+		INSERT INTO product_variants (product_id, sku, options, price_cents, currency, image_urls)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, productID, sku, encoded, priceCents, variantCurrency(priceCents, currency), pq.Array(imageURLs)).Scan(&id)
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicateSKU
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create variant: %w", err)
+	}
+
+	if err := receiveOpeningStock(tx, productID, id, stockQuantity); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return r.GetVariant(id)
+}
+
+// UpdateVariant replaces a variant's fields other than its stock, which
+// only changes through the inventory ledger. An invalid priceCents makes
+// the variant sell at the product's price.
+func (r *CatalogRepository) UpdateVariant(id, sku string, options map[string]string, priceCents sql.NullInt64, currency string, imageURLs []string, isActive bool) (*ProductVariant, error) {
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode variant options: %w", err)
+	}
+
+	result, err := r.db.Exec(`
+		UPDATE product_variants
+		SET sku = $2, options = $3, price_cents = $4, currency = $5, image_urls = $6, is_active = $7, updated_at = NOW()
+		WHERE id = $1
+	`, id, sku, encoded, priceCents, variantCurrency(priceCents, currency), pq.Array(imageURLs), isActive)
+	if isUniqueViolation(err) {
+		return nil, ErrDuplicateSKU
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update variant: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count updated variants: %w", err)
+	}
+	if updated == 0 {
+		return nil, ErrVariantNotFound
+	}
+
+	return r.GetVariant(id)
+}
+
+// DeleteVariant stops selling a variant. It is kept so reservations and
+// orders can still refer to it.
+func (r *CatalogRepository) DeleteVariant(id string) error {
+	result, err := r.db.Exec(`UPDATE product_variants SET is_active = false, updated_at = NOW() WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete variant: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to count deleted variants: %w", err)
+	}
+	if deleted == 0 {
+		return ErrVariantNotFound
+	}
+
+	return nil
+}
+
+func variantCurrency(priceCents sql.NullInt64, currency string) sql.NullString {
+	return sql.NullString{String: currency, Valid: priceCents.Valid}
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
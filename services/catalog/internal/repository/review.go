@@ -0,0 +1,336 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Review statuses. Only approved reviews are shown to customers and count
+// towards their product's rating.
+const (
+	ReviewStatusPending  = "pending"
+	ReviewStatusApproved = "approved"
+	ReviewStatusRejected = "rejected"
+)
+
+// Review sort orders.
+const (
+	ReviewSortNewest  = "newest"
+	ReviewSortHelpful = "helpful"
+)
+
+var (
+	ErrReviewNotFound = errors.New("review not found")
+	ErrOwnReviewVote  = errors.New("cannot vote on your own review")
+)
+
+// Review is a customer's rating and review of a product, from 1 to 5
+// stars, and where it is in moderation.
+type Review struct {
+	ID             string
+	ProductID      string
+	UserID         string
+	OrderID        string
+	Rating         int32
+	Title          string
+	Body           string
+	Status         string
+	ModerationNote string
+	HelpfulCount   int32
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+const reviewColumns = `id, product_id, user_id, order_id, rating, title, body, status,
+	COALESCE(moderation_note, ''), helpful_count, created_at, updated_at`
+
+func scanReview(row rowScanner) (*Review, error) {
+	review := &Review{}
+	if err := row.Scan(
+		&review.ID, &review.ProductID, &review.UserID, &review.OrderID, &review.Rating,
+		&review.Title, &review.Body, &review.Status, &review.ModerationNote,
+		&review.HelpfulCount, &review.CreatedAt, &review.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// UpsertReview creates userID's review of productID, or replaces the one
+// they already wrote. Either way the review goes back to pending
+// moderation, and the product's rating is updated in case it was approved.
+func (r *CatalogRepository) UpsertReview(productID, userID, orderID string, rating int32, title, body string) (*Review, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockProductRating(tx, productID); err != nil {
+		return nil, err
+	}
+
+	review, err := scanReview(tx.QueryRow(`
+		INSERT INTO product_reviews (product_id, user_id, order_id, rating, title, body)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (product_id, user_id) DO UPDATE
+		SET order_id = EXCLUDED.order_id,
+			rating = EXCLUDED.rating,
+			title = EXCLUDED.title,
+			body = EXCLUDED.body,
+			status = 'pending',
+			moderation_note = NULL,
+			updated_at = NOW()
+		RETURNING `+reviewColumns,
+		productID, userID, orderID, rating, title, body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save review: %w", err)
+	}
+
+	if err := updateProductRating(tx, productID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return review, nil
+}
+
+// ListReviews returns a page of reviews in the order of sortOrder, newest
+// first by default, and how many there are in total. An empty productID or
+// status leaves that filter off.
+func (r *CatalogRepository) ListReviews(productID, status, sortOrder string, limit, offset int) ([]*Review, int, error) {
+	f := &searchFilter{}
+	if productID != "" {
+		f.conditions = append(f.conditions, "product_id = "+f.arg(productID))
+	}
+	if status != "" {
+		f.conditions = append(f.conditions, "status = "+f.arg(status))
+	}
+
+	var totalCount int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM product_reviews`+f.where(), f.args...).Scan(&totalCount); err != nil {
+		return nil, 0, fmt.Errorf("failed to count reviews: %w", err)
+	}
+
+	order := "created_at DESC, id ASC"
+	if sortOrder == ReviewSortHelpful {
+		order = "helpful_count DESC, created_at DESC, id ASC"
+	}
+
+	query := `SELECT ` + reviewColumns + ` FROM product_reviews` + f.where() + " ORDER BY " + order
+	query += fmt.Sprintf(" LIMIT %s OFFSET %s", f.arg(limit), f.arg(offset))
+
+	rows, err := r.db.Query(query, f.args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list reviews: %w", err)
+	}
+	defer rows.Close()
+
+	var reviews []*Review
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan review: %w", err)
+		}
+		reviews = append(reviews, review)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to iterate reviews: %w", err)
+	}
+
+	return reviews, totalCount, nil
+}
+
+// ModerateReview sets a review's status and moderation note, updating its
+// product's rating.
+func (r *CatalogRepository) ModerateReview(id, status, note string) (*Review, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	productID, err := reviewProductID(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockProductRating(tx, productID); err != nil {
+		return nil, err
+	}
+
+	review, err := scanReview(tx.QueryRow(`
+		UPDATE product_reviews
+		SET status = $2, moderation_note = $3, updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+reviewColumns,
+		id, status, nullString(note)))
+	if err == sql.ErrNoRows {
+		return nil, ErrReviewNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to moderate review: %w", err)
+	}
+
+	if err := updateProductRating(tx, productID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return review, nil
+}
+
+// VoteReview records that userID found an approved review helpful, or
+// takes their vote back when helpful is false. Voting twice, or taking
+// back a vote never cast, leaves the count as it is.
+func (r *CatalogRepository) VoteReview(reviewID, userID string, helpful bool) (*Review, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var authorID string
+	err = tx.QueryRow(`
+		SELECT user_id FROM product_reviews
+		WHERE id = $1 AND status = 'approved'
+		FOR UPDATE
+	`, reviewID).Scan(&authorID)
+	if err == sql.ErrNoRows {
+		return nil, ErrReviewNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock review: %w", err)
+	}
+	if authorID == userID {
+		return nil, ErrOwnReviewVote
+	}
+
+	var result sql.Result
+	delta := 1
+	if helpful {
+		result, err = tx.Exec(`
+			INSERT INTO review_votes (review_id, user_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, reviewID, userID)
+	} else {
+		delta = -1
+		result, err = tx.Exec(`DELETE FROM review_votes WHERE review_id = $1 AND user_id = $2`, reviewID, userID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record vote: %w", err)
+	}
+	changed, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to record vote: %w", err)
+	}
+	if changed == 0 {
+		delta = 0
+	}
+
+	review, err := scanReview(tx.QueryRow(`
+		UPDATE product_reviews
+		SET helpful_count = helpful_count + $2
+		WHERE id = $1
+		RETURNING `+reviewColumns,
+		reviewID, delta))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update helpful count: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return review, nil
+}
+
+// DeleteReview deletes userID's review id, updating its product's rating.
+func (r *CatalogRepository) DeleteReview(id, userID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	productID, err := reviewProductID(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := lockProductRating(tx, productID); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM product_reviews WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete review: %w", err)
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to delete review: %w", err)
+	} else if deleted == 0 {
+		return ErrReviewNotFound
+	}
+
+	if err := updateProductRating(tx, productID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func reviewProductID(tx *sql.Tx, id string) (string, error) {
+	var productID string
+	err := tx.QueryRow(`SELECT product_id FROM product_reviews WHERE id = $1`, id).Scan(&productID)
+	if err == sql.ErrNoRows {
+		return "", ErrReviewNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get review: %w", err)
+	}
+	return productID, nil
+}
+
+// lockProductRating locks a product's row so that concurrent changes to
+// its reviews update its rating one at a time.
+func lockProductRating(tx *sql.Tx, productID string) error {
+	var id string
+	err := tx.QueryRow(`SELECT id FROM products WHERE id = $1 FOR UPDATE`, productID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return ErrProductNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock product: %w", err)
+	}
+	return nil
+}
+
+// updateProductRating recomputes a product's rating from its approved
+// reviews.
+func updateProductRating(tx *sql.Tx, productID string) error {
+	_, err := tx.Exec(`
+		UPDATE products
+		SET rating_average = COALESCE(r.average, 0), rating_count = r.count
+		FROM (
+			SELECT AVG(rating) AS average, COUNT(*) AS count
+			FROM product_reviews
+			WHERE product_id = $1 AND status = 'approved'
+		) r
+		WHERE id = $1
+	`, productID)
+	if err != nil {
+		return fmt.Errorf("failed to update product rating: %w", err)
+	}
+	return nil
+}
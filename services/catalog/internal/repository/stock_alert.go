@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	eventspb "github.com/safar/microservices-demo/proto/events/v1"
+	"github.com/safar/microservices-demo/shared/events"
+)
+
+// Kinds of stock alerts, raised by the stock_alerts triggers.
+const (
+	StockAlertLow = "low_stock"
+	StockAlertOut = "out_of_stock"
+)
+
+// LowStockItem is an active product, or an active variant of one, whose
+// stock available to sell is at or below its product's reorder threshold,
+// or has run out.
+type LowStockItem struct {
+	ProductID        string
+	ProductName      string
+	ProductSlug      string
+	VariantID        sql.NullString
+	SKU              sql.NullString
+	Available        int32
+	ReorderThreshold int32
+}
+
+// SetReorderThreshold sets the stock at or below which a product, or each
+// of its variants, is low on stock. 0 turns low-stock alerts off.
+func (r *CatalogRepository) SetReorderThreshold(productID string, threshold int32) (*Product, error) {
+	product := &Product{}
+	err := r.db.QueryRow(`
+		UPDATE products
+		SET reorder_threshold = $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING id, name, slug, description, price_cents, currency, category_id, image_urls, stock_quantity, weight_grams, reorder_threshold, rating_average, rating_count, is_active, created_at, updated_at
+	`, productID, threshold).Scan(
+		&product.ID, &product.Name, &product.Slug, &product.Description, &product.PriceCents,
+		&product.Currency, &product.CategoryID, pq.Array(&product.ImageURLs), &product.StockQuantity,
+		&product.WeightGrams, &product.ReorderThreshold, &product.RatingAverage, &product.RatingCount, &product.IsActive, &product.CreatedAt, &product.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to set reorder threshold: %w", err)
+	}
+	return product, nil
+}
+
+// ListLowStockProducts returns a page of the active products and variants
+// that are low on or out of stock, the least available first, and how many
+// there are. Products with active variants are stocked per variant, so
+// only their variants are listed.
+func (r *CatalogRepository) ListLowStockProducts(limit, offset int) ([]*LowStockItem, int, error) {
+	rows, err := r.db.Query(`
+		WITH stock AS (
+			SELECT p.id AS product_id, p.name, p.slug, NULL::UUID AS variant_id, NULL AS sku,
+				p.stock_quantity AS available, p.reorder_threshold
+			FROM products p
+			WHERE p.is_active
+				AND NOT EXISTS (SELECT 1 FROM product_variants v WHERE v.product_id = p.id AND v.is_active)
+			UNION ALL
+			SELECT p.id, p.name, p.slug, v.id, v.sku, v.stock_quantity, p.reorder_threshold
+			FROM product_variants v
+			JOIN products p ON p.id = v.product_id
+			WHERE p.is_active AND v.is_active
+		)
+		SELECT product_id, name, slug, variant_id, sku, available, reorder_threshold, COUNT(*) OVER ()
+		FROM stock
+		WHERE available <= 0 OR available <= reorder_threshold
+		ORDER BY available, name, sku NULLS FIRST
+		LIMIT $1 OFFSET $2
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list low-stock products: %w", err)
+	}
+	defer rows.Close()
+
+	var items []*LowStockItem
+	var total int
+	for rows.Next() {
+		item := &LowStockItem{}
+		if err := rows.Scan(
+			&item.ProductID, &item.ProductName, &item.ProductSlug, &item.VariantID, &item.SKU,
+			&item.Available, &item.ReorderThreshold, &total,
+		); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan low-stock product: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to iterate low-stock products: %w", err)
+	}
+
+	return items, total, nil
+}
+
+// ListUnpublishedOutboxEvents returns up to limit stock alerts that have
+// not been published yet, oldest first, as events. The stock_alerts table
+// is the catalog's outbox, drained by an events.OutboxRelay.
+func (r *CatalogRepository) ListUnpublishedOutboxEvents(limit int) ([]events.Event, error) {
+	rows, err := r.db.Query(`
+		SELECT a.id, a.kind, a.product_id, p.name, a.variant_id, v.sku, a.available, a.reorder_threshold, a.created_at
+		FROM stock_alerts a
+		JOIN products p ON p.id = a.product_id
+		LEFT JOIN product_variants v ON v.id = a.variant_id
+		WHERE a.published_at IS NULL
+		ORDER BY a.created_at ASC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stock alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []events.Event
+	for rows.Next() {
+		var (
+			id, kind  string
+			item      LowStockItem
+			createdAt time.Time
+		)
+		if err := rows.Scan(
+			&id, &kind, &item.ProductID, &item.ProductName, &item.VariantID, &item.SKU,
+			&item.Available, &item.ReorderThreshold, &createdAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan stock alert: %w", err)
+		}
+
+		event, err := stockAlertEvent(kind, &item, createdAt)
+		if err != nil {
+			return nil, err
+		}
+		event.ID = id
+		pending = append(pending, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate stock alerts: %w", err)
+	}
+
+	return pending, nil
+}
+
+func (r *CatalogRepository) MarkOutboxEventPublished(alertID string) error {
+	if _, err := r.db.Exec(`UPDATE stock_alerts SET published_at = NOW() WHERE id = $1`, alertID); err != nil {
+		return fmt.Errorf("failed to mark stock alert published: %w", err)
+	}
+	return nil
+}
+
+// RecordOutboxFailure counts a failed publish attempt for an alert.
+func (r *CatalogRepository) RecordOutboxFailure(alertID string, publishErr error) error {
+	if _, err := r.db.Exec(`UPDATE stock_alerts SET attempts = attempts + 1, last_error = $2 WHERE id = $1`,
+		alertID, publishErr.Error()); err != nil {
+		return fmt.Errorf("failed to record stock alert failure: %w", err)
+	}
+	return nil
+}
+
+func stockAlertEvent(kind string, item *LowStockItem, alertedAt time.Time) (events.Event, error) {
+	eventType := events.TypeStockLow
+	if kind == StockAlertOut {
+		eventType = events.TypeStockOut
+	}
+
+	event, err := events.New(eventType, item.ProductID, &eventspb.StockAlert{
+		ProductId:        item.ProductID,
+		ProductName:      item.ProductName,
+		VariantId:        item.VariantID.String,
+		Sku:              item.SKU.String,
+		Available:        item.Available,
+		ReorderThreshold: item.ReorderThreshold,
+		AlertedAt:        alertedAt.Format("2006-01-02T15:04:05Z"),
+	})
+	if err != nil {
+		return events.Event{}, err
+	}
+	event.OccurredAt = alertedAt
+	return event, nil
+}
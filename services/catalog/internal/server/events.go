@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	eventsv1 "github.com/safar/microservices-demo/proto/events/v1"
+	"github.com/safar/microservices-demo/services/catalog/internal/service"
+	"github.com/safar/microservices-demo/shared/events"
+)
+
+// OrderEventTypes are the order events the catalog service reacts to.
+var OrderEventTypes = []string{events.TypeOrderCancelled}
+
+// EventHandler updates inventory in response to events published by other
+// services.
+type EventHandler struct {
+	catalogService *service.CatalogService
+}
+
+func NewEventHandler(catalogService *service.CatalogService) *EventHandler {
+	return &EventHandler{
+		catalogService: catalogService,
+	}
+}
+
+func (h *EventHandler) HandleOrderEvent(ctx context.Context, event events.Event) error {
+	switch event.Type {
+	case events.TypeOrderCancelled:
+		var cancelled eventsv1.OrderCancelled
+		if err := event.Decode(&cancelled); err != nil {
+			return err
+		}
+		if err := h.catalogService.ReleaseOrderStock(ctx, cancelled.OrderId); err != nil {
+			return fmt.Errorf("failed to release order stock: %w", err)
+		}
+		return nil
+	default:
+		return nil
+	}
+}
@@ -2,12 +2,17 @@ package server
 
 import (
 	"context"
+	"errors"
+	"io"
 	"math"
+	"time"
 
 	commonv1 "github.com/safar/microservices-demo/proto/common/v1"
 	pb "github.com/safar/microservices-demo/proto/catalog/v1"
 	"github.com/safar/microservices-demo/services/catalog/internal/repository"
 	"github.com/safar/microservices-demo/services/catalog/internal/service"
+	"github.com/safar/microservices-demo/shared/pagination"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -24,56 +29,27 @@ func NewGRPCServer(catalogService *service.CatalogService) *GRPCServer {
 }
 
 func (s *GRPCServer) ListProducts(ctx context.Context, req *pb.ListProductsRequest) (*pb.ListProductsResponse, error) {
-	page := int(req.Pagination.Page)
-	pageSize := int(req.Pagination.PageSize)
-
-	if page <= 0 {
-		page = 1
-	}
-	if pageSize <= 0 {
-		pageSize = 10
+	page, err := pagination.FromProto(req.Pagination, 10)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	products, total, err := s.catalogService.ListProducts(ctx, page, pageSize, req.CategoryId, req.ActiveOnly)
+	products, result, err := s.catalogService.ListProducts(ctx, page, req.CategoryId, req.IncludeDescendants, req.ActiveOnly, searchSort(req.Sort))
+	if errors.Is(err, service.ErrPageTokenSort) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to list products: %v", err)
 	}
 
 	var pbProducts []*pb.Product
 	for _, p := range products {
-		categoryID := ""
-		if p.CategoryID.Valid {
-			categoryID = p.CategoryID.String
-		}
-
-		pbProducts = append(pbProducts, &pb.Product{
-			Id:          p.ID,
-			Name:        p.Name,
-			Slug:        p.Slug,
-			Description: p.Description,
-			Price: &commonv1.Money{
-				AmountCents: p.PriceCents,
-				Currency:    p.Currency,
-			},
-			CategoryId:    categoryID,
-			ImageUrls:     p.ImageURLs,
-			StockQuantity: p.StockQuantity,
-			IsActive:      p.IsActive,
-			CreatedAt:     p.CreatedAt.Format("2006-01-02T15:04:05Z"),
-			UpdatedAt:     p.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-		})
+		pbProducts = append(pbProducts, convertProductToProto(p))
 	}
 
-	totalPages := int32(math.Ceil(float64(total) / float64(pageSize)))
-
 	return &pb.ListProductsResponse{
-		Products: pbProducts,
-		Pagination: &commonv1.PaginationResponse{
-			Page:       int32(page),
-			PageSize:   int32(pageSize),
-			TotalPages: totalPages,
-			TotalCount: int64(total),
-		},
+		Products:   pbProducts,
+		Pagination: pagination.ToProto(page, result),
 	}, nil
 }
 
@@ -95,36 +71,56 @@ func (s *GRPCServer) GetProduct(ctx context.Context, req *pb.GetProductRequest)
 	}
 
 	p := product.(*repository.Product)
-	categoryID := ""
-	if p.CategoryID.Valid {
-		categoryID = p.CategoryID.String
+
+	var options []*pb.ProductOption
+	for _, o := range p.Options {
+		options = append(options, &pb.ProductOption{Name: o.Name, Values: o.Values})
 	}
 
-	return &pb.Product{
-		Id:          p.ID,
-		Name:        p.Name,
-		Slug:        p.Slug,
-		Description: p.Description,
-		Price: &commonv1.Money{
-			AmountCents: p.PriceCents,
-			Currency:    p.Currency,
-		},
-		CategoryId:    categoryID,
-		ImageUrls:     p.ImageURLs,
-		StockQuantity: p.StockQuantity,
-		IsActive:      p.IsActive,
-		CreatedAt:     p.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		UpdatedAt:     p.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-	}, nil
+	var variants []*pb.ProductVariant
+	for _, v := range p.Variants {
+		variants = append(variants, convertVariantToProto(v))
+	}
+
+	var breadcrumbs []*pb.Category
+	for _, c := range p.Breadcrumbs {
+		breadcrumbs = append(breadcrumbs, convertCategoryToProto(c))
+	}
+
+	pbProduct := convertProductToProto(p)
+	pbProduct.Options = options
+	pbProduct.Variants = variants
+	pbProduct.Breadcrumbs = breadcrumbs
+	return pbProduct, nil
+}
+
+func (s *GRPCServer) GetProducts(ctx context.Context, req *pb.GetProductsRequest) (*pb.GetProductsResponse, error) {
+	products, err := s.catalogService.GetProductsByIDs(ctx, req.Ids)
+	if errors.Is(err, service.ErrTooManyProducts) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get products: %v", err)
+	}
+
+	resp := &pb.GetProductsResponse{Products: make([]*pb.Product, 0, len(products))}
+	for _, p := range products {
+		pbProduct := convertProductToProto(p)
+		for _, v := range p.Variants {
+			pbProduct.Variants = append(pbProduct.Variants, convertVariantToProto(v))
+		}
+		resp.Products = append(resp.Products, pbProduct)
+	}
+	return resp, nil
 }
 
-func (s *GRPCServer) SearchProducts(ctx context.Context, req *pb.SearchProductsRequest) (*pb.ListProductsResponse, error) {
-	if req.Query == "" {
-		return nil, status.Error(codes.InvalidArgument, "search query is required")
+func (s *GRPCServer) SearchProducts(ctx context.Context, req *pb.SearchProductsRequest) (*pb.SearchProductsResponse, error) {
+	if req.MinPriceCents < 0 || req.MaxPriceCents < 0 {
+		return nil, status.Error(codes.InvalidArgument, "price bounds must not be negative")
 	}
 
-	page := int(req.Pagination.Page)
-	pageSize := int(req.Pagination.PageSize)
+	page := int(req.Pagination.GetPage())
+	pageSize := int(req.Pagination.GetPageSize())
 
 	if page <= 0 {
 		page = 1
@@ -133,39 +129,31 @@ func (s *GRPCServer) SearchProducts(ctx context.Context, req *pb.SearchProductsR
 		pageSize = 10
 	}
 
-	products, total, err := s.catalogService.SearchProducts(ctx, req.Query, page, pageSize, req.CategoryId)
+	products, total, facets, err := s.catalogService.SearchProducts(ctx, repository.ProductSearch{
+		Query:              req.Query,
+		CategoryID:         req.CategoryId,
+		IncludeDescendants: req.IncludeDescendants,
+		MinPriceCents:      req.MinPriceCents,
+		MaxPriceCents:      req.MaxPriceCents,
+		InStockOnly:        req.InStockOnly,
+		Attributes:         req.Attributes,
+		Sort:               searchSort(req.Sort),
+	}, page, pageSize)
+	if errors.Is(err, service.ErrInvalidPriceRange) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to search products: %v", err)
 	}
 
 	var pbProducts []*pb.Product
 	for _, p := range products {
-		categoryID := ""
-		if p.CategoryID.Valid {
-			categoryID = p.CategoryID.String
-		}
-
-		pbProducts = append(pbProducts, &pb.Product{
-			Id:          p.ID,
-			Name:        p.Name,
-			Slug:        p.Slug,
-			Description: p.Description,
-			Price: &commonv1.Money{
-				AmountCents: p.PriceCents,
-				Currency:    p.Currency,
-			},
-			CategoryId:    categoryID,
-			ImageUrls:     p.ImageURLs,
-			StockQuantity: p.StockQuantity,
-			IsActive:      p.IsActive,
-			CreatedAt:     p.CreatedAt.Format("2006-01-02T15:04:05Z"),
-			UpdatedAt:     p.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-		})
+		pbProducts = append(pbProducts, convertProductToProto(p))
 	}
 
 	totalPages := int32(math.Ceil(float64(total) / float64(pageSize)))
 
-	return &pb.ListProductsResponse{
+	return &pb.SearchProductsResponse{
 		Products: pbProducts,
 		Pagination: &commonv1.PaginationResponse{
 			Page:       int32(page),
@@ -173,9 +161,46 @@ func (s *GRPCServer) SearchProducts(ctx context.Context, req *pb.SearchProductsR
 			TotalPages: totalPages,
 			TotalCount: int64(total),
 		},
+		Facets: convertFacetsToProto(facets),
 	}, nil
 }
 
+func (s *GRPCServer) SuggestProducts(ctx context.Context, req *pb.SuggestProductsRequest) (*pb.SuggestProductsResponse, error) {
+	if req.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+
+	suggestions, err := s.catalogService.SuggestProducts(ctx, req.Prefix, int(req.Limit))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to suggest products: %v", err)
+	}
+
+	resp := &pb.SuggestProductsResponse{}
+	for _, p := range suggestions.Products {
+		resp.Products = append(resp.Products, &pb.ProductSuggestion{
+			Id:       p.ID,
+			Name:     p.Name,
+			Slug:     p.Slug,
+			ImageUrl: p.ImageURL,
+		})
+	}
+	for _, c := range suggestions.Categories {
+		resp.Categories = append(resp.Categories, &pb.CategorySuggestion{
+			Id:   c.ID,
+			Name: c.Name,
+			Slug: c.Slug,
+		})
+	}
+	for _, q := range suggestions.Queries {
+		resp.Queries = append(resp.Queries, &pb.QuerySuggestion{
+			Query:       q.Query,
+			SearchCount: q.SearchCount,
+		})
+	}
+
+	return resp, nil
+}
+
 func (s *GRPCServer) CreateProduct(ctx context.Context, req *pb.CreateProductRequest) (*pb.Product, error) {
 	if req.Name == "" || req.Slug == "" {
 		return nil, status.Error(codes.InvalidArgument, "name and slug are required")
@@ -185,6 +210,10 @@ func (s *GRPCServer) CreateProduct(ctx context.Context, req *pb.CreateProductReq
 		return nil, status.Error(codes.InvalidArgument, "price is required")
 	}
 
+	if req.WeightGrams < 0 {
+		return nil, status.Error(codes.InvalidArgument, "weight must not be negative")
+	}
+
 	product, err := s.catalogService.CreateProduct(
 		ctx,
 		req.Name,
@@ -195,32 +224,13 @@ func (s *GRPCServer) CreateProduct(ctx context.Context, req *pb.CreateProductReq
 		req.CategoryId,
 		req.ImageUrls,
 		req.StockQuantity,
+		req.WeightGrams,
 	)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to create product: %v", err)
 	}
 
-	categoryID := ""
-	if product.CategoryID.Valid {
-		categoryID = product.CategoryID.String
-	}
-
-	return &pb.Product{
-		Id:          product.ID,
-		Name:        product.Name,
-		Slug:        product.Slug,
-		Description: product.Description,
-		Price: &commonv1.Money{
-			AmountCents: product.PriceCents,
-			Currency:    product.Currency,
-		},
-		CategoryId:    categoryID,
-		ImageUrls:     product.ImageURLs,
-		StockQuantity: product.StockQuantity,
-		IsActive:      product.IsActive,
-		CreatedAt:     product.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		UpdatedAt:     product.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-	}, nil
+	return convertProductToProto(product), nil
 }
 
 func (s *GRPCServer) UpdateProduct(ctx context.Context, req *pb.UpdateProductRequest) (*pb.Product, error) {
@@ -232,6 +242,10 @@ func (s *GRPCServer) UpdateProduct(ctx context.Context, req *pb.UpdateProductReq
 		return nil, status.Error(codes.InvalidArgument, "price is required")
 	}
 
+	if req.WeightGrams < 0 {
+		return nil, status.Error(codes.InvalidArgument, "weight must not be negative")
+	}
+
 	product, err := s.catalogService.UpdateProduct(
 		ctx,
 		req.Id,
@@ -242,34 +256,14 @@ func (s *GRPCServer) UpdateProduct(ctx context.Context, req *pb.UpdateProductReq
 		req.Price.Currency,
 		req.CategoryId,
 		req.ImageUrls,
-		req.StockQuantity,
+		req.WeightGrams,
 		req.IsActive,
 	)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to update product: %v", err)
 	}
 
-	categoryID := ""
-	if product.CategoryID.Valid {
-		categoryID = product.CategoryID.String
-	}
-
-	return &pb.Product{
-		Id:          product.ID,
-		Name:        product.Name,
-		Slug:        product.Slug,
-		Description: product.Description,
-		Price: &commonv1.Money{
-			AmountCents: product.PriceCents,
-			Currency:    product.Currency,
-		},
-		CategoryId:    categoryID,
-		ImageUrls:     product.ImageURLs,
-		StockQuantity: product.StockQuantity,
-		IsActive:      product.IsActive,
-		CreatedAt:     product.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		UpdatedAt:     product.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-	}, nil
+	return convertProductToProto(product), nil
 }
 
 func (s *GRPCServer) DeleteProduct(ctx context.Context, req *pb.DeleteProductRequest) (*commonv1.Empty, error) {
@@ -284,6 +278,108 @@ func (s *GRPCServer) DeleteProduct(ctx context.Context, req *pb.DeleteProductReq
 	return &commonv1.Empty{}, nil
 }
 
+func (s *GRPCServer) ImportProducts(stream grpc.ClientStreamingServer[pb.ImportProductsRequest, pb.ImportProductsResponse]) error {
+	var rows []service.ImportRow
+	var dryRun bool
+
+	for position := 0; ; position++ {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if options := req.GetOptions(); options != nil {
+			if position > 0 {
+				return status.Error(codes.InvalidArgument, "import options must be the first message")
+			}
+			dryRun = options.DryRun
+			continue
+		}
+
+		product := req.GetProduct()
+		if product == nil {
+			return status.Error(codes.InvalidArgument, "import message has neither options nor a product")
+		}
+		if len(rows) == service.MaxImportRows {
+			return status.Errorf(codes.InvalidArgument, "an import may hold at most %d products", service.MaxImportRows)
+		}
+
+		row := int(req.Row)
+		if row == 0 {
+			row = len(rows) + 1
+		}
+		rows = append(rows, service.ImportRow{
+			Row: row,
+			Record: repository.ProductRecord{
+				Slug:          product.Slug,
+				Name:          product.Name,
+				Description:   product.Description,
+				PriceCents:    product.PriceCents,
+				Currency:      product.Currency,
+				CategorySlug:  product.CategorySlug,
+				ImageURLs:     product.ImageUrls,
+				StockQuantity: product.StockQuantity,
+				WeightGrams:   product.WeightGrams,
+				IsActive:      product.IsActive,
+			},
+		})
+	}
+
+	result, err := s.catalogService.ImportProducts(stream.Context(), rows, dryRun)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to import products: %v", err)
+	}
+
+	resp := &pb.ImportProductsResponse{
+		DryRun:    result.DryRun,
+		TotalRows: int32(result.TotalRows),
+		Created:   int32(result.Created),
+		Updated:   int32(result.Updated),
+		Failed:    int32(len(result.Errors)),
+	}
+	for _, e := range result.Errors {
+		resp.Errors = append(resp.Errors, &pb.ImportRowError{
+			Row:     int32(e.Row),
+			Slug:    e.Slug,
+			Message: e.Message,
+		})
+	}
+	for _, w := range result.Warnings {
+		resp.Warnings = append(resp.Warnings, &pb.ImportRowError{
+			Row:     int32(w.Row),
+			Slug:    w.Slug,
+			Message: w.Message,
+		})
+	}
+
+	return stream.SendAndClose(resp)
+}
+
+func (s *GRPCServer) ExportProducts(req *pb.ExportProductsRequest, stream grpc.ServerStreamingServer[pb.ProductRecord]) error {
+	err := s.catalogService.ExportProducts(stream.Context(), req.CategoryId, req.IncludeDescendants, req.ActiveOnly, func(record *repository.ProductRecord) error {
+		return stream.Send(&pb.ProductRecord{
+			Slug:          record.Slug,
+			Name:          record.Name,
+			Description:   record.Description,
+			PriceCents:    record.PriceCents,
+			Currency:      record.Currency,
+			CategorySlug:  record.CategorySlug,
+			ImageUrls:     record.ImageURLs,
+			StockQuantity: record.StockQuantity,
+			WeightGrams:   record.WeightGrams,
+			IsActive:      record.IsActive,
+		})
+	})
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to export products: %v", err)
+	}
+
+	return nil
+}
+
 func (s *GRPCServer) ListCategories(ctx context.Context, req *commonv1.Empty) (*pb.ListCategoriesResponse, error) {
 	categories, err := s.catalogService.ListCategories(ctx)
 	if err != nil {
@@ -292,19 +388,7 @@ func (s *GRPCServer) ListCategories(ctx context.Context, req *commonv1.Empty) (*
 
 	var pbCategories []*pb.Category
 	for _, c := range categories {
-		parentID := ""
-		if c.ParentID.Valid {
-			parentID = c.ParentID.String
-		}
-
-		pbCategories = append(pbCategories, &pb.Category{
-			Id:          c.ID,
-			Name:        c.Name,
-			Slug:        c.Slug,
-			Description: c.Description,
-			ParentId:    parentID,
-			CreatedAt:   c.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		})
+		pbCategories = append(pbCategories, convertCategoryToProto(c))
 	}
 
 	return &pb.ListCategoriesResponse{
@@ -312,14 +396,63 @@ func (s *GRPCServer) ListCategories(ctx context.Context, req *commonv1.Empty) (*
 	}, nil
 }
 
+func (s *GRPCServer) GetCategoryTree(ctx context.Context, req *commonv1.Empty) (*pb.CategoryTree, error) {
+	roots, err := s.catalogService.GetCategoryTree(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get category tree: %v", err)
+	}
+
+	return &pb.CategoryTree{
+		Roots: convertCategoryNodesToProto(roots),
+	}, nil
+}
+
+func (s *GRPCServer) CreateCategory(ctx context.Context, req *pb.CreateCategoryRequest) (*pb.Category, error) {
+	if req.Name == "" || req.Slug == "" {
+		return nil, status.Error(codes.InvalidArgument, "name and slug are required")
+	}
+
+	category, err := s.catalogService.CreateCategory(ctx, req.Name, req.Slug, req.Description, req.ParentId)
+	if err != nil {
+		return nil, categoryError("failed to create category", err)
+	}
+
+	return convertCategoryToProto(category), nil
+}
+
+func (s *GRPCServer) UpdateCategory(ctx context.Context, req *pb.UpdateCategoryRequest) (*pb.Category, error) {
+	if req.Id == "" || req.Name == "" || req.Slug == "" {
+		return nil, status.Error(codes.InvalidArgument, "category ID, name and slug are required")
+	}
+
+	category, err := s.catalogService.UpdateCategory(ctx, req.Id, req.Name, req.Slug, req.Description, req.ParentId)
+	if err != nil {
+		return nil, categoryError("failed to update category", err)
+	}
+
+	return convertCategoryToProto(category), nil
+}
+
+func (s *GRPCServer) DeleteCategory(ctx context.Context, req *pb.DeleteCategoryRequest) (*commonv1.Empty, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "category ID is required")
+	}
+
+	if err := s.catalogService.DeleteCategory(ctx, req.Id); err != nil {
+		return nil, categoryError("failed to delete category", err)
+	}
+
+	return &commonv1.Empty{}, nil
+}
+
 func (s *GRPCServer) CheckInventory(ctx context.Context, req *pb.CheckInventoryRequest) (*pb.CheckInventoryResponse, error) {
 	if len(req.Items) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "items are required")
 	}
 
-	items := make(map[string]int32)
+	items := make(map[repository.InventoryKey]int32)
 	for _, item := range req.Items {
-		items[item.ProductId] = item.Quantity
+		items[repository.InventoryKey{ProductID: item.ProductId, VariantID: item.VariantId}] = item.Quantity
 	}
 
 	available, unavailable, err := s.catalogService.CheckInventory(ctx, items)
@@ -327,10 +460,17 @@ func (s *GRPCServer) CheckInventory(ctx context.Context, req *pb.CheckInventoryR
 		return nil, status.Errorf(codes.Internal, "failed to check inventory: %v", err)
 	}
 
-	return &pb.CheckInventoryResponse{
-		Available:             available,
-		UnavailableProductIds: unavailable,
-	}, nil
+	resp := &pb.CheckInventoryResponse{
+		Available: available,
+	}
+	for _, key := range unavailable {
+		resp.UnavailableProductIds = append(resp.UnavailableProductIds, key.ProductID)
+		if key.VariantID != "" {
+			resp.UnavailableVariantIds = append(resp.UnavailableVariantIds, key.VariantID)
+		}
+	}
+
+	return resp, nil
 }
 
 func (s *GRPCServer) ReserveInventory(ctx context.Context, req *pb.ReserveInventoryRequest) (*pb.ReserveInventoryResponse, error) {
@@ -338,9 +478,9 @@ func (s *GRPCServer) ReserveInventory(ctx context.Context, req *pb.ReserveInvent
 		return nil, status.Error(codes.InvalidArgument, "order ID and items are required")
 	}
 
-	items := make(map[string]int32)
+	items := make(map[repository.InventoryKey]int32)
 	for _, item := range req.Items {
-		items[item.ProductId] = item.Quantity
+		items[repository.InventoryKey{ProductID: item.ProductId, VariantID: item.VariantId}] = item.Quantity
 	}
 
 	expirationMinutes := req.ExpirationMinutes
@@ -360,3 +500,841 @@ func (s *GRPCServer) ReserveInventory(ctx context.Context, req *pb.ReserveInvent
 		ReservationId: reservationID,
 	}, nil
 }
+
+func (s *GRPCServer) CommitReservation(ctx context.Context, req *pb.CommitReservationRequest) (*commonv1.Empty, error) {
+	if req.ReservationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "reservation ID is required")
+	}
+
+	if err := s.catalogService.CommitReservation(ctx, req.ReservationId); err != nil {
+		return nil, reservationError("failed to commit reservation", err)
+	}
+
+	return &commonv1.Empty{}, nil
+}
+
+func (s *GRPCServer) ReleaseReservation(ctx context.Context, req *pb.ReleaseReservationRequest) (*commonv1.Empty, error) {
+	if req.ReservationId == "" {
+		return nil, status.Error(codes.InvalidArgument, "reservation ID is required")
+	}
+
+	if err := s.catalogService.ReleaseReservation(ctx, req.ReservationId); err != nil {
+		return nil, reservationError("failed to release reservation", err)
+	}
+
+	return &commonv1.Empty{}, nil
+}
+
+func (s *GRPCServer) SetProductOptions(ctx context.Context, req *pb.SetProductOptionsRequest) (*pb.Product, error) {
+	if req.ProductId == "" {
+		return nil, status.Error(codes.InvalidArgument, "product ID is required")
+	}
+
+	options := make([]repository.ProductOption, 0, len(req.Options))
+	for _, o := range req.Options {
+		options = append(options, repository.ProductOption{Name: o.Name, Values: o.Values})
+	}
+
+	if err := s.catalogService.SetProductOptions(ctx, req.ProductId, options); err != nil {
+		return nil, variantError("failed to set product options", err)
+	}
+
+	return s.GetProduct(ctx, &pb.GetProductRequest{
+		Identifier: &pb.GetProductRequest_Id{Id: req.ProductId},
+	})
+}
+
+func (s *GRPCServer) ListVariants(ctx context.Context, req *pb.ListVariantsRequest) (*pb.ListVariantsResponse, error) {
+	if req.ProductId == "" {
+		return nil, status.Error(codes.InvalidArgument, "product ID is required")
+	}
+
+	variants, err := s.catalogService.ListVariants(ctx, req.ProductId, req.IncludeInactive)
+	if err != nil {
+		return nil, variantError("failed to list variants", err)
+	}
+
+	var pbVariants []*pb.ProductVariant
+	for _, v := range variants {
+		pbVariants = append(pbVariants, convertVariantToProto(v))
+	}
+
+	return &pb.ListVariantsResponse{
+		Variants: pbVariants,
+	}, nil
+}
+
+func (s *GRPCServer) CreateVariant(ctx context.Context, req *pb.CreateVariantRequest) (*pb.ProductVariant, error) {
+	if req.ProductId == "" || req.Sku == "" {
+		return nil, status.Error(codes.InvalidArgument, "product ID and SKU are required")
+	}
+
+	if req.StockQuantity < 0 {
+		return nil, status.Error(codes.InvalidArgument, "stock must not be negative")
+	}
+
+	variant, err := s.catalogService.CreateVariant(
+		ctx,
+		req.ProductId,
+		req.Sku,
+		req.Options,
+		variantPrice(req.Price),
+		req.StockQuantity,
+		req.ImageUrls,
+	)
+	if err != nil {
+		return nil, variantError("failed to create variant", err)
+	}
+
+	return convertVariantToProto(variant), nil
+}
+
+func (s *GRPCServer) UpdateVariant(ctx context.Context, req *pb.UpdateVariantRequest) (*pb.ProductVariant, error) {
+	if req.Id == "" || req.Sku == "" {
+		return nil, status.Error(codes.InvalidArgument, "variant ID and SKU are required")
+	}
+
+	variant, err := s.catalogService.UpdateVariant(
+		ctx,
+		req.Id,
+		req.Sku,
+		req.Options,
+		variantPrice(req.Price),
+		req.ImageUrls,
+		req.IsActive,
+	)
+	if err != nil {
+		return nil, variantError("failed to update variant", err)
+	}
+
+	return convertVariantToProto(variant), nil
+}
+
+func (s *GRPCServer) DeleteVariant(ctx context.Context, req *pb.DeleteVariantRequest) (*commonv1.Empty, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "variant ID is required")
+	}
+
+	if err := s.catalogService.DeleteVariant(ctx, req.Id); err != nil {
+		return nil, variantError("failed to delete variant", err)
+	}
+
+	return &commonv1.Empty{}, nil
+}
+
+func (s *GRPCServer) SubmitReview(ctx context.Context, req *pb.SubmitReviewRequest) (*pb.Review, error) {
+	if req.ProductId == "" || req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "product ID and user ID are required")
+	}
+
+	review, err := s.catalogService.SubmitReview(ctx, req.ProductId, req.UserId, req.Rating, req.Title, req.Body)
+	if err != nil {
+		return nil, reviewError("failed to submit review", err)
+	}
+
+	return convertReviewToProto(review), nil
+}
+
+func (s *GRPCServer) ListReviews(ctx context.Context, req *pb.ListReviewsRequest) (*pb.ListReviewsResponse, error) {
+	page := int(req.Pagination.GetPage())
+	pageSize := int(req.Pagination.GetPageSize())
+
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+
+	sortOrder := repository.ReviewSortNewest
+	if req.Sort == pb.ReviewSort_REVIEW_SORT_HELPFUL {
+		sortOrder = repository.ReviewSortHelpful
+	}
+
+	reviews, total, err := s.catalogService.ListReviews(ctx, req.ProductId, reviewStatus(req.Status), sortOrder, page, pageSize)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list reviews: %v", err)
+	}
+
+	var pbReviews []*pb.Review
+	for _, r := range reviews {
+		pbReviews = append(pbReviews, convertReviewToProto(r))
+	}
+
+	totalPages := int32(math.Ceil(float64(total) / float64(pageSize)))
+
+	return &pb.ListReviewsResponse{
+		Reviews: pbReviews,
+		Pagination: &commonv1.PaginationResponse{
+			Page:       int32(page),
+			PageSize:   int32(pageSize),
+			TotalPages: totalPages,
+			TotalCount: int64(total),
+		},
+	}, nil
+}
+
+func (s *GRPCServer) ModerateReview(ctx context.Context, req *pb.ModerateReviewRequest) (*pb.Review, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "review ID is required")
+	}
+
+	review, err := s.catalogService.ModerateReview(ctx, req.Id, reviewStatus(req.Status), req.Note)
+	if err != nil {
+		return nil, reviewError("failed to moderate review", err)
+	}
+
+	return convertReviewToProto(review), nil
+}
+
+func (s *GRPCServer) VoteReview(ctx context.Context, req *pb.VoteReviewRequest) (*pb.Review, error) {
+	if req.ReviewId == "" || req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "review ID and user ID are required")
+	}
+
+	review, err := s.catalogService.VoteReview(ctx, req.ReviewId, req.UserId, req.Helpful)
+	if err != nil {
+		return nil, reviewError("failed to vote on review", err)
+	}
+
+	return convertReviewToProto(review), nil
+}
+
+func (s *GRPCServer) DeleteReview(ctx context.Context, req *pb.DeleteReviewRequest) (*commonv1.Empty, error) {
+	if req.Id == "" || req.UserId == "" {
+		return nil, status.Error(codes.InvalidArgument, "review ID and user ID are required")
+	}
+
+	if err := s.catalogService.DeleteReview(ctx, req.Id, req.UserId); err != nil {
+		return nil, reviewError("failed to delete review", err)
+	}
+
+	return &commonv1.Empty{}, nil
+}
+
+func (s *GRPCServer) CreateProductPrice(ctx context.Context, req *pb.CreateProductPriceRequest) (*pb.ProductPrice, error) {
+	if req.ProductId == "" {
+		return nil, status.Error(codes.InvalidArgument, "product ID is required")
+	}
+
+	if req.Price == nil {
+		return nil, status.Error(codes.InvalidArgument, "price is required")
+	}
+
+	input := service.ProductPriceInput{
+		PriceCents: req.Price.AmountCents,
+		Currency:   req.Price.Currency,
+	}
+	if req.CompareAtPrice != nil {
+		if req.CompareAtPrice.Currency != "" && req.CompareAtPrice.Currency != req.Price.Currency {
+			return nil, status.Error(codes.InvalidArgument, "compare-at price must be in the price's currency")
+		}
+		input.CompareAtCents = req.CompareAtPrice.AmountCents
+	}
+
+	var err error
+	if req.StartsAt != "" {
+		if input.StartsAt, err = time.Parse(time.RFC3339, req.StartsAt); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "starts_at must be an RFC 3339 time")
+		}
+	}
+	if req.EndsAt != "" {
+		if input.EndsAt, err = time.Parse(time.RFC3339, req.EndsAt); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "ends_at must be an RFC 3339 time")
+		}
+	}
+
+	price, err := s.catalogService.CreateProductPrice(ctx, req.ProductId, input)
+	if err != nil {
+		return nil, priceError("failed to create scheduled price", err)
+	}
+
+	return convertProductPriceToProto(price), nil
+}
+
+func (s *GRPCServer) ListProductPrices(ctx context.Context, req *pb.ListProductPricesRequest) (*pb.ListProductPricesResponse, error) {
+	if req.ProductId == "" {
+		return nil, status.Error(codes.InvalidArgument, "product ID is required")
+	}
+
+	prices, err := s.catalogService.ListProductPrices(ctx, req.ProductId)
+	if err != nil {
+		return nil, priceError("failed to list scheduled prices", err)
+	}
+
+	var pbPrices []*pb.ProductPrice
+	for _, p := range prices {
+		pbPrices = append(pbPrices, convertProductPriceToProto(p))
+	}
+
+	return &pb.ListProductPricesResponse{
+		Prices: pbPrices,
+	}, nil
+}
+
+func (s *GRPCServer) CancelProductPrice(ctx context.Context, req *pb.CancelProductPriceRequest) (*commonv1.Empty, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "scheduled price ID is required")
+	}
+
+	if err := s.catalogService.CancelProductPrice(ctx, req.Id); err != nil {
+		return nil, priceError("failed to cancel scheduled price", err)
+	}
+
+	return &commonv1.Empty{}, nil
+}
+
+func (s *GRPCServer) GetPriceHistory(ctx context.Context, req *pb.GetPriceHistoryRequest) (*pb.PriceHistory, error) {
+	if req.ProductId == "" {
+		return nil, status.Error(codes.InvalidArgument, "product ID is required")
+	}
+
+	if req.Days < 0 {
+		return nil, status.Error(codes.InvalidArgument, "days must not be negative")
+	}
+
+	history, err := s.catalogService.GetPriceHistory(ctx, req.ProductId, int(req.Days))
+	if err != nil {
+		return nil, priceError("failed to get price history", err)
+	}
+
+	resp := &pb.PriceHistory{
+		Days: int32(history.Days),
+	}
+	if history.LowestPriceCents > 0 {
+		resp.LowestPrice = &commonv1.Money{
+			AmountCents: history.LowestPriceCents,
+			Currency:    history.Currency,
+		}
+	}
+	for _, e := range history.Entries {
+		resp.Entries = append(resp.Entries, convertPriceHistoryEntryToProto(e))
+	}
+
+	return resp, nil
+}
+
+func (s *GRPCServer) AdjustStock(ctx context.Context, req *pb.AdjustStockRequest) (*pb.InventoryMovement, error) {
+	if req.ProductId == "" {
+		return nil, status.Error(codes.InvalidArgument, "product ID is required")
+	}
+
+	movement, err := s.catalogService.AdjustStock(ctx, service.StockAdjustment{
+		ProductID:   req.ProductId,
+		VariantID:   req.VariantId,
+		WarehouseID: req.WarehouseId,
+		Quantity:    req.Quantity,
+		Reason:      movementReason(req.Reason),
+		Reference:   req.Reference,
+		Note:        req.Note,
+		ActorID:     req.ActorId,
+	})
+	if err != nil {
+		return nil, inventoryError("failed to adjust stock", err)
+	}
+
+	return convertInventoryMovementToProto(movement), nil
+}
+
+func (s *GRPCServer) ListInventoryMovements(ctx context.Context, req *pb.ListInventoryMovementsRequest) (*pb.ListInventoryMovementsResponse, error) {
+	page, err := pagination.FromProto(req.Pagination, 50)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	filter := repository.MovementFilter{
+		ProductID:   req.ProductId,
+		VariantID:   req.VariantId,
+		WarehouseID: req.WarehouseId,
+		Reason:      movementReason(req.Reason),
+		Reference:   req.Reference,
+	}
+	if req.Since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, req.Since); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "since must be an RFC 3339 time")
+		}
+		filter.Since = filter.Since.UTC()
+	}
+	if req.Until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, req.Until); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "until must be an RFC 3339 time")
+		}
+		filter.Until = filter.Until.UTC()
+	}
+
+	movements, result, err := s.catalogService.ListInventoryMovements(ctx, filter, page)
+	if err != nil {
+		return nil, inventoryError("failed to list inventory movements", err)
+	}
+
+	var pbMovements []*pb.InventoryMovement
+	for _, m := range movements {
+		pbMovements = append(pbMovements, convertInventoryMovementToProto(m))
+	}
+
+	return &pb.ListInventoryMovementsResponse{
+		Movements:  pbMovements,
+		Pagination: pagination.ToProto(page, result),
+	}, nil
+}
+
+func (s *GRPCServer) GetInventoryLevels(ctx context.Context, req *pb.GetInventoryLevelsRequest) (*pb.GetInventoryLevelsResponse, error) {
+	if req.ProductId == "" {
+		return nil, status.Error(codes.InvalidArgument, "product ID is required")
+	}
+
+	levels, err := s.catalogService.GetInventoryLevels(ctx, req.ProductId)
+	if err != nil {
+		return nil, inventoryError("failed to get inventory levels", err)
+	}
+
+	var pbLevels []*pb.InventoryLevel
+	for _, l := range levels {
+		pbLevels = append(pbLevels, &pb.InventoryLevel{
+			WarehouseId:   l.WarehouseID,
+			WarehouseCode: l.WarehouseCode,
+			ProductId:     l.ProductID,
+			VariantId:     l.VariantID.String,
+			OnHand:        l.OnHand,
+			Reserved:      l.Reserved,
+			Available:     l.Available(),
+			UpdatedAt:     l.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		})
+	}
+
+	return &pb.GetInventoryLevelsResponse{
+		Levels: pbLevels,
+	}, nil
+}
+
+func (s *GRPCServer) CreateWarehouse(ctx context.Context, req *pb.CreateWarehouseRequest) (*pb.Warehouse, error) {
+	warehouse, err := s.catalogService.CreateWarehouse(ctx, req.Code, req.Name)
+	if err != nil {
+		return nil, inventoryError("failed to create warehouse", err)
+	}
+
+	return convertWarehouseToProto(warehouse), nil
+}
+
+func (s *GRPCServer) ListWarehouses(ctx context.Context, req *commonv1.Empty) (*pb.ListWarehousesResponse, error) {
+	warehouses, err := s.catalogService.ListWarehouses(ctx)
+	if err != nil {
+		return nil, inventoryError("failed to list warehouses", err)
+	}
+
+	var pbWarehouses []*pb.Warehouse
+	for _, w := range warehouses {
+		pbWarehouses = append(pbWarehouses, convertWarehouseToProto(w))
+	}
+
+	return &pb.ListWarehousesResponse{
+		Warehouses: pbWarehouses,
+	}, nil
+}
+
+func (s *GRPCServer) SetReorderThreshold(ctx context.Context, req *pb.SetReorderThresholdRequest) (*pb.Product, error) {
+	if req.ProductId == "" {
+		return nil, status.Error(codes.InvalidArgument, "product ID is required")
+	}
+
+	product, err := s.catalogService.SetReorderThreshold(ctx, req.ProductId, req.ReorderThreshold)
+	if err != nil {
+		return nil, inventoryError("failed to set reorder threshold", err)
+	}
+
+	return convertProductToProto(product), nil
+}
+
+func (s *GRPCServer) ListLowStockProducts(ctx context.Context, req *pb.ListLowStockProductsRequest) (*pb.ListLowStockProductsResponse, error) {
+	page := int(req.Pagination.GetPage())
+	pageSize := int(req.Pagination.GetPageSize())
+
+	if page <= 0 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 50
+	}
+
+	items, total, err := s.catalogService.ListLowStockProducts(ctx, page, pageSize)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list low-stock products: %v", err)
+	}
+
+	var pbItems []*pb.LowStockItem
+	for _, item := range items {
+		pbItems = append(pbItems, &pb.LowStockItem{
+			ProductId:        item.ProductID,
+			ProductName:      item.ProductName,
+			ProductSlug:      item.ProductSlug,
+			VariantId:        item.VariantID.String,
+			Sku:              item.SKU.String,
+			Available:        item.Available,
+			ReorderThreshold: item.ReorderThreshold,
+			OutOfStock:       item.Available <= 0,
+		})
+	}
+
+	totalPages := int32(math.Ceil(float64(total) / float64(pageSize)))
+
+	return &pb.ListLowStockProductsResponse{
+		Items: pbItems,
+		Pagination: &commonv1.PaginationResponse{
+			Page:       int32(page),
+			PageSize:   int32(pageSize),
+			TotalPages: totalPages,
+			TotalCount: int64(total),
+		},
+	}, nil
+}
+
+func variantPrice(price *commonv1.Money) *service.VariantPrice {
+	if price == nil {
+		return nil
+	}
+	return &service.VariantPrice{AmountCents: price.AmountCents, Currency: price.Currency}
+}
+
+// convertProductToProto converts a product without its options, variants
+// and breadcrumbs. Its price is what it sells at now.
+func convertProductToProto(p *repository.Product) *pb.Product {
+	categoryID := ""
+	if p.CategoryID.Valid {
+		categoryID = p.CategoryID.String
+	}
+
+	pbProduct := &pb.Product{
+		Id:          p.ID,
+		Name:        p.Name,
+		Slug:        p.Slug,
+		Description: p.Description,
+		Price: &commonv1.Money{
+			AmountCents: p.EffectivePriceCents(),
+			Currency:    p.Currency,
+		},
+		CategoryId:       categoryID,
+		ImageUrls:        p.ImageURLs,
+		StockQuantity:    p.StockQuantity,
+		WeightGrams:      p.WeightGrams,
+		ReorderThreshold: p.ReorderThreshold,
+		RatingAverage:    p.RatingAverage,
+		RatingCount:      p.RatingCount,
+		IsActive:         p.IsActive,
+		CreatedAt:        p.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt:        p.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		ListPrice: &commonv1.Money{
+			AmountCents: p.PriceCents,
+			Currency:    p.Currency,
+		},
+	}
+	if compareAt := p.CompareAtPriceCents(); compareAt > 0 {
+		pbProduct.CompareAtPrice = &commonv1.Money{AmountCents: compareAt, Currency: p.Currency}
+	}
+	if p.ScheduledPrice != nil && p.ScheduledPrice.EndsAt.Valid {
+		pbProduct.SaleEndsAt = p.ScheduledPrice.EndsAt.Time.Format("2006-01-02T15:04:05Z")
+	}
+	return pbProduct
+}
+
+func convertProductPriceToProto(p *repository.ProductPrice) *pb.ProductPrice {
+	pbPrice := &pb.ProductPrice{
+		Id:        p.ID,
+		ProductId: p.ProductID,
+		Price: &commonv1.Money{
+			AmountCents: p.PriceCents,
+			Currency:    p.Currency,
+		},
+		StartsAt:  p.StartsAt.Format("2006-01-02T15:04:05Z"),
+		CreatedAt: p.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if p.CompareAtCents.Valid {
+		pbPrice.CompareAtPrice = &commonv1.Money{AmountCents: p.CompareAtCents.Int64, Currency: p.Currency}
+	}
+	if p.EndsAt.Valid {
+		pbPrice.EndsAt = p.EndsAt.Time.Format("2006-01-02T15:04:05Z")
+	}
+	return pbPrice
+}
+
+func convertPriceHistoryEntryToProto(e repository.PriceHistoryEntry) *pb.PriceHistoryEntry {
+	kind := pb.PriceChangeKind_PRICE_CHANGE_KIND_LIST
+	if e.Kind == repository.PriceChangeScheduled {
+		kind = pb.PriceChangeKind_PRICE_CHANGE_KIND_SCHEDULED
+	}
+
+	pbEntry := &pb.PriceHistoryEntry{
+		Kind: kind,
+		Price: &commonv1.Money{
+			AmountCents: e.PriceCents,
+			Currency:    e.Currency,
+		},
+		EffectiveFrom: e.EffectiveFrom.Format("2006-01-02T15:04:05Z"),
+	}
+	if e.CompareAtCents.Valid {
+		pbEntry.CompareAtPrice = &commonv1.Money{AmountCents: e.CompareAtCents.Int64, Currency: e.Currency}
+	}
+	if e.EffectiveUntil.Valid {
+		pbEntry.EffectiveUntil = e.EffectiveUntil.Time.Format("2006-01-02T15:04:05Z")
+	}
+	return pbEntry
+}
+
+func convertInventoryMovementToProto(m *repository.InventoryMovement) *pb.InventoryMovement {
+	return &pb.InventoryMovement{
+		Id:             m.ID,
+		WarehouseId:    m.WarehouseID,
+		ProductId:      m.ProductID,
+		VariantId:      m.VariantID.String,
+		Reason:         movementReasonToProto(m.Reason),
+		OnHandChange:   m.OnHandChange,
+		ReservedChange: m.ReservedChange,
+		Reference:      m.Reference.String,
+		Note:           m.Note.String,
+		CreatedBy:      m.CreatedBy.String,
+		CreatedAt:      m.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+func convertWarehouseToProto(w *repository.Warehouse) *pb.Warehouse {
+	return &pb.Warehouse{
+		Id:        w.ID,
+		Code:      w.Code,
+		Name:      w.Name,
+		IsDefault: w.IsDefault,
+		CreatedAt: w.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+func convertVariantToProto(v *repository.ProductVariant) *pb.ProductVariant {
+	return &pb.ProductVariant{
+		Id:        v.ID,
+		ProductId: v.ProductID,
+		Sku:       v.SKU,
+		Options:   v.Options,
+		Price: &commonv1.Money{
+			AmountCents: v.PriceCents,
+			Currency:    v.Currency,
+		},
+		PriceOverride: v.PriceOverride,
+		StockQuantity: v.StockQuantity,
+		ImageUrls:     v.ImageURLs,
+		IsActive:      v.IsActive,
+		CreatedAt:     v.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt:     v.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+func convertCategoryToProto(c *repository.Category) *pb.Category {
+	parentID := ""
+	if c.ParentID.Valid {
+		parentID = c.ParentID.String
+	}
+
+	return &pb.Category{
+		Id:          c.ID,
+		Name:        c.Name,
+		Slug:        c.Slug,
+		Description: c.Description,
+		ParentId:    parentID,
+		CreatedAt:   c.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+func convertCategoryNodesToProto(nodes []*service.CategoryNode) []*pb.CategoryNode {
+	var pbNodes []*pb.CategoryNode
+	for _, node := range nodes {
+		pbNodes = append(pbNodes, &pb.CategoryNode{
+			Category: convertCategoryToProto(node.Category),
+			Children: convertCategoryNodesToProto(node.Children),
+		})
+	}
+	return pbNodes
+}
+
+func searchSort(sort pb.SearchSort) string {
+	switch sort {
+	case pb.SearchSort_SEARCH_SORT_RELEVANCE:
+		return repository.SearchSortRelevance
+	case pb.SearchSort_SEARCH_SORT_PRICE_ASC:
+		return repository.SearchSortPriceAsc
+	case pb.SearchSort_SEARCH_SORT_PRICE_DESC:
+		return repository.SearchSortPriceDesc
+	case pb.SearchSort_SEARCH_SORT_NEWEST:
+		return repository.SearchSortNewest
+	case pb.SearchSort_SEARCH_SORT_RATING:
+		return repository.SearchSortRating
+	default:
+		return ""
+	}
+}
+
+func convertReviewToProto(r *repository.Review) *pb.Review {
+	return &pb.Review{
+		Id:             r.ID,
+		ProductId:      r.ProductID,
+		UserId:         r.UserID,
+		OrderId:        r.OrderID,
+		Rating:         r.Rating,
+		Title:          r.Title,
+		Body:           r.Body,
+		Status:         reviewStatusToProto(r.Status),
+		ModerationNote: r.ModerationNote,
+		HelpfulCount:   r.HelpfulCount,
+		CreatedAt:      r.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt:      r.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+func reviewStatus(status pb.ReviewStatus) string {
+	switch status {
+	case pb.ReviewStatus_REVIEW_STATUS_PENDING:
+		return repository.ReviewStatusPending
+	case pb.ReviewStatus_REVIEW_STATUS_APPROVED:
+		return repository.ReviewStatusApproved
+	case pb.ReviewStatus_REVIEW_STATUS_REJECTED:
+		return repository.ReviewStatusRejected
+	default:
+		return ""
+	}
+}
+
+func reviewStatusToProto(status string) pb.ReviewStatus {
+	switch status {
+	case repository.ReviewStatusPending:
+		return pb.ReviewStatus_REVIEW_STATUS_PENDING
+	case repository.ReviewStatusApproved:
+		return pb.ReviewStatus_REVIEW_STATUS_APPROVED
+	case repository.ReviewStatusRejected:
+		return pb.ReviewStatus_REVIEW_STATUS_REJECTED
+	default:
+		return pb.ReviewStatus_REVIEW_STATUS_UNSPECIFIED
+	}
+}
+
+// movementReasons maps inventory movement reasons to their repository
+// names.
+var movementReasons = map[pb.InventoryMovementReason]string{
+	pb.InventoryMovementReason_INVENTORY_MOVEMENT_REASON_RECEIPT:     repository.MovementReceipt,
+	pb.InventoryMovementReason_INVENTORY_MOVEMENT_REASON_SALE:        repository.MovementSale,
+	pb.InventoryMovementReason_INVENTORY_MOVEMENT_REASON_RESERVATION: repository.MovementReservation,
+	pb.InventoryMovementReason_INVENTORY_MOVEMENT_REASON_RELEASE:     repository.MovementRelease,
+	pb.InventoryMovementReason_INVENTORY_MOVEMENT_REASON_RETURN:      repository.MovementReturn,
+	pb.InventoryMovementReason_INVENTORY_MOVEMENT_REASON_DAMAGE:      repository.MovementDamage,
+	pb.InventoryMovementReason_INVENTORY_MOVEMENT_REASON_ADJUSTMENT:  repository.MovementAdjustment,
+}
+
+func movementReason(reason pb.InventoryMovementReason) string {
+	return movementReasons[reason]
+}
+
+func movementReasonToProto(reason string) pb.InventoryMovementReason {
+	for pbReason, r := range movementReasons {
+		if r == reason {
+			return pbReason
+		}
+	}
+	return pb.InventoryMovementReason_INVENTORY_MOVEMENT_REASON_UNSPECIFIED
+}
+
+func convertFacetsToProto(facets *repository.SearchFacets) *pb.SearchFacets {
+	pbFacets := &pb.SearchFacets{}
+	for _, f := range facets.Categories {
+		pbFacets.Categories = append(pbFacets.Categories, &pb.CategoryFacet{
+			CategoryId: f.CategoryID,
+			Name:       f.Name,
+			Count:      f.Count,
+		})
+	}
+	for _, f := range facets.PriceRanges {
+		pbFacets.PriceRanges = append(pbFacets.PriceRanges, &pb.PriceFacet{
+			MinPriceCents: f.MinCents,
+			MaxPriceCents: f.MaxCents,
+			Count:         f.Count,
+		})
+	}
+	return pbFacets
+}
+
+func categoryError(msg string, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrCategoryNotFound):
+		return status.Errorf(codes.NotFound, "%s: %v", msg, err)
+	case errors.Is(err, repository.ErrDuplicateCategorySlug):
+		return status.Errorf(codes.AlreadyExists, "%s: %v", msg, err)
+	case errors.Is(err, repository.ErrCategoryCycle), errors.Is(err, repository.ErrCategoryNotEmpty):
+		return status.Errorf(codes.FailedPrecondition, "%s: %v", msg, err)
+	default:
+		return status.Errorf(codes.Internal, "%s: %v", msg, err)
+	}
+}
+
+func variantError(msg string, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrProductNotFound), errors.Is(err, repository.ErrVariantNotFound):
+		return status.Errorf(codes.NotFound, "%s: %v", msg, err)
+	case errors.Is(err, repository.ErrDuplicateSKU):
+		return status.Errorf(codes.AlreadyExists, "%s: %v", msg, err)
+	case errors.Is(err, service.ErrInvalidProductOptions), errors.Is(err, service.ErrInvalidVariantOptions):
+		return status.Errorf(codes.InvalidArgument, "%s: %v", msg, err)
+	default:
+		return status.Errorf(codes.Internal, "%s: %v", msg, err)
+	}
+}
+
+func reservationError(msg string, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrReservationNotFound):
+		return status.Errorf(codes.NotFound, "%s: %v", msg, err)
+	case errors.Is(err, repository.ErrReservationClosed):
+		return status.Errorf(codes.FailedPrecondition, "%s: %v", msg, err)
+	default:
+		return status.Errorf(codes.Internal, "%s: %v", msg, err)
+	}
+}
+
+func reviewError(msg string, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrProductNotFound), errors.Is(err, repository.ErrReviewNotFound):
+		return status.Errorf(codes.NotFound, "%s: %v", msg, err)
+	case errors.Is(err, service.ErrInvalidReview), errors.Is(err, service.ErrInvalidReviewStatus):
+		return status.Errorf(codes.InvalidArgument, "%s: %v", msg, err)
+	case errors.Is(err, service.ErrNotPurchased):
+		return status.Errorf(codes.PermissionDenied, "%s: %v", msg, err)
+	case errors.Is(err, repository.ErrOwnReviewVote):
+		return status.Errorf(codes.FailedPrecondition, "%s: %v", msg, err)
+	default:
+		return status.Errorf(codes.Internal, "%s: %v", msg, err)
+	}
+}
+
+func priceError(msg string, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrProductNotFound), errors.Is(err, repository.ErrPriceNotFound):
+		return status.Errorf(codes.NotFound, "%s: %v", msg, err)
+	case errors.Is(err, repository.ErrPriceOverlap):
+		return status.Errorf(codes.AlreadyExists, "%s: %v", msg, err)
+	case errors.Is(err, repository.ErrPriceEnded):
+		return status.Errorf(codes.FailedPrecondition, "%s: %v", msg, err)
+	case errors.Is(err, service.ErrInvalidProductPrice):
+		return status.Errorf(codes.InvalidArgument, "%s: %v", msg, err)
+	default:
+		return status.Errorf(codes.Internal, "%s: %v", msg, err)
+	}
+}
+
+func inventoryError(msg string, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrProductNotFound), errors.Is(err, repository.ErrVariantNotFound),
+		errors.Is(err, repository.ErrWarehouseNotFound):
+		return status.Errorf(codes.NotFound, "%s: %v", msg, err)
+	case errors.Is(err, repository.ErrDuplicateWarehouseCode):
+		return status.Errorf(codes.AlreadyExists, "%s: %v", msg, err)
+	case errors.Is(err, repository.ErrInsufficientStock):
+		return status.Errorf(codes.FailedPrecondition, "%s: %v", msg, err)
+	case errors.Is(err, service.ErrInvalidStockAdjustment), errors.Is(err, service.ErrInvalidWarehouse),
+		errors.Is(err, service.ErrInvalidReorderThreshold):
+		return status.Errorf(codes.InvalidArgument, "%s: %v", msg, err)
+	default:
+		return status.Errorf(codes.Internal, "%s: %v", msg, err)
+	}
+}
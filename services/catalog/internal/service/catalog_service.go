@@ -2,18 +2,98 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"time"
 
+	"github.com/safar/microservices-demo/services/catalog/internal/client"
 	"github.com/safar/microservices-demo/services/catalog/internal/repository"
+	"github.com/safar/microservices-demo/shared/pagination"
 )
 
+// expiredReservationBatchSize caps how many reservations one sweep releases.
+const expiredReservationBatchSize = 100
+
+var (
+	// ErrInvalidPriceRange is returned when a search's minimum price is
+	// above its maximum.
+	ErrInvalidPriceRange = errors.New("minimum price is above maximum price")
+	// ErrPageTokenSort is returned when products are listed by page token
+	// in an order other than newest first.
+	ErrPageTokenSort = errors.New("page tokens can only list products newest first")
+	// ErrTooManyProducts is returned when more products are looked up at
+	// once than maxProductLookup.
+	ErrTooManyProducts = errors.New("too many products requested at once")
+)
+
+type CatalogStore interface {
+	ListCategories() ([]*repository.Category, error)
+	GetCategory(id string) (*repository.Category, error)
+	ListCategoryAncestors(id string) ([]*repository.Category, error)
+	CreateCategory(name, slug, description, parentID string) (*repository.Category, error)
+	UpdateCategory(id, name, slug, description, parentID string) (*repository.Category, error)
+	DeleteCategory(id string) error
+	CreateProduct(name, slug, description string, priceCents int64, currency, categoryID string, imageURLs []string, stockQuantity, weightGrams int32) (*repository.Product, error)
+	GetProductByID(id string) (*repository.Product, error)
+	GetProductBySlug(slug string) (*repository.Product, error)
+	GetProductsByIDs(ids []string) ([]*repository.Product, error)
+	ListProducts(page pagination.Page, categoryID string, includeDescendants, activeOnly bool, sortOrder string) ([]*repository.Product, pagination.Result, error)
+	SearchProducts(search repository.ProductSearch) ([]*repository.Product, int, *repository.SearchFacets, error)
+	LogSearchQueries(counts []repository.SearchQueryCount) error
+	SuggestProducts(ctx context.Context, prefix string, limit int) ([]*repository.ProductSuggestion, error)
+	SuggestCategories(ctx context.Context, prefix string, limit int) ([]*repository.Category, error)
+	SuggestQueries(ctx context.Context, prefix string, limit int) ([]*repository.QuerySuggestion, error)
+	UpsertProduct(record repository.ProductRecord, categoryID string) (bool, int32, error)
+	ExistingProductStock(slugs []string) (map[string]int32, error)
+	ExportProducts(categoryID string, includeDescendants, activeOnly bool, fn func(*repository.ProductRecord) error) error
+	UpdateProduct(id, name, slug, description string, priceCents int64, currency, categoryID string, imageURLs []string, weightGrams int32, isActive bool) (*repository.Product, error)
+	DeleteProduct(id string) error
+	CheckInventory(productID, variantID string, quantity int32) (bool, error)
+	ReserveInventory(orderID string, items map[repository.InventoryKey]int32, expirationMinutes int32) (string, error)
+	CommitReservation(reservationID string) error
+	ReleaseReservation(reservationID string) error
+	ReleaseOrderReservation(orderID string) error
+	ReleaseExpiredReservations(limit int) (int, error)
+	ListProductOptions(productID string) ([]repository.ProductOption, error)
+	SetProductOptions(productID string, options []repository.ProductOption) error
+	ListVariants(productID string, includeInactive bool) ([]*repository.ProductVariant, error)
+	ListActiveVariantsOfProducts(productIDs []string) (map[string][]*repository.ProductVariant, error)
+	GetVariant(id string) (*repository.ProductVariant, error)
+	CreateVariant(productID, sku string, options map[string]string, priceCents sql.NullInt64, currency string, stockQuantity int32, imageURLs []string) (*repository.ProductVariant, error)
+	UpdateVariant(id, sku string, options map[string]string, priceCents sql.NullInt64, currency string, imageURLs []string, isActive bool) (*repository.ProductVariant, error)
+	DeleteVariant(id string) error
+	CreateProductPrice(productID string, priceCents int64, compareAtCents sql.NullInt64, startsAt time.Time, endsAt sql.NullTime) (*repository.ProductPrice, error)
+	ListProductPrices(productID string) ([]*repository.ProductPrice, error)
+	ActiveProductPrices(productIDs []string) (map[string]*repository.ProductPrice, error)
+	CancelProductPrice(id string) error
+	PriceHistory(productID string) ([]repository.PriceHistoryEntry, error)
+	AdjustStock(movement repository.InventoryMovement) (*repository.InventoryMovement, error)
+	ListInventoryMovements(filter repository.MovementFilter, page pagination.Page) ([]*repository.InventoryMovement, pagination.Result, error)
+	ListInventoryLevels(productID string) ([]*repository.InventoryLevel, error)
+	CreateWarehouse(code, name string) (*repository.Warehouse, error)
+	ListWarehouses() ([]*repository.Warehouse, error)
+	SetReorderThreshold(productID string, threshold int32) (*repository.Product, error)
+	ListLowStockProducts(limit, offset int) ([]*repository.LowStockItem, int, error)
+	UpsertReview(productID, userID, orderID string, rating int32, title, body string) (*repository.Review, error)
+	ListReviews(productID, status, sortOrder string, limit, offset int) ([]*repository.Review, int, error)
+	ModerateReview(id, status, note string) (*repository.Review, error)
+	VoteReview(reviewID, userID string, helpful bool) (*repository.Review, error)
+	DeleteReview(id, userID string) error
+}
+
 type CatalogService struct {
-	repo *repository.CatalogRepository
+	repo      CatalogStore
+	clients   *client.ServiceClients
+	searchLog *searchQueryLog
 }
 
-func NewCatalogService(repo *repository.CatalogRepository) *CatalogService {
+func NewCatalogService(repo CatalogStore, clients *client.ServiceClients) *CatalogService {
 	return &CatalogService{
-		repo: repo,
+		repo:      repo,
+		clients:   clients,
+		searchLog: newSearchQueryLog(),
 	}
 }
 
@@ -27,53 +107,169 @@ func (s *CatalogService) ListCategories(ctx context.Context) ([]*repository.Cate
 }
 
 // Product operations
-func (s *CatalogService) CreateProduct(ctx context.Context, name, slug, description string, priceCents int64, currency, categoryID string, imageURLs []string, stockQuantity int32) (*repository.Product, error) {
-	product, err := s.repo.CreateProduct(name, slug, description, priceCents, currency, categoryID, imageURLs, stockQuantity)
+func (s *CatalogService) CreateProduct(ctx context.Context, name, slug, description string, priceCents int64, currency, categoryID string, imageURLs []string, stockQuantity, weightGrams int32) (*repository.Product, error) {
+	product, err := s.repo.CreateProduct(name, slug, description, priceCents, currency, categoryID, imageURLs, stockQuantity, weightGrams)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create product: %w", err)
 	}
+	if err := s.loadPrices(product); err != nil {
+		return nil, err
+	}
 	return product, nil
 }
 
+// GetProductByID returns a product with its options, active variants,
+// scheduled price in effect and category breadcrumbs.
 func (s *CatalogService) GetProductByID(ctx context.Context, id string) (*repository.Product, error) {
 	product, err := s.repo.GetProductByID(id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get product: %w", err)
 	}
+	if err := s.loadVariants(product); err != nil {
+		return nil, err
+	}
+	if err := s.loadPrices(product); err != nil {
+		return nil, err
+	}
+	if err := s.loadBreadcrumbs(product); err != nil {
+		return nil, err
+	}
 	return product, nil
 }
 
+// GetProductBySlug returns a product with its options, active variants,
+// scheduled price in effect and category breadcrumbs.
 func (s *CatalogService) GetProductBySlug(ctx context.Context, slug string) (*repository.Product, error) {
 	product, err := s.repo.GetProductBySlug(slug)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get product: %w", err)
 	}
+	if err := s.loadVariants(product); err != nil {
+		return nil, err
+	}
+	if err := s.loadPrices(product); err != nil {
+		return nil, err
+	}
+	if err := s.loadBreadcrumbs(product); err != nil {
+		return nil, err
+	}
 	return product, nil
 }
 
-func (s *CatalogService) ListProducts(ctx context.Context, page, pageSize int, categoryID string, activeOnly bool) ([]*repository.Product, int, error) {
-	offset := (page - 1) * pageSize
-	products, total, err := s.repo.ListProducts(pageSize, offset, categoryID, activeOnly)
+// maxProductLookup caps how many products GetProductsByIDs looks up.
+const maxProductLookup = 100
+
+// GetProductsByIDs returns the products of ids that exist, in the order of
+// ids, with their active variants and the scheduled prices in effect. It
+// runs one query for each instead of one set per product, and leaves out
+// options and breadcrumbs, for callers pricing many products at once.
+func (s *CatalogService) GetProductsByIDs(ctx context.Context, ids []string) ([]*repository.Product, error) {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) > maxProductLookup {
+		return nil, ErrTooManyProducts
+	}
+
+	found, err := s.repo.GetProductsByIDs(unique)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to list products: %w", err)
+		return nil, fmt.Errorf("failed to get products: %w", err)
+	}
+
+	byID := make(map[string]*repository.Product, len(found))
+	for _, product := range found {
+		byID[product.ID] = product
 	}
-	return products, total, nil
+	products := make([]*repository.Product, 0, len(found))
+	for _, id := range unique {
+		if product, ok := byID[id]; ok {
+			products = append(products, product)
+		}
+	}
+
+	variants, err := s.repo.ListActiveVariantsOfProducts(unique)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product variants: %w", err)
+	}
+	for _, product := range products {
+		product.Variants = variants[product.ID]
+	}
+
+	if err := s.loadPrices(products...); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// ListProducts returns a page of products in the order of sortOrder,
+// newest first by default. Pages listed by page token must be newest first.
+func (s *CatalogService) ListProducts(ctx context.Context, page pagination.Page, categoryID string, includeDescendants, activeOnly bool, sortOrder string) ([]*repository.Product, pagination.Result, error) {
+	if page.Keyset {
+		switch sortOrder {
+		case repository.SearchSortPriceAsc, repository.SearchSortPriceDesc, repository.SearchSortRating:
+			return nil, pagination.Result{}, ErrPageTokenSort
+		}
+	}
+
+	products, result, err := s.repo.ListProducts(page, categoryID, includeDescendants, activeOnly, sortOrder)
+	if err != nil {
+		return nil, pagination.Result{}, fmt.Errorf("failed to list products: %w", err)
+	}
+	if err := s.loadPrices(products...); err != nil {
+		return nil, pagination.Result{}, err
+	}
+	return products, result, nil
 }
 
-func (s *CatalogService) SearchProducts(ctx context.Context, query string, page, pageSize int, categoryID string) ([]*repository.Product, int, error) {
-	offset := (page - 1) * pageSize
-	products, total, err := s.repo.SearchProducts(query, pageSize, offset, categoryID)
+// SearchProducts returns a page of the products search matches, how many
+// it matches in total, and facet counts over all of them. Without a sort,
+// results are ranked by relevance to the query, or newest first when there
+// is no query. Queries are logged for suggestions when their first page
+// is searched; the log is written in the background by RunSearchQueryLog.
+func (s *CatalogService) SearchProducts(ctx context.Context, search repository.ProductSearch, page, pageSize int) ([]*repository.Product, int, *repository.SearchFacets, error) {
+	if search.MaxPriceCents > 0 && search.MinPriceCents > search.MaxPriceCents {
+		return nil, 0, nil, ErrInvalidPriceRange
+	}
+
+	if search.Sort == "" {
+		search.Sort = repository.SearchSortNewest
+		if search.Query != "" {
+			search.Sort = repository.SearchSortRelevance
+		}
+	}
+	search.Limit = pageSize
+	search.Offset = (page - 1) * pageSize
+
+	products, total, facets, err := s.repo.SearchProducts(search)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to search products: %w", err)
+		return nil, 0, nil, fmt.Errorf("failed to search products: %w", err)
+	}
+	if err := s.loadPrices(products...); err != nil {
+		return nil, 0, nil, err
+	}
+
+	if page == 1 {
+		s.logSearchQuery(search.Query, total)
 	}
-	return products, total, nil
+
+	return products, total, facets, nil
 }
 
-func (s *CatalogService) UpdateProduct(ctx context.Context, id, name, slug, description string, priceCents int64, currency, categoryID string, imageURLs []string, stockQuantity int32, isActive bool) (*repository.Product, error) {
-	product, err := s.repo.UpdateProduct(id, name, slug, description, priceCents, currency, categoryID, imageURLs, stockQuantity, isActive)
+// UpdateProduct replaces a product's fields. Its stock only changes through
+// the inventory ledger.
+func (s *CatalogService) UpdateProduct(ctx context.Context, id, name, slug, description string, priceCents int64, currency, categoryID string, imageURLs []string, weightGrams int32, isActive bool) (*repository.Product, error) {
+	product, err := s.repo.UpdateProduct(id, name, slug, description, priceCents, currency, categoryID, imageURLs, weightGrams, isActive)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update product: %w", err)
 	}
+	if err := s.loadPrices(product); err != nil {
+		return nil, err
+	}
 	return product, nil
 }
 
@@ -85,23 +281,29 @@ func (s *CatalogService) DeleteProduct(ctx context.Context, id string) error {
 }
 
 // Inventory operations
-func (s *CatalogService) CheckInventory(ctx context.Context, items map[string]int32) (bool, []string, error) {
-	var unavailable []string
 
-	for productID, quantity := range items {
-		available, err := s.repo.CheckInventory(productID, quantity)
+// CheckInventory reports whether every item is in stock, returning the ones
+// that are not. A variant that is no longer sold counts as out of stock.
+func (s *CatalogService) CheckInventory(ctx context.Context, items map[repository.InventoryKey]int32) (bool, []repository.InventoryKey, error) {
+	var unavailable []repository.InventoryKey
+
+	for key, quantity := range items {
+		available, err := s.repo.CheckInventory(key.ProductID, key.VariantID, quantity)
+		if errors.Is(err, repository.ErrVariantNotFound) {
+			available, err = false, nil
+		}
 		if err != nil {
-			return false, nil, fmt.Errorf("failed to check inventory for product %s: %w", productID, err)
+			return false, nil, fmt.Errorf("failed to check inventory for product %s: %w", key.ProductID, err)
 		}
 		if !available {
-			unavailable = append(unavailable, productID)
+			unavailable = append(unavailable, key)
 		}
 	}
 
 	return len(unavailable) == 0, unavailable, nil
 }
 
-func (s *CatalogService) ReserveInventory(ctx context.Context, orderID string, items map[string]int32, expirationMinutes int32) (string, error) {
+func (s *CatalogService) ReserveInventory(ctx context.Context, orderID string, items map[repository.InventoryKey]int32, expirationMinutes int32) (string, error) {
 	// First check all items are available
 	available, unavailable, err := s.CheckInventory(ctx, items)
 	if err != nil {
@@ -111,17 +313,73 @@ func (s *CatalogService) ReserveInventory(ctx context.Context, orderID string, i
 		return "", fmt.Errorf("insufficient inventory for products: %v", unavailable)
 	}
 
-	// Reserve each item
-	var reservationID string
-	for productID, quantity := range items {
-		resID, err := s.repo.ReserveInventory(orderID, productID, quantity, expirationMinutes)
+	reservationID, err := s.repo.ReserveInventory(orderID, items, expirationMinutes)
+	if err != nil {
+		return "", fmt.Errorf("failed to reserve inventory: %w", err)
+	}
+
+	return reservationID, nil
+}
+
+func (s *CatalogService) CommitReservation(ctx context.Context, reservationID string) error {
+	if err := s.repo.CommitReservation(reservationID); err != nil {
+		return fmt.Errorf("failed to commit reservation: %w", err)
+	}
+	return nil
+}
+
+func (s *CatalogService) ReleaseReservation(ctx context.Context, reservationID string) error {
+	if err := s.repo.ReleaseReservation(reservationID); err != nil {
+		return fmt.Errorf("failed to release reservation: %w", err)
+	}
+	return nil
+}
+
+// ReleaseOrderStock returns the stock reserved or sold for a cancelled
+// order to inventory. Releasing an order twice is a no-op, so redelivered
+// cancellations are harmless.
+func (s *CatalogService) ReleaseOrderStock(ctx context.Context, orderID string) error {
+	if err := s.repo.ReleaseOrderReservation(orderID); err != nil {
+		return fmt.Errorf("failed to release order reservation: %w", err)
+	}
+	return nil
+}
+
+// ReleaseExpiredReservations returns the stock of every pending reservation
+// past its expiry and reports how many reservations were released.
+func (s *CatalogService) ReleaseExpiredReservations(ctx context.Context) (int, error) {
+	var total int
+	for {
+		released, err := s.repo.ReleaseExpiredReservations(expiredReservationBatchSize)
 		if err != nil {
-			return "", fmt.Errorf("failed to reserve inventory: %w", err)
+			return total, fmt.Errorf("failed to release expired reservations: %w", err)
 		}
-		if reservationID == "" {
-			reservationID = resID
+		total += released
+		if released < expiredReservationBatchSize || ctx.Err() != nil {
+			return total, nil
 		}
 	}
+}
 
-	return reservationID, nil
+// RunReservationSweeper releases expired reservations every interval until
+// ctx is done.
+func (s *CatalogService) RunReservationSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		released, err := s.ReleaseExpiredReservations(ctx)
+		if err != nil {
+			log.Printf("Reservation sweep failed: %v", err)
+		}
+		if released > 0 {
+			log.Printf("Released %d expired reservations", released)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
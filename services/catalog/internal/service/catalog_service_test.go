@@ -2,48 +2,166 @@ package service
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
+	orderpb "github.com/safar/microservices-demo/proto/order/v1"
+	"github.com/safar/microservices-demo/services/catalog/internal/client"
 	"github.com/safar/microservices-demo/services/catalog/internal/repository"
+	"github.com/safar/microservices-demo/shared/pagination"
+	"google.golang.org/grpc"
 )
 
 type mockCatalogRepository struct {
-	listProductsFn     func(limit, offset int, categoryID string, activeOnly bool) error
-	checkInventoryFn   func(productID string, quantity int32) (bool, error)
-	reserveInventoryFn func(orderID, productID string, quantity, expirationMinutes int32) (string, error)
+	listProductsFn     func(page pagination.Page, categoryID string, includeDescendants, activeOnly bool, sortOrder string) error
+	checkInventoryFn   func(productID, variantID string, quantity int32) (bool, error)
+	reserveInventoryFn func(orderID string, items map[repository.InventoryKey]int32, expirationMinutes int32) (string, error)
+	releaseExpiredFn   func(limit int) (int, error)
+	releasedOrders     []string
+	options            []repository.ProductOption
+	variants           []*repository.ProductVariant
+	createdVariants    int
+	categories         []*repository.Category
+	productCategoryID  string
+	products           map[string]*repository.Product
+	searches           []repository.ProductSearch
+	loggedQueries      []repository.SearchQueryCount
+	logSearchErr       error
+	suggestQueriesFn   func(ctx context.Context, prefix string, limit int) ([]*repository.QuerySuggestion, error)
+	existingStock      map[string]int32
+	upserted           map[string]string
+	reviews            []*repository.Review
+	activePrices       map[string]*repository.ProductPrice
+	createdPrices      int
+	movements          []repository.InventoryMovement
+	reorderThresholds  int
 }
 
 func (m *mockCatalogRepository) ListCategories() ([]*repository.Category, error) {
-	return nil, nil
+	return m.categories, nil
+}
+
+func (m *mockCatalogRepository) GetCategory(id string) (*repository.Category, error) {
+	for _, c := range m.categories {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return nil, repository.ErrCategoryNotFound
+}
+
+func (m *mockCatalogRepository) ListCategoryAncestors(id string) ([]*repository.Category, error) {
+	var path []*repository.Category
+	for id != "" {
+		category, err := m.GetCategory(id)
+		if err != nil {
+			return nil, err
+		}
+		path = append([]*repository.Category{category}, path...)
+		id = category.ParentID.String
+	}
+	return path, nil
+}
+
+func (m *mockCatalogRepository) CreateCategory(name, slug, description, parentID string) (*repository.Category, error) {
+	return &repository.Category{Name: name, Slug: slug}, nil
 }
 
-func (m *mockCatalogRepository) CreateProduct(name, slug, description string, priceCents int64, currency, categoryID string, imageURLs []string, stockQuantity int32) (*repository.Product, error) {
+func (m *mockCatalogRepository) UpdateCategory(id, name, slug, description, parentID string) (*repository.Category, error) {
+	return &repository.Category{ID: id, Name: name, Slug: slug}, nil
+}
+
+func (m *mockCatalogRepository) DeleteCategory(id string) error {
+	return nil
+}
+
+func (m *mockCatalogRepository) CreateProduct(name, slug, description string, priceCents int64, currency, categoryID string, imageURLs []string, stockQuantity, weightGrams int32) (*repository.Product, error) {
 	return nil, nil
 }
 
 func (m *mockCatalogRepository) GetProductByID(id string) (*repository.Product, error) {
-	return nil, nil
+	return &repository.Product{
+		ID:         id,
+		CategoryID: sql.NullString{String: m.productCategoryID, Valid: m.productCategoryID != ""},
+	}, nil
 }
 
 func (m *mockCatalogRepository) GetProductBySlug(slug string) (*repository.Product, error) {
 	return nil, nil
 }
 
-func (m *mockCatalogRepository) ListProducts(limit, offset int, categoryID string, activeOnly bool) ([]*repository.Product, int, error) {
+func (m *mockCatalogRepository) GetProductsByIDs(ids []string) ([]*repository.Product, error) {
+	var products []*repository.Product
+	for _, product := range m.products {
+		for _, id := range ids {
+			if product.ID == id {
+				products = append(products, product)
+			}
+		}
+	}
+	return products, nil
+}
+
+func (m *mockCatalogRepository) ListProducts(page pagination.Page, categoryID string, includeDescendants, activeOnly bool, sortOrder string) ([]*repository.Product, pagination.Result, error) {
 	if m.listProductsFn != nil {
-		if err := m.listProductsFn(limit, offset, categoryID, activeOnly); err != nil {
-			return nil, 0, err
+		if err := m.listProductsFn(page, categoryID, includeDescendants, activeOnly, sortOrder); err != nil {
+			return nil, pagination.Result{}, err
 		}
 	}
-	return []*repository.Product{}, 0, nil
+	return []*repository.Product{}, pagination.Result{}, nil
 }
 
-func (m *mockCatalogRepository) SearchProducts(searchQuery string, limit, offset int, categoryID string) ([]*repository.Product, int, error) {
-	return nil, 0, nil
+func (m *mockCatalogRepository) SearchProducts(search repository.ProductSearch) ([]*repository.Product, int, *repository.SearchFacets, error) {
+	m.searches = append(m.searches, search)
+	return nil, 0, &repository.SearchFacets{}, nil
+}
+
+func (m *mockCatalogRepository) LogSearchQueries(counts []repository.SearchQueryCount) error {
+	if m.logSearchErr != nil {
+		return m.logSearchErr
+	}
+	m.loggedQueries = append(m.loggedQueries, counts...)
+	return nil
 }
 
-func (m *mockCatalogRepository) UpdateProduct(id, name, slug, description string, priceCents int64, currency, categoryID string, imageURLs []string, stockQuantity int32, isActive bool) (*repository.Product, error) {
+func (m *mockCatalogRepository) SuggestProducts(ctx context.Context, prefix string, limit int) ([]*repository.ProductSuggestion, error) {
+	return []*repository.ProductSuggestion{{ID: "product-1", Name: "Laptop Stand"}}, nil
+}
+
+func (m *mockCatalogRepository) SuggestCategories(ctx context.Context, prefix string, limit int) ([]*repository.Category, error) {
+	return []*repository.Category{{ID: "laptops", Name: "Laptops"}}, nil
+}
+
+func (m *mockCatalogRepository) SuggestQueries(ctx context.Context, prefix string, limit int) ([]*repository.QuerySuggestion, error) {
+	if m.suggestQueriesFn != nil {
+		return m.suggestQueriesFn(ctx, prefix, limit)
+	}
+	return []*repository.QuerySuggestion{{Query: "laptop", SearchCount: 12}}, nil
+}
+
+func (m *mockCatalogRepository) UpsertProduct(record repository.ProductRecord, categoryID string) (bool, int32, error) {
+	if m.upserted == nil {
+		m.upserted = make(map[string]string)
+	}
+	m.upserted[record.Slug] = categoryID
+	if stockQuantity, ok := m.existingStock[record.Slug]; ok {
+		return false, stockQuantity, nil
+	}
+	return true, record.StockQuantity, nil
+}
+
+func (m *mockCatalogRepository) ExistingProductStock(slugs []string) (map[string]int32, error) {
+	return m.existingStock, nil
+}
+
+func (m *mockCatalogRepository) ExportProducts(categoryID string, includeDescendants, activeOnly bool, fn func(*repository.ProductRecord) error) error {
+	return nil
+}
+
+func (m *mockCatalogRepository) UpdateProduct(id, name, slug, description string, priceCents int64, currency, categoryID string, imageURLs []string, weightGrams int32, isActive bool) (*repository.Product, error) {
 	return nil, nil
 }
 
@@ -51,43 +169,236 @@ func (m *mockCatalogRepository) DeleteProduct(id string) error {
 	return nil
 }
 
-func (m *mockCatalogRepository) CheckInventory(productID string, quantity int32) (bool, error) {
+func (m *mockCatalogRepository) CheckInventory(productID, variantID string, quantity int32) (bool, error) {
 	if m.checkInventoryFn != nil {
-		return m.checkInventoryFn(productID, quantity)
+		return m.checkInventoryFn(productID, variantID, quantity)
 	}
 	return true, nil
 }
 
-func (m *mockCatalogRepository) ReserveInventory(orderID, productID string, quantity, expirationMinutes int32) (string, error) {
+func (m *mockCatalogRepository) ReserveInventory(orderID string, items map[repository.InventoryKey]int32, expirationMinutes int32) (string, error) {
 	if m.reserveInventoryFn != nil {
-		return m.reserveInventoryFn(orderID, productID, quantity, expirationMinutes)
+		return m.reserveInventoryFn(orderID, items, expirationMinutes)
 	}
 	return "res-default", nil
 }
 
+func (m *mockCatalogRepository) CommitReservation(reservationID string) error {
+	return nil
+}
+
+func (m *mockCatalogRepository) ReleaseReservation(reservationID string) error {
+	return nil
+}
+
+func (m *mockCatalogRepository) ReleaseOrderReservation(orderID string) error {
+	m.releasedOrders = append(m.releasedOrders, orderID)
+	return nil
+}
+
+func (m *mockCatalogRepository) ReleaseExpiredReservations(limit int) (int, error) {
+	if m.releaseExpiredFn != nil {
+		return m.releaseExpiredFn(limit)
+	}
+	return 0, nil
+}
+
+func (m *mockCatalogRepository) ListProductOptions(productID string) ([]repository.ProductOption, error) {
+	return m.options, nil
+}
+
+func (m *mockCatalogRepository) SetProductOptions(productID string, options []repository.ProductOption) error {
+	m.options = options
+	return nil
+}
+
+func (m *mockCatalogRepository) ListVariants(productID string, includeInactive bool) ([]*repository.ProductVariant, error) {
+	return m.variants, nil
+}
+
+func (m *mockCatalogRepository) ListActiveVariantsOfProducts(productIDs []string) (map[string][]*repository.ProductVariant, error) {
+	variants := make(map[string][]*repository.ProductVariant)
+	for _, v := range m.variants {
+		if v.IsActive {
+			variants[v.ProductID] = append(variants[v.ProductID], v)
+		}
+	}
+	return variants, nil
+}
+
+func (m *mockCatalogRepository) GetVariant(id string) (*repository.ProductVariant, error) {
+	for _, v := range m.variants {
+		if v.ID == id {
+			return v, nil
+		}
+	}
+	return nil, repository.ErrVariantNotFound
+}
+
+func (m *mockCatalogRepository) CreateVariant(productID, sku string, options map[string]string, priceCents sql.NullInt64, currency string, stockQuantity int32, imageURLs []string) (*repository.ProductVariant, error) {
+	m.createdVariants++
+	return &repository.ProductVariant{ProductID: productID, SKU: sku, Options: options}, nil
+}
+
+func (m *mockCatalogRepository) UpdateVariant(id, sku string, options map[string]string, priceCents sql.NullInt64, currency string, imageURLs []string, isActive bool) (*repository.ProductVariant, error) {
+	return &repository.ProductVariant{ID: id, SKU: sku, Options: options}, nil
+}
+
+func (m *mockCatalogRepository) DeleteVariant(id string) error {
+	return nil
+}
+
+func (m *mockCatalogRepository) CreateProductPrice(productID string, priceCents int64, compareAtCents sql.NullInt64, startsAt time.Time, endsAt sql.NullTime) (*repository.ProductPrice, error) {
+	m.createdPrices++
+	return &repository.ProductPrice{
+		ProductID:      productID,
+		PriceCents:     priceCents,
+		CompareAtCents: compareAtCents,
+		StartsAt:       startsAt,
+		EndsAt:         endsAt,
+	}, nil
+}
+
+func (m *mockCatalogRepository) ListProductPrices(productID string) ([]*repository.ProductPrice, error) {
+	return nil, nil
+}
+
+func (m *mockCatalogRepository) ActiveProductPrices(productIDs []string) (map[string]*repository.ProductPrice, error) {
+	return m.activePrices, nil
+}
+
+func (m *mockCatalogRepository) CancelProductPrice(id string) error {
+	return nil
+}
+
+func (m *mockCatalogRepository) PriceHistory(productID string) ([]repository.PriceHistoryEntry, error) {
+	return nil, nil
+}
+
+func (m *mockCatalogRepository) AdjustStock(movement repository.InventoryMovement) (*repository.InventoryMovement, error) {
+	m.movements = append(m.movements, movement)
+	return &movement, nil
+}
+
+func (m *mockCatalogRepository) ListInventoryMovements(filter repository.MovementFilter, page pagination.Page) ([]*repository.InventoryMovement, pagination.Result, error) {
+	return nil, pagination.Result{}, nil
+}
+
+func (m *mockCatalogRepository) ListInventoryLevels(productID string) ([]*repository.InventoryLevel, error) {
+	return nil, nil
+}
+
+func (m *mockCatalogRepository) CreateWarehouse(code, name string) (*repository.Warehouse, error) {
+	return &repository.Warehouse{Code: code, Name: name}, nil
+}
+
+func (m *mockCatalogRepository) ListWarehouses() ([]*repository.Warehouse, error) {
+	return nil, nil
+}
+
+func (m *mockCatalogRepository) SetReorderThreshold(productID string, threshold int32) (*repository.Product, error) {
+	m.reorderThresholds++
+	return &repository.Product{ID: productID, ReorderThreshold: threshold}, nil
+}
+
+func (m *mockCatalogRepository) ListLowStockProducts(limit, offset int) ([]*repository.LowStockItem, int, error) {
+	return nil, 0, nil
+}
+
+func (m *mockCatalogRepository) UpsertReview(productID, userID, orderID string, rating int32, title, body string) (*repository.Review, error) {
+	review := &repository.Review{
+		ProductID: productID,
+		UserID:    userID,
+		OrderID:   orderID,
+		Rating:    rating,
+		Title:     title,
+		Body:      body,
+		Status:    repository.ReviewStatusPending,
+	}
+	m.reviews = append(m.reviews, review)
+	return review, nil
+}
+
+func (m *mockCatalogRepository) ListReviews(productID, status, sortOrder string, limit, offset int) ([]*repository.Review, int, error) {
+	return m.reviews, len(m.reviews), nil
+}
+
+func (m *mockCatalogRepository) ModerateReview(id, status, note string) (*repository.Review, error) {
+	return &repository.Review{ID: id, Status: status, ModerationNote: note}, nil
+}
+
+func (m *mockCatalogRepository) VoteReview(reviewID, userID string, helpful bool) (*repository.Review, error) {
+	return &repository.Review{ID: reviewID}, nil
+}
+
+func (m *mockCatalogRepository) DeleteReview(id, userID string) error {
+	return nil
+}
+
+type fakeOrderClient struct {
+	orderpb.OrderServiceClient
+	purchases map[string]string
+	checks    int
+}
+
+func (f *fakeOrderClient) HasPurchasedProduct(ctx context.Context, in *orderpb.HasPurchasedProductRequest, opts ...grpc.CallOption) (*orderpb.HasPurchasedProductResponse, error) {
+	f.checks++
+	orderID := f.purchases[in.UserId+"/"+in.ProductId]
+	return &orderpb.HasPurchasedProductResponse{Purchased: orderID != "", OrderId: orderID}, nil
+}
+
 func TestListProductsCalculatesOffset(t *testing.T) {
 	mockRepo := &mockCatalogRepository{
-		listProductsFn: func(limit, offset int, categoryID string, activeOnly bool) error {
-			if limit != 20 || offset != 40 {
+		listProductsFn: func(page pagination.Page, categoryID string, includeDescendants, activeOnly bool, sortOrder string) error {
+			if page.Limit() != 20 || page.Offset() != 40 {
 				return errors.New("unexpected pagination values")
 			}
-			if categoryID != "cat-1" || !activeOnly {
+			if categoryID != "cat-1" || !includeDescendants || !activeOnly {
 				return errors.New("unexpected filter values")
 			}
+			if sortOrder != repository.SearchSortRating {
+				return errors.New("unexpected sort")
+			}
 			return nil
 		},
 	}
 
-	svc := NewCatalogService(mockRepo)
-	_, _, err := svc.ListProducts(context.Background(), 3, 20, "cat-1", true)
+	svc := NewCatalogService(mockRepo, nil)
+	_, _, err := svc.ListProducts(context.Background(), pagination.Page{Number: 3, Size: 20}, "cat-1", true, true, repository.SearchSortRating)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 }
 
+func TestListProductsByPageTokenOnlyListsNewestFirst(t *testing.T) {
+	listed := 0
+	mockRepo := &mockCatalogRepository{
+		listProductsFn: func(page pagination.Page, categoryID string, includeDescendants, activeOnly bool, sortOrder string) error {
+			listed++
+			if page.Limit() != 21 || page.Offset() != 0 {
+				return errors.New("unexpected pagination values")
+			}
+			return nil
+		},
+	}
+
+	svc := NewCatalogService(mockRepo, nil)
+	page := pagination.Page{Size: 20, Keyset: true}
+
+	if _, _, err := svc.ListProducts(context.Background(), page, "", false, true, repository.SearchSortPriceAsc); !errors.Is(err, ErrPageTokenSort) {
+		t.Fatalf("expected ErrPageTokenSort, got %v", err)
+	}
+	if _, _, err := svc.ListProducts(context.Background(), page, "", false, true, ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if listed != 1 {
+		t.Fatalf("expected the repository to be listed once, got %d", listed)
+	}
+}
+
 func TestCheckInventoryReturnsUnavailableItems(t *testing.T) {
 	mockRepo := &mockCatalogRepository{
-		checkInventoryFn: func(productID string, quantity int32) (bool, error) {
+		checkInventoryFn: func(productID, variantID string, quantity int32) (bool, error) {
 			if productID == "prod-2" {
 				return false, nil
 			}
@@ -95,10 +406,10 @@ func TestCheckInventoryReturnsUnavailableItems(t *testing.T) {
 		},
 	}
 
-	svc := NewCatalogService(mockRepo)
-	available, unavailable, err := svc.CheckInventory(context.Background(), map[string]int32{
-		"prod-1": 1,
-		"prod-2": 2,
+	svc := NewCatalogService(mockRepo, nil)
+	available, unavailable, err := svc.CheckInventory(context.Background(), map[repository.InventoryKey]int32{
+		{ProductID: "prod-1"}: 1,
+		{ProductID: "prod-2"}: 2,
 	})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
@@ -106,35 +417,722 @@ func TestCheckInventoryReturnsUnavailableItems(t *testing.T) {
 	if available {
 		t.Fatalf("expected inventory to be unavailable")
 	}
-	if len(unavailable) != 1 || unavailable[0] != "prod-2" {
+	if len(unavailable) != 1 || unavailable[0].ProductID != "prod-2" {
 		t.Fatalf("unexpected unavailable list: %#v", unavailable)
 	}
 }
 
-func TestReserveInventoryUsesFirstReservationID(t *testing.T) {
+func TestReserveInventoryReservesAllItemsUnderOneID(t *testing.T) {
 	var calls int
 	mockRepo := &mockCatalogRepository{
-		checkInventoryFn: func(productID string, quantity int32) (bool, error) {
+		checkInventoryFn: func(productID, variantID string, quantity int32) (bool, error) {
 			return true, nil
 		},
-		reserveInventoryFn: func(orderID, productID string, quantity, expirationMinutes int32) (string, error) {
+		reserveInventoryFn: func(orderID string, items map[repository.InventoryKey]int32, expirationMinutes int32) (string, error) {
 			calls++
-			if calls == 1 {
-				return "res-1", nil
+			if orderID != "order-1" || len(items) != 2 || items[repository.InventoryKey{ProductID: "prod-2"}] != 2 {
+				return "", errors.New("unexpected reservation values")
 			}
-			return "res-2", nil
+			return "res-1", nil
 		},
 	}
 
-	svc := NewCatalogService(mockRepo)
-	reservationID, err := svc.ReserveInventory(context.Background(), "order-1", map[string]int32{
-		"prod-1": 1,
-		"prod-2": 2,
+	svc := NewCatalogService(mockRepo, nil)
+	reservationID, err := svc.ReserveInventory(context.Background(), "order-1", map[repository.InventoryKey]int32{
+		{ProductID: "prod-1"}: 1,
+		{ProductID: "prod-2"}: 2,
 	}, 15)
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
+	if calls != 1 {
+		t.Fatalf("expected a single reservation, got %d", calls)
+	}
 	if reservationID != "res-1" {
-		t.Fatalf("expected first reservation id, got %s", reservationID)
+		t.Fatalf("expected reservation id res-1, got %s", reservationID)
+	}
+}
+
+func TestReleaseExpiredReservationsDrainsBatches(t *testing.T) {
+	batches := []int{expiredReservationBatchSize, expiredReservationBatchSize, 3}
+	var calls int
+	mockRepo := &mockCatalogRepository{
+		releaseExpiredFn: func(limit int) (int, error) {
+			released := batches[calls]
+			calls++
+			return released, nil
+		},
+	}
+
+	svc := NewCatalogService(mockRepo, nil)
+	released, err := svc.ReleaseExpiredReservations(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 batches, got %d", calls)
+	}
+	if released != 2*expiredReservationBatchSize+3 {
+		t.Fatalf("unexpected released count: %d", released)
+	}
+}
+
+func TestCheckInventoryCountsVariantNoLongerSoldAsUnavailable(t *testing.T) {
+	mockRepo := &mockCatalogRepository{
+		checkInventoryFn: func(productID, variantID string, quantity int32) (bool, error) {
+			if variantID == "var-2" {
+				return false, repository.ErrVariantNotFound
+			}
+			return true, nil
+		},
+	}
+
+	svc := NewCatalogService(mockRepo, nil)
+	available, unavailable, err := svc.CheckInventory(context.Background(), map[repository.InventoryKey]int32{
+		{ProductID: "prod-1", VariantID: "var-1"}: 1,
+		{ProductID: "prod-1", VariantID: "var-2"}: 1,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if available {
+		t.Fatalf("expected inventory to be unavailable")
+	}
+	if len(unavailable) != 1 || unavailable[0].VariantID != "var-2" {
+		t.Fatalf("unexpected unavailable list: %#v", unavailable)
+	}
+}
+
+func TestCreateVariantChecksOptionsAgainstProduct(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[string]string
+		wantErr bool
+	}{
+		{name: "every option set", options: map[string]string{"Size": "M", "Colour": "Red"}},
+		{name: "option missing", options: map[string]string{"Size": "M"}, wantErr: true},
+		{name: "value not allowed", options: map[string]string{"Size": "XXL", "Colour": "Red"}, wantErr: true},
+		{name: "unknown option", options: map[string]string{"Size": "M", "Fit": "Slim"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &mockCatalogRepository{
+				options: []repository.ProductOption{
+					{Name: "Size", Values: []string{"S", "M", "L"}},
+					{Name: "Colour", Values: []string{"Red", "Blue"}},
+				},
+			}
+
+			svc := NewCatalogService(mockRepo, nil)
+			_, err := svc.CreateVariant(context.Background(), "prod-1", "TSHIRT-M-RED", tt.options, nil, 5, nil)
+
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidVariantOptions) {
+					t.Fatalf("expected ErrInvalidVariantOptions, got %v", err)
+				}
+				if mockRepo.createdVariants != 0 {
+					t.Fatalf("expected no variant to be created")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if mockRepo.createdVariants != 1 {
+				t.Fatalf("expected a variant to be created, got %d", mockRepo.createdVariants)
+			}
+		})
+	}
+}
+
+func TestSetProductOptionsRejectsOptionsExistingVariantsDoNotMatch(t *testing.T) {
+	mockRepo := &mockCatalogRepository{
+		options: []repository.ProductOption{{Name: "Size", Values: []string{"S", "M"}}},
+		variants: []*repository.ProductVariant{
+			{ID: "var-1", SKU: "TSHIRT-S", Options: map[string]string{"Size": "S"}},
+		},
+	}
+
+	svc := NewCatalogService(mockRepo, nil)
+	err := svc.SetProductOptions(context.Background(), "prod-1", []repository.ProductOption{
+		{Name: "Size", Values: []string{"M", "L"}},
+	})
+	if !errors.Is(err, ErrInvalidVariantOptions) {
+		t.Fatalf("expected ErrInvalidVariantOptions, got %v", err)
+	}
+	if len(mockRepo.options[0].Values) != 2 || mockRepo.options[0].Values[0] != "S" {
+		t.Fatalf("expected options to be left alone, got %+v", mockRepo.options)
+	}
+}
+
+func testCategories() []*repository.Category {
+	category := func(id, name, parentID string) *repository.Category {
+		return &repository.Category{ID: id, Name: name, ParentID: sql.NullString{String: parentID, Valid: parentID != ""}}
+	}
+	// Sorted by name, as the repository lists them
+	return []*repository.Category{
+		category("cat-clothing", "Clothing", ""),
+		category("cat-electronics", "Electronics", ""),
+		category("cat-phones", "Phones", "cat-electronics"),
+		category("cat-shirts", "Shirts", "cat-clothing"),
+		category("cat-tshirts", "T-Shirts", "cat-shirts"),
+	}
+}
+
+func TestGetCategoryTreeNestsSubcategories(t *testing.T) {
+	svc := NewCatalogService(&mockCatalogRepository{categories: testCategories()}, nil)
+
+	roots, err := svc.GetCategoryTree(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(roots) != 2 || roots[0].Category.ID != "cat-clothing" || roots[1].Category.ID != "cat-electronics" {
+		t.Fatalf("expected clothing and electronics at the top, got %+v", roots)
+	}
+	shirts := roots[0].Children
+	if len(shirts) != 1 || shirts[0].Category.ID != "cat-shirts" {
+		t.Fatalf("expected shirts below clothing, got %+v", shirts)
+	}
+	if len(shirts[0].Children) != 1 || shirts[0].Children[0].Category.ID != "cat-tshirts" {
+		t.Fatalf("expected t-shirts below shirts, got %+v", shirts[0].Children)
+	}
+	if len(roots[1].Children) != 1 || roots[1].Children[0].Category.ID != "cat-phones" {
+		t.Fatalf("expected phones below electronics, got %+v", roots[1].Children)
+	}
+}
+
+func TestGetProductByIDLoadsBreadcrumbs(t *testing.T) {
+	svc := NewCatalogService(&mockCatalogRepository{
+		categories:        testCategories(),
+		productCategoryID: "cat-tshirts",
+	}, nil)
+
+	product, err := svc.GetProductByID(context.Background(), "prod-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var path []string
+	for _, c := range product.Breadcrumbs {
+		path = append(path, c.ID)
+	}
+	if len(path) != 3 || path[0] != "cat-clothing" || path[1] != "cat-shirts" || path[2] != "cat-tshirts" {
+		t.Fatalf("expected clothing > shirts > t-shirts, got %v", path)
+	}
+}
+
+func TestUpdateCategoryRejectsItselfAsParent(t *testing.T) {
+	svc := NewCatalogService(&mockCatalogRepository{categories: testCategories()}, nil)
+
+	_, err := svc.UpdateCategory(context.Background(), "cat-shirts", "Shirts", "shirts", "", "cat-shirts")
+	if !errors.Is(err, repository.ErrCategoryCycle) {
+		t.Fatalf("expected ErrCategoryCycle, got %v", err)
+	}
+}
+
+func TestSearchProductsDefaultsSortToRelevanceOnlyWithQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		wantSort string
+	}{
+		{query: "shirt", wantSort: repository.SearchSortRelevance},
+		{query: "", wantSort: repository.SearchSortNewest},
+	}
+
+	for _, tt := range tests {
+		mockRepo := &mockCatalogRepository{}
+		svc := NewCatalogService(mockRepo, nil)
+
+		if _, _, _, err := svc.SearchProducts(context.Background(), repository.ProductSearch{Query: tt.query}, 3, 20); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		got := mockRepo.searches[0]
+		if got.Sort != tt.wantSort || got.Limit != 20 || got.Offset != 40 {
+			t.Fatalf("query %q: expected %s sort at offset 40, got %+v", tt.query, tt.wantSort, got)
+		}
+	}
+}
+
+func TestSearchProductsRejectsInvertedPriceRange(t *testing.T) {
+	mockRepo := &mockCatalogRepository{}
+	svc := NewCatalogService(mockRepo, nil)
+
+	_, _, _, err := svc.SearchProducts(context.Background(), repository.ProductSearch{MinPriceCents: 5000, MaxPriceCents: 1000}, 1, 10)
+	if !errors.Is(err, ErrInvalidPriceRange) {
+		t.Fatalf("expected ErrInvalidPriceRange, got %v", err)
+	}
+	if len(mockRepo.searches) != 0 {
+		t.Fatalf("expected no search to run")
+	}
+}
+
+func TestSearchProductsLogsNormalisedQueryOnFirstPage(t *testing.T) {
+	mockRepo := &mockCatalogRepository{}
+	svc := NewCatalogService(mockRepo, nil)
+
+	for _, query := range []string{"  Laptop   Stand ", "laptop stand"} {
+		for page := 1; page <= 2; page++ {
+			if _, _, _, err := svc.SearchProducts(context.Background(), repository.ProductSearch{Query: query}, page, 10); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		}
+	}
+	if len(mockRepo.loggedQueries) != 0 {
+		t.Fatalf("expected searches to be buffered, got %+v", mockRepo.loggedQueries)
+	}
+
+	if _, err := svc.FlushSearchQueries(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(mockRepo.loggedQueries) != 1 || mockRepo.loggedQueries[0].Query != "laptop stand" || mockRepo.loggedQueries[0].Searches != 2 {
+		t.Fatalf("expected \"laptop stand\" logged with 2 first-page searches, got %+v", mockRepo.loggedQueries)
+	}
+
+	if flushed, _ := svc.FlushSearchQueries(); flushed != 0 {
+		t.Fatalf("expected nothing left to flush, got %d", flushed)
+	}
+}
+
+func TestSearchProductsIgnoresSearchLogFailures(t *testing.T) {
+	mockRepo := &mockCatalogRepository{logSearchErr: errors.New("database unavailable")}
+	svc := NewCatalogService(mockRepo, nil)
+
+	if _, _, _, err := svc.SearchProducts(context.Background(), repository.ProductSearch{Query: "laptop"}, 1, 10); err != nil {
+		t.Fatalf("expected search to succeed, got %v", err)
+	}
+	if _, err := svc.FlushSearchQueries(); err == nil {
+		t.Fatalf("expected the flush to report the failure")
+	}
+}
+
+func TestSuggestProductsSkipsShortPrefixes(t *testing.T) {
+	mockRepo := &mockCatalogRepository{
+		suggestQueriesFn: func(ctx context.Context, prefix string, limit int) ([]*repository.QuerySuggestion, error) {
+			t.Fatalf("expected no lookup for a one-character prefix")
+			return nil, nil
+		},
+	}
+	svc := NewCatalogService(mockRepo, nil)
+
+	suggestions, err := svc.SuggestProducts(context.Background(), " L ", 5)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(suggestions.Products) != 0 || len(suggestions.Categories) != 0 || len(suggestions.Queries) != 0 {
+		t.Fatalf("expected no suggestions, got %+v", suggestions)
+	}
+}
+
+func TestSuggestProductsLeavesOutLookupsOverBudget(t *testing.T) {
+	var gotPrefix string
+	var gotLimit int
+	mockRepo := &mockCatalogRepository{
+		suggestQueriesFn: func(ctx context.Context, prefix string, limit int) ([]*repository.QuerySuggestion, error) {
+			gotPrefix, gotLimit = prefix, limit
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	svc := NewCatalogService(mockRepo, nil)
+
+	suggestions, err := svc.SuggestProducts(context.Background(), "LAPT", 50)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if gotPrefix != "lapt" || gotLimit != maxSuggestLimit {
+		t.Fatalf("expected lookup of \"lapt\" capped at %d, got %q and %d", maxSuggestLimit, gotPrefix, gotLimit)
+	}
+	if len(suggestions.Products) != 1 || len(suggestions.Categories) != 1 {
+		t.Fatalf("expected product and category suggestions, got %+v", suggestions)
+	}
+	if suggestions.Queries != nil {
+		t.Fatalf("expected no query suggestions, got %+v", suggestions.Queries)
+	}
+}
+
+func TestSuggestProductsFailsWhenLookupFailsWithinBudget(t *testing.T) {
+	mockRepo := &mockCatalogRepository{
+		suggestQueriesFn: func(ctx context.Context, prefix string, limit int) ([]*repository.QuerySuggestion, error) {
+			return nil, errors.New("connection refused")
+		},
+	}
+	svc := NewCatalogService(mockRepo, nil)
+
+	if _, err := svc.SuggestProducts(context.Background(), "laptop", 0); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func importRows() []ImportRow {
+	return []ImportRow{
+		{Row: 2, Record: repository.ProductRecord{Slug: "denim-jeans", Name: "Denim Jeans", PriceCents: 4999, CategorySlug: "clothing"}},
+		{Row: 3, Record: repository.ProductRecord{Slug: "smart-watch", Name: "Smart Watch", PriceCents: 39900, Currency: "usd"}},
+		{Row: 4, Record: repository.ProductRecord{Slug: "winter-jacket", Name: "Winter Jacket", PriceCents: 12900, CategorySlug: "outerwear"}},
+		{Row: 5, Record: repository.ProductRecord{Slug: "denim-jeans", Name: "Denim Jeans", PriceCents: 5999}},
+		{Row: 6, Record: repository.ProductRecord{Slug: "cotton-t-shirt", Name: "Cotton T-Shirt", PriceCents: 1999, StockQuantity: 40}},
+		{Row: 7, Record: repository.ProductRecord{Slug: "wool-socks", Name: "Wool Socks", PriceCents: 899, StockQuantity: 12}},
+	}
+}
+
+func TestImportProductsReportsInvalidRowsAndImportsTheRest(t *testing.T) {
+	mockRepo := &mockCatalogRepository{
+		categories:    []*repository.Category{{ID: "cat-clothing", Slug: "clothing"}},
+		existingStock: map[string]int32{"cotton-t-shirt": 25, "wool-socks": 12},
+	}
+	svc := NewCatalogService(mockRepo, nil)
+
+	result, err := svc.ImportProducts(context.Background(), importRows(), false)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if result.TotalRows != 6 || result.Created != 1 || result.Updated != 2 {
+		t.Fatalf("expected 1 created and 2 updated of 6 rows, got %+v", result)
+	}
+
+	wantErrors := map[int]string{
+		3: "currency must be a three-letter code such as USD",
+		4: `category "outerwear" does not exist`,
+		5: "slug is also used by row 2",
+	}
+	if len(result.Errors) != len(wantErrors) {
+		t.Fatalf("expected %d row errors, got %+v", len(wantErrors), result.Errors)
+	}
+	for _, e := range result.Errors {
+		if e.Message != wantErrors[e.Row] {
+			t.Fatalf("row %d: expected %q, got %q", e.Row, wantErrors[e.Row], e.Message)
+		}
+	}
+
+	if len(mockRepo.upserted) != 3 || mockRepo.upserted["denim-jeans"] != "cat-clothing" {
+		t.Fatalf("expected denim-jeans, cotton-t-shirt and wool-socks upserted, got %v", mockRepo.upserted)
+	}
+
+	wantWarning := "stock_quantity 40 was not applied: the product has 25 in stock, which only changes through inventory adjustments"
+	if len(result.Warnings) != 1 || result.Warnings[0].Row != 6 || result.Warnings[0].Message != wantWarning {
+		t.Fatalf("expected row 6 warned that its stock was ignored, got %+v", result.Warnings)
+	}
+}
+
+func TestImportProductsDryRunWritesNothing(t *testing.T) {
+	mockRepo := &mockCatalogRepository{
+		categories:    []*repository.Category{{ID: "cat-clothing", Slug: "clothing"}},
+		existingStock: map[string]int32{"cotton-t-shirt": 25, "wool-socks": 12},
+	}
+	svc := NewCatalogService(mockRepo, nil)
+
+	result, err := svc.ImportProducts(context.Background(), importRows(), true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !result.DryRun || result.Created != 1 || result.Updated != 2 || len(result.Errors) != 3 || len(result.Warnings) != 1 {
+		t.Fatalf("expected the dry run to report 1 created, 2 updated, 3 errors and 1 warning, got %+v", result)
+	}
+	if len(mockRepo.upserted) != 0 {
+		t.Fatalf("expected nothing written, got %v", mockRepo.upserted)
+	}
+}
+
+func TestSubmitReviewRecordsPurchaseOrder(t *testing.T) {
+	mockRepo := &mockCatalogRepository{}
+	orders := &fakeOrderClient{purchases: map[string]string{"user-1/prod-1": "order-1"}}
+	svc := NewCatalogService(mockRepo, &client.ServiceClients{Order: orders})
+
+	review, err := svc.SubmitReview(context.Background(), "prod-1", "user-1", 4, "  Great fit ", "Wore it all summer.")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if review.OrderID != "order-1" || review.Title != "Great fit" || review.Status != repository.ReviewStatusPending {
+		t.Fatalf("expected a pending review of order-1 titled %q, got %+v", "Great fit", review)
+	}
+}
+
+func TestSubmitReviewRequiresPurchase(t *testing.T) {
+	mockRepo := &mockCatalogRepository{}
+	orders := &fakeOrderClient{purchases: map[string]string{"user-1/prod-1": "order-1"}}
+	svc := NewCatalogService(mockRepo, &client.ServiceClients{Order: orders})
+
+	_, err := svc.SubmitReview(context.Background(), "prod-1", "user-2", 5, "Love it", "Best purchase this year.")
+	if !errors.Is(err, ErrNotPurchased) {
+		t.Fatalf("expected ErrNotPurchased, got %v", err)
+	}
+	if len(mockRepo.reviews) != 0 {
+		t.Fatalf("expected no review saved, got %+v", mockRepo.reviews)
+	}
+}
+
+func TestSubmitReviewValidatesBeforeCheckingPurchase(t *testing.T) {
+	tests := []struct {
+		name   string
+		rating int32
+		title  string
+		body   string
+	}{
+		{name: "rating too low", rating: 0, title: "Meh", body: "Fine."},
+		{name: "rating too high", rating: 6, title: "Wow", body: "Amazing."},
+		{name: "blank title", rating: 3, title: "   ", body: "Fine."},
+		{name: "missing body", rating: 3, title: "Meh", body: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orders := &fakeOrderClient{}
+			svc := NewCatalogService(&mockCatalogRepository{}, &client.ServiceClients{Order: orders})
+
+			_, err := svc.SubmitReview(context.Background(), "prod-1", "user-1", tt.rating, tt.title, tt.body)
+			if !errors.Is(err, ErrInvalidReview) {
+				t.Fatalf("expected ErrInvalidReview, got %v", err)
+			}
+			if orders.checks != 0 {
+				t.Fatalf("expected no purchase check for an invalid review")
+			}
+		})
+	}
+}
+
+func TestModerateReviewRejectsUnknownStatus(t *testing.T) {
+	svc := NewCatalogService(&mockCatalogRepository{}, nil)
+
+	if _, err := svc.ModerateReview(context.Background(), "review-1", "", "spam"); !errors.Is(err, ErrInvalidReviewStatus) {
+		t.Fatalf("expected ErrInvalidReviewStatus, got %v", err)
+	}
+}
+
+func TestGetProductByIDAppliesScheduledPriceToInheritingVariants(t *testing.T) {
+	mockRepo := &mockCatalogRepository{
+		variants: []*repository.ProductVariant{
+			{ID: "v-inherit", PriceCents: 2000},
+			{ID: "v-override", PriceCents: 2500, PriceOverride: true},
+		},
+		activePrices: map[string]*repository.ProductPrice{
+			"prod-1": {ProductID: "prod-1", PriceCents: 1500},
+		},
+	}
+	svc := NewCatalogService(mockRepo, nil)
+
+	product, err := svc.GetProductByID(context.Background(), "prod-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if product.EffectivePriceCents() != 1500 {
+		t.Errorf("expected effective price 1500, got %d", product.EffectivePriceCents())
+	}
+	if product.Variants[0].PriceCents != 1500 {
+		t.Errorf("expected inheriting variant at 1500, got %d", product.Variants[0].PriceCents)
+	}
+	if product.Variants[1].PriceCents != 2500 {
+		t.Errorf("expected overriding variant to keep 2500, got %d", product.Variants[1].PriceCents)
+	}
+}
+
+func TestCreateProductPriceValidatesBeforeSaving(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name  string
+		input ProductPriceInput
+	}{
+		{name: "zero price", input: ProductPriceInput{}},
+		{name: "compare-at not above price", input: ProductPriceInput{PriceCents: 1000, CompareAtCents: 1000}},
+		{name: "other currency", input: ProductPriceInput{PriceCents: 1000, Currency: "EUR"}},
+		{name: "starts in the past", input: ProductPriceInput{PriceCents: 1000, StartsAt: now.Add(-time.Hour)}},
+		{name: "ends before it starts", input: ProductPriceInput{PriceCents: 1000, StartsAt: now.Add(time.Hour), EndsAt: now}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &mockCatalogRepository{}
+			svc := NewCatalogService(mockRepo, nil)
+
+			if _, err := svc.CreateProductPrice(context.Background(), "prod-1", tt.input); !errors.Is(err, ErrInvalidProductPrice) {
+				t.Fatalf("expected ErrInvalidProductPrice, got %v", err)
+			}
+			if mockRepo.createdPrices != 0 {
+				t.Fatalf("expected no scheduled price saved")
+			}
+		})
+	}
+}
+
+func TestCreateProductPriceStartsNowByDefault(t *testing.T) {
+	svc := NewCatalogService(&mockCatalogRepository{}, nil)
+
+	price, err := svc.CreateProductPrice(context.Background(), "prod-1", ProductPriceInput{PriceCents: 1000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if time.Since(price.StartsAt) > time.Minute || price.EndsAt.Valid || price.CompareAtCents.Valid {
+		t.Errorf("expected an open-ended price starting now, got %+v", price)
+	}
+}
+
+func TestLowestPriceCentsSkipsOtherCurrencies(t *testing.T) {
+	entries := []repository.PriceHistoryEntry{
+		{PriceCents: 2000, Currency: "USD"},
+		{PriceCents: 900, Currency: "EUR"},
+		{PriceCents: 1500, Currency: "USD"},
+	}
+
+	if got := lowestPriceCents(entries, "USD"); got != 1500 {
+		t.Errorf("expected lowest price 1500, got %d", got)
+	}
+	if got := lowestPriceCents(nil, "USD"); got != 0 {
+		t.Errorf("expected 0 without history, got %d", got)
+	}
+}
+
+func TestAdjustStockValidatesReasonAndQuantity(t *testing.T) {
+	tests := []struct {
+		name       string
+		adjustment StockAdjustment
+	}{
+		{name: "receipt of nothing", adjustment: StockAdjustment{Reason: repository.MovementReceipt}},
+		{name: "negative return", adjustment: StockAdjustment{Reason: repository.MovementReturn, Quantity: -1}},
+		{name: "positive damage", adjustment: StockAdjustment{Reason: repository.MovementDamage, Quantity: 2}},
+		{name: "zero adjustment", adjustment: StockAdjustment{Reason: repository.MovementAdjustment}},
+		{name: "sale", adjustment: StockAdjustment{Reason: repository.MovementSale, Quantity: -1}},
+		{name: "reservation", adjustment: StockAdjustment{Reason: repository.MovementReservation, Quantity: 1}},
+		{name: "unknown reason", adjustment: StockAdjustment{Reason: "lost", Quantity: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := &mockCatalogRepository{}
+			svc := NewCatalogService(mockRepo, nil)
+
+			tt.adjustment.ProductID = "prod-1"
+			if _, err := svc.AdjustStock(context.Background(), tt.adjustment); !errors.Is(err, ErrInvalidStockAdjustment) {
+				t.Fatalf("expected ErrInvalidStockAdjustment, got %v", err)
+			}
+			if len(mockRepo.movements) != 0 {
+				t.Fatalf("expected no movement recorded")
+			}
+		})
+	}
+}
+
+func TestAdjustStockRejectsVariantOfAnotherProduct(t *testing.T) {
+	mockRepo := &mockCatalogRepository{
+		variants: []*repository.ProductVariant{{ID: "v-1", ProductID: "prod-2"}},
+	}
+	svc := NewCatalogService(mockRepo, nil)
+
+	_, err := svc.AdjustStock(context.Background(), StockAdjustment{
+		ProductID: "prod-1",
+		VariantID: "v-1",
+		Quantity:  5,
+		Reason:    repository.MovementReceipt,
+	})
+	if !errors.Is(err, repository.ErrVariantNotFound) {
+		t.Fatalf("expected ErrVariantNotFound, got %v", err)
+	}
+	if len(mockRepo.movements) != 0 {
+		t.Fatalf("expected no movement recorded")
+	}
+}
+
+func TestAdjustStockRecordsActor(t *testing.T) {
+	mockRepo := &mockCatalogRepository{}
+	svc := NewCatalogService(mockRepo, nil)
+
+	_, err := svc.AdjustStock(context.Background(), StockAdjustment{
+		ProductID: "prod-1",
+		Quantity:  -3,
+		Reason:    repository.MovementDamage,
+		Note:      "Water damage",
+		ActorID:   "admin-1",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mockRepo.movements) != 1 {
+		t.Fatalf("expected one movement, got %d", len(mockRepo.movements))
+	}
+	movement := mockRepo.movements[0]
+	if movement.OnHandChange != -3 || movement.ReservedChange != 0 || movement.CreatedBy.String != "admin-1" || movement.VariantID.Valid {
+		t.Errorf("unexpected movement %+v", movement)
+	}
+}
+
+func TestSetReorderThresholdRejectsNegative(t *testing.T) {
+	mockRepo := &mockCatalogRepository{}
+	svc := NewCatalogService(mockRepo, nil)
+
+	if _, err := svc.SetReorderThreshold(context.Background(), "prod-1", -1); !errors.Is(err, ErrInvalidReorderThreshold) {
+		t.Fatalf("expected ErrInvalidReorderThreshold, got %v", err)
+	}
+	if mockRepo.reorderThresholds != 0 {
+		t.Fatalf("expected no reorder threshold saved")
+	}
+
+	product, err := svc.SetReorderThreshold(context.Background(), "prod-1", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if product.ReorderThreshold != 0 {
+		t.Errorf("expected alerts turned off, got threshold %d", product.ReorderThreshold)
+	}
+}
+
+func TestGetProductsByIDsLoadsVariantsAndPricesInRequestOrder(t *testing.T) {
+	mockRepo := &mockCatalogRepository{
+		products: map[string]*repository.Product{
+			"prod-1": {ID: "prod-1", PriceCents: 2000},
+			"prod-2": {ID: "prod-2", PriceCents: 900},
+		},
+		variants: []*repository.ProductVariant{
+			{ID: "var-m", ProductID: "prod-1", PriceCents: 2000, IsActive: true},
+			{ID: "var-l", ProductID: "prod-1", PriceCents: 2400, PriceOverride: true, IsActive: true},
+		},
+		activePrices: map[string]*repository.ProductPrice{
+			"prod-1": {ProductID: "prod-1", PriceCents: 1500},
+		},
+	}
+	svc := NewCatalogService(mockRepo, nil)
+
+	products, err := svc.GetProductsByIDs(context.Background(), []string{"prod-2", "missing", "prod-1", "prod-2"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(products) != 2 || products[0].ID != "prod-2" || products[1].ID != "prod-1" {
+		t.Fatalf("expected prod-2 then prod-1, got %+v", products)
+	}
+	if len(products[0].Variants) != 0 || len(products[1].Variants) != 2 {
+		t.Fatalf("expected only prod-1 to have variants, got %d and %d", len(products[0].Variants), len(products[1].Variants))
+	}
+	if products[1].ScheduledPrice == nil || products[1].Variants[0].PriceCents != 1500 || products[1].Variants[1].PriceCents != 2400 {
+		t.Fatalf("expected the scheduled price on prod-1 and its variant without an override, got %+v", products[1].Variants)
+	}
+}
+
+func TestGetProductsByIDsRejectsTooManyProducts(t *testing.T) {
+	svc := NewCatalogService(&mockCatalogRepository{}, nil)
+
+	ids := make([]string, maxProductLookup+1)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("prod-%d", i)
+	}
+
+	if _, err := svc.GetProductsByIDs(context.Background(), ids); !errors.Is(err, ErrTooManyProducts) {
+		t.Fatalf("expected ErrTooManyProducts, got %v", err)
+	}
+}
+
+func TestReleaseOrderStockReleasesOrderReservation(t *testing.T) {
+	mockRepo := &mockCatalogRepository{}
+	svc := NewCatalogService(mockRepo, nil)
+
+	if err := svc.ReleaseOrderStock(context.Background(), "order-1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(mockRepo.releasedOrders) != 1 || mockRepo.releasedOrders[0] != "order-1" {
+		t.Fatalf("expected the reservation of order-1 to be released, got %v", mockRepo.releasedOrders)
 	}
 }
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/safar/microservices-demo/services/catalog/internal/repository"
+)
+
+// CategoryNode is a category with its subcategories.
+type CategoryNode struct {
+	Category *repository.Category
+	Children []*CategoryNode
+}
+
+// loadBreadcrumbs fills in the path from the root category down to a
+// product's category.
+func (s *CatalogService) loadBreadcrumbs(product *repository.Product) error {
+	if !product.CategoryID.Valid {
+		return nil
+	}
+
+	breadcrumbs, err := s.repo.ListCategoryAncestors(product.CategoryID.String)
+	if err != nil {
+		return fmt.Errorf("failed to get category breadcrumbs: %w", err)
+	}
+
+	product.Breadcrumbs = breadcrumbs
+	return nil
+}
+
+// GetCategoryTree returns the top-level categories with their
+// subcategories below them, each level sorted by name.
+func (s *CatalogService) GetCategoryTree(ctx context.Context) ([]*CategoryNode, error) {
+	categories, err := s.repo.ListCategories()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list categories: %w", err)
+	}
+	return buildCategoryTree(categories), nil
+}
+
+func (s *CatalogService) CreateCategory(ctx context.Context, name, slug, description, parentID string) (*repository.Category, error) {
+	category, err := s.repo.CreateCategory(name, slug, description, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create category: %w", err)
+	}
+	return category, nil
+}
+
+// UpdateCategory updates a category and moves it below parentID, or to the
+// top level if parentID is empty. Moving a category below itself or one of
+// its subcategories fails with repository.ErrCategoryCycle.
+func (s *CatalogService) UpdateCategory(ctx context.Context, id, name, slug, description, parentID string) (*repository.Category, error) {
+	if parentID == id {
+		return nil, repository.ErrCategoryCycle
+	}
+
+	category, err := s.repo.UpdateCategory(id, name, slug, description, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update category: %w", err)
+	}
+	return category, nil
+}
+
+// DeleteCategory deletes a category. Categories that still have
+// subcategories or products fail with repository.ErrCategoryNotEmpty.
+func (s *CatalogService) DeleteCategory(ctx context.Context, id string) error {
+	if err := s.repo.DeleteCategory(id); err != nil {
+		return fmt.Errorf("failed to delete category: %w", err)
+	}
+	return nil
+}
+
+// buildCategoryTree arranges categories under their parents, keeping the
+// order they are given in. Categories whose parent is missing are treated
+// as top-level.
+func buildCategoryTree(categories []*repository.Category) []*CategoryNode {
+	nodes := make(map[string]*CategoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.ID] = &CategoryNode{Category: category}
+	}
+
+	var roots []*CategoryNode
+	for _, category := range categories {
+		node := nodes[category.ID]
+		parent, ok := nodes[category.ParentID.String]
+		if !category.ParentID.Valid || !ok {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+
+	return roots
+}
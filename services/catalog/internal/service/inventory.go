@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/safar/microservices-demo/services/catalog/internal/repository"
+	"github.com/safar/microservices-demo/shared/pagination"
+)
+
+var (
+	// ErrInvalidStockAdjustment is returned when a stock adjustment has a
+	// reason other than a receipt, return, damage or manual adjustment, or
+	// a quantity of the wrong sign for its reason.
+	ErrInvalidStockAdjustment = errors.New("invalid stock adjustment")
+	// ErrInvalidWarehouse is returned when a warehouse has no code or name.
+	ErrInvalidWarehouse = errors.New("warehouse code and name are required")
+)
+
+// StockAdjustment is a change to the stock on hand of a product, or of one
+// of its variants when VariantID is set, at a warehouse, the default one
+// when WarehouseID is empty. Quantity is positive for receipts and returns,
+// negative for damage, and either for manual adjustments. ActorID is who
+// made it.
+type StockAdjustment struct {
+	ProductID   string
+	VariantID   string
+	WarehouseID string
+	Quantity    int32
+	Reason      string
+	Reference   string
+	Note        string
+	ActorID     string
+}
+
+// AdjustStock records a stock adjustment in the inventory ledger. Stock on
+// hand cannot drop below what is reserved for orders.
+func (s *CatalogService) AdjustStock(ctx context.Context, adjustment StockAdjustment) (*repository.InventoryMovement, error) {
+	if err := validateStockAdjustment(adjustment); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.repo.GetProductByID(adjustment.ProductID); err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+	if adjustment.VariantID != "" {
+		variant, err := s.repo.GetVariant(adjustment.VariantID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get variant: %w", err)
+		}
+		if variant.ProductID != adjustment.ProductID {
+			return nil, fmt.Errorf("failed to get variant: %w", repository.ErrVariantNotFound)
+		}
+	}
+
+	movement, err := s.repo.AdjustStock(repository.InventoryMovement{
+		WarehouseID:  adjustment.WarehouseID,
+		ProductID:    adjustment.ProductID,
+		VariantID:    nullString(adjustment.VariantID),
+		Reason:       adjustment.Reason,
+		OnHandChange: adjustment.Quantity,
+		Reference:    nullString(adjustment.Reference),
+		Note:         nullString(adjustment.Note),
+		CreatedBy:    nullString(adjustment.ActorID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to adjust stock: %w", err)
+	}
+	return movement, nil
+}
+
+// ListInventoryMovements returns a page of the inventory ledger entries
+// filter matches, newest first.
+func (s *CatalogService) ListInventoryMovements(ctx context.Context, filter repository.MovementFilter, page pagination.Page) ([]*repository.InventoryMovement, pagination.Result, error) {
+	movements, result, err := s.repo.ListInventoryMovements(filter, page)
+	if err != nil {
+		return nil, pagination.Result{}, fmt.Errorf("failed to list inventory movements: %w", err)
+	}
+	return movements, result, nil
+}
+
+// GetInventoryLevels returns a product's stock and its variants' at each
+// warehouse.
+func (s *CatalogService) GetInventoryLevels(ctx context.Context, productID string) ([]*repository.InventoryLevel, error) {
+	if _, err := s.repo.GetProductByID(productID); err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	levels, err := s.repo.ListInventoryLevels(productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inventory levels: %w", err)
+	}
+	return levels, nil
+}
+
+func (s *CatalogService) CreateWarehouse(ctx context.Context, code, name string) (*repository.Warehouse, error) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	name = strings.TrimSpace(name)
+	if code == "" || name == "" {
+		return nil, ErrInvalidWarehouse
+	}
+
+	warehouse, err := s.repo.CreateWarehouse(code, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create warehouse: %w", err)
+	}
+	return warehouse, nil
+}
+
+func (s *CatalogService) ListWarehouses(ctx context.Context) ([]*repository.Warehouse, error) {
+	warehouses, err := s.repo.ListWarehouses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list warehouses: %w", err)
+	}
+	return warehouses, nil
+}
+
+func validateStockAdjustment(adjustment StockAdjustment) error {
+	switch adjustment.Reason {
+	case repository.MovementReceipt, repository.MovementReturn:
+		if adjustment.Quantity <= 0 {
+			return fmt.Errorf("%w: %s quantity must be positive", ErrInvalidStockAdjustment, adjustment.Reason)
+		}
+	case repository.MovementDamage:
+		if adjustment.Quantity >= 0 {
+			return fmt.Errorf("%w: damage quantity must be negative", ErrInvalidStockAdjustment)
+		}
+	case repository.MovementAdjustment:
+		if adjustment.Quantity == 0 {
+			return fmt.Errorf("%w: adjustment quantity must not be zero", ErrInvalidStockAdjustment)
+		}
+	default:
+		return fmt.Errorf("%w: reason must be receipt, return, damage or adjustment", ErrInvalidStockAdjustment)
+	}
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
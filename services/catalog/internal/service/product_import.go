@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/safar/microservices-demo/services/catalog/internal/repository"
+)
+
+// MaxImportRows caps how many products one import may hold.
+const MaxImportRows = 50000
+
+var (
+	slugPattern     = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// ImportRow is a product to import and the row it came from in the
+// client's file.
+type ImportRow struct {
+	Row    int
+	Record repository.ProductRecord
+}
+
+type ImportRowError struct {
+	Row     int
+	Slug    string
+	Message string
+}
+
+// ImportResult reports an import: how many products were created and
+// updated, or would have been for a dry run, the rows that failed, and the
+// rows that were imported with part of them ignored.
+type ImportResult struct {
+	DryRun    bool
+	TotalRows int
+	Created   int
+	Updated   int
+	Errors    []ImportRowError
+	Warnings  []ImportRowError
+}
+
+// ImportProducts creates or updates a product for every valid row,
+// matching products by slug. Invalid rows are reported and skipped
+// without stopping the import. The stock of an existing product is not
+// changed by an import, so rows giving it a different stock are imported
+// with a warning. A dry run validates every row and counts what would
+// change without writing anything.
+func (s *CatalogService) ImportProducts(ctx context.Context, rows []ImportRow, dryRun bool) (*ImportResult, error) {
+	categories, err := s.repo.ListCategories()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list categories: %w", err)
+	}
+	categoryIDs := make(map[string]string, len(categories))
+	for _, cat := range categories {
+		categoryIDs[cat.Slug] = cat.ID
+	}
+
+	result := &ImportResult{DryRun: dryRun, TotalRows: len(rows)}
+	firstRows := make(map[string]int, len(rows))
+	var valid []ImportRow
+
+	for _, row := range rows {
+		if row.Record.Currency == "" {
+			row.Record.Currency = "USD"
+		}
+
+		problems := validateProductRecord(row.Record, categoryIDs)
+		if first, ok := firstRows[row.Record.Slug]; ok {
+			problems = append(problems, fmt.Sprintf("slug is also used by row %d", first))
+		} else if row.Record.Slug != "" {
+			firstRows[row.Record.Slug] = row.Row
+		}
+
+		if len(problems) > 0 {
+			result.Errors = append(result.Errors, ImportRowError{
+				Row:     row.Row,
+				Slug:    row.Record.Slug,
+				Message: strings.Join(problems, "; "),
+			})
+			continue
+		}
+		valid = append(valid, row)
+	}
+
+	if dryRun {
+		slugs := make([]string, len(valid))
+		for i, row := range valid {
+			slugs[i] = row.Record.Slug
+		}
+		existing, err := s.repo.ExistingProductStock(slugs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check existing products: %w", err)
+		}
+		for _, row := range valid {
+			stockQuantity, ok := existing[row.Record.Slug]
+			if !ok {
+				result.Created++
+				continue
+			}
+			result.Updated++
+			result.warnIgnoredStock(row, stockQuantity)
+		}
+		return result, nil
+	}
+
+	for _, row := range valid {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		created, stockQuantity, err := s.repo.UpsertProduct(row.Record, categoryIDs[row.Record.CategorySlug])
+		if err != nil {
+			result.Errors = append(result.Errors, ImportRowError{Row: row.Row, Slug: row.Record.Slug, Message: err.Error()})
+			continue
+		}
+		if created {
+			result.Created++
+		} else {
+			result.Updated++
+			result.warnIgnoredStock(row, stockQuantity)
+		}
+	}
+
+	return result, nil
+}
+
+// warnIgnoredStock warns that row's stock was not applied to the existing
+// product when it differs from the product's stock.
+func (r *ImportResult) warnIgnoredStock(row ImportRow, stockQuantity int32) {
+	if row.Record.StockQuantity == stockQuantity {
+		return
+	}
+	r.Warnings = append(r.Warnings, ImportRowError{
+		Row:  row.Row,
+		Slug: row.Record.Slug,
+		Message: fmt.Sprintf("stock_quantity %d was not applied: the product has %d in stock, which only changes through inventory adjustments",
+			row.Record.StockQuantity, stockQuantity),
+	})
+}
+
+// validateProductRecord returns what is wrong with an imported product.
+func validateProductRecord(record repository.ProductRecord, categoryIDs map[string]string) []string {
+	var problems []string
+
+	if !slugPattern.MatchString(record.Slug) || len(record.Slug) > 255 {
+		problems = append(problems, "slug must be lowercase letters, digits and single hyphens, at most 255 characters")
+	}
+	if strings.TrimSpace(record.Name) == "" || len(record.Name) > 255 {
+		problems = append(problems, "name is required and must be at most 255 characters")
+	}
+	if record.PriceCents < 0 {
+		problems = append(problems, "price must not be negative")
+	}
+	if !currencyPattern.MatchString(record.Currency) {
+		problems = append(problems, "currency must be a three-letter code such as USD")
+	}
+	if _, ok := categoryIDs[record.CategorySlug]; record.CategorySlug != "" && !ok {
+		problems = append(problems, fmt.Sprintf("category %q does not exist", record.CategorySlug))
+	}
+	if record.StockQuantity < 0 {
+		problems = append(problems, "stock quantity must not be negative")
+	}
+	if record.WeightGrams < 0 {
+		problems = append(problems, "weight must not be negative")
+	}
+
+	return problems
+}
+
+// ExportProducts calls fn with each product, ordered by slug, stopping at
+// the first error fn returns.
+func (s *CatalogService) ExportProducts(ctx context.Context, categoryID string, includeDescendants, activeOnly bool, fn func(*repository.ProductRecord) error) error {
+	if err := s.repo.ExportProducts(categoryID, includeDescendants, activeOnly, fn); err != nil {
+		return fmt.Errorf("failed to export products: %w", err)
+	}
+	return nil
+}
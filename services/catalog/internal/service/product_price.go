@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/safar/microservices-demo/services/catalog/internal/repository"
+)
+
+const (
+	// defaultPriceHistoryDays is how far back price history goes when a
+	// request does not say.
+	defaultPriceHistoryDays = 30
+	// priceStartSkew is how far in the past a scheduled price may start,
+	// to allow for clock differences between the caller and the service.
+	priceStartSkew = time.Minute
+)
+
+// ErrInvalidProductPrice is returned when a scheduled price is not above
+// zero, its compare-at price is not above it, or its window is empty or
+// starts in the past.
+var ErrInvalidProductPrice = errors.New("invalid scheduled price")
+
+// ProductPriceInput is a price to schedule for a product. A zero StartsAt
+// starts it now and a zero EndsAt never ends it.
+type ProductPriceInput struct {
+	PriceCents     int64
+	CompareAtCents int64
+	Currency       string
+	StartsAt       time.Time
+	EndsAt         time.Time
+}
+
+// PriceHistory is the prices a product was sold at over the last Days
+// days, and the lowest of them.
+type PriceHistory struct {
+	Entries          []repository.PriceHistoryEntry
+	LowestPriceCents int64
+	Currency         string
+	Days             int
+}
+
+// loadPrices fills in the scheduled price in effect for each product, and
+// for each of its loaded variants that sells at the product's price.
+func (s *CatalogService) loadPrices(products ...*repository.Product) error {
+	ids := make([]string, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+
+	prices, err := s.repo.ActiveProductPrices(ids)
+	if err != nil {
+		return fmt.Errorf("failed to get scheduled prices: %w", err)
+	}
+
+	for _, product := range products {
+		price, ok := prices[product.ID]
+		if !ok {
+			continue
+		}
+		product.ScheduledPrice = price
+		for _, variant := range product.Variants {
+			if !variant.PriceOverride {
+				variant.PriceCents = price.PriceCents
+			}
+		}
+	}
+	return nil
+}
+
+// CreateProductPrice schedules a price for a product in its currency.
+// Scheduled prices of a product may not overlap.
+func (s *CatalogService) CreateProductPrice(ctx context.Context, productID string, input ProductPriceInput) (*repository.ProductPrice, error) {
+	product, err := s.repo.GetProductByID(productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	now := time.Now()
+	if input.StartsAt.IsZero() {
+		input.StartsAt = now
+	}
+	if err := validateProductPrice(input, product.Currency, now); err != nil {
+		return nil, err
+	}
+
+	// Windows are stored in UTC, like NOW() they are compared to
+	compareAtCents := sql.NullInt64{Int64: input.CompareAtCents, Valid: input.CompareAtCents > 0}
+	endsAt := sql.NullTime{Time: input.EndsAt.UTC(), Valid: !input.EndsAt.IsZero()}
+	price, err := s.repo.CreateProductPrice(productID, input.PriceCents, compareAtCents, input.StartsAt.UTC(), endsAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scheduled price: %w", err)
+	}
+	return price, nil
+}
+
+// ListProductPrices returns every scheduled price of a product, including
+// those that have ended.
+func (s *CatalogService) ListProductPrices(ctx context.Context, productID string) ([]*repository.ProductPrice, error) {
+	if _, err := s.repo.GetProductByID(productID); err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	prices, err := s.repo.ListProductPrices(productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled prices: %w", err)
+	}
+	return prices, nil
+}
+
+// CancelProductPrice deletes a scheduled price that has not started yet,
+// or ends it now if it has.
+func (s *CatalogService) CancelProductPrice(ctx context.Context, id string) error {
+	if err := s.repo.CancelProductPrice(id); err != nil {
+		return fmt.Errorf("failed to cancel scheduled price: %w", err)
+	}
+	return nil
+}
+
+// GetPriceHistory returns the prices a product was sold at over the last
+// days days, 30 by default, and the lowest of them in its currency.
+func (s *CatalogService) GetPriceHistory(ctx context.Context, productID string, days int) (*PriceHistory, error) {
+	if days <= 0 {
+		days = defaultPriceHistoryDays
+	}
+
+	product, err := s.repo.GetProductByID(productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	entries, err := s.repo.PriceHistory(productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get price history: %w", err)
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	history := &PriceHistory{Currency: product.Currency, Days: days}
+	for _, entry := range entries {
+		if entry.EffectiveUntil.Valid && !entry.EffectiveUntil.Time.After(since) {
+			continue
+		}
+		history.Entries = append(history.Entries, entry)
+	}
+	history.LowestPriceCents = lowestPriceCents(history.Entries, product.Currency)
+
+	return history, nil
+}
+
+// lowestPriceCents returns the lowest price in currency among entries, or 0
+// when there is none.
+func lowestPriceCents(entries []repository.PriceHistoryEntry, currency string) int64 {
+	var lowest int64
+	for _, entry := range entries {
+		if entry.Currency != currency {
+			continue
+		}
+		if lowest == 0 || entry.PriceCents < lowest {
+			lowest = entry.PriceCents
+		}
+	}
+	return lowest
+}
+
+func validateProductPrice(input ProductPriceInput, currency string, now time.Time) error {
+	if input.PriceCents <= 0 {
+		return fmt.Errorf("%w: price must be above zero", ErrInvalidProductPrice)
+	}
+	if input.CompareAtCents != 0 && input.CompareAtCents <= input.PriceCents {
+		return fmt.Errorf("%w: compare-at price must be above the price", ErrInvalidProductPrice)
+	}
+	if input.Currency != "" && input.Currency != currency {
+		return fmt.Errorf("%w: currency must be the product's, %s", ErrInvalidProductPrice, currency)
+	}
+	if input.StartsAt.Before(now.Add(-priceStartSkew)) {
+		return fmt.Errorf("%w: start must not be in the past", ErrInvalidProductPrice)
+	}
+	if !input.EndsAt.IsZero() && !input.EndsAt.After(input.StartsAt) {
+		return fmt.Errorf("%w: end must be after the start", ErrInvalidProductPrice)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/safar/microservices-demo/services/catalog/internal/repository"
+)
+
+const (
+	// suggestTimeout is the latency budget of one suggestion request.
+	// Kinds of suggestion not looked up in time are left out.
+	suggestTimeout = 150 * time.Millisecond
+	// minSuggestPrefixLength is the shortest prefix, in characters, that
+	// gets suggestions; shorter ones match too much to be useful.
+	minSuggestPrefixLength = 2
+	defaultSuggestLimit    = 5
+	maxSuggestLimit        = 10
+	// maxLoggedQueryLength keeps logged queries within their column.
+	maxLoggedQueryLength = 255
+	// maxPendingSearchQueries bounds how many distinct queries wait to be
+	// logged; searches for new queries beyond it are not counted.
+	maxPendingSearchQueries = 10000
+)
+
+// Suggestions are search-as-you-type suggestions for a prefix.
+type Suggestions struct {
+	Products   []*repository.ProductSuggestion
+	Categories []*repository.Category
+	Queries    []*repository.QuerySuggestion
+}
+
+// normalizeQuery lowercases a query and collapses its whitespace, so
+// searches differing only in case or spacing are logged as one.
+func normalizeQuery(query string) string {
+	return strings.ToLower(strings.Join(strings.Fields(query), " "))
+}
+
+// searchQueryLog collects searches in memory until they are written to the
+// query log, so searching never waits on the write.
+type searchQueryLog struct {
+	mu      sync.Mutex
+	pending map[string]*repository.SearchQueryCount
+}
+
+func newSearchQueryLog() *searchQueryLog {
+	return &searchQueryLog{pending: make(map[string]*repository.SearchQueryCount)}
+}
+
+func (l *searchQueryLog) add(query string, resultCount int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count, ok := l.pending[query]
+	if !ok {
+		if len(l.pending) >= maxPendingSearchQueries {
+			return
+		}
+		count = &repository.SearchQueryCount{Query: query}
+		l.pending[query] = count
+	}
+	count.Searches++
+	count.ResultCount = resultCount
+}
+
+// take removes and returns the pending counts.
+func (l *searchQueryLog) take() []repository.SearchQueryCount {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	counts := make([]repository.SearchQueryCount, 0, len(l.pending))
+	for _, count := range l.pending {
+		counts = append(counts, *count)
+	}
+	l.pending = make(map[string]*repository.SearchQueryCount)
+	return counts
+}
+
+// logSearchQuery counts a search in the query log that suggestions are
+// ranked by. The count is buffered and written by RunSearchQueryLog.
+func (s *CatalogService) logSearchQuery(query string, resultCount int) {
+	query = normalizeQuery(query)
+	if query == "" || len(query) > maxLoggedQueryLength {
+		return
+	}
+	s.searchLog.add(query, resultCount)
+}
+
+// FlushSearchQueries writes the buffered search counts to the query log and
+// reports how many queries it wrote. Counts that fail to be written are
+// dropped; the log only ranks suggestions.
+func (s *CatalogService) FlushSearchQueries() (int, error) {
+	counts := s.searchLog.take()
+	if len(counts) == 0 {
+		return 0, nil
+	}
+	if err := s.repo.LogSearchQueries(counts); err != nil {
+		return 0, err
+	}
+	return len(counts), nil
+}
+
+// RunSearchQueryLog flushes buffered search counts every interval until ctx
+// is done, and once more on the way out.
+func (s *CatalogService) RunSearchQueryLog(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if _, err := s.FlushSearchQueries(); err != nil {
+				log.Printf("Failed to log search queries: %v", err)
+			}
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := s.FlushSearchQueries(); err != nil {
+			log.Printf("Failed to log search queries: %v", err)
+		}
+	}
+}
+
+// SuggestProducts returns product names, categories and popular past
+// queries matching prefix, tolerating typos. The lookups run concurrently
+// within suggestTimeout; one that does not finish in time is left empty
+// rather than delaying the rest.
+func (s *CatalogService) SuggestProducts(ctx context.Context, prefix string, limit int) (*Suggestions, error) {
+	suggestions := &Suggestions{}
+
+	prefix = normalizeQuery(prefix)
+	if utf8.RuneCountInString(prefix) < minSuggestPrefixLength {
+		return suggestions, nil
+	}
+
+	if limit <= 0 {
+		limit = defaultSuggestLimit
+	}
+	if limit > maxSuggestLimit {
+		limit = maxSuggestLimit
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, suggestTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var productsErr, categoriesErr, queriesErr error
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		suggestions.Products, productsErr = s.repo.SuggestProducts(ctx, prefix, limit)
+	}()
+	go func() {
+		defer wg.Done()
+		suggestions.Categories, categoriesErr = s.repo.SuggestCategories(ctx, prefix, limit)
+	}()
+	go func() {
+		defer wg.Done()
+		suggestions.Queries, queriesErr = s.repo.SuggestQueries(ctx, prefix, limit)
+	}()
+	wg.Wait()
+
+	for _, err := range []error{productsErr, categoriesErr, queriesErr} {
+		// Once the budget is spent, failed lookups are ones that were cut
+		// off, so the suggestions found in time are returned
+		if err != nil && ctx.Err() == nil {
+			return nil, fmt.Errorf("failed to suggest products: %w", err)
+		}
+	}
+	if productsErr != nil {
+		suggestions.Products = nil
+	}
+	if categoriesErr != nil {
+		suggestions.Categories = nil
+	}
+	if queriesErr != nil {
+		suggestions.Queries = nil
+	}
+
+	return suggestions, nil
+}
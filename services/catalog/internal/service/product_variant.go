@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/safar/microservices-demo/services/catalog/internal/repository"
+)
+
+var (
+	// ErrInvalidProductOptions is returned when option types are unnamed,
+	// named twice or have no values, or repeat a value.
+	ErrInvalidProductOptions = errors.New("invalid product options")
+	// ErrInvalidVariantOptions is returned when a variant does not give one
+	// of the allowed values for each of its product's options, and no
+	// others.
+	ErrInvalidVariantOptions = errors.New("variant options do not match the product's options")
+)
+
+// VariantPrice is the price a variant sells at when it does not sell at its
+// product's price.
+type VariantPrice struct {
+	AmountCents int64
+	Currency    string
+}
+
+// loadVariants fills in a product's options and active variants.
+func (s *CatalogService) loadVariants(product *repository.Product) error {
+	options, err := s.repo.ListProductOptions(product.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get product options: %w", err)
+	}
+
+	variants, err := s.repo.ListVariants(product.ID, false)
+	if err != nil {
+		return fmt.Errorf("failed to get product variants: %w", err)
+	}
+
+	product.Options = options
+	product.Variants = variants
+	return nil
+}
+
+// SetProductOptions replaces a product's option types. Every existing
+// variant must match the new options.
+func (s *CatalogService) SetProductOptions(ctx context.Context, productID string, options []repository.ProductOption) error {
+	if err := validateProductOptions(options); err != nil {
+		return err
+	}
+
+	if _, err := s.repo.GetProductByID(productID); err != nil {
+		return fmt.Errorf("failed to get product: %w", err)
+	}
+
+	variants, err := s.repo.ListVariants(productID, true)
+	if err != nil {
+		return fmt.Errorf("failed to get product variants: %w", err)
+	}
+	for _, variant := range variants {
+		if err := validateVariantOptions(options, variant.Options); err != nil {
+			return fmt.Errorf("%w: variant %s", err, variant.SKU)
+		}
+	}
+
+	if err := s.repo.SetProductOptions(productID, options); err != nil {
+		return fmt.Errorf("failed to set product options: %w", err)
+	}
+
+	return nil
+}
+
+// ListVariants returns a product's variants, including those no longer
+// sold if includeInactive is set.
+func (s *CatalogService) ListVariants(ctx context.Context, productID string, includeInactive bool) ([]*repository.ProductVariant, error) {
+	if _, err := s.repo.GetProductByID(productID); err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	variants, err := s.repo.ListVariants(productID, includeInactive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list variants: %w", err)
+	}
+	return variants, nil
+}
+
+// CreateVariant adds a variant to a product. A nil price makes the variant
+// sell at the product's price.
+func (s *CatalogService) CreateVariant(ctx context.Context, productID, sku string, options map[string]string, price *VariantPrice, stockQuantity int32, imageURLs []string) (*repository.ProductVariant, error) {
+	productOptions, err := s.productOptions(productID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateVariantOptions(productOptions, options); err != nil {
+		return nil, err
+	}
+
+	priceCents, currency := variantPrice(price)
+	variant, err := s.repo.CreateVariant(productID, sku, options, priceCents, currency, stockQuantity, imageURLs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create variant: %w", err)
+	}
+	return variant, nil
+}
+
+// UpdateVariant replaces a variant's fields. A nil price makes the variant
+// sell at the product's price. Its stock only changes through the inventory
+// ledger.
+func (s *CatalogService) UpdateVariant(ctx context.Context, id, sku string, options map[string]string, price *VariantPrice, imageURLs []string, isActive bool) (*repository.ProductVariant, error) {
+	variant, err := s.repo.GetVariant(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variant: %w", err)
+	}
+
+	productOptions, err := s.productOptions(variant.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateVariantOptions(productOptions, options); err != nil {
+		return nil, err
+	}
+
+	priceCents, currency := variantPrice(price)
+	updated, err := s.repo.UpdateVariant(id, sku, options, priceCents, currency, imageURLs, isActive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update variant: %w", err)
+	}
+	return updated, nil
+}
+
+func (s *CatalogService) DeleteVariant(ctx context.Context, id string) error {
+	if err := s.repo.DeleteVariant(id); err != nil {
+		return fmt.Errorf("failed to delete variant: %w", err)
+	}
+	return nil
+}
+
+func (s *CatalogService) productOptions(productID string) ([]repository.ProductOption, error) {
+	if _, err := s.repo.GetProductByID(productID); err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	options, err := s.repo.ListProductOptions(productID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product options: %w", err)
+	}
+	return options, nil
+}
+
+func validateProductOptions(options []repository.ProductOption) error {
+	names := make(map[string]bool)
+	for _, option := range options {
+		if option.Name == "" || names[option.Name] {
+			return fmt.Errorf("%w: option names must be set and unique", ErrInvalidProductOptions)
+		}
+		names[option.Name] = true
+
+		if len(option.Values) == 0 {
+			return fmt.Errorf("%w: option %s has no values", ErrInvalidProductOptions, option.Name)
+		}
+		values := make(map[string]bool)
+		for _, value := range option.Values {
+			if value == "" || values[value] {
+				return fmt.Errorf("%w: values of option %s must be set and unique", ErrInvalidProductOptions, option.Name)
+			}
+			values[value] = true
+		}
+	}
+	return nil
+}
+
+// validateVariantOptions checks that values gives an allowed value for each
+// of options and names no other option.
+func validateVariantOptions(options []repository.ProductOption, values map[string]string) error {
+	if len(values) != len(options) {
+		return ErrInvalidVariantOptions
+	}
+
+	for _, option := range options {
+		value, ok := values[option.Name]
+		if !ok {
+			return fmt.Errorf("%w: missing %s", ErrInvalidVariantOptions, option.Name)
+		}
+
+		allowed := false
+		for _, v := range option.Values {
+			if v == value {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%w: %s is not a value of %s", ErrInvalidVariantOptions, value, option.Name)
+		}
+	}
+	return nil
+}
+
+func variantPrice(price *VariantPrice) (sql.NullInt64, string) {
+	if price == nil {
+		return sql.NullInt64{}, ""
+	}
+	return sql.NullInt64{Int64: price.AmountCents, Valid: true}, price.Currency
+}
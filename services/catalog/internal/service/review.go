@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	orderpb "github.com/safar/microservices-demo/proto/order/v1"
+	"github.com/safar/microservices-demo/services/catalog/internal/repository"
+)
+
+const (
+	maxReviewTitleLength = 200
+	maxReviewBodyLength  = 5000
+)
+
+var (
+	// ErrInvalidReview is returned when a review's rating is not from 1 to
+	// 5 stars or its title or body is missing or too long.
+	ErrInvalidReview = errors.New("invalid review")
+	// ErrInvalidReviewStatus is returned when a review is moderated to a
+	// status other than pending, approved or rejected.
+	ErrInvalidReviewStatus = errors.New("invalid review status")
+	// ErrNotPurchased is returned when a user reviews a product they have
+	// not bought.
+	ErrNotPurchased = errors.New("only customers who bought the product can review it")
+)
+
+// SubmitReview saves userID's review of a product they bought, replacing
+// any review they wrote before. The review waits for moderation before it
+// is shown or counts towards the product's rating.
+func (s *CatalogService) SubmitReview(ctx context.Context, productID, userID string, rating int32, title, body string) (*repository.Review, error) {
+	title = strings.TrimSpace(title)
+	body = strings.TrimSpace(body)
+	if err := validateReview(rating, title, body); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.repo.GetProductByID(productID); err != nil {
+		return nil, fmt.Errorf("failed to get product: %w", err)
+	}
+
+	purchase, err := s.clients.Order.HasPurchasedProduct(ctx, &orderpb.HasPurchasedProductRequest{
+		UserId:    userID,
+		ProductId: productID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check purchase: %w", err)
+	}
+	if !purchase.Purchased {
+		return nil, ErrNotPurchased
+	}
+
+	review, err := s.repo.UpsertReview(productID, userID, purchase.OrderId, rating, title, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit review: %w", err)
+	}
+	return review, nil
+}
+
+func validateReview(rating int32, title, body string) error {
+	if rating < 1 || rating > 5 {
+		return fmt.Errorf("%w: rating must be from 1 to 5", ErrInvalidReview)
+	}
+	if title == "" || utf8.RuneCountInString(title) > maxReviewTitleLength {
+		return fmt.Errorf("%w: title is required and must be at most %d characters", ErrInvalidReview, maxReviewTitleLength)
+	}
+	if body == "" || utf8.RuneCountInString(body) > maxReviewBodyLength {
+		return fmt.Errorf("%w: body is required and must be at most %d characters", ErrInvalidReview, maxReviewBodyLength)
+	}
+	return nil
+}
+
+// ListReviews returns a page of reviews and how many there are in total.
+// An empty productID lists reviews of every product and an empty status
+// lists every status.
+func (s *CatalogService) ListReviews(ctx context.Context, productID, status, sortOrder string, page, pageSize int) ([]*repository.Review, int, error) {
+	offset := (page - 1) * pageSize
+	reviews, total, err := s.repo.ListReviews(productID, status, sortOrder, pageSize, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list reviews: %w", err)
+	}
+	return reviews, total, nil
+}
+
+// ModerateReview approves or rejects a review, or sends it back to
+// pending, with a note for its author.
+func (s *CatalogService) ModerateReview(ctx context.Context, id, status, note string) (*repository.Review, error) {
+	switch status {
+	case repository.ReviewStatusPending, repository.ReviewStatusApproved, repository.ReviewStatusRejected:
+	default:
+		return nil, ErrInvalidReviewStatus
+	}
+
+	review, err := s.repo.ModerateReview(id, status, strings.TrimSpace(note))
+	if err != nil {
+		return nil, fmt.Errorf("failed to moderate review: %w", err)
+	}
+	return review, nil
+}
+
+// VoteReview marks an approved review as helpful to userID, or takes their
+// vote back.
+func (s *CatalogService) VoteReview(ctx context.Context, reviewID, userID string, helpful bool) (*repository.Review, error) {
+	review, err := s.repo.VoteReview(reviewID, userID, helpful)
+	if err != nil {
+		return nil, fmt.Errorf("failed to vote on review: %w", err)
+	}
+	return review, nil
+}
+
+// DeleteReview deletes userID's own review.
+func (s *CatalogService) DeleteReview(ctx context.Context, id, userID string) error {
+	if err := s.repo.DeleteReview(id, userID); err != nil {
+		return fmt.Errorf("failed to delete review: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/safar/microservices-demo/services/catalog/internal/repository"
+)
+
+// ErrInvalidReorderThreshold is returned when a reorder threshold is
+// negative.
+var ErrInvalidReorderThreshold = errors.New("reorder threshold must not be negative")
+
+// SetReorderThreshold sets the stock at or below which a product, or each
+// of its variants, is low on stock; 0 turns low-stock alerts off. Alerts
+// are raised when stock drops across it, not when it is set.
+func (s *CatalogService) SetReorderThreshold(ctx context.Context, productID string, threshold int32) (*repository.Product, error) {
+	if threshold < 0 {
+		return nil, ErrInvalidReorderThreshold
+	}
+
+	product, err := s.repo.SetReorderThreshold(productID, threshold)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set reorder threshold: %w", err)
+	}
+	if err := s.loadPrices(product); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// ListLowStockProducts returns a page of the products and variants that
+// are low on or out of stock, the least available first, and how many
+// there are.
+func (s *CatalogService) ListLowStockProducts(ctx context.Context, page, pageSize int) ([]*repository.LowStockItem, int, error) {
+	offset := (page - 1) * pageSize
+	items, total, err := s.repo.ListLowStockProducts(pageSize, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list low-stock products: %w", err)
+	}
+	return items, total, nil
+}
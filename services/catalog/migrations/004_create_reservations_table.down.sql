@@ -0,0 +1,4 @@
+-- Drop reservations table
+DROP INDEX IF EXISTS idx_inventory_reservations_reservation_id;
+ALTER TABLE inventory_reservations DROP COLUMN IF EXISTS reservation_id;
+DROP TABLE IF EXISTS reservations;
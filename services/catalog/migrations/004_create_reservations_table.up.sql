@@ -0,0 +1,25 @@
+-- Create reservations table
+CREATE TABLE IF NOT EXISTS reservations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    order_id UUID NOT NULL UNIQUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
+
+-- Group reservation lines under a single reservation
+ALTER TABLE inventory_reservations ADD COLUMN IF NOT EXISTS reservation_id UUID REFERENCES reservations(id) ON DELETE CASCADE;
+
+INSERT INTO reservations (order_id, expires_at)
+SELECT order_id, MIN(expires_at) FROM inventory_reservations GROUP BY order_id
+ON CONFLICT (order_id) DO NOTHING;
+
+UPDATE inventory_reservations ir
+SET reservation_id = r.id
+FROM reservations r
+WHERE r.order_id = ir.order_id AND ir.reservation_id IS NULL;
+
+-- Create indexes
+CREATE INDEX idx_reservations_status_expires_at ON reservations(status, expires_at);
+CREATE INDEX idx_inventory_reservations_reservation_id ON inventory_reservations(reservation_id);
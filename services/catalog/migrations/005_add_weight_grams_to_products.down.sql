@@ -0,0 +1,2 @@
+-- Drop weight_grams from products
+ALTER TABLE products DROP COLUMN IF EXISTS weight_grams;
@@ -0,0 +1,2 @@
+-- Add weight_grams to products
+ALTER TABLE products ADD COLUMN IF NOT EXISTS weight_grams INT DEFAULT 0 NOT NULL;
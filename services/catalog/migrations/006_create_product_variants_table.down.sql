@@ -0,0 +1,4 @@
+-- Drop product variants and options
+ALTER TABLE inventory_reservations DROP COLUMN IF EXISTS variant_id;
+DROP TABLE IF EXISTS product_variants;
+DROP TABLE IF EXISTS product_options;
@@ -0,0 +1,32 @@
+-- Create product_options table
+CREATE TABLE IF NOT EXISTS product_options (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    "values" TEXT[] NOT NULL,
+    position INT NOT NULL,
+    UNIQUE (product_id, name)
+);
+
+-- Create product_variants table
+CREATE TABLE IF NOT EXISTS product_variants (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    sku VARCHAR(64) UNIQUE NOT NULL,
+    options JSONB DEFAULT '{}' NOT NULL,
+    price_cents BIGINT,
+    currency VARCHAR(3),
+    stock_quantity INT DEFAULT 0 NOT NULL,
+    image_urls TEXT[],
+    is_active BOOLEAN DEFAULT true NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
+
+-- Reserve stock of a variant rather than of its product
+ALTER TABLE inventory_reservations ADD COLUMN IF NOT EXISTS variant_id UUID REFERENCES product_variants(id) ON DELETE CASCADE;
+
+-- Create indexes
+CREATE INDEX idx_product_options_product_id ON product_options(product_id);
+CREATE INDEX idx_product_variants_product_id ON product_variants(product_id);
+CREATE INDEX idx_inventory_reservations_variant_id ON inventory_reservations(variant_id);
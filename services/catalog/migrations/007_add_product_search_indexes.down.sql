@@ -0,0 +1,3 @@
+-- Drop product search indexes
+DROP INDEX IF EXISTS idx_product_variants_options;
+DROP INDEX IF EXISTS idx_products_price_cents;
@@ -0,0 +1,3 @@
+-- Index the columns product search filters and sorts on
+CREATE INDEX IF NOT EXISTS idx_products_price_cents ON products(price_cents);
+CREATE INDEX IF NOT EXISTS idx_product_variants_options ON product_variants USING gin(options jsonb_path_ops);
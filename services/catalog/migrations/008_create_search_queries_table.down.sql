@@ -0,0 +1,3 @@
+-- Drop search_queries table
+DROP INDEX IF EXISTS idx_categories_name_trgm;
+DROP TABLE IF EXISTS search_queries;
@@ -0,0 +1,11 @@
+-- Create search_queries table, one row per normalised query
+CREATE TABLE IF NOT EXISTS search_queries (
+    query VARCHAR(255) PRIMARY KEY,
+    search_count BIGINT DEFAULT 0 NOT NULL,
+    result_count INT DEFAULT 0 NOT NULL,
+    last_searched_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
+
+-- Create indexes
+CREATE INDEX idx_search_queries_query_trgm ON search_queries USING gin(query gin_trgm_ops);
+CREATE INDEX idx_categories_name_trgm ON categories USING gin(name gin_trgm_ops);
@@ -0,0 +1,6 @@
+-- Drop product_reviews and review_votes tables
+DROP INDEX IF EXISTS idx_products_rating;
+ALTER TABLE products DROP COLUMN IF EXISTS rating_count;
+ALTER TABLE products DROP COLUMN IF EXISTS rating_average;
+DROP TABLE IF EXISTS review_votes;
+DROP TABLE IF EXISTS product_reviews;
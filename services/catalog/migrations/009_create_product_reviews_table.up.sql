@@ -0,0 +1,33 @@
+-- Create product_reviews table, one review per customer and product
+CREATE TABLE IF NOT EXISTS product_reviews (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    order_id UUID NOT NULL,
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    title VARCHAR(200) NOT NULL,
+    body TEXT NOT NULL,
+    status VARCHAR(20) DEFAULT 'pending' NOT NULL CHECK (status IN ('pending', 'approved', 'rejected')),
+    moderation_note TEXT,
+    helpful_count INT DEFAULT 0 NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    UNIQUE (product_id, user_id)
+);
+
+-- Create review_votes table, one helpful vote per customer and review
+CREATE TABLE IF NOT EXISTS review_votes (
+    review_id UUID NOT NULL REFERENCES product_reviews(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    PRIMARY KEY (review_id, user_id)
+);
+
+-- Denormalise the rating of approved reviews onto products
+ALTER TABLE products ADD COLUMN IF NOT EXISTS rating_average NUMERIC(3, 2) DEFAULT 0 NOT NULL;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS rating_count INT DEFAULT 0 NOT NULL;
+
+-- Create indexes
+CREATE INDEX idx_product_reviews_product_id_status ON product_reviews(product_id, status, created_at DESC);
+CREATE INDEX idx_product_reviews_status ON product_reviews(status, created_at);
+CREATE INDEX idx_products_rating ON products(rating_average DESC, rating_count DESC);
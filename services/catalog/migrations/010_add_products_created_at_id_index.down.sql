@@ -0,0 +1,2 @@
+-- Drop the keyset pagination index on products
+DROP INDEX IF EXISTS idx_products_created_at_id;
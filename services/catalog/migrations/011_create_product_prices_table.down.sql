@@ -0,0 +1,5 @@
+-- Drop product_prices and product_price_history tables
+DROP TRIGGER IF EXISTS trg_products_list_price_history ON products;
+DROP FUNCTION IF EXISTS record_product_list_price();
+DROP TABLE IF EXISTS product_price_history;
+DROP TABLE IF EXISTS product_prices;
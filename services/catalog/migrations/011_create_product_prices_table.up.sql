@@ -0,0 +1,46 @@
+-- Create product_prices table, prices a product sells at instead of its
+-- list price from starts_at until ends_at (no end when NULL)
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+CREATE TABLE IF NOT EXISTS product_prices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    price_cents BIGINT NOT NULL CHECK (price_cents > 0),
+    compare_at_cents BIGINT CHECK (compare_at_cents > price_cents),
+    currency VARCHAR(3) NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP CHECK (ends_at > starts_at),
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    EXCLUDE USING gist (product_id WITH =, tsrange(starts_at, ends_at) WITH &&)
+);
+
+-- Create product_price_history table, every list price a product was set to
+CREATE TABLE IF NOT EXISTS product_price_history (
+    id BIGSERIAL PRIMARY KEY,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    price_cents BIGINT NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    effective_from TIMESTAMP DEFAULT NOW() NOT NULL
+);
+
+-- Record list price changes however products are written
+CREATE OR REPLACE FUNCTION record_product_list_price() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' OR NEW.price_cents IS DISTINCT FROM OLD.price_cents OR NEW.currency IS DISTINCT FROM OLD.currency THEN
+        INSERT INTO product_price_history (product_id, price_cents, currency)
+        VALUES (NEW.id, NEW.price_cents, NEW.currency);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_products_list_price_history
+AFTER INSERT OR UPDATE OF price_cents, currency ON products
+FOR EACH ROW EXECUTE FUNCTION record_product_list_price();
+
+-- Start the history of existing products with their current list price
+INSERT INTO product_price_history (product_id, price_cents, currency, effective_from)
+SELECT id, price_cents, currency, updated_at FROM products;
+
+-- Create indexes
+CREATE INDEX idx_product_price_history_product_id ON product_price_history(product_id, effective_from DESC);
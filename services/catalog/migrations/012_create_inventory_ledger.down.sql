@@ -0,0 +1,10 @@
+-- Drop the inventory ledger. Stock stays in stock_quantity, less what
+-- pending reservations hold.
+DROP TRIGGER IF EXISTS trg_inventory_movements_append_only ON inventory_movements;
+DROP TRIGGER IF EXISTS trg_inventory_movements_apply ON inventory_movements;
+DROP FUNCTION IF EXISTS reject_inventory_movement_change();
+DROP FUNCTION IF EXISTS apply_inventory_movement();
+ALTER TABLE inventory_reservations DROP COLUMN IF EXISTS warehouse_id;
+DROP TABLE IF EXISTS inventory_levels;
+DROP TABLE IF EXISTS inventory_movements;
+DROP TABLE IF EXISTS warehouses;
@@ -0,0 +1,130 @@
+-- Create warehouses table, the locations stock is held at. Stock without a
+-- location is received into the default warehouse.
+CREATE TABLE IF NOT EXISTS warehouses (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code VARCHAR(50) UNIQUE NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    is_default BOOLEAN DEFAULT false NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_warehouses_default ON warehouses(is_default) WHERE is_default;
+
+INSERT INTO warehouses (code, name, is_default)
+VALUES ('default', 'Main warehouse', true)
+ON CONFLICT (code) DO NOTHING;
+
+-- Create inventory_movements table, the append-only ledger of every change
+-- to on-hand and reserved stock
+CREATE TABLE IF NOT EXISTS inventory_movements (
+    id BIGSERIAL PRIMARY KEY,
+    warehouse_id UUID NOT NULL REFERENCES warehouses(id),
+    product_id UUID NOT NULL REFERENCES products(id),
+    variant_id UUID REFERENCES product_variants(id),
+    reason VARCHAR(20) NOT NULL CHECK (reason IN ('receipt', 'sale', 'reservation', 'release', 'return', 'damage', 'adjustment')),
+    on_hand_change INT DEFAULT 0 NOT NULL,
+    reserved_change INT DEFAULT 0 NOT NULL,
+    reference VARCHAR(255),
+    note TEXT,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    CHECK (on_hand_change <> 0 OR reserved_change <> 0)
+);
+
+CREATE INDEX idx_inventory_movements_product_id ON inventory_movements(product_id, created_at DESC, id DESC);
+CREATE INDEX idx_inventory_movements_warehouse_id ON inventory_movements(warehouse_id, created_at DESC, id DESC);
+CREATE INDEX idx_inventory_movements_reference ON inventory_movements(reference);
+CREATE INDEX idx_inventory_movements_created_at ON inventory_movements(created_at DESC, id DESC);
+
+-- Create inventory_levels table, the stock of each product or variant at
+-- each warehouse as the ledger adds up to
+CREATE TABLE IF NOT EXISTS inventory_levels (
+    warehouse_id UUID NOT NULL REFERENCES warehouses(id),
+    product_id UUID NOT NULL REFERENCES products(id),
+    variant_id UUID REFERENCES product_variants(id),
+    on_hand INT DEFAULT 0 NOT NULL CHECK (on_hand >= 0),
+    reserved INT DEFAULT 0 NOT NULL CHECK (reserved >= 0),
+    updated_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    UNIQUE NULLS NOT DISTINCT (warehouse_id, product_id, variant_id),
+    CHECK (reserved <= on_hand)
+);
+
+CREATE INDEX idx_inventory_levels_product_id ON inventory_levels(product_id);
+
+-- Remember which warehouse each reservation line holds stock at
+ALTER TABLE inventory_reservations ADD COLUMN IF NOT EXISTS warehouse_id UUID REFERENCES warehouses(id);
+
+UPDATE inventory_reservations
+SET warehouse_id = (SELECT id FROM warehouses WHERE is_default)
+WHERE warehouse_id IS NULL;
+
+-- Open the ledger with the current stock at the default warehouse. Stock
+-- held by pending reservations is on hand and reserved.
+INSERT INTO inventory_movements (warehouse_id, product_id, variant_id, reason, on_hand_change, note)
+SELECT w.id, s.product_id, s.variant_id, 'adjustment', s.on_hand, 'Opening balance'
+FROM (
+    SELECT p.id AS product_id, NULL::UUID AS variant_id, p.stock_quantity + COALESCE(SUM(ir.quantity), 0) AS on_hand
+    FROM products p
+    LEFT JOIN inventory_reservations ir ON ir.product_id = p.id AND ir.variant_id IS NULL
+        AND ir.reservation_id IN (SELECT id FROM reservations WHERE status = 'pending')
+    GROUP BY p.id
+    UNION ALL
+    SELECT v.product_id, v.id, v.stock_quantity + COALESCE(SUM(ir.quantity), 0)
+    FROM product_variants v
+    LEFT JOIN inventory_reservations ir ON ir.variant_id = v.id
+        AND ir.reservation_id IN (SELECT id FROM reservations WHERE status = 'pending')
+    GROUP BY v.id
+) s
+CROSS JOIN warehouses w
+WHERE w.is_default AND s.on_hand > 0;
+
+INSERT INTO inventory_movements (warehouse_id, product_id, variant_id, reason, reserved_change, reference, created_at)
+SELECT ir.warehouse_id, ir.product_id, ir.variant_id, 'reservation', ir.quantity, ir.order_id::TEXT, ir.reserved_at
+FROM inventory_reservations ir
+JOIN reservations r ON r.id = ir.reservation_id
+WHERE r.status = 'pending' AND ir.quantity > 0;
+
+INSERT INTO inventory_levels (warehouse_id, product_id, variant_id, on_hand, reserved)
+SELECT warehouse_id, product_id, variant_id, SUM(on_hand_change), SUM(reserved_change)
+FROM inventory_movements
+GROUP BY warehouse_id, product_id, variant_id;
+
+-- Apply each movement to its stock level, and to the stock_quantity
+-- available to sell of its product or variant
+CREATE OR REPLACE FUNCTION apply_inventory_movement() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO inventory_levels (warehouse_id, product_id, variant_id, on_hand, reserved)
+    VALUES (NEW.warehouse_id, NEW.product_id, NEW.variant_id, NEW.on_hand_change, NEW.reserved_change)
+    ON CONFLICT (warehouse_id, product_id, variant_id) DO UPDATE
+    SET on_hand = inventory_levels.on_hand + EXCLUDED.on_hand,
+        reserved = inventory_levels.reserved + EXCLUDED.reserved,
+        updated_at = NOW();
+
+    IF NEW.variant_id IS NULL THEN
+        UPDATE products
+        SET stock_quantity = stock_quantity + NEW.on_hand_change - NEW.reserved_change
+        WHERE id = NEW.product_id;
+    ELSE
+        UPDATE product_variants
+        SET stock_quantity = stock_quantity + NEW.on_hand_change - NEW.reserved_change
+        WHERE id = NEW.variant_id;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_inventory_movements_apply
+AFTER INSERT ON inventory_movements
+FOR EACH ROW EXECUTE FUNCTION apply_inventory_movement();
+
+-- Keep the ledger append-only
+CREATE OR REPLACE FUNCTION reject_inventory_movement_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'inventory movements cannot be changed or deleted';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_inventory_movements_append_only
+BEFORE UPDATE OR DELETE ON inventory_movements
+FOR EACH ROW EXECUTE FUNCTION reject_inventory_movement_change();
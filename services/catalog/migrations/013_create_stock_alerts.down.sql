@@ -0,0 +1,6 @@
+-- Drop stock alerts and reorder thresholds
+DROP TRIGGER IF EXISTS trg_product_variants_stock_alert ON product_variants;
+DROP TRIGGER IF EXISTS trg_products_stock_alert ON products;
+DROP FUNCTION IF EXISTS record_stock_alert();
+DROP TABLE IF EXISTS stock_alerts;
+ALTER TABLE products DROP COLUMN IF EXISTS reorder_threshold;
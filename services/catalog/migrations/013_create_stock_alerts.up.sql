@@ -0,0 +1,72 @@
+-- Stock available to sell at or below which a product, or each of its
+-- variants, is low on stock; 0 for no low-stock alerts
+ALTER TABLE products ADD COLUMN IF NOT EXISTS reorder_threshold INT DEFAULT 0 NOT NULL CHECK (reorder_threshold >= 0);
+
+-- Create stock_alerts table, the outbox of alerts raised when stock drops
+-- to a reorder threshold or runs out. The catalog service publishes them
+-- to the event bus.
+CREATE TABLE IF NOT EXISTS stock_alerts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    product_id UUID NOT NULL REFERENCES products(id),
+    variant_id UUID REFERENCES product_variants(id),
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('low_stock', 'out_of_stock')),
+    available INT NOT NULL,
+    reorder_threshold INT NOT NULL,
+    attempts INT DEFAULT 0 NOT NULL,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    published_at TIMESTAMP
+);
+
+CREATE INDEX idx_stock_alerts_unpublished ON stock_alerts(created_at) WHERE published_at IS NULL;
+
+-- Raise an alert when the stock of an active product or variant drops
+-- across its product's reorder threshold, or to zero. Stock that was
+-- already low does not alert again until it is restocked above it.
+CREATE OR REPLACE FUNCTION record_stock_alert() RETURNS trigger AS $$
+DECLARE
+    alert_product_id UUID;
+    alert_variant_id UUID;
+    threshold INT;
+    active BOOLEAN;
+BEGIN
+    IF NEW.stock_quantity >= OLD.stock_quantity THEN
+        RETURN NEW;
+    END IF;
+
+    IF TG_TABLE_NAME = 'products' THEN
+        alert_product_id := NEW.id;
+        threshold := NEW.reorder_threshold;
+        active := NEW.is_active;
+    ELSE
+        alert_product_id := NEW.product_id;
+        alert_variant_id := NEW.id;
+        SELECT p.reorder_threshold, p.is_active AND NEW.is_active
+        INTO threshold, active
+        FROM products p
+        WHERE p.id = NEW.product_id;
+    END IF;
+
+    IF NOT active THEN
+        RETURN NEW;
+    END IF;
+
+    IF NEW.stock_quantity <= 0 AND OLD.stock_quantity > 0 THEN
+        INSERT INTO stock_alerts (product_id, variant_id, kind, available, reorder_threshold)
+        VALUES (alert_product_id, alert_variant_id, 'out_of_stock', NEW.stock_quantity, threshold);
+    ELSIF NEW.stock_quantity <= threshold AND OLD.stock_quantity > threshold THEN
+        INSERT INTO stock_alerts (product_id, variant_id, kind, available, reorder_threshold)
+        VALUES (alert_product_id, alert_variant_id, 'low_stock', NEW.stock_quantity, threshold);
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_products_stock_alert
+AFTER UPDATE OF stock_quantity ON products
+FOR EACH ROW EXECUTE FUNCTION record_stock_alert();
+
+CREATE TRIGGER trg_product_variants_stock_alert
+AFTER UPDATE OF stock_quantity ON product_variants
+FOR EACH ROW EXECUTE FUNCTION record_stock_alert();
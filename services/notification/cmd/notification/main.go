@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
@@ -11,6 +12,7 @@ import (
 	"github.com/safar/microservices-demo/services/notification/internal/server"
 	"github.com/safar/microservices-demo/services/notification/internal/service"
 	"github.com/safar/microservices-demo/services/notification/internal/smtp"
+	"github.com/safar/microservices-demo/shared/events"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
@@ -32,6 +34,28 @@ func main() {
 	// Initialize service
 	notificationService := service.NewNotificationService(repo, smtpClient)
 
+	// Initialize event bus
+	bus, err := events.Open(cfg.EventBusDriver, cfg.EventBusURL)
+	if err != nil {
+		log.Fatalf("Failed to initialize event bus: %v", err)
+	}
+	defer bus.Close()
+
+	// Send notifications for order events
+	eventHandler := server.NewEventHandler(notificationService, cfg.StockAlertRecipients)
+	go func() {
+		if err := bus.Subscribe(context.Background(), "notification-service", server.OrderEventTypes, eventHandler.HandleOrderEvent); err != nil {
+			log.Printf("Order event subscription stopped: %v", err)
+		}
+	}()
+
+	// Email stock alerts to merchandisers
+	go func() {
+		if err := bus.Subscribe(context.Background(), "notification-service-inventory", server.InventoryEventTypes, eventHandler.HandleInventoryEvent); err != nil {
+			log.Printf("Inventory event subscription stopped: %v", err)
+		}
+	}()
+
 	// Initialize gRPC server
 	grpcServer := server.NewGRPCServer(notificationService)
 
@@ -205,3 +205,25 @@ func (r *NotificationRepository) ListNotifications(email string, limit, offset i
 
 	return notifications, total, nil
 }
+
+// IsEventProcessed reports whether a bus event was already handled.
+func (r *NotificationRepository) IsEventProcessed(eventID string) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS(SELECT 1 FROM processed_events WHERE event_id = $1)`
+	if err := r.db.QueryRow(query, eventID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check processed event: %w", err)
+	}
+	return exists, nil
+}
+
+func (r *NotificationRepository) MarkEventProcessed(eventID, eventType string) error {
+	query := `
+		INSERT INTO processed_events (event_id, event_type)
+		VALUES ($1, $2)
+		ON CONFLICT (event_id) DO NOTHING
+	`
+	if _, err := r.db.Exec(query, eventID, eventType); err != nil {
+		return fmt.Errorf("failed to mark event processed: %w", err)
+	}
+	return nil
+}
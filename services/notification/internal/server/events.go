@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	eventsv1 "github.com/safar/microservices-demo/proto/events/v1"
+	"github.com/safar/microservices-demo/services/notification/internal/service"
+	"github.com/safar/microservices-demo/services/notification/internal/templates"
+	"github.com/safar/microservices-demo/shared/events"
+)
+
+// OrderEventTypes are the order events the notification service reacts to.
+var OrderEventTypes = []string{events.TypeOrderCreated, events.TypeOrderStatusChanged}
+
+// InventoryEventTypes are the stock alerts the notification service emails
+// to merchandisers.
+var InventoryEventTypes = []string{events.TypeStockLow, events.TypeStockOut}
+
+// EventHandler sends notifications for events published by other services.
+type EventHandler struct {
+	notificationService  *service.NotificationService
+	stockAlertRecipients []string
+}
+
+func NewEventHandler(notificationService *service.NotificationService, stockAlertRecipients []string) *EventHandler {
+	return &EventHandler{
+		notificationService:  notificationService,
+		stockAlertRecipients: stockAlertRecipients,
+	}
+}
+
+func (h *EventHandler) HandleOrderEvent(ctx context.Context, event events.Event) error {
+	return h.notificationService.HandleEventOnce(ctx, event.ID, event.Type, func() error {
+		return h.handleOrderEvent(ctx, event)
+	})
+}
+
+func (h *EventHandler) handleOrderEvent(ctx context.Context, event events.Event) error {
+	switch event.Type {
+	case events.TypeOrderCreated:
+		var created eventsv1.OrderCreated
+		if err := event.Decode(&created); err != nil {
+			return err
+		}
+		return h.sendOrderConfirmation(ctx, &created)
+	case events.TypeOrderStatusChanged:
+		var changed eventsv1.OrderStatusChanged
+		if err := event.Decode(&changed); err != nil {
+			return err
+		}
+		return h.sendShippingUpdate(ctx, &changed)
+	default:
+		return nil
+	}
+}
+
+func (h *EventHandler) HandleInventoryEvent(ctx context.Context, event events.Event) error {
+	return h.notificationService.HandleEventOnce(ctx, event.ID, event.Type, func() error {
+		return h.sendStockAlert(ctx, event)
+	})
+}
+
+// sendStockAlert emails a stock alert to each configured recipient. Alerts
+// are dropped when there are no recipients.
+func (h *EventHandler) sendStockAlert(ctx context.Context, event events.Event) error {
+	var alert eventsv1.StockAlert
+	if err := event.Decode(&alert); err != nil {
+		return err
+	}
+
+	data := templates.StockAlertData{
+		ProductName:      alert.ProductName,
+		SKU:              alert.Sku,
+		Available:        alert.Available,
+		ReorderThreshold: alert.ReorderThreshold,
+		OutOfStock:       event.Type == events.TypeStockOut,
+		AlertedAt:        alert.AlertedAt,
+	}
+
+	for _, email := range h.stockAlertRecipients {
+		if err := h.notificationService.SendStockAlert(ctx, data, email); err != nil {
+			return fmt.Errorf("failed to send stock alert: %w", err)
+		}
+	}
+	return nil
+}
+
+func (h *EventHandler) sendOrderConfirmation(ctx context.Context, created *eventsv1.OrderCreated) error {
+	var items []templates.OrderItem
+	for _, item := range created.Items {
+		items = append(items, templates.OrderItem{
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			UnitPrice:   formatMoney(item.UnitPrice),
+			TotalPrice:  formatMoney(item.TotalPrice),
+		})
+	}
+
+	data := templates.OrderConfirmationData{
+		FirstName:  "User", // Would come from user service
+		OrderID:    created.OrderId,
+		OrderDate:  created.CreatedAt,
+		Items:      items,
+		Subtotal:   formatMoney(created.Subtotal),
+		Shipping:   formatMoney(created.Shipping),
+		Tax:        formatMoney(created.Tax),
+		Discount:   formatMoney(created.Discount),
+		CouponCode: created.CouponCode,
+		Total:      formatMoney(created.Total),
+	}
+	if addr := created.ShippingAddress; addr != nil {
+		data.ShippingAddress = templates.Address{
+			Street:  addr.Street,
+			City:    addr.City,
+			State:   addr.State,
+			ZipCode: addr.ZipCode,
+			Country: addr.Country,
+		}
+	}
+
+	if err := h.notificationService.SendOrderConfirmation(ctx, data, "user@example.com"); err != nil {
+		return fmt.Errorf("failed to send order confirmation: %w", err)
+	}
+	return nil
+}
+
+// sendShippingUpdate notifies the customer once an order ships or is
+// delivered; other status changes are not emailed.
+func (h *EventHandler) sendShippingUpdate(ctx context.Context, changed *eventsv1.OrderStatusChanged) error {
+	if changed.NewStatus != "shipped" && changed.NewStatus != "delivered" {
+		return nil
+	}
+
+	data := templates.ShippingUpdateData{
+		FirstName:      "User", // Would come from user service
+		OrderID:        changed.OrderId,
+		TrackingNumber: changed.TrackingNumber,
+		Status:         changed.NewStatus,
+	}
+
+	if err := h.notificationService.SendShippingUpdate(ctx, data, "user@example.com"); err != nil {
+		return fmt.Errorf("failed to send shipping update: %w", err)
+	}
+	return nil
+}
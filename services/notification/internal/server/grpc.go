@@ -141,6 +141,42 @@ func (s *GRPCServer) SendPasswordReset(ctx context.Context, req *pb.SendPassword
 	return &commonv1.Empty{}, nil
 }
 
+func (s *GRPCServer) SendCartReminder(ctx context.Context, req *pb.SendCartReminderRequest) (*commonv1.Empty, error) {
+	if req.Email == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	if len(req.Items) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "items are required")
+	}
+
+	// Convert proto items to template items
+	var items []templates.OrderItem
+	for _, item := range req.Items {
+		items = append(items, templates.OrderItem{
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			UnitPrice:   formatMoney(item.UnitPrice),
+			TotalPrice:  formatMoney(item.TotalPrice),
+		})
+	}
+
+	// Prepare template data
+	data := templates.CartReminderData{
+		FirstName: req.FirstName,
+		Items:     items,
+		Total:     formatMoney(req.Total),
+		CartURL:   "http://localhost:3000/cart",
+	}
+
+	err := s.notificationService.SendCartReminder(ctx, data, req.Email)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to send cart reminder: %v", err)
+	}
+
+	return &commonv1.Empty{}, nil
+}
+
 func formatMoney(money *commonv1.Money) string {
 	if money == nil {
 		return "$0.00"
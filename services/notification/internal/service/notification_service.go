@@ -146,6 +146,75 @@ func (s *NotificationService) SendPasswordReset(ctx context.Context, data templa
 	return nil
 }
 
+func (s *NotificationService) SendCartReminder(ctx context.Context, data templates.CartReminderData, email string) error {
+	// Render email template
+	body, err := templates.RenderCartReminder(data)
+	if err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+
+	subject := "Your cart is waiting for you"
+
+	// Create notification record
+	notification := &repository.Notification{
+		RecipientEmail: email,
+		RecipientName:  data.FirstName,
+		Type:           "cart_reminder",
+		Subject:        subject,
+		Body:           body,
+		Status:         "pending",
+		RetryCount:     0,
+	}
+
+	createdNotification, err := s.repo.CreateNotification(notification)
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+
+	// Send email asynchronously
+	go s.sendEmailAsync(createdNotification.ID, email, subject, body)
+
+	return nil
+}
+
+func (s *NotificationService) SendStockAlert(ctx context.Context, data templates.StockAlertData, email string) error {
+	// Render email template
+	body, err := templates.RenderStockAlert(data)
+	if err != nil {
+		return fmt.Errorf("failed to render template: %w", err)
+	}
+
+	item := data.ProductName
+	if data.SKU != "" {
+		item = fmt.Sprintf("%s (%s)", data.ProductName, data.SKU)
+	}
+	subject := fmt.Sprintf("Low Stock - %s", item)
+	if data.OutOfStock {
+		subject = fmt.Sprintf("Out of Stock - %s", item)
+	}
+
+	// Create notification record
+	notification := &repository.Notification{
+		RecipientEmail: email,
+		RecipientName:  "Merchandising",
+		Type:           "stock_alert",
+		Subject:        subject,
+		Body:           body,
+		Status:         "pending",
+		RetryCount:     0,
+	}
+
+	createdNotification, err := s.repo.CreateNotification(notification)
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %w", err)
+	}
+
+	// Send email asynchronously
+	go s.sendEmailAsync(createdNotification.ID, email, subject, body)
+
+	return nil
+}
+
 func (s *NotificationService) sendEmailAsync(notificationID, to, subject, body string) {
 	err := s.smtpClient.SendEmail(to, subject, body)
 	if err != nil {
@@ -168,3 +237,21 @@ func (s *NotificationService) ListNotifications(ctx context.Context, email strin
 	offset := (page - 1) * pageSize
 	return s.repo.ListNotifications(email, pageSize, offset)
 }
+
+// HandleEventOnce runs handle for a bus event unless the event was already
+// handled, so redelivered events don't send duplicate emails.
+func (s *NotificationService) HandleEventOnce(ctx context.Context, eventID, eventType string, handle func() error) error {
+	processed, err := s.repo.IsEventProcessed(eventID)
+	if err != nil {
+		return err
+	}
+	if processed {
+		return nil
+	}
+
+	if err := handle(); err != nil {
+		return err
+	}
+
+	return s.repo.MarkEventProcessed(eventID, eventType)
+}
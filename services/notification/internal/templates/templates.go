@@ -15,6 +15,8 @@ type OrderConfirmationData struct {
 	Subtotal        string
 	Shipping        string
 	Tax             string
+	Discount        string
+	CouponCode      string
 	Total           string
 	ShippingAddress Address
 }
@@ -58,6 +60,24 @@ type PasswordResetData struct {
 	ExpiresIn  string
 }
 
+// CartReminderData holds data for abandoned cart reminder emails
+type CartReminderData struct {
+	FirstName string
+	Items     []OrderItem
+	Total     string
+	CartURL   string
+}
+
+// StockAlertData holds data for low-stock and out-of-stock alert emails
+type StockAlertData struct {
+	ProductName      string
+	SKU              string
+	Available        int32
+	ReorderThreshold int32
+	OutOfStock       bool
+	AlertedAt        string
+}
+
 const orderConfirmationTemplate = `
 <!DOCTYPE html>
 <html>
@@ -98,6 +118,7 @@ const orderConfirmationTemplate = `
                     <p>Subtotal: {{.Subtotal}}</p>
                     <p>Shipping: {{.Shipping}}</p>
                     <p>Tax: {{.Tax}}</p>
+                    {{if .CouponCode}}<p>Discount ({{.CouponCode}}): -{{.Discount}}</p>{{end}}
                     <p style="font-size: 1.3em;">Total: {{.Total}}</p>
                 </div>
 
@@ -224,6 +245,97 @@ const passwordResetTemplate = `
 </html>
 `
 
+const cartReminderTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background-color: #FF9800; color: white; padding: 20px; text-align: center; }
+        .content { padding: 20px; background-color: #f9f9f9; }
+        .cart-details { background-color: white; padding: 15px; margin: 15px 0; border-radius: 5px; }
+        .item { border-bottom: 1px solid #eee; padding: 10px 0; }
+        .total { font-size: 1.2em; font-weight: bold; margin-top: 15px; }
+        .button { display: inline-block; padding: 12px 24px; background-color: #FF9800; color: white; text-decoration: none; border-radius: 5px; margin: 20px 0; }
+        .footer { text-align: center; padding: 20px; color: #666; font-size: 0.9em; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>You Left Something Behind</h1>
+        </div>
+        <div class="content">
+            <p>Hi {{.FirstName}},</p>
+            <p>The items below are still waiting in your cart.</p>
+
+            <div class="cart-details">
+                {{range .Items}}
+                <div class="item">
+                    <p><strong>{{.ProductName}}</strong></p>
+                    <p>Quantity: {{.Quantity}} × {{.UnitPrice}} = {{.TotalPrice}}</p>
+                </div>
+                {{end}}
+
+                <p class="total">Total: {{.Total}}</p>
+            </div>
+
+            <p style="text-align: center;">
+                <a href="{{.CartURL}}" class="button">Return to Your Cart</a>
+            </p>
+        </div>
+        <div class="footer">
+            <p>This is an automated email. Please do not reply.</p>
+        </div>
+    </div>
+</body>
+</html>
+`
+
+const stockAlertTemplate = `
+<!DOCTYPE html>
+<html>
+<head>
+    <style>
+        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+        .header { background-color: {{if .OutOfStock}}#F44336{{else}}#FF9800{{end}}; color: white; padding: 20px; text-align: center; }
+        .content { padding: 20px; background-color: #f9f9f9; }
+        .stock-details { background-color: white; padding: 15px; margin: 15px 0; border-radius: 5px; }
+        .footer { text-align: center; padding: 20px; color: #666; font-size: 0.9em; }
+    </style>
+</head>
+<body>
+    <div class="container">
+        <div class="header">
+            <h1>{{if .OutOfStock}}Out of Stock{{else}}Low Stock{{end}}</h1>
+        </div>
+        <div class="content">
+            {{if .OutOfStock}}
+            <p>The product below has run out of stock and can no longer be ordered.</p>
+            {{else}}
+            <p>The product below has dropped to its reorder threshold.</p>
+            {{end}}
+
+            <div class="stock-details">
+                <h2>{{.ProductName}}</h2>
+                {{if .SKU}}
+                <p><strong>SKU:</strong> {{.SKU}}</p>
+                {{end}}
+                <p><strong>Available:</strong> {{.Available}}</p>
+                <p><strong>Reorder Threshold:</strong> {{.ReorderThreshold}}</p>
+                <p><strong>Alerted At:</strong> {{.AlertedAt}}</p>
+            </div>
+        </div>
+        <div class="footer">
+            <p>This is an automated email. Please do not reply.</p>
+        </div>
+    </div>
+</body>
+</html>
+`
+
 // RenderOrderConfirmation renders the order confirmation email
 func RenderOrderConfirmation(data OrderConfirmationData) (string, error) {
 	tmpl, err := template.New("order_confirmation").Parse(orderConfirmationTemplate)
@@ -283,3 +395,33 @@ func RenderPasswordReset(data PasswordResetData) (string, error) {
 
 	return buf.String(), nil
 }
+
+// RenderCartReminder renders the abandoned cart reminder email
+func RenderCartReminder(data CartReminderData) (string, error) {
+	tmpl, err := template.New("cart_reminder").Parse(cartReminderTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// RenderStockAlert renders the low-stock or out-of-stock alert email
+func RenderStockAlert(data StockAlertData) (string, error) {
+	tmpl, err := template.New("stock_alert").Parse(stockAlertTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+
+	return buf.String(), nil
+}
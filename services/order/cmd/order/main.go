@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"time"
 
 	pb "github.com/safar/microservices-demo/proto/order/v1"
 	"github.com/safar/microservices-demo/services/order/internal/client"
@@ -11,6 +13,7 @@ import (
 	"github.com/safar/microservices-demo/services/order/internal/repository"
 	"github.com/safar/microservices-demo/services/order/internal/server"
 	"github.com/safar/microservices-demo/services/order/internal/service"
+	"github.com/safar/microservices-demo/shared/events"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
@@ -39,8 +42,29 @@ func main() {
 	}
 	defer clients.Close()
 
+	// Initialize event bus
+	bus, err := events.Open(cfg.EventBusDriver, cfg.EventBusURL)
+	if err != nil {
+		log.Fatalf("Failed to initialize event bus: %v", err)
+	}
+	defer bus.Close()
+
+	// Publish order events written to the outbox
+	go events.NewOutboxRelay(repo, bus).Run(context.Background(), time.Second)
+
 	// Initialize service
-	orderService := service.NewOrderService(repo, clients)
+	orderService := service.NewOrderService(repo, clients, service.NewTableTaxEngine(repo))
+
+	// Resume checkouts left unfinished by a crash or restart
+	go orderService.RunSagaRecovery(context.Background(), 30*time.Second)
+
+	// Move orders along as their shipments progress
+	eventHandler := server.NewEventHandler(orderService)
+	go func() {
+		if err := bus.Subscribe(context.Background(), "order-service", server.ShipmentEventTypes, eventHandler.HandleShipmentEvent); err != nil {
+			log.Printf("Shipment event subscription stopped: %v", err)
+		}
+	}()
 
 	// Initialize gRPC server
 	grpcServer := server.NewGRPCServer(orderService)
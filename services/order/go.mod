@@ -5,6 +5,8 @@ go 1.26.0
 require (
 	github.com/lib/pq v1.11.2
 	github.com/safar/microservices-demo/proto v0.0.0-00010101000000-000000000000
+	github.com/safar/microservices-demo/shared v0.0.0-00010101000000-000000000000
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260217215200-42d3e9bedb6d
 	google.golang.org/grpc v1.79.1
 )
 
@@ -12,8 +14,9 @@ require (
 	golang.org/x/net v0.50.0 // indirect
 	golang.org/x/sys v0.41.0 // indirect
 	golang.org/x/text v0.34.0 // indirect
-	google.golang.org/genproto/googleapis/rpc v0.0.0-20260217215200-42d3e9bedb6d // indirect
 	google.golang.org/protobuf v1.36.11 // indirect
 )
 
 replace github.com/safar/microservices-demo/proto => ../../proto
+
+replace github.com/safar/microservices-demo/shared => ../../shared
@@ -0,0 +1,306 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Checkout saga states. A saga moves forward through the step states and
+// ends in SagaStateCompleted, or switches to SagaStateCompensating and ends
+// in SagaStateCompensated once every completed step has been undone.
+const (
+	SagaStateStarted           = "started"
+	SagaStateInventoryReserved = "inventory_reserved"
+	SagaStatePaymentCharged    = "payment_charged"
+	SagaStateCartCleared       = "cart_cleared"
+	SagaStateShipmentCreated   = "shipment_created"
+	SagaStateCompleted         = "completed"
+	SagaStateCompensating      = "compensating"
+	SagaStateCompensated       = "compensated"
+)
+
+var (
+	ErrCheckoutSagaNotFound    = errors.New("checkout not found")
+	ErrDuplicateIdempotencyKey = errors.New("idempotency key already used")
+	// ErrCheckoutSagaConflict is returned when a saga was written by another
+	// worker since it was read, so the stale copy must not be driven further.
+	ErrCheckoutSagaConflict = errors.New("checkout saga was updated by another worker")
+)
+
+// CheckoutSaga is the persisted state of a single checkout. Its ID is reused
+// as the order ID so reservations and charges can be correlated with the
+// order before the order row exists.
+type CheckoutSaga struct {
+	ID                  string
+	UserID              string
+	IdempotencyKey      sql.NullString
+	State               string
+	Items               []SagaItem
+	Currency            string
+	SubtotalCents       int64
+	ShippingCents       int64
+	TaxCents            int64
+	TotalCents          int64
+	TaxInclusive        bool
+	DiscountCents       int64
+	CouponCode          sql.NullString
+	ShippingStreet      string
+	ShippingCity        string
+	ShippingState       string
+	ShippingZip         string
+	ShippingCountry     string
+	PaymentMethodID     string
+	ShippingCarrier     sql.NullString
+	ShippingService     sql.NullString
+	ReservationID       sql.NullString
+	ReservationReleased bool
+	TransactionID       sql.NullString
+	PaymentRefunded     bool
+	CartCleared         bool
+	CartRestored        bool
+	TrackingNumber      sql.NullString
+	ShipmentCancelled   bool
+	LastError           sql.NullString
+	// Version is bumped by every write and claim, and writes only succeed
+	// against the version they read.
+	Version      int32
+	ClaimedBy    sql.NullString
+	ClaimedUntil sql.NullTime
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// SagaItem is the snapshot of a cart line taken when the saga starts.
+type SagaItem struct {
+	ProductID      string `json:"product_id"`
+	VariantID      string `json:"variant_id,omitempty"`
+	SKU            string `json:"sku,omitempty"`
+	ProductName    string `json:"product_name"`
+	Quantity       int32  `json:"quantity"`
+	UnitPriceCents int64  `json:"unit_price_cents"`
+	Currency       string `json:"currency"`
+	ImageURL       string `json:"image_url"`
+	WeightGrams    int32  `json:"weight_grams"`
+	CategoryID     string `json:"category_id"`
+	// Tax and discount are filled in once the order total is priced.
+	TaxCents        int64  `json:"tax_cents"`
+	TaxRateBps      int32  `json:"tax_rate_bps"`
+	TaxJurisdiction string `json:"tax_jurisdiction"`
+	DiscountCents   int64  `json:"discount_cents"`
+}
+
+// IsTerminal reports whether the saga needs no further processing.
+func (s *CheckoutSaga) IsTerminal() bool {
+	return s.State == SagaStateCompleted || s.State == SagaStateCompensated
+}
+
+const checkoutSagaColumns = `id, user_id, idempotency_key, state, items, currency, subtotal_cents, shipping_cents, tax_cents, total_cents,
+	shipping_street, shipping_city, shipping_state, shipping_zip, shipping_country, payment_method_id,
+	shipping_carrier, shipping_service, reservation_id, reservation_released, transaction_id, payment_refunded,
+	cart_cleared, cart_restored, tracking_number, shipment_cancelled, tax_inclusive, discount_cents, coupon_code, last_error,
+	version, claimed_by, claimed_until, created_at, updated_at`
+
+// CreateCheckoutSaga stores a new saga. It returns ErrDuplicateIdempotencyKey
+// if the user already started a checkout with the same idempotency key.
+func (r *OrderRepository) CreateCheckoutSaga(saga *CheckoutSaga) (*CheckoutSaga, error) {
+	items, err := json.Marshal(saga.Items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode saga items: %w", err)
+	}
+
+	query := `
+		INSERT INTO checkout_sagas (user_id, idempotency_key, state, items, currency, subtotal_cents,
+			shipping_street, shipping_city, shipping_state, shipping_zip, shipping_country, payment_method_id,
+			shipping_carrier, shipping_service, coupon_code)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id, created_at, updated_at
+	`
+
+	err = r.db.QueryRow(query,
+		saga.UserID, saga.IdempotencyKey, saga.State, items, saga.Currency, saga.SubtotalCents,
+		saga.ShippingStreet, saga.ShippingCity, saga.ShippingState, saga.ShippingZip, saga.ShippingCountry,
+		saga.PaymentMethodID, saga.ShippingCarrier, saga.ShippingService, saga.CouponCode,
+	).Scan(&saga.ID, &saga.CreatedAt, &saga.UpdatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return nil, ErrDuplicateIdempotencyKey
+		}
+		return nil, fmt.Errorf("failed to create checkout saga: %w", err)
+	}
+
+	return saga, nil
+}
+
+// GetCheckoutSagaByIdempotencyKey returns the user's saga started with key,
+// or ErrCheckoutSagaNotFound.
+func (r *OrderRepository) GetCheckoutSagaByIdempotencyKey(userID, key string) (*CheckoutSaga, error) {
+	query := `
+		SELECT ` + checkoutSagaColumns + `
+		FROM checkout_sagas
+		WHERE user_id = $1 AND idempotency_key = $2
+	`
+
+	rows, err := r.db.Query(query, userID, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checkout saga: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to get checkout saga: %w", err)
+		}
+		return nil, ErrCheckoutSagaNotFound
+	}
+
+	return scanCheckoutSaga(rows)
+}
+
+// UpdateCheckoutSaga persists the saga's state, step results and priced
+// items. It returns ErrCheckoutSagaConflict if the saga was written or
+// claimed since it was read.
+func (r *OrderRepository) UpdateCheckoutSaga(saga *CheckoutSaga) error {
+	items, err := json.Marshal(saga.Items)
+	if err != nil {
+		return fmt.Errorf("failed to encode saga items: %w", err)
+	}
+
+	query := `
+		UPDATE checkout_sagas
+		SET state = $2, shipping_cents = $3, tax_cents = $4, total_cents = $5,
+			reservation_id = $6, reservation_released = $7, transaction_id = $8, payment_refunded = $9,
+			cart_cleared = $10, cart_restored = $11, last_error = $12, shipping_carrier = $13,
+			shipping_service = $14, tracking_number = $15, shipment_cancelled = $16, items = $17,
+			tax_inclusive = $18, discount_cents = $19, version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND version = $20
+		RETURNING version, updated_at
+	`
+
+	err = r.db.QueryRow(query,
+		saga.ID, saga.State, saga.ShippingCents, saga.TaxCents, saga.TotalCents,
+		saga.ReservationID, saga.ReservationReleased, saga.TransactionID, saga.PaymentRefunded,
+		saga.CartCleared, saga.CartRestored, saga.LastError, saga.ShippingCarrier,
+		saga.ShippingService, saga.TrackingNumber, saga.ShipmentCancelled, items,
+		saga.TaxInclusive, saga.DiscountCents, saga.Version,
+	).Scan(&saga.Version, &saga.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return ErrCheckoutSagaConflict
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update checkout saga: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimStaleCheckoutSagas claims up to limit sagas for owner until lease
+// runs out, and returns them. Only sagas that are not in a terminal state,
+// have not been touched for at least staleAfter and are not claimed by
+// another worker are claimed, oldest first. Claiming bumps the version, so
+// a request still driving a claimed saga fails its next write.
+func (r *OrderRepository) ClaimStaleCheckoutSagas(owner string, staleAfter, lease time.Duration, limit int) ([]*CheckoutSaga, error) {
+	query := `
+		UPDATE checkout_sagas
+		SET claimed_by = $1, claimed_until = $2, version = version + 1
+		WHERE id IN (
+			SELECT id
+			FROM checkout_sagas
+			WHERE state NOT IN ($3, $4) AND updated_at < $5
+				AND (claimed_until IS NULL OR claimed_until < NOW())
+			ORDER BY updated_at ASC
+			LIMIT $6
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + checkoutSagaColumns
+
+	now := time.Now()
+	rows, err := r.db.Query(query, owner, now.Add(lease), SagaStateCompleted, SagaStateCompensated, now.Add(-staleAfter), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim checkout sagas: %w", err)
+	}
+	defer rows.Close()
+
+	var sagas []*CheckoutSaga
+	for rows.Next() {
+		saga, err := scanCheckoutSaga(rows)
+		if err != nil {
+			return nil, err
+		}
+		sagas = append(sagas, saga)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate checkout sagas: %w", err)
+	}
+
+	return sagas, nil
+}
+
+// CompleteCheckoutSaga creates the order for a saga and marks the saga
+// completed in the same transaction, so a restart can never produce the
+// order twice. It returns ErrCheckoutSagaConflict if the saga was written or
+// claimed since it was read.
+func (r *OrderRepository) CompleteCheckoutSaga(saga *CheckoutSaga, order *Order, items []OrderItem) (*Order, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := createOrderTx(tx, order, items); err != nil {
+		return nil, err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE checkout_sagas
+		SET state = $2, last_error = NULL, version = version + 1, updated_at = NOW()
+		WHERE id = $1 AND version = $3
+	`, saga.ID, SagaStateCompleted, saga.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete checkout saga: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to complete checkout saga: %w", err)
+	} else if n == 0 {
+		return nil, ErrCheckoutSagaConflict
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	saga.State = SagaStateCompleted
+	saga.LastError = sql.NullString{}
+	saga.Version++
+
+	return order, nil
+}
+
+func scanCheckoutSaga(rows *sql.Rows) (*CheckoutSaga, error) {
+	saga := &CheckoutSaga{}
+	var items []byte
+	if err := rows.Scan(
+		&saga.ID, &saga.UserID, &saga.IdempotencyKey, &saga.State, &items, &saga.Currency, &saga.SubtotalCents,
+		&saga.ShippingCents, &saga.TaxCents, &saga.TotalCents,
+		&saga.ShippingStreet, &saga.ShippingCity, &saga.ShippingState, &saga.ShippingZip, &saga.ShippingCountry,
+		&saga.PaymentMethodID, &saga.ShippingCarrier, &saga.ShippingService, &saga.ReservationID,
+		&saga.ReservationReleased, &saga.TransactionID, &saga.PaymentRefunded, &saga.CartCleared,
+		&saga.CartRestored, &saga.TrackingNumber, &saga.ShipmentCancelled, &saga.TaxInclusive,
+		&saga.DiscountCents, &saga.CouponCode, &saga.LastError,
+		&saga.Version, &saga.ClaimedBy, &saga.ClaimedUntil, &saga.CreatedAt, &saga.UpdatedAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to scan checkout saga: %w", err)
+	}
+
+	if err := json.Unmarshal(items, &saga.Items); err != nil {
+		return nil, fmt.Errorf("failed to decode saga items: %w", err)
+	}
+
+	return saga, nil
+}
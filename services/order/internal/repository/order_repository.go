@@ -2,10 +2,30 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/safar/microservices-demo/shared/pagination"
+)
+
+// Order statuses, matching the OrderStatus enum in the order proto.
+const (
+	OrderStatusPending    = "pending"
+	OrderStatusConfirmed  = "confirmed"
+	OrderStatusProcessing = "processing"
+	OrderStatusShipped    = "shipped"
+	OrderStatusDelivered  = "delivered"
+	OrderStatusCancelled  = "cancelled"
+	OrderStatusRefunded   = "refunded"
+)
+
+var (
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrOrderStatusMismatch is returned when an order is not in one of the
+	// statuses a status update expects it to be in.
+	ErrOrderStatusMismatch = errors.New("unexpected order status")
 )
 
 type Order struct {
@@ -16,6 +36,9 @@ type Order struct {
 	ShippingCents    int64
 	TaxCents         int64
 	TotalCents       int64
+	TaxInclusive     bool
+	DiscountCents    int64
+	CouponCode       sql.NullString
 	Currency         string
 	ShippingStreet   string
 	ShippingCity     string
@@ -37,6 +60,16 @@ type OrderItem struct {
 	Quantity       int32
 	UnitPriceCents int64
 	TotalPriceCents int64
+	// TaxCents is the tax charged on the line, at TaxRateBps basis points
+	// in TaxJurisdiction.
+	TaxCents        int64
+	TaxRateBps      int32
+	TaxJurisdiction string
+	DiscountCents   int64
+	// VariantID and SKU are empty unless the line is a variant of the
+	// product.
+	VariantID string
+	SKU       string
 }
 
 type OrderStatusHistory struct {
@@ -44,6 +77,7 @@ type OrderStatusHistory struct {
 	OrderID   string
 	Status    string
 	Notes     string
+	ChangedBy string
 	CreatedAt time.Time
 }
 
@@ -79,92 +113,133 @@ func (r *OrderRepository) CreateOrder(order *Order, items []OrderItem) (*Order,
 	}
 	defer tx.Rollback()
 
+	if err := createOrderTx(tx, order, items); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return order, nil
+}
+
+// createOrderTx inserts an order with its items and initial status history.
+// When order.ID is set it is used as the primary key.
+func createOrderTx(tx *sql.Tx, order *Order, items []OrderItem) error {
 	// Create order
 	query := `
-		INSERT INTO orders (user_id, status, subtotal_cents, shipping_cents, tax_cents, total_cents, currency,
+		INSERT INTO orders (id, user_id, status, subtotal_cents, shipping_cents, tax_cents, total_cents, currency,
 			shipping_street, shipping_city, shipping_state, shipping_zip, shipping_country,
-			payment_method_id, transaction_id, tracking_number)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+			payment_method_id, transaction_id, tracking_number, tax_inclusive, discount_cents, coupon_code)
+		VALUES (COALESCE(NULLIF($1, '')::uuid, gen_random_uuid()), $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
 		RETURNING id, user_id, status, subtotal_cents, shipping_cents, tax_cents, total_cents, currency,
 			shipping_street, shipping_city, shipping_state, shipping_zip, shipping_country,
-			payment_method_id, transaction_id, tracking_number, created_at, updated_at
+			payment_method_id, transaction_id, tracking_number, tax_inclusive, discount_cents, coupon_code,
+			created_at, updated_at
 	`
 
-	err = tx.QueryRow(query,
-		order.UserID, order.Status, order.SubtotalCents, order.ShippingCents, order.TaxCents,
+	err := tx.QueryRow(query,
+		order.ID, order.UserID, order.Status, order.SubtotalCents, order.ShippingCents, order.TaxCents,
 		order.TotalCents, order.Currency, order.ShippingStreet, order.ShippingCity,
 		order.ShippingState, order.ShippingZip, order.ShippingCountry,
-		order.PaymentMethodID, order.TransactionID, order.TrackingNumber,
+		order.PaymentMethodID, order.TransactionID, order.TrackingNumber, order.TaxInclusive,
+		order.DiscountCents, order.CouponCode,
 	).Scan(
 		&order.ID, &order.UserID, &order.Status, &order.SubtotalCents, &order.ShippingCents,
 		&order.TaxCents, &order.TotalCents, &order.Currency, &order.ShippingStreet,
 		&order.ShippingCity, &order.ShippingState, &order.ShippingZip, &order.ShippingCountry,
-		&order.PaymentMethodID, &order.TransactionID, &order.TrackingNumber,
-		&order.CreatedAt, &order.UpdatedAt,
+		&order.PaymentMethodID, &order.TransactionID, &order.TrackingNumber, &order.TaxInclusive,
+		&order.DiscountCents, &order.CouponCode, &order.CreatedAt, &order.UpdatedAt,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create order: %w", err)
+		return fmt.Errorf("failed to create order: %w", err)
 	}
 
 	// Create order items
 	for _, item := range items {
 		itemQuery := `
-			INSERT INTO order_items (order_id, product_id, product_name, quantity, unit_price_cents, total_price_cents)
-			VALUES ($1, $2, $3, $4, $5, $6)
+			INSERT INTO order_items (order_id, product_id, product_name, quantity, unit_price_cents, total_price_cents,
+				tax_cents, tax_rate_bps, tax_jurisdiction, discount_cents, variant_id, sku)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, '')::uuid, $12)
 		`
-		_, err = tx.Exec(itemQuery, order.ID, item.ProductID, item.ProductName, item.Quantity, item.UnitPriceCents, item.TotalPriceCents)
+		_, err = tx.Exec(itemQuery, order.ID, item.ProductID, item.ProductName, item.Quantity, item.UnitPriceCents, item.TotalPriceCents,
+			item.TaxCents, item.TaxRateBps, item.TaxJurisdiction, item.DiscountCents, item.VariantID, item.SKU)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create order item: %w", err)
+			return fmt.Errorf("failed to create order item: %w", err)
+		}
+	}
+
+	// Redeem the coupon with the order so limits hold under concurrent checkouts
+	if order.CouponCode.Valid {
+		if err := redeemPromotionTx(tx, order); err != nil {
+			return err
 		}
 	}
 
 	// Create initial status history
 	historyQuery := `
-		INSERT INTO order_status_history (order_id, status, notes)
-		VALUES ($1, $2, $3)
+		INSERT INTO order_status_history (order_id, status, notes, changed_by)
+		VALUES ($1, $2, $3, $4)
 	`
-	_, err = tx.Exec(historyQuery, order.ID, order.Status, "Order created")
+	_, err = tx.Exec(historyQuery, order.ID, order.Status, "Order created", order.UserID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create status history: %w", err)
+		return fmt.Errorf("failed to create status history: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	event, err := orderCreatedEvent(order, items)
+	if err != nil {
+		return err
 	}
 
-	return order, nil
+	return insertOutboxEvent(tx, event)
 }
 
 func (r *OrderRepository) GetOrder(orderID, userID string) (*Order, []OrderItem, []OrderStatusHistory, error) {
+	return r.getOrder(`WHERE id = $1 AND user_id = $2`, orderID, userID)
+}
+
+// GetOrderByID returns an order whichever user placed it, for admins.
+func (r *OrderRepository) GetOrderByID(orderID string) (*Order, []OrderItem, []OrderStatusHistory, error) {
+	return r.getOrder(`WHERE id = $1`, orderID)
+}
+
+// getOrder returns the order matching where, with its items and status
+// history.
+func (r *OrderRepository) getOrder(where string, args ...interface{}) (*Order, []OrderItem, []OrderStatusHistory, error) {
 	// Get order
 	orderQuery := `
 		SELECT id, user_id, status, subtotal_cents, shipping_cents, tax_cents, total_cents, currency,
 			shipping_street, shipping_city, shipping_state, shipping_zip, shipping_country,
-			payment_method_id, transaction_id, tracking_number, created_at, updated_at
+			payment_method_id, transaction_id, tracking_number, tax_inclusive, discount_cents, coupon_code,
+			created_at, updated_at
 		FROM orders
-		WHERE id = $1 AND user_id = $2
-	`
+		` + where
 
 	order := &Order{}
-	err := r.db.QueryRow(orderQuery, orderID, userID).Scan(
+	err := r.db.QueryRow(orderQuery, args...).Scan(
 		&order.ID, &order.UserID, &order.Status, &order.SubtotalCents, &order.ShippingCents,
 		&order.TaxCents, &order.TotalCents, &order.Currency, &order.ShippingStreet,
 		&order.ShippingCity, &order.ShippingState, &order.ShippingZip, &order.ShippingCountry,
-		&order.PaymentMethodID, &order.TransactionID, &order.TrackingNumber,
-		&order.CreatedAt, &order.UpdatedAt,
+		&order.PaymentMethodID, &order.TransactionID, &order.TrackingNumber, &order.TaxInclusive,
+		&order.DiscountCents, &order.CouponCode, &order.CreatedAt, &order.UpdatedAt,
 	)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil, ErrOrderNotFound
+	}
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to get order: %w", err)
 	}
 
 	// Get order items
 	itemsQuery := `
-		SELECT id, order_id, product_id, product_name, quantity, unit_price_cents, total_price_cents
+		SELECT id, order_id, product_id, product_name, quantity, unit_price_cents, total_price_cents,
+			tax_cents, tax_rate_bps, tax_jurisdiction, discount_cents, COALESCE(variant_id::text, ''), sku
 		FROM order_items
 		WHERE order_id = $1
 	`
 
-	rows, err := r.db.Query(itemsQuery, orderID)
+	rows, err := r.db.Query(itemsQuery, order.ID)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to get order items: %w", err)
 	}
@@ -173,7 +248,8 @@ func (r *OrderRepository) GetOrder(orderID, userID string) (*Order, []OrderItem,
 	var items []OrderItem
 	for rows.Next() {
 		var item OrderItem
-		if err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.ProductName, &item.Quantity, &item.UnitPriceCents, &item.TotalPriceCents); err != nil {
+		if err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.ProductName, &item.Quantity, &item.UnitPriceCents, &item.TotalPriceCents,
+			&item.TaxCents, &item.TaxRateBps, &item.TaxJurisdiction, &item.DiscountCents, &item.VariantID, &item.SKU); err != nil {
 			return nil, nil, nil, fmt.Errorf("failed to scan order item: %w", err)
 		}
 		items = append(items, item)
@@ -181,13 +257,13 @@ func (r *OrderRepository) GetOrder(orderID, userID string) (*Order, []OrderItem,
 
 	// Get status history
 	historyQuery := `
-		SELECT id, order_id, status, notes, created_at
+		SELECT id, order_id, status, notes, COALESCE(changed_by, ''), created_at
 		FROM order_status_history
 		WHERE order_id = $1
 		ORDER BY created_at ASC
 	`
 
-	historyRows, err := r.db.Query(historyQuery, orderID)
+	historyRows, err := r.db.Query(historyQuery, order.ID)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to get status history: %w", err)
 	}
@@ -196,7 +272,7 @@ func (r *OrderRepository) GetOrder(orderID, userID string) (*Order, []OrderItem,
 	var history []OrderStatusHistory
 	for historyRows.Next() {
 		var h OrderStatusHistory
-		if err := historyRows.Scan(&h.ID, &h.OrderID, &h.Status, &h.Notes, &h.CreatedAt); err != nil {
+		if err := historyRows.Scan(&h.ID, &h.OrderID, &h.Status, &h.Notes, &h.ChangedBy, &h.CreatedAt); err != nil {
 			return nil, nil, nil, fmt.Errorf("failed to scan status history: %w", err)
 		}
 		history = append(history, h)
@@ -205,37 +281,40 @@ func (r *OrderRepository) GetOrder(orderID, userID string) (*Order, []OrderItem,
 	return order, items, history, nil
 }
 
-func (r *OrderRepository) ListOrders(userID string, limit, offset int, statusFilter string) ([]*Order, int, error) {
-	countQuery := `SELECT COUNT(*) FROM orders WHERE user_id = $1`
-	query := `
-		SELECT id, user_id, status, subtotal_cents, shipping_cents, tax_cents, total_cents, currency,
-			shipping_street, shipping_city, shipping_state, shipping_zip, shipping_country,
-			payment_method_id, transaction_id, tracking_number, created_at, updated_at
-		FROM orders
-		WHERE user_id = $1
-	`
-
+func (r *OrderRepository) ListOrders(userID string, page pagination.Page, statusFilter string) ([]*Order, pagination.Result, error) {
+	where := ` WHERE user_id = $1`
 	args := []interface{}{userID}
 	argPos := 2
 
 	if statusFilter != "" {
-		countQuery += fmt.Sprintf(" AND status = $%d", argPos)
-		query += fmt.Sprintf(" AND status = $%d", argPos)
+		where += fmt.Sprintf(" AND status = $%d", argPos)
 		args = append(args, statusFilter)
 		argPos++
 	}
 
-	var totalCount int
-	if err := r.db.QueryRow(countQuery, args[:len(args)-1]...).Scan(&totalCount); err != nil {
-		return nil, 0, fmt.Errorf("failed to count orders: %w", err)
+	result, err := pagination.Count(r.db, page, `FROM orders`+where, args...)
+	if err != nil {
+		return nil, pagination.Result{}, fmt.Errorf("failed to count orders: %w", err)
+	}
+
+	if condition, conditionArgs := page.Condition("created_at", "id", argPos); condition != "" {
+		where += " AND " + condition
+		args = append(args, conditionArgs...)
+		argPos += len(conditionArgs)
 	}
 
-	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", argPos, argPos+1)
-	args = append(args, limit, offset)
+	query := `
+		SELECT id, user_id, status, subtotal_cents, shipping_cents, tax_cents, total_cents, currency,
+			shipping_street, shipping_city, shipping_state, shipping_zip, shipping_country,
+			payment_method_id, transaction_id, tracking_number, tax_inclusive, discount_cents, coupon_code,
+			created_at, updated_at
+		FROM orders` + where
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", argPos, argPos+1)
+	args = append(args, page.Limit(), page.Offset())
 
 	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to list orders: %w", err)
+		return nil, pagination.Result{}, fmt.Errorf("failed to list orders: %w", err)
 	}
 	defer rows.Close()
 
@@ -246,39 +325,114 @@ func (r *OrderRepository) ListOrders(userID string, limit, offset int, statusFil
 			&order.ID, &order.UserID, &order.Status, &order.SubtotalCents, &order.ShippingCents,
 			&order.TaxCents, &order.TotalCents, &order.Currency, &order.ShippingStreet,
 			&order.ShippingCity, &order.ShippingState, &order.ShippingZip, &order.ShippingCountry,
-			&order.PaymentMethodID, &order.TransactionID, &order.TrackingNumber,
-			&order.CreatedAt, &order.UpdatedAt,
+			&order.PaymentMethodID, &order.TransactionID, &order.TrackingNumber, &order.TaxInclusive,
+			&order.DiscountCents, &order.CouponCode, &order.CreatedAt, &order.UpdatedAt,
 		); err != nil {
-			return nil, 0, fmt.Errorf("failed to scan order: %w", err)
+			return nil, pagination.Result{}, fmt.Errorf("failed to scan order: %w", err)
 		}
 		orders = append(orders, order)
 	}
 
-	return orders, totalCount, nil
+	orders, result.Next = pagination.Trim(page, orders, func(order *Order) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: order.CreatedAt, ID: order.ID}
+	})
+	return orders, result, nil
+}
+
+// FindProductPurchase returns the latest of userID's orders in one of
+// statuses that includes productID, or "" if there is none.
+func (r *OrderRepository) FindProductPurchase(userID, productID string, statuses []string) (string, error) {
+	var orderID string
+	err := r.db.QueryRow(`
+		SELECT o.id
+		FROM orders o
+		JOIN order_items i ON i.order_id = o.id
+		WHERE o.user_id = $1 AND i.product_id = $2 AND o.status = ANY($3)
+		ORDER BY o.created_at DESC
+		LIMIT 1
+	`, userID, productID, pq.Array(statuses)).Scan(&orderID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find product purchase: %w", err)
+	}
+
+	return orderID, nil
 }
 
-func (r *OrderRepository) UpdateOrderStatus(orderID, status, notes string) error {
+// UpdateOrderStatus moves an order to status and records changedBy in its
+// history. The order must currently be in one of fromStatuses; otherwise
+// ErrOrderStatusMismatch is returned and nothing is written.
+func (r *OrderRepository) UpdateOrderStatus(orderID string, fromStatuses []string, status, notes, changedBy string) error {
 	tx, err := r.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
+	// Lock the order so the recorded previous status is accurate
+	order := &Order{ID: orderID}
+	err = tx.QueryRow(`
+		SELECT user_id, status, total_cents, currency, transaction_id, tracking_number
+		FROM orders WHERE id = $1 FOR UPDATE
+	`, orderID).Scan(&order.UserID, &order.Status, &order.TotalCents, &order.Currency, &order.TransactionID, &order.TrackingNumber)
+	if err == sql.ErrNoRows {
+		return ErrOrderNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get order: %w", err)
+	}
+	if !containsStatus(fromStatuses, order.Status) {
+		return fmt.Errorf("%w: order is %s", ErrOrderStatusMismatch, order.Status)
+	}
+	oldStatus := order.Status
+	order.Status = status
+
 	// Update order status
-	_, err = tx.Exec(`UPDATE orders SET status = $1, updated_at = NOW() WHERE id = $2`, status, orderID)
+	var changedAt time.Time
+	err = tx.QueryRow(`UPDATE orders SET status = $1, updated_at = NOW() WHERE id = $2 RETURNING updated_at`, status, orderID).Scan(&changedAt)
 	if err != nil {
 		return fmt.Errorf("failed to update order status: %w", err)
 	}
 
 	// Add status history
-	_, err = tx.Exec(`INSERT INTO order_status_history (order_id, status, notes) VALUES ($1, $2, $3)`, orderID, status, notes)
+	_, err = tx.Exec(`INSERT INTO order_status_history (order_id, status, notes, changed_by) VALUES ($1, $2, $3, $4)`, orderID, status, notes, changedBy)
 	if err != nil {
 		return fmt.Errorf("failed to add status history: %w", err)
 	}
 
+	// Publish the change through the outbox
+	event, err := orderStatusChangedEvent(order, oldStatus, notes, changedBy, changedAt)
+	if err != nil {
+		return err
+	}
+	if err := insertOutboxEvent(tx, event); err != nil {
+		return err
+	}
+
+	if status == OrderStatusCancelled {
+		event, err := orderCancelledEvent(order, notes, changedAt)
+		if err != nil {
+			return err
+		}
+		if err := insertOutboxEvent(tx, event); err != nil {
+			return err
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
 	return nil
 }
+
+func containsStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	commonpb "github.com/safar/microservices-demo/proto/common/v1"
+	eventspb "github.com/safar/microservices-demo/proto/events/v1"
+	"github.com/safar/microservices-demo/shared/events"
+)
+
+// insertOutboxEvent stores an event in the outbox as part of tx, so the
+// event is relayed if and only if the mutation that produced it commits.
+func insertOutboxEvent(tx *sql.Tx, event events.Event) error {
+	_, err := tx.Exec(`
+		INSERT INTO outbox (event_type, aggregate_id, payload, created_at)
+		VALUES ($1, $2, $3, $4)
+	`, event.Type, event.AggregateID, event.Payload, event.OccurredAt)
+	if err != nil {
+		return fmt.Errorf("failed to write %s event to outbox: %w", event.Type, err)
+	}
+	return nil
+}
+
+// ListUnpublishedOutboxEvents returns up to limit events that have not been
+// relayed yet, oldest first.
+func (r *OrderRepository) ListUnpublishedOutboxEvents(limit int) ([]events.Event, error) {
+	query := `
+		SELECT id, event_type, aggregate_id, payload, created_at
+		FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY created_at ASC
+		LIMIT $1
+	`
+
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []events.Event
+	for rows.Next() {
+		var event events.Event
+		if err := rows.Scan(&event.ID, &event.Type, &event.AggregateID, &event.Payload, &event.OccurredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		pending = append(pending, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate outbox events: %w", err)
+	}
+
+	return pending, nil
+}
+
+func (r *OrderRepository) MarkOutboxEventPublished(eventID string) error {
+	if _, err := r.db.Exec(`UPDATE outbox SET published_at = NOW() WHERE id = $1`, eventID); err != nil {
+		return fmt.Errorf("failed to mark outbox event published: %w", err)
+	}
+	return nil
+}
+
+// RecordOutboxFailure counts a failed publish attempt for an event.
+func (r *OrderRepository) RecordOutboxFailure(eventID string, publishErr error) error {
+	if _, err := r.db.Exec(`UPDATE outbox SET attempts = attempts + 1, last_error = $2 WHERE id = $1`,
+		eventID, publishErr.Error()); err != nil {
+		return fmt.Errorf("failed to record outbox failure: %w", err)
+	}
+	return nil
+}
+
+func orderCreatedEvent(order *Order, items []OrderItem) (events.Event, error) {
+	payload := &eventspb.OrderCreated{
+		OrderId:  order.ID,
+		UserId:   order.UserID,
+		Status:   order.Status,
+		Subtotal: &commonpb.Money{AmountCents: order.SubtotalCents, Currency: order.Currency},
+		Shipping: &commonpb.Money{AmountCents: order.ShippingCents, Currency: order.Currency},
+		Tax:      &commonpb.Money{AmountCents: order.TaxCents, Currency: order.Currency},
+		Total:    &commonpb.Money{AmountCents: order.TotalCents, Currency: order.Currency},
+		Discount: &commonpb.Money{AmountCents: order.DiscountCents, Currency: order.Currency},
+		ShippingAddress: &commonpb.Address{
+			Street:  order.ShippingStreet,
+			City:    order.ShippingCity,
+			State:   order.ShippingState,
+			ZipCode: order.ShippingZip,
+			Country: order.ShippingCountry,
+		},
+		TransactionId: order.TransactionID.String,
+		CreatedAt:     order.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		CouponCode:    order.CouponCode.String,
+	}
+
+	for _, item := range items {
+		payload.Items = append(payload.Items, &eventspb.OrderItem{
+			ProductId:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			UnitPrice:   &commonpb.Money{AmountCents: item.UnitPriceCents, Currency: order.Currency},
+			TotalPrice:  &commonpb.Money{AmountCents: item.TotalPriceCents, Currency: order.Currency},
+			VariantId:   item.VariantID,
+			Sku:         item.SKU,
+		})
+	}
+
+	return events.New(events.TypeOrderCreated, order.ID, payload)
+}
+
+func orderStatusChangedEvent(order *Order, oldStatus, notes, changedBy string, changedAt time.Time) (events.Event, error) {
+	return events.New(events.TypeOrderStatusChanged, order.ID, &eventspb.OrderStatusChanged{
+		OrderId:        order.ID,
+		UserId:         order.UserID,
+		OldStatus:      oldStatus,
+		NewStatus:      order.Status,
+		Notes:          notes,
+		TrackingNumber: order.TrackingNumber.String,
+		ChangedAt:      changedAt.Format("2006-01-02T15:04:05Z"),
+		ChangedBy:      changedBy,
+	})
+}
+
+func orderCancelledEvent(order *Order, reason string, cancelledAt time.Time) (events.Event, error) {
+	return events.New(events.TypeOrderCancelled, order.ID, &eventspb.OrderCancelled{
+		OrderId:       order.ID,
+		UserId:        order.UserID,
+		Reason:        reason,
+		TransactionId: order.TransactionID.String,
+		Total:         &commonpb.Money{AmountCents: order.TotalCents, Currency: order.Currency},
+		CancelledAt:   cancelledAt.Format("2006-01-02T15:04:05Z"),
+	})
+}
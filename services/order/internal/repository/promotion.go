@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Promotion rule types.
+const (
+	PromotionTypePercentOff   = "percent_off"
+	PromotionTypeFixedOff     = "fixed_off"
+	PromotionTypeFreeShipping = "free_shipping"
+	PromotionTypeBuyXGetY     = "buy_x_get_y"
+)
+
+var (
+	ErrPromotionNotFound = errors.New("promotion not found")
+	// ErrPromotionUnavailable is returned when redeeming a promotion that is
+	// inactive or outside its validity window.
+	ErrPromotionUnavailable = errors.New("promotion is not available")
+	// ErrPromotionExhausted is returned when redeeming a promotion that has
+	// reached its usage limit or the user's per-user limit.
+	ErrPromotionExhausted = errors.New("promotion usage limit reached")
+)
+
+// Promotion is a discount rule redeemed with a coupon code. Zero limits
+// mean unlimited, and an empty ProductID applies a buy-X-get-Y rule to
+// every product.
+type Promotion struct {
+	ID               string
+	Code             string
+	Description      string
+	Type             string
+	PercentOff       int32
+	AmountOffCents   int64
+	BuyQuantity      int32
+	GetQuantity      int32
+	ProductID        string
+	MinSubtotalCents int64
+	StartsAt         sql.NullTime
+	EndsAt           sql.NullTime
+	UsageLimit       int32
+	PerUserLimit     int32
+	IsActive         bool
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// IsValidAt reports whether the promotion is active and inside its validity
+// window at t.
+func (p *Promotion) IsValidAt(t time.Time) bool {
+	if !p.IsActive {
+		return false
+	}
+	if p.StartsAt.Valid && t.Before(p.StartsAt.Time) {
+		return false
+	}
+	if p.EndsAt.Valid && !t.Before(p.EndsAt.Time) {
+		return false
+	}
+	return true
+}
+
+// GetPromotionByCode returns the promotion for a coupon code, ignoring case.
+func (r *OrderRepository) GetPromotionByCode(code string) (*Promotion, error) {
+	query := `
+		SELECT id, code, description, type, percent_off, amount_off_cents, buy_quantity, get_quantity,
+			product_id, min_subtotal_cents, starts_at, ends_at, usage_limit, per_user_limit, is_active,
+			created_at, updated_at
+		FROM promotions
+		WHERE UPPER(code) = UPPER($1)
+	`
+
+	promotion := &Promotion{}
+	err := r.db.QueryRow(query, code).Scan(
+		&promotion.ID, &promotion.Code, &promotion.Description, &promotion.Type, &promotion.PercentOff,
+		&promotion.AmountOffCents, &promotion.BuyQuantity, &promotion.GetQuantity, &promotion.ProductID,
+		&promotion.MinSubtotalCents, &promotion.StartsAt, &promotion.EndsAt, &promotion.UsageLimit,
+		&promotion.PerUserLimit, &promotion.IsActive, &promotion.CreatedAt, &promotion.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrPromotionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get promotion: %w", err)
+	}
+
+	return promotion, nil
+}
+
+// CountPromotionRedemptions returns how often a promotion has been redeemed
+// in total and by userID. An empty userID, for a guest, has no redemptions.
+func (r *OrderRepository) CountPromotionRedemptions(promotionID, userID string) (int, int, error) {
+	var total, byUser int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE user_id = NULLIF($2, '')::uuid)
+		FROM promotion_redemptions
+		WHERE promotion_id = $1
+	`, promotionID, userID).Scan(&total, &byUser)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count promotion redemptions: %w", err)
+	}
+
+	return total, byUser, nil
+}
+
+// redeemPromotionTx records that order used its coupon. The promotion row is
+// locked while its limits are checked, so concurrent checkouts cannot
+// redeem a limited promotion more often than allowed.
+func redeemPromotionTx(tx *sql.Tx, order *Order) error {
+	promotion := &Promotion{}
+	err := tx.QueryRow(`
+		SELECT id, starts_at, ends_at, usage_limit, per_user_limit, is_active
+		FROM promotions
+		WHERE UPPER(code) = UPPER($1)
+		FOR UPDATE
+	`, order.CouponCode.String).Scan(
+		&promotion.ID, &promotion.StartsAt, &promotion.EndsAt, &promotion.UsageLimit,
+		&promotion.PerUserLimit, &promotion.IsActive,
+	)
+	if err == sql.ErrNoRows {
+		return ErrPromotionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get promotion: %w", err)
+	}
+
+	if !promotion.IsValidAt(time.Now()) {
+		return ErrPromotionUnavailable
+	}
+
+	var total, byUser int32
+	err = tx.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE user_id = $2)
+		FROM promotion_redemptions
+		WHERE promotion_id = $1
+	`, promotion.ID, order.UserID).Scan(&total, &byUser)
+	if err != nil {
+		return fmt.Errorf("failed to count promotion redemptions: %w", err)
+	}
+	if (promotion.UsageLimit > 0 && total >= promotion.UsageLimit) ||
+		(promotion.PerUserLimit > 0 && byUser >= promotion.PerUserLimit) {
+		return ErrPromotionExhausted
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO promotion_redemptions (promotion_id, user_id, order_id, discount_cents)
+		VALUES ($1, $2, $3, $4)
+	`, promotion.ID, order.UserID, order.ID, order.DiscountCents); err != nil {
+		return fmt.Errorf("failed to redeem promotion: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TaxRate is the combined sales tax rate for a jurisdiction. A rate applies
+// to addresses in Country and, when set, State and zip codes starting with
+// ZipPrefix. RateBps is in basis points, so 725 is 7.25%.
+type TaxRate struct {
+	ID               string
+	Jurisdiction     string
+	Country          string
+	State            string
+	ZipPrefix        string
+	RateBps          int32
+	Inclusive        bool
+	ExemptCategories []string
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// ListTaxRates returns every configured tax rate.
+func (r *OrderRepository) ListTaxRates() ([]TaxRate, error) {
+	query := `
+		SELECT id, jurisdiction, country, state, zip_prefix, rate_bps, inclusive, exempt_categories,
+			created_at, updated_at
+		FROM tax_rates
+		ORDER BY country, state, zip_prefix
+	`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tax rates: %w", err)
+	}
+	defer rows.Close()
+
+	var rates []TaxRate
+	for rows.Next() {
+		var rate TaxRate
+		if err := rows.Scan(
+			&rate.ID, &rate.Jurisdiction, &rate.Country, &rate.State, &rate.ZipPrefix, &rate.RateBps,
+			&rate.Inclusive, pq.Array(&rate.ExemptCategories), &rate.CreatedAt, &rate.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan tax rate: %w", err)
+		}
+		rates = append(rates, rate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate tax rates: %w", err)
+	}
+
+	return rates, nil
+}
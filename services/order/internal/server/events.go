@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+
+	eventsv1 "github.com/safar/microservices-demo/proto/events/v1"
+	"github.com/safar/microservices-demo/services/order/internal/service"
+	"github.com/safar/microservices-demo/shared/events"
+)
+
+// ShipmentEventTypes are the shipment events the order service reacts to.
+var ShipmentEventTypes = []string{events.TypeShipmentStatusChanged}
+
+// EventHandler updates orders in response to events published by other
+// services.
+type EventHandler struct {
+	orderService *service.OrderService
+}
+
+func NewEventHandler(orderService *service.OrderService) *EventHandler {
+	return &EventHandler{
+		orderService: orderService,
+	}
+}
+
+func (h *EventHandler) HandleShipmentEvent(ctx context.Context, event events.Event) error {
+	switch event.Type {
+	case events.TypeShipmentStatusChanged:
+		var changed eventsv1.ShipmentStatusChanged
+		if err := event.Decode(&changed); err != nil {
+			return err
+		}
+		return h.orderService.ApplyShipmentStatus(ctx, changed.OrderId, changed.NewStatus, changed.Description)
+	default:
+		return nil
+	}
+}
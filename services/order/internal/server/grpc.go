@@ -2,15 +2,24 @@ package server
 
 import (
 	"context"
-	"math"
+	"errors"
+	"log"
 
 	commonv1 "github.com/safar/microservices-demo/proto/common/v1"
 	pb "github.com/safar/microservices-demo/proto/order/v1"
+	"github.com/safar/microservices-demo/services/order/internal/repository"
 	"github.com/safar/microservices-demo/services/order/internal/service"
+	"github.com/safar/microservices-demo/shared/pagination"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// CheckoutRolledBackReason is the ErrorInfo reason CreateOrder attaches
+// when a checkout failed and was rolled back, so callers can tell it apart
+// from other failed preconditions.
+const CheckoutRolledBackReason = "CHECKOUT_ROLLED_BACK"
+
 type GRPCServer struct {
 	pb.UnimplementedOrderServiceServer
 	orderService *service.OrderService
@@ -27,7 +36,37 @@ func (s *GRPCServer) CreateOrder(ctx context.Context, req *pb.CreateOrderRequest
 		return nil, status.Error(codes.InvalidArgument, "user ID, shipping address, and payment method ID are required")
 	}
 
-	order, items, err := s.orderService.CreateOrder(ctx, req.UserId, req.ShippingAddress, req.PaymentMethodId)
+	if len(req.IdempotencyKey) > 255 {
+		return nil, status.Error(codes.InvalidArgument, "idempotency key must be at most 255 characters")
+	}
+
+	if (req.ShippingCarrier == "") != (req.ShippingService == "") {
+		return nil, status.Error(codes.InvalidArgument, "shipping carrier and service must be set together")
+	}
+
+	shippingOption := service.ShippingOption{Carrier: req.ShippingCarrier, Service: req.ShippingService}
+	order, items, err := s.orderService.CreateOrder(ctx, req.UserId, req.ShippingAddress, req.PaymentMethodId, shippingOption, req.IdempotencyKey)
+	if errors.Is(err, service.ErrCheckoutInProgress) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	if errors.Is(err, service.ErrIdempotencyKeyReused) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, service.ErrCheckoutRolledBack) {
+		st, derr := status.New(codes.FailedPrecondition, err.Error()).WithDetails(&errdetails.ErrorInfo{
+			Reason: CheckoutRolledBackReason,
+			Domain: "order.microservices-demo",
+		})
+		if derr != nil {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, st.Err()
+	}
+	if errors.Is(err, service.ErrEmptyCart) || errors.Is(err, service.ErrShippingOptionUnavailable) ||
+		errors.Is(err, service.ErrCouponNotFound) || errors.Is(err, service.ErrCouponNotApplicable) ||
+		errors.Is(err, service.ErrProductUnavailable) || errors.Is(err, service.ErrCartPriceChanged) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to create order: %v", err)
 	}
@@ -48,6 +87,18 @@ func (s *GRPCServer) CreateOrder(ctx context.Context, req *pb.CreateOrderRequest
 				AmountCents: item.TotalPriceCents,
 				Currency:    order.Currency,
 			},
+			Tax: &commonv1.Money{
+				AmountCents: item.TaxCents,
+				Currency:    order.Currency,
+			},
+			TaxRateBps:      item.TaxRateBps,
+			TaxJurisdiction: item.TaxJurisdiction,
+			Discount: &commonv1.Money{
+				AmountCents: item.DiscountCents,
+				Currency:    order.Currency,
+			},
+			VariantId: item.VariantID,
+			Sku:       item.SKU,
 		})
 	}
 
@@ -72,6 +123,12 @@ func (s *GRPCServer) CreateOrder(ctx context.Context, req *pb.CreateOrderRequest
 			AmountCents: order.TotalCents,
 			Currency:    order.Currency,
 		},
+		TaxInclusive: order.TaxInclusive,
+		Discount: &commonv1.Money{
+			AmountCents: order.DiscountCents,
+			Currency:    order.Currency,
+		},
+		CouponCode: order.CouponCode.String,
 		ShippingAddress: &commonv1.Address{
 			Street:  order.ShippingStreet,
 			City:    order.ShippingCity,
@@ -106,6 +163,22 @@ func (s *GRPCServer) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb
 		return nil, status.Errorf(codes.NotFound, "order not found: %v", err)
 	}
 
+	pbOrder := convertOrderToProto(order, items, history)
+
+	// Live tracking is best effort; the order is still returned without it
+	tracking, err := s.orderService.TrackShipment(ctx, order)
+	if err != nil {
+		log.Printf("Failed to track shipment for order %s: %v", order.ID, err)
+	} else if tracking != nil {
+		pbOrder.Shipment = tracking.Shipment
+		pbOrder.TrackingEvents = tracking.Events
+	}
+
+	return pbOrder, nil
+}
+
+// convertOrderToProto converts an order with its items and status history.
+func convertOrderToProto(order *repository.Order, items []repository.OrderItem, history []repository.OrderStatusHistory) *pb.Order {
 	// Convert items
 	var pbItems []*pb.OrderItem
 	for _, item := range items {
@@ -122,6 +195,18 @@ func (s *GRPCServer) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb
 				AmountCents: item.TotalPriceCents,
 				Currency:    order.Currency,
 			},
+			Tax: &commonv1.Money{
+				AmountCents: item.TaxCents,
+				Currency:    order.Currency,
+			},
+			TaxRateBps:      item.TaxRateBps,
+			TaxJurisdiction: item.TaxJurisdiction,
+			Discount: &commonv1.Money{
+				AmountCents: item.DiscountCents,
+				Currency:    order.Currency,
+			},
+			VariantId: item.VariantID,
+			Sku:       item.SKU,
 		})
 	}
 
@@ -132,6 +217,7 @@ func (s *GRPCServer) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb
 			Id:        h.ID,
 			Status:    getOrderStatus(h.Status),
 			Notes:     h.Notes,
+			ChangedBy: h.ChangedBy,
 			CreatedAt: h.CreatedAt.Format("2006-01-02T15:04:05Z"),
 		})
 	}
@@ -157,6 +243,12 @@ func (s *GRPCServer) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb
 			AmountCents: order.TotalCents,
 			Currency:    order.Currency,
 		},
+		TaxInclusive: order.TaxInclusive,
+		Discount: &commonv1.Money{
+			AmountCents: order.DiscountCents,
+			Currency:    order.Currency,
+		},
+		CouponCode: order.CouponCode.String,
 		ShippingAddress: &commonv1.Address{
 			Street:  order.ShippingStreet,
 			City:    order.ShippingCity,
@@ -179,7 +271,7 @@ func (s *GRPCServer) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb
 		pbOrder.TrackingNumber = order.TrackingNumber.String
 	}
 
-	return pbOrder, nil
+	return pbOrder
 }
 
 func (s *GRPCServer) ListOrders(ctx context.Context, req *pb.ListOrdersRequest) (*pb.ListOrdersResponse, error) {
@@ -187,14 +279,9 @@ func (s *GRPCServer) ListOrders(ctx context.Context, req *pb.ListOrdersRequest)
 		return nil, status.Error(codes.InvalidArgument, "user ID is required")
 	}
 
-	page := int(req.Pagination.Page)
-	pageSize := int(req.Pagination.PageSize)
-
-	if page <= 0 {
-		page = 1
-	}
-	if pageSize <= 0 {
-		pageSize = 10
+	page, err := pagination.FromProto(req.Pagination, 10)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
 	statusFilter := ""
@@ -202,7 +289,7 @@ func (s *GRPCServer) ListOrders(ctx context.Context, req *pb.ListOrdersRequest)
 		statusFilter = getOrderStatusString(req.StatusFilter)
 	}
 
-	orders, total, err := s.orderService.ListOrders(ctx, req.UserId, page, pageSize, statusFilter)
+	orders, result, err := s.orderService.ListOrders(ctx, req.UserId, page, statusFilter)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to list orders: %v", err)
 	}
@@ -229,6 +316,12 @@ func (s *GRPCServer) ListOrders(ctx context.Context, req *pb.ListOrdersRequest)
 				AmountCents: order.TotalCents,
 				Currency:    order.Currency,
 			},
+			TaxInclusive: order.TaxInclusive,
+			Discount: &commonv1.Money{
+				AmountCents: order.DiscountCents,
+				Currency:    order.Currency,
+			},
+			CouponCode: order.CouponCode.String,
 			CreatedAt: order.CreatedAt.Format("2006-01-02T15:04:05Z"),
 			UpdatedAt: order.UpdatedAt.Format("2006-01-02T15:04:05Z"),
 		}
@@ -236,16 +329,9 @@ func (s *GRPCServer) ListOrders(ctx context.Context, req *pb.ListOrdersRequest)
 		pbOrders = append(pbOrders, pbOrder)
 	}
 
-	totalPages := int32(math.Ceil(float64(total) / float64(pageSize)))
-
 	return &pb.ListOrdersResponse{
-		Orders: pbOrders,
-		Pagination: &commonv1.PaginationResponse{
-			Page:       int32(page),
-			PageSize:   int32(pageSize),
-			TotalPages: totalPages,
-			TotalCount: int64(total),
-		},
+		Orders:     pbOrders,
+		Pagination: pagination.ToProto(page, result),
 	}, nil
 }
 
@@ -254,16 +340,24 @@ func (s *GRPCServer) UpdateOrderStatus(ctx context.Context, req *pb.UpdateOrderS
 		return nil, status.Error(codes.InvalidArgument, "order ID is required")
 	}
 
+	if req.Status == pb.OrderStatus_ORDER_STATUS_UNSPECIFIED {
+		return nil, status.Error(codes.InvalidArgument, "status is required")
+	}
+	if req.ChangedBy == "" {
+		return nil, status.Error(codes.InvalidArgument, "changed by is required")
+	}
+
 	statusStr := getOrderStatusString(req.Status)
-	if err := s.orderService.UpdateOrderStatus(ctx, req.Id, statusStr, req.Notes); err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to update order status: %v", err)
+	if err := s.orderService.UpdateOrderStatus(ctx, req.Id, statusStr, req.Notes, req.ChangedBy); err != nil {
+		return nil, orderStatusError("failed to update order status", err)
 	}
 
-	// Return updated order (simplified - would need user ID)
-	return &pb.Order{
-		Id:     req.Id,
-		Status: req.Status,
-	}, nil
+	order, items, history, err := s.orderService.GetOrderByID(ctx, req.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get updated order: %v", err)
+	}
+
+	return convertOrderToProto(order, items, history), nil
 }
 
 func (s *GRPCServer) CancelOrder(ctx context.Context, req *pb.CancelOrderRequest) (*pb.Order, error) {
@@ -272,15 +366,110 @@ func (s *GRPCServer) CancelOrder(ctx context.Context, req *pb.CancelOrderRequest
 	}
 
 	if err := s.orderService.CancelOrder(ctx, req.Id, req.UserId, req.Reason); err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to cancel order: %v", err)
+		return nil, orderStatusError("failed to cancel order", err)
+	}
+
+	// A paid order moves on to refunded once its payment is returned
+	order, items, history, err := s.orderService.GetOrderByID(ctx, req.Id)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get cancelled order: %v", err)
+	}
+
+	return convertOrderToProto(order, items, history), nil
+}
+
+func (s *GRPCServer) GetShippingQuotes(ctx context.Context, req *pb.GetShippingQuotesRequest) (*pb.GetShippingQuotesResponse, error) {
+	if req.UserId == "" || req.ShippingAddress == nil {
+		return nil, status.Error(codes.InvalidArgument, "user ID and shipping address are required")
+	}
+
+	quotes, weightGrams, err := s.orderService.GetShippingQuotes(ctx, req.UserId, req.ShippingAddress)
+	if errors.Is(err, service.ErrEmptyCart) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get shipping quotes: %v", err)
+	}
+
+	return &pb.GetShippingQuotesResponse{
+		Quotes:      quotes,
+		WeightGrams: weightGrams,
+	}, nil
+}
+
+// EvaluateCoupon prices a coupon against cart items for the cart service.
+// Guest carts are evaluated without a user ID.
+func (s *GRPCServer) EvaluateCoupon(ctx context.Context, req *pb.EvaluateCouponRequest) (*pb.EvaluateCouponResponse, error) {
+	if req.CouponCode == "" {
+		return nil, status.Error(codes.InvalidArgument, "coupon code is required")
+	}
+
+	var lines []service.PromotionLine
+	currency := "USD"
+	for _, item := range req.Items {
+		if item.UnitPrice == nil {
+			return nil, status.Error(codes.InvalidArgument, "item unit price is required")
+		}
+		lines = append(lines, service.PromotionLine{
+			ProductID:      item.ProductId,
+			Quantity:       item.Quantity,
+			UnitPriceCents: item.UnitPrice.AmountCents,
+		})
+		currency = item.UnitPrice.Currency
 	}
 
-	return &pb.Order{
-		Id:     req.Id,
-		Status: pb.OrderStatus_ORDER_STATUS_CANCELLED,
+	promotion, discount, err := s.orderService.EvaluateCoupon(ctx, req.UserId, req.CouponCode, lines)
+	if errors.Is(err, service.ErrCouponNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if errors.Is(err, service.ErrCouponNotApplicable) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to evaluate coupon: %v", err)
+	}
+
+	return &pb.EvaluateCouponResponse{
+		CouponCode:  promotion.Code,
+		Description: promotion.Description,
+		Discount: &commonv1.Money{
+			AmountCents: discount.ItemsCents,
+			Currency:    currency,
+		},
+		FreeShipping: discount.FreeShipping,
 	}, nil
 }
 
+// HasPurchasedProduct tells the catalog service whether a user bought a
+// product they are reviewing.
+func (s *GRPCServer) HasPurchasedProduct(ctx context.Context, req *pb.HasPurchasedProductRequest) (*pb.HasPurchasedProductResponse, error) {
+	if req.UserId == "" || req.ProductId == "" {
+		return nil, status.Error(codes.InvalidArgument, "user ID and product ID are required")
+	}
+
+	purchased, orderID, err := s.orderService.HasPurchasedProduct(ctx, req.UserId, req.ProductId)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to check purchase: %v", err)
+	}
+
+	return &pb.HasPurchasedProductResponse{
+		Purchased: purchased,
+		OrderId:   orderID,
+	}, nil
+}
+
+// orderStatusError maps order status update failures to gRPC status codes.
+func orderStatusError(msg string, err error) error {
+	switch {
+	case errors.Is(err, repository.ErrOrderNotFound):
+		return status.Error(codes.NotFound, "order not found")
+	case errors.Is(err, service.ErrInvalidStatusTransition):
+		return status.Errorf(codes.FailedPrecondition, "%s: %v", msg, err)
+	default:
+		return status.Errorf(codes.Internal, "%s: %v", msg, err)
+	}
+}
+
 func getOrderStatus(status string) pb.OrderStatus {
 	switch status {
 	case "pending":
@@ -0,0 +1,516 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	cartpb "github.com/safar/microservices-demo/proto/cart/v1"
+	catalogpb "github.com/safar/microservices-demo/proto/catalog/v1"
+	commonpb "github.com/safar/microservices-demo/proto/common/v1"
+	paymentpb "github.com/safar/microservices-demo/proto/payment/v1"
+	shippingpb "github.com/safar/microservices-demo/proto/shipping/v1"
+	"github.com/safar/microservices-demo/services/order/internal/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// sagaStaleAfter is how long a saga must be idle before recovery picks it
+// up, so sagas still being driven by a live request are left alone.
+const sagaStaleAfter = time.Minute
+
+// sagaLease is how long recovery holds a claimed saga before another worker
+// may claim it again.
+const sagaLease = 5 * time.Minute
+
+// sagaRecoveryBatch bounds how many sagas one recovery pass claims.
+const sagaRecoveryBatch = 50
+
+// reservationExpirationMinutes bounds how long reserved stock is held if a
+// saga never commits or releases it.
+const reservationExpirationMinutes = 15
+
+// checkCartPrices verifies that every product in the cart, or variant of
+// it, is still sold at the price the cart charges for it, and that the
+// customer has accepted any price change since the item was added. The cart
+// reprices items from the catalog when it is read, so an item whose price
+// moved is flagged price_changed until the customer accepts the new price.
+func checkCartPrices(cart *cartpb.Cart, products map[string]*catalogpb.Product) error {
+	for _, item := range cart.Items {
+		product := products[item.ProductId]
+		if !product.GetIsActive() || item.Unavailable {
+			return fmt.Errorf("%w: %s", ErrProductUnavailable, item.ProductName)
+		}
+
+		if item.PriceChanged {
+			return fmt.Errorf("%w: %s was added at %d %s and now costs %d %s", ErrCartPriceChanged, item.ProductName,
+				item.AddedUnitPrice.GetAmountCents(), item.AddedUnitPrice.GetCurrency(),
+				item.UnitPrice.GetAmountCents(), item.UnitPrice.GetCurrency())
+		}
+
+		price := product.GetPrice()
+		if item.VariantId != "" || len(product.GetVariants()) > 0 {
+			variant := productVariant(product, item.VariantId)
+			if variant == nil {
+				return fmt.Errorf("%w: %s", ErrProductUnavailable, item.ProductName)
+			}
+			price = variant.Price
+		}
+
+		if item.UnitPrice.GetAmountCents() != price.GetAmountCents() ||
+			item.UnitPrice.GetCurrency() != price.GetCurrency() {
+			return fmt.Errorf("%w: %s", ErrCartPriceChanged, item.ProductName)
+		}
+	}
+	return nil
+}
+
+// sagaWorkerID identifies this process as the owner of the sagas it
+// claims.
+func sagaWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "order-service"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// productVariant returns the variant of product with the given id, or nil
+// if it is not sold.
+func productVariant(product *catalogpb.Product, variantID string) *catalogpb.ProductVariant {
+	for _, variant := range product.GetVariants() {
+		if variant.Id == variantID && variant.IsActive {
+			return variant
+		}
+	}
+	return nil
+}
+
+func newCheckoutSaga(userID string, shippingAddress *commonpb.Address, paymentMethodID string, option ShippingOption, cart *cartpb.Cart, products map[string]*catalogpb.Product) *repository.CheckoutSaga {
+	saga := &repository.CheckoutSaga{
+		UserID:          userID,
+		State:           repository.SagaStateStarted,
+		Currency:        cart.Total.Currency,
+		ShippingStreet:  shippingAddress.Street,
+		ShippingCity:    shippingAddress.City,
+		ShippingState:   shippingAddress.State,
+		ShippingZip:     shippingAddress.ZipCode,
+		ShippingCountry: shippingAddress.Country,
+		PaymentMethodID: paymentMethodID,
+		ShippingCarrier: sql.NullString{String: option.Carrier, Valid: option.Carrier != ""},
+		ShippingService: sql.NullString{String: option.Service, Valid: option.Service != ""},
+		CouponCode:      couponCode(cart.CouponCode),
+	}
+
+	for _, item := range cart.Items {
+		saga.Items = append(saga.Items, repository.SagaItem{
+			ProductID:      item.ProductId,
+			VariantID:      item.VariantId,
+			SKU:            item.Sku,
+			ProductName:    item.ProductName,
+			Quantity:       item.Quantity,
+			UnitPriceCents: item.UnitPrice.AmountCents,
+			Currency:       item.UnitPrice.Currency,
+			ImageURL:       item.ImageUrl,
+			WeightGrams:    products[item.ProductId].GetWeightGrams(),
+			CategoryID:     products[item.ProductId].GetCategoryId(),
+		})
+		saga.SubtotalCents += item.UnitPrice.AmountCents * int64(item.Quantity)
+	}
+
+	return saga
+}
+
+// runCheckoutSaga drives a saga forward from its recorded state until it
+// completes. If a step fails, every step that already succeeded is
+// compensated in reverse order and the step's error is returned. If another
+// worker took the saga over, it is left to that worker untouched.
+func (s *OrderService) runCheckoutSaga(ctx context.Context, saga *repository.CheckoutSaga) (*repository.Order, []repository.OrderItem, error) {
+	var order *repository.Order
+	var items []repository.OrderItem
+
+	for !saga.IsTerminal() {
+		var err error
+		switch saga.State {
+		case repository.SagaStateStarted:
+			err = s.reserveInventory(ctx, saga)
+		case repository.SagaStateInventoryReserved:
+			err = s.chargePayment(ctx, saga)
+		case repository.SagaStatePaymentCharged:
+			err = s.clearCart(ctx, saga)
+		case repository.SagaStateCartCleared:
+			err = s.createShipment(ctx, saga)
+		case repository.SagaStateShipmentCreated:
+			order, items, err = s.completeCheckout(ctx, saga)
+		case repository.SagaStateCompensating:
+			if cerr := s.compensateCheckoutSaga(ctx, saga); cerr != nil {
+				return nil, nil, cerr
+			}
+			return nil, nil, checkoutRolledBack(saga)
+		default:
+			return nil, nil, fmt.Errorf("checkout %s is in unknown state %q", saga.ID, saga.State)
+		}
+
+		if errors.Is(err, repository.ErrCheckoutSagaConflict) {
+			return nil, nil, err
+		}
+		if err != nil {
+			saga.State = repository.SagaStateCompensating
+			saga.LastError = sql.NullString{String: err.Error(), Valid: true}
+			if uerr := s.repo.UpdateCheckoutSaga(saga); uerr != nil {
+				return nil, nil, fmt.Errorf("%w (failed to record saga failure: %v)", err, uerr)
+			}
+			if cerr := s.compensateCheckoutSaga(ctx, saga); cerr != nil {
+				return nil, nil, fmt.Errorf("%w (compensation incomplete: %v)", err, cerr)
+			}
+			return nil, nil, err
+		}
+	}
+
+	return order, items, nil
+}
+
+// checkoutRolledBack reports that saga failed and was rolled back, and why.
+func checkoutRolledBack(saga *repository.CheckoutSaga) error {
+	return fmt.Errorf("%w: checkout %s: %s", ErrCheckoutRolledBack, saga.ID, saga.LastError.String)
+}
+
+// advanceCheckoutSaga records that a step finished and moves to the next state.
+func (s *OrderService) advanceCheckoutSaga(saga *repository.CheckoutSaga, state string) error {
+	saga.State = state
+	if err := s.repo.UpdateCheckoutSaga(saga); err != nil {
+		return fmt.Errorf("failed to record checkout progress: %w", err)
+	}
+	return nil
+}
+
+func (s *OrderService) reserveInventory(ctx context.Context, saga *repository.CheckoutSaga) error {
+	var inventoryItems []*catalogpb.InventoryItem
+	for _, item := range saga.Items {
+		inventoryItems = append(inventoryItems, &catalogpb.InventoryItem{
+			ProductId: item.ProductID,
+			VariantId: item.VariantID,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	inventoryCheck, err := s.clients.Catalog.CheckInventory(ctx, &catalogpb.CheckInventoryRequest{
+		Items: inventoryItems,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check inventory: %w", err)
+	}
+
+	if !inventoryCheck.Available {
+		return fmt.Errorf("insufficient inventory for products: %v", append(inventoryCheck.UnavailableProductIds, inventoryCheck.UnavailableVariantIds...))
+	}
+
+	reserveResp, err := s.clients.Catalog.ReserveInventory(ctx, &catalogpb.ReserveInventoryRequest{
+		OrderId:           saga.ID,
+		Items:             inventoryItems,
+		ExpirationMinutes: reservationExpirationMinutes,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reserve inventory: %w", err)
+	}
+	if !reserveResp.Success {
+		return fmt.Errorf("failed to reserve inventory")
+	}
+
+	saga.ReservationID = sql.NullString{String: reserveResp.ReservationId, Valid: reserveResp.ReservationId != ""}
+	return s.advanceCheckoutSaga(saga, repository.SagaStateInventoryReserved)
+}
+
+func (s *OrderService) chargePayment(ctx context.Context, saga *repository.CheckoutSaga) error {
+	shippingQuote, err := s.clients.Shipping.GetQuote(ctx, &shippingpb.GetQuoteRequest{
+		From:        warehouseAddress,
+		To:          sagaShippingAddress(saga),
+		WeightGrams: sagaWeightGrams(saga),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get shipping quote: %w", err)
+	}
+
+	quote, err := selectShippingQuote(shippingQuote.Quotes, ShippingOption{
+		Carrier: saga.ShippingCarrier.String,
+		Service: saga.ShippingService.String,
+	})
+	if err != nil {
+		return err
+	}
+
+	saga.ShippingCarrier = sql.NullString{String: quote.Carrier, Valid: true}
+	saga.ShippingService = sql.NullString{String: quote.Service, Valid: true}
+	saga.ShippingCents = quote.Cost.AmountCents
+	if err := s.applyCoupon(ctx, saga); err != nil {
+		return err
+	}
+	if err := s.applyTax(ctx, saga); err != nil {
+		return err
+	}
+	saga.TotalCents = saga.SubtotalCents + saga.ShippingCents - saga.DiscountCents
+	if !saga.TaxInclusive {
+		saga.TotalCents += saga.TaxCents
+	}
+
+	// The idempotency key is derived from the saga so a resumed saga
+	// re-charging after a crash gets the original transaction back.
+	chargeResp, err := s.clients.Payment.Charge(ctx, &paymentpb.ChargeRequest{
+		OrderId:         saga.ID,
+		UserId:          saga.UserID,
+		PaymentMethodId: saga.PaymentMethodID,
+		Amount: &commonpb.Money{
+			AmountCents: saga.TotalCents,
+			Currency:    saga.Currency,
+		},
+		IdempotencyKey: "checkout-" + saga.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("payment failed: %w", err)
+	}
+	if !chargeResp.Success {
+		return fmt.Errorf("payment failed: %s", chargeResp.ErrorMessage)
+	}
+
+	saga.TransactionID = sql.NullString{String: chargeResp.Transaction.Id, Valid: true}
+	return s.advanceCheckoutSaga(saga, repository.SagaStatePaymentCharged)
+}
+
+func (s *OrderService) clearCart(ctx context.Context, saga *repository.CheckoutSaga) error {
+	if _, err := s.clients.Cart.ClearCart(ctx, &cartpb.ClearCartRequest{
+		UserId: saga.UserID,
+	}); err != nil {
+		return fmt.Errorf("failed to clear cart: %w", err)
+	}
+
+	saga.CartCleared = true
+	return s.advanceCheckoutSaga(saga, repository.SagaStateCartCleared)
+}
+
+// createShipment books the shipment with the quoted carrier and service so
+// the order is created with its tracking number. The shipping service
+// returns the existing shipment if the saga is resumed after this step.
+func (s *OrderService) createShipment(ctx context.Context, saga *repository.CheckoutSaga) error {
+	shipment, err := s.clients.Shipping.CreateShipment(ctx, &shippingpb.CreateShipmentRequest{
+		OrderId:     saga.ID,
+		From:        warehouseAddress,
+		To:          sagaShippingAddress(saga),
+		WeightGrams: sagaWeightGrams(saga),
+		Carrier:     saga.ShippingCarrier.String,
+		Service:     saga.ShippingService.String,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create shipment: %w", err)
+	}
+
+	saga.TrackingNumber = sql.NullString{String: shipment.TrackingNumber, Valid: true}
+	return s.advanceCheckoutSaga(saga, repository.SagaStateShipmentCreated)
+}
+
+func (s *OrderService) completeCheckout(ctx context.Context, saga *repository.CheckoutSaga) (*repository.Order, []repository.OrderItem, error) {
+	// Commit before the order exists so expiry can never hand sold stock
+	// back; a later failure releases the committed reservation instead.
+	if saga.ReservationID.Valid {
+		if _, err := s.clients.Catalog.CommitReservation(ctx, &catalogpb.CommitReservationRequest{
+			ReservationId: saga.ReservationID.String,
+		}); err != nil {
+			return nil, nil, fmt.Errorf("failed to commit reservation: %w", err)
+		}
+	}
+
+	order := &repository.Order{
+		ID:              saga.ID,
+		UserID:          saga.UserID,
+		Status:          repository.OrderStatusConfirmed,
+		SubtotalCents:   saga.SubtotalCents,
+		ShippingCents:   saga.ShippingCents,
+		TaxCents:        saga.TaxCents,
+		TotalCents:      saga.TotalCents,
+		TaxInclusive:    saga.TaxInclusive,
+		DiscountCents:   saga.DiscountCents,
+		CouponCode:      saga.CouponCode,
+		Currency:        saga.Currency,
+		ShippingStreet:  saga.ShippingStreet,
+		ShippingCity:    saga.ShippingCity,
+		ShippingState:   saga.ShippingState,
+		ShippingZip:     saga.ShippingZip,
+		ShippingCountry: saga.ShippingCountry,
+		PaymentMethodID: sql.NullString{String: saga.PaymentMethodID, Valid: true},
+		TransactionID:   saga.TransactionID,
+		TrackingNumber:  saga.TrackingNumber,
+	}
+
+	var orderItems []repository.OrderItem
+	for _, item := range saga.Items {
+		orderItems = append(orderItems, repository.OrderItem{
+			ProductID:       item.ProductID,
+			ProductName:     item.ProductName,
+			Quantity:        item.Quantity,
+			UnitPriceCents:  item.UnitPriceCents,
+			TotalPriceCents: item.UnitPriceCents * int64(item.Quantity),
+			TaxCents:        item.TaxCents,
+			TaxRateBps:      item.TaxRateBps,
+			TaxJurisdiction: item.TaxJurisdiction,
+			DiscountCents:   item.DiscountCents,
+			VariantID:       item.VariantID,
+			SKU:             item.SKU,
+		})
+	}
+
+	createdOrder, err := s.repo.CompleteCheckoutSaga(saga, order, orderItems)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create order: %w", couponRedemptionError(err))
+	}
+
+	return createdOrder, orderItems, nil
+}
+
+// compensateCheckoutSaga undoes completed steps in reverse order. Each
+// compensation is recorded as soon as it succeeds, so a retry after a
+// partial failure never refunds or restores twice.
+func (s *OrderService) compensateCheckoutSaga(ctx context.Context, saga *repository.CheckoutSaga) error {
+	if saga.TrackingNumber.Valid && !saga.ShipmentCancelled {
+		if _, err := s.clients.Shipping.CancelShipment(ctx, &shippingpb.CancelShipmentRequest{
+			OrderId: saga.ID,
+			Reason:  "checkout failed",
+		}); err != nil {
+			return s.recordCompensationFailure(saga, fmt.Errorf("failed to cancel shipment: %w", err))
+		}
+		saga.ShipmentCancelled = true
+		if err := s.repo.UpdateCheckoutSaga(saga); err != nil {
+			return fmt.Errorf("failed to record shipment cancellation: %w", err)
+		}
+	}
+
+	if saga.CartCleared && !saga.CartRestored {
+		for _, item := range saga.Items {
+			_, err := s.clients.Cart.AddItem(ctx, &cartpb.AddItemRequest{
+				UserId:    saga.UserID,
+				ProductId: item.ProductID,
+				VariantId: item.VariantID,
+				Quantity:  item.Quantity,
+			})
+			// A product that stopped being sold since checkout started
+			// cannot go back into the cart
+			if code := status.Code(err); code == codes.NotFound || code == codes.FailedPrecondition {
+				log.Printf("Not restoring %s to cart of checkout %s: %v", item.ProductID, saga.ID, err)
+				continue
+			}
+			if err != nil {
+				return s.recordCompensationFailure(saga, fmt.Errorf("failed to restore cart: %w", err))
+			}
+		}
+		saga.CartRestored = true
+		if err := s.repo.UpdateCheckoutSaga(saga); err != nil {
+			return fmt.Errorf("failed to record cart restore: %w", err)
+		}
+	}
+
+	if saga.TransactionID.Valid && !saga.PaymentRefunded {
+		refundResp, err := s.clients.Payment.Refund(ctx, &paymentpb.RefundRequest{
+			TransactionId: saga.TransactionID.String,
+			Amount: &commonpb.Money{
+				AmountCents: saga.TotalCents,
+				Currency:    saga.Currency,
+			},
+			Reason: "checkout failed",
+		})
+		if err != nil {
+			return s.recordCompensationFailure(saga, fmt.Errorf("failed to refund payment: %w", err))
+		}
+		if !refundResp.Success {
+			return s.recordCompensationFailure(saga, fmt.Errorf("failed to refund payment: %s", refundResp.ErrorMessage))
+		}
+		saga.PaymentRefunded = true
+		if err := s.repo.UpdateCheckoutSaga(saga); err != nil {
+			return fmt.Errorf("failed to record refund: %w", err)
+		}
+	}
+
+	if saga.ReservationID.Valid && !saga.ReservationReleased {
+		if _, err := s.clients.Catalog.ReleaseReservation(ctx, &catalogpb.ReleaseReservationRequest{
+			ReservationId: saga.ReservationID.String,
+		}); err != nil {
+			return s.recordCompensationFailure(saga, fmt.Errorf("failed to release reservation: %w", err))
+		}
+		saga.ReservationReleased = true
+		if err := s.repo.UpdateCheckoutSaga(saga); err != nil {
+			return fmt.Errorf("failed to record reservation release: %w", err)
+		}
+	}
+
+	return s.advanceCheckoutSaga(saga, repository.SagaStateCompensated)
+}
+
+// recordCompensationFailure keeps the saga in the compensating state so
+// recovery retries it, and returns err.
+func (s *OrderService) recordCompensationFailure(saga *repository.CheckoutSaga, err error) error {
+	if uerr := s.repo.UpdateCheckoutSaga(saga); uerr != nil {
+		log.Printf("Failed to record compensation progress for checkout %s: %v", saga.ID, uerr)
+		if errors.Is(uerr, repository.ErrCheckoutSagaConflict) {
+			return uerr
+		}
+	}
+	return err
+}
+
+// ResumeCheckoutSagas picks up sagas left unfinished by a crash or restart.
+// Sagas that were moving forward continue from their last recorded step;
+// sagas that were compensating finish their rollback. Each saga is claimed
+// first, so replicas running recovery never drive the same saga at once.
+func (s *OrderService) ResumeCheckoutSagas(ctx context.Context) error {
+	sagas, err := s.repo.ClaimStaleCheckoutSagas(s.workerID, sagaStaleAfter, sagaLease, sagaRecoveryBatch)
+	if err != nil {
+		return fmt.Errorf("failed to claim unfinished checkouts: %w", err)
+	}
+
+	for _, saga := range sagas {
+		if _, _, err := s.runCheckoutSaga(ctx, saga); err != nil {
+			log.Printf("Checkout %s did not complete on resume: %v", saga.ID, err)
+			continue
+		}
+		log.Printf("Checkout %s resumed and completed", saga.ID)
+	}
+
+	return nil
+}
+
+// RunSagaRecovery resumes unfinished sagas every interval until ctx is done.
+func (s *OrderService) RunSagaRecovery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.ResumeCheckoutSagas(ctx); err != nil {
+			log.Printf("Saga recovery failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func sagaShippingAddress(saga *repository.CheckoutSaga) *commonpb.Address {
+	return &commonpb.Address{
+		Street:  saga.ShippingStreet,
+		City:    saga.ShippingCity,
+		State:   saga.ShippingState,
+		ZipCode: saga.ShippingZip,
+		Country: saga.ShippingCountry,
+	}
+}
+
+func sameShippingAddress(saga *repository.CheckoutSaga, addr *commonpb.Address) bool {
+	return saga.ShippingStreet == addr.Street &&
+		saga.ShippingCity == addr.City &&
+		saga.ShippingState == addr.State &&
+		saga.ShippingZip == addr.ZipCode &&
+		saga.ShippingCountry == addr.Country
+}
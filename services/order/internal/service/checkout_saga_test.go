@@ -0,0 +1,661 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	cartpb "github.com/safar/microservices-demo/proto/cart/v1"
+	catalogpb "github.com/safar/microservices-demo/proto/catalog/v1"
+	commonpb "github.com/safar/microservices-demo/proto/common/v1"
+	notificationpb "github.com/safar/microservices-demo/proto/notification/v1"
+	paymentpb "github.com/safar/microservices-demo/proto/payment/v1"
+	shippingpb "github.com/safar/microservices-demo/proto/shipping/v1"
+	"github.com/safar/microservices-demo/services/order/internal/client"
+	"github.com/safar/microservices-demo/services/order/internal/repository"
+	"github.com/safar/microservices-demo/shared/pagination"
+	"google.golang.org/grpc"
+)
+
+type fakeOrderStore struct {
+	sagas       map[string]*repository.CheckoutSaga
+	orders      map[string]*repository.Order
+	items       map[string][]repository.OrderItem
+	history     map[string][]repository.OrderStatusHistory
+	promotions  map[string]*repository.Promotion
+	redemptions map[string][]string
+	completeErr error
+	nextID      int
+}
+
+func newFakeOrderStore() *fakeOrderStore {
+	return &fakeOrderStore{
+		sagas:       make(map[string]*repository.CheckoutSaga),
+		orders:      make(map[string]*repository.Order),
+		items:       make(map[string][]repository.OrderItem),
+		history:     make(map[string][]repository.OrderStatusHistory),
+		promotions:  make(map[string]*repository.Promotion),
+		redemptions: make(map[string][]string),
+	}
+}
+
+func (f *fakeOrderStore) GetOrder(orderID, userID string) (*repository.Order, []repository.OrderItem, []repository.OrderStatusHistory, error) {
+	order, ok := f.orders[orderID]
+	if !ok || order.UserID != userID {
+		return nil, nil, nil, repository.ErrOrderNotFound
+	}
+	return order, nil, f.history[orderID], nil
+}
+
+func (f *fakeOrderStore) GetOrderByID(orderID string) (*repository.Order, []repository.OrderItem, []repository.OrderStatusHistory, error) {
+	order, ok := f.orders[orderID]
+	if !ok {
+		return nil, nil, nil, repository.ErrOrderNotFound
+	}
+	return order, f.items[orderID], f.history[orderID], nil
+}
+
+func (f *fakeOrderStore) ListOrders(userID string, page pagination.Page, statusFilter string) ([]*repository.Order, pagination.Result, error) {
+	return nil, pagination.Result{}, nil
+}
+
+func (f *fakeOrderStore) UpdateOrderStatus(orderID string, fromStatuses []string, status, notes, changedBy string) error {
+	order, ok := f.orders[orderID]
+	if !ok {
+		return repository.ErrOrderNotFound
+	}
+	allowed := false
+	for _, from := range fromStatuses {
+		if order.Status == from {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%w: order is %s", repository.ErrOrderStatusMismatch, order.Status)
+	}
+	order.Status = status
+	f.history[orderID] = append(f.history[orderID], repository.OrderStatusHistory{
+		OrderID:   orderID,
+		Status:    status,
+		Notes:     notes,
+		ChangedBy: changedBy,
+	})
+	return nil
+}
+
+func (f *fakeOrderStore) FindProductPurchase(userID, productID string, statuses []string) (string, error) {
+	for id, order := range f.orders {
+		if order.UserID != userID || !slices.Contains(statuses, order.Status) {
+			continue
+		}
+		for _, item := range f.items[id] {
+			if item.ProductID == productID {
+				return id, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func (f *fakeOrderStore) CreateCheckoutSaga(saga *repository.CheckoutSaga) (*repository.CheckoutSaga, error) {
+	if saga.IdempotencyKey.Valid {
+		if _, err := f.GetCheckoutSagaByIdempotencyKey(saga.UserID, saga.IdempotencyKey.String); err == nil {
+			return nil, repository.ErrDuplicateIdempotencyKey
+		}
+	}
+	f.nextID++
+	saga.ID = fmt.Sprintf("saga-%d", f.nextID)
+	saved := *saga
+	f.sagas[saga.ID] = &saved
+	return saga, nil
+}
+
+func (f *fakeOrderStore) GetCheckoutSagaByIdempotencyKey(userID, key string) (*repository.CheckoutSaga, error) {
+	for _, saga := range f.sagas {
+		if saga.UserID == userID && saga.IdempotencyKey.Valid && saga.IdempotencyKey.String == key {
+			copied := *saga
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrCheckoutSagaNotFound
+}
+
+func (f *fakeOrderStore) UpdateCheckoutSaga(saga *repository.CheckoutSaga) error {
+	if stored, ok := f.sagas[saga.ID]; ok && stored.Version != saga.Version {
+		return repository.ErrCheckoutSagaConflict
+	}
+	saga.Version++
+	saved := *saga
+	f.sagas[saga.ID] = &saved
+	return nil
+}
+
+// ClaimStaleCheckoutSagas treats every saga as stale, but skips sagas
+// another owner's claim still holds.
+func (f *fakeOrderStore) ClaimStaleCheckoutSagas(owner string, staleAfter, lease time.Duration, limit int) ([]*repository.CheckoutSaga, error) {
+	var sagas []*repository.CheckoutSaga
+	for _, saga := range f.sagas {
+		if saga.IsTerminal() || (saga.ClaimedUntil.Valid && saga.ClaimedUntil.Time.After(time.Now())) {
+			continue
+		}
+		if len(sagas) == limit {
+			break
+		}
+		saga.ClaimedBy = sql.NullString{String: owner, Valid: true}
+		saga.ClaimedUntil = sql.NullTime{Time: time.Now().Add(lease), Valid: true}
+		saga.Version++
+		copied := *saga
+		sagas = append(sagas, &copied)
+	}
+	return sagas, nil
+}
+
+func (f *fakeOrderStore) CompleteCheckoutSaga(saga *repository.CheckoutSaga, order *repository.Order, items []repository.OrderItem) (*repository.Order, error) {
+	if f.completeErr != nil {
+		return nil, f.completeErr
+	}
+	if order.CouponCode.Valid {
+		promotion, err := f.GetPromotionByCode(order.CouponCode.String)
+		if err != nil {
+			return nil, err
+		}
+		total, byUser, _ := f.CountPromotionRedemptions(promotion.ID, order.UserID)
+		if (promotion.UsageLimit > 0 && total >= int(promotion.UsageLimit)) ||
+			(promotion.PerUserLimit > 0 && byUser >= int(promotion.PerUserLimit)) {
+			return nil, repository.ErrPromotionExhausted
+		}
+		f.redemptions[promotion.ID] = append(f.redemptions[promotion.ID], order.UserID)
+	}
+	if stored, ok := f.sagas[saga.ID]; ok && stored.Version != saga.Version {
+		return nil, repository.ErrCheckoutSagaConflict
+	}
+	f.orders[order.ID] = order
+	f.items[order.ID] = items
+	saga.State = repository.SagaStateCompleted
+	return order, f.UpdateCheckoutSaga(saga)
+}
+
+type fakeCatalogClient struct {
+	catalogpb.CatalogServiceClient
+	weights    map[string]int32
+	categories map[string]string
+	prices     map[string]int64
+	inactive   map[string]bool
+	variants   map[string][]*catalogpb.ProductVariant
+	reserveErr error
+	reserved   []string
+	committed  []string
+	released   []string
+	// reservedItems are the items of the last reservation.
+	reservedItems []*catalogpb.InventoryItem
+}
+
+func (f *fakeCatalogClient) GetProduct(ctx context.Context, in *catalogpb.GetProductRequest, opts ...grpc.CallOption) (*catalogpb.Product, error) {
+	return &catalogpb.Product{
+		Id:          in.GetId(),
+		WeightGrams: f.weights[in.GetId()],
+		CategoryId:  f.categories[in.GetId()],
+		Price:       &commonpb.Money{AmountCents: f.prices[in.GetId()], Currency: "USD"},
+		IsActive:    !f.inactive[in.GetId()],
+		Variants:    f.variants[in.GetId()],
+	}, nil
+}
+
+func (f *fakeCatalogClient) CheckInventory(ctx context.Context, in *catalogpb.CheckInventoryRequest, opts ...grpc.CallOption) (*catalogpb.CheckInventoryResponse, error) {
+	return &catalogpb.CheckInventoryResponse{Available: true}, nil
+}
+
+func (f *fakeCatalogClient) ReserveInventory(ctx context.Context, in *catalogpb.ReserveInventoryRequest, opts ...grpc.CallOption) (*catalogpb.ReserveInventoryResponse, error) {
+	if f.reserveErr != nil {
+		return nil, f.reserveErr
+	}
+	f.reserved = append(f.reserved, in.OrderId)
+	f.reservedItems = in.Items
+	return &catalogpb.ReserveInventoryResponse{Success: true, ReservationId: "res-" + in.OrderId}, nil
+}
+
+func (f *fakeCatalogClient) CommitReservation(ctx context.Context, in *catalogpb.CommitReservationRequest, opts ...grpc.CallOption) (*commonpb.Empty, error) {
+	f.committed = append(f.committed, in.ReservationId)
+	return &commonpb.Empty{}, nil
+}
+
+func (f *fakeCatalogClient) ReleaseReservation(ctx context.Context, in *catalogpb.ReleaseReservationRequest, opts ...grpc.CallOption) (*commonpb.Empty, error) {
+	f.released = append(f.released, in.ReservationId)
+	return &commonpb.Empty{}, nil
+}
+
+type fakeCartClient struct {
+	cartpb.CartServiceClient
+	cart     *cartpb.Cart
+	clearErr error
+	cleared  int
+	restored []*cartpb.AddItemRequest
+}
+
+func (f *fakeCartClient) GetCart(ctx context.Context, in *cartpb.GetCartRequest, opts ...grpc.CallOption) (*cartpb.Cart, error) {
+	return f.cart, nil
+}
+
+func (f *fakeCartClient) ClearCart(ctx context.Context, in *cartpb.ClearCartRequest, opts ...grpc.CallOption) (*commonpb.Empty, error) {
+	if f.clearErr != nil {
+		return nil, f.clearErr
+	}
+	f.cleared++
+	return &commonpb.Empty{}, nil
+}
+
+func (f *fakeCartClient) AddItem(ctx context.Context, in *cartpb.AddItemRequest, opts ...grpc.CallOption) (*cartpb.Cart, error) {
+	f.restored = append(f.restored, in)
+	return f.cart, nil
+}
+
+type fakePaymentClient struct {
+	paymentpb.PaymentServiceClient
+	chargeErr error
+	refundErr error
+	onCharge  func()
+	charges   []*paymentpb.ChargeRequest
+	refunds   []*paymentpb.RefundRequest
+}
+
+func (f *fakePaymentClient) Charge(ctx context.Context, in *paymentpb.ChargeRequest, opts ...grpc.CallOption) (*paymentpb.ChargeResponse, error) {
+	if f.chargeErr != nil {
+		return nil, f.chargeErr
+	}
+	if f.onCharge != nil {
+		f.onCharge()
+	}
+	f.charges = append(f.charges, in)
+	return &paymentpb.ChargeResponse{
+		Success:     true,
+		Transaction: &paymentpb.Transaction{Id: "txn-" + in.OrderId},
+	}, nil
+}
+
+func (f *fakePaymentClient) Refund(ctx context.Context, in *paymentpb.RefundRequest, opts ...grpc.CallOption) (*paymentpb.RefundResponse, error) {
+	if f.refundErr != nil {
+		return nil, f.refundErr
+	}
+	f.refunds = append(f.refunds, in)
+	return &paymentpb.RefundResponse{Success: true}, nil
+}
+
+type fakeShippingClient struct {
+	shippingpb.ShippingServiceClient
+	createErr error
+	trackErr  error
+	quoted    []*shippingpb.GetQuoteRequest
+	shipments []*shippingpb.CreateShipmentRequest
+	cancelled []string
+}
+
+func (f *fakeShippingClient) CreateShipment(ctx context.Context, in *shippingpb.CreateShipmentRequest, opts ...grpc.CallOption) (*shippingpb.Shipment, error) {
+	if f.createErr != nil {
+		return nil, f.createErr
+	}
+	f.shipments = append(f.shipments, in)
+	return &shippingpb.Shipment{OrderId: in.OrderId, TrackingNumber: "TRACK-" + in.OrderId}, nil
+}
+
+func (f *fakeShippingClient) CancelShipment(ctx context.Context, in *shippingpb.CancelShipmentRequest, opts ...grpc.CallOption) (*commonpb.Empty, error) {
+	f.cancelled = append(f.cancelled, in.OrderId)
+	return &commonpb.Empty{}, nil
+}
+
+func (f *fakeShippingClient) TrackShipment(ctx context.Context, in *shippingpb.TrackShipmentRequest, opts ...grpc.CallOption) (*shippingpb.TrackShipmentResponse, error) {
+	if f.trackErr != nil {
+		return nil, f.trackErr
+	}
+	return &shippingpb.TrackShipmentResponse{
+		Shipment: &shippingpb.Shipment{TrackingNumber: in.TrackingNumber, Status: shippingpb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT},
+	}, nil
+}
+
+func (f *fakeShippingClient) GetQuote(ctx context.Context, in *shippingpb.GetQuoteRequest, opts ...grpc.CallOption) (*shippingpb.GetQuoteResponse, error) {
+	f.quoted = append(f.quoted, in)
+	return &shippingpb.GetQuoteResponse{
+		Quotes: []*shippingpb.ShippingQuote{
+			{Carrier: "FedEx", Service: "2-Day", Cost: &commonpb.Money{AmountCents: 1800, Currency: "USD"}},
+			{Carrier: "USPS", Service: "Priority Mail", Cost: &commonpb.Money{AmountCents: 650, Currency: "USD"}},
+		},
+	}, nil
+}
+
+type fakeNotificationClient struct {
+	notificationpb.NotificationServiceClient
+}
+
+func (f *fakeNotificationClient) SendOrderConfirmation(ctx context.Context, in *notificationpb.SendOrderConfirmationRequest, opts ...grpc.CallOption) (*commonpb.Empty, error) {
+	return &commonpb.Empty{}, nil
+}
+
+type checkoutFixture struct {
+	store    *fakeOrderStore
+	catalog  *fakeCatalogClient
+	cart     *fakeCartClient
+	payment  *fakePaymentClient
+	shipping *fakeShippingClient
+	taxRates *fakeTaxRateStore
+	svc      *OrderService
+}
+
+func newCheckoutFixture() *checkoutFixture {
+	f := &checkoutFixture{
+		store: newFakeOrderStore(),
+		catalog: &fakeCatalogClient{
+			weights: map[string]int32{"prod-1": 300},
+			prices:  map[string]int64{"prod-1": 1500},
+		},
+		cart: &fakeCartClient{
+			cart: &cartpb.Cart{
+				UserId: "user-1",
+				Items: []*cartpb.CartItem{
+					{
+						ProductId:   "prod-1",
+						ProductName: "Widget",
+						Quantity:    2,
+						UnitPrice:   &commonpb.Money{AmountCents: 1500, Currency: "USD"},
+						TotalPrice:  &commonpb.Money{AmountCents: 3000, Currency: "USD"},
+					},
+				},
+				Total: &commonpb.Money{AmountCents: 3000, Currency: "USD"},
+			},
+		},
+		payment:  &fakePaymentClient{},
+		shipping: &fakeShippingClient{},
+		taxRates: &fakeTaxRateStore{},
+	}
+
+	f.svc = NewOrderService(f.store, &client.ServiceClients{
+		Catalog:      f.catalog,
+		Cart:         f.cart,
+		Payment:      f.payment,
+		Shipping:     f.shipping,
+		Notification: &fakeNotificationClient{},
+	}, NewTableTaxEngine(f.taxRates))
+
+	return f
+}
+
+func (f *checkoutFixture) createOrder() (*repository.Order, error) {
+	return f.createOrderWithKey("")
+}
+
+func (f *checkoutFixture) createOrderWithKey(idempotencyKey string) (*repository.Order, error) {
+	order, _, err := f.svc.CreateOrder(context.Background(), "user-1", &commonpb.Address{
+		Street:  "1 Main St",
+		City:    "San Francisco",
+		State:   "CA",
+		ZipCode: "94105",
+		Country: "USA",
+	}, "pm-1", ShippingOption{}, idempotencyKey)
+	return order, err
+}
+
+func (f *checkoutFixture) onlySaga(t *testing.T) *repository.CheckoutSaga {
+	t.Helper()
+	if len(f.store.sagas) != 1 {
+		t.Fatalf("expected exactly one saga, got %d", len(f.store.sagas))
+	}
+	for _, saga := range f.store.sagas {
+		return saga
+	}
+	return nil
+}
+
+func TestCreateOrderCompletesCheckoutSaga(t *testing.T) {
+	f := newCheckoutFixture()
+
+	order, err := f.createOrder()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	saga := f.onlySaga(t)
+	if saga.State != repository.SagaStateCompleted {
+		t.Fatalf("expected saga to be completed, got %s", saga.State)
+	}
+	if order.ID != saga.ID {
+		t.Fatalf("expected order ID %s to match saga ID %s", order.ID, saga.ID)
+	}
+	if order.TotalCents != 3650 {
+		t.Fatalf("expected total 3650, got %d", order.TotalCents)
+	}
+	if len(f.payment.charges) != 1 || f.payment.charges[0].IdempotencyKey != "checkout-"+saga.ID {
+		t.Fatalf("unexpected charges: %+v", f.payment.charges)
+	}
+	if len(f.catalog.committed) != 1 || f.catalog.committed[0] != "res-"+saga.ID {
+		t.Fatalf("expected reservation to be committed, got %v", f.catalog.committed)
+	}
+	if len(f.shipping.shipments) != 1 || f.shipping.shipments[0].Carrier != "USPS" || f.shipping.shipments[0].Service != "Priority Mail" {
+		t.Fatalf("expected shipment with the quoted service, got %+v", f.shipping.shipments)
+	}
+	if order.TrackingNumber.String != "TRACK-"+saga.ID {
+		t.Fatalf("expected order to carry the tracking number, got %q", order.TrackingNumber.String)
+	}
+	if len(f.catalog.released) != 0 || len(f.payment.refunds) != 0 || len(f.cart.restored) != 0 || len(f.shipping.cancelled) != 0 {
+		t.Fatalf("expected no compensation on success")
+	}
+}
+
+func TestCreateOrderReservesVariantInCart(t *testing.T) {
+	f := newCheckoutFixture()
+	f.catalog.variants = map[string][]*catalogpb.ProductVariant{"prod-1": {{
+		Id:       "var-l",
+		Sku:      "WIDGET-L",
+		Price:    &commonpb.Money{AmountCents: 1500, Currency: "USD"},
+		IsActive: true,
+	}}}
+	f.cart.cart.Items[0].VariantId = "var-l"
+	f.cart.cart.Items[0].Sku = "WIDGET-L"
+
+	if _, err := f.createOrder(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(f.catalog.reservedItems) != 1 || f.catalog.reservedItems[0].VariantId != "var-l" {
+		t.Fatalf("expected the variant to be reserved, got %+v", f.catalog.reservedItems)
+	}
+	if item := f.onlySaga(t).Items[0]; item.VariantID != "var-l" || item.SKU != "WIDGET-L" {
+		t.Fatalf("expected the saga to record the variant, got %+v", item)
+	}
+}
+
+func TestCreateOrderCompensatesEachFailurePoint(t *testing.T) {
+	tests := []struct {
+		name          string
+		setup         func(f *checkoutFixture)
+		wantReleased  bool
+		wantRefunded  bool
+		wantRestored  bool
+		wantCancelled bool
+	}{
+		{
+			name:  "reserve inventory fails",
+			setup: func(f *checkoutFixture) { f.catalog.reserveErr = errors.New("out of stock") },
+		},
+		{
+			name:         "charge fails",
+			setup:        func(f *checkoutFixture) { f.payment.chargeErr = errors.New("card declined") },
+			wantReleased: true,
+		},
+		{
+			name:         "clear cart fails",
+			setup:        func(f *checkoutFixture) { f.cart.clearErr = errors.New("cart unavailable") },
+			wantReleased: true,
+			wantRefunded: true,
+		},
+		{
+			name:         "create shipment fails",
+			setup:        func(f *checkoutFixture) { f.shipping.createErr = errors.New("carrier unavailable") },
+			wantReleased: true,
+			wantRefunded: true,
+			wantRestored: true,
+		},
+		{
+			name:          "order persistence fails",
+			setup:         func(f *checkoutFixture) { f.store.completeErr = errors.New("db down") },
+			wantReleased:  true,
+			wantRefunded:  true,
+			wantRestored:  true,
+			wantCancelled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newCheckoutFixture()
+			tt.setup(f)
+
+			if _, err := f.createOrder(); err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+
+			saga := f.onlySaga(t)
+			if saga.State != repository.SagaStateCompensated {
+				t.Fatalf("expected saga to be compensated, got %s", saga.State)
+			}
+			if !saga.LastError.Valid {
+				t.Fatalf("expected saga to record the failure")
+			}
+			if got := len(f.catalog.released) == 1; got != tt.wantReleased {
+				t.Fatalf("reservation released = %v, want %v", got, tt.wantReleased)
+			}
+			if got := len(f.payment.refunds) == 1; got != tt.wantRefunded {
+				t.Fatalf("payment refunded = %v, want %v", got, tt.wantRefunded)
+			}
+			if got := len(f.cart.restored) == 1; got != tt.wantRestored {
+				t.Fatalf("cart restored = %v, want %v", got, tt.wantRestored)
+			}
+			if got := len(f.shipping.cancelled) == 1; got != tt.wantCancelled {
+				t.Fatalf("shipment cancelled = %v, want %v", got, tt.wantCancelled)
+			}
+			if tt.wantRefunded && f.payment.refunds[0].Amount.AmountCents != 3650 {
+				t.Fatalf("expected full refund, got %d", f.payment.refunds[0].Amount.AmountCents)
+			}
+			if len(f.store.orders) != 0 {
+				t.Fatalf("expected no order to be created")
+			}
+		})
+	}
+}
+
+func TestResumeCheckoutSagasContinuesFromRecordedStep(t *testing.T) {
+	f := newCheckoutFixture()
+	f.store.completeErr = errors.New("db down")
+	f.payment.refundErr = errors.New("payment unavailable")
+
+	// The first attempt fails to persist the order and cannot refund, so the
+	// saga is left compensating with the refund and reservation outstanding.
+	if _, err := f.createOrder(); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	saga := f.onlySaga(t)
+	if saga.State != repository.SagaStateCompensating || !saga.CartRestored || saga.PaymentRefunded {
+		t.Fatalf("unexpected saga after failed compensation: %+v", saga)
+	}
+
+	f.payment.refundErr = nil
+	if err := f.svc.ResumeCheckoutSagas(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	saga = f.onlySaga(t)
+	if saga.State != repository.SagaStateCompensated {
+		t.Fatalf("expected saga to be compensated, got %s", saga.State)
+	}
+	if len(f.cart.restored) != 1 {
+		t.Fatalf("expected cart to be restored once, got %d", len(f.cart.restored))
+	}
+	if len(f.payment.refunds) != 1 || len(f.catalog.released) != 1 {
+		t.Fatalf("expected one refund and one release, got %d and %d", len(f.payment.refunds), len(f.catalog.released))
+	}
+}
+
+func TestResumeCheckoutSagasCompletesChargedCheckout(t *testing.T) {
+	f := newCheckoutFixture()
+	f.store.sagas["saga-9"] = &repository.CheckoutSaga{
+		ID:              "saga-9",
+		UserID:          "user-1",
+		State:           repository.SagaStatePaymentCharged,
+		Items:           []repository.SagaItem{{ProductID: "prod-1", ProductName: "Widget", Quantity: 1, UnitPriceCents: 1500, Currency: "USD"}},
+		Currency:        "USD",
+		SubtotalCents:   1500,
+		TotalCents:      2150,
+		PaymentMethodID: "pm-1",
+	}
+
+	if err := f.svc.ResumeCheckoutSagas(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if f.store.sagas["saga-9"].State != repository.SagaStateCompleted {
+		t.Fatalf("expected saga to be completed, got %s", f.store.sagas["saga-9"].State)
+	}
+	if f.cart.cleared != 1 {
+		t.Fatalf("expected cart to be cleared once, got %d", f.cart.cleared)
+	}
+	if len(f.payment.charges) != 0 || len(f.catalog.reserved) != 0 {
+		t.Fatalf("expected completed steps not to be repeated")
+	}
+	if _, ok := f.store.orders["saga-9"]; !ok {
+		t.Fatalf("expected order to be created with the saga ID")
+	}
+}
+
+func TestResumeCheckoutSagasSkipsClaimedSaga(t *testing.T) {
+	f := newCheckoutFixture()
+	f.store.sagas["saga-9"] = &repository.CheckoutSaga{
+		ID:              "saga-9",
+		UserID:          "user-1",
+		State:           repository.SagaStatePaymentCharged,
+		Items:           []repository.SagaItem{{ProductID: "prod-1", ProductName: "Widget", Quantity: 1, UnitPriceCents: 1500, Currency: "USD"}},
+		Currency:        "USD",
+		PaymentMethodID: "pm-1",
+		ClaimedBy:       sqlString("other-replica"),
+		ClaimedUntil:    sql.NullTime{Time: time.Now().Add(time.Minute), Valid: true},
+	}
+
+	if err := f.svc.ResumeCheckoutSagas(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if f.store.sagas["saga-9"].State != repository.SagaStatePaymentCharged {
+		t.Fatalf("expected saga claimed by another replica to be left alone, got %s", f.store.sagas["saga-9"].State)
+	}
+	if f.cart.cleared != 0 {
+		t.Fatalf("expected cart not to be cleared, got %d", f.cart.cleared)
+	}
+}
+
+func TestCreateOrderStopsWhenRecoveryClaimsSaga(t *testing.T) {
+	f := newCheckoutFixture()
+	// Recovery claims the saga while the request is still charging, as it
+	// would for a request that ran past sagaStaleAfter
+	f.payment.onCharge = func() {
+		if _, err := f.store.ClaimStaleCheckoutSagas("recovery", sagaStaleAfter, sagaLease, sagaRecoveryBatch); err != nil {
+			t.Fatalf("failed to claim saga: %v", err)
+		}
+	}
+
+	_, err := f.createOrder()
+	if !errors.Is(err, ErrCheckoutInProgress) {
+		t.Fatalf("expected ErrCheckoutInProgress, got %v", err)
+	}
+
+	saga := f.onlySaga(t)
+	if saga.State != repository.SagaStateInventoryReserved || saga.ClaimedBy.String != "recovery" {
+		t.Fatalf("expected saga to be left to recovery, got %+v", saga)
+	}
+	if len(f.payment.refunds) != 0 || len(f.catalog.released) != 0 {
+		t.Fatalf("expected the losing request not to compensate, got %d refunds and %d releases", len(f.payment.refunds), len(f.catalog.released))
+	}
+}
+
+func sqlString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: true}
+}
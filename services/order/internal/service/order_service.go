@@ -3,33 +3,101 @@ package service
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	commonpb "github.com/safar/microservices-demo/proto/common/v1"
-	catalogpb "github.com/safar/microservices-demo/proto/catalog/v1"
 	cartpb "github.com/safar/microservices-demo/proto/cart/v1"
-	notificationpb "github.com/safar/microservices-demo/proto/notification/v1"
 	paymentpb "github.com/safar/microservices-demo/proto/payment/v1"
 	shippingpb "github.com/safar/microservices-demo/proto/shipping/v1"
 	"github.com/safar/microservices-demo/services/order/internal/client"
 	"github.com/safar/microservices-demo/services/order/internal/repository"
+	"github.com/safar/microservices-demo/shared/pagination"
+)
+
+// OrderStore is the persistence the order service depends on.
+type OrderStore interface {
+	GetOrder(orderID, userID string) (*repository.Order, []repository.OrderItem, []repository.OrderStatusHistory, error)
+	GetOrderByID(orderID string) (*repository.Order, []repository.OrderItem, []repository.OrderStatusHistory, error)
+	ListOrders(userID string, page pagination.Page, statusFilter string) ([]*repository.Order, pagination.Result, error)
+	UpdateOrderStatus(orderID string, fromStatuses []string, status, notes, changedBy string) error
+	CreateCheckoutSaga(saga *repository.CheckoutSaga) (*repository.CheckoutSaga, error)
+	GetCheckoutSagaByIdempotencyKey(userID, key string) (*repository.CheckoutSaga, error)
+	UpdateCheckoutSaga(saga *repository.CheckoutSaga) error
+	ClaimStaleCheckoutSagas(owner string, staleAfter, lease time.Duration, limit int) ([]*repository.CheckoutSaga, error)
+	CompleteCheckoutSaga(saga *repository.CheckoutSaga, order *repository.Order, items []repository.OrderItem) (*repository.Order, error)
+	GetPromotionByCode(code string) (*repository.Promotion, error)
+	CountPromotionRedemptions(promotionID, userID string) (int, int, error)
+	FindProductPurchase(userID, productID string, statuses []string) (string, error)
+}
+
+var (
+	// ErrCheckoutInProgress is returned when a checkout with the same
+	// idempotency key is still running.
+	ErrCheckoutInProgress = errors.New("a checkout with this idempotency key is already in progress")
+	// ErrCheckoutRolledBack is returned when a checkout failed and every
+	// completed step was undone. It is wrapped with the checkout's ID and
+	// the reason it failed.
+	ErrCheckoutRolledBack = errors.New("checkout was rolled back")
+	// ErrIdempotencyKeyReused is returned when an idempotency key is replayed
+	// with a different shipping address or payment method.
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used for a different checkout")
+	// ErrInvalidStatusTransition is returned when the order status state
+	// machine does not allow moving an order to the requested status.
+	ErrInvalidStatusTransition = errors.New("invalid order status transition")
+	// ErrProductUnavailable is returned when checking out a cart with a
+	// product that is no longer sold.
+	ErrProductUnavailable = errors.New("product is not available")
+	// ErrCartPriceChanged is returned when a cart's price for a product no
+	// longer matches the catalog, or changed since the product was added and
+	// the customer has not accepted the new price.
+	ErrCartPriceChanged = errors.New("cart price no longer matches the catalog")
 )
 
 type OrderService struct {
-	repo    *repository.OrderRepository
-	clients *client.ServiceClients
+	repo     OrderStore
+	clients  *client.ServiceClients
+	tax      TaxEngine
+	workerID string
 }
 
-func NewOrderService(repo *repository.OrderRepository, clients *client.ServiceClients) *OrderService {
+func NewOrderService(repo OrderStore, clients *client.ServiceClients, tax TaxEngine) *OrderService {
 	return &OrderService{
-		repo:    repo,
-		clients: clients,
+		repo:     repo,
+		clients:  clients,
+		tax:      tax,
+		workerID: sagaWorkerID(),
 	}
 }
 
-// CreateOrder orchestrates the entire checkout flow
-func (s *OrderService) CreateOrder(ctx context.Context, userID string, shippingAddress *commonpb.Address, paymentMethodID string) (*repository.Order, []repository.OrderItem, error) {
-	// Step 1: Get cart from Cart Service
+// CreateOrder orchestrates the checkout flow as a persisted saga: inventory
+// is reserved, payment charged and the cart cleared before the order is
+// written, and any of those steps is compensated if a later one fails. The
+// order confirmation is sent by subscribers of the OrderCreated event.
+//
+// The order ships with shippingOption, or the cheapest quote if none was
+// chosen. Cart prices are checked against the catalog, so the customer is
+// charged the price they were shown only while it is still current. A
+// coupon applied to the cart is priced with the order and redeemed in the
+// same transaction that creates it. When idempotencyKey is set, retries with
+// the same key return the order from the first attempt instead of checking
+// out again.
+func (s *OrderService) CreateOrder(ctx context.Context, userID string, shippingAddress *commonpb.Address, paymentMethodID string, shippingOption ShippingOption, idempotencyKey string) (*repository.Order, []repository.OrderItem, error) {
+	// Step 1: Replay an earlier checkout with the same idempotency key
+	if idempotencyKey != "" {
+		saga, err := s.repo.GetCheckoutSagaByIdempotencyKey(userID, idempotencyKey)
+		if err == nil {
+			return s.replayCheckout(ctx, saga, shippingAddress, paymentMethodID, shippingOption)
+		}
+		if !errors.Is(err, repository.ErrCheckoutSagaNotFound) {
+			return nil, nil, fmt.Errorf("failed to look up idempotency key: %w", err)
+		}
+	}
+
+	// Step 2: Get cart from Cart Service
 	cart, err := s.clients.Cart.GetCart(ctx, &cartpb.GetCartRequest{
 		UserId: userID,
 	})
@@ -38,156 +106,63 @@ func (s *OrderService) CreateOrder(ctx context.Context, userID string, shippingA
 	}
 
 	if len(cart.Items) == 0 {
-		return nil, nil, fmt.Errorf("cart is empty")
-	}
-
-	// Step 2: Validate products exist and check inventory
-	var inventoryItems []*catalogpb.InventoryItem
-	for _, item := range cart.Items {
-		inventoryItems = append(inventoryItems, &catalogpb.InventoryItem{
-			ProductId: item.ProductId,
-			Quantity:  item.Quantity,
-		})
+		return nil, nil, ErrEmptyCart
 	}
 
-	inventoryCheck, err := s.clients.Catalog.CheckInventory(ctx, &catalogpb.CheckInventoryRequest{
-		Items: inventoryItems,
-	})
+	products, err := s.lookupProducts(ctx, cart)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to check inventory: %w", err)
+		return nil, nil, err
 	}
 
-	if !inventoryCheck.Available {
-		return nil, nil, fmt.Errorf("insufficient inventory for products: %v", inventoryCheck.UnavailableProductIds)
+	if err := checkCartPrices(cart, products); err != nil {
+		return nil, nil, err
 	}
 
-	// Step 3: Reserve inventory
-	reserveResp, err := s.clients.Catalog.ReserveInventory(ctx, &catalogpb.ReserveInventoryRequest{
-		OrderId:           "", // Will be filled after order creation
-		Items:             inventoryItems,
-		ExpirationMinutes: 15,
-	})
-	if err != nil || !reserveResp.Success {
-		return nil, nil, fmt.Errorf("failed to reserve inventory: %w", err)
+	// Step 3: Record the saga with a snapshot of the cart
+	saga := newCheckoutSaga(userID, shippingAddress, paymentMethodID, shippingOption, cart, products)
+	saga.IdempotencyKey = sql.NullString{String: idempotencyKey, Valid: idempotencyKey != ""}
+	saga, err = s.repo.CreateCheckoutSaga(saga)
+	if errors.Is(err, repository.ErrDuplicateIdempotencyKey) {
+		// A concurrent request with the same key won the race
+		return nil, nil, ErrCheckoutInProgress
 	}
-
-	// Step 4: Calculate shipping
-	shippingQuote, err := s.clients.Shipping.GetQuote(ctx, &shippingpb.GetQuoteRequest{
-		To:          shippingAddress,
-		WeightGrams: 1000, // Mock weight
-	})
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get shipping quote: %w", err)
+		return nil, nil, fmt.Errorf("failed to start checkout: %w", err)
 	}
 
-	var shippingCost int64
-	if len(shippingQuote.Quotes) > 0 {
-		shippingCost = shippingQuote.Quotes[0].Cost.AmountCents
+	// Step 4: Reserve inventory, charge payment, clear cart and create the order
+	order, items, err := s.runCheckoutSaga(ctx, saga)
+	if errors.Is(err, repository.ErrCheckoutSagaConflict) {
+		// Recovery took over a checkout that ran past sagaStaleAfter
+		return nil, nil, ErrCheckoutInProgress
 	}
+	return order, items, err
+}
 
-	// Step 5: Calculate totals
-	subtotal := cart.Total.AmountCents
-	tax := int64(0) // Mock tax calculation
-	total := subtotal + shippingCost + tax
-
-	// Step 6: Process payment
-	chargeResp, err := s.clients.Payment.Charge(ctx, &paymentpb.ChargeRequest{
-		OrderId:         "",  // Will be filled after order creation
-		UserId:          userID,
-		PaymentMethodId: paymentMethodID,
-		Amount: &commonpb.Money{
-			AmountCents: total,
-			Currency:    cart.Total.Currency,
-		},
-		IdempotencyKey: fmt.Sprintf("order-%s-%d", userID, subtotal),
-	})
-	if err != nil || !chargeResp.Success {
-		return nil, nil, fmt.Errorf("payment failed: %v", chargeResp.ErrorMessage)
-	}
-
-	// Step 7: Create order record
-	order := &repository.Order{
-		UserID:          userID,
-		Status:          "confirmed",
-		SubtotalCents:   subtotal,
-		ShippingCents:   shippingCost,
-		TaxCents:        tax,
-		TotalCents:      total,
-		Currency:        cart.Total.Currency,
-		ShippingStreet:  shippingAddress.Street,
-		ShippingCity:    shippingAddress.City,
-		ShippingState:   shippingAddress.State,
-		ShippingZip:     shippingAddress.ZipCode,
-		ShippingCountry: shippingAddress.Country,
-		PaymentMethodID: sql.NullString{String: paymentMethodID, Valid: true},
-		TransactionID:   sql.NullString{String: chargeResp.Transaction.Id, Valid: true},
-	}
-
-	var orderItems []repository.OrderItem
-	for _, item := range cart.Items {
-		orderItems = append(orderItems, repository.OrderItem{
-			ProductID:       item.ProductId,
-			ProductName:     item.ProductName,
-			Quantity:        item.Quantity,
-			UnitPriceCents:  item.UnitPrice.AmountCents,
-			TotalPriceCents: item.TotalPrice.AmountCents,
-		})
+// replayCheckout answers a retried CreateOrder with the outcome of the
+// checkout that first used the idempotency key.
+func (s *OrderService) replayCheckout(ctx context.Context, saga *repository.CheckoutSaga, shippingAddress *commonpb.Address, paymentMethodID string, shippingOption ShippingOption) (*repository.Order, []repository.OrderItem, error) {
+	if saga.PaymentMethodID != paymentMethodID || !sameShippingAddress(saga, shippingAddress) {
+		return nil, nil, ErrIdempotencyKeyReused
 	}
-
-	createdOrder, err := s.repo.CreateOrder(order, orderItems)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create order: %w", err)
+	// A checkout without a chosen option records the quote it picked, so
+	// only an explicitly different choice counts as reuse
+	if shippingOption.Carrier != "" && (saga.ShippingCarrier.String != shippingOption.Carrier || saga.ShippingService.String != shippingOption.Service) {
+		return nil, nil, ErrIdempotencyKeyReused
 	}
 
-	// Step 8: Clear cart
-	_, err = s.clients.Cart.ClearCart(ctx, &cartpb.ClearCartRequest{
-		UserId: userID,
-	})
-	if err != nil {
-		// Log error but don't fail order
-		fmt.Printf("Warning: failed to clear cart: %v\n", err)
-	}
-
-	// Step 9: Send confirmation email (async - don't wait)
-	go func() {
-		var notifItems []*notificationpb.OrderItem
-		for _, item := range orderItems {
-			notifItems = append(notifItems, &notificationpb.OrderItem{
-				ProductName: item.ProductName,
-				Quantity:    item.Quantity,
-				UnitPrice: &commonpb.Money{
-					AmountCents: item.UnitPriceCents,
-					Currency:    createdOrder.Currency,
-				},
-				TotalPrice: &commonpb.Money{
-					AmountCents: item.TotalPriceCents,
-					Currency:    createdOrder.Currency,
-				},
-			})
+	switch saga.State {
+	case repository.SagaStateCompleted:
+		order, items, _, err := s.repo.GetOrder(saga.ID, saga.UserID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get order: %w", err)
 		}
-
-		s.clients.Notification.SendOrderConfirmation(context.Background(), &notificationpb.SendOrderConfirmationRequest{
-			Email:     "user@example.com", // Would come from user service
-			FirstName: "User",
-			OrderId:   createdOrder.ID,
-			Items:     notifItems,
-			Subtotal: &commonpb.Money{
-				AmountCents: createdOrder.SubtotalCents,
-				Currency:    createdOrder.Currency,
-			},
-			Shipping: &commonpb.Money{
-				AmountCents: createdOrder.ShippingCents,
-				Currency:    createdOrder.Currency,
-			},
-			Total: &commonpb.Money{
-				AmountCents: createdOrder.TotalCents,
-				Currency:    createdOrder.Currency,
-			},
-			ShippingAddress: shippingAddress,
-		})
-	}()
-
-	return createdOrder, orderItems, nil
+		return order, items, nil
+	case repository.SagaStateCompensated:
+		return nil, nil, checkoutRolledBack(saga)
+	default:
+		return nil, nil, ErrCheckoutInProgress
+	}
 }
 
 func (s *OrderService) GetOrder(ctx context.Context, orderID, userID string) (*repository.Order, []repository.OrderItem, []repository.OrderStatusHistory, error) {
@@ -199,43 +174,163 @@ func (s *OrderService) GetOrder(ctx context.Context, orderID, userID string) (*r
 	return order, items, history, nil
 }
 
-func (s *OrderService) ListOrders(ctx context.Context, userID string, page, pageSize int, statusFilter string) ([]*repository.Order, int, error) {
-	offset := (page - 1) * pageSize
-	orders, total, err := s.repo.ListOrders(userID, pageSize, offset, statusFilter)
+// GetOrderByID returns an order whichever user placed it, for admins.
+func (s *OrderService) GetOrderByID(ctx context.Context, orderID string) (*repository.Order, []repository.OrderItem, []repository.OrderStatusHistory, error) {
+	order, items, history, err := s.repo.GetOrderByID(orderID)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to list orders: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to get order: %w", err)
+	}
+
+	return order, items, history, nil
+}
+
+func (s *OrderService) ListOrders(ctx context.Context, userID string, page pagination.Page, statusFilter string) ([]*repository.Order, pagination.Result, error) {
+	orders, result, err := s.repo.ListOrders(userID, page, statusFilter)
+	if err != nil {
+		return nil, pagination.Result{}, fmt.Errorf("failed to list orders: %w", err)
 	}
 
-	return orders, total, nil
+	return orders, result, nil
 }
 
-func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID, status, notes string) error {
-	if err := s.repo.UpdateOrderStatus(orderID, status, notes); err != nil {
+// HasPurchasedProduct reports whether userID has a paid order for
+// productID that was not cancelled or refunded, returning the latest one.
+func (s *OrderService) HasPurchasedProduct(ctx context.Context, userID, productID string) (bool, string, error) {
+	orderID, err := s.repo.FindProductPurchase(userID, productID, purchasedOrderStatuses)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to check purchase: %w", err)
+	}
+
+	return orderID != "", orderID, nil
+}
+
+// UpdateOrderStatus moves an order to status if the order's current status
+// allows it, recording changedBy in the status history. Cancelling an
+// order and refunding it return its payment like CancelOrder does.
+func (s *OrderService) UpdateOrderStatus(ctx context.Context, orderID, status, notes, changedBy string) error {
+	if status == repository.OrderStatusCancelled || status == repository.OrderStatusRefunded {
+		order, _, _, err := s.repo.GetOrderByID(orderID)
+		if err != nil {
+			return fmt.Errorf("failed to get order: %w", err)
+		}
+		if status == repository.OrderStatusCancelled {
+			return s.cancelOrder(ctx, order, notes, changedBy)
+		}
+		if err := s.refundOrder(ctx, order, notes, changedBy); err != nil {
+			return fmt.Errorf("failed to update order status: %w", err)
+		}
+		return nil
+	}
+
+	if err := s.transitionOrder(orderID, status, notes, changedBy); err != nil {
 		return fmt.Errorf("failed to update order status: %w", err)
 	}
 
 	return nil
 }
 
+func (s *OrderService) transitionOrder(orderID, status, notes, changedBy string) error {
+	err := s.repo.UpdateOrderStatus(orderID, orderStatusPredecessors(status), status, notes, changedBy)
+	if errors.Is(err, repository.ErrOrderStatusMismatch) {
+		return fmt.Errorf("%w to %s: %v", ErrInvalidStatusTransition, status, err)
+	}
+	return err
+}
+
+// ApplyShipmentStatus moves an order forward to match its shipment's status.
+// The order steps through each intermediate status so its history stays
+// complete; statuses it has already passed are skipped, so redelivered or
+// out-of-order shipment updates are harmless.
+func (s *OrderService) ApplyShipmentStatus(ctx context.Context, orderID, shipmentStatus, description string) error {
+	target, ok := shipmentOrderStatuses[shipmentStatus]
+	if !ok {
+		return nil
+	}
+
+	notes := "Shipment " + strings.ReplaceAll(shipmentStatus, "_", " ")
+	if description != "" {
+		notes += ": " + description
+	}
+
+	for _, status := range fulfillmentPath {
+		err := s.transitionOrder(orderID, status, notes, shippingChangedBy)
+		if errors.Is(err, repository.ErrOrderNotFound) {
+			// Shipments of rolled-back checkouts have no order
+			log.Printf("Ignoring shipment update for unknown order %s", orderID)
+			return nil
+		}
+		if err != nil && !errors.Is(err, ErrInvalidStatusTransition) {
+			return fmt.Errorf("failed to update order status: %w", err)
+		}
+		if status == target {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// TrackShipment returns the live shipment status of an order, or nil if the
+// order has no shipment.
+func (s *OrderService) TrackShipment(ctx context.Context, order *repository.Order) (*shippingpb.TrackShipmentResponse, error) {
+	if !order.TrackingNumber.Valid {
+		return nil, nil
+	}
+
+	tracking, err := s.clients.Shipping.TrackShipment(ctx, &shippingpb.TrackShipmentRequest{
+		TrackingNumber: order.TrackingNumber.String,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to track shipment: %w", err)
+	}
+
+	return tracking, nil
+}
+
+// CancelOrder cancels a customer's order that has not shipped. See
+// cancelOrder for how its payment and stock are returned.
 func (s *OrderService) CancelOrder(ctx context.Context, orderID, userID, reason string) error {
-	// Get order to check status
 	order, _, _, err := s.repo.GetOrder(orderID, userID)
 	if err != nil {
 		return fmt.Errorf("failed to get order: %w", err)
 	}
 
-	if order.Status == "shipped" || order.Status == "delivered" {
-		return fmt.Errorf("cannot cancel order that has been shipped")
+	return s.cancelOrder(ctx, order, reason, userID)
+}
+
+// cancelOrder cancels an order that has not shipped and refunds its payment,
+// moving it on to refunded. The catalog service returns the order's stock
+// when it receives the OrderCancelled event. If the refund fails the order
+// stays cancelled and the error is returned; cancelling it again retries
+// the refund.
+func (s *OrderService) cancelOrder(ctx context.Context, order *repository.Order, reason, changedBy string) error {
+	retryingRefund := order.Status == repository.OrderStatusCancelled && order.TransactionID.Valid
+	if !retryingRefund {
+		// Orders that have shipped can't be cancelled
+		if err := s.transitionOrder(order.ID, repository.OrderStatusCancelled, reason, changedBy); err != nil {
+			return fmt.Errorf("failed to cancel order: %w", err)
+		}
+		order.Status = repository.OrderStatusCancelled
+	}
+
+	if !order.TransactionID.Valid {
+		return nil
 	}
+	if err := s.refundOrder(ctx, order, reason, changedBy); err != nil {
+		return fmt.Errorf("order cancelled but not refunded: %w", err)
+	}
+	return nil
+}
 
-	// Update status to cancelled
-	if err := s.repo.UpdateOrderStatus(orderID, "cancelled", reason); err != nil {
-		return fmt.Errorf("failed to cancel order: %w", err)
+// refundOrder refunds an order's payment, if it was paid, and moves it to
+// refunded. The order is left as it was if the refund fails.
+func (s *OrderService) refundOrder(ctx context.Context, order *repository.Order, reason, changedBy string) error {
+	if !CanTransitionOrderStatus(order.Status, repository.OrderStatusRefunded) {
+		return fmt.Errorf("%w to %s: order is %s", ErrInvalidStatusTransition, repository.OrderStatusRefunded, order.Status)
 	}
 
-	// Trigger refund if payment was processed
 	if order.TransactionID.Valid {
-		_, err := s.clients.Payment.Refund(ctx, &paymentpb.RefundRequest{
+		refundResp, err := s.clients.Payment.Refund(ctx, &paymentpb.RefundRequest{
 			TransactionId: order.TransactionID.String,
 			Amount: &commonpb.Money{
 				AmountCents: order.TotalCents,
@@ -244,10 +339,16 @@ func (s *OrderService) CancelOrder(ctx context.Context, orderID, userID, reason
 			Reason: reason,
 		})
 		if err != nil {
-			// Log error but don't fail cancellation
-			fmt.Printf("Warning: failed to process refund: %v\n", err)
+			return fmt.Errorf("failed to refund payment: %w", err)
+		}
+		if !refundResp.Success {
+			return fmt.Errorf("failed to refund payment: %s", refundResp.ErrorMessage)
 		}
 	}
 
+	if err := s.transitionOrder(order.ID, repository.OrderStatusRefunded, reason, changedBy); err != nil {
+		return fmt.Errorf("payment refunded but order not updated: %w", err)
+	}
+	order.Status = repository.OrderStatusRefunded
 	return nil
 }
@@ -0,0 +1,452 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	catalogpb "github.com/safar/microservices-demo/proto/catalog/v1"
+	commonpb "github.com/safar/microservices-demo/proto/common/v1"
+	"github.com/safar/microservices-demo/services/order/internal/repository"
+)
+
+func TestCreateOrderReplaysCompletedCheckout(t *testing.T) {
+	f := newCheckoutFixture()
+
+	first, err := f.createOrderWithKey("key-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	replayed, err := f.createOrderWithKey("key-1")
+	if err != nil {
+		t.Fatalf("expected no error on replay, got %v", err)
+	}
+
+	if replayed.ID != first.ID {
+		t.Fatalf("expected replay to return order %s, got %s", first.ID, replayed.ID)
+	}
+	if len(f.store.sagas) != 1 {
+		t.Fatalf("expected a single checkout, got %d", len(f.store.sagas))
+	}
+	if len(f.payment.charges) != 1 {
+		t.Fatalf("expected a single charge, got %d", len(f.payment.charges))
+	}
+}
+
+func TestCreateOrderWithDifferentKeysCreatesSeparateOrders(t *testing.T) {
+	f := newCheckoutFixture()
+
+	first, err := f.createOrderWithKey("key-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	second, err := f.createOrderWithKey("key-2")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if first.ID == second.ID {
+		t.Fatalf("expected separate orders, got %s twice", first.ID)
+	}
+	if len(f.payment.charges) != 2 || f.payment.charges[0].IdempotencyKey == f.payment.charges[1].IdempotencyKey {
+		t.Fatalf("expected two charges with distinct payment keys, got %+v", f.payment.charges)
+	}
+}
+
+func TestCreateOrderRejectsKeyStillInFlight(t *testing.T) {
+	f := newCheckoutFixture()
+	f.store.sagas["saga-9"] = &repository.CheckoutSaga{
+		ID:              "saga-9",
+		UserID:          "user-1",
+		IdempotencyKey:  sqlString("key-1"),
+		State:           repository.SagaStatePaymentCharged,
+		ShippingStreet:  "1 Main St",
+		ShippingCity:    "San Francisco",
+		ShippingState:   "CA",
+		ShippingZip:     "94105",
+		ShippingCountry: "USA",
+		PaymentMethodID: "pm-1",
+	}
+
+	_, err := f.createOrderWithKey("key-1")
+	if !errors.Is(err, ErrCheckoutInProgress) {
+		t.Fatalf("expected ErrCheckoutInProgress, got %v", err)
+	}
+	if len(f.payment.charges) != 0 {
+		t.Fatalf("expected no charge while the first checkout is in flight")
+	}
+}
+
+func TestCreateOrderRejectsKeyReusedForDifferentRequest(t *testing.T) {
+	f := newCheckoutFixture()
+
+	if _, err := f.createOrderWithKey("key-1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	_, _, err := f.svc.CreateOrder(context.Background(), "user-1", &commonpb.Address{
+		Street:  "1 Main St",
+		City:    "San Francisco",
+		State:   "CA",
+		ZipCode: "94105",
+		Country: "USA",
+	}, "pm-2", ShippingOption{}, "key-1")
+	if !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Fatalf("expected ErrIdempotencyKeyReused, got %v", err)
+	}
+}
+
+func TestCreateOrderReplaysRolledBackCheckout(t *testing.T) {
+	f := newCheckoutFixture()
+	f.payment.chargeErr = errors.New("card declined")
+
+	if _, err := f.createOrderWithKey("key-1"); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+
+	f.payment.chargeErr = nil
+	_, err := f.createOrderWithKey("key-1")
+	if !errors.Is(err, ErrCheckoutRolledBack) {
+		t.Fatalf("expected ErrCheckoutRolledBack, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "card declined") {
+		t.Fatalf("expected the rollback reason in %q", err.Error())
+	}
+	if len(f.catalog.reserved) != 1 {
+		t.Fatalf("expected the checkout not to run again, got %d reservations", len(f.catalog.reserved))
+	}
+}
+
+func TestCreateOrderRequiresAcceptingCartPriceChange(t *testing.T) {
+	f := newCheckoutFixture()
+
+	// The price rose after the item was added; the cart reprices it from
+	// the catalog and flags the change
+	f.catalog.prices["prod-1"] = 1800
+	item := f.cart.cart.Items[0]
+	item.AddedUnitPrice = &commonpb.Money{AmountCents: 1500, Currency: "USD"}
+	item.UnitPrice = &commonpb.Money{AmountCents: 1800, Currency: "USD"}
+	item.TotalPrice = &commonpb.Money{AmountCents: 3600, Currency: "USD"}
+	item.PriceChanged = true
+	f.cart.cart.Total = &commonpb.Money{AmountCents: 3600, Currency: "USD"}
+
+	_, err := f.createOrder()
+	if !errors.Is(err, ErrCartPriceChanged) {
+		t.Fatalf("expected ErrCartPriceChanged, got %v", err)
+	}
+	if len(f.store.sagas) != 0 || len(f.payment.charges) != 0 {
+		t.Fatalf("expected checkout not to start before the new price is accepted")
+	}
+
+	// Accepting the new price stores it as the price the item was added at
+	item.AddedUnitPrice = item.UnitPrice
+	item.PriceChanged = false
+
+	order, err := f.createOrder()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if order.SubtotalCents != 3600 {
+		t.Fatalf("expected subtotal at the accepted price, got %d", order.SubtotalCents)
+	}
+}
+
+func TestCreateOrderRejectsCartOutOfStepWithCatalog(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(f *checkoutFixture)
+		wantErr error
+	}{
+		{
+			name:    "price changed",
+			setup:   func(f *checkoutFixture) { f.catalog.prices["prod-1"] = 1800 },
+			wantErr: ErrCartPriceChanged,
+		},
+		{
+			name:    "product no longer sold",
+			setup:   func(f *checkoutFixture) { f.catalog.inactive = map[string]bool{"prod-1": true} },
+			wantErr: ErrProductUnavailable,
+		},
+		{
+			name: "variant price changed",
+			setup: func(f *checkoutFixture) {
+				f.catalog.variants = map[string][]*catalogpb.ProductVariant{"prod-1": {{
+					Id:       "var-l",
+					Price:    &commonpb.Money{AmountCents: 1700, Currency: "USD"},
+					IsActive: true,
+				}}}
+				f.cart.cart.Items[0].VariantId = "var-l"
+			},
+			wantErr: ErrCartPriceChanged,
+		},
+		{
+			name: "variant no longer sold",
+			setup: func(f *checkoutFixture) {
+				f.catalog.variants = map[string][]*catalogpb.ProductVariant{"prod-1": {{
+					Id:    "var-l",
+					Price: &commonpb.Money{AmountCents: 1500, Currency: "USD"},
+				}}}
+				f.cart.cart.Items[0].VariantId = "var-l"
+			},
+			wantErr: ErrProductUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newCheckoutFixture()
+			tt.setup(f)
+
+			if _, err := f.createOrder(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if len(f.store.sagas) != 0 || len(f.payment.charges) != 0 {
+				t.Fatalf("expected checkout not to start")
+			}
+		})
+	}
+}
+
+func TestUpdateOrderStatusEnforcesTransitions(t *testing.T) {
+	tests := []struct {
+		from    string
+		to      string
+		allowed bool
+	}{
+		{repository.OrderStatusPending, repository.OrderStatusConfirmed, true},
+		{repository.OrderStatusConfirmed, repository.OrderStatusProcessing, true},
+		{repository.OrderStatusProcessing, repository.OrderStatusShipped, true},
+		{repository.OrderStatusShipped, repository.OrderStatusDelivered, true},
+		{repository.OrderStatusDelivered, repository.OrderStatusRefunded, true},
+		{repository.OrderStatusConfirmed, repository.OrderStatusCancelled, true},
+		{repository.OrderStatusCancelled, repository.OrderStatusRefunded, true},
+		{repository.OrderStatusPending, repository.OrderStatusShipped, false},
+		{repository.OrderStatusShipped, repository.OrderStatusCancelled, false},
+		{repository.OrderStatusDelivered, repository.OrderStatusProcessing, false},
+		{repository.OrderStatusCancelled, repository.OrderStatusConfirmed, false},
+		{repository.OrderStatusRefunded, repository.OrderStatusDelivered, false},
+		{repository.OrderStatusConfirmed, repository.OrderStatusConfirmed, false},
+		{repository.OrderStatusConfirmed, "lost", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			f := newCheckoutFixture()
+			f.store.orders["order-1"] = &repository.Order{ID: "order-1", UserID: "user-1", Status: tt.from}
+
+			err := f.svc.UpdateOrderStatus(context.Background(), "order-1", tt.to, "", "admin-1")
+
+			if tt.allowed {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+				history := f.store.history["order-1"]
+				if len(history) != 1 || history[0].Status != tt.to || history[0].ChangedBy != "admin-1" {
+					t.Fatalf("expected transition by admin-1 to be recorded, got %+v", history)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrInvalidStatusTransition) {
+				t.Fatalf("expected ErrInvalidStatusTransition, got %v", err)
+			}
+			if f.store.orders["order-1"].Status != tt.from {
+				t.Fatalf("expected status to stay %s, got %s", tt.from, f.store.orders["order-1"].Status)
+			}
+		})
+	}
+}
+
+func TestCancelOrderRefundsAndRecordsCustomer(t *testing.T) {
+	f := newCheckoutFixture()
+	f.store.orders["order-1"] = &repository.Order{
+		ID:            "order-1",
+		UserID:        "user-1",
+		Status:        repository.OrderStatusConfirmed,
+		TotalCents:    3000,
+		Currency:      "USD",
+		TransactionID: sqlString("txn-1"),
+	}
+
+	if err := f.svc.CancelOrder(context.Background(), "order-1", "user-1", "changed my mind"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	history := f.store.history["order-1"]
+	if len(history) != 2 || history[0].Status != repository.OrderStatusCancelled || history[0].ChangedBy != "user-1" {
+		t.Fatalf("expected cancellation by user-1 to be recorded, got %+v", history)
+	}
+	if history[1].Status != repository.OrderStatusRefunded || f.store.orders["order-1"].Status != repository.OrderStatusRefunded {
+		t.Fatalf("expected the refunded order to move to refunded, got %+v", history)
+	}
+	if len(f.payment.refunds) != 1 || f.payment.refunds[0].TransactionId != "txn-1" || f.payment.refunds[0].Amount.AmountCents != 3000 {
+		t.Fatalf("expected 3000 of txn-1 to be refunded, got %+v", f.payment.refunds)
+	}
+}
+
+func TestCancelOrderRetriesFailedRefund(t *testing.T) {
+	f := newCheckoutFixture()
+	f.store.orders["order-1"] = &repository.Order{
+		ID:            "order-1",
+		UserID:        "user-1",
+		Status:        repository.OrderStatusConfirmed,
+		TotalCents:    3000,
+		Currency:      "USD",
+		TransactionID: sqlString("txn-1"),
+	}
+	f.payment.refundErr = errors.New("payment provider down")
+
+	if err := f.svc.CancelOrder(context.Background(), "order-1", "user-1", "changed my mind"); err == nil {
+		t.Fatalf("expected the failed refund to be reported")
+	}
+	if got := f.store.orders["order-1"].Status; got != repository.OrderStatusCancelled {
+		t.Fatalf("expected order to stay cancelled, got %s", got)
+	}
+
+	f.payment.refundErr = nil
+	if err := f.svc.CancelOrder(context.Background(), "order-1", "user-1", "changed my mind"); err != nil {
+		t.Fatalf("expected retry to succeed, got %v", err)
+	}
+	if got := f.store.orders["order-1"].Status; got != repository.OrderStatusRefunded || len(f.payment.refunds) != 1 {
+		t.Fatalf("expected one refund and a refunded order, got %s after %d refunds", got, len(f.payment.refunds))
+	}
+}
+
+func TestUpdateOrderStatusRefundsPayment(t *testing.T) {
+	tests := []struct {
+		from       string
+		wantRefund bool
+		wantErr    error
+		wantStatus string
+	}{
+		{from: repository.OrderStatusDelivered, wantRefund: true, wantStatus: repository.OrderStatusRefunded},
+		{from: repository.OrderStatusCancelled, wantRefund: true, wantStatus: repository.OrderStatusRefunded},
+		{from: repository.OrderStatusConfirmed, wantErr: ErrInvalidStatusTransition, wantStatus: repository.OrderStatusConfirmed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from, func(t *testing.T) {
+			f := newCheckoutFixture()
+			f.store.orders["order-1"] = &repository.Order{
+				ID:            "order-1",
+				UserID:        "user-1",
+				Status:        tt.from,
+				TotalCents:    3000,
+				Currency:      "USD",
+				TransactionID: sqlString("txn-1"),
+			}
+
+			err := f.svc.UpdateOrderStatus(context.Background(), "order-1", repository.OrderStatusRefunded, "returned", "admin-1")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if got := len(f.payment.refunds) == 1; got != tt.wantRefund {
+				t.Fatalf("payment refunded = %v, want %v", got, tt.wantRefund)
+			}
+			if got := f.store.orders["order-1"].Status; got != tt.wantStatus {
+				t.Fatalf("expected %s, got %s", tt.wantStatus, got)
+			}
+		})
+	}
+}
+
+func TestCancelOrderRejectsShippedOrder(t *testing.T) {
+	f := newCheckoutFixture()
+	f.store.orders["order-1"] = &repository.Order{
+		ID:            "order-1",
+		UserID:        "user-1",
+		Status:        repository.OrderStatusShipped,
+		TransactionID: sqlString("txn-1"),
+	}
+
+	err := f.svc.CancelOrder(context.Background(), "order-1", "user-1", "too late")
+	if !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Fatalf("expected ErrInvalidStatusTransition, got %v", err)
+	}
+	if len(f.payment.refunds) != 0 {
+		t.Fatalf("expected no refund for a shipped order")
+	}
+}
+
+func TestHasPurchasedProductIgnoresCancelledOrders(t *testing.T) {
+	f := newCheckoutFixture()
+
+	order, err := f.createOrder()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	purchased, orderID, err := f.svc.HasPurchasedProduct(context.Background(), "user-1", "prod-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !purchased || orderID != order.ID {
+		t.Fatalf("expected purchase in order %s, got %v %q", order.ID, purchased, orderID)
+	}
+
+	if err := f.svc.CancelOrder(context.Background(), order.ID, "user-1", "changed my mind"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	purchased, _, err = f.svc.HasPurchasedProduct(context.Background(), "user-1", "prod-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if purchased {
+		t.Fatalf("expected a cancelled order not to count as a purchase")
+	}
+}
+
+func TestApplyShipmentStatusStepsOrderThroughFulfillment(t *testing.T) {
+	f := newCheckoutFixture()
+	f.store.orders["order-1"] = &repository.Order{ID: "order-1", UserID: "user-1", Status: repository.OrderStatusConfirmed}
+	ctx := context.Background()
+
+	if err := f.svc.ApplyShipmentStatus(ctx, "order-1", "label_created", ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if f.store.orders["order-1"].Status != repository.OrderStatusConfirmed {
+		t.Fatalf("expected label creation not to change the order, got %s", f.store.orders["order-1"].Status)
+	}
+
+	if err := f.svc.ApplyShipmentStatus(ctx, "order-1", "in_transit", "Departed facility"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := f.svc.ApplyShipmentStatus(ctx, "order-1", "in_transit", "Arrived at facility"); err != nil {
+		t.Fatalf("expected redelivered update to be ignored, got %v", err)
+	}
+	if err := f.svc.ApplyShipmentStatus(ctx, "order-1", "delivered", ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	var statuses []string
+	for _, h := range f.store.history["order-1"] {
+		if h.ChangedBy != shippingChangedBy {
+			t.Fatalf("expected change by %s, got %s", shippingChangedBy, h.ChangedBy)
+		}
+		statuses = append(statuses, h.Status)
+	}
+	want := []string{repository.OrderStatusProcessing, repository.OrderStatusShipped, repository.OrderStatusDelivered}
+	if len(statuses) != len(want) {
+		t.Fatalf("expected history %v, got %v", want, statuses)
+	}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Fatalf("expected history %v, got %v", want, statuses)
+		}
+	}
+}
+
+func TestApplyShipmentStatusIgnoresCancelledOrder(t *testing.T) {
+	f := newCheckoutFixture()
+	f.store.orders["order-1"] = &repository.Order{ID: "order-1", UserID: "user-1", Status: repository.OrderStatusCancelled}
+
+	if err := f.svc.ApplyShipmentStatus(context.Background(), "order-1", "delivered", ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if f.store.orders["order-1"].Status != repository.OrderStatusCancelled {
+		t.Fatalf("expected cancelled order to stay cancelled, got %s", f.store.orders["order-1"].Status)
+	}
+}
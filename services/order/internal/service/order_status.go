@@ -0,0 +1,68 @@
+package service
+
+import "github.com/safar/microservices-demo/services/order/internal/repository"
+
+// shippingChangedBy is recorded as the author of status changes driven by
+// shipment updates.
+const shippingChangedBy = "shipping-service"
+
+// orderStatusTransitions lists the statuses each order status may move to.
+// Orders move forward from pending to delivered; they can be cancelled until
+// they ship, and refunded once cancelled or delivered.
+var orderStatusTransitions = map[string][]string{
+	repository.OrderStatusPending:    {repository.OrderStatusConfirmed, repository.OrderStatusCancelled},
+	repository.OrderStatusConfirmed:  {repository.OrderStatusProcessing, repository.OrderStatusCancelled},
+	repository.OrderStatusProcessing: {repository.OrderStatusShipped, repository.OrderStatusCancelled},
+	repository.OrderStatusShipped:    {repository.OrderStatusDelivered},
+	repository.OrderStatusDelivered:  {repository.OrderStatusRefunded},
+	repository.OrderStatusCancelled:  {repository.OrderStatusRefunded},
+}
+
+// CanTransitionOrderStatus reports whether an order in status from may move
+// to status to.
+func CanTransitionOrderStatus(from, to string) bool {
+	for _, next := range orderStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// orderStatusPredecessors returns the statuses an order may move to status
+// to from.
+func orderStatusPredecessors(to string) []string {
+	var from []string
+	for status := range orderStatusTransitions {
+		if CanTransitionOrderStatus(status, to) {
+			from = append(from, status)
+		}
+	}
+	return from
+}
+
+// fulfillmentPath is the order of statuses an order passes through once it
+// has been confirmed.
+var fulfillmentPath = []string{
+	repository.OrderStatusProcessing,
+	repository.OrderStatusShipped,
+	repository.OrderStatusDelivered,
+}
+
+// purchasedOrderStatuses are the statuses of orders that were paid for and
+// not cancelled or refunded.
+var purchasedOrderStatuses = []string{
+	repository.OrderStatusConfirmed,
+	repository.OrderStatusProcessing,
+	repository.OrderStatusShipped,
+	repository.OrderStatusDelivered,
+}
+
+// shipmentOrderStatuses maps the shipment statuses that affect an order to
+// the order status they imply.
+var shipmentOrderStatuses = map[string]string{
+	"picked_up":        repository.OrderStatusShipped,
+	"in_transit":       repository.OrderStatusShipped,
+	"out_for_delivery": repository.OrderStatusShipped,
+	"delivered":        repository.OrderStatusDelivered,
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/safar/microservices-demo/services/order/internal/repository"
+)
+
+var (
+	// ErrCouponNotFound is returned for a coupon code without a promotion.
+	ErrCouponNotFound = errors.New("coupon not found")
+	// ErrCouponNotApplicable is returned when a coupon exists but cannot be
+	// used for the order, for example because it expired or reached its
+	// usage limit.
+	ErrCouponNotApplicable = errors.New("coupon cannot be applied")
+)
+
+// PromotionLine is an order line a promotion is evaluated against.
+type PromotionLine struct {
+	ProductID      string
+	Quantity       int32
+	UnitPriceCents int64
+}
+
+// Discount is what a promotion takes off an order. Lines holds the discount
+// on each line, in the order the lines were given.
+type Discount struct {
+	Lines        []int64
+	ItemsCents   int64
+	FreeShipping bool
+}
+
+// EvaluateCoupon checks that userID may redeem code for lines and returns
+// the promotion with the discount it gives. Limits are checked again when
+// the order is created, so a coupon that evaluates cleanly can still be
+// rejected at checkout. An empty userID, for a guest cart, skips the
+// per-user limit until the guest signs in to check out.
+func (s *OrderService) EvaluateCoupon(ctx context.Context, userID, code string, lines []PromotionLine) (*repository.Promotion, *Discount, error) {
+	promotion, err := s.repo.GetPromotionByCode(code)
+	if errors.Is(err, repository.ErrPromotionNotFound) {
+		return nil, nil, ErrCouponNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get promotion: %w", err)
+	}
+
+	total, byUser, err := s.repo.CountPromotionRedemptions(promotion.ID, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count promotion redemptions: %w", err)
+	}
+
+	var subtotalCents int64
+	for _, line := range lines {
+		subtotalCents += line.UnitPriceCents * int64(line.Quantity)
+	}
+
+	if err := checkPromotion(promotion, time.Now(), subtotalCents, total, byUser); err != nil {
+		return nil, nil, err
+	}
+
+	return promotion, promotionDiscount(promotion, lines), nil
+}
+
+// checkPromotion reports why promotion cannot be used for an order with
+// subtotalCents, given how often it was redeemed in total and by the user.
+func checkPromotion(promotion *repository.Promotion, now time.Time, subtotalCents int64, total, byUser int) error {
+	if !promotion.IsValidAt(now) {
+		return fmt.Errorf("%w: coupon is not active", ErrCouponNotApplicable)
+	}
+	if promotion.UsageLimit > 0 && total >= int(promotion.UsageLimit) {
+		return fmt.Errorf("%w: coupon is no longer available", ErrCouponNotApplicable)
+	}
+	if promotion.PerUserLimit > 0 && byUser >= int(promotion.PerUserLimit) {
+		return fmt.Errorf("%w: coupon was already used", ErrCouponNotApplicable)
+	}
+	if subtotalCents < promotion.MinSubtotalCents {
+		return fmt.Errorf("%w: order subtotal is below the coupon minimum", ErrCouponNotApplicable)
+	}
+	return nil
+}
+
+// promotionDiscount applies a promotion's rule to lines. Fixed discounts are
+// spread over the lines in proportion to their amount so each line's tax
+// is charged on what the customer actually pays.
+func promotionDiscount(promotion *repository.Promotion, lines []PromotionLine) *Discount {
+	discount := &Discount{Lines: make([]int64, len(lines))}
+
+	switch promotion.Type {
+	case repository.PromotionTypePercentOff:
+		for i, line := range lines {
+			amount := line.UnitPriceCents * int64(line.Quantity)
+			discount.Lines[i] = (amount*int64(promotion.PercentOff) + 50) / 100
+		}
+	case repository.PromotionTypeFixedOff:
+		var subtotalCents int64
+		for _, line := range lines {
+			subtotalCents += line.UnitPriceCents * int64(line.Quantity)
+		}
+		remaining := promotion.AmountOffCents
+		if remaining > subtotalCents {
+			remaining = subtotalCents
+		}
+		allocated := int64(0)
+		for i, line := range lines {
+			if subtotalCents == 0 {
+				break
+			}
+			if i == len(lines)-1 {
+				discount.Lines[i] = remaining - allocated
+				break
+			}
+			amount := line.UnitPriceCents * int64(line.Quantity)
+			discount.Lines[i] = remaining * amount / subtotalCents
+			allocated += discount.Lines[i]
+		}
+	case repository.PromotionTypeFreeShipping:
+		discount.FreeShipping = true
+	case repository.PromotionTypeBuyXGetY:
+		group := promotion.BuyQuantity + promotion.GetQuantity
+		if promotion.GetQuantity <= 0 || group <= 0 {
+			break
+		}
+		for i, line := range lines {
+			if promotion.ProductID != "" && line.ProductID != promotion.ProductID {
+				continue
+			}
+			freeUnits := line.Quantity / group * promotion.GetQuantity
+			discount.Lines[i] = int64(freeUnits) * line.UnitPriceCents
+		}
+	}
+
+	for _, lineDiscount := range discount.Lines {
+		discount.ItemsCents += lineDiscount
+	}
+	return discount
+}
+
+// applyCoupon prices the saga's coupon, recording the discount on each item
+// and waiving shipping for free-shipping promotions.
+func (s *OrderService) applyCoupon(ctx context.Context, saga *repository.CheckoutSaga) error {
+	saga.DiscountCents = 0
+	if !saga.CouponCode.Valid {
+		return nil
+	}
+
+	lines := make([]PromotionLine, len(saga.Items))
+	for i, item := range saga.Items {
+		lines[i] = PromotionLine{
+			ProductID:      item.ProductID,
+			Quantity:       item.Quantity,
+			UnitPriceCents: item.UnitPriceCents,
+		}
+	}
+
+	_, discount, err := s.EvaluateCoupon(ctx, saga.UserID, saga.CouponCode.String, lines)
+	if err != nil {
+		return err
+	}
+
+	for i := range saga.Items {
+		saga.Items[i].DiscountCents = discount.Lines[i]
+	}
+	saga.DiscountCents = discount.ItemsCents
+	if discount.FreeShipping {
+		saga.DiscountCents += saga.ShippingCents
+	}
+	return nil
+}
+
+// couponRedemptionError reports a coupon the repository refused to redeem
+// as ErrCouponNotApplicable.
+func couponRedemptionError(err error) error {
+	if errors.Is(err, repository.ErrPromotionNotFound) ||
+		errors.Is(err, repository.ErrPromotionUnavailable) ||
+		errors.Is(err, repository.ErrPromotionExhausted) {
+		return fmt.Errorf("%w: %v", ErrCouponNotApplicable, err)
+	}
+	return err
+}
+
+func couponCode(code string) sql.NullString {
+	return sql.NullString{String: code, Valid: code != ""}
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/safar/microservices-demo/services/order/internal/repository"
+)
+
+func (f *fakeOrderStore) GetPromotionByCode(code string) (*repository.Promotion, error) {
+	promotion, ok := f.promotions[strings.ToUpper(code)]
+	if !ok {
+		return nil, repository.ErrPromotionNotFound
+	}
+	return promotion, nil
+}
+
+func (f *fakeOrderStore) CountPromotionRedemptions(promotionID, userID string) (int, int, error) {
+	byUser := 0
+	for _, redeemedBy := range f.redemptions[promotionID] {
+		if redeemedBy == userID {
+			byUser++
+		}
+	}
+	return len(f.redemptions[promotionID]), byUser, nil
+}
+
+func (f *fakeOrderStore) addPromotion(promotion *repository.Promotion) {
+	promotion.ID = "promo-" + promotion.Code
+	promotion.IsActive = true
+	f.promotions[strings.ToUpper(promotion.Code)] = promotion
+}
+
+func TestPromotionDiscount(t *testing.T) {
+	lines := []PromotionLine{
+		{ProductID: "prod-1", Quantity: 2, UnitPriceCents: 1500},
+		{ProductID: "prod-2", Quantity: 7, UnitPriceCents: 142},
+	}
+
+	tests := []struct {
+		name             string
+		promotion        *repository.Promotion
+		wantLines        []int64
+		wantFreeShipping bool
+	}{
+		{
+			name:      "percent off",
+			promotion: &repository.Promotion{Type: repository.PromotionTypePercentOff, PercentOff: 10},
+			wantLines: []int64{300, 99},
+		},
+		{
+			name:      "fixed off spread over lines",
+			promotion: &repository.Promotion{Type: repository.PromotionTypeFixedOff, AmountOffCents: 1000},
+			wantLines: []int64{751, 249},
+		},
+		{
+			name:      "fixed off capped at subtotal",
+			promotion: &repository.Promotion{Type: repository.PromotionTypeFixedOff, AmountOffCents: 10000},
+			wantLines: []int64{3000, 994},
+		},
+		{
+			name:             "free shipping",
+			promotion:        &repository.Promotion{Type: repository.PromotionTypeFreeShipping},
+			wantLines:        []int64{0, 0},
+			wantFreeShipping: true,
+		},
+		{
+			name:      "buy two get one",
+			promotion: &repository.Promotion{Type: repository.PromotionTypeBuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+			wantLines: []int64{0, 284},
+		},
+		{
+			name:      "buy one get one on a single product",
+			promotion: &repository.Promotion{Type: repository.PromotionTypeBuyXGetY, BuyQuantity: 1, GetQuantity: 1, ProductID: "prod-1"},
+			wantLines: []int64{1500, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discount := promotionDiscount(tt.promotion, lines)
+
+			var wantItems int64
+			for i, want := range tt.wantLines {
+				if discount.Lines[i] != want {
+					t.Fatalf("expected line %d discount %d, got %d", i, want, discount.Lines[i])
+				}
+				wantItems += want
+			}
+			if discount.ItemsCents != wantItems || discount.FreeShipping != tt.wantFreeShipping {
+				t.Fatalf("expected %d off with free shipping %v, got %d with %v", wantItems, tt.wantFreeShipping, discount.ItemsCents, discount.FreeShipping)
+			}
+		})
+	}
+}
+
+func TestCheckPromotion(t *testing.T) {
+	now := time.Now()
+	past := sql.NullTime{Time: now.Add(-time.Hour), Valid: true}
+	future := sql.NullTime{Time: now.Add(time.Hour), Valid: true}
+
+	tests := []struct {
+		name      string
+		promotion repository.Promotion
+		total     int
+		byUser    int
+		wantErr   bool
+	}{
+		{name: "within window", promotion: repository.Promotion{IsActive: true, StartsAt: past, EndsAt: future}},
+		{name: "inactive", promotion: repository.Promotion{IsActive: false}, wantErr: true},
+		{name: "not started", promotion: repository.Promotion{IsActive: true, StartsAt: future}, wantErr: true},
+		{name: "expired", promotion: repository.Promotion{IsActive: true, EndsAt: past}, wantErr: true},
+		{name: "under usage limit", promotion: repository.Promotion{IsActive: true, UsageLimit: 5}, total: 4},
+		{name: "usage limit reached", promotion: repository.Promotion{IsActive: true, UsageLimit: 5}, total: 5, wantErr: true},
+		{name: "per-user limit reached", promotion: repository.Promotion{IsActive: true, PerUserLimit: 1}, total: 3, byUser: 1, wantErr: true},
+		{name: "below minimum subtotal", promotion: repository.Promotion{IsActive: true, MinSubtotalCents: 5000}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPromotion(&tt.promotion, now, 3000, tt.total, tt.byUser)
+			if tt.wantErr && !errors.Is(err, ErrCouponNotApplicable) {
+				t.Fatalf("expected ErrCouponNotApplicable, got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCreateOrderRedeemsCartCoupon(t *testing.T) {
+	f := newCheckoutFixture()
+	f.store.addPromotion(&repository.Promotion{Code: "SAVE10", Type: repository.PromotionTypePercentOff, PercentOff: 10})
+	f.cart.cart.CouponCode = "save10"
+
+	order, items, err := f.svc.CreateOrder(context.Background(), "user-1", testShippingAddress, "pm-1", ShippingOption{}, "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if order.DiscountCents != 300 || order.TotalCents != 3000+650-300 {
+		t.Fatalf("expected 300 off a total of 3350, got discount %d total %d", order.DiscountCents, order.TotalCents)
+	}
+	if f.payment.charges[0].Amount.AmountCents != order.TotalCents {
+		t.Fatalf("expected charge of %d, got %d", order.TotalCents, f.payment.charges[0].Amount.AmountCents)
+	}
+	if items[0].DiscountCents != 300 {
+		t.Fatalf("expected line discount 300, got %d", items[0].DiscountCents)
+	}
+	if len(f.store.redemptions["promo-SAVE10"]) != 1 {
+		t.Fatalf("expected the coupon to be redeemed once, got %v", f.store.redemptions)
+	}
+}
+
+func TestCreateOrderTaxesDiscountedAmount(t *testing.T) {
+	f := newCheckoutFixture()
+	f.taxRates.rates = testTaxRates
+	f.store.addPromotion(&repository.Promotion{Code: "TENOFF", Type: repository.PromotionTypeFixedOff, AmountOffCents: 1000})
+	f.cart.cart.CouponCode = "TENOFF"
+
+	order, _, err := f.svc.CreateOrder(context.Background(), "user-1", testShippingAddress, "pm-1", ShippingOption{}, "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// 8.63% of the discounted 2000
+	if order.TaxCents != 173 || order.TotalCents != 2000+650+173 {
+		t.Fatalf("expected tax 173 on the discounted lines, got tax %d total %d", order.TaxCents, order.TotalCents)
+	}
+}
+
+func TestCreateOrderWaivesShippingForFreeShippingCoupon(t *testing.T) {
+	f := newCheckoutFixture()
+	f.store.addPromotion(&repository.Promotion{Code: "SHIPFREE", Type: repository.PromotionTypeFreeShipping})
+	f.cart.cart.CouponCode = "SHIPFREE"
+
+	order, _, err := f.svc.CreateOrder(context.Background(), "user-1", testShippingAddress, "pm-1", ShippingOption{}, "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if order.ShippingCents != 650 || order.DiscountCents != 650 || order.TotalCents != 3000 {
+		t.Fatalf("expected shipping to be waived, got shipping %d discount %d total %d", order.ShippingCents, order.DiscountCents, order.TotalCents)
+	}
+}
+
+func TestCreateOrderRejectsExpiredCoupon(t *testing.T) {
+	f := newCheckoutFixture()
+	f.store.addPromotion(&repository.Promotion{
+		Code:       "OLD",
+		Type:       repository.PromotionTypePercentOff,
+		PercentOff: 50,
+		EndsAt:     sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true},
+	})
+	f.cart.cart.CouponCode = "OLD"
+
+	_, err := f.createOrder()
+	if !errors.Is(err, ErrCouponNotApplicable) {
+		t.Fatalf("expected ErrCouponNotApplicable, got %v", err)
+	}
+	if len(f.payment.charges) != 0 {
+		t.Fatalf("expected no charge with an expired coupon")
+	}
+}
+
+func TestCreateOrderRollsBackWhenCouponRunsOutDuringCheckout(t *testing.T) {
+	f := newCheckoutFixture()
+	f.store.addPromotion(&repository.Promotion{Code: "LAST", Type: repository.PromotionTypePercentOff, PercentOff: 10, UsageLimit: 1})
+	f.cart.cart.CouponCode = "LAST"
+	// Another checkout redeems the last use while this one is being charged
+	f.payment.onCharge = func() {
+		f.store.redemptions["promo-LAST"] = append(f.store.redemptions["promo-LAST"], "user-2")
+	}
+
+	_, err := f.createOrder()
+	if !errors.Is(err, ErrCouponNotApplicable) {
+		t.Fatalf("expected ErrCouponNotApplicable, got %v", err)
+	}
+
+	if len(f.store.orders) != 0 {
+		t.Fatalf("expected no order to be created")
+	}
+	if len(f.store.redemptions["promo-LAST"]) != 1 {
+		t.Fatalf("expected the coupon to stay at its usage limit, got %v", f.store.redemptions["promo-LAST"])
+	}
+	if len(f.payment.refunds) != 1 {
+		t.Fatalf("expected the charge to be refunded")
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	cartpb "github.com/safar/microservices-demo/proto/cart/v1"
+	catalogpb "github.com/safar/microservices-demo/proto/catalog/v1"
+	commonpb "github.com/safar/microservices-demo/proto/common/v1"
+	shippingpb "github.com/safar/microservices-demo/proto/shipping/v1"
+	"github.com/safar/microservices-demo/services/order/internal/repository"
+)
+
+// defaultItemWeightGrams is used for products without a weight in the
+// catalog.
+const defaultItemWeightGrams = 500
+
+// warehouseAddress is where every shipment is sent from.
+var warehouseAddress = &commonpb.Address{
+	Street:  "100 Warehouse Way",
+	City:    "Oakland",
+	State:   "CA",
+	ZipCode: "94607",
+	Country: "USA",
+}
+
+var (
+	// ErrEmptyCart is returned when quoting or checking out an empty cart.
+	ErrEmptyCart = errors.New("cart is empty")
+	// ErrShippingOptionUnavailable is returned when the chosen carrier and
+	// service are not offered for the order.
+	ErrShippingOptionUnavailable = errors.New("shipping option is not available")
+)
+
+// ShippingOption is the carrier and service a customer picked from the
+// shipping quotes. The zero value lets checkout pick the cheapest quote.
+type ShippingOption struct {
+	Carrier string
+	Service string
+}
+
+// GetShippingQuotes quotes shipping the user's current cart to
+// shippingAddress and returns the quotes with the parcel weight.
+func (s *OrderService) GetShippingQuotes(ctx context.Context, userID string, shippingAddress *commonpb.Address) ([]*shippingpb.ShippingQuote, int32, error) {
+	cart, err := s.clients.Cart.GetCart(ctx, &cartpb.GetCartRequest{
+		UserId: userID,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get cart: %w", err)
+	}
+
+	if len(cart.Items) == 0 {
+		return nil, 0, ErrEmptyCart
+	}
+
+	products, err := s.lookupProducts(ctx, cart)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var weightGrams int32
+	for _, item := range cart.Items {
+		weightGrams += lineWeightGrams(products[item.ProductId].WeightGrams, item.Quantity)
+	}
+
+	resp, err := s.clients.Shipping.GetQuote(ctx, &shippingpb.GetQuoteRequest{
+		From:        warehouseAddress,
+		To:          shippingAddress,
+		WeightGrams: weightGrams,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get shipping quote: %w", err)
+	}
+
+	return resp.Quotes, weightGrams, nil
+}
+
+// lookupProducts fetches the catalog entry of each product in the cart for
+// its weight and category.
+func (s *OrderService) lookupProducts(ctx context.Context, cart *cartpb.Cart) (map[string]*catalogpb.Product, error) {
+	products := make(map[string]*catalogpb.Product, len(cart.Items))
+	for _, item := range cart.Items {
+		if _, ok := products[item.ProductId]; ok {
+			continue
+		}
+		product, err := s.clients.Catalog.GetProduct(ctx, &catalogpb.GetProductRequest{
+			Identifier: &catalogpb.GetProductRequest_Id{Id: item.ProductId},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get product %s: %w", item.ProductId, err)
+		}
+		products[item.ProductId] = product
+	}
+	return products, nil
+}
+
+// selectShippingQuote returns the quote matching option, or the cheapest
+// quote if no option was chosen.
+func selectShippingQuote(quotes []*shippingpb.ShippingQuote, option ShippingOption) (*shippingpb.ShippingQuote, error) {
+	if len(quotes) == 0 {
+		return nil, fmt.Errorf("no shipping quotes available")
+	}
+
+	if option.Carrier == "" && option.Service == "" {
+		cheapest := quotes[0]
+		for _, quote := range quotes[1:] {
+			if quote.Cost.AmountCents < cheapest.Cost.AmountCents {
+				cheapest = quote
+			}
+		}
+		return cheapest, nil
+	}
+
+	for _, quote := range quotes {
+		if quote.Carrier == option.Carrier && quote.Service == option.Service {
+			return quote, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrShippingOptionUnavailable, option.Carrier, option.Service)
+}
+
+func lineWeightGrams(weightGrams, quantity int32) int32 {
+	if weightGrams <= 0 {
+		weightGrams = defaultItemWeightGrams
+	}
+	return weightGrams * quantity
+}
+
+func sagaWeightGrams(saga *repository.CheckoutSaga) int32 {
+	var weightGrams int32
+	for _, item := range saga.Items {
+		weightGrams += lineWeightGrams(item.WeightGrams, item.Quantity)
+	}
+	return weightGrams
+}
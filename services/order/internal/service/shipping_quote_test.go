@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	commonpb "github.com/safar/microservices-demo/proto/common/v1"
+)
+
+var testShippingAddress = &commonpb.Address{
+	Street:  "1 Main St",
+	City:    "San Francisco",
+	State:   "CA",
+	ZipCode: "94105",
+	Country: "USA",
+}
+
+func TestGetShippingQuotesWeighsCartFromCatalog(t *testing.T) {
+	f := newCheckoutFixture()
+
+	quotes, weightGrams, err := f.svc.GetShippingQuotes(context.Background(), "user-1", testShippingAddress)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if weightGrams != 600 {
+		t.Fatalf("expected 2 x 300g = 600g, got %d", weightGrams)
+	}
+	if len(quotes) != 2 || f.shipping.quoted[0].WeightGrams != 600 {
+		t.Fatalf("expected quotes for a 600g parcel, got %d quotes for %dg", len(quotes), f.shipping.quoted[0].WeightGrams)
+	}
+}
+
+func TestGetShippingQuotesUsesDefaultWeightForUnweighedProducts(t *testing.T) {
+	f := newCheckoutFixture()
+	f.catalog.weights = nil
+
+	_, weightGrams, err := f.svc.GetShippingQuotes(context.Background(), "user-1", testShippingAddress)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if weightGrams != 2*defaultItemWeightGrams {
+		t.Fatalf("expected default weight %d, got %d", 2*defaultItemWeightGrams, weightGrams)
+	}
+}
+
+func TestCreateOrderDefaultsToCheapestShippingOption(t *testing.T) {
+	f := newCheckoutFixture()
+
+	order, err := f.createOrder()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if order.ShippingCents != 650 {
+		t.Fatalf("expected cheapest quote of 650, got %d", order.ShippingCents)
+	}
+	if f.shipping.quoted[0].WeightGrams != 600 {
+		t.Fatalf("expected checkout to quote a 600g parcel, got %d", f.shipping.quoted[0].WeightGrams)
+	}
+}
+
+func TestCreateOrderShipsWithChosenOption(t *testing.T) {
+	f := newCheckoutFixture()
+
+	order, _, err := f.svc.CreateOrder(context.Background(), "user-1", testShippingAddress, "pm-1",
+		ShippingOption{Carrier: "FedEx", Service: "2-Day"}, "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if order.ShippingCents != 1800 || order.TotalCents != 4800 {
+		t.Fatalf("expected FedEx 2-Day pricing, got shipping %d total %d", order.ShippingCents, order.TotalCents)
+	}
+	if len(f.shipping.shipments) != 1 || f.shipping.shipments[0].Carrier != "FedEx" || f.shipping.shipments[0].Service != "2-Day" {
+		t.Fatalf("expected shipment with FedEx 2-Day, got %+v", f.shipping.shipments)
+	}
+}
+
+func TestCreateOrderRejectsUnavailableShippingOption(t *testing.T) {
+	f := newCheckoutFixture()
+
+	_, _, err := f.svc.CreateOrder(context.Background(), "user-1", testShippingAddress, "pm-1",
+		ShippingOption{Carrier: "DHL", Service: "Express"}, "")
+	if !errors.Is(err, ErrShippingOptionUnavailable) {
+		t.Fatalf("expected ErrShippingOptionUnavailable, got %v", err)
+	}
+
+	if len(f.payment.charges) != 0 {
+		t.Fatalf("expected no charge for an unavailable option")
+	}
+	if len(f.catalog.released) != 1 {
+		t.Fatalf("expected the reservation to be released")
+	}
+}
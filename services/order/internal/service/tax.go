@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	commonpb "github.com/safar/microservices-demo/proto/common/v1"
+	"github.com/safar/microservices-demo/services/order/internal/repository"
+)
+
+// TaxEngine calculates the tax owed on an order's lines when they ship to
+// an address.
+type TaxEngine interface {
+	CalculateTax(ctx context.Context, address *commonpb.Address, lines []TaxableLine) (*TaxBreakdown, error)
+}
+
+// TaxableLine is an order line to be taxed.
+type TaxableLine struct {
+	CategoryID  string
+	AmountCents int64
+}
+
+// LineTax is the tax on a single order line.
+type LineTax struct {
+	TaxCents     int64
+	RateBps      int32
+	Jurisdiction string
+}
+
+// TaxBreakdown is the tax on each line, in the order the lines were given.
+// When Inclusive is set the line amounts already contain the tax, so it is
+// reported but not added to the order total.
+type TaxBreakdown struct {
+	Lines     []LineTax
+	TaxCents  int64
+	Inclusive bool
+}
+
+// TaxRateStore is where TableTaxEngine reads its rates from.
+type TaxRateStore interface {
+	ListTaxRates() ([]repository.TaxRate, error)
+}
+
+// TableTaxEngine applies the most specific configured rate for the shipping
+// address: a zip prefix match beats a state match, which beats a
+// country-wide rate. Lines in one of the rate's exempt categories are not
+// taxed, and addresses without a rate are not taxed at all.
+type TableTaxEngine struct {
+	rates TaxRateStore
+}
+
+func NewTableTaxEngine(rates TaxRateStore) *TableTaxEngine {
+	return &TableTaxEngine{
+		rates: rates,
+	}
+}
+
+func (e *TableTaxEngine) CalculateTax(ctx context.Context, address *commonpb.Address, lines []TaxableLine) (*TaxBreakdown, error) {
+	rates, err := e.rates.ListTaxRates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tax rates: %w", err)
+	}
+
+	breakdown := &TaxBreakdown{Lines: make([]LineTax, len(lines))}
+
+	rate := matchTaxRate(rates, address)
+	if rate == nil {
+		return breakdown, nil
+	}
+	breakdown.Inclusive = rate.Inclusive
+
+	for i, line := range lines {
+		breakdown.Lines[i].Jurisdiction = rate.Jurisdiction
+		if containsString(rate.ExemptCategories, line.CategoryID) {
+			continue
+		}
+		breakdown.Lines[i].RateBps = rate.RateBps
+		breakdown.Lines[i].TaxCents = lineTaxCents(line.AmountCents, rate.RateBps, rate.Inclusive)
+		breakdown.TaxCents += breakdown.Lines[i].TaxCents
+	}
+
+	return breakdown, nil
+}
+
+// matchTaxRate returns the most specific rate covering address, or nil.
+func matchTaxRate(rates []repository.TaxRate, address *commonpb.Address) *repository.TaxRate {
+	var best *repository.TaxRate
+	bestScore := -1
+	for i := range rates {
+		rate := &rates[i]
+		if !strings.EqualFold(rate.Country, address.Country) {
+			continue
+		}
+		if rate.State != "" && !strings.EqualFold(rate.State, address.State) {
+			continue
+		}
+		if rate.ZipPrefix != "" && !strings.HasPrefix(address.ZipCode, rate.ZipPrefix) {
+			continue
+		}
+
+		score := 0
+		if rate.State != "" {
+			score = 1
+		}
+		if rate.ZipPrefix != "" {
+			score = 1 + len(rate.ZipPrefix)
+		}
+		if score > bestScore {
+			best, bestScore = rate, score
+		}
+	}
+	return best
+}
+
+// lineTaxCents rounds the tax on amountCents to the nearest cent. For
+// inclusive pricing the tax is the part of amountCents above the net price.
+func lineTaxCents(amountCents int64, rateBps int32, inclusive bool) int64 {
+	bps := int64(rateBps)
+	if inclusive {
+		net := (amountCents*10000 + (10000+bps)/2) / (10000 + bps)
+		return amountCents - net
+	}
+	return (amountCents*bps + 5000) / 10000
+}
+
+// applyTax prices the tax on the saga's discounted items and records the
+// breakdown on each item.
+func (s *OrderService) applyTax(ctx context.Context, saga *repository.CheckoutSaga) error {
+	lines := make([]TaxableLine, len(saga.Items))
+	for i, item := range saga.Items {
+		lines[i] = TaxableLine{
+			CategoryID:  item.CategoryID,
+			AmountCents: item.UnitPriceCents*int64(item.Quantity) - item.DiscountCents,
+		}
+	}
+
+	breakdown, err := s.tax.CalculateTax(ctx, sagaShippingAddress(saga), lines)
+	if err != nil {
+		return fmt.Errorf("failed to calculate tax: %w", err)
+	}
+
+	for i := range saga.Items {
+		saga.Items[i].TaxCents = breakdown.Lines[i].TaxCents
+		saga.Items[i].TaxRateBps = breakdown.Lines[i].RateBps
+		saga.Items[i].TaxJurisdiction = breakdown.Lines[i].Jurisdiction
+	}
+	saga.TaxCents = breakdown.TaxCents
+	saga.TaxInclusive = breakdown.Inclusive
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
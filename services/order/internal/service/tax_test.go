@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	commonpb "github.com/safar/microservices-demo/proto/common/v1"
+	"github.com/safar/microservices-demo/services/order/internal/repository"
+)
+
+type fakeTaxRateStore struct {
+	rates []repository.TaxRate
+}
+
+func (f *fakeTaxRateStore) ListTaxRates() ([]repository.TaxRate, error) {
+	return f.rates, nil
+}
+
+var testTaxRates = []repository.TaxRate{
+	{Jurisdiction: "United States", Country: "USA", RateBps: 0},
+	{Jurisdiction: "California", Country: "USA", State: "CA", RateBps: 725, ExemptCategories: []string{"groceries"}},
+	{Jurisdiction: "San Francisco, CA", Country: "USA", State: "CA", ZipPrefix: "941", RateBps: 863},
+	{Jurisdiction: "Germany", Country: "DE", RateBps: 1900, Inclusive: true},
+}
+
+func TestTableTaxEngineCalculatesTax(t *testing.T) {
+	tests := []struct {
+		name          string
+		address       *commonpb.Address
+		lines         []TaxableLine
+		wantLines     []LineTax
+		wantTotal     int64
+		wantInclusive bool
+	}{
+		{
+			name:    "state rate",
+			address: &commonpb.Address{Country: "USA", State: "CA", ZipCode: "90001"},
+			lines:   []TaxableLine{{AmountCents: 3000}, {AmountCents: 999}},
+			wantLines: []LineTax{
+				{TaxCents: 218, RateBps: 725, Jurisdiction: "California"},
+				{TaxCents: 72, RateBps: 725, Jurisdiction: "California"},
+			},
+			wantTotal: 290,
+		},
+		{
+			name:      "zip prefix beats state",
+			address:   &commonpb.Address{Country: "usa", State: "ca", ZipCode: "94105"},
+			lines:     []TaxableLine{{AmountCents: 3000}},
+			wantLines: []LineTax{{TaxCents: 259, RateBps: 863, Jurisdiction: "San Francisco, CA"}},
+			wantTotal: 259,
+		},
+		{
+			name:    "exempt category",
+			address: &commonpb.Address{Country: "USA", State: "CA", ZipCode: "90001"},
+			lines:   []TaxableLine{{CategoryID: "groceries", AmountCents: 3000}, {CategoryID: "toys", AmountCents: 1000}},
+			wantLines: []LineTax{
+				{Jurisdiction: "California"},
+				{TaxCents: 73, RateBps: 725, Jurisdiction: "California"},
+			},
+			wantTotal: 73,
+		},
+		{
+			name:          "inclusive pricing",
+			address:       &commonpb.Address{Country: "DE", ZipCode: "10115"},
+			lines:         []TaxableLine{{AmountCents: 1190}},
+			wantLines:     []LineTax{{TaxCents: 190, RateBps: 1900, Jurisdiction: "Germany"}},
+			wantTotal:     190,
+			wantInclusive: true,
+		},
+		{
+			name:      "no matching rate",
+			address:   &commonpb.Address{Country: "CA", State: "ON", ZipCode: "M5V"},
+			lines:     []TaxableLine{{AmountCents: 3000}},
+			wantLines: []LineTax{{}},
+		},
+	}
+
+	engine := NewTableTaxEngine(&fakeTaxRateStore{rates: testTaxRates})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breakdown, err := engine.CalculateTax(context.Background(), tt.address, tt.lines)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+
+			if breakdown.TaxCents != tt.wantTotal || breakdown.Inclusive != tt.wantInclusive {
+				t.Fatalf("expected tax %d inclusive %v, got %d inclusive %v", tt.wantTotal, tt.wantInclusive, breakdown.TaxCents, breakdown.Inclusive)
+			}
+			for i, want := range tt.wantLines {
+				if breakdown.Lines[i] != want {
+					t.Fatalf("expected line %d to be %+v, got %+v", i, want, breakdown.Lines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCreateOrderAddsTaxToTotal(t *testing.T) {
+	f := newCheckoutFixture()
+	f.taxRates.rates = testTaxRates
+
+	order, items, err := f.svc.CreateOrder(context.Background(), "user-1", testShippingAddress, "pm-1", ShippingOption{}, "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if order.TaxCents != 259 || order.TotalCents != 3000+650+259 || order.TaxInclusive {
+		t.Fatalf("expected exclusive tax 259 added to total, got tax %d total %d", order.TaxCents, order.TotalCents)
+	}
+	if f.payment.charges[0].Amount.AmountCents != order.TotalCents {
+		t.Fatalf("expected charge of %d, got %d", order.TotalCents, f.payment.charges[0].Amount.AmountCents)
+	}
+	if items[0].TaxCents != 259 || items[0].TaxRateBps != 863 || items[0].TaxJurisdiction != "San Francisco, CA" {
+		t.Fatalf("expected line tax breakdown, got %+v", items[0])
+	}
+}
+
+func TestCreateOrderKeepsInclusiveTaxOutOfTotal(t *testing.T) {
+	f := newCheckoutFixture()
+	f.taxRates.rates = testTaxRates
+
+	order, items, err := f.svc.CreateOrder(context.Background(), "user-1", &commonpb.Address{
+		Street:  "Unter den Linden 1",
+		City:    "Berlin",
+		ZipCode: "10117",
+		Country: "DE",
+	}, "pm-1", ShippingOption{}, "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if order.TaxCents != 479 || order.TotalCents != 3650 || !order.TaxInclusive {
+		t.Fatalf("expected inclusive tax 479 within total 3650, got tax %d total %d", order.TaxCents, order.TotalCents)
+	}
+	if items[0].TaxCents != 479 {
+		t.Fatalf("expected line tax 479, got %d", items[0].TaxCents)
+	}
+}
+
+func TestCreateOrderSkipsTaxForExemptCategory(t *testing.T) {
+	f := newCheckoutFixture()
+	f.taxRates.rates = testTaxRates
+	f.catalog.categories = map[string]string{"prod-1": "groceries"}
+
+	order, _, err := f.svc.CreateOrder(context.Background(), "user-1", &commonpb.Address{
+		Street:  "1 Sunset Blvd",
+		City:    "Los Angeles",
+		State:   "CA",
+		ZipCode: "90028",
+		Country: "USA",
+	}, "pm-1", ShippingOption{}, "")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if order.TaxCents != 0 || order.TotalCents != 3650 {
+		t.Fatalf("expected no tax on exempt category, got tax %d total %d", order.TaxCents, order.TotalCents)
+	}
+}
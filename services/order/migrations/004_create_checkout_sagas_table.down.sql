@@ -0,0 +1,2 @@
+-- Drop checkout_sagas table
+DROP TABLE IF EXISTS checkout_sagas;
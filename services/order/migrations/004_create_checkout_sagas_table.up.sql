@@ -0,0 +1,31 @@
+-- Create checkout_sagas table
+CREATE TABLE IF NOT EXISTS checkout_sagas (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    state VARCHAR(50) DEFAULT 'started' NOT NULL,
+    items JSONB NOT NULL,
+    currency VARCHAR(3) DEFAULT 'USD' NOT NULL,
+    subtotal_cents BIGINT DEFAULT 0 NOT NULL,
+    shipping_cents BIGINT DEFAULT 0 NOT NULL,
+    tax_cents BIGINT DEFAULT 0 NOT NULL,
+    total_cents BIGINT DEFAULT 0 NOT NULL,
+    shipping_street VARCHAR(255),
+    shipping_city VARCHAR(100),
+    shipping_state VARCHAR(100),
+    shipping_zip VARCHAR(20),
+    shipping_country VARCHAR(100),
+    payment_method_id UUID NOT NULL,
+    reservation_id UUID,
+    reservation_released BOOLEAN DEFAULT false NOT NULL,
+    transaction_id UUID,
+    payment_refunded BOOLEAN DEFAULT false NOT NULL,
+    cart_cleared BOOLEAN DEFAULT false NOT NULL,
+    cart_restored BOOLEAN DEFAULT false NOT NULL,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
+
+-- Create indexes
+CREATE INDEX idx_checkout_sagas_state_updated_at ON checkout_sagas(state, updated_at);
+CREATE INDEX idx_checkout_sagas_user_id ON checkout_sagas(user_id);
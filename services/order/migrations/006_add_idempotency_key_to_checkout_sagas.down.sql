@@ -0,0 +1,3 @@
+-- Drop idempotency_key from checkout_sagas
+DROP INDEX IF EXISTS idx_checkout_sagas_user_idempotency_key;
+ALTER TABLE checkout_sagas DROP COLUMN IF EXISTS idempotency_key;
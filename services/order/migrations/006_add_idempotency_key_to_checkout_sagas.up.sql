@@ -0,0 +1,5 @@
+-- Add idempotency_key to checkout_sagas
+ALTER TABLE checkout_sagas ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(255);
+
+-- Create index
+CREATE UNIQUE INDEX idx_checkout_sagas_user_idempotency_key ON checkout_sagas(user_id, idempotency_key) WHERE idempotency_key IS NOT NULL;
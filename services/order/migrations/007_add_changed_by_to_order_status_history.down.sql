@@ -0,0 +1,2 @@
+-- Drop changed_by from order_status_history
+ALTER TABLE order_status_history DROP COLUMN IF EXISTS changed_by;
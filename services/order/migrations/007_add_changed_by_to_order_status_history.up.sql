@@ -0,0 +1,2 @@
+-- Add changed_by to order_status_history
+ALTER TABLE order_status_history ADD COLUMN IF NOT EXISTS changed_by VARCHAR(255);
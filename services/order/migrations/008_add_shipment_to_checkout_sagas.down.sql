@@ -0,0 +1,5 @@
+-- Drop shipment columns from checkout_sagas
+ALTER TABLE checkout_sagas DROP COLUMN IF EXISTS shipment_cancelled;
+ALTER TABLE checkout_sagas DROP COLUMN IF EXISTS tracking_number;
+ALTER TABLE checkout_sagas DROP COLUMN IF EXISTS shipping_service;
+ALTER TABLE checkout_sagas DROP COLUMN IF EXISTS shipping_carrier;
@@ -0,0 +1,5 @@
+-- Add shipment columns to checkout_sagas
+ALTER TABLE checkout_sagas ADD COLUMN IF NOT EXISTS shipping_carrier VARCHAR(100);
+ALTER TABLE checkout_sagas ADD COLUMN IF NOT EXISTS shipping_service VARCHAR(100);
+ALTER TABLE checkout_sagas ADD COLUMN IF NOT EXISTS tracking_number VARCHAR(255);
+ALTER TABLE checkout_sagas ADD COLUMN IF NOT EXISTS shipment_cancelled BOOLEAN DEFAULT false NOT NULL;
@@ -0,0 +1,2 @@
+-- Drop tax_rates table
+DROP TABLE IF EXISTS tax_rates;
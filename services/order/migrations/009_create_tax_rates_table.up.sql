@@ -0,0 +1,14 @@
+-- Create tax_rates table
+CREATE TABLE IF NOT EXISTS tax_rates (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    jurisdiction VARCHAR(255) NOT NULL,
+    country VARCHAR(100) NOT NULL,
+    state VARCHAR(100) DEFAULT '' NOT NULL,
+    zip_prefix VARCHAR(20) DEFAULT '' NOT NULL,
+    rate_bps INT NOT NULL CHECK (rate_bps >= 0),
+    inclusive BOOLEAN DEFAULT false NOT NULL,
+    exempt_categories TEXT[] DEFAULT '{}' NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    UNIQUE (country, state, zip_prefix)
+);
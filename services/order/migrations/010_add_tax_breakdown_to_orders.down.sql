@@ -0,0 +1,8 @@
+-- Drop tax-inclusive pricing flag from checkout_sagas and orders
+ALTER TABLE checkout_sagas DROP COLUMN IF EXISTS tax_inclusive;
+ALTER TABLE orders DROP COLUMN IF EXISTS tax_inclusive;
+
+-- Drop per-line tax breakdown from order_items
+ALTER TABLE order_items DROP COLUMN IF EXISTS tax_jurisdiction;
+ALTER TABLE order_items DROP COLUMN IF EXISTS tax_rate_bps;
+ALTER TABLE order_items DROP COLUMN IF EXISTS tax_cents;
@@ -0,0 +1,8 @@
+-- Add per-line tax breakdown to order_items
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS tax_cents BIGINT DEFAULT 0 NOT NULL;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS tax_rate_bps INT DEFAULT 0 NOT NULL;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS tax_jurisdiction VARCHAR(255) DEFAULT '' NOT NULL;
+
+-- Add tax-inclusive pricing flag to orders and checkout_sagas
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tax_inclusive BOOLEAN DEFAULT false NOT NULL;
+ALTER TABLE checkout_sagas ADD COLUMN IF NOT EXISTS tax_inclusive BOOLEAN DEFAULT false NOT NULL;
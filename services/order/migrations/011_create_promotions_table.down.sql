@@ -0,0 +1,2 @@
+-- Drop promotions table
+DROP TABLE IF EXISTS promotions;
@@ -0,0 +1,23 @@
+-- Create promotions table
+CREATE TABLE IF NOT EXISTS promotions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    code VARCHAR(100) NOT NULL,
+    description TEXT DEFAULT '' NOT NULL,
+    type VARCHAR(50) NOT NULL CHECK (type IN ('percent_off', 'fixed_off', 'free_shipping', 'buy_x_get_y')),
+    percent_off INT DEFAULT 0 NOT NULL CHECK (percent_off BETWEEN 0 AND 100),
+    amount_off_cents BIGINT DEFAULT 0 NOT NULL CHECK (amount_off_cents >= 0),
+    buy_quantity INT DEFAULT 0 NOT NULL CHECK (buy_quantity >= 0),
+    get_quantity INT DEFAULT 0 NOT NULL CHECK (get_quantity >= 0),
+    product_id VARCHAR(255) DEFAULT '' NOT NULL,
+    min_subtotal_cents BIGINT DEFAULT 0 NOT NULL,
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    usage_limit INT DEFAULT 0 NOT NULL,
+    per_user_limit INT DEFAULT 0 NOT NULL,
+    is_active BOOLEAN DEFAULT true NOT NULL,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP DEFAULT NOW() NOT NULL
+);
+
+-- Create index
+CREATE UNIQUE INDEX idx_promotions_code ON promotions(UPPER(code));
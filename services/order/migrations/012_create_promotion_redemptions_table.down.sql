@@ -0,0 +1,2 @@
+-- Drop promotion_redemptions table
+DROP TABLE IF EXISTS promotion_redemptions;
@@ -0,0 +1,8 @@
+-- Drop discount from checkout_sagas
+ALTER TABLE checkout_sagas DROP COLUMN IF EXISTS coupon_code;
+ALTER TABLE checkout_sagas DROP COLUMN IF EXISTS discount_cents;
+
+-- Drop discount from orders and order_items
+ALTER TABLE order_items DROP COLUMN IF EXISTS discount_cents;
+ALTER TABLE orders DROP COLUMN IF EXISTS coupon_code;
+ALTER TABLE orders DROP COLUMN IF EXISTS discount_cents;
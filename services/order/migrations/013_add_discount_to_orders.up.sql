@@ -0,0 +1,8 @@
+-- Add discount to orders and order_items
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS discount_cents BIGINT DEFAULT 0 NOT NULL;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS coupon_code VARCHAR(100);
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS discount_cents BIGINT DEFAULT 0 NOT NULL;
+
+-- Add discount to checkout_sagas
+ALTER TABLE checkout_sagas ADD COLUMN IF NOT EXISTS discount_cents BIGINT DEFAULT 0 NOT NULL;
+ALTER TABLE checkout_sagas ADD COLUMN IF NOT EXISTS coupon_code VARCHAR(100);
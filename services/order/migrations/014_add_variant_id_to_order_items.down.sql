@@ -0,0 +1,3 @@
+-- Drop the variant ordered from order_items
+ALTER TABLE order_items DROP COLUMN IF EXISTS sku;
+ALTER TABLE order_items DROP COLUMN IF EXISTS variant_id;
@@ -0,0 +1,3 @@
+-- Add the variant ordered to order_items
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS variant_id UUID;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS sku VARCHAR(64) DEFAULT '' NOT NULL;
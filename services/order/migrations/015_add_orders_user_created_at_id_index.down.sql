@@ -0,0 +1,2 @@
+-- Drop the keyset pagination index on orders
+DROP INDEX IF EXISTS idx_orders_user_created_at_id;
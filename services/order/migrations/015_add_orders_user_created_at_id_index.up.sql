@@ -0,0 +1,2 @@
+-- Index each user's orders in list order for keyset pagination
+CREATE INDEX IF NOT EXISTS idx_orders_user_created_at_id ON orders(user_id, created_at DESC, id DESC);
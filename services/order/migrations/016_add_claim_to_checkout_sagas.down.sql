@@ -0,0 +1,4 @@
+-- Drop claim and version columns from checkout_sagas
+ALTER TABLE checkout_sagas DROP COLUMN IF EXISTS claimed_until;
+ALTER TABLE checkout_sagas DROP COLUMN IF EXISTS claimed_by;
+ALTER TABLE checkout_sagas DROP COLUMN IF EXISTS version;
@@ -0,0 +1,6 @@
+-- Add claim and version columns to checkout_sagas. Recovery claims a saga
+-- for claimed_until before driving it, and every write bumps version so a
+-- worker holding an outdated copy of the saga cannot overwrite it.
+ALTER TABLE checkout_sagas ADD COLUMN IF NOT EXISTS version INT DEFAULT 0 NOT NULL;
+ALTER TABLE checkout_sagas ADD COLUMN IF NOT EXISTS claimed_by VARCHAR(255);
+ALTER TABLE checkout_sagas ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP;
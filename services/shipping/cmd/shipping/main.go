@@ -1,15 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"time"
 
 	pb "github.com/safar/microservices-demo/proto/shipping/v1"
 	"github.com/safar/microservices-demo/services/shipping/internal/config"
 	"github.com/safar/microservices-demo/services/shipping/internal/repository"
 	"github.com/safar/microservices-demo/services/shipping/internal/server"
 	"github.com/safar/microservices-demo/services/shipping/internal/service"
+	"github.com/safar/microservices-demo/shared/events"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
@@ -25,9 +28,27 @@ func main() {
 	}
 	defer repo.Close()
 
+	// Initialize event bus
+	bus, err := events.Open(cfg.EventBusDriver, cfg.EventBusURL)
+	if err != nil {
+		log.Fatalf("Failed to initialize event bus: %v", err)
+	}
+	defer bus.Close()
+
+	// Publish shipment events written to the outbox
+	go events.NewOutboxRelay(repo, bus).Run(context.Background(), time.Second)
+
 	// Initialize service
 	shippingService := service.NewShippingService(repo)
 
+	// Keep shipments in step with order events
+	eventHandler := server.NewEventHandler(shippingService)
+	go func() {
+		if err := bus.Subscribe(context.Background(), "shipping-service", server.OrderEventTypes, eventHandler.HandleOrderEvent); err != nil {
+			log.Printf("Order event subscription stopped: %v", err)
+		}
+	}()
+
 	// Initialize gRPC server
 	grpcServer := server.NewGRPCServer(shippingService)
 
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	eventsv1 "github.com/safar/microservices-demo/proto/events/v1"
+	"github.com/safar/microservices-demo/shared/events"
+)
+
+// insertOutboxEvent stores an event in the outbox as part of tx, so the
+// event is relayed if and only if the change that produced it commits.
+func insertOutboxEvent(tx *sql.Tx, event events.Event) error {
+	_, err := tx.Exec(`
+		INSERT INTO outbox (event_type, aggregate_id, payload, created_at)
+		VALUES ($1, $2, $3, $4)
+	`, event.Type, event.AggregateID, event.Payload, event.OccurredAt)
+	if err != nil {
+		return fmt.Errorf("failed to write %s event to outbox: %w", event.Type, err)
+	}
+	return nil
+}
+
+// ListUnpublishedOutboxEvents returns up to limit events that have not been
+// relayed yet, oldest first.
+func (r *ShippingRepository) ListUnpublishedOutboxEvents(limit int) ([]events.Event, error) {
+	query := `
+		SELECT id, event_type, aggregate_id, payload, created_at
+		FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY created_at ASC
+		LIMIT $1
+	`
+
+	rows, err := r.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []events.Event
+	for rows.Next() {
+		var event events.Event
+		if err := rows.Scan(&event.ID, &event.Type, &event.AggregateID, &event.Payload, &event.OccurredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		pending = append(pending, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate outbox events: %w", err)
+	}
+
+	return pending, nil
+}
+
+func (r *ShippingRepository) MarkOutboxEventPublished(eventID string) error {
+	if _, err := r.db.Exec(`UPDATE outbox SET published_at = NOW() WHERE id = $1`, eventID); err != nil {
+		return fmt.Errorf("failed to mark outbox event published: %w", err)
+	}
+	return nil
+}
+
+// RecordOutboxFailure counts a failed publish attempt for an event.
+func (r *ShippingRepository) RecordOutboxFailure(eventID string, publishErr error) error {
+	if _, err := r.db.Exec(`UPDATE outbox SET attempts = attempts + 1, last_error = $2 WHERE id = $1`,
+		eventID, publishErr.Error()); err != nil {
+		return fmt.Errorf("failed to record outbox failure: %w", err)
+	}
+	return nil
+}
+
+func shipmentStatusChangedEvent(shipment *Shipment, oldStatus string, trackingEvent *TrackingEvent, changedAt time.Time) (events.Event, error) {
+	return events.New(events.TypeShipmentStatusChanged, shipment.ID, &eventsv1.ShipmentStatusChanged{
+		ShipmentId:     shipment.ID,
+		OrderId:        shipment.OrderID,
+		TrackingNumber: shipment.TrackingNumber,
+		OldStatus:      oldStatus,
+		NewStatus:      shipment.Status,
+		Location:       trackingEvent.Location,
+		Description:    trackingEvent.Description,
+		ChangedAt:      changedAt.Format("2006-01-02T15:04:05Z"),
+	})
+}
@@ -2,12 +2,23 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	_ "github.com/lib/pq"
 )
 
+var ErrShipmentNotFound = errors.New("shipment not found")
+
+// ErrShipmentClosed is returned when updating a shipment that was already
+// delivered or cancelled.
+var ErrShipmentClosed = errors.New("shipment is already delivered or cancelled")
+
+// ErrShipmentStatusMismatch is returned when a shipment is not in one of the
+// statuses a status update expects.
+var ErrShipmentStatusMismatch = errors.New("shipment status does not allow this change")
+
 type ShippingRepository struct {
 	db *sql.DB
 }
@@ -112,7 +123,7 @@ func (r *ShippingRepository) GetShipmentByTracking(trackingNumber string) (*Ship
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("shipment not found")
+			return nil, ErrShipmentNotFound
 		}
 		return nil, fmt.Errorf("failed to get shipment: %w", err)
 	}
@@ -142,7 +153,7 @@ func (r *ShippingRepository) GetShipmentByID(shipmentID string) (*Shipment, erro
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("shipment not found")
+			return nil, ErrShipmentNotFound
 		}
 		return nil, fmt.Errorf("failed to get shipment: %w", err)
 	}
@@ -172,7 +183,7 @@ func (r *ShippingRepository) GetShipmentByOrderID(orderID string) (*Shipment, er
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("shipment not found")
+			return nil, ErrShipmentNotFound
 		}
 		return nil, fmt.Errorf("failed to get shipment: %w", err)
 	}
@@ -180,13 +191,81 @@ func (r *ShippingRepository) GetShipmentByOrderID(orderID string) (*Shipment, er
 	return shipment, nil
 }
 
-func (r *ShippingRepository) UpdateShipmentStatus(shipmentID, status string) error {
-	query := `UPDATE shipments SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`
-	_, err := r.db.Exec(query, status, shipmentID)
+// UpdateShipmentStatus moves a shipment to trackingEvent.Status, adds the
+// tracking event and writes a ShipmentStatusChanged event to the outbox in
+// one transaction, and returns the updated shipment. Delivered and cancelled
+// shipments are closed; when fromStatuses is set the shipment must also be
+// in one of them.
+func (r *ShippingRepository) UpdateShipmentStatus(shipmentID string, fromStatuses []string, trackingEvent *TrackingEvent) (*Shipment, error) {
+	tx, err := r.db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to update shipment status: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	return nil
+	defer tx.Rollback()
+
+	// Lock the shipment so the recorded previous status is accurate
+	shipment := &Shipment{}
+	err = tx.QueryRow(`
+		SELECT id, order_id, tracking_number, carrier, service, status,
+			   from_street, from_city, from_state, from_zip, from_country,
+			   to_street, to_city, to_state, to_zip, to_country,
+			   weight_grams, shipping_cost_cents, currency, estimated_days,
+			   created_at, updated_at
+		FROM shipments
+		WHERE id = $1
+		FOR UPDATE
+	`, shipmentID).Scan(
+		&shipment.ID, &shipment.OrderID, &shipment.TrackingNumber, &shipment.Carrier, &shipment.Service, &shipment.Status,
+		&shipment.FromStreet, &shipment.FromCity, &shipment.FromState, &shipment.FromZip, &shipment.FromCountry,
+		&shipment.ToStreet, &shipment.ToCity, &shipment.ToState, &shipment.ToZip, &shipment.ToCountry,
+		&shipment.WeightGrams, &shipment.ShippingCostCents, &shipment.Currency, &shipment.EstimatedDays,
+		&shipment.CreatedAt, &shipment.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrShipmentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get shipment: %w", err)
+	}
+	if shipment.Status == "delivered" || shipment.Status == "cancelled" {
+		return nil, ErrShipmentClosed
+	}
+	if len(fromStatuses) > 0 && !containsStatus(fromStatuses, shipment.Status) {
+		return nil, fmt.Errorf("%w: shipment is %s", ErrShipmentStatusMismatch, shipment.Status)
+	}
+	oldStatus := shipment.Status
+	shipment.Status = trackingEvent.Status
+
+	err = tx.QueryRow(`UPDATE shipments SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 RETURNING updated_at`,
+		shipment.Status, shipment.ID).Scan(&shipment.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update shipment status: %w", err)
+	}
+
+	trackingEvent.ShipmentID = shipment.ID
+	err = tx.QueryRow(`
+		INSERT INTO tracking_events (shipment_id, status, location, description)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, trackingEvent.ShipmentID, trackingEvent.Status, trackingEvent.Location, trackingEvent.Description).Scan(&trackingEvent.ID, &trackingEvent.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add tracking event: %w", err)
+	}
+
+	// Publish the change through the outbox
+	event, err := shipmentStatusChangedEvent(shipment, oldStatus, trackingEvent, trackingEvent.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertOutboxEvent(tx, event); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return shipment, nil
 }
 
 func (r *ShippingRepository) AddTrackingEvent(event *TrackingEvent) error {
@@ -237,3 +316,12 @@ func (r *ShippingRepository) GetTrackingEvents(shipmentID string) ([]TrackingEve
 
 	return events, nil
 }
+
+func containsStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
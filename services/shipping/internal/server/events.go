@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	eventsv1 "github.com/safar/microservices-demo/proto/events/v1"
+	"github.com/safar/microservices-demo/services/shipping/internal/service"
+	"github.com/safar/microservices-demo/shared/events"
+)
+
+// OrderEventTypes are the order events the shipping service reacts to.
+var OrderEventTypes = []string{events.TypeOrderCancelled}
+
+// EventHandler updates shipments in response to events published by other
+// services.
+type EventHandler struct {
+	shippingService *service.ShippingService
+}
+
+func NewEventHandler(shippingService *service.ShippingService) *EventHandler {
+	return &EventHandler{
+		shippingService: shippingService,
+	}
+}
+
+func (h *EventHandler) HandleOrderEvent(ctx context.Context, event events.Event) error {
+	switch event.Type {
+	case events.TypeOrderCancelled:
+		var cancelled eventsv1.OrderCancelled
+		if err := event.Decode(&cancelled); err != nil {
+			return err
+		}
+		if err := h.shippingService.CancelShipmentForOrder(ctx, cancelled.OrderId, cancelled.Reason); err != nil {
+			return fmt.Errorf("failed to cancel shipment: %w", err)
+		}
+		return nil
+	default:
+		return nil
+	}
+}
@@ -2,9 +2,11 @@ package server
 
 import (
 	"context"
+	"errors"
 
 	commonv1 "github.com/safar/microservices-demo/proto/common/v1"
 	pb "github.com/safar/microservices-demo/proto/shipping/v1"
+	"github.com/safar/microservices-demo/services/shipping/internal/repository"
 	"github.com/safar/microservices-demo/services/shipping/internal/service"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -152,6 +154,51 @@ func (s *GRPCServer) TrackShipment(ctx context.Context, req *pb.TrackShipmentReq
 	}, nil
 }
 
+func (s *GRPCServer) UpdateShipmentStatus(ctx context.Context, req *pb.UpdateShipmentStatusRequest) (*pb.Shipment, error) {
+	if req.TrackingNumber == "" {
+		return nil, status.Error(codes.InvalidArgument, "tracking number is required")
+	}
+
+	statusStr := getShipmentStatusString(req.Status)
+	if statusStr == "" {
+		return nil, status.Error(codes.InvalidArgument, "status is required")
+	}
+
+	shipment, err := s.shippingService.UpdateShipmentStatus(ctx, req.TrackingNumber, statusStr, req.Location, req.Description)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrShipmentNotFound):
+			return nil, status.Error(codes.NotFound, "shipment not found")
+		case errors.Is(err, service.ErrShipmentClosed):
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		default:
+			return nil, status.Errorf(codes.Internal, "failed to update shipment status: %v", err)
+		}
+	}
+
+	return &pb.Shipment{
+		Id:             shipment.ID,
+		OrderId:        shipment.OrderID,
+		TrackingNumber: shipment.TrackingNumber,
+		Carrier:        shipment.Carrier,
+		Service:        shipment.Service,
+		Status:         getShipmentStatus(shipment.Status),
+		CreatedAt:      shipment.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}, nil
+}
+
+func (s *GRPCServer) CancelShipment(ctx context.Context, req *pb.CancelShipmentRequest) (*commonv1.Empty, error) {
+	if req.OrderId == "" {
+		return nil, status.Error(codes.InvalidArgument, "order ID is required")
+	}
+
+	if err := s.shippingService.CancelShipmentForOrder(ctx, req.OrderId, req.Reason); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to cancel shipment: %v", err)
+	}
+
+	return &commonv1.Empty{}, nil
+}
+
 func getShipmentStatus(status string) pb.ShipmentStatus {
 	switch status {
 	case "pending":
@@ -172,3 +219,24 @@ func getShipmentStatus(status string) pb.ShipmentStatus {
 		return pb.ShipmentStatus_SHIPMENT_STATUS_UNSPECIFIED
 	}
 }
+
+func getShipmentStatusString(status pb.ShipmentStatus) string {
+	switch status {
+	case pb.ShipmentStatus_SHIPMENT_STATUS_PENDING:
+		return "pending"
+	case pb.ShipmentStatus_SHIPMENT_STATUS_LABEL_CREATED:
+		return "label_created"
+	case pb.ShipmentStatus_SHIPMENT_STATUS_PICKED_UP:
+		return "picked_up"
+	case pb.ShipmentStatus_SHIPMENT_STATUS_IN_TRANSIT:
+		return "in_transit"
+	case pb.ShipmentStatus_SHIPMENT_STATUS_OUT_FOR_DELIVERY:
+		return "out_for_delivery"
+	case pb.ShipmentStatus_SHIPMENT_STATUS_DELIVERED:
+		return "delivered"
+	case pb.ShipmentStatus_SHIPMENT_STATUS_FAILED:
+		return "failed"
+	default:
+		return ""
+	}
+}
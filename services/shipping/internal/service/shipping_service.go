@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"math/rand"
 	"time"
@@ -11,8 +12,23 @@ import (
 	"github.com/safar/microservices-demo/services/shipping/internal/repository"
 )
 
+// ErrShipmentClosed is returned when updating a shipment that was already
+// delivered or cancelled.
+var ErrShipmentClosed = repository.ErrShipmentClosed
+
+// ShipmentStore is the shipment persistence the service depends on.
+type ShipmentStore interface {
+	CreateShipment(shipment *repository.Shipment) (*repository.Shipment, error)
+	GetShipmentByTracking(trackingNumber string) (*repository.Shipment, error)
+	GetShipmentByID(shipmentID string) (*repository.Shipment, error)
+	GetShipmentByOrderID(orderID string) (*repository.Shipment, error)
+	UpdateShipmentStatus(shipmentID string, fromStatuses []string, trackingEvent *repository.TrackingEvent) (*repository.Shipment, error)
+	AddTrackingEvent(event *repository.TrackingEvent) error
+	GetTrackingEvents(shipmentID string) ([]repository.TrackingEvent, error)
+}
+
 type ShippingService struct {
-	repo *repository.ShippingRepository
+	repo ShipmentStore
 }
 
 type ShippingQuote struct {
@@ -26,7 +42,7 @@ type ShippingQuote struct {
 // Shipment is an exported alias for repository.Shipment
 type Shipment = repository.Shipment
 
-func NewShippingService(repo *repository.ShippingRepository) *ShippingService {
+func NewShippingService(repo ShipmentStore) *ShippingService {
 	rand.Seed(time.Now().UnixNano())
 	return &ShippingService{repo: repo}
 }
@@ -83,7 +99,8 @@ func (s *ShippingService) GetQuote(ctx context.Context, from, to *commonpb.Addre
 	return quotes, nil
 }
 
-// CreateShipment creates a new shipment with tracking
+// CreateShipment creates a new shipment with tracking. An order has at most
+// one shipment, so creating it again returns the existing shipment.
 func (s *ShippingService) CreateShipment(ctx context.Context, orderID string, from, to *commonpb.Address, weightGrams int32, carrier, service string) (*repository.Shipment, error) {
 	if orderID == "" {
 		return nil, fmt.Errorf("order ID is required")
@@ -93,6 +110,14 @@ func (s *ShippingService) CreateShipment(ctx context.Context, orderID string, fr
 		return nil, fmt.Errorf("from and to addresses are required")
 	}
 
+	existing, err := s.repo.GetShipmentByOrderID(orderID)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, repository.ErrShipmentNotFound) {
+		return nil, err
+	}
+
 	// Generate tracking number
 	trackingNumber := generateTrackingNumber(carrier)
 
@@ -199,20 +224,52 @@ func (s *ShippingService) GetShipmentByOrderID(ctx context.Context, orderID stri
 	return shipment, events, nil
 }
 
-// UpdateShipmentStatus updates shipment status and adds tracking event
-func (s *ShippingService) UpdateShipmentStatus(ctx context.Context, shipmentID, status, location, description string) error {
-	if err := s.repo.UpdateShipmentStatus(shipmentID, status); err != nil {
-		return err
+// UpdateShipmentStatus records a carrier status update for the shipment with
+// trackingNumber. The ShipmentStatusChanged event is written to the outbox
+// with the update and published by the outbox relay.
+func (s *ShippingService) UpdateShipmentStatus(ctx context.Context, trackingNumber, status, location, description string) (*repository.Shipment, error) {
+	shipment, err := s.repo.GetShipmentByTracking(trackingNumber)
+	if err != nil {
+		return nil, err
 	}
 
-	event := &repository.TrackingEvent{
-		ShipmentID:  shipmentID,
+	return s.repo.UpdateShipmentStatus(shipment.ID, nil, &repository.TrackingEvent{
 		Status:      status,
 		Location:    location,
 		Description: description,
+	})
+}
+
+// CancelShipmentForOrder cancels the order's shipment if it has not been
+// handed to the carrier yet. Orders without a shipment are ignored.
+func (s *ShippingService) CancelShipmentForOrder(ctx context.Context, orderID, reason string) error {
+	shipment, err := s.repo.GetShipmentByOrderID(orderID)
+	if errors.Is(err, repository.ErrShipmentNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
 	}
 
-	return s.repo.AddTrackingEvent(event)
+	if shipment.Status != "pending" {
+		return nil
+	}
+
+	description := "Order cancelled"
+	if reason != "" {
+		description += ": " + reason
+	}
+
+	_, err = s.repo.UpdateShipmentStatus(shipment.ID, []string{"pending"}, &repository.TrackingEvent{
+		Status:      "cancelled",
+		Location:    shipment.FromCity + ", " + shipment.FromState,
+		Description: description,
+	})
+	// The shipment left pending since it was read, so it is no longer ours to cancel
+	if errors.Is(err, repository.ErrShipmentStatusMismatch) || errors.Is(err, repository.ErrShipmentClosed) {
+		return nil
+	}
+	return err
 }
 
 // Helper functions
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	commonpb "github.com/safar/microservices-demo/proto/common/v1"
+	"github.com/safar/microservices-demo/services/shipping/internal/repository"
+)
+
+type fakeShipmentStore struct {
+	shipments map[string]*repository.Shipment
+	tracking  []repository.TrackingEvent
+	nextID    int
+
+	// beforeUpdate runs before a status update, to simulate a concurrent change
+	beforeUpdate func(shipment *repository.Shipment)
+}
+
+func newFakeShipmentStore() *fakeShipmentStore {
+	return &fakeShipmentStore{shipments: make(map[string]*repository.Shipment)}
+}
+
+func (f *fakeShipmentStore) newID(prefix string) string {
+	f.nextID++
+	return fmt.Sprintf("%s-%d", prefix, f.nextID)
+}
+
+func (f *fakeShipmentStore) CreateShipment(shipment *repository.Shipment) (*repository.Shipment, error) {
+	shipment.ID = f.newID("shipment")
+	stored := *shipment
+	f.shipments[shipment.ID] = &stored
+	return shipment, nil
+}
+
+func (f *fakeShipmentStore) find(match func(*repository.Shipment) bool) (*repository.Shipment, error) {
+	for _, shipment := range f.shipments {
+		if match(shipment) {
+			found := *shipment
+			return &found, nil
+		}
+	}
+	return nil, repository.ErrShipmentNotFound
+}
+
+func (f *fakeShipmentStore) GetShipmentByTracking(trackingNumber string) (*repository.Shipment, error) {
+	return f.find(func(s *repository.Shipment) bool { return s.TrackingNumber == trackingNumber })
+}
+
+func (f *fakeShipmentStore) GetShipmentByID(shipmentID string) (*repository.Shipment, error) {
+	return f.find(func(s *repository.Shipment) bool { return s.ID == shipmentID })
+}
+
+func (f *fakeShipmentStore) GetShipmentByOrderID(orderID string) (*repository.Shipment, error) {
+	return f.find(func(s *repository.Shipment) bool { return s.OrderID == orderID })
+}
+
+func (f *fakeShipmentStore) UpdateShipmentStatus(shipmentID string, fromStatuses []string, trackingEvent *repository.TrackingEvent) (*repository.Shipment, error) {
+	shipment, ok := f.shipments[shipmentID]
+	if !ok {
+		return nil, repository.ErrShipmentNotFound
+	}
+	if f.beforeUpdate != nil {
+		f.beforeUpdate(shipment)
+	}
+	if shipment.Status == "delivered" || shipment.Status == "cancelled" {
+		return nil, repository.ErrShipmentClosed
+	}
+	if len(fromStatuses) > 0 {
+		allowed := false
+		for _, status := range fromStatuses {
+			allowed = allowed || status == shipment.Status
+		}
+		if !allowed {
+			return nil, repository.ErrShipmentStatusMismatch
+		}
+	}
+
+	shipment.Status = trackingEvent.Status
+	trackingEvent.ShipmentID = shipmentID
+	if err := f.AddTrackingEvent(trackingEvent); err != nil {
+		return nil, err
+	}
+	updated := *shipment
+	return &updated, nil
+}
+
+func (f *fakeShipmentStore) AddTrackingEvent(event *repository.TrackingEvent) error {
+	event.ID = f.newID("tracking")
+	f.tracking = append(f.tracking, *event)
+	return nil
+}
+
+func (f *fakeShipmentStore) GetTrackingEvents(shipmentID string) ([]repository.TrackingEvent, error) {
+	var events []repository.TrackingEvent
+	for _, event := range f.tracking {
+		if event.ShipmentID == shipmentID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func testAddress(city string) *commonpb.Address {
+	return &commonpb.Address{Street: "1 Main St", City: city, State: "CA", ZipCode: "94000", Country: "US"}
+}
+
+func createTestShipment(t *testing.T, svc *ShippingService, orderID string) *repository.Shipment {
+	t.Helper()
+	shipment, err := svc.CreateShipment(context.Background(), orderID, testAddress("Oakland"), testAddress("Fresno"), 1000, "UPS", "Ground")
+	if err != nil {
+		t.Fatalf("failed to create shipment: %v", err)
+	}
+	return shipment
+}
+
+func TestCreateShipmentReturnsExistingShipment(t *testing.T) {
+	store := newFakeShipmentStore()
+	svc := NewShippingService(store)
+
+	first := createTestShipment(t, svc, "order-1")
+	second := createTestShipment(t, svc, "order-1")
+
+	if second.ID != first.ID {
+		t.Fatalf("expected existing shipment %s, got %s", first.ID, second.ID)
+	}
+	if len(store.shipments) != 1 || len(store.tracking) != 1 {
+		t.Fatalf("expected one shipment and one tracking event, got %d and %d", len(store.shipments), len(store.tracking))
+	}
+	if first.Carrier != "UPS" || first.Service != "Ground" || first.Status != "pending" {
+		t.Fatalf("expected pending UPS Ground shipment, got %s %s %s", first.Status, first.Carrier, first.Service)
+	}
+}
+
+func TestUpdateShipmentStatusRecordsTrackingEvent(t *testing.T) {
+	store := newFakeShipmentStore()
+	svc := NewShippingService(store)
+	shipment := createTestShipment(t, svc, "order-1")
+
+	updated, err := svc.UpdateShipmentStatus(context.Background(), shipment.TrackingNumber, "in_transit", "Fresno, CA", "Arrived at facility")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if updated.Status != "in_transit" {
+		t.Fatalf("expected in_transit, got %s", updated.Status)
+	}
+
+	events, _ := store.GetTrackingEvents(shipment.ID)
+	last := events[len(events)-1]
+	if last.Status != "in_transit" || last.Location != "Fresno, CA" || last.Description != "Arrived at facility" {
+		t.Fatalf("unexpected tracking event %+v", last)
+	}
+}
+
+func TestUpdateShipmentStatusRejectsClosedShipment(t *testing.T) {
+	store := newFakeShipmentStore()
+	svc := NewShippingService(store)
+	shipment := createTestShipment(t, svc, "order-1")
+
+	if _, err := svc.UpdateShipmentStatus(context.Background(), shipment.TrackingNumber, "delivered", "Fresno, CA", "Delivered"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	_, err := svc.UpdateShipmentStatus(context.Background(), shipment.TrackingNumber, "in_transit", "Fresno, CA", "Late scan")
+	if !errors.Is(err, ErrShipmentClosed) {
+		t.Fatalf("expected ErrShipmentClosed, got %v", err)
+	}
+	if store.shipments[shipment.ID].Status != "delivered" {
+		t.Fatalf("expected shipment to stay delivered, got %s", store.shipments[shipment.ID].Status)
+	}
+}
+
+func TestUpdateShipmentStatusUnknownTrackingNumber(t *testing.T) {
+	svc := NewShippingService(newFakeShipmentStore())
+
+	_, err := svc.UpdateShipmentStatus(context.Background(), "missing", "in_transit", "", "")
+	if !errors.Is(err, repository.ErrShipmentNotFound) {
+		t.Fatalf("expected ErrShipmentNotFound, got %v", err)
+	}
+}
+
+func TestCancelShipmentForOrder(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       string
+		beforeUpdate func(*repository.Shipment)
+		wantStatus   string
+	}{
+		{name: "pending shipment is cancelled", status: "pending", wantStatus: "cancelled"},
+		{name: "shipment with carrier is kept", status: "in_transit", wantStatus: "in_transit"},
+		{
+			name:         "carrier picks up shipment during cancel",
+			status:       "pending",
+			beforeUpdate: func(s *repository.Shipment) { s.Status = "in_transit" },
+			wantStatus:   "in_transit",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeShipmentStore()
+			svc := NewShippingService(store)
+			shipment := createTestShipment(t, svc, "order-1")
+			store.shipments[shipment.ID].Status = tt.status
+			store.beforeUpdate = tt.beforeUpdate
+
+			if err := svc.CancelShipmentForOrder(context.Background(), "order-1", "customer request"); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if got := store.shipments[shipment.ID].Status; got != tt.wantStatus {
+				t.Fatalf("expected %s, got %s", tt.wantStatus, got)
+			}
+		})
+	}
+}
+
+func TestCancelShipmentForOrderWithoutShipment(t *testing.T) {
+	svc := NewShippingService(newFakeShipmentStore())
+
+	if err := svc.CancelShipmentForOrder(context.Background(), "order-1", ""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,3 @@
+-- Drop outbox table
+DROP INDEX IF EXISTS idx_outbox_unpublished;
+DROP TABLE IF EXISTS outbox;
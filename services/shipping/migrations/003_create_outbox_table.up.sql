@@ -0,0 +1,15 @@
+-- Create outbox table for shipment events, written in the same transaction
+-- as the status change that produced them
+CREATE TABLE IF NOT EXISTS outbox (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    event_type VARCHAR(100) NOT NULL,
+    aggregate_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT DEFAULT 0 NOT NULL,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT NOW() NOT NULL,
+    published_at TIMESTAMP
+);
+
+-- Create index
+CREATE INDEX idx_outbox_unpublished ON outbox(created_at) WHERE published_at IS NULL;
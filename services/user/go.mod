@@ -6,6 +6,7 @@ require (
 	github.com/golang-jwt/jwt/v5 v5.3.1
 	github.com/lib/pq v1.11.2
 	github.com/safar/microservices-demo/proto v0.0.0-00010101000000-000000000000
+	github.com/safar/microservices-demo/shared v0.0.0-00010101000000-000000000000
 	golang.org/x/crypto v0.48.0
 	google.golang.org/grpc v1.79.1
 )
@@ -19,3 +20,5 @@ require (
 )
 
 replace github.com/safar/microservices-demo/proto => ../../proto
+
+replace github.com/safar/microservices-demo/shared => ../../shared
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/safar/microservices-demo/shared/pagination"
 )
 
 type User struct {
@@ -128,23 +129,29 @@ func (r *UserRepository) GetUserByID(id string) (*User, error) {
 	return user, nil
 }
 
-func (r *UserRepository) ListUsers(limit, offset int) ([]*User, int, error) {
-	countQuery := `SELECT COUNT(*) FROM users`
-	var totalCount int
-	if err := r.db.QueryRow(countQuery).Scan(&totalCount); err != nil {
-		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+// ListUsers returns a page of users, newest first, and how many there are
+// as the page asks to count them.
+func (r *UserRepository) ListUsers(page pagination.Page) ([]*User, pagination.Result, error) {
+	result, err := pagination.Count(r.db, page, `FROM users`)
+	if err != nil {
+		return nil, pagination.Result{}, fmt.Errorf("failed to count users: %w", err)
 	}
 
 	query := `
 		SELECT id, email, password_hash, role, created_at, updated_at
 		FROM users
-		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
 	`
+	var args []interface{}
+	if condition, conditionArgs := page.Condition("created_at", "id", 1); condition != "" {
+		query += " WHERE " + condition
+		args = append(args, conditionArgs...)
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, page.Limit(), page.Offset())
 
-	rows, err := r.db.Query(query, limit, offset)
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+		return nil, pagination.Result{}, fmt.Errorf("failed to list users: %w", err)
 	}
 	defer rows.Close()
 
@@ -155,12 +162,15 @@ func (r *UserRepository) ListUsers(limit, offset int) ([]*User, int, error) {
 			&user.ID, &user.Email, &user.PasswordHash, &user.Role,
 			&user.CreatedAt, &user.UpdatedAt,
 		); err != nil {
-			return nil, 0, fmt.Errorf("failed to scan user: %w", err)
+			return nil, pagination.Result{}, fmt.Errorf("failed to scan user: %w", err)
 		}
 		users = append(users, user)
 	}
 
-	return users, totalCount, nil
+	users, result.Next = pagination.Trim(page, users, func(user *User) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: user.CreatedAt, ID: user.ID}
+	})
+	return users, result, nil
 }
 
 // Profile operations
@@ -2,11 +2,11 @@ package server
 
 import (
 	"context"
-	"math"
 
 	commonv1 "github.com/safar/microservices-demo/proto/common/v1"
 	pb "github.com/safar/microservices-demo/proto/user/v1"
 	"github.com/safar/microservices-demo/services/user/internal/service"
+	"github.com/safar/microservices-demo/shared/pagination"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -227,17 +227,12 @@ func (s *GRPCServer) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest)
 }
 
 func (s *GRPCServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
-	page := int(req.Pagination.Page)
-	pageSize := int(req.Pagination.PageSize)
-
-	if page <= 0 {
-		page = 1
-	}
-	if pageSize <= 0 {
-		pageSize = 10
+	page, err := pagination.FromProto(req.Pagination, 10)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	users, total, err := s.userService.ListUsers(ctx, page, pageSize)
+	users, result, err := s.userService.ListUsers(ctx, page)
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to list users: %v", err)
 	}
@@ -253,16 +248,9 @@ func (s *GRPCServer) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*
 		})
 	}
 
-	totalPages := int32(math.Ceil(float64(total) / float64(pageSize)))
-
 	return &pb.ListUsersResponse{
-		Users: pbUsers,
-		Pagination: &commonv1.PaginationResponse{
-			Page:       int32(page),
-			PageSize:   int32(pageSize),
-			TotalPages: totalPages,
-			TotalCount: int64(total),
-		},
+		Users:      pbUsers,
+		Pagination: pagination.ToProto(page, result),
 	}, nil
 }
 
@@ -9,16 +9,33 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/safar/microservices-demo/services/user/internal/repository"
+	"github.com/safar/microservices-demo/shared/pagination"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// UserStore is the user data the service needs, implemented by
+// repository.UserRepository.
+type UserStore interface {
+	CreateUser(email, passwordHash, role string) (*repository.User, error)
+	GetUserByEmail(email string) (*repository.User, error)
+	GetUserByID(id string) (*repository.User, error)
+	ListUsers(page pagination.Page) ([]*repository.User, pagination.Result, error)
+	CreateProfile(userID, firstName, lastName, phone, avatarURL string) (*repository.Profile, error)
+	GetProfileByUserID(userID string) (*repository.Profile, error)
+	UpdateProfile(userID, firstName, lastName, phone, avatarURL string) (*repository.Profile, error)
+	CreateAddress(userID, label, street, city, state, zipCode, country string, isDefault bool) (*repository.Address, error)
+	ListAddresses(userID string) ([]*repository.Address, error)
+	AddToWishlist(userID, productID string) error
+	GetWishlist(userID string) ([]*repository.WishlistItem, error)
+}
+
 type UserService struct {
-	repo      *repository.UserRepository
+	repo      UserStore
 	jwtSecret string
 	jwtExpiry int
 }
 
-func NewUserService(repo *repository.UserRepository, jwtSecret string, jwtExpiry int) *UserService {
+func NewUserService(repo UserStore, jwtSecret string, jwtExpiry int) *UserService {
 	return &UserService{
 		repo:      repo,
 		jwtSecret: jwtSecret,
@@ -161,14 +178,13 @@ func (s *UserService) UpdateUser(ctx context.Context, userID, firstName, lastNam
 }
 
 // ListUsers lists all users (admin only)
-func (s *UserService) ListUsers(ctx context.Context, page, pageSize int) ([]*repository.User, int, error) {
-	offset := (page - 1) * pageSize
-	users, total, err := s.repo.ListUsers(pageSize, offset)
+func (s *UserService) ListUsers(ctx context.Context, page pagination.Page) ([]*repository.User, pagination.Result, error) {
+	users, result, err := s.repo.ListUsers(page)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+		return nil, pagination.Result{}, fmt.Errorf("failed to list users: %w", err)
 	}
 
-	return users, total, nil
+	return users, result, nil
 }
 
 // AddAddress adds a new address for a user
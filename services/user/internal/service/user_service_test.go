@@ -7,13 +7,14 @@ import (
 	"time"
 
 	"github.com/safar/microservices-demo/services/user/internal/repository"
+	"github.com/safar/microservices-demo/shared/pagination"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type mockUserRepository struct {
 	getUserByEmailFn func(email string) (*repository.User, error)
 	getProfileByIDFn func(userID string) (*repository.Profile, error)
-	listUsersFn      func(limit, offset int) ([]*repository.User, int, error)
+	listUsersFn      func(page pagination.Page) ([]*repository.User, pagination.Result, error)
 }
 
 func (m *mockUserRepository) CreateUser(email, passwordHash, role string) (*repository.User, error) {
@@ -46,11 +47,11 @@ func (m *mockUserRepository) UpdateProfile(userID, firstName, lastName, phone, a
 	return nil, nil
 }
 
-func (m *mockUserRepository) ListUsers(limit, offset int) ([]*repository.User, int, error) {
+func (m *mockUserRepository) ListUsers(page pagination.Page) ([]*repository.User, pagination.Result, error) {
 	if m.listUsersFn != nil {
-		return m.listUsersFn(limit, offset)
+		return m.listUsersFn(page)
 	}
-	return nil, 0, nil
+	return nil, pagination.Result{}, nil
 }
 
 func (m *mockUserRepository) CreateAddress(userID, label, street, city, state, zipCode, country string, isDefault bool) (*repository.Address, error) {
@@ -128,16 +129,16 @@ func TestLoginInvalidCredentials(t *testing.T) {
 
 func TestListUsersPaginationOffset(t *testing.T) {
 	mockRepo := &mockUserRepository{
-		listUsersFn: func(limit, offset int) ([]*repository.User, int, error) {
-			if limit != 10 || offset != 20 {
-				t.Fatalf("unexpected pagination values: limit=%d offset=%d", limit, offset)
+		listUsersFn: func(page pagination.Page) ([]*repository.User, pagination.Result, error) {
+			if page.Limit() != 10 || page.Offset() != 20 {
+				t.Fatalf("unexpected pagination values: limit=%d offset=%d", page.Limit(), page.Offset())
 			}
-			return []*repository.User{}, 0, nil
+			return []*repository.User{}, pagination.Result{}, nil
 		},
 	}
 
 	svc := NewUserService(mockRepo, "test-secret", 3600)
-	_, _, err := svc.ListUsers(context.Background(), 3, 10)
+	_, _, err := svc.ListUsers(context.Background(), pagination.Page{Number: 3, Size: 10})
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
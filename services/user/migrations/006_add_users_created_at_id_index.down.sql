@@ -0,0 +1,2 @@
+-- Drop the keyset pagination index on users
+DROP INDEX IF EXISTS idx_users_created_at_id;
@@ -0,0 +1,2 @@
+-- Index users in list order for keyset pagination
+CREATE INDEX IF NOT EXISTS idx_users_created_at_id ON users(created_at DESC, id DESC);
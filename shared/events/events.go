@@ -0,0 +1,103 @@
+// Package events provides the domain event envelope and the bus that
+// services use to publish and subscribe to each other's events.
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Order lifecycle event types. Payloads are the matching messages in
+// proto/events/v1.
+const (
+	TypeOrderCreated       = "order.created"
+	TypeOrderCancelled     = "order.cancelled"
+	TypeOrderStatusChanged = "order.status_changed"
+)
+
+// Shipment event types, published by the shipping service.
+const (
+	TypeShipmentStatusChanged = "shipment.status_changed"
+)
+
+// Stock alert event types, published by the catalog service. Both carry a
+// StockAlert payload.
+const (
+	TypeStockLow = "inventory.low_stock"
+	TypeStockOut = "inventory.out_of_stock"
+)
+
+// Event is a single domain event. ID is unique per event and lets
+// subscribers ignore redeliveries.
+type Event struct {
+	ID          string
+	Type        string
+	AggregateID string
+	Payload     []byte
+	OccurredAt  time.Time
+}
+
+// New builds an event with msg encoded as its JSON payload. The ID is
+// assigned by whoever stores the event first, usually an outbox.
+func New(eventType, aggregateID string, msg proto.Message) (Event, error) {
+	payload, err := protojson.Marshal(msg)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	return Event{
+		Type:        eventType,
+		AggregateID: aggregateID,
+		Payload:     payload,
+		OccurredAt:  time.Now(),
+	}, nil
+}
+
+// Decode unmarshals the event payload into msg.
+func (e Event) Decode(msg proto.Message) error {
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(e.Payload, msg); err != nil {
+		return fmt.Errorf("failed to decode %s event %s: %w", e.Type, e.ID, err)
+	}
+	return nil
+}
+
+// Handler processes a delivered event. Returning an error causes the event
+// to be redelivered, so handlers must be idempotent.
+type Handler func(ctx context.Context, event Event) error
+
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+type Subscriber interface {
+	// Subscribe delivers events of the given types to handler until ctx is
+	// done. Subscribers sharing a group split the events between them;
+	// every group sees every event.
+	Subscribe(ctx context.Context, group string, eventTypes []string, handler Handler) error
+}
+
+type Bus interface {
+	Publisher
+	Subscriber
+	Close() error
+}
+
+// Open returns the bus for driver, either "memory" or "postgres". url is
+// only used by the postgres driver. Services only see each other's events
+// on the postgres bus; the memory bus is for tests and single-process runs.
+func Open(driver, url string) (Bus, error) {
+	switch driver {
+	case "memory":
+		log.Printf("Using the in-memory event bus: events are only delivered within this process")
+		return NewMemoryBus(), nil
+	case "postgres":
+		return NewPostgresBus(url)
+	default:
+		return nil, fmt.Errorf("unknown event bus driver %q", driver)
+	}
+}
@@ -0,0 +1,88 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MemoryBus delivers events synchronously to subscribers in the same
+// process. It keeps no history, so events published while nobody is
+// subscribed are dropped. Use it for tests and single-process local runs.
+type MemoryBus struct {
+	mu     sync.RWMutex
+	nextID int
+	groups map[int]*memorySubscription
+}
+
+type memorySubscription struct {
+	group      string
+	eventTypes map[string]bool
+	handler    Handler
+	mu         sync.Mutex
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		groups: make(map[int]*memorySubscription),
+	}
+}
+
+// Publish hands the event to one subscription of every group interested in
+// its type and returns the handler errors, if any.
+func (b *MemoryBus) Publish(ctx context.Context, event Event) error {
+	b.mu.RLock()
+	seen := make(map[string]bool)
+	var targets []*memorySubscription
+	for id := 0; id < b.nextID; id++ {
+		sub, ok := b.groups[id]
+		if !ok || seen[sub.group] || !sub.eventTypes[event.Type] {
+			continue
+		}
+		seen[sub.group] = true
+		targets = append(targets, sub)
+	}
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, sub := range targets {
+		sub.mu.Lock()
+		err := sub.handler(ctx, event)
+		sub.mu.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sub.group, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (b *MemoryBus) Subscribe(ctx context.Context, group string, eventTypes []string, handler Handler) error {
+	sub := &memorySubscription{
+		group:      group,
+		eventTypes: make(map[string]bool),
+		handler:    handler,
+	}
+	for _, eventType := range eventTypes {
+		sub.eventTypes[eventType] = true
+	}
+
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.groups[id] = sub
+	b.mu.Unlock()
+
+	<-ctx.Done()
+
+	b.mu.Lock()
+	delete(b.groups, id)
+	b.mu.Unlock()
+
+	return nil
+}
+
+func (b *MemoryBus) Close() error {
+	return nil
+}
@@ -0,0 +1,84 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func subscribeMemory(t *testing.T, bus *MemoryBus, group string, eventTypes []string, handler Handler) context.CancelFunc {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		bus.Subscribe(ctx, group, eventTypes, handler)
+	}()
+
+	// Wait for the subscription to register
+	deadline := time.Now().Add(time.Second)
+	for {
+		bus.mu.RLock()
+		n := len(bus.groups)
+		bus.mu.RUnlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func TestMemoryBusDeliversOncePerGroup(t *testing.T) {
+	bus := NewMemoryBus()
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	record := func(name string) Handler {
+		return func(ctx context.Context, event Event) error {
+			mu.Lock()
+			calls[name]++
+			mu.Unlock()
+			return nil
+		}
+	}
+
+	stop1 := subscribeMemory(t, bus, "notification", []string{TypeOrderCreated}, record("notification"))
+	defer stop1()
+	stop2 := subscribeMemory(t, bus, "notification", []string{TypeOrderCreated}, record("notification"))
+	defer stop2()
+	stop3 := subscribeMemory(t, bus, "shipping", []string{TypeOrderCancelled}, record("shipping"))
+	defer stop3()
+
+	if err := bus.Publish(context.Background(), Event{ID: "evt-1", Type: TypeOrderCreated}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if calls["notification"] != 1 {
+		t.Fatalf("expected notification group to handle the event once, got %d", calls["notification"])
+	}
+	if calls["shipping"] != 0 {
+		t.Fatalf("expected shipping group to ignore the event, got %d", calls["shipping"])
+	}
+}
+
+func TestMemoryBusReturnsHandlerErrors(t *testing.T) {
+	bus := NewMemoryBus()
+
+	stop := subscribeMemory(t, bus, "notification", []string{TypeOrderCreated}, func(ctx context.Context, event Event) error {
+		return errors.New("smtp down")
+	})
+	defer stop()
+
+	if err := bus.Publish(context.Background(), Event{ID: "evt-1", Type: TypeOrderCreated}); err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+}
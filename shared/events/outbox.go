@@ -0,0 +1,82 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// outboxBatchSize caps how many events one relay pass publishes.
+const outboxBatchSize = 100
+
+// OutboxStore is the outbox persistence a relay drains. Services write
+// events to their outbox in the same transaction as the change that
+// produced them.
+type OutboxStore interface {
+	ListUnpublishedOutboxEvents(limit int) ([]Event, error)
+	MarkOutboxEventPublished(eventID string) error
+	RecordOutboxFailure(eventID string, publishErr error) error
+}
+
+// OutboxRelay publishes events written to a service's outbox. Events are
+// published at least once and in the order they were written.
+type OutboxRelay struct {
+	store OutboxStore
+	bus   Publisher
+}
+
+func NewOutboxRelay(store OutboxStore, bus Publisher) *OutboxRelay {
+	return &OutboxRelay{
+		store: store,
+		bus:   bus,
+	}
+}
+
+// RelayPending publishes unpublished events until the outbox is drained or
+// a publish fails, and reports how many were published. It stops at the
+// first failure so later events are never published ahead of it.
+func (r *OutboxRelay) RelayPending(ctx context.Context) (int, error) {
+	var published int
+	for {
+		pending, err := r.store.ListUnpublishedOutboxEvents(outboxBatchSize)
+		if err != nil {
+			return published, fmt.Errorf("failed to list outbox events: %w", err)
+		}
+
+		for _, event := range pending {
+			if err := r.bus.Publish(ctx, event); err != nil {
+				if rerr := r.store.RecordOutboxFailure(event.ID, err); rerr != nil {
+					log.Printf("Failed to record outbox failure for event %s: %v", event.ID, rerr)
+				}
+				return published, fmt.Errorf("failed to publish %s event %s: %w", event.Type, event.ID, err)
+			}
+			if err := r.store.MarkOutboxEventPublished(event.ID); err != nil {
+				return published, err
+			}
+			published++
+		}
+
+		if len(pending) < outboxBatchSize || ctx.Err() != nil {
+			return published, nil
+		}
+	}
+}
+
+// Run relays pending events every interval until ctx is done.
+func (r *OutboxRelay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RelayPending(ctx); err != nil {
+			log.Printf("Outbox relay failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type fakeOutboxStore struct {
+	pending   []Event
+	published []string
+	failures  map[string]int
+}
+
+func (f *fakeOutboxStore) ListUnpublishedOutboxEvents(limit int) ([]Event, error) {
+	var unpublished []Event
+	for _, event := range f.pending {
+		if !f.isPublished(event.ID) && len(unpublished) < limit {
+			unpublished = append(unpublished, event)
+		}
+	}
+	return unpublished, nil
+}
+
+func (f *fakeOutboxStore) MarkOutboxEventPublished(eventID string) error {
+	f.published = append(f.published, eventID)
+	return nil
+}
+
+func (f *fakeOutboxStore) RecordOutboxFailure(eventID string, publishErr error) error {
+	if f.failures == nil {
+		f.failures = make(map[string]int)
+	}
+	f.failures[eventID]++
+	return nil
+}
+
+func (f *fakeOutboxStore) isPublished(eventID string) bool {
+	for _, id := range f.published {
+		if id == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+type fakePublisher struct {
+	failOn    string
+	published []Event
+}
+
+func (f *fakePublisher) Publish(ctx context.Context, event Event) error {
+	if event.ID == f.failOn {
+		return errors.New("bus unavailable")
+	}
+	f.published = append(f.published, event)
+	return nil
+}
+
+func TestOutboxRelayPublishesPendingEventsInOrder(t *testing.T) {
+	store := &fakeOutboxStore{pending: []Event{
+		{ID: "evt-1", Type: TypeOrderCreated},
+		{ID: "evt-2", Type: TypeOrderStatusChanged},
+		{ID: "evt-3", Type: TypeOrderCancelled},
+	}}
+	bus := &fakePublisher{}
+
+	published, err := NewOutboxRelay(store, bus).RelayPending(context.Background())
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if published != 3 || len(store.published) != 3 {
+		t.Fatalf("expected 3 events published, got %d", published)
+	}
+	for i, event := range bus.published {
+		if event.ID != store.pending[i].ID {
+			t.Fatalf("expected event %s at position %d, got %s", store.pending[i].ID, i, event.ID)
+		}
+	}
+}
+
+func TestOutboxRelayStopsAtFirstFailure(t *testing.T) {
+	store := &fakeOutboxStore{pending: []Event{
+		{ID: "evt-1", Type: TypeOrderCreated},
+		{ID: "evt-2", Type: TypeOrderStatusChanged},
+		{ID: "evt-3", Type: TypeOrderCancelled},
+	}}
+	bus := &fakePublisher{failOn: "evt-2"}
+	relay := NewOutboxRelay(store, bus)
+
+	published, err := relay.RelayPending(context.Background())
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if published != 1 || store.isPublished("evt-3") {
+		t.Fatalf("expected only evt-1 to be published, got %v", store.published)
+	}
+	if store.failures["evt-2"] != 1 {
+		t.Fatalf("expected failure to be recorded for evt-2")
+	}
+
+	bus.failOn = ""
+	if _, err := relay.RelayPending(context.Background()); err != nil {
+		t.Fatalf("expected no error on retry, got %v", err)
+	}
+	if len(store.published) != 3 {
+		t.Fatalf("expected all events published after retry, got %v", store.published)
+	}
+}
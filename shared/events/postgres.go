@@ -0,0 +1,202 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const postgresSchema = `
+	CREATE TABLE IF NOT EXISTS events (
+		position BIGSERIAL PRIMARY KEY,
+		id UUID NOT NULL UNIQUE,
+		type VARCHAR(100) NOT NULL,
+		aggregate_id VARCHAR(255) NOT NULL,
+		payload JSONB NOT NULL,
+		occurred_at TIMESTAMP NOT NULL,
+		published_at TIMESTAMP DEFAULT NOW() NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_events_type_position ON events(type, position);
+
+	CREATE TABLE IF NOT EXISTS event_subscriptions (
+		group_name VARCHAR(100) PRIMARY KEY,
+		position BIGINT NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP DEFAULT NOW() NOT NULL
+	);
+`
+
+// PostgresBus stores events in a shared database table. Each subscriber
+// group keeps a cursor into the table and polls for events past it, so
+// events survive restarts and are delivered at least once.
+type PostgresBus struct {
+	db           *sql.DB
+	pollInterval time.Duration
+	batchSize    int
+}
+
+func NewPostgresBus(databaseURL string) (*PostgresBus, error) {
+	db, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event bus database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping event bus database: %w", err)
+	}
+
+	if _, err := db.Exec(postgresSchema); err != nil {
+		return nil, fmt.Errorf("failed to create event bus schema: %w", err)
+	}
+
+	db.SetMaxOpenConns(10)
+	db.SetMaxIdleConns(2)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	return &PostgresBus{
+		db:           db,
+		pollInterval: time.Second,
+		batchSize:    100,
+	}, nil
+}
+
+// Publish appends the event. Publishing an event ID that is already stored
+// is a no-op, so publishers can safely retry.
+func (b *PostgresBus) Publish(ctx context.Context, event Event) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Serialize publishers so positions become visible in order and a
+	// subscriber cursor never skips a position committed late.
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext('events'))`); err != nil {
+		return fmt.Errorf("failed to lock events: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO events (id, type, aggregate_id, payload, occurred_at)
+		VALUES (COALESCE(NULLIF($1, '')::uuid, gen_random_uuid()), $2, $3, $4, $5)
+		ON CONFLICT (id) DO NOTHING
+	`, event.ID, event.Type, event.AggregateID, event.Payload, event.OccurredAt); err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", event.Type, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (b *PostgresBus) Subscribe(ctx context.Context, group string, eventTypes []string, handler Handler) error {
+	if _, err := b.db.ExecContext(ctx, `
+		INSERT INTO event_subscriptions (group_name) VALUES ($1)
+		ON CONFLICT (group_name) DO NOTHING
+	`, group); err != nil {
+		return fmt.Errorf("failed to register subscription %s: %w", group, err)
+	}
+
+	ticker := time.NewTicker(b.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			delivered, err := b.deliver(ctx, group, eventTypes, handler)
+			if err != nil {
+				log.Printf("Event delivery to %s failed: %v", group, err)
+				break
+			}
+			if delivered < b.batchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver hands the next batch of events to handler and advances the
+// group's cursor past every event that was handled. The cursor row stays
+// locked meanwhile, so members of a group never handle the same event
+// concurrently.
+func (b *PostgresBus) deliver(ctx context.Context, group string, eventTypes []string, handler Handler) (int, error) {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var position int64
+	if err := tx.QueryRowContext(ctx, `
+		SELECT position FROM event_subscriptions WHERE group_name = $1 FOR UPDATE
+	`, group).Scan(&position); err != nil {
+		return 0, fmt.Errorf("failed to get subscription cursor: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT position, id, type, aggregate_id, payload, occurred_at
+		FROM events
+		WHERE position > $1 AND type = ANY($2)
+		ORDER BY position ASC
+		LIMIT $3
+	`, position, pq.Array(eventTypes), b.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	type storedEvent struct {
+		position int64
+		event    Event
+	}
+	var batch []storedEvent
+	for rows.Next() {
+		var se storedEvent
+		if err := rows.Scan(&se.position, &se.event.ID, &se.event.Type, &se.event.AggregateID,
+			&se.event.Payload, &se.event.OccurredAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan event: %w", err)
+		}
+		batch = append(batch, se)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to iterate events: %w", err)
+	}
+
+	var delivered int
+	var handlerErr error
+	for _, se := range batch {
+		if err := handler(ctx, se.event); err != nil {
+			handlerErr = fmt.Errorf("failed to handle %s event %s: %w", se.event.Type, se.event.ID, err)
+			break
+		}
+		position = se.position
+		delivered++
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE event_subscriptions SET position = $2, updated_at = NOW() WHERE group_name = $1
+	`, group, position); err != nil {
+		return 0, fmt.Errorf("failed to advance subscription cursor: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return delivered, handlerErr
+}
+
+func (b *PostgresBus) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,240 @@
+// Package pagination pages through lists either by page number, with
+// LIMIT/OFFSET, or by an opaque cursor over (created_at, id), and counts
+// their totals exactly, approximately or not at all.
+package pagination
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	commonv1 "github.com/safar/microservices-demo/proto/common/v1"
+)
+
+// ErrInvalidPageToken is returned for a page token that was not issued by
+// a list response.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// CountMode is how a list counts its total.
+type CountMode string
+
+// Count modes. The zero value counts exactly when paging by page number
+// and does not count when paging by cursor.
+const (
+	CountExact       CountMode = "exact"
+	CountApproximate CountMode = "approximate"
+	CountNone        CountMode = "none"
+)
+
+// Cursor is the position of the last row of a page in a list ordered by
+// created_at and id, both descending.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+type token struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// EncodeToken returns the page token of cursor.
+func EncodeToken(cursor Cursor) string {
+	data, _ := json.Marshal(token{CreatedAt: cursor.CreatedAt.UTC(), ID: cursor.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeToken returns the cursor of a page token.
+func DecodeToken(s string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidPageToken
+	}
+	var t token
+	if err := json.Unmarshal(data, &t); err != nil || t.ID == "" || t.CreatedAt.IsZero() {
+		return Cursor{}, ErrInvalidPageToken
+	}
+	return Cursor{CreatedAt: t.CreatedAt, ID: t.ID}, nil
+}
+
+// Page is which page of a list to return.
+type Page struct {
+	// Number is the 1-based page number, unused when paging by cursor.
+	Number int
+	Size   int
+	// Keyset pages by cursor, listing the rows after After, or from the
+	// start when After is nil.
+	Keyset bool
+	After  *Cursor
+	Count  CountMode
+}
+
+// CountMode returns how the page's list should be counted.
+func (p Page) CountMode() CountMode {
+	if p.Count != "" {
+		return p.Count
+	}
+	if p.Keyset {
+		return CountNone
+	}
+	return CountExact
+}
+
+// Limit returns how many rows to select. Paging by cursor selects one row
+// more than the page holds, to tell whether there is a next page.
+func (p Page) Limit() int {
+	if p.Keyset {
+		return p.Size + 1
+	}
+	return p.Size
+}
+
+// Offset returns how many rows to skip.
+func (p Page) Offset() int {
+	if p.Keyset || p.Number < 1 {
+		return 0
+	}
+	return (p.Number - 1) * p.Size
+}
+
+// Condition returns the condition that keeps the rows after the page's
+// cursor, comparing createdAtColumn and idColumn to placeholders $argPos
+// and $argPos+1, and the values of those placeholders. It returns "" when
+// there is no cursor.
+func (p Page) Condition(createdAtColumn, idColumn string, argPos int) (string, []interface{}) {
+	if !p.Keyset || p.After == nil {
+		return "", nil
+	}
+	condition := fmt.Sprintf("(%s, %s) < ($%d, $%d)", createdAtColumn, idColumn, argPos, argPos+1)
+	return condition, []interface{}{p.After.CreatedAt, p.After.ID}
+}
+
+// Result is how many rows a list has and where its next page starts.
+type Result struct {
+	Total            int64
+	TotalApproximate bool
+	Counted          bool
+	// Next is the cursor of the next page when paging by cursor, nil on
+	// the last page.
+	Next *Cursor
+}
+
+// Queryer runs a query returning one row; *sql.DB and *sql.Tx are both
+// Queryers.
+type Queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Count counts the rows of "SELECT ... " + fromWhere as the page asks,
+// using the query planner's estimate for an approximate count.
+func Count(db Queryer, page Page, fromWhere string, args ...interface{}) (Result, error) {
+	switch page.CountMode() {
+	case CountNone:
+		return Result{}, nil
+	case CountApproximate:
+		var plan string
+		if err := db.QueryRow(`EXPLAIN (FORMAT JSON) SELECT 1 `+fromWhere, args...).Scan(&plan); err != nil {
+			return Result{}, fmt.Errorf("failed to estimate count: %w", err)
+		}
+		rows, err := planRows(plan)
+		if err != nil {
+			return Result{}, err
+		}
+		return Result{Total: rows, TotalApproximate: true, Counted: true}, nil
+	}
+
+	var total int64
+	if err := db.QueryRow(`SELECT COUNT(*) `+fromWhere, args...).Scan(&total); err != nil {
+		return Result{}, fmt.Errorf("failed to count: %w", err)
+	}
+	return Result{Total: total, Counted: true}, nil
+}
+
+// planRows returns the estimated rows of an EXPLAIN (FORMAT JSON) plan.
+func planRows(plan string) (int64, error) {
+	var explain []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(plan), &explain); err != nil {
+		return 0, fmt.Errorf("failed to parse query plan: %w", err)
+	}
+	if len(explain) == 0 {
+		return 0, errors.New("failed to parse query plan: empty plan")
+	}
+	return int64(explain[0].Plan.Rows), nil
+}
+
+// Trim drops the extra row selected when paging by cursor and returns the
+// cursor of the next page, taken from the page's last row with cursor, or
+// nil when there is no next page.
+func Trim[T any](page Page, rows []T, cursor func(T) Cursor) ([]T, *Cursor) {
+	if !page.Keyset || len(rows) <= page.Size {
+		return rows, nil
+	}
+	rows = rows[:page.Size]
+	next := cursor(rows[len(rows)-1])
+	return rows, &next
+}
+
+// FromProto returns the page a request asks for, defaulting to the first
+// page of defaultSize rows.
+func FromProto(p *commonv1.Pagination, defaultSize int) (Page, error) {
+	page := Page{Number: 1, Size: defaultSize}
+	if p == nil {
+		return page, nil
+	}
+
+	if p.Page > 0 {
+		page.Number = int(p.Page)
+	}
+	if p.PageSize > 0 {
+		page.Size = int(p.PageSize)
+	}
+
+	switch p.Count {
+	case commonv1.CountMode_COUNT_MODE_EXACT:
+		page.Count = CountExact
+	case commonv1.CountMode_COUNT_MODE_APPROXIMATE:
+		page.Count = CountApproximate
+	case commonv1.CountMode_COUNT_MODE_NONE:
+		page.Count = CountNone
+	}
+
+	if p.PageToken != "" || p.UsePageToken {
+		page.Keyset = true
+		page.Number = 0
+	}
+	if p.PageToken != "" {
+		cursor, err := DecodeToken(p.PageToken)
+		if err != nil {
+			return Page{}, err
+		}
+		page.After = &cursor
+	}
+
+	return page, nil
+}
+
+// ToProto returns the pagination of a list response.
+func ToProto(page Page, result Result) *commonv1.PaginationResponse {
+	resp := &commonv1.PaginationResponse{
+		Page:                  int32(page.Number),
+		PageSize:              int32(page.Size),
+		TotalCount:            result.Total,
+		TotalCountApproximate: result.TotalApproximate,
+		TotalCounted:          result.Counted,
+	}
+	if result.Counted && page.Size > 0 {
+		resp.TotalPages = int32(math.Ceil(float64(result.Total) / float64(page.Size)))
+	}
+	if result.Next != nil {
+		resp.NextPageToken = EncodeToken(*result.Next)
+	}
+	return resp
+}
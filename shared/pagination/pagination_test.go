@@ -0,0 +1,111 @@
+package pagination
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	commonv1 "github.com/safar/microservices-demo/proto/common/v1"
+)
+
+func TestTokenRoundTrip(t *testing.T) {
+	cursor := Cursor{
+		CreatedAt: time.Date(2026, 3, 4, 5, 6, 7, 123456000, time.UTC),
+		ID:        "6f1c2d3e-0000-4000-8000-000000000001",
+	}
+
+	got, err := DecodeToken(EncodeToken(cursor))
+	if err != nil {
+		t.Fatalf("DecodeToken: %v", err)
+	}
+	if !got.CreatedAt.Equal(cursor.CreatedAt) || got.ID != cursor.ID {
+		t.Errorf("DecodeToken = %+v, want %+v", got, cursor)
+	}
+}
+
+func TestDecodeTokenRejectsGarbage(t *testing.T) {
+	for _, token := range []string{"not a token", "e30", "bnVsbA"} {
+		if _, err := DecodeToken(token); !errors.Is(err, ErrInvalidPageToken) {
+			t.Errorf("DecodeToken(%q) error = %v, want ErrInvalidPageToken", token, err)
+		}
+	}
+}
+
+func TestFromProto(t *testing.T) {
+	page, err := FromProto(&commonv1.Pagination{Page: 3, PageSize: 25}, 10)
+	if err != nil {
+		t.Fatalf("FromProto: %v", err)
+	}
+	if page.Keyset || page.Offset() != 50 || page.Limit() != 25 || page.CountMode() != CountExact {
+		t.Errorf("page numbers: got %+v, offset %d, limit %d", page, page.Offset(), page.Limit())
+	}
+
+	page, err = FromProto(&commonv1.Pagination{UsePageToken: true}, 10)
+	if err != nil {
+		t.Fatalf("FromProto: %v", err)
+	}
+	if !page.Keyset || page.After != nil || page.Offset() != 0 || page.Limit() != 11 || page.CountMode() != CountNone {
+		t.Errorf("first cursor page: got %+v, offset %d, limit %d", page, page.Offset(), page.Limit())
+	}
+
+	after := Cursor{CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), ID: "b"}
+	page, err = FromProto(&commonv1.Pagination{
+		Page:      7,
+		PageToken: EncodeToken(after),
+		Count:     commonv1.CountMode_COUNT_MODE_APPROXIMATE,
+	}, 10)
+	if err != nil {
+		t.Fatalf("FromProto: %v", err)
+	}
+	if !page.Keyset || page.After == nil || page.After.ID != "b" || page.Offset() != 0 || page.CountMode() != CountApproximate {
+		t.Errorf("next cursor page: got %+v", page)
+	}
+	condition, args := page.Condition("p.created_at", "p.id", 3)
+	if condition != "(p.created_at, p.id) < ($3, $4)" || len(args) != 2 {
+		t.Errorf("Condition = %q, %v", condition, args)
+	}
+
+	if _, err := FromProto(&commonv1.Pagination{PageToken: "garbage"}, 10); !errors.Is(err, ErrInvalidPageToken) {
+		t.Errorf("FromProto with a bad token error = %v, want ErrInvalidPageToken", err)
+	}
+}
+
+func TestTrimReturnsNextCursorOnlyWhenThereIsMore(t *testing.T) {
+	type row struct {
+		id        string
+		createdAt time.Time
+	}
+	cursor := func(r row) Cursor { return Cursor{CreatedAt: r.createdAt, ID: r.id} }
+	rows := []row{{id: "c"}, {id: "b"}, {id: "a"}}
+	page := Page{Size: 2, Keyset: true}
+
+	got, next := Trim(page, rows, cursor)
+	if len(got) != 2 || next == nil || next.ID != "b" {
+		t.Errorf("Trim with a next page = %v, %v", got, next)
+	}
+
+	got, next = Trim(page, rows[:2], cursor)
+	if len(got) != 2 || next != nil {
+		t.Errorf("Trim on the last page = %v, %v", got, next)
+	}
+}
+
+func TestToProto(t *testing.T) {
+	resp := ToProto(Page{Number: 2, Size: 10}, Result{Total: 21, Counted: true})
+	if resp.TotalPages != 3 || resp.TotalCount != 21 || !resp.TotalCounted || resp.NextPageToken != "" {
+		t.Errorf("ToProto by page number = %+v", resp)
+	}
+
+	next := Cursor{CreatedAt: time.Now().UTC(), ID: "x"}
+	resp = ToProto(Page{Size: 10, Keyset: true}, Result{Next: &next})
+	if resp.TotalCounted || resp.TotalPages != 0 || resp.NextPageToken != EncodeToken(next) {
+		t.Errorf("ToProto by cursor = %+v", resp)
+	}
+}
+
+func TestPlanRows(t *testing.T) {
+	rows, err := planRows(`[{"Plan": {"Node Type": "Seq Scan", "Plan Rows": 1234, "Plan Width": 4}}]`)
+	if err != nil || rows != 1234 {
+		t.Errorf("planRows = %d, %v, want 1234", rows, err)
+	}
+}